@@ -0,0 +1,170 @@
+package api
+
+import (
+    "context"
+    "errors"
+    "log"
+    "net"
+
+    "google.golang.org/grpc"
+    "google.golang.org/grpc/codes"
+    "google.golang.org/grpc/status"
+
+    "smart-crawler/models"
+    pb "smart-crawler/proto/crawlerpb"
+)
+
+// grpcService implements pb.CrawlerServiceServer on top of the same job
+// registry as the REST API, so crawls started through either are visible
+// to both.
+type grpcService struct {
+    pb.UnimplementedCrawlerServiceServer
+    server *Server
+}
+
+// ServeGRPC serves the gRPC control API until ctx is cancelled
+func (s *Server) ServeGRPC(ctx context.Context, addr string) error {
+    listener, err := net.Listen("tcp", addr)
+    if err != nil {
+        return err
+    }
+
+    grpcServer := grpc.NewServer()
+    pb.RegisterCrawlerServiceServer(grpcServer, &grpcService{server: s})
+
+    go func() {
+        <-ctx.Done()
+        grpcServer.GracefulStop()
+    }()
+
+    log.Printf("gRPC server listening on %s", addr)
+    if err := grpcServer.Serve(listener); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+        return err
+    }
+    return nil
+}
+
+func (g *grpcService) StartCrawl(ctx context.Context, req *pb.StartCrawlRequest) (*pb.CrawlStatus, error) {
+    crawlReq := startCrawlRequest{URL: req.Url, Depth: 3, Workers: 10, Mode: "smart"}
+    if req.Depth != 0 {
+        crawlReq.Depth = int(req.Depth)
+    }
+    if req.Workers != 0 {
+        crawlReq.Workers = int(req.Workers)
+    }
+    if req.Mode != "" {
+        crawlReq.Mode = req.Mode
+    }
+
+    job, err := g.server.startJob(crawlReq)
+    if err != nil {
+        return nil, status.Error(codes.InvalidArgument, err.Error())
+    }
+    return toProtoStatus(job.snapshot()), nil
+}
+
+func (g *grpcService) StopCrawl(ctx context.Context, req *pb.StopCrawlRequest) (*pb.CrawlStatus, error) {
+    job, err := g.lookupJob(req.CrawlId)
+    if err != nil {
+        return nil, err
+    }
+    job.stop()
+    return toProtoStatus(job.snapshot()), nil
+}
+
+func (g *grpcService) GetStats(ctx context.Context, req *pb.GetStatsRequest) (*pb.CrawlStatus, error) {
+    job, err := g.lookupJob(req.CrawlId)
+    if err != nil {
+        return nil, err
+    }
+    return toProtoStatus(job.snapshot()), nil
+}
+
+// StreamPages sends every page the crawl stores from the time of the call
+// until the crawl finishes or the client goes away.
+func (g *grpcService) StreamPages(req *pb.StreamPagesRequest, stream pb.CrawlerService_StreamPagesServer) error {
+    job, err := g.lookupJob(req.CrawlId)
+    if err != nil {
+        return err
+    }
+
+    pages, unsubscribe := job.subscribe()
+    defer unsubscribe()
+
+    for {
+        select {
+        case page := <-pages:
+            if err := stream.Send(toProtoPage(page, req.IncludeContent)); err != nil {
+                return err
+            }
+        case <-job.finished:
+            // Pages the crawl stored last may still be buffered
+            for {
+                select {
+                case page := <-pages:
+                    if err := stream.Send(toProtoPage(page, req.IncludeContent)); err != nil {
+                        return err
+                    }
+                default:
+                    return nil
+                }
+            }
+        case <-stream.Context().Done():
+            return stream.Context().Err()
+        }
+    }
+}
+
+func (g *grpcService) lookupJob(id string) (*Job, error) {
+    job, exists := g.server.job(id)
+    if !exists {
+        return nil, status.Errorf(codes.NotFound, "crawl %q not found", id)
+    }
+    return job, nil
+}
+
+func toProtoPage(page *models.Page, includeContent bool) *pb.Page {
+    out := &pb.Page{
+        Id:             page.ID,
+        Url:            page.URL,
+        Title:          page.Title,
+        StatusCode:     int32(page.StatusCode),
+        ContentType:    page.ContentType,
+        Size:           page.Size,
+        LoadTimeMs:     page.LoadTime,
+        Depth:          int32(page.Depth),
+        ParentUrl:      page.ParentURL,
+        Hash:           page.Hash,
+        Importance:     page.Importance,
+        ContentQuality: page.ContentQuality,
+        LinkDensity:    page.LinkDensity,
+    }
+    if includeContent {
+        out.Content = page.Content
+    }
+    return out
+}
+
+func toProtoStatus(job JobStatus) *pb.CrawlStatus {
+    out := &pb.CrawlStatus{
+        CrawlId:         job.ID,
+        Url:             job.URL,
+        Mode:            job.Mode,
+        Status:          job.Status,
+        Error:           job.Error,
+        PagesCrawled:    int64(job.PagesCrawled),
+        LinksDiscovered: int64(job.LinksDiscovered),
+        Errors:          int64(job.Errors),
+    }
+    if job.Stats != nil {
+        out.Stats = &pb.CrawlStats{
+            PagesProcessed: int64(job.Stats.PagesProcessed),
+            PagesSkipped:   int64(job.Stats.PagesSkipped),
+            Errors:         int64(job.Stats.Errors),
+            DurationMs:     job.Stats.Duration.Milliseconds(),
+            AvgLoadTimeMs:  job.Stats.AvgLoadTime.Milliseconds(),
+            TotalSize:      job.Stats.TotalSize,
+        }
+    }
+    return out
+}
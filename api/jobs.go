@@ -0,0 +1,225 @@
+package api
+
+import (
+    "context"
+    "sync"
+    "time"
+
+    "smart-crawler/crawler"
+    "smart-crawler/models"
+)
+
+type crawlRunner interface {
+    Crawl(ctx context.Context, startURL string, maxDepth int) (*models.CrawlStats, error)
+    Events() <-chan crawler.Event
+}
+
+const (
+    JobRunning   = "running"
+    JobCompleted = "completed"
+    JobCancelled = "cancelled"
+    JobFailed    = "failed"
+)
+
+const subscriberBufferSize = 1024
+
+// Job is a crawl started through the API. Live counters are fed from the
+// crawler's event stream; Stats is only set once the crawl has returned.
+type Job struct {
+    ID      string
+    request startCrawlRequest
+
+    status          string
+    err             string
+    startedAt       time.Time
+    finishedAt      time.Time
+    pagesCrawled    int
+    linksDiscovered int
+    errors          int
+    crawlID         int64 // Session, once the crawler has created it
+    crawlUUID       string
+    stats           *models.CrawlStats
+
+    subscribers map[chan *models.Page]struct{}
+    finished    chan struct{}       // Closed once the crawl has returned
+    onPage      func(*models.Page) // Called with each saved page, if set
+
+    ctx    context.Context
+    cancel context.CancelFunc
+    mutex  sync.RWMutex
+}
+
+// JobStatus is the JSON view of a Job
+type JobStatus struct {
+    ID              string             `json:"id"`
+    URL             string             `json:"url"`
+    Mode            string             `json:"mode"`
+    Depth           int                `json:"depth"`
+    Workers         int                `json:"workers"`
+    CrawlID         int64              `json:"crawl_id,omitempty"`
+    CrawlUUID       string             `json:"crawl_uuid,omitempty"`
+    Status          string             `json:"status"`
+    Error           string             `json:"error,omitempty"`
+    StartedAt       time.Time          `json:"started_at"`
+    FinishedAt      *time.Time         `json:"finished_at,omitempty"`
+    PagesCrawled    int                `json:"pages_crawled"`
+    LinksDiscovered int                `json:"links_discovered"`
+    Errors          int                `json:"errors"`
+    Stats           *models.CrawlStats `json:"stats,omitempty"`
+}
+
+// newJob creates a job whose context is cancelled by stop, so the job can be
+// stopped as soon as it is published, before it has started
+func newJob(parent context.Context, id string, req startCrawlRequest) *Job {
+    ctx, cancel := context.WithCancel(parent)
+    return &Job{
+        ID:        id,
+        request:   req,
+        status:    JobRunning,
+        startedAt: time.Now(),
+
+        subscribers: make(map[chan *models.Page]struct{}),
+        finished:    make(chan struct{}),
+
+        ctx:    ctx,
+        cancel: cancel,
+    }
+}
+
+func (j *Job) start(runner crawlRunner) {
+    ctx, cancel := j.ctx, j.cancel
+
+    events := runner.Events()
+    done := make(chan struct{})
+    drained := make(chan struct{})
+
+    go func() {
+        defer close(drained)
+        for {
+            select {
+            case event := <-events:
+                j.handle(event)
+            case <-done:
+                // The crawl has returned, so nothing more is sent: what is
+                // still buffered is the rest of its events
+                for {
+                    select {
+                    case event := <-events:
+                        j.handle(event)
+                    default:
+                        return
+                    }
+                }
+            }
+        }
+    }()
+
+    go func() {
+        defer cancel()
+
+        stats, err := runner.Crawl(ctx, j.request.URL, j.request.Depth)
+        close(done)
+        <-drained
+
+        j.mutex.Lock()
+        defer j.mutex.Unlock()
+        defer close(j.finished)
+
+        j.finishedAt = time.Now()
+        j.stats = stats
+        switch {
+        case err != nil:
+            j.status = JobFailed
+            j.err = err.Error()
+        case j.status == JobCancelled || ctx.Err() != nil:
+            j.status = JobCancelled
+        default:
+            j.status = JobCompleted
+        }
+    }()
+}
+
+func (j *Job) handle(event crawler.Event) {
+    j.record(event)
+    if event.Type == crawler.PageCrawled && j.onPage != nil {
+        j.onPage(event.Page)
+    }
+}
+
+func (j *Job) record(event crawler.Event) {
+    j.mutex.Lock()
+    defer j.mutex.Unlock()
+
+    if event.CrawlUUID != "" {
+        j.crawlID, j.crawlUUID = event.CrawlID, event.CrawlUUID
+    }
+    switch event.Type {
+    case crawler.PageCrawled:
+        j.pagesCrawled++
+        for subscriber := range j.subscribers {
+            select {
+            case subscriber <- event.Page:
+            default:
+                // Slow subscribers miss pages rather than stall the crawl
+            }
+        }
+    case crawler.LinkDiscovered:
+        j.linksDiscovered++
+    case crawler.ErrorOccurred:
+        j.errors++
+    }
+}
+
+// subscribe returns a channel receiving every page the job crawls from now
+// on. Call the returned function to unsubscribe.
+func (j *Job) subscribe() (<-chan *models.Page, func()) {
+    pages := make(chan *models.Page, subscriberBufferSize)
+
+    j.mutex.Lock()
+    j.subscribers[pages] = struct{}{}
+    j.mutex.Unlock()
+
+    return pages, func() {
+        j.mutex.Lock()
+        delete(j.subscribers, pages)
+        j.mutex.Unlock()
+    }
+}
+
+func (j *Job) stop() {
+    j.mutex.Lock()
+    if j.status == JobRunning {
+        j.status = JobCancelled
+    }
+    j.mutex.Unlock()
+
+    j.cancel()
+}
+
+func (j *Job) snapshot() JobStatus {
+    j.mutex.RLock()
+    defer j.mutex.RUnlock()
+
+    status := JobStatus{
+        ID:              j.ID,
+        URL:             j.request.URL,
+        Mode:            j.request.Mode,
+        Depth:           j.request.Depth,
+        Workers:         j.request.Workers,
+        CrawlID:         j.crawlID,
+        CrawlUUID:       j.crawlUUID,
+        Status:          j.status,
+        Error:           j.err,
+        StartedAt:       j.startedAt,
+        PagesCrawled:    j.pagesCrawled,
+        LinksDiscovered: j.linksDiscovered,
+        Errors:          j.errors,
+        Stats:           j.stats,
+    }
+    if !j.finishedAt.IsZero() {
+        finishedAt := j.finishedAt
+        status.FinishedAt = &finishedAt
+    }
+
+    return status
+}
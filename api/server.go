@@ -0,0 +1,695 @@
+package api
+
+import (
+    "context"
+    "database/sql"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "log"
+    "net/http"
+    "strconv"
+    "sync"
+    "time"
+
+    "github.com/google/uuid"
+
+    "smart-crawler/audit"
+    "smart-crawler/crawler"
+    "smart-crawler/database"
+    "smart-crawler/models"
+    "smart-crawler/utils"
+)
+
+// Server exposes crawl job control and stored results over HTTP
+type Server struct {
+    db            *database.PostgresDB
+    tagRules      []crawler.TagRule
+    auditLog      *audit.Log
+    proxies       *crawler.ProxyPool
+    auth          *crawler.Auth
+    headers       *crawler.HeaderOverrides
+    crawlerOpts   []crawler.Option
+    subscriptions *subscriptionWatcher
+    jobs          map[string]*Job
+    nextID        int
+    mutex         sync.RWMutex
+    baseCtx       context.Context
+}
+
+// NewServer creates a server whose crawl jobs are cancelled with ctx
+func NewServer(ctx context.Context, db *database.PostgresDB, tagRules []crawler.TagRule) *Server {
+    return &Server{
+        db:            db,
+        tagRules:      tagRules,
+        subscriptions: newSubscriptionWatcher(ctx, db),
+        jobs:          make(map[string]*Job),
+        baseCtx:       ctx,
+    }
+}
+
+// SetAuditLog makes every crawl started through the API record its requests
+func (s *Server) SetAuditLog(log *audit.Log) {
+    s.auditLog = log
+}
+
+// SetProxyPool makes crawls started through the API fetch through pool; nil
+// fetches directly
+func (s *Server) SetProxyPool(pool *crawler.ProxyPool) {
+    s.proxies = pool
+}
+
+// SetAuth makes crawls started through the API authenticate with auth; nil
+// crawls anonymously
+func (s *Server) SetAuth(auth *crawler.Auth) {
+    s.auth = auth
+}
+
+// SetHeaders sends per-domain header overrides with crawls started through
+// the API; nil sends the crawler's own headers only
+func (s *Server) SetHeaders(overrides *crawler.HeaderOverrides) {
+    s.headers = overrides
+}
+
+// SetCrawlerOptions builds the crawlers of crawls started through the API
+// with opts, such as a User-Agent or rate limit, before each job's workers
+// and scope
+func (s *Server) SetCrawlerOptions(opts ...crawler.Option) {
+    s.crawlerOpts = opts
+}
+
+func (s *Server) Handler() http.Handler {
+    mux := http.NewServeMux()
+    mux.HandleFunc("POST /crawls", s.handleStartCrawl)
+    mux.HandleFunc("GET /crawls", s.handleListCrawls)
+    mux.HandleFunc("GET /crawls/{id}", s.handleGetCrawl)
+    mux.HandleFunc("GET /crawls/{id}/hosts", s.handleGetCrawlHosts)
+    mux.HandleFunc("DELETE /crawls/{id}", s.handleCancelCrawl)
+    mux.HandleFunc("GET /sessions", s.handleListSessions)
+    mux.HandleFunc("GET /sessions/{id}", s.handleGetSession)
+    mux.HandleFunc("DELETE /sessions/{id}", s.handleDeleteSession)
+    mux.HandleFunc("GET /sessions/{id}/security", s.handleGetSessionSecurity)
+    mux.HandleFunc("GET /pages", s.handleListPages)
+    mux.HandleFunc("GET /pages/{id}/tags", s.handleGetTags)
+    mux.HandleFunc("POST /pages/{id}/tags", s.handleAddTags)
+    mux.HandleFunc("DELETE /pages/{id}/tags/{tag}", s.handleRemoveTag)
+    mux.HandleFunc("GET /pages/{id}/extractions", s.handleGetPageExtractions)
+    mux.HandleFunc("GET /extractions", s.handleListExtractions)
+    mux.HandleFunc("GET /pages/{id}/images", s.handleGetPageImages)
+    mux.HandleFunc("GET /images", s.handleListImages)
+    mux.HandleFunc("GET /pages/{id}/changes", s.handleGetPageChanges)
+    mux.HandleFunc("GET /changes", s.handleListChanges)
+    mux.HandleFunc("POST /subscriptions", s.handleCreateSubscription)
+    mux.HandleFunc("GET /subscriptions", s.handleListSubscriptions)
+    mux.HandleFunc("GET /subscriptions/{id}", s.handleGetSubscription)
+    mux.HandleFunc("DELETE /subscriptions/{id}", s.handleDeleteSubscription)
+    mux.HandleFunc("GET /subscriptions/{id}/matches", s.handleListMatches)
+    return mux
+}
+
+// ListenAndServe serves the REST API until ctx is cancelled
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+    httpServer := &http.Server{
+        Addr:              addr,
+        Handler:           s.Handler(),
+        ReadHeaderTimeout: 10 * time.Second,
+    }
+
+    go func() {
+        <-ctx.Done()
+        shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+        defer cancel()
+        httpServer.Shutdown(shutdownCtx)
+    }()
+
+    log.Printf("API server listening on %s", addr)
+    if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+        return err
+    }
+    return nil
+}
+
+type startCrawlRequest struct {
+    URL     string `json:"url"`
+    Depth   int    `json:"depth"`
+    Workers int    `json:"workers"`
+    Mode    string `json:"mode"`
+    Scope   string `json:"scope"`
+}
+
+func (s *Server) handleStartCrawl(w http.ResponseWriter, r *http.Request) {
+    req := startCrawlRequest{Depth: 3, Workers: 10, Mode: "smart"}
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+        return
+    }
+
+    job, err := s.startJob(req)
+    if err != nil {
+        writeError(w, http.StatusBadRequest, err)
+        return
+    }
+
+    writeJSON(w, http.StatusAccepted, job.snapshot())
+}
+
+// startJob validates req and starts the crawl it describes
+func (s *Server) startJob(req startCrawlRequest) (*Job, error) {
+    if !utils.IsValidURL(req.URL) {
+        return nil, fmt.Errorf("invalid url %q", req.URL)
+    }
+    if req.Depth < 0 {
+        return nil, errors.New("depth must be >= 0")
+    }
+
+    // Workers, scope, and tag rules are validated by the constructors
+    opts := append(append([]crawler.Option(nil), s.crawlerOpts...),
+        crawler.WithWorkers(req.Workers), crawler.WithScope(crawler.Scope(req.Scope)), crawler.WithTagRules(s.tagRules))
+    if s.proxies != nil {
+        opts = append(opts, crawler.WithProxies(s.proxies))
+    }
+    if s.auth != nil {
+        opts = append(opts, crawler.WithAuth(s.auth))
+    }
+    if s.headers != nil {
+        opts = append(opts, crawler.WithHeaders(s.headers))
+    }
+    if s.auditLog != nil {
+        opts = append(opts, crawler.WithAuditLog(s.auditLog))
+    }
+
+    var runner crawlRunner
+    switch req.Mode {
+    case "smart":
+        smartCrawler, err := crawler.NewSmart(s.db, opts...)
+        if err != nil {
+            return nil, err
+        }
+        runner = smartCrawler
+    case "traditional":
+        traditionalCrawler, err := crawler.NewTraditional(s.db, opts...)
+        if err != nil {
+            return nil, err
+        }
+        runner = traditionalCrawler
+    case "sitemap":
+        sitemapCrawler, err := crawler.NewTraditional(s.db, opts...)
+        if err != nil {
+            return nil, err
+        }
+        sitemapCrawler.SetSitemapOnly(true)
+        runner = sitemapCrawler
+    default:
+        return nil, fmt.Errorf("invalid mode %q, use 'smart', 'traditional', or 'sitemap'", req.Mode)
+    }
+
+    s.mutex.Lock()
+    s.nextID++
+    job := newJob(s.baseCtx, strconv.Itoa(s.nextID), req)
+    job.onPage = s.subscriptions.evaluate
+    s.jobs[job.ID] = job
+    s.mutex.Unlock()
+
+    job.start(runner)
+
+    return job, nil
+}
+
+func (s *Server) job(id string) (*Job, bool) {
+    s.mutex.RLock()
+    defer s.mutex.RUnlock()
+
+    job, exists := s.jobs[id]
+    return job, exists
+}
+
+func (s *Server) handleListCrawls(w http.ResponseWriter, r *http.Request) {
+    s.mutex.RLock()
+    jobs := make([]JobStatus, 0, len(s.jobs))
+    for i := 1; i <= s.nextID; i++ {
+        if job, exists := s.jobs[strconv.Itoa(i)]; exists {
+            jobs = append(jobs, job.snapshot())
+        }
+    }
+    s.mutex.RUnlock()
+
+    writeJSON(w, http.StatusOK, jobs)
+}
+
+func (s *Server) handleGetCrawl(w http.ResponseWriter, r *http.Request) {
+    job, ok := s.lookupJob(w, r)
+    if !ok {
+        return
+    }
+    writeJSON(w, http.StatusOK, job.snapshot())
+}
+
+// handleGetCrawlHosts lists a finished crawl's stats per host, sorted by
+// sort (pages by default) and cut to limit
+func (s *Server) handleGetCrawlHosts(w http.ResponseWriter, r *http.Request) {
+    job, ok := s.lookupJob(w, r)
+    if !ok {
+        return
+    }
+    limit, err := queryInt(r, "limit", 100)
+    if err != nil || limit < 1 || limit > 10000 {
+        writeError(w, http.StatusBadRequest, errors.New("limit must be between 1 and 10000"))
+        return
+    }
+    order := r.URL.Query().Get("sort")
+    if order == "" {
+        order = "pages"
+    }
+
+    status := job.snapshot()
+    if status.Stats == nil {
+        writeError(w, http.StatusConflict, fmt.Errorf("crawl %s has not finished; its host stats are available once it has", job.ID))
+        return
+    }
+    hosts, err := crawler.SortHosts(status.Stats.Hosts, order)
+    if err != nil {
+        writeError(w, http.StatusBadRequest, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, hosts[:min(limit, len(hosts))])
+}
+
+func (s *Server) handleCancelCrawl(w http.ResponseWriter, r *http.Request) {
+    job, ok := s.lookupJob(w, r)
+    if !ok {
+        return
+    }
+    job.stop()
+    writeJSON(w, http.StatusOK, job.snapshot())
+}
+
+func (s *Server) lookupJob(w http.ResponseWriter, r *http.Request) (*Job, bool) {
+    job, exists := s.job(r.PathValue("id"))
+    if !exists {
+        writeError(w, http.StatusNotFound, fmt.Errorf("crawl %q not found", r.PathValue("id")))
+        return nil, false
+    }
+    return job, true
+}
+
+// Sessions are the crawls recorded in the database, including ones not
+// started through this server; /crawls only tracks this server's jobs.
+func (s *Server) handleListSessions(w http.ResponseWriter, r *http.Request) {
+    limit, err := queryInt(r, "limit", 50)
+    if err != nil || limit < 1 || limit > 1000 {
+        writeError(w, http.StatusBadRequest, errors.New("limit must be between 1 and 1000"))
+        return
+    }
+
+    crawls, err := s.db.ListCrawls(limit)
+    if err != nil {
+        writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, crawls)
+}
+
+// handleGetSession looks a session up by its id or its UUID
+func (s *Server) handleGetSession(w http.ResponseWriter, r *http.Request) {
+    var crawl *models.Crawl
+    var err error
+    if crawlUUID := r.PathValue("id"); uuid.Validate(crawlUUID) == nil {
+        crawl, err = s.db.GetCrawlByUUID(crawlUUID)
+    } else {
+        crawlID, ok := pathID(w, r, "session")
+        if !ok {
+            return
+        }
+        crawl, err = s.db.GetCrawl(crawlID)
+    }
+    if errors.Is(err, sql.ErrNoRows) {
+        writeError(w, http.StatusNotFound, fmt.Errorf("session %s not found", r.PathValue("id")))
+        return
+    }
+    if err != nil {
+        writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, crawl)
+}
+
+// handleGetSessionSecurity reports the security headers and TLS of each
+// host a session fetched, flagging certificates expiring within
+// expiry_days (30 by default)
+func (s *Server) handleGetSessionSecurity(w http.ResponseWriter, r *http.Request) {
+    crawlID, ok := pathID(w, r, "session")
+    if !ok {
+        return
+    }
+    days, err := queryInt(r, "expiry_days", 30)
+    if err != nil || days < 0 {
+        writeError(w, http.StatusBadRequest, errors.New("expiry_days must be a non-negative number"))
+        return
+    }
+
+    if _, err := s.db.GetCrawl(crawlID); errors.Is(err, sql.ErrNoRows) {
+        writeError(w, http.StatusNotFound, fmt.Errorf("session %d not found", crawlID))
+        return
+    } else if err != nil {
+        writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+    hosts, err := s.db.SecurityReport(crawlID, time.Now(), time.Duration(days)*24*time.Hour)
+    if err != nil {
+        writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, hosts)
+}
+
+func (s *Server) handleDeleteSession(w http.ResponseWriter, r *http.Request) {
+    crawlID, ok := pathID(w, r, "session")
+    if !ok {
+        return
+    }
+
+    err := s.db.DeleteCrawl(crawlID)
+    if errors.Is(err, sql.ErrNoRows) {
+        writeError(w, http.StatusNotFound, fmt.Errorf("session %d not found", crawlID))
+        return
+    }
+    if err != nil {
+        writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+    w.WriteHeader(http.StatusNoContent)
+}
+
+// handleListPages supports crawl_id, crawl_uuid, host, min_depth, max_depth, status, min_quality,
+// max_quality, since, until (RFC 3339), tag, spam, sort, order, cursor, and limit.
+func (s *Server) handleListPages(w http.ResponseWriter, r *http.Request) {
+    query, err := parsePageQuery(r)
+    if err != nil {
+        writeError(w, http.StatusBadRequest, err)
+        return
+    }
+
+    list, err := s.db.QueryPages(query)
+    if errors.Is(err, database.ErrInvalidQuery) {
+        writeError(w, http.StatusBadRequest, err)
+        return
+    }
+    if err != nil {
+        writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+
+    writeJSON(w, http.StatusOK, list)
+}
+
+func parsePageQuery(r *http.Request) (database.PageQuery, error) {
+    values := r.URL.Query()
+    query := database.PageQuery{
+        CrawlUUID:  values.Get("crawl_uuid"),
+        Host:       values.Get("host"),
+        Tag:        values.Get("tag"),
+        SchemaType: values.Get("schema_type"),
+        SortBy:     values.Get("sort"),
+        Cursor:     values.Get("cursor"),
+    }
+
+    var err error
+    if query.Limit, err = queryInt(r, "limit", 50); err != nil || query.Limit < 1 || query.Limit > 1000 {
+        return query, errors.New("limit must be between 1 and 1000")
+    }
+    if query.StatusCode, err = queryInt(r, "status", 0); err != nil {
+        return query, errors.New("status must be an integer")
+    }
+    if val := values.Get("crawl_id"); val != "" {
+        if query.CrawlID, err = strconv.ParseInt(val, 10, 64); err != nil {
+            return query, errors.New("crawl_id must be an integer")
+        }
+    }
+
+    if val := values.Get("spam"); val != "" {
+        spam, err := strconv.ParseBool(val)
+        if err != nil {
+            return query, errors.New("spam must be true or false")
+        }
+        query.Spam = &spam
+    }
+
+    switch values.Get("order") {
+    case "", "asc":
+    case "desc":
+        query.Descending = true
+    default:
+        return query, errors.New("order must be 'asc' or 'desc'")
+    }
+
+    for key, target := range map[string]**int{"min_depth": &query.MinDepth, "max_depth": &query.MaxDepth} {
+        if val := values.Get(key); val != "" {
+            depth, err := strconv.Atoi(val)
+            if err != nil {
+                return query, fmt.Errorf("%s must be an integer", key)
+            }
+            *target = &depth
+        }
+    }
+
+    for key, target := range map[string]**float64{"min_quality": &query.MinQuality, "max_quality": &query.MaxQuality} {
+        if val := values.Get(key); val != "" {
+            quality, err := strconv.ParseFloat(val, 64)
+            if err != nil {
+                return query, fmt.Errorf("%s must be a number", key)
+            }
+            *target = &quality
+        }
+    }
+
+    for key, target := range map[string]*time.Time{"since": &query.CrawledAfter, "until": &query.CrawledBefore} {
+        if val := values.Get(key); val != "" {
+            t, err := time.Parse(time.RFC3339, val)
+            if err != nil {
+                return query, fmt.Errorf("%s must be an RFC 3339 timestamp", key)
+            }
+            *target = t
+        }
+    }
+
+    return query, nil
+}
+
+func (s *Server) handleGetPageExtractions(w http.ResponseWriter, r *http.Request) {
+    pageID, ok := pathPageID(w, r)
+    if !ok {
+        return
+    }
+
+    extractions, err := s.db.GetPageExtractions(pageID)
+    if err != nil {
+        writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, extractions)
+}
+
+// handleListExtractions pages through the records extracted in a crawl
+// session, oldest first
+func (s *Server) handleListExtractions(w http.ResponseWriter, r *http.Request) {
+    values := r.URL.Query()
+    crawlID, err := strconv.ParseInt(values.Get("crawl_id"), 10, 64)
+    if err != nil {
+        writeError(w, http.StatusBadRequest, errors.New("crawl_id must be an integer"))
+        return
+    }
+    limit, err := queryInt(r, "limit", 50)
+    if err != nil || limit < 1 || limit > 1000 {
+        writeError(w, http.StatusBadRequest, errors.New("limit must be between 1 and 1000"))
+        return
+    }
+    var after int64
+    if val := values.Get("after"); val != "" {
+        if after, err = strconv.ParseInt(val, 10, 64); err != nil {
+            writeError(w, http.StatusBadRequest, errors.New("after must be an integer"))
+            return
+        }
+    }
+
+    extractions, err := s.db.ListExtractions(crawlID, values.Get("rule"), after, limit)
+    if err != nil {
+        writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, extractions)
+}
+
+func (s *Server) handleGetPageImages(w http.ResponseWriter, r *http.Request) {
+    pageID, ok := pathPageID(w, r)
+    if !ok {
+        return
+    }
+
+    images, err := s.db.GetPageImages(pageID)
+    if err != nil {
+        writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, images)
+}
+
+// handleListImages pages through the images recorded in a crawl session,
+// oldest first
+func (s *Server) handleListImages(w http.ResponseWriter, r *http.Request) {
+    values := r.URL.Query()
+    crawlID, err := strconv.ParseInt(values.Get("crawl_id"), 10, 64)
+    if err != nil {
+        writeError(w, http.StatusBadRequest, errors.New("crawl_id must be an integer"))
+        return
+    }
+    limit, err := queryInt(r, "limit", 50)
+    if err != nil || limit < 1 || limit > 1000 {
+        writeError(w, http.StatusBadRequest, errors.New("limit must be between 1 and 1000"))
+        return
+    }
+    var after int64
+    if val := values.Get("after"); val != "" {
+        if after, err = strconv.ParseInt(val, 10, 64); err != nil {
+            writeError(w, http.StatusBadRequest, errors.New("after must be an integer"))
+            return
+        }
+    }
+
+    images, err := s.db.ListImages(crawlID, after, limit)
+    if err != nil {
+        writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, images)
+}
+
+func (s *Server) handleGetPageChanges(w http.ResponseWriter, r *http.Request) {
+    pageID, ok := pathPageID(w, r)
+    if !ok {
+        return
+    }
+
+    changes, err := s.db.GetPageChanges(pageID)
+    if err != nil {
+        writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, changes)
+}
+
+// handleListChanges pages through the changes revisits found in a crawl
+// session's pages, oldest first
+func (s *Server) handleListChanges(w http.ResponseWriter, r *http.Request) {
+    values := r.URL.Query()
+    crawlID, err := strconv.ParseInt(values.Get("crawl_id"), 10, 64)
+    if err != nil {
+        writeError(w, http.StatusBadRequest, errors.New("crawl_id must be an integer"))
+        return
+    }
+    limit, err := queryInt(r, "limit", 50)
+    if err != nil || limit < 1 || limit > 1000 {
+        writeError(w, http.StatusBadRequest, errors.New("limit must be between 1 and 1000"))
+        return
+    }
+    var after int64
+    if val := values.Get("after"); val != "" {
+        if after, err = strconv.ParseInt(val, 10, 64); err != nil {
+            writeError(w, http.StatusBadRequest, errors.New("after must be an integer"))
+            return
+        }
+    }
+
+    changes, err := s.db.ListPageChanges(crawlID, after, limit)
+    if err != nil {
+        writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, changes)
+}
+
+func (s *Server) handleGetTags(w http.ResponseWriter, r *http.Request) {
+    pageID, ok := pathPageID(w, r)
+    if !ok {
+        return
+    }
+
+    tags, err := s.db.GetPageTags(pageID)
+    if err != nil {
+        writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, tags)
+}
+
+type addTagsRequest struct {
+    Tags []string `json:"tags"`
+}
+
+func (s *Server) handleAddTags(w http.ResponseWriter, r *http.Request) {
+    pageID, ok := pathPageID(w, r)
+    if !ok {
+        return
+    }
+
+    var req addTagsRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Tags) == 0 {
+        writeError(w, http.StatusBadRequest, errors.New(`body must be {"tags": ["..."]}`))
+        return
+    }
+
+    if err := s.db.AddPageTags(pageID, req.Tags, "manual"); err != nil {
+        writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+
+    tags, err := s.db.GetPageTags(pageID)
+    if err != nil {
+        writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, tags)
+}
+
+func (s *Server) handleRemoveTag(w http.ResponseWriter, r *http.Request) {
+    pageID, ok := pathPageID(w, r)
+    if !ok {
+        return
+    }
+
+    if err := s.db.RemovePageTag(pageID, r.PathValue("tag")); err != nil {
+        writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+    w.WriteHeader(http.StatusNoContent)
+}
+
+func pathPageID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+    return pathID(w, r, "page")
+}
+
+func pathID(w http.ResponseWriter, r *http.Request, kind string) (int64, bool) {
+    id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+    if err != nil {
+        writeError(w, http.StatusBadRequest, fmt.Errorf("invalid %s id %q", kind, r.PathValue("id")))
+        return 0, false
+    }
+    return id, true
+}
+
+func queryInt(r *http.Request, key string, defaultVal int) (int, error) {
+    val := r.URL.Query().Get(key)
+    if val == "" {
+        return defaultVal, nil
+    }
+    return strconv.Atoi(val)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(status)
+    json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+    writeJSON(w, status, map[string]string{"error": err.Error()})
+}
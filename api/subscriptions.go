@@ -0,0 +1,366 @@
+package api
+
+import (
+    "bytes"
+    "context"
+    "database/sql"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "log"
+    "net/http"
+    "net/url"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/PuerkitoBio/goquery"
+    "github.com/andybalholm/cascadia"
+
+    "smart-crawler/database"
+    "smart-crawler/models"
+    "smart-crawler/output"
+)
+
+const (
+    snippetLength  = 200
+    webhookTimeout = 10 * time.Second
+)
+
+// subscription is a saved search ready to run against pages
+type subscription struct {
+    models.Subscription
+    keywords []string        // Lowercased
+    selector goquery.Matcher // nil without a selector
+}
+
+func compileSubscription(sub models.Subscription) (*subscription, error) {
+    compiled := &subscription{Subscription: sub}
+    for _, keyword := range sub.Keywords {
+        if keyword = strings.ToLower(strings.TrimSpace(keyword)); keyword != "" {
+            compiled.keywords = append(compiled.keywords, keyword)
+        }
+    }
+    if sub.Selector != "" {
+        selector, err := cascadia.Compile(sub.Selector)
+        if err != nil {
+            return nil, fmt.Errorf("invalid selector %q: %w", sub.Selector, err)
+        }
+        compiled.selector = selector
+    }
+    if len(compiled.keywords) == 0 && compiled.selector == nil {
+        return nil, errors.New("a subscription needs keywords, a selector, or both")
+    }
+    return compiled, nil
+}
+
+// match returns a snippet of where page matches, or false. doc is the
+// page's parsed body, nil if it is not HTML.
+func (sub *subscription) match(page *models.Page, doc *goquery.Document) (string, bool) {
+    text := page.Title + " " + page.Content
+    if sub.selector != nil {
+        if doc == nil {
+            return "", false
+        }
+        selection := doc.FindMatcher(sub.selector)
+        if selection.Length() == 0 {
+            return "", false
+        }
+        text = selection.Text()
+    }
+    text = strings.Join(strings.Fields(text), " ")
+
+    lower := strings.ToLower(text)
+    first := -1
+    for _, keyword := range sub.keywords {
+        i := strings.Index(lower, keyword)
+        if i < 0 && sub.MatchAll {
+            return "", false
+        }
+        if i >= 0 && (first < 0 || i < first) {
+            first = i
+        }
+    }
+    if len(sub.keywords) > 0 && first < 0 {
+        return "", false
+    }
+    return snippet(text, first), true
+}
+
+// snippet cuts about snippetLength bytes of text around offset at, or from
+// its start when at is negative
+func snippet(text string, at int) string {
+    start := 0
+    if at > snippetLength/4 {
+        start = at - snippetLength/4
+    }
+    end := start + snippetLength
+    if end > len(text) {
+        end = len(text)
+    }
+    // Keep whole words and runes
+    if start > 0 {
+        if i := strings.IndexByte(text[start:end], ' '); i >= 0 {
+            start += i + 1
+        }
+    }
+    if end < len(text) {
+        if i := strings.LastIndexByte(text[start:end], ' '); i > 0 {
+            end = start + i
+        }
+    }
+    return strings.ToValidUTF8(text[start:end], "")
+}
+
+// subscriptionWatcher runs the saved subscriptions against each page the
+// server's crawls save, records matches, and delivers them to webhooks.
+// Subscriptions are loaded from the database on first use and reloaded
+// when they change.
+type subscriptionWatcher struct {
+    db     *database.PostgresDB
+    ctx    context.Context
+    client *http.Client
+    subs   []*subscription
+    loaded bool
+    mutex  sync.RWMutex
+}
+
+func newSubscriptionWatcher(ctx context.Context, db *database.PostgresDB) *subscriptionWatcher {
+    return &subscriptionWatcher{
+        db:     db,
+        ctx:    ctx,
+        client: &http.Client{Timeout: webhookTimeout},
+    }
+}
+
+func (w *subscriptionWatcher) reload() error {
+    saved, err := w.db.ListSubscriptions()
+    if err != nil {
+        return err
+    }
+    subs := make([]*subscription, 0, len(saved))
+    for _, sub := range saved {
+        compiled, err := compileSubscription(sub)
+        if err != nil {
+            log.Printf("skipping subscription %d: %v", sub.ID, err)
+            continue
+        }
+        subs = append(subs, compiled)
+    }
+
+    w.mutex.Lock()
+    w.subs, w.loaded = subs, true
+    w.mutex.Unlock()
+    return nil
+}
+
+func (w *subscriptionWatcher) subscriptions() ([]*subscription, error) {
+    w.mutex.RLock()
+    subs, loaded := w.subs, w.loaded
+    w.mutex.RUnlock()
+    if loaded {
+        return subs, nil
+    }
+
+    if err := w.reload(); err != nil {
+        return nil, err
+    }
+    w.mutex.RLock()
+    defer w.mutex.RUnlock()
+    return w.subs, nil
+}
+
+// subscriptionAlert is what a subscription's webhook receives
+type subscriptionAlert struct {
+    Subscription models.Subscription      `json:"subscription"`
+    Match        models.SubscriptionMatch `json:"match"`
+}
+
+// evaluate runs every subscription against a saved page
+func (w *subscriptionWatcher) evaluate(page *models.Page) {
+    subs, err := w.subscriptions()
+    if err != nil {
+        log.Printf("loading subscriptions: %v", err)
+        return
+    }
+    if len(subs) == 0 || page == nil || page.ID == 0 {
+        return
+    }
+
+    // Selectors need the markup, which is only parsed when one is in use
+    var doc *goquery.Document
+    for _, sub := range subs {
+        if sub.selector != nil && strings.Contains(strings.ToLower(page.ContentType), "html") {
+            doc, _ = goquery.NewDocumentFromReader(bytes.NewReader(page.Body))
+            break
+        }
+    }
+
+    for _, sub := range subs {
+        text, ok := sub.match(page, doc)
+        if !ok {
+            continue
+        }
+
+        match := models.SubscriptionMatch{
+            SubscriptionID: sub.ID,
+            PageID:         page.ID,
+            CrawlID:        page.CrawlID,
+            CrawlUUID:      page.CrawlUUID,
+            URL:            page.URL,
+            Title:          page.Title,
+            Snippet:        text,
+        }
+        saved, err := w.db.SaveSubscriptionMatch(&match, page.Hash)
+        if err != nil {
+            log.Printf("saving match of subscription %d on %s: %v", sub.ID, page.URL, err)
+            continue
+        }
+        if saved && sub.WebhookURL != "" {
+            go w.deliver(sub.Subscription, match)
+        }
+    }
+}
+
+func (w *subscriptionWatcher) deliver(sub models.Subscription, match models.SubscriptionMatch) {
+    alert := subscriptionAlert{Subscription: sub, Match: match}
+    if err := output.PostJSON(w.ctx, w.client, sub.WebhookURL, alert); err != nil {
+        log.Printf("delivering match of subscription %d on %s: %v", sub.ID, match.URL, err)
+    }
+}
+
+type createSubscriptionRequest struct {
+    Name       string   `json:"name"`
+    Keywords   []string `json:"keywords"`
+    MatchAll   bool     `json:"match_all"`
+    Selector   string   `json:"selector"`
+    WebhookURL string   `json:"webhook_url"`
+}
+
+func (s *Server) handleCreateSubscription(w http.ResponseWriter, r *http.Request) {
+    var req createSubscriptionRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+        return
+    }
+
+    sub := models.Subscription{
+        Name:       strings.TrimSpace(req.Name),
+        Keywords:   req.Keywords,
+        MatchAll:   req.MatchAll,
+        Selector:   strings.TrimSpace(req.Selector),
+        WebhookURL: strings.TrimSpace(req.WebhookURL),
+    }
+    if sub.Name == "" {
+        writeError(w, http.StatusBadRequest, errors.New("name is required"))
+        return
+    }
+    if _, err := compileSubscription(sub); err != nil {
+        writeError(w, http.StatusBadRequest, err)
+        return
+    }
+    if sub.WebhookURL != "" {
+        parsed, err := url.Parse(sub.WebhookURL)
+        if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+            writeError(w, http.StatusBadRequest, fmt.Errorf("invalid webhook_url %q", sub.WebhookURL))
+            return
+        }
+    }
+
+    if err := s.db.CreateSubscription(&sub); err != nil {
+        writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+    if err := s.subscriptions.reload(); err != nil {
+        writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+    writeJSON(w, http.StatusCreated, sub)
+}
+
+func (s *Server) handleListSubscriptions(w http.ResponseWriter, r *http.Request) {
+    subs, err := s.db.ListSubscriptions()
+    if err != nil {
+        writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, subs)
+}
+
+func (s *Server) handleGetSubscription(w http.ResponseWriter, r *http.Request) {
+    sub, ok := s.lookupSubscription(w, r)
+    if !ok {
+        return
+    }
+    writeJSON(w, http.StatusOK, sub)
+}
+
+func (s *Server) handleDeleteSubscription(w http.ResponseWriter, r *http.Request) {
+    id, ok := pathID(w, r, "subscription")
+    if !ok {
+        return
+    }
+
+    err := s.db.DeleteSubscription(id)
+    if errors.Is(err, sql.ErrNoRows) {
+        writeError(w, http.StatusNotFound, fmt.Errorf("subscription %d not found", id))
+        return
+    }
+    if err != nil {
+        writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+    if err := s.subscriptions.reload(); err != nil {
+        writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+    w.WriteHeader(http.StatusNoContent)
+}
+
+// handleListMatches is a subscription's feed: matches after the "after"
+// match id, oldest first, so a reader polls with the last id it has seen.
+func (s *Server) handleListMatches(w http.ResponseWriter, r *http.Request) {
+    sub, ok := s.lookupSubscription(w, r)
+    if !ok {
+        return
+    }
+
+    limit, err := queryInt(r, "limit", 50)
+    if err != nil || limit < 1 || limit > 1000 {
+        writeError(w, http.StatusBadRequest, errors.New("limit must be between 1 and 1000"))
+        return
+    }
+    var after int64
+    if val := r.URL.Query().Get("after"); val != "" {
+        if after, err = strconv.ParseInt(val, 10, 64); err != nil {
+            writeError(w, http.StatusBadRequest, errors.New("after must be an integer"))
+            return
+        }
+    }
+
+    matches, err := s.db.ListSubscriptionMatches(sub.ID, after, limit)
+    if err != nil {
+        writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, matches)
+}
+
+func (s *Server) lookupSubscription(w http.ResponseWriter, r *http.Request) (*models.Subscription, bool) {
+    id, ok := pathID(w, r, "subscription")
+    if !ok {
+        return nil, false
+    }
+
+    sub, err := s.db.GetSubscription(id)
+    if errors.Is(err, sql.ErrNoRows) {
+        writeError(w, http.StatusNotFound, fmt.Errorf("subscription %d not found", id))
+        return nil, false
+    }
+    if err != nil {
+        writeError(w, http.StatusInternalServerError, err)
+        return nil, false
+    }
+    return sub, true
+}
@@ -0,0 +1,125 @@
+package audit
+
+import (
+    "fmt"
+    "net/http"
+    "os"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+)
+
+const header = "# smart-crawler politeness audit v1: unix_micros\thost\trule\turl"
+
+// Rule is the politeness rule a request was issued under
+type Rule struct {
+    Rate     float64 // Requests per second
+    Burst    int
+    Robots   string // robots.txt directive applied, "none" when not checked
+    Redirect bool   // A redirect the client followed, not a request the rate limiter admitted
+}
+
+func (r Rule) String() string {
+    robots := r.Robots
+    if robots == "" {
+        robots = "none"
+    }
+    rule := fmt.Sprintf("rate=%g;burst=%d;robots=%s", r.Rate, r.Burst, robots)
+    if r.Redirect {
+        rule += ";redirect=true"
+    }
+    return rule
+}
+
+// ParseRule parses the form written by Rule.String
+func ParseRule(s string) (Rule, error) {
+    var rule Rule
+    for _, part := range strings.Split(s, ";") {
+        key, val, ok := strings.Cut(part, "=")
+        if !ok {
+            return rule, fmt.Errorf("invalid rule %q", s)
+        }
+
+        var err error
+        switch key {
+        case "rate":
+            rule.Rate, err = strconv.ParseFloat(val, 64)
+        case "burst":
+            rule.Burst, err = strconv.Atoi(val)
+        case "robots":
+            rule.Robots = val
+        case "redirect":
+            rule.Redirect, err = strconv.ParseBool(val)
+        }
+        if err != nil {
+            return rule, fmt.Errorf("invalid rule %q: %w", s, err)
+        }
+    }
+    return rule, nil
+}
+
+// Log is an append-only, tab separated record of every outgoing request.
+// Each record is written straight to the file, so a killed crawl loses
+// none of it.
+type Log struct {
+    file  *os.File
+    mutex sync.Mutex
+}
+
+func Open(path string) (*Log, error) {
+    file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+    if err != nil {
+        return nil, fmt.Errorf("failed to open audit log: %w", err)
+    }
+
+    info, err := file.Stat()
+    if err != nil {
+        file.Close()
+        return nil, fmt.Errorf("failed to stat audit log: %w", err)
+    }
+
+    if info.Size() == 0 {
+        if _, err := fmt.Fprintln(file, header); err != nil {
+            file.Close()
+            return nil, fmt.Errorf("failed to write audit log: %w", err)
+        }
+    }
+    return &Log{file: file}, nil
+}
+
+// Record logs a request issued now. The timestamp is taken under the lock so
+// lines are always in time order.
+func (l *Log) Record(host string, rule Rule, url string) {
+    l.mutex.Lock()
+    defer l.mutex.Unlock()
+
+    fmt.Fprintf(l.file, "%d\t%s\t%s\t%s\n", time.Now().UnixMicro(), host, rule, url)
+}
+
+func (l *Log) Close() error {
+    l.mutex.Lock()
+    defer l.mutex.Unlock()
+
+    return l.file.Close()
+}
+
+// Transport records each request in the audit log before sending it.
+// Redirects the client follows are marked, as they bypass the rate limiter.
+type Transport struct {
+    Base http.RoundTripper
+    Log  *Log
+    Rule func() Rule
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+    rule := t.Rule()
+    rule.Redirect = req.Response != nil
+    t.Log.Record(req.URL.Hostname(), rule, req.URL.String())
+
+    base := t.Base
+    if base == nil {
+        base = http.DefaultTransport
+    }
+    return base.RoundTrip(req)
+}
@@ -0,0 +1,127 @@
+package audit
+
+import (
+    "bufio"
+    "fmt"
+    "os"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// Violation is a request that exceeded the rate rule it was issued under
+type Violation struct {
+    Line int
+    Host string
+    At   time.Time
+    Rule Rule
+    URL  string
+}
+
+// HostReport summarizes one host's requests in an audit log
+type HostReport struct {
+    Host       string
+    Requests   int
+    Redirects  int // Of Requests, redirects followed, which the rate rule does not cover
+    First      time.Time
+    Last       time.Time
+    PeakPerSec int // Most requests observed in any one-second window
+    Violations []Violation
+}
+
+// Verify replays the audit log through a token bucket per host, using each
+// request's recorded rule, and reports every request that could not have
+// been admitted under that rule. Redirects followed are counted but spend
+// no tokens, since the rate limiter never saw them.
+func Verify(path string) ([]HostReport, error) {
+    file, err := os.Open(path)
+    if err != nil {
+        return nil, fmt.Errorf("failed to open audit log: %w", err)
+    }
+    defer file.Close()
+
+    type bucket struct {
+        tokens float64
+        last   time.Time
+        window []time.Time
+    }
+
+    reports := make(map[string]*HostReport)
+    buckets := make(map[string]*bucket)
+
+    scanner := bufio.NewScanner(file)
+    scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+    lineNo := 0
+    for scanner.Scan() {
+        lineNo++
+        line := scanner.Text()
+        if line == "" || strings.HasPrefix(line, "#") {
+            continue
+        }
+
+        fields := strings.SplitN(line, "\t", 4)
+        if len(fields) != 4 {
+            return nil, fmt.Errorf("line %d: expected 4 fields", lineNo)
+        }
+        micros, err := strconv.ParseInt(fields[0], 10, 64)
+        if err != nil {
+            return nil, fmt.Errorf("line %d: invalid timestamp: %w", lineNo, err)
+        }
+        rule, err := ParseRule(fields[2])
+        if err != nil {
+            return nil, fmt.Errorf("line %d: %w", lineNo, err)
+        }
+        at := time.UnixMicro(micros)
+        host := fields[1]
+
+        report, exists := reports[host]
+        if !exists {
+            report = &HostReport{Host: host, First: at}
+            reports[host] = report
+            buckets[host] = &bucket{tokens: float64(rule.Burst), last: at}
+        }
+        b := buckets[host]
+
+        report.Requests++
+        report.Last = at
+        if rule.Redirect {
+            report.Redirects++
+            continue
+        }
+
+        // Refill, then spend one token; a small epsilon absorbs clock jitter
+        if elapsed := at.Sub(b.last).Seconds(); elapsed > 0 {
+            b.tokens += elapsed * rule.Rate
+        }
+        if b.tokens > float64(rule.Burst) {
+            b.tokens = float64(rule.Burst)
+        }
+        b.last = at
+        if rule.Rate > 0 && b.tokens < 1-1e-3 {
+            report.Violations = append(report.Violations, Violation{
+                Line: lineNo, Host: host, At: at, Rule: rule, URL: fields[3],
+            })
+        }
+        b.tokens--
+
+        b.window = append(b.window, at)
+        for len(b.window) > 0 && at.Sub(b.window[0]) >= time.Second {
+            b.window = b.window[1:]
+        }
+        if len(b.window) > report.PeakPerSec {
+            report.PeakPerSec = len(b.window)
+        }
+    }
+    if err := scanner.Err(); err != nil {
+        return nil, fmt.Errorf("failed to read audit log: %w", err)
+    }
+
+    var result []HostReport
+    for _, report := range reports {
+        result = append(result, *report)
+    }
+    sort.Slice(result, func(i, j int) bool { return result[i].Host < result[j].Host })
+
+    return result, nil
+}
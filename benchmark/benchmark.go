@@ -6,6 +6,7 @@ import (
     "context"
     "fmt"
     "log"
+    "sort"
     "time"
     "strings"
     
@@ -13,62 +14,488 @@ import (
     "smart-crawler/crawler"
     "smart-crawler/database"
     "smart-crawler/models"
+    "smart-crawler/progress"
 )
 
-func RunComparison(ctx context.Context, db *database.PostgresDB, startURL string, maxDepth, workers int) {
+// Config describes a benchmark: the site, and how often each crawler
+// crawls it
+type Config struct {
+    StartURL string
+    MaxDepth int
+    Workers  int
+    Display  progress.Mode
+    // Measured runs of each crawler; 0 counts as 1
+    Iterations int
+    // Runs of each crawler before the measured ones, whose results are
+    // discarded, so caches and connections are warm for all of those
+    Warmup int
+    // Recorded with the results: a name for the build or setup, and any
+    // other settings that shape them
+    Label    string
+    Settings map[string]string
+    // Directory to write a CPU and a heap profile of each measured run to,
+    // as <crawler>-<iteration>.cpu.pprof and .heap.pprof; none if empty
+    ProfileDir string
+    // Also audit the site's sitemaps in each iteration, as the baseline of
+    // fetching a known list of URLs without discovering any
+    Sitemap bool
+}
+
+// Result holds the stats of each crawler's measured runs, in order. A run
+// that failed to start has empty stats.
+type Result struct {
+    Traditional []*models.CrawlStats
+    Smart       []*models.CrawlStats
+    Sitemap     []*models.CrawlStats // Empty unless Config.Sitemap
+}
+
+func RunComparison(ctx context.Context, db database.Store, startURL string, maxDepth, workers int, display progress.Mode, opts ...crawler.Option) {
+    Run(ctx, db, Config{StartURL: startURL, MaxDepth: maxDepth, Workers: workers, Display: display, Iterations: 1}, opts...)
+}
+
+// Run crawls cfg.StartURL with the traditional and then the smart crawler,
+// and with cfg.Sitemap audits its sitemaps after them, first cfg.Warmup
+// times and then cfg.Iterations times, and prints how they compare. Over several iterations it also prints the mean, median, spread,
+// and confidence interval of each crawler's rate, duration, and error rate,
+// and whether the crawlers' difference is statistically significant. Each
+// measured run's memory and garbage collection are recorded in its stats'
+// Resources.
+func Run(ctx context.Context, db database.Store, cfg Config, opts ...crawler.Option) *Result {
+    iterations := max(cfg.Iterations, 1)
     fmt.Println("🚀 Starting Crawler Performance Benchmark")
     fmt.Println("==========================================")
-    fmt.Printf("Target URL: %s\n", startURL)
-    fmt.Printf("Max Depth: %d\n", maxDepth)
-    fmt.Printf("Workers: %d\n", workers)
+    fmt.Printf("Target URL: %s\n", cfg.StartURL)
+    fmt.Printf("Max Depth: %d\n", cfg.MaxDepth)
+    fmt.Printf("Workers: %d\n", cfg.Workers)
+    if iterations > 1 || cfg.Warmup > 0 {
+        fmt.Printf("Iterations: %d (after %d warm-up)\n", iterations, cfg.Warmup)
+    }
     fmt.Println()
 
-    // Clear previous data
-    clearDatabase(db)
+    // Each run is its own crawl session, so neither sees the other's pages
+    // and both stay in the database for later comparison.
+    for i := 1; i <= cfg.Warmup && ctx.Err() == nil; i++ {
+        fmt.Printf("🔥 Warm-up %d of %d...\n", i, cfg.Warmup)
+        runTraditionalBenchmark(ctx, db, cfg.StartURL, cfg.MaxDepth, cfg.Workers, cfg.Display, "", "", opts)
+        runSmartBenchmark(ctx, db, cfg.StartURL, cfg.MaxDepth, cfg.Workers, cfg.Display, "", "", opts)
+        if cfg.Sitemap {
+            runSitemapBenchmark(ctx, db, cfg.StartURL, cfg.Workers, cfg.Display, "", "", opts)
+        }
+    }
+
+    // The crawlers take turns, so drift in the site or the network over
+    // the benchmark affects both alike
+    result := &Result{}
+    for i := 1; i <= iterations && ctx.Err() == nil; i++ {
+        if iterations > 1 {
+            fmt.Printf("🔁 Iteration %d of %d\n", i, iterations)
+        }
+        // Run Traditional Crawler
+        fmt.Println("📊 Running Traditional Crawler...")
+        result.Traditional = append(result.Traditional, runTraditionalBenchmark(ctx, db, cfg.StartURL, cfg.MaxDepth, cfg.Workers, cfg.Display, cfg.ProfileDir, profileName(CrawlerTraditional, i), opts))
 
-    // Run Traditional Crawler
-    fmt.Println("📊 Running Traditional Crawler...")
-    traditionalStats := runTraditionalBenchmark(ctx, db, startURL, maxDepth, workers)
-    
-    // Clear database for fair comparison
-    clearDatabase(db)
-    
-    // Run Smart Crawler
-    fmt.Println("🧠 Running Smart Crawler...")
-    smartStats := runSmartBenchmark(ctx, db, startURL, maxDepth, workers)
+        // Run Smart Crawler
+        fmt.Println("🧠 Running Smart Crawler...")
+        result.Smart = append(result.Smart, runSmartBenchmark(ctx, db, cfg.StartURL, cfg.MaxDepth, cfg.Workers, cfg.Display, cfg.ProfileDir, profileName(CrawlerSmart, i), opts))
+
+        if cfg.Sitemap {
+            fmt.Println("🗺️  Running Sitemap Audit...")
+            result.Sitemap = append(result.Sitemap, runSitemapBenchmark(ctx, db, cfg.StartURL, cfg.Workers, cfg.Display, cfg.ProfileDir, profileName(CrawlerSitemap, i), opts))
+        }
+    }
+    if len(result.Smart) == 0 {
+        return result
+    }
 
     // Display Results
+    traditionalStats, smartStats := result.Traditional[len(result.Traditional)-1], result.Smart[len(result.Smart)-1]
+    if len(result.Smart) > 1 {
+        fmt.Println("\nDetails of the last iteration follow the statistics.")
+        displayStatistics(result)
+    }
     displayComparison(traditionalStats, smartStats)
+    if len(result.Sitemap) > 0 {
+        displaySitemap(result.Sitemap[len(result.Sitemap)-1], traditionalStats, smartStats)
+    }
+    displayProtocols(traditionalStats, smartStats)
+    displayTiming(traditionalStats, smartStats)
+    displayResources(traditionalStats, smartStats)
+    displayHarvest(traditionalStats, smartStats)
+    displayStorage(db, traditionalStats, smartStats)
+    return result
+}
+
+// metric is a figure taken from each run for the statistics, stored in
+// benchmark results under key
+type metric struct {
+    key            string
+    name           string
+    higherIsBetter bool
+    value          func(*models.CrawlStats) float64
+}
+
+var metrics = []metric{
+    {"pages_per_second", "Pages/second", true, func(stats *models.CrawlStats) float64 {
+        return float64(stats.PagesProcessed) / stats.Duration.Seconds()
+    }},
+    {"duration_seconds", "Duration (s)", false, func(stats *models.CrawlStats) float64 {
+        return stats.Duration.Seconds()
+    }},
+    {"error_rate", "Error rate (%)", false, func(stats *models.CrawlStats) float64 {
+        if attempted := stats.PagesProcessed + stats.Errors; attempted > 0 {
+            return float64(stats.Errors) / float64(attempted) * 100
+        }
+        return 0
+    }},
+    {"peak_rss_mb", "Peak RSS (MB)", false, func(stats *models.CrawlStats) float64 {
+        if stats.Resources == nil {
+            return 0
+        }
+        return float64(stats.Resources.PeakRSS) / (1 << 20)
+    }},
+    {"alloc_mb", "Allocated (MB)", false, func(stats *models.CrawlStats) float64 {
+        if stats.Resources == nil {
+            return 0
+        }
+        return float64(stats.Resources.TotalAlloc) / (1 << 20)
+    }},
+    {"gc_pause_ms", "GC pause (ms)", false, func(stats *models.CrawlStats) float64 {
+        if stats.Resources == nil {
+            return 0
+        }
+        return float64(stats.Resources.GCPause) / float64(time.Millisecond)
+    }},
+    {"harvest_rate", "Harvest rate (%)", true, func(stats *models.CrawlStats) float64 {
+        if stats.Harvest == nil {
+            return 0
+        }
+        return stats.Harvest.Rate * 100
+    }},
+}
+
+// sample takes m from each run that completed
+func (m metric) sample(runs []*models.CrawlStats) []float64 {
+    var values []float64
+    for _, stats := range runs {
+        if stats.CrawlID != 0 && stats.Duration > 0 {
+            values = append(values, m.value(stats))
+        }
+    }
+    return values
+}
+
+// displayStatistics summarizes each metric over the iterations, and marks
+// the differences between the crawlers that could be chance
+func displayStatistics(result *Result) {
+    fmt.Printf("\n📐 Statistics over %d Iterations (95%% confidence)\n", len(result.Smart))
+    fmt.Println("==============================================")
+    fmt.Printf("%-16s %-13s %-10s %-10s %-10s %s\n", "Metric", "Crawler", "Mean", "Median", "StdDev", "95% CI")
+    fmt.Println(strings.Repeat("-", 86))
+    for _, m := range metrics {
+        traditional, smart := summarize(m.sample(result.Traditional)), summarize(m.sample(result.Smart))
+        for i, row := range []struct {
+            name    string
+            summary models.MetricSummary
+        }{{"Traditional", traditional}, {"Smart", smart}, {"Sitemap", summarize(m.sample(result.Sitemap))}} {
+            if row.name == "Sitemap" && len(result.Sitemap) == 0 {
+                continue
+            }
+            name := ""
+            if i == 0 {
+                name = m.name
+            }
+            s := row.summary
+            fmt.Printf("%-16s %-13s %-10.2f %-10.2f %-10.2f [%.2f, %.2f]\n", name, row.name, s.Mean, s.Median, s.StdDev, s.CILow, s.CIHigh)
+        }
+        d := compare(traditional, smart)
+        verdict := "significant"
+        if !d.Significant {
+            verdict = "not significant"
+        }
+        fmt.Printf("%-16s %-13s %-+10.2f %-21s [%.2f, %.2f] %s\n", "", "Difference", d.Delta, "", d.Low, d.High, verdict)
+    }
+}
+
+// displayProtocols reports the pages each run fetched over each HTTP version
+// and their average load time, so a speedup can be told apart from one
+// run negotiating a newer protocol than the other
+func displayProtocols(traditional, smart *models.CrawlStats) {
+    protocols := make(map[string]bool)
+    for protocol := range traditional.Protocols {
+        protocols[protocol] = true
+    }
+    for protocol := range smart.Protocols {
+        protocols[protocol] = true
+    }
+    if len(protocols) == 0 {
+        return
+    }
+    names := make([]string, 0, len(protocols))
+    for protocol := range protocols {
+        names = append(names, protocol)
+    }
+    sort.Strings(names)
+
+    fmt.Println("\n🔌 Protocols")
+    fmt.Println("============")
+    fmt.Printf("%-20s %-22s %-22s\n", "Protocol", "Traditional", "Smart")
+    fmt.Println(strings.Repeat("-", 65))
+    for _, protocol := range names {
+        fmt.Printf("%-20s %-22s %-22s\n", protocol, protocolUsage(traditional, protocol), protocolUsage(smart, protocol))
+    }
+}
+
+// protocolUsage formats the pages a run fetched over protocol and their
+// average load time
+func protocolUsage(stats *models.CrawlStats, protocol string) string {
+    usage := stats.Protocols[protocol]
+    if usage == nil || usage.Pages == 0 {
+        return "-"
+    }
+    average := (usage.LoadTime / time.Duration(usage.Pages)).Round(time.Millisecond)
+    return fmt.Sprintf("%d pages, %v avg", usage.Pages, average)
+}
+
+// displayTiming compares the median and 90th percentile of each phase of
+// the runs' fetches, showing whether a difference in load time came from
+// the network or the servers
+func displayTiming(traditional, smart *models.CrawlStats) {
+    if traditional.Timing == nil && smart.Timing == nil {
+        return
+    }
+    phases := []struct {
+        name  string
+        phase func(*models.TimingPercentiles) models.Percentiles
+    }{
+        {"DNS", func(t *models.TimingPercentiles) models.Percentiles { return t.DNS }},
+        {"Connect", func(t *models.TimingPercentiles) models.Percentiles { return t.Connect }},
+        {"TLS", func(t *models.TimingPercentiles) models.Percentiles { return t.TLS }},
+        {"TTFB", func(t *models.TimingPercentiles) models.Percentiles { return t.TTFB }},
+        {"Download", func(t *models.TimingPercentiles) models.Percentiles { return t.Download }},
+    }
+    format := func(timing *models.TimingPercentiles, phase func(*models.TimingPercentiles) models.Percentiles) string {
+        if timing == nil {
+            return "-"
+        }
+        p := phase(timing)
+        return fmt.Sprintf("%.1fms / %.1fms", p.P50, p.P90)
+    }
+
+    fmt.Println("\n⏱️  Fetch Timing (p50 / p90)")
+    fmt.Println("===========================")
+    fmt.Printf("%-20s %-22s %-22s\n", "Phase", "Traditional", "Smart")
+    fmt.Println(strings.Repeat("-", 65))
+    for _, phase := range phases {
+        fmt.Printf("%-20s %-22s %-22s\n", phase.name, format(traditional.Timing, phase.phase), format(smart.Timing, phase.phase))
+    }
+    load := func(p *models.Percentiles) string {
+        if p == nil {
+            return "-"
+        }
+        return fmt.Sprintf("%.1fms / %.1fms", p.P50, p.P90)
+    }
+    fmt.Printf("%-20s %-22s %-22s\n", "Page load", load(traditional.Latency), load(smart.Latency))
+}
+
+// displayHarvest compares the runs' harvest rates, overall and at each
+// quarter of their pages, showing whether prioritization found the relevant
+// pages sooner
+func displayHarvest(traditional, smart *models.CrawlStats) {
+    if traditional.Harvest == nil && smart.Harvest == nil {
+        return
+    }
+    // The rate once a run had processed a share of its pages, from the
+    // last sample by then
+    at := func(h *models.HarvestStats, share float64) string {
+        if h == nil {
+            return "-"
+        }
+        if share == 1 {
+            return fmt.Sprintf("%.1f%%", h.Rate*100)
+        }
+        pages := int(share * float64(h.Pages))
+        rate, found := 0.0, false
+        for _, sample := range h.Samples {
+            if sample.Pages > pages {
+                break
+            }
+            rate, found = sample.Rate, true
+        }
+        if !found {
+            return "-"
+        }
+        return fmt.Sprintf("%.1f%%", rate*100)
+    }
+
+    threshold := smart.Harvest
+    if threshold == nil {
+        threshold = traditional.Harvest
+    }
+    fmt.Printf("\n🌾 Harvest Rate (relevance at least %.2f)\n", threshold.Threshold)
+    fmt.Println("=====================================")
+    fmt.Printf("%-20s %-15s %-15s\n", "After", "Traditional", "Smart")
+    fmt.Println(strings.Repeat("-", 65))
+    for _, share := range []float64{0.25, 0.5, 0.75, 1} {
+        fmt.Printf("%-20s %-15s %-15s\n", fmt.Sprintf("%.0f%% of pages", share*100), at(traditional.Harvest, share), at(smart.Harvest, share))
+    }
 }
 
-func runTraditionalBenchmark(ctx context.Context, db *database.PostgresDB, startURL string, maxDepth, workers int) *models.CrawlStats {
-    traditionalCrawler := crawler.NewTraditional(db, workers)
+// displayResources compares what the runs cost the process in memory and
+// garbage collection, and points to their profiles
+func displayResources(traditional, smart *models.CrawlStats) {
+    if traditional.Resources == nil || smart.Resources == nil {
+        return
+    }
+    t, s := traditional.Resources, smart.Resources
+
+    fmt.Println("\n🧮 Resource Usage")
+    fmt.Println("=================")
+    fmt.Printf("%-20s %-15s %-15s %-15s\n", "Metric", "Traditional", "Smart", "Improvement")
+    fmt.Println(strings.Repeat("-", 65))
+    fmt.Printf("%-20s %-15s %-15s %-15s\n", "Peak RSS", formatBytes(t.PeakRSS), formatBytes(s.PeakRSS), calculateImprovementReverse(int(t.PeakRSS), int(s.PeakRSS)))
+    fmt.Printf("%-20s %-15s %-15s %-15s\n", "Allocated", formatBytes(int64(t.TotalAlloc)), formatBytes(int64(s.TotalAlloc)), calculateImprovementReverse(int(t.TotalAlloc), int(s.TotalAlloc)))
+    fmt.Printf("%-20s %-15d %-15d %-15s\n", "Allocations", t.Mallocs, s.Mallocs, calculateImprovementReverse(int(t.Mallocs), int(s.Mallocs)))
+    fmt.Printf("%-20s %-15d %-15d %-15s\n", "GC Cycles", t.GCCycles, s.GCCycles, calculateImprovementReverse(int(t.GCCycles), int(s.GCCycles)))
+    fmt.Printf("%-20s %-15s %-15s %-15s\n", "GC Pause", t.GCPause.Round(time.Microsecond), s.GCPause.Round(time.Microsecond), calculateDurationImprovement(t.GCPause, s.GCPause))
+    if s.CPUProfile != "" || s.HeapProfile != "" {
+        fmt.Printf("Profiles: %s %s, %s %s (inspect with 'go tool pprof')\n", t.CPUProfile, t.HeapProfile, s.CPUProfile, s.HeapProfile)
+    }
+}
+
+// displayStorage reports what compressing page bodies saved for each run.
+// Only the Postgres store compresses bodies itself.
+func displayStorage(db database.Store, traditional, smart *models.CrawlStats) {
+    postgres, ok := db.(*database.PostgresDB)
+    if !ok {
+        return
+    }
+
+    fmt.Println("\n💾 Body Storage")
+    fmt.Println("===============")
+    fmt.Printf("%-20s %-15s %-15s %-15s\n", "Run", "Uncompressed", "Stored", "Savings")
+    fmt.Println(strings.Repeat("-", 65))
+    for _, run := range []struct {
+        name  string
+        stats *models.CrawlStats
+    }{{"Traditional", traditional}, {"Smart", smart}} {
+        if run.stats.CrawlID == 0 {
+            continue
+        }
+        storage, err := postgres.BodyStorage(run.stats.CrawlID)
+        if err != nil {
+            log.Printf("Failed to measure body storage of crawl %d: %v", run.stats.CrawlID, err)
+            continue
+        }
+        savings := calculateImprovementReverse(int(storage.Size), int(storage.StoredSize))
+        fmt.Printf("%-20s %-15s %-15s %-15s\n", run.name, formatBytes(storage.Size), formatBytes(storage.StoredSize), savings)
+    }
+}
+
+func runTraditionalBenchmark(ctx context.Context, db database.Store, startURL string, maxDepth, workers int, display progress.Mode, profileDir, profile string, opts []crawler.Option) *models.CrawlStats {
+    traditionalCrawler, err := crawler.NewTraditional(db, append([]crawler.Option{crawler.WithWorkers(workers)}, opts...)...)
+    if err != nil {
+        log.Printf("Traditional crawler error: %v", err)
+        return &models.CrawlStats{}
+    }
+    meter := startMeter(profileDir, profile)
     start := time.Now()
     
+    stopProgress := progress.Show(display, "traditional", traditionalCrawler)
     stats, err := traditionalCrawler.Crawl(ctx, startURL, maxDepth)
+    stopProgress()
+    duration := time.Since(start)
+    resources := meter.stop()
     if err != nil {
         log.Printf("Traditional crawler error: %v", err)
         return &models.CrawlStats{}
     }
     
-    stats.Duration = time.Since(start)
+    stats.Duration = duration
+    stats.Resources = resources
     return stats
 }
 
-func runSmartBenchmark(ctx context.Context, db *database.PostgresDB, startURL string, maxDepth, workers int) *models.CrawlStats {
-    smartCrawler := crawler.NewSmart(db, workers)
+func runSmartBenchmark(ctx context.Context, db database.Store, startURL string, maxDepth, workers int, display progress.Mode, profileDir, profile string, opts []crawler.Option) *models.CrawlStats {
+    smartCrawler, err := crawler.NewSmart(db, append([]crawler.Option{crawler.WithWorkers(workers)}, opts...)...)
+    if err != nil {
+        log.Printf("Smart crawler error: %v", err)
+        return &models.CrawlStats{}
+    }
+    meter := startMeter(profileDir, profile)
     start := time.Now()
     
+    stopProgress := progress.Show(display, "smart", smartCrawler)
     stats, err := smartCrawler.Crawl(ctx, startURL, maxDepth)
+    stopProgress()
+    duration := time.Since(start)
+    resources := meter.stop()
     if err != nil {
         log.Printf("Smart crawler error: %v", err)
         return &models.CrawlStats{}
     }
     
-    stats.Duration = time.Since(start)
+    stats.Duration = duration
+    stats.Resources = resources
+    return stats
+}
+
+func runSitemapBenchmark(ctx context.Context, db database.Store, startURL string, workers int, display progress.Mode, profileDir, profile string, opts []crawler.Option) *models.CrawlStats {
+    sitemapCrawler, err := crawler.NewTraditional(db, append([]crawler.Option{crawler.WithWorkers(workers)}, opts...)...)
+    if err != nil {
+        log.Printf("Sitemap audit error: %v", err)
+        return &models.CrawlStats{}
+    }
+    sitemapCrawler.SetSitemapOnly(true)
+    meter := startMeter(profileDir, profile)
+    start := time.Now()
+
+    stopProgress := progress.Show(display, "sitemap", sitemapCrawler)
+    stats, err := sitemapCrawler.Crawl(ctx, startURL, 0)
+    stopProgress()
+    duration := time.Since(start)
+    resources := meter.stop()
+    if err != nil {
+        log.Printf("Sitemap audit error: %v", err)
+        return &models.CrawlStats{}
+    }
+
+    stats.Duration = duration
+    stats.Resources = resources
     return stats
 }
 
+// displaySitemap sets the crawlers against the sitemap audit: how many of
+// the pages the site lists each one reached, and at what rate compared to
+// fetching the list outright
+func displaySitemap(sitemap, traditional, smart *models.CrawlStats) {
+    if sitemap.CrawlID == 0 {
+        return
+    }
+    rate := func(stats *models.CrawlStats) string {
+        if stats.Duration <= 0 {
+            return "-"
+        }
+        return fmt.Sprintf("%.2f/s", float64(stats.PagesProcessed)/stats.Duration.Seconds())
+    }
+    coverage := func(stats *models.CrawlStats) string {
+        if sitemap.PagesProcessed == 0 {
+            return "N/A"
+        }
+        return fmt.Sprintf("%.1f%%", float64(stats.PagesProcessed)/float64(sitemap.PagesProcessed)*100)
+    }
+
+    fmt.Println("\n🗺️  Sitemap Baseline")
+    fmt.Println("===================")
+    fmt.Printf("%-20s %-15s %-15s %-15s\n", "Metric", "Sitemap", "Traditional", "Smart")
+    fmt.Println(strings.Repeat("-", 65))
+    fmt.Printf("%-20s %-15d %-15d %-15d\n", "Crawl ID", sitemap.CrawlID, traditional.CrawlID, smart.CrawlID)
+    fmt.Printf("%-20s %-15d %-15d %-15d\n", "Pages Processed", sitemap.PagesProcessed, traditional.PagesProcessed, smart.PagesProcessed)
+    fmt.Printf("%-20s %-15d %-15d %-15d\n", "Errors", sitemap.Errors, traditional.Errors, smart.Errors)
+    fmt.Printf("%-20s %-15s %-15s %-15s\n", "Duration", sitemap.Duration.Round(time.Second), traditional.Duration.Round(time.Second), smart.Duration.Round(time.Second))
+    fmt.Printf("%-20s %-15s %-15s %-15s\n", "Rate", rate(sitemap), rate(traditional), rate(smart))
+    fmt.Printf("%-20s %-15s %-15s %-15s\n", "Pages vs Sitemap", "100%", coverage(traditional), coverage(smart))
+}
+
 func displayComparison(traditional, smart *models.CrawlStats) {
     fmt.Println("\n📈 Performance Comparison Results")
     fmt.Println("=================================")
@@ -76,6 +503,9 @@ func displayComparison(traditional, smart *models.CrawlStats) {
     fmt.Printf("%-20s %-15s %-15s %-15s\n", "Metric", "Traditional", "Smart", "Improvement")
     fmt.Println(strings.Repeat("-", 65))
     
+    // Crawl sessions
+    fmt.Printf("%-20s %-15d %-15d %-15s\n", "Crawl ID", traditional.CrawlID, smart.CrawlID, "")
+    
     // Pages Processed
     improvement := calculateImprovement(traditional.PagesProcessed, smart.PagesProcessed)
     fmt.Printf("%-20s %-15d %-15d %-15s\n", "Pages Processed", traditional.PagesProcessed, smart.PagesProcessed, improvement)
@@ -179,15 +609,3 @@ func formatBytes(bytes int64) string {
     }
     return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
 }
-
-func clearDatabase(db *database.PostgresDB) {
-    queries := []string{
-        "TRUNCATE TABLE links CASCADE",
-        "TRUNCATE TABLE pages CASCADE", 
-        "TRUNCATE TABLE crawl_queue CASCADE",
-    }
-    
-    for _, query := range queries {
-        db.DB.Exec(query)
-    }
-}
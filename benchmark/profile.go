@@ -0,0 +1,149 @@
+package benchmark
+
+import (
+    "bytes"
+    "fmt"
+    "log"
+    "os"
+    "path/filepath"
+    "runtime"
+    "runtime/debug"
+    runtimemetrics "runtime/metrics"
+    "runtime/pprof"
+    "strconv"
+    "time"
+
+    "smart-crawler/models"
+)
+
+// rssInterval is how often a run's resident set size is sampled for its peak
+const rssInterval = 50 * time.Millisecond
+
+// meter measures the memory and garbage collection of one run, and writes
+// its profiles when it is given a directory
+type meter struct {
+    before      runtime.MemStats
+    cpuFile     *os.File
+    heapProfile string
+
+    peakRSS int64 // Written only by sampleRSS until stopped is closed
+    done    chan struct{}
+    stopped chan struct{}
+}
+
+// startMeter starts measuring a run. The garbage left by earlier runs is
+// collected and returned to the operating system first, so it counts
+// against neither the run's allocations nor its peak RSS. With profileDir
+// set, a CPU profile of the run is written there as name.cpu.pprof, and
+// its heap as name.heap.pprof when it stops.
+func startMeter(profileDir, name string) *meter {
+    debug.FreeOSMemory()
+    m := &meter{done: make(chan struct{}), stopped: make(chan struct{})}
+    if profileDir != "" {
+        if err := os.MkdirAll(profileDir, 0o755); err != nil {
+            log.Printf("Failed to create the profile directory: %v", err)
+        } else {
+            m.heapProfile = filepath.Join(profileDir, name+".heap.pprof")
+            path := filepath.Join(profileDir, name+".cpu.pprof")
+            if file, err := os.Create(path); err != nil {
+                log.Printf("Failed to create the CPU profile: %v", err)
+            } else if err := pprof.StartCPUProfile(file); err != nil {
+                log.Printf("Failed to start the CPU profile: %v", err)
+                file.Close()
+            } else {
+                m.cpuFile = file
+            }
+        }
+    }
+    runtime.ReadMemStats(&m.before)
+    m.peakRSS = residentSetSize()
+    go m.sampleRSS()
+    return m
+}
+
+// sampleRSS keeps the highest resident set size seen until the run stops
+func (m *meter) sampleRSS() {
+    defer close(m.stopped)
+    ticker := time.NewTicker(rssInterval)
+    defer ticker.Stop()
+    for {
+        select {
+        case <-ticker.C:
+            m.peakRSS = max(m.peakRSS, residentSetSize())
+        case <-m.done:
+            return
+        }
+    }
+}
+
+// stop ends the measurement and any profiles, and returns what the run cost
+func (m *meter) stop() *models.ResourceUsage {
+    close(m.done)
+    <-m.stopped
+    var after runtime.MemStats
+    runtime.ReadMemStats(&after)
+    usage := &models.ResourceUsage{
+        PeakRSS:    max(m.peakRSS, residentSetSize()),
+        TotalAlloc: after.TotalAlloc - m.before.TotalAlloc,
+        Mallocs:    after.Mallocs - m.before.Mallocs,
+        GCCycles:   after.NumGC - m.before.NumGC,
+        GCPause:    time.Duration(after.PauseTotalNs - m.before.PauseTotalNs),
+    }
+
+    if m.cpuFile != nil {
+        pprof.StopCPUProfile()
+        if err := m.cpuFile.Close(); err != nil {
+            log.Printf("Failed to write the CPU profile: %v", err)
+        } else {
+            usage.CPUProfile = m.cpuFile.Name()
+        }
+    }
+    if m.heapProfile != "" {
+        if err := writeHeapProfile(m.heapProfile); err != nil {
+            log.Printf("Failed to write the heap profile: %v", err)
+        } else {
+            usage.HeapProfile = m.heapProfile
+        }
+    }
+    return usage
+}
+
+// writeHeapProfile writes the heap as of the last garbage collection, run
+// first so the profile is up to date
+func writeHeapProfile(path string) error {
+    runtime.GC()
+    file, err := os.Create(path)
+    if err != nil {
+        return err
+    }
+    if err := pprof.WriteHeapProfile(file); err != nil {
+        file.Close()
+        return err
+    }
+    return file.Close()
+}
+
+// residentSetSize is the process's resident memory, from /proc where there
+// is one, and otherwise the memory the Go runtime holds from the operating
+// system less what it has released, which leaves out memory of cgo
+// libraries such as DuckDB's
+func residentSetSize() int64 {
+    if statm, err := os.ReadFile("/proc/self/statm"); err == nil {
+        if fields := bytes.Fields(statm); len(fields) > 1 {
+            if pages, err := strconv.ParseInt(string(fields[1]), 10, 64); err == nil {
+                return pages * int64(os.Getpagesize())
+            }
+        }
+    }
+    samples := []runtimemetrics.Sample{{Name: "/memory/classes/total:bytes"}, {Name: "/memory/classes/heap/released:bytes"}}
+    runtimemetrics.Read(samples)
+    if samples[0].Value.Kind() != runtimemetrics.KindUint64 || samples[1].Value.Kind() != runtimemetrics.KindUint64 {
+        return 0
+    }
+    return int64(samples[0].Value.Uint64() - samples[1].Value.Uint64())
+}
+
+// profileName names the profiles of a measured run, e.g. smart-2
+func profileName(crawler string, iteration int) string {
+    return fmt.Sprintf("%s-%d", crawler, iteration)
+}
@@ -0,0 +1,275 @@
+package benchmark
+
+import (
+    "encoding/csv"
+    "encoding/json"
+    "fmt"
+    "io"
+    "maps"
+    "math"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+
+    "smart-crawler/models"
+)
+
+// Crawlers as benchmark results name them
+const (
+    CrawlerTraditional = "traditional"
+    CrawlerSmart       = "smart"
+    CrawlerSitemap     = "sitemap" // The sitemap audit baseline
+)
+
+// DefaultRegressionThreshold is how many percent worse than its baseline a
+// metric may get before a report flags it
+const DefaultRegressionThreshold = 10.0
+
+// Record summarizes the measured runs for storing, with the configuration
+// they ran under
+func (r *Result) Record(cfg Config) *models.BenchmarkResult {
+    record := &models.BenchmarkResult{
+        RanAt: time.Now(),
+        Label: cfg.Label,
+        Config: models.BenchmarkConfig{
+            StartURL:   cfg.StartURL,
+            MaxDepth:   cfg.MaxDepth,
+            Workers:    cfg.Workers,
+            Iterations: max(cfg.Iterations, 1),
+            Warmup:     cfg.Warmup,
+            Settings:   cfg.Settings,
+        },
+        Crawlers: make(map[string]*models.BenchmarkCrawler),
+    }
+    for name, runs := range map[string][]*models.CrawlStats{CrawlerTraditional: r.Traditional, CrawlerSmart: r.Smart, CrawlerSitemap: r.Sitemap} {
+        if len(runs) == 0 {
+            continue
+        }
+        crawler := &models.BenchmarkCrawler{Metrics: make(map[string]models.MetricSummary)}
+        for _, stats := range runs {
+            if stats.CrawlID != 0 {
+                crawler.CrawlIDs = append(crawler.CrawlIDs, stats.CrawlID)
+            }
+        }
+        for _, m := range metrics {
+            crawler.Metrics[m.key] = summarize(m.sample(runs))
+        }
+        record.Crawlers[name] = crawler
+    }
+    return record
+}
+
+// sameSetup reports whether two benchmarks ran under configurations whose
+// results can be compared. Synthetic sites are served on a new port each
+// time, so their URLs are not compared, their settings are.
+func sameSetup(a, b models.BenchmarkConfig) bool {
+    if a.Settings["synthetic"] == "" && a.StartURL != b.StartURL {
+        return false
+    }
+    return a.MaxDepth == b.MaxDepth && a.Workers == b.Workers && maps.Equal(a.Settings, b.Settings)
+}
+
+// Change is how one metric of one crawler moved from its baseline
+type Change struct {
+    Crawler  string
+    Metric   string
+    Baseline models.MetricSummary // Of the baseline results' means
+    Current  models.MetricSummary
+    // How much worse the current mean is than the baseline's, in percent;
+    // negative for an improvement, and +Inf for a metric that was zero
+    Worse     float64
+    Regressed bool
+}
+
+// Comparison is a benchmark result set against the results before it
+type Comparison struct {
+    Current  models.BenchmarkResult
+    Baseline []int64 // IDs of the results compared against
+    Changes  []Change
+}
+
+// Regressed reports whether any metric regressed
+func (c *Comparison) Regressed() bool {
+    for _, change := range c.Changes {
+        if change.Regressed {
+            return true
+        }
+    }
+    return false
+}
+
+// CompareResults sets current against up to window earlier results of
+// history run under the same configuration, newest first. A metric
+// regressed when its mean is more than threshold percent worse than the
+// mean of theirs and, with two or more of them, also beyond their 95%
+// confidence interval, so ordinary variation between benchmarks is not
+// flagged.
+func CompareResults(current models.BenchmarkResult, history []models.BenchmarkResult, window int, threshold float64) *Comparison {
+    comparison := &Comparison{Current: current}
+    var baseline []models.BenchmarkResult
+    for _, previous := range history {
+        if len(baseline) >= window {
+            break
+        }
+        if previous.ID != current.ID && previous.RanAt.Before(current.RanAt) && sameSetup(current.Config, previous.Config) {
+            baseline = append(baseline, previous)
+            comparison.Baseline = append(comparison.Baseline, previous.ID)
+        }
+    }
+    if len(baseline) == 0 {
+        return comparison
+    }
+
+    for _, name := range []string{CrawlerTraditional, CrawlerSmart, CrawlerSitemap} {
+        crawler := current.Crawlers[name]
+        if crawler == nil {
+            continue
+        }
+        for _, m := range metrics {
+            var means []float64
+            for _, previous := range baseline {
+                if previous.Crawlers[name] == nil {
+                    continue
+                }
+                if summary := previous.Crawlers[name].Metrics[m.key]; summary.N > 0 {
+                    means = append(means, summary.Mean)
+                }
+            }
+            summary, ok := crawler.Metrics[m.key]
+            if len(means) == 0 || !ok || summary.N == 0 {
+                continue
+            }
+            change := Change{Crawler: name, Metric: m.key, Baseline: summarize(means), Current: summary}
+            change.Worse, change.Regressed = regression(m, change.Baseline, summary, threshold)
+            comparison.Changes = append(comparison.Changes, change)
+        }
+    }
+    return comparison
+}
+
+// regression works out how much worse current is than baseline, and
+// whether that counts as a regression
+func regression(m metric, baseline, current models.MetricSummary, threshold float64) (float64, bool) {
+    delta := current.Mean - baseline.Mean
+    if m.higherIsBetter {
+        delta = -delta
+    }
+    var worse float64
+    switch {
+    case baseline.Mean != 0:
+        worse = delta / math.Abs(baseline.Mean) * 100
+    case delta > 0:
+        worse = math.Inf(1)
+    }
+    if worse <= threshold {
+        return worse, false
+    }
+    if baseline.N >= 2 {
+        beyond := current.Mean < baseline.CILow
+        if !m.higherIsBetter {
+            beyond = current.Mean > baseline.CIHigh
+        }
+        return worse, beyond
+    }
+    return worse, true
+}
+
+// metricNamed finds a metric by its key
+func metricNamed(key string) (metric, bool) {
+    for _, m := range metrics {
+        if m.key == key {
+            return m, true
+        }
+    }
+    return metric{}, false
+}
+
+// WriteComparison prints a comparison as a table of each metric's baseline
+// and current mean
+func WriteComparison(w io.Writer, c *Comparison) {
+    current := c.Current
+    fmt.Fprintf(w, "Benchmark #%d, %s", current.ID, current.RanAt.Local().Format(time.DateTime))
+    if current.Label != "" {
+        fmt.Fprintf(w, " (%s)", current.Label)
+    }
+    fmt.Fprintf(w, "\n%s, depth %d, %d workers, %d iterations\n", current.Config.StartURL, current.Config.MaxDepth, current.Config.Workers, current.Config.Iterations)
+    if len(c.Baseline) == 0 {
+        fmt.Fprintln(w, "No earlier results with the same configuration to compare with")
+        return
+    }
+    ids := make([]string, len(c.Baseline))
+    for i, id := range c.Baseline {
+        ids[i] = "#" + strconv.FormatInt(id, 10)
+    }
+    fmt.Fprintf(w, "Baseline: mean of %s\n\n", strings.Join(ids, ", "))
+
+    fmt.Fprintf(w, "%-12s %-18s %14s %14s %10s\n", "Crawler", "Metric", "Baseline", "Current", "Change")
+    fmt.Fprintln(w, strings.Repeat("-", 72))
+    for _, change := range c.Changes {
+        name := change.Metric
+        if m, ok := metricNamed(change.Metric); ok {
+            name = m.name
+        }
+        verdict := ""
+        if change.Regressed {
+            verdict = "  REGRESSED"
+        }
+        fmt.Fprintf(w, "%-12s %-18s %14.2f %14.2f %10s%s\n", change.Crawler, name, change.Baseline.Mean, change.Current.Mean, formatWorse(change.Worse), verdict)
+    }
+}
+
+// formatWorse shows how much worse a metric got as a signed change for the
+// better, so an improvement reads positive
+func formatWorse(worse float64) string {
+    if math.IsInf(worse, 1) {
+        return "new"
+    }
+    return fmt.Sprintf("%+.1f%%", 0-worse)
+}
+
+// WriteResultsJSON writes results as a JSON array
+func WriteResultsJSON(w io.Writer, results []models.BenchmarkResult) error {
+    if results == nil {
+        results = []models.BenchmarkResult{}
+    }
+    encoder := json.NewEncoder(w)
+    encoder.SetIndent("", "  ")
+    return encoder.Encode(results)
+}
+
+// WriteResultsCSV writes results as CSV, one row per crawler and metric of
+// each result
+func WriteResultsCSV(w io.Writer, results []models.BenchmarkResult) error {
+    writer := csv.NewWriter(w)
+    writer.Write([]string{"id", "ran_at", "label", "start_url", "max_depth", "workers", "iterations",
+        "crawler", "metric", "n", "mean", "median", "stddev", "ci_low", "ci_high"})
+    float := func(v float64) string {
+        return strconv.FormatFloat(v, 'f', -1, 64)
+    }
+    for _, result := range results {
+        crawlers := make([]string, 0, len(result.Crawlers))
+        for name := range result.Crawlers {
+            crawlers = append(crawlers, name)
+        }
+        sort.Strings(crawlers)
+        for _, name := range crawlers {
+            keys := make([]string, 0, len(result.Crawlers[name].Metrics))
+            for key := range result.Crawlers[name].Metrics {
+                keys = append(keys, key)
+            }
+            sort.Strings(keys)
+            for _, key := range keys {
+                s := result.Crawlers[name].Metrics[key]
+                writer.Write([]string{
+                    strconv.FormatInt(result.ID, 10), result.RanAt.UTC().Format(time.RFC3339), result.Label,
+                    result.Config.StartURL, strconv.Itoa(result.Config.MaxDepth), strconv.Itoa(result.Config.Workers),
+                    strconv.Itoa(result.Config.Iterations), name, key, strconv.Itoa(s.N),
+                    float(s.Mean), float(s.Median), float(s.StdDev), float(s.CILow), float(s.CIHigh),
+                })
+            }
+        }
+    }
+    writer.Flush()
+    return writer.Error()
+}
@@ -0,0 +1,100 @@
+package benchmark
+
+import (
+    "math"
+    "sort"
+
+    "smart-crawler/models"
+)
+
+// summarize takes the mean, median, standard deviation, and confidence
+// interval of values
+func summarize(values []float64) models.MetricSummary {
+    n := len(values)
+    if n == 0 {
+        return models.MetricSummary{}
+    }
+    sorted := append([]float64(nil), values...)
+    sort.Float64s(sorted)
+    s := models.MetricSummary{N: n, Median: sorted[n/2]}
+    if n%2 == 0 {
+        s.Median = (sorted[n/2-1] + sorted[n/2]) / 2
+    }
+    for _, v := range values {
+        s.Mean += v
+    }
+    s.Mean /= float64(n)
+    s.CILow, s.CIHigh = s.Mean, s.Mean
+    if n < 2 {
+        return s
+    }
+    for _, v := range values {
+        s.StdDev += (v - s.Mean) * (v - s.Mean)
+    }
+    s.StdDev = math.Sqrt(s.StdDev / float64(n-1))
+    margin := tCritical(float64(n-1)) * s.StdDev / math.Sqrt(float64(n))
+    s.CILow, s.CIHigh = s.Mean-margin, s.Mean+margin
+    return s
+}
+
+// Difference compares one metric of the smart crawler's runs with the
+// traditional crawler's
+type Difference struct {
+    Delta float64 `json:"delta"` // Smart mean minus traditional mean
+    // 95% confidence interval of Delta, by Welch's t-test
+    Low  float64 `json:"low"`
+    High float64 `json:"high"`
+    // Whether the interval excludes zero; false when either crawler has
+    // fewer than two runs, as their spread is unknown
+    Significant bool `json:"significant"`
+}
+
+// compare tests whether the means of smart and traditional differ, without
+// assuming their variances are equal
+func compare(traditional, smart models.MetricSummary) Difference {
+    d := Difference{Delta: smart.Mean - traditional.Mean}
+    d.Low, d.High = d.Delta, d.Delta
+    if traditional.N < 2 || smart.N < 2 {
+        return d
+    }
+    vt := traditional.StdDev * traditional.StdDev / float64(traditional.N)
+    vs := smart.StdDev * smart.StdDev / float64(smart.N)
+    se := math.Sqrt(vt + vs)
+    if se == 0 {
+        // Identical runs on both sides: any difference is exact
+        d.Significant = d.Delta != 0
+        return d
+    }
+    // Welch-Satterthwaite degrees of freedom
+    df := (vt + vs) * (vt + vs) / (vt*vt/float64(traditional.N-1) + vs*vs/float64(smart.N-1))
+    margin := tCritical(df) * se
+    d.Low, d.High = d.Delta-margin, d.Delta+margin
+    d.Significant = d.Low > 0 || d.High < 0
+    return d
+}
+
+// Two-sided 95% critical values of Student's t for 1 to 30 degrees of
+// freedom
+var tTable = []float64{
+    12.706, 4.303, 3.182, 2.776, 2.571, 2.447, 2.365, 2.306, 2.262, 2.228,
+    2.201, 2.179, 2.160, 2.145, 2.131, 2.120, 2.110, 2.101, 2.093, 2.086,
+    2.080, 2.074, 2.069, 2.064, 2.060, 2.056, 2.052, 2.048, 2.045, 2.042,
+}
+
+// tCritical is the two-sided 95% critical value of t for df degrees of
+// freedom, rounded down to the next tabulated value, which errs wide
+func tCritical(df float64) float64 {
+    switch {
+    case df < 1:
+        return tTable[0]
+    case df <= 30:
+        return tTable[int(df)-1]
+    case df <= 40:
+        return 2.042
+    case df <= 60:
+        return 2.021
+    case df <= 120:
+        return 2.000
+    }
+    return 1.980
+}
@@ -0,0 +1,252 @@
+package benchmark
+
+import (
+    "errors"
+    "fmt"
+    "hash/fnv"
+    "html"
+    "math"
+    "math/rand"
+    "net"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// Latency distributions a synthetic site draws its response delays from
+const (
+    LatencyFixed       = "fixed"       // Every response takes the mean
+    LatencyUniform     = "uniform"     // Between zero and twice the mean
+    LatencyExponential = "exponential" // Mostly fast, with a long tail
+)
+
+// SiteOptions shapes a synthetic site. Everything about a page, from its
+// text and links to its delay and whether it fails, follows from Seed and
+// its number, so the same options always serve the same site.
+type SiteOptions struct {
+    Pages          int           // Pages on the site, numbered from 0, the home page
+    Branching      int           // Child pages each page links to, forming a tree
+    DuplicateRatio float64       // Share of pages serving another page's content, at most the share without children
+    Latency        time.Duration // Mean delay before each response
+    Distribution   string        // LatencyFixed, LatencyUniform, or LatencyExponential
+    ErrorRate      float64       // Share of pages answering 500
+    Seed           int64
+}
+
+// DefaultSiteOptions is a site of 500 pages, 5 children each, a tenth of
+// them duplicates and a fiftieth failing, answering in 20ms on average
+var DefaultSiteOptions = SiteOptions{
+    Pages:          500,
+    Branching:      5,
+    DuplicateRatio: 0.1,
+    Latency:        20 * time.Millisecond,
+    Distribution:   LatencyExponential,
+    ErrorRate:      0.02,
+    Seed:           1,
+}
+
+// Validate reports options that cannot make a site
+func (o SiteOptions) Validate() error {
+    switch {
+    case o.Pages < 1:
+        return fmt.Errorf("a synthetic site needs at least one page, got %d", o.Pages)
+    case o.Branching < 1:
+        return fmt.Errorf("branching must be at least 1, got %d", o.Branching)
+    case o.DuplicateRatio < 0 || o.DuplicateRatio > 1:
+        return fmt.Errorf("duplicate ratio must be between 0 and 1, got %v", o.DuplicateRatio)
+    case o.ErrorRate < 0 || o.ErrorRate > 1:
+        return fmt.Errorf("error rate must be between 0 and 1, got %v", o.ErrorRate)
+    case o.Latency < 0:
+        return fmt.Errorf("latency must not be negative, got %v", o.Latency)
+    }
+    switch o.Distribution {
+    case LatencyFixed, LatencyUniform, LatencyExponential:
+        return nil
+    }
+    return fmt.Errorf("unknown latency distribution %q (want fixed, uniform, or exponential)", o.Distribution)
+}
+
+// Depth is the crawl depth at which every page of the site's tree is
+// reached from the home page
+func (o SiteOptions) Depth() int {
+    depth, reached, level := 0, 1, 1
+    for reached < o.Pages {
+        level *= o.Branching
+        reached += level
+        depth++
+    }
+    return depth
+}
+
+// SyntheticSite is a generated site served on a local port
+type SyntheticSite struct {
+    opts     SiteOptions
+    server   *http.Server
+    listener net.Listener
+}
+
+// StartSyntheticSite serves a site generated from opts on a free port of
+// 127.0.0.1 until Close
+func StartSyntheticSite(opts SiteOptions) (*SyntheticSite, error) {
+    if err := opts.Validate(); err != nil {
+        return nil, err
+    }
+    listener, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        return nil, fmt.Errorf("failed to listen for the synthetic site: %w", err)
+    }
+    site := &SyntheticSite{opts: opts, listener: listener}
+    site.server = &http.Server{Handler: site, ReadHeaderTimeout: 10 * time.Second}
+    go func() {
+        if err := site.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+            fmt.Printf("Synthetic site stopped: %v\n", err)
+        }
+    }()
+    return site, nil
+}
+
+// URL is the site's home page
+func (s *SyntheticSite) URL() string {
+    return "http://" + s.listener.Addr().String() + "/"
+}
+
+func (s *SyntheticSite) Close() error {
+    return s.server.Close()
+}
+
+// pageRand returns the random source of one aspect of page n, the same
+// every time for the same seed
+func (s *SyntheticSite) pageRand(n int, aspect string) *rand.Rand {
+    h := fnv.New64a()
+    fmt.Fprintf(h, "%d/%s/%d", s.opts.Seed, aspect, n)
+    return rand.New(rand.NewSource(int64(h.Sum64())))
+}
+
+// pageNumber parses "/" and "/docs/N" paths
+func pageNumber(path string) (int, bool) {
+    if path == "/" {
+        return 0, true
+    }
+    rest, ok := strings.CutPrefix(path, "/docs/")
+    if !ok {
+        return 0, false
+    }
+    n, err := strconv.Atoi(rest)
+    return n, err == nil && n >= 0 && strconv.Itoa(n) == rest
+}
+
+func pagePath(n int) string {
+    if n == 0 {
+        return "/"
+    }
+    return "/docs/" + strconv.Itoa(n)
+}
+
+func (s *SyntheticSite) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    if r.URL.Path == "/sitemap.xml" {
+        s.serveSitemap(w, r)
+        return
+    }
+    n, ok := pageNumber(r.URL.Path)
+    if !ok || n >= s.opts.Pages {
+        http.NotFound(w, r)
+        return
+    }
+
+    timer := time.NewTimer(s.latency(n))
+    defer timer.Stop()
+    select {
+    case <-timer.C:
+    case <-r.Context().Done():
+        return
+    }
+
+    // The home page always answers, so a crawl can start
+    if n > 0 && s.pageRand(n, "error").Float64() < s.opts.ErrorRate {
+        http.Error(w, "synthetic failure", http.StatusInternalServerError)
+        return
+    }
+    w.Header().Set("Content-Type", "text/html; charset=utf-8")
+    fmt.Fprint(w, s.render(s.contentOf(n)))
+}
+
+// serveSitemap lists every page of the site, the failing ones too, as a
+// sitemap audit's baseline
+func (s *SyntheticSite) serveSitemap(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Content-Type", "application/xml")
+    fmt.Fprint(w, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<urlset xmlns=\"http://www.sitemaps.org/schemas/sitemap/0.9\">\n")
+    for n := 0; n < s.opts.Pages; n++ {
+        fmt.Fprintf(w, "<url><loc>http://%s%s</loc></url>\n", r.Host, pagePath(n))
+    }
+    fmt.Fprint(w, "</urlset>\n")
+}
+
+// latency draws page n's delay from the site's distribution
+func (s *SyntheticSite) latency(n int) time.Duration {
+    mean := float64(s.opts.Latency)
+    rng := s.pageRand(n, "latency")
+    switch s.opts.Distribution {
+    case LatencyUniform:
+        return time.Duration(rng.Float64() * 2 * mean)
+    case LatencyExponential:
+        // Capped, so one page cannot hold a worker for long
+        return time.Duration(math.Min(rng.ExpFloat64()*mean, 20*mean))
+    }
+    return time.Duration(mean)
+}
+
+// contentOf is the page whose content page n serves: its own, or for a
+// duplicate that of an earlier page. Only pages without children are made
+// duplicates, as a duplicate links where its original does and would cut
+// its subtree off.
+func (s *SyntheticSite) contentOf(n int) int {
+    firstLeaf := (s.opts.Pages - 2 + s.opts.Branching) / s.opts.Branching
+    if n == 0 || n < firstLeaf {
+        return n
+    }
+    share := s.opts.DuplicateRatio * float64(s.opts.Pages) / float64(s.opts.Pages-firstLeaf)
+    rng := s.pageRand(n, "duplicate")
+    if rng.Float64() < share {
+        return rng.Intn(n)
+    }
+    return n
+}
+
+// Words synthetic text is made of
+var syntheticWords = strings.Fields(`crawler frontier priority quality content page site link
+    archive index search engine network request response latency server client cache queue
+    worker thread memory storage database schema record field value query result analysis
+    document article section paragraph heading summary report review guide tutorial reference`)
+
+// render writes page n: a title, paragraphs of uneven length, and links to
+// its children in the tree, its parent, and a few pages anywhere on the site
+func (s *SyntheticSite) render(n int) string {
+    rng := s.pageRand(n, "content")
+    var b strings.Builder
+    title := fmt.Sprintf("Page %d: %s %s", n, syntheticWords[rng.Intn(len(syntheticWords))], syntheticWords[rng.Intn(len(syntheticWords))])
+    fmt.Fprintf(&b, "<!DOCTYPE html>\n<html><head><title>%s</title></head><body>\n<h1>%s</h1>\n", html.EscapeString(title), html.EscapeString(title))
+
+    // Some pages are thin, others long articles, so their quality differs
+    for p := 1 + rng.Intn(6); p > 0; p-- {
+        words := make([]string, 20+rng.Intn(120))
+        for i := range words {
+            words[i] = syntheticWords[rng.Intn(len(syntheticWords))]
+        }
+        fmt.Fprintf(&b, "<p>%s.</p>\n", strings.Join(words, " "))
+    }
+
+    b.WriteString("<nav>\n")
+    if n > 0 {
+        fmt.Fprintf(&b, "<a href=\"%s\">Up</a>\n", pagePath((n-1)/s.opts.Branching))
+    }
+    for child := n*s.opts.Branching + 1; child <= n*s.opts.Branching+s.opts.Branching && child < s.opts.Pages; child++ {
+        fmt.Fprintf(&b, "<a href=\"%s\">Page %d</a>\n", pagePath(child), child)
+    }
+    for i := rng.Intn(s.opts.Branching + 1); i > 0; i-- {
+        other := rng.Intn(s.opts.Pages)
+        fmt.Fprintf(&b, "<a href=\"%s\">See also page %d</a>\n", pagePath(other), other)
+    }
+    b.WriteString("</nav>\n</body></html>\n")
+    return b.String()
+}
@@ -0,0 +1,83 @@
+package blobstore
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "net/url"
+    "os"
+    "strings"
+)
+
+// ErrNotFound is returned by Get for a key that holds no blob
+var ErrNotFound = errors.New("blob not found")
+
+// Store keeps immutable blobs under keys. Page bodies are written under
+// their content hash, so writing a key twice writes the same bytes.
+type Store interface {
+    Put(ctx context.Context, key string, data []byte) error
+    Get(ctx context.Context, key string) ([]byte, error)
+    Delete(ctx context.Context, key string) error
+    // String names the store in logs, without credentials
+    String() string
+}
+
+// Open returns the blob store a location names: a local directory, as a
+// path or file:// URL, or an S3 bucket as s3://bucket/prefix. S3
+// credentials and region come from the standard AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY, AWS_SESSION_TOKEN, and AWS_REGION variables;
+// S3_ENDPOINT points at an S3-compatible server such as MinIO instead of
+// AWS.
+func Open(location string) (Store, error) {
+    if !strings.Contains(location, "://") {
+        return NewDir(location)
+    }
+    u, err := url.Parse(location)
+    if err != nil {
+        return nil, fmt.Errorf("invalid blob store %q: %w", location, err)
+    }
+
+    switch u.Scheme {
+    case "file":
+        return NewDir(u.Path)
+    case "s3":
+        if u.Host == "" {
+            return nil, fmt.Errorf("invalid blob store %q: no bucket", location)
+        }
+        return NewS3(S3Config{
+            Bucket:       u.Host,
+            Prefix:       strings.Trim(u.Path, "/"),
+            Region:       os.Getenv("AWS_REGION"),
+            Endpoint:     os.Getenv("S3_ENDPOINT"),
+            AccessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+            SecretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+            SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+        })
+    default:
+        return nil, fmt.Errorf("invalid blob store %q: use a directory, file://, or s3://", location)
+    }
+}
+
+// BodyKey is the key a page body with this content hash is stored under:
+// the first two characters of the hash name a directory, so no directory
+// or listing grows too large, and ext names the body's encoding
+func BodyKey(hash, ext string) string {
+    return hashKey("bodies", hash, ext)
+}
+
+// ThumbnailKey is the key a thumbnail of the image with this content hash
+// is stored under, laid out like page bodies, with ext naming its format
+func ThumbnailKey(hash, ext string) string {
+    return hashKey("thumbnails", hash, ext)
+}
+
+func hashKey(dir, hash, ext string) string {
+    prefix := hash
+    if len(prefix) > 2 {
+        prefix = prefix[:2]
+    }
+    if ext != "" {
+        ext = "." + ext
+    }
+    return dir + "/" + prefix + "/" + hash + ext
+}
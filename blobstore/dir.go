@@ -0,0 +1,94 @@
+package blobstore
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "io/fs"
+    "os"
+    "path/filepath"
+    "strings"
+)
+
+// Dir stores blobs as files under a local directory
+type Dir struct {
+    root string
+}
+
+// NewDir stores blobs under root, creating it if needed
+func NewDir(root string) (*Dir, error) {
+    if root == "" {
+        return nil, fmt.Errorf("blob store directory not set")
+    }
+    if err := os.MkdirAll(root, 0o755); err != nil {
+        return nil, fmt.Errorf("failed to create blob store directory: %w", err)
+    }
+    return &Dir{root: root}, nil
+}
+
+func (d *Dir) path(key string) (string, error) {
+    clean := filepath.Clean(filepath.FromSlash(key))
+    if clean == "." || filepath.IsAbs(clean) || strings.HasPrefix(clean, ".."+string(filepath.Separator)) || clean == ".." {
+        return "", fmt.Errorf("invalid blob key %q", key)
+    }
+    return filepath.Join(d.root, clean), nil
+}
+
+// Put writes the blob to a temporary file first and renames it into place,
+// so a reader never sees a partial blob
+func (d *Dir) Put(ctx context.Context, key string, data []byte) error {
+    path, err := d.path(key)
+    if err != nil {
+        return err
+    }
+    if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+        return err
+    }
+
+    tmp, err := os.CreateTemp(filepath.Dir(path), ".blob-*")
+    if err != nil {
+        return err
+    }
+    if _, err := tmp.Write(data); err != nil {
+        tmp.Close()
+        os.Remove(tmp.Name())
+        return err
+    }
+    if err := tmp.Close(); err != nil {
+        os.Remove(tmp.Name())
+        return err
+    }
+    if err := os.Rename(tmp.Name(), path); err != nil {
+        os.Remove(tmp.Name())
+        return err
+    }
+    return nil
+}
+
+func (d *Dir) Get(ctx context.Context, key string) ([]byte, error) {
+    path, err := d.path(key)
+    if err != nil {
+        return nil, err
+    }
+    data, err := os.ReadFile(path)
+    if errors.Is(err, fs.ErrNotExist) {
+        return nil, ErrNotFound
+    }
+    return data, err
+}
+
+// Delete removes a blob; deleting one that does not exist is not an error
+func (d *Dir) Delete(ctx context.Context, key string) error {
+    path, err := d.path(key)
+    if err != nil {
+        return err
+    }
+    if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+        return err
+    }
+    return nil
+}
+
+func (d *Dir) String() string {
+    return d.root
+}
@@ -0,0 +1,224 @@
+package blobstore
+
+import (
+    "bytes"
+    "context"
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/hex"
+    "fmt"
+    "io"
+    "net/http"
+    "net/url"
+    "sort"
+    "strings"
+    "time"
+)
+
+// S3Config locates a bucket and the credentials to use it
+type S3Config struct {
+    Bucket       string
+    Prefix       string // Prepended to every key, e.g. "crawler"
+    Region       string // us-east-1 when empty
+    Endpoint     string // S3-compatible server URL, e.g. http://localhost:9000; AWS when empty
+    AccessKey    string
+    SecretKey    string
+    SessionToken string
+}
+
+// S3 stores blobs as objects in an S3 bucket, or on any server speaking the
+// S3 API. Requests are signed with AWS Signature Version 4.
+type S3 struct {
+    config S3Config
+    base   *url.URL // Bucket URL that keys are appended to
+    client *http.Client
+}
+
+// NewS3 stores blobs in the configured bucket. AWS buckets are addressed by
+// virtual host; custom endpoints by path, as MinIO and most other servers
+// expect.
+func NewS3(config S3Config) (*S3, error) {
+    if config.Bucket == "" {
+        return nil, fmt.Errorf("S3 bucket not set")
+    }
+    if config.AccessKey == "" || config.SecretKey == "" {
+        return nil, fmt.Errorf("S3 credentials not set: AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+    }
+    if config.Region == "" {
+        config.Region = "us-east-1"
+    }
+
+    var base *url.URL
+    if config.Endpoint != "" {
+        endpoint, err := url.Parse(config.Endpoint)
+        if err != nil || endpoint.Host == "" {
+            return nil, fmt.Errorf("invalid S3 endpoint %q", config.Endpoint)
+        }
+        base = endpoint.JoinPath(config.Bucket)
+    } else {
+        base = &url.URL{Scheme: "https", Host: fmt.Sprintf("%s.s3.%s.amazonaws.com", config.Bucket, config.Region)}
+    }
+
+    return &S3{config: config, base: base, client: &http.Client{Timeout: time.Minute}}, nil
+}
+
+func (s *S3) Put(ctx context.Context, key string, data []byte) error {
+    resp, err := s.do(ctx, http.MethodPut, key, data)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+    return s.check(resp, key)
+}
+
+func (s *S3) Get(ctx context.Context, key string) ([]byte, error) {
+    resp, err := s.do(ctx, http.MethodGet, key, nil)
+    if err != nil {
+        return nil, err
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode == http.StatusNotFound {
+        return nil, ErrNotFound
+    }
+    if err := s.check(resp, key); err != nil {
+        return nil, err
+    }
+    return io.ReadAll(resp.Body)
+}
+
+// Delete removes an object; S3 answers deleting a missing one with success
+func (s *S3) Delete(ctx context.Context, key string) error {
+    resp, err := s.do(ctx, http.MethodDelete, key, nil)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+    return s.check(resp, key)
+}
+
+func (s *S3) String() string {
+    location := "s3://" + s.config.Bucket
+    if s.config.Prefix != "" {
+        location += "/" + s.config.Prefix
+    }
+    return location
+}
+
+func (s *S3) check(resp *http.Response, key string) error {
+    if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+        return nil
+    }
+    message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+    return fmt.Errorf("S3 %s %s: %s: %s", resp.Request.Method, key, resp.Status, bytes.TrimSpace(message))
+}
+
+func (s *S3) do(ctx context.Context, method, key string, body []byte) (*http.Response, error) {
+    if s.config.Prefix != "" {
+        key = s.config.Prefix + "/" + key
+    }
+    target := *s.base
+    target.Path = strings.TrimSuffix(target.Path, "/") + "/" + key
+    target.RawPath = ""
+
+    req, err := http.NewRequestWithContext(ctx, method, target.String(), bytes.NewReader(body))
+    if err != nil {
+        return nil, err
+    }
+    if s.config.SessionToken != "" {
+        req.Header.Set("X-Amz-Security-Token", s.config.SessionToken)
+    }
+    signV4(req, body, s.config.AccessKey, s.config.SecretKey, s.config.Region, "s3", time.Now())
+    return s.client.Do(req)
+}
+
+// signV4 signs req with AWS Signature Version 4 over its path, query, Host,
+// and every header already set, adding the X-Amz-Date,
+// X-Amz-Content-Sha256, and Authorization headers
+func signV4(req *http.Request, body []byte, accessKey, secretKey, region, service string, now time.Time) {
+    amzDate := now.UTC().Format("20060102T150405Z")
+    date := amzDate[:8]
+    payloadHash := sha256Hex(body)
+    req.Header.Set("X-Amz-Date", amzDate)
+    req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+    headers := map[string]string{"host": req.URL.Host}
+    for name, values := range req.Header {
+        headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+    }
+    names := make([]string, 0, len(headers))
+    for name := range headers {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    var canonicalHeaders strings.Builder
+    for _, name := range names {
+        canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+    }
+    signedHeaders := strings.Join(names, ";")
+
+    canonicalRequest := strings.Join([]string{
+        req.Method,
+        uriEncode(req.URL.Path, false),
+        canonicalQuery(req.URL.Query()),
+        canonicalHeaders.String(),
+        signedHeaders,
+        payloadHash,
+    }, "\n")
+    scope := date + "/" + region + "/" + service + "/aws4_request"
+    stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+    key := hmacSHA256([]byte("AWS4"+secretKey), date)
+    key = hmacSHA256(key, region)
+    key = hmacSHA256(key, service)
+    key = hmacSHA256(key, "aws4_request")
+    signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+    req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+        accessKey, scope, signedHeaders, signature))
+}
+
+func canonicalQuery(query url.Values) string {
+    keys := make([]string, 0, len(query))
+    for key := range query {
+        keys = append(keys, key)
+    }
+    sort.Strings(keys)
+    var parts []string
+    for _, key := range keys {
+        values := append([]string(nil), query[key]...)
+        sort.Strings(values)
+        for _, value := range values {
+            parts = append(parts, uriEncode(key, true)+"="+uriEncode(value, true))
+        }
+    }
+    return strings.Join(parts, "&")
+}
+
+// uriEncode percent-encodes every byte but the unreserved characters, and
+// slashes unless encodeSlash, as Signature Version 4 requires
+func uriEncode(s string, encodeSlash bool) string {
+    var b strings.Builder
+    for i := 0; i < len(s); i++ {
+        c := s[i]
+        switch {
+        case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+            b.WriteByte(c)
+        case c == '/' && !encodeSlash:
+            b.WriteByte(c)
+        default:
+            fmt.Fprintf(&b, "%%%02X", c)
+        }
+    }
+    return b.String()
+}
+
+func sha256Hex(data []byte) string {
+    sum := sha256.Sum256(data)
+    return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+    mac := hmac.New(sha256.New, key)
+    mac.Write([]byte(data))
+    return mac.Sum(nil)
+}
@@ -0,0 +1,573 @@
+package main
+
+import (
+    "encoding/json"
+    "errors"
+    "flag"
+    "fmt"
+    "log"
+    "os"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+
+    "smart-crawler/api"
+    "smart-crawler/audit"
+    "smart-crawler/benchmark"
+    "smart-crawler/crawler"
+    "smart-crawler/database"
+    "smart-crawler/dataset"
+    "smart-crawler/progress"
+    "smart-crawler/replay"
+)
+
+func runBenchmark(args []string) {
+    fs := newFlagSet("benchmark", "", "Crawl -url with the traditional and then the smart crawler, each as its own crawl session,\n"+
+        "and compare pages, quality, duplicates, and storage.")
+    url := fs.String("url", "https://example.com", "Starting URL to crawl")
+    depth := fs.Int("depth", 3, "Maximum crawl depth")
+    workers := fs.Int("workers", 10, "Number of concurrent workers per crawler")
+    iterations := fs.Int("iterations", 1, "Measured runs of each crawler, reported with their mean, spread, and significance when more than 1")
+    warmup := fs.Int("warmup", 0, "Runs of each crawler before the measured ones, whose results are discarded")
+    sitemap := fs.Bool("sitemap", false, "Also audit the site's sitemaps in each iteration, as a baseline of fetching the pages the site lists")
+    harvestThreshold := fs.Float64("harvest-threshold", 0.5, "Relevance (to -topic, or content quality; 0-1) at which a page counts towards the harvest rate (0 disables)")
+    topicKeywords := fs.String("topic", "", "Comma-separated keywords both crawlers score pages' relevance against for the harvest rate, and the smart crawler focuses on")
+    topicDocs := fs.String("topic-docs", "", "Comma-separated text or HTML files that describe the topic, instead of or as well as -topic")
+    profileDir := fs.String("profile-dir", "", "Directory to write a pprof CPU and heap profile of each measured run to")
+    label := fs.String("label", "", "Label stored with the result, e.g. the commit benchmarked, shown by 'report'")
+    progressMode := fs.String("progress", "auto", "Progress display: 'live' redrawn in the terminal, 'log' lines every 30s, 'off', or 'auto' (live on a terminal)")
+    cachePath := fs.String("http-cache", "", "WARC file (.warc or .warc.gz) to replay responses from and record new ones to, so both runs see the same site")
+    offline := fs.Bool("http-cache-offline", false, "Fail requests for URLs not in -http-cache instead of fetching them")
+    synthetic := fs.Bool("synthetic", false, "Benchmark against a generated site served locally instead of -url")
+    site := benchmark.DefaultSiteOptions
+    fs.IntVar(&site.Pages, "synthetic-pages", site.Pages, "Pages of the -synthetic site")
+    fs.IntVar(&site.Branching, "synthetic-branching", site.Branching, "Child pages each -synthetic page links to")
+    fs.Float64Var(&site.DuplicateRatio, "synthetic-duplicates", site.DuplicateRatio, "Share of -synthetic pages duplicating another page's content")
+    fs.DurationVar(&site.Latency, "synthetic-latency", site.Latency, "Mean delay of -synthetic responses")
+    fs.StringVar(&site.Distribution, "synthetic-latency-dist", site.Distribution, "Distribution of -synthetic delays: 'fixed', 'uniform', or 'exponential'")
+    fs.Float64Var(&site.ErrorRate, "synthetic-errors", site.ErrorRate, "Share of -synthetic pages answering 500")
+    fs.Int64Var(&site.Seed, "synthetic-seed", site.Seed, "Seed the -synthetic site is generated from")
+    store := addStoreFlags(fs)
+    parseFlags(fs, args)
+    display, err := progress.ParseMode(*progressMode)
+    if err != nil {
+        log.Fatalf("Invalid -progress: %v", err)
+    }
+    if *iterations < 1 || *warmup < 0 {
+        log.Fatal("-iterations must be at least 1 and -warmup not negative")
+    }
+    if *harvestThreshold < 0 || *harvestThreshold > 1 {
+        log.Fatal("-harvest-threshold must be between 0 and 1")
+    }
+    var topic *crawler.Topic
+    if *topicKeywords != "" || *topicDocs != "" {
+        if topic, err = crawler.LoadTopic(splitList(*topicKeywords), splitList(*topicDocs)); err != nil {
+            log.Fatalf("Invalid -topic: %v", err)
+        }
+    }
+    if *offline && *cachePath == "" {
+        log.Fatal("-http-cache-offline needs -http-cache")
+    }
+
+    cfg := loadConfig()
+    db := store.open(cfg)
+    defer db.Close()
+    defer startTracing(cfg)()
+    ctx, cancel := signalContext()
+    defer cancel()
+
+    if *synthetic {
+        server, err := benchmark.StartSyntheticSite(site)
+        if err != nil {
+            log.Fatalf("Invalid synthetic site: %v", err)
+        }
+        defer server.Close()
+        *url = server.URL()
+        // Deep enough to reach every page, unless -depth says otherwise
+        depthSet := false
+        fs.Visit(func(f *flag.Flag) { depthSet = depthSet || f.Name == "depth" })
+        if !depthSet {
+            *depth = site.Depth()
+        }
+        log.Printf("Serving a synthetic site of %d pages (branching %d, %.0f%% duplicates, %.0f%% errors, %v %s latency, seed %d) at %s",
+            site.Pages, site.Branching, site.DuplicateRatio*100, site.ErrorRate*100, site.Latency, site.Distribution, site.Seed, *url)
+    }
+
+    options := fetchOptions(cfg)
+    if *harvestThreshold > 0 {
+        options = append(options, crawler.WithHarvestThreshold(*harvestThreshold))
+    }
+    if topic != nil {
+        options = append(options, crawler.WithTopic(topic))
+    }
+    var cache *replay.Cache
+    if *cachePath != "" {
+        if cache, err = replay.OpenCache(*cachePath); err != nil {
+            log.Fatalf("Failed to open -http-cache: %v", err)
+        }
+        cache.SetOffline(*offline)
+        log.Printf("Replaying %d cached responses from %s", cache.Len(), *cachePath)
+        options = append(options, crawler.WithReplayCache(cache))
+    }
+
+    // Everything besides the flags above that changes what is measured, so
+    // 'report' only compares results run alike
+    settings := map[string]string{
+        "rate_limit":         strconv.FormatFloat(cfg.RateLimit, 'f', -1, 64),
+        "http_version":       cfg.HTTPVersion,
+        "max_conns_per_host": strconv.Itoa(cfg.HTTPMaxConnsPerHost),
+        "request_timeout":    cfg.RequestTimeout.String(),
+        "harvest_threshold":  strconv.FormatFloat(*harvestThreshold, 'f', -1, 64),
+    }
+    if *synthetic {
+        settings["synthetic"] = fmt.Sprintf("pages=%d branching=%d duplicates=%v latency=%v/%s errors=%v seed=%d",
+            site.Pages, site.Branching, site.DuplicateRatio, site.Latency, site.Distribution, site.ErrorRate, site.Seed)
+    }
+    if cache != nil {
+        settings["http_cache"] = *cachePath
+    }
+    if topic != nil {
+        settings["topic"] = *topicKeywords
+        settings["topic_docs"] = *topicDocs
+    }
+    // Profiling slows the crawlers down a little
+    if *profileDir != "" {
+        settings["profiled"] = "true"
+    }
+    benchmarkConfig := benchmark.Config{
+        StartURL:   *url,
+        MaxDepth:   *depth,
+        Workers:    *workers,
+        Display:    display,
+        Iterations: *iterations,
+        Warmup:     *warmup,
+        Label:      *label,
+        Settings:   settings,
+        ProfileDir: *profileDir,
+        Sitemap:    *sitemap,
+    }
+    result := benchmark.Run(ctx, db, benchmarkConfig, options...)
+    // An interrupted benchmark measured less than it was asked to
+    if ctx.Err() == nil {
+        if id, err := db.SaveBenchmarkResult(result.Record(benchmarkConfig)); err != nil {
+            log.Printf("Failed to save the benchmark result: %v", err)
+        } else {
+            log.Printf("Saved benchmark result #%d; compare it with earlier ones with 'report'", id)
+        }
+    }
+
+    if cache != nil {
+        recorded, replayed := cache.Stats()
+        log.Printf("HTTP cache: %d responses recorded live, %d requests replayed", recorded, replayed)
+        if recorded > 0 {
+            if err := cache.Save(); err != nil {
+                log.Fatalf("Failed to save -http-cache: %v", err)
+            }
+        }
+    }
+}
+
+func runReport(args []string) {
+    fs := newFlagSet("report", "", "Compare a stored benchmark result with the mean of earlier ones run under the same\n"+
+        "configuration, exiting with status 1 if a metric regressed, or export stored results.")
+    id := fs.Int64("id", 0, "Benchmark result to report on (default the latest)")
+    window := fs.Int("baseline", 5, "Earlier results with the same configuration to compare with")
+    threshold := fs.Float64("threshold", benchmark.DefaultRegressionThreshold, "Percent a metric may get worse than the baseline before it counts as a regression")
+    format := fs.String("format", "text", "Output: 'text' compares -id with its baseline; 'json' or 'csv' export every stored result")
+    limit := fs.Int("limit", 0, "Most recent results to export with -format json or csv (0 for all)")
+    store := addStoreFlags(fs)
+    parseFlags(fs, args)
+    if *window < 1 || *threshold < 0 || *limit < 0 {
+        log.Fatal("-baseline must be at least 1, and -threshold and -limit not negative")
+    }
+
+    cfg := loadConfig()
+    db := store.open(cfg)
+    defer db.Close()
+
+    switch *format {
+    case "json", "csv":
+        results, err := db.BenchmarkResults(*limit)
+        if err != nil {
+            log.Fatalf("Failed to load benchmark results: %v", err)
+        }
+        if *format == "json" {
+            err = benchmark.WriteResultsJSON(os.Stdout, results)
+        } else {
+            err = benchmark.WriteResultsCSV(os.Stdout, results)
+        }
+        if err != nil {
+            log.Fatalf("Failed to write benchmark results: %v", err)
+        }
+        return
+    case "text":
+    default:
+        log.Fatalf("Invalid -format %q (want text, json, or csv)", *format)
+    }
+
+    results, err := db.BenchmarkResults(0)
+    if err != nil {
+        log.Fatalf("Failed to load benchmark results: %v", err)
+    }
+    if len(results) == 0 {
+        log.Fatal("No benchmark results stored yet; run 'benchmark' first")
+    }
+    current := results[0]
+    if *id != 0 {
+        found := false
+        for _, result := range results {
+            if result.ID == *id {
+                current, found = result, true
+                break
+            }
+        }
+        if !found {
+            log.Fatalf("Benchmark result %d not found", *id)
+        }
+    }
+
+    comparison := benchmark.CompareResults(current, results, *window, *threshold)
+    benchmark.WriteComparison(os.Stdout, comparison)
+    if comparison.Regressed() {
+        log.Fatalf("Benchmark result #%d regressed against its baseline", current.ID)
+    }
+}
+
+func runServe(args []string) {
+    fs := newFlagSet("serve", "", "Serve the REST API for starting crawls and querying what they stored, and with\n"+
+        "-grpc-addr the gRPC service, until interrupted. Requires the Postgres store.")
+    addr := fs.String("addr", ":8080", "REST listen address")
+    grpcAddr := fs.String("grpc-addr", "", "gRPC listen address (disabled when empty)")
+    site := addSiteFlags(fs)
+    store := addStoreFlags(fs)
+    parseFlags(fs, args)
+
+    cfg := loadConfig()
+    tagRules, err := crawler.ParseTagRules(cfg.TagRules)
+    if err != nil {
+        log.Fatalf("Invalid TAG_RULES: %v", err)
+    }
+    auditLog, auth, headers := site.load()
+    if auditLog != nil {
+        defer auditLog.Close()
+    }
+    proxies := loadProxies(cfg)
+    if proxies != nil {
+        defer logProxies(proxies)
+    }
+
+    db := store.open(cfg)
+    defer db.Close()
+    defer startTracing(cfg)()
+    ctx, cancel := signalContext()
+    defer cancel()
+    if proxies != nil && cfg.ProxyCheckURL != "" {
+        go proxies.HealthCheck(ctx, cfg.ProxyCheckURL, time.Minute)
+    }
+
+    server := api.NewServer(ctx, requirePostgres(db, "serve"), tagRules)
+    server.SetAuditLog(auditLog)
+    server.SetProxyPool(proxies)
+    server.SetAuth(auth)
+    server.SetHeaders(headers)
+    server.SetCrawlerOptions(fetchOptions(cfg)...)
+    if *grpcAddr != "" {
+        go func() {
+            if err := server.ServeGRPC(ctx, *grpcAddr); err != nil {
+                log.Fatalf("gRPC server failed: %v", err)
+            }
+        }()
+    }
+    if err := server.ListenAndServe(ctx, *addr); err != nil {
+        log.Fatalf("API server failed: %v", err)
+    }
+}
+
+func runSearch(args []string) {
+    fs := newFlagSet("search", "", "List stored pages matching the filters, one per line: ID, status, quality, importance, URL,\n"+
+        "and title, or JSON with -json. Requires the Postgres store.")
+    var query database.PageQuery
+    fs.Int64Var(&query.CrawlID, "crawl-id", 0, "Only pages of this crawl session")
+    fs.StringVar(&query.Host, "host", "", "Only pages on this host")
+    fs.StringVar(&query.Tag, "tag", "", "Only pages with this tag")
+    fs.StringVar(&query.SchemaType, "schema-type", "", "Only pages with a structured data item of this type, e.g. Product")
+    fs.IntVar(&query.StatusCode, "status", 0, "Only pages answered with this HTTP status")
+    minQuality := fs.Float64("min-quality", 0, "Only pages with at least this content quality score (0-1)")
+    fs.StringVar(&query.SortBy, "sort", "id", "Order by 'id', 'crawled_at', 'depth', 'size', 'status_code', 'importance_score', 'content_quality', 'load_time_ms', or 'relevance'")
+    fs.BoolVar(&query.Descending, "desc", false, "Sort in descending order")
+    fs.IntVar(&query.Limit, "limit", 50, "Pages to list (1-1000)")
+    fs.StringVar(&query.Cursor, "cursor", "", "Continue after the last page of a previous search, as printed by it")
+    asJSON := fs.Bool("json", false, "Print each page as a JSON object")
+    store := addStoreFlags(fs)
+    parseFlags(fs, args)
+
+    if query.Limit < 1 || query.Limit > 1000 {
+        log.Fatalf("-limit must be between 1 and 1000")
+    }
+    if *minQuality > 0 {
+        query.MinQuality = minQuality
+    }
+
+    cfg := loadConfig()
+    db := store.open(cfg)
+    defer db.Close()
+
+    list, err := requirePostgres(db, "search").QueryPages(query)
+    if errors.Is(err, database.ErrInvalidQuery) {
+        log.Fatalf("Invalid search: %v", err)
+    }
+    if err != nil {
+        log.Fatalf("Search failed: %v", err)
+    }
+
+    encoder := json.NewEncoder(os.Stdout)
+    for _, page := range list.Pages {
+        if *asJSON {
+            encoder.Encode(page)
+            continue
+        }
+        fmt.Printf("%d\t%d\t%.3f\t%.3f\t%s\t%s\n", page.ID, page.StatusCode, page.ContentQuality, page.Importance, page.URL, page.Title)
+    }
+    if list.NextCursor != "" {
+        log.Printf("More pages match; continue with -cursor=%s", list.NextCursor)
+    }
+}
+
+func runExport(args []string) {
+    fs := newFlagSet("export", "", "Write crawl session -crawl-id as a dataset package (a zstd-compressed tar of pages, links,\n"+
+        "and a manifest, in JSONL or Parquet) or as a link graph. Requires the Postgres store.")
+    crawlID := fs.Int64("crawl-id", 0, "Crawl session to export (required)")
+    formatName := fs.String("format", "jsonl", "Package table format, 'jsonl' or 'parquet', or link graph format, 'graphml', 'dot', or 'gexf'")
+    outPath := fs.String("out", "", "File to write (default crawl-<id>.tar.zst for a package, crawl-<id>.<format> for a graph)")
+    anonymize := fs.Bool("anonymize", false, "Leave page titles and bodies out of a package")
+    hashURLs := fs.Bool("hash-urls", false, "Replace URLs with keyed hashes in a package")
+    store := addStoreFlags(fs)
+    parseFlags(fs, args)
+
+    if *crawlID == 0 {
+        log.Fatalf("export requires -crawl-id")
+    }
+    packageFormat, packageErr := dataset.ParseFormat(*formatName)
+    graphFormat, graphErr := dataset.ParseGraphFormat(*formatName)
+    if packageErr != nil && graphErr != nil {
+        log.Fatalf("Invalid -format: %s. Use 'jsonl' or 'parquet' for a package, or 'graphml', 'dot', or 'gexf' for a link graph", *formatName)
+    }
+    if graphErr == nil && (*anonymize || *hashURLs) {
+        log.Fatalf("-anonymize and -hash-urls only apply to packages")
+    }
+
+    cfg := loadConfig()
+    db := store.open(cfg)
+    defer db.Close()
+
+    postgres := requirePostgres(db, "export")
+    if packageErr == nil {
+        runPackage(postgres, *crawlID, *outPath, dataset.Options{Format: packageFormat, Anonymize: *anonymize, HashURLs: *hashURLs})
+    } else {
+        runGraph(postgres, *crawlID, *outPath, graphFormat)
+    }
+}
+
+func runPackage(db *database.PostgresDB, crawlID int64, outPath string, opts dataset.Options) {
+    if outPath == "" {
+        outPath = fmt.Sprintf("crawl-%d.tar.zst", crawlID)
+    }
+
+    manifest, err := dataset.Package(db, crawlID, outPath, opts)
+    if err != nil {
+        log.Fatalf("Failed to package crawl %d: %v", crawlID, err)
+    }
+
+    for _, file := range manifest.Files {
+        log.Printf("%s: %d records, %d bytes", file.Name, file.Records, file.Size)
+    }
+    log.Printf("Dataset for crawl %d written to %s", crawlID, outPath)
+}
+
+func runGraph(db *database.PostgresDB, crawlID int64, outPath string, format dataset.GraphFormat) {
+    if outPath == "" {
+        outPath = fmt.Sprintf("crawl-%d.%s", crawlID, format)
+    }
+
+    file, err := os.Create(outPath)
+    if err != nil {
+        log.Fatalf("Failed to create %s: %v", outPath, err)
+    }
+    stats, err := dataset.ExportGraph(db, crawlID, file, format)
+    if closeErr := file.Close(); err == nil {
+        err = closeErr
+    }
+    if err != nil {
+        os.Remove(outPath)
+        log.Fatalf("Failed to export the link graph of crawl %d: %v", crawlID, err)
+    }
+    log.Printf("Link graph of crawl %d written to %s: %d pages, %d links", crawlID, outPath, stats.Nodes, stats.Edges)
+}
+
+// runQueue lists the URLs that failed every attempt, or queues those of a
+// crawl again
+func runQueue(args []string) {
+    fs := newFlagSet("queue", "", "List the URLs the smart crawler gave up on after -max-attempts failed fetches, with their\n"+
+        "attempts and last error, or with -requeue make them pending again for 'crawl -resume'.")
+    crawlID := fs.Int64("crawl-id", 0, "Crawl session whose failed URLs to list (0 lists every crawl's) or requeue")
+    requeue := fs.Bool("requeue", false, "Queue the failed URLs of -crawl-id again with a fresh retry budget")
+    store := addStoreFlags(fs)
+    parseFlags(fs, args)
+
+    if *requeue && *crawlID == 0 {
+        log.Fatalf("-requeue requires -crawl-id")
+    }
+
+    cfg := loadConfig()
+    db := store.open(cfg)
+    defer db.Close()
+
+    if *requeue {
+        requeued, err := db.RequeueFailed(*crawlID)
+        if err != nil {
+            log.Fatalf("Failed to requeue failed URLs of crawl %d: %v", *crawlID, err)
+        }
+        log.Printf("Requeued %d failed URLs of crawl %d; continue the crawl with 'crawl -resume'", requeued, *crawlID)
+        return
+    }
+
+    failed, err := db.GetFailedURLs(*crawlID)
+    if err != nil {
+        log.Fatalf("Failed to list failed URLs: %v", err)
+    }
+    if len(failed) == 0 {
+        log.Printf("No failed URLs")
+        return
+    }
+    for _, url := range failed {
+        fmt.Printf("%d\t%d\t%s\t%s\t%s\n", url.CrawlID, url.Attempts, url.LastAttempt.Format(time.RFC3339), url.URL, url.LastError)
+    }
+}
+
+// runMigrate brings the schema up to date, which opening the store does,
+// and optionally compresses the page bodies stored before bodies were
+// compressed on write
+func runMigrate(args []string) {
+    fs := newFlagSet("migrate", "", "Migrate the database schema to this build's version, as every command does on startup,\n"+
+        "then exit.")
+    compressBodies := fs.Bool("compress-bodies", false, "Also compress page bodies stored before compression, 500 per transaction (Postgres only)")
+    store := addStoreFlags(fs)
+    parseFlags(fs, args)
+
+    cfg := loadConfig()
+    db := store.open(cfg)
+    defer db.Close()
+    log.Printf("Database schema is up to date")
+    if !*compressBodies {
+        return
+    }
+
+    report, err := requirePostgres(db, "-compress-bodies").CompressBodies(500)
+    if err != nil {
+        log.Fatalf("Failed to compress page bodies after %d: %v", report.Bodies, err)
+    }
+    if report.Bodies == 0 {
+        log.Printf("No uncompressed page bodies left")
+        return
+    }
+    log.Printf("Compressed %d page bodies from %d to %d bytes", report.Bodies, report.Size, report.StoredSize)
+}
+
+func runAudit(args []string) {
+    fs := newFlagSet("audit", " <log>", "Check that the requests recorded in a politeness audit log (written with 'crawl -audit')\n"+
+        "stayed within the rate limits declared alongside them. Exits non-zero on any violation.")
+    fs.Parse(args)
+    if fs.NArg() != 1 {
+        fs.Usage()
+        os.Exit(2)
+    }
+    auditPath := fs.Arg(0)
+
+    reports, err := audit.Verify(auditPath)
+    if err != nil {
+        log.Fatalf("Failed to verify audit log: %v", err)
+    }
+
+    violations := 0
+    for _, report := range reports {
+        log.Printf("%s: %d requests (%d redirects) from %s to %s, peak %d/s, %d violations",
+            report.Host, report.Requests, report.Redirects, report.First.Format(time.RFC3339), report.Last.Format(time.RFC3339),
+            report.PeakPerSec, len(report.Violations))
+        for _, v := range report.Violations {
+            log.Printf("  line %d at %s exceeded %s: %s", v.Line, v.At.Format(time.RFC3339Nano), v.Rule, v.URL)
+        }
+        violations += len(report.Violations)
+    }
+
+    if violations > 0 {
+        log.Fatalf("Audit failed: %d requests exceeded their declared limits", violations)
+    }
+    log.Printf("Audit passed: %d hosts stayed within declared limits", len(reports))
+}
+
+func runSecurity(args []string) {
+    fs := newFlagSet("security", "", "Summarize the security headers (HSTS, CSP, X-Frame-Options, and others) a crawl session's\n"+
+        "HTML pages were served with and the TLS version, cipher, and certificate expiry of each host,\n"+
+        "with findings for what falls short. Requires the Postgres store.")
+    crawlID := fs.Int64("crawl-id", 0, "Crawl session to report on (required)")
+    expiryWarning := fs.Duration("expiry-warning", 30*24*time.Hour, "Flag certificates expiring within this long")
+    asJSON := fs.Bool("json", false, "Print each host as a JSON object")
+    store := addStoreFlags(fs)
+    parseFlags(fs, args)
+
+    if *crawlID == 0 {
+        log.Fatalf("-crawl-id is required")
+    }
+
+    cfg := loadConfig()
+    db := store.open(cfg)
+    defer db.Close()
+
+    hosts, err := requirePostgres(db, "security").SecurityReport(*crawlID, time.Now(), *expiryWarning)
+    if err != nil {
+        log.Fatalf("Security report failed: %v", err)
+    }
+    if len(hosts) == 0 {
+        log.Fatalf("Crawl session %d has no pages", *crawlID)
+    }
+
+    encoder := json.NewEncoder(os.Stdout)
+    for _, host := range hosts {
+        if *asJSON {
+            encoder.Encode(host)
+            continue
+        }
+        fmt.Printf("%s: %d pages, %d HTML, %d over HTTPS\n", host.Host, host.Pages, host.Documents, host.HTTPS)
+        if host.CertExpiry != nil {
+            fmt.Printf("  TLS: %s; certificate from %s expires %s\n", formatCounts(host.TLSVersions), host.CertIssuer, host.CertExpiry.Format("2006-01-02"))
+        }
+        for _, name := range database.SecurityHeaders {
+            if header, ok := host.Headers[name]; ok {
+                fmt.Printf("  %s (%d/%d): %s\n", name, header.Documents, host.Documents, header.Value)
+            }
+        }
+        for _, finding := range host.Findings {
+            fmt.Printf("  ! %s\n", finding)
+        }
+    }
+}
+
+// formatCounts lists counts by key, most common first
+func formatCounts(counts map[string]int) string {
+    keys := make([]string, 0, len(counts))
+    for key := range counts {
+        keys = append(keys, key)
+    }
+    sort.Slice(keys, func(i, j int) bool {
+        if counts[keys[i]] != counts[keys[j]] {
+            return counts[keys[i]] > counts[keys[j]]
+        }
+        return keys[i] < keys[j]
+    })
+    parts := make([]string, len(keys))
+    for i, key := range keys {
+        parts[i] = fmt.Sprintf("%s (%d)", key, counts[key])
+    }
+    return strings.Join(parts, ", ")
+}
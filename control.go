@@ -0,0 +1,51 @@
+package main
+
+import (
+    "log"
+    "strconv"
+    "strings"
+    "time"
+
+    "smart-crawler/progress"
+)
+
+// controllable is a running crawler that signals can pause and inspect
+type controllable interface {
+    progress.Source
+    Pause() bool
+    Resume() bool
+}
+
+// togglePause pauses a running crawl, or resumes a paused one
+func togglePause(label string, c controllable) {
+    if c.Pause() {
+        log.Printf("Paused the %s crawl; fetches under way will finish. Signal again to resume", label)
+        return
+    }
+    c.Resume()
+    log.Printf("Resumed the %s crawl", label)
+}
+
+// dumpState logs a snapshot of a crawl and its queue
+func dumpState(label string, c controllable) {
+    p := c.Progress()
+    state := "running"
+    switch {
+    case p.Paused:
+        state = "paused"
+    case !p.Running:
+        state = "not running"
+    }
+    queued := "unknown"
+    if p.Remaining >= 0 {
+        queued = strconv.Itoa(p.Remaining)
+    }
+    log.Printf("%s crawl %d is %s after %v: %d pages fetched, %d skipped, %d errors, %d bytes; %s URLs queued, %d in flight",
+        label, p.CrawlID, state, p.Elapsed.Round(time.Second), p.PagesFetched, p.PagesSkipped, p.Errors, p.Bytes, queued, p.InFlight)
+    if len(p.ActiveHosts) > 0 {
+        log.Printf("Fetching from %d hosts: %s", len(p.ActiveHosts), strings.Join(p.ActiveHosts, ", "))
+    }
+    if !p.Deadline.IsZero() {
+        log.Printf("-max-duration ends the crawl at %s", p.Deadline.Format(time.RFC3339))
+    }
+}
@@ -0,0 +1,36 @@
+//go:build !windows
+
+package main
+
+import (
+    "os"
+    "os/signal"
+    "syscall"
+)
+
+// controlBySignals lets signals control a crawl until the returned function
+// is called: SIGUSR1 logs its state, and SIGUSR2 or SIGTSTP (Ctrl+Z) pause
+// and resume it rather than suspending the process
+func controlBySignals(label string, c controllable) func() {
+    signals := make(chan os.Signal, 1)
+    signal.Notify(signals, syscall.SIGUSR1, syscall.SIGUSR2, syscall.SIGTSTP)
+    done := make(chan struct{})
+    go func() {
+        for {
+            select {
+            case sig := <-signals:
+                if sig == syscall.SIGUSR1 {
+                    dumpState(label, c)
+                } else {
+                    togglePause(label, c)
+                }
+            case <-done:
+                return
+            }
+        }
+    }()
+    return func() {
+        signal.Stop(signals)
+        close(done)
+    }
+}
@@ -0,0 +1,8 @@
+//go:build windows
+
+package main
+
+// controlBySignals does nothing: Windows has no SIGUSR1 or SIGUSR2
+func controlBySignals(label string, c controllable) func() {
+    return func() {}
+}
@@ -0,0 +1,1058 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "log"
+    "math"
+    "net/http"
+    "os"
+    "sort"
+    "strings"
+    "time"
+
+    "smart-crawler/audit"
+    "smart-crawler/crawler"
+    "smart-crawler/database"
+    "smart-crawler/frontier"
+    "smart-crawler/models"
+    "smart-crawler/output"
+    "smart-crawler/pipeline"
+    "smart-crawler/progress"
+    "smart-crawler/replay"
+    "smart-crawler/utils"
+)
+
+// patternList collects a repeatable regex flag
+type patternList []string
+
+func (p *patternList) String() string {
+    return strings.Join(*p, ";")
+}
+
+func (p *patternList) Set(pattern string) error {
+    *p = append(*p, pattern)
+    return nil
+}
+
+// splitList splits a comma-separated flag, dropping empty entries
+func splitList(s string) []string {
+    var items []string
+    for _, item := range strings.Split(s, ",") {
+        if item = strings.TrimSpace(item); item != "" {
+            items = append(items, item)
+        }
+    }
+    return items
+}
+
+func runCrawl(args []string) {
+    fs := newFlagSet("crawl", "", "Crawl a site starting at -url. The smart crawler (the default) prioritizes the frontier\n"+
+        "by content analysis and keeps it in the database; -continuous keeps revisiting pages, -refresh\n"+
+        "revisits the due pages of an earlier crawl once, and -warc replays an archive offline.")
+    var (
+        url = fs.String("url", "https://example.com", "Starting URL to crawl")
+        depth = fs.Int("depth", 3, "Maximum crawl depth")
+        workers = fs.Int("workers", 10, "Number of concurrent workers")
+        minWorkers = fs.Int("min-workers", 1, "Smart crawler: fewest workers an autoscaled pool shrinks to")
+        hostConcurrency = fs.Int("host-concurrency", crawler.DefaultHostConcurrency, "Smart crawler: most fetches under way against one host, so a slow host cannot hold every worker (0 for no limit)")
+        dnsPrefetch = fs.Bool("dns-prefetch", false, "Smart crawler: resolve the hosts of claimed URLs while they wait for a worker (needs the DNS cache, on unless DNS_MAX_TTL=0)")
+        maxWorkers = fs.Int("max-workers", 0, "Smart crawler: autoscale the worker pool up to this many workers, starting at -workers, by latency, errors, and queue starvation (0 keeps -workers fixed)")
+        crawlerKind = fs.String("crawler", "smart", "Crawler: 'smart', 'traditional' (breadth-first, for comparison), 'sitemap' (fetch only the URLs the site's sitemaps list, a fast audit), or 'mirror' (breadth-first, writing a browsable offline copy to -mirror-dir)")
+        mirrorDir = fs.String("mirror-dir", "mirror", "With -crawler=mirror: directory to write the offline copy of pages and their stylesheets, scripts, and images to")
+        continuous = fs.Bool("continuous", false, "Smart crawler: keep running, revisiting saved pages as they come due, instead of ending when the frontier is empty")
+        refresh = fs.Bool("refresh", false, "Revisit the pages of crawl -crawl-id that are due, then exit")
+        crawlID = fs.Int64("crawl-id", 0, "Crawl session to revisit with -refresh")
+        warcPath = fs.String("warc", "", "WARC archive to replay through the smart crawler instead of fetching")
+        frontierKind = fs.String("frontier", "postgres", "Smart crawler frontier: 'postgres', 'heap' (served from memory, written to the Postgres queue behind), or 'redis' (shared between instances)")
+        heapSize = fs.Int("heap-size", crawler.DefaultHeapFrontierSize, "Smart crawler with -frontier=heap: most URLs held in memory before the lowest priority ones spill to the database")
+        scopeName = fs.String("scope", "unrestricted", "Links to follow: 'same-host', 'same-domain', 'subdomains', or 'unrestricted'")
+        resume = fs.Bool("resume", false, "Resume the last checkpointed smart crawl of -url")
+        staleAfter = fs.Duration("stale-after", time.Hour, "Before crawling -url, mark its unfinished crawl sessions idle this long as interrupted (0 disables)")
+        minQuality = fs.Float64("min-quality", 0, "Smart crawler: don't follow links on pages with a lower content quality score (0-1)")
+        minImportance = fs.Float64("min-importance", 0, "Smart crawler: don't follow links on pages with a lower importance score (0-1)")
+        paginationDepth = fs.Int("pagination-depth", crawler.DefaultPaginationDepth, "Smart crawler: how many pages past the first to follow paginated listings (rel=next, ?page=N)")
+        maxPages = fs.Int("max-pages", 0, "Stop the crawl after fetching this many pages (0 for no limit)")
+        maxBytes = fs.Int64("max-bytes", 0, "Stop the crawl after fetching this many bytes of content (0 for no limit)")
+        maxResponseSize = fs.Int64("max-response-size", crawler.DefaultMaxResponseSize, "Read at most this many bytes of each response body, marking longer pages truncated (0 for no limit)")
+        maxDuration = fs.Duration("max-duration", 0, "Stop the crawl after running this long, e.g. 30m (0 for no limit)")
+        requestRate = fs.Float64("rate", 0, "Requests per second with -continuous and -refresh, shared by discovery and revisits (0 keeps RATE_LIMIT, or 15 without it)")
+        refreshShare = fs.Float64("refresh-share", crawler.DefaultRevisitPolicy.RefreshShare, "Fraction of each pull given to due revisits with -continuous (0-1)")
+        minRevisit = fs.Duration("min-revisit", crawler.DefaultRevisitPolicy.MinInterval, "Shortest revisit interval with -continuous and -refresh")
+        maxRevisit = fs.Duration("max-revisit", crawler.DefaultRevisitPolicy.MaxInterval, "Longest revisit interval with -continuous and -refresh")
+        diffs = fs.Bool("diffs", false, "With -continuous and -refresh: store a diff of the text of each page a revisit finds changed, in the page_changes table")
+        notifyWebhook = fs.String("notify-webhook", "", "With -diffs: URL to POST each change of a watched page to as JSON")
+        notifySlack = fs.String("notify-slack", "", "With -diffs: Slack incoming webhook URL to post each change of a watched page to")
+        notifyEmail = fs.String("notify-email", "", "With -diffs: comma-separated addresses to email each change of a watched page to, through SMTP_URL")
+        seenMemory = fs.Int("seen-memory", crawler.DefaultSeenMemory, "Seen URLs or content hashes the exact seen sets hold in memory before spilling the rest to disk")
+        bloomCapacity = fs.Uint("bloom-capacity", 0, "Expected distinct URLs/pages; keeps seen URLs and content hashes in Bloom filters of this capacity (0 keeps exact sets)")
+        bloomFP = fs.Float64("bloom-fp", 0.001, "False-positive rate of the Bloom filters")
+        bloomVerify = fs.Bool("bloom-verify", false, "Confirm Bloom filter hits against the database, so no page is wrongly skipped")
+        persistentDedup = fs.Bool("persistent-dedup", false, "Smart crawler: keep content hashes in the database, so duplicates are recognized across restarts, recrawls, and instances")
+        dedupCache = fs.Int("dedup-cache", crawler.DefaultDedupCacheSize, "Content hashes the persistent duplicate detector caches in memory")
+        nearDuplicate = fs.Float64("near-duplicate", 0, "Smart crawler: skip pages whose title and text are at least this similar to a page already saved (0-1, e.g. 0.9; 0 disables)")
+        holdout = fs.Float64("holdout", 0, "Smart crawler: fraction of frontier pulls taken in queue order instead of by priority, to measure what the prioritization yields (0-1, 0 disables)")
+        resolveRedirects = fs.Bool("resolve-redirects", true, "Replace links through URL shorteners (t.co, bit.ly, ...) and tracking redirects with their final targets")
+        checkpointInterval = fs.Duration("checkpoint-interval", 30*time.Second, "How often the smart crawler checkpoints its state (0 disables)")
+        writeBatch = fs.Int("write-batch", crawler.DefaultWriteBatch, "Smart crawler: pages saved per database transaction (1 saves each page as it is fetched)")
+        writeFlushInterval = fs.Duration("write-flush-interval", crawler.DefaultWriteFlushInterval, "Smart crawler: longest a fetched page waits for its batch to fill before it is saved")
+        maxAttempts = fs.Int("max-attempts", crawler.DefaultMaxAttempts, "Smart crawler: failed fetches allowed per URL before it is dead-lettered")
+        retryBackoff = fs.Duration("retry-backoff", crawler.DefaultRetryBackoff, "Smart crawler: wait before retrying a failed URL, doubling with each further failure")
+        languages = fs.String("languages", "", "Smart crawler: comma-separated target languages (e.g. 'en,de'); links hinting at other languages are demoted")
+        strictLanguages = fs.Bool("strict-languages", false, "Drop links hinting at languages outside -languages instead of demoting them")
+        fetchStrategy = fs.String("fetch", "get", "Smart crawler fetch strategy for new URLs: 'get', or 'head-first' to check content types with HEAD before downloading (revisits are always conditional)")
+        stallTimeout = fs.Duration("stall-timeout", crawler.DefaultStallTimeout, "Smart crawler: report a stall after this long without a successful fetch while URLs are pending (0 disables)")
+        drainTimeout = fs.Duration("drain-timeout", crawler.DefaultDrainTimeout, "Smart crawler: on Ctrl+C or SIGTERM, how long fetches under way may take to finish before they are cut off; URLs not fetched go back to the queue")
+        stallWebhook = fs.String("stall-webhook", "", "URL to POST a JSON stall report to, in addition to logging it")
+        pipelinePath = fs.String("pipeline", "", "JSON file of post-processing pipelines to run saved pages through")
+        robotsTTL = fs.Duration("robots-ttl", crawler.DefaultRobotsTTL, "Smart crawler: how long a site's robots.txt is trusted before it is fetched again (0 ignores robots.txt)")
+        priorityRulesPath = fs.String("priority-rules", "", "Smart crawler: YAML file of link priority rules for this crawl, layered over PRIORITY_RULES")
+        linkSelector = fs.String("links", "", "Only follow links selected by, or inside elements selected by, this CSS selector or XPath (XPath starts with / or (), e.g. 'article' or '//div[@id=\"results\"]'; the smart crawler still follows paginated listings")
+        trackingParams = fs.String("tracking-params", strings.Join(utils.DefaultTrackingParams, ","), "Comma-separated query parameters removed from URLs before they are queued; a trailing * matches a prefix (empty keeps every parameter)")
+        sessionParams = fs.String("session-params", strings.Join(utils.DefaultSessionParams, ","), "Comma-separated query and path parameters, like session IDs, that URL fingerprints ignore, so URLs differing only in them are crawled once; a trailing * matches a prefix")
+        keepTrailingSlash = fs.Bool("keep-trailing-slash", false, "Keep trailing slashes of URL paths instead of removing them, for sites serving different pages at /dir and /dir/")
+        documents = fs.String("documents", "", "Smart crawler: comma-separated document formats to follow links to and save the text of, 'pdf' and 'docx' (default: none)")
+        images = fs.Bool("images", false, "Record the <img> elements of crawled pages, with the dimensions, format, and size read from the start of each image file, into the images table")
+        imageThumbnails = fs.Bool("image-thumbnails", false, "With -images: fetch whole image files and store JPEG thumbnails of them in BLOB_STORE (needs -store=postgres)")
+        thumbnailSize = fs.Int("thumbnail-size", crawler.DefaultThumbnailSize, "With -image-thumbnails: longest side of thumbnails, in pixels")
+        spam = fs.Bool("spam", false, "Score HTML pages for spam (keyword stuffing, hidden text, ad and link density, doorway pages); pages scoring above -spam-threshold are saved flagged as spam, but their links are not followed")
+        spamThreshold = fs.Float64("spam-threshold", crawler.DefaultSpamThreshold, "With -spam: spam score (0-1) above which a page is flagged")
+        scriptPath = fs.String("script", "", "Smart crawler: Starlark file with should_follow, score_link, and extract callbacks to customize the crawl")
+        linkModelPath = fs.String("link-model", "", "Smart crawler: JSON file to load the learned link priority model from and save it back to, so learning carries across crawls")
+        cookiesPath = fs.String("cookies", "", "Netscape cookies file to start the crawl with and save its cookies to, so logged-in sessions carry over between runs")
+        progressMode = fs.String("progress", "auto", "Progress display: 'live' redrawn in the terminal, 'log' lines every 30s, 'off', or 'auto' (live on a terminal)")
+        harvestThreshold = fs.Float64("harvest-threshold", 0, "Track the harvest rate: the fraction of pages whose relevance (to -topic, or content quality; 0-1) is at least this (0 disables)")
+        topicKeywords = fs.String("topic", "", "Focus the crawl on a topic: comma-separated keywords (e.g. 'solar power,photovoltaics'); the smart crawler follows links from relevant pages first")
+        topicDocs = fs.String("topic-docs", "", "Comma-separated text or HTML files that describe the topic, instead of or as well as -topic")
+        statsPath = fs.String("stats-json", "", "Write the crawl's stats, with load time percentiles, throughput over time, and status codes, to this JSON file when it ends")
+    )
+    var includePatterns, excludePatterns patternList
+    fs.Var(&includePatterns, "include", "Only enqueue URLs matching this regex (repeatable; adds to URL_INCLUDE)")
+    fs.Var(&excludePatterns, "exclude", "Never enqueue URLs matching this regex (repeatable; adds to URL_EXCLUDE)")
+    var allowDomains, blockDomains patternList
+    fs.Var(&allowDomains, "allow-domains", "Only enqueue URLs on the domains, and their subdomains, of this domain list file or URL (repeatable; adds to DOMAIN_ALLOWLIST)")
+    fs.Var(&blockDomains, "block-domains", "Never enqueue URLs on the domains, and their subdomains, of this domain list file or URL, e.g. a hosts file of ad or tracker domains (repeatable; adds to DOMAIN_BLOCKLIST)")
+    var watchPatterns patternList
+    fs.Var(&watchPatterns, "watch", "With -diffs: only notify of changes to URLs matching this regex (repeatable; default every page)")
+    site := addSiteFlags(fs)
+    store := addStoreFlags(fs)
+    parseFlags(fs, args)
+
+    // The smart crawler runs one way at a time
+    mode := *crawlerKind
+    variants := 0
+    for flagMode, set := range map[string]bool{"replay": *warcPath != "", "refresh": *refresh, "continuous": *continuous} {
+        if set {
+            mode = flagMode
+            variants++
+        }
+    }
+    switch {
+    case *crawlerKind != "smart" && *crawlerKind != "traditional" && *crawlerKind != "sitemap" && *crawlerKind != "mirror":
+        log.Fatalf("Invalid -crawler: %s. Use 'smart', 'traditional', 'sitemap', or 'mirror'", *crawlerKind)
+    case variants > 1:
+        log.Fatalf("-warc, -refresh, and -continuous cannot be combined")
+    case variants > 0 && *crawlerKind != "smart":
+        log.Fatalf("-warc, -refresh, and -continuous use the smart crawler")
+    case *resume && mode != "smart" && mode != "continuous":
+        log.Fatalf("-resume is only supported by the smart crawler, batch or -continuous")
+    case *linkSelector != "" && mode == "sitemap":
+        log.Fatalf("-links has no effect on a sitemap audit, which follows no links")
+    case *seenMemory <= 0:
+        log.Fatalf("-seen-memory must be positive")
+    }
+    // Sitemap audits and mirrors are run by the traditional crawler
+    traditional := mode == "traditional" || mode == "sitemap" || mode == "mirror"
+
+    cfg := loadConfig()
+    tagRules, err := crawler.ParseTagRules(cfg.TagRules)
+    if err != nil {
+        log.Fatalf("Invalid TAG_RULES: %v", err)
+    }
+    unknownContent, err := crawler.ParseUnknownContentAction(cfg.UnknownContent)
+    if err != nil {
+        log.Fatalf("Invalid UNKNOWN_CONTENT_ACTION: %v", err)
+    }
+    scope, err := crawler.ParseScope(*scopeName)
+    if err != nil {
+        log.Fatalf("Invalid -scope: %v", err)
+    }
+    urlFilter, err := crawler.NewURLFilter(
+        append(crawler.SplitPatterns(cfg.URLInclude), includePatterns...),
+        append(crawler.SplitPatterns(cfg.URLExclude), excludePatterns...),
+    )
+    if err != nil {
+        log.Fatalf("Invalid URL filter: %v", err)
+    }
+    allowSources := append(crawler.SplitPatterns(cfg.DomainAllowlist), allowDomains...)
+    allowlist, err := crawler.LoadDomainList(context.Background(), nil, allowSources...)
+    if err != nil {
+        log.Fatalf("Invalid allowlist: %v", err)
+    }
+    // An empty allowlist would allow every domain instead of none
+    if len(allowSources) > 0 && allowlist.Len() == 0 {
+        log.Fatalf("Invalid allowlist: no domains in %s", strings.Join(allowSources, ", "))
+    }
+    blocklist, err := crawler.LoadDomainList(context.Background(), nil, append(crawler.SplitPatterns(cfg.DomainBlocklist), blockDomains...)...)
+    if err != nil {
+        log.Fatalf("Invalid blocklist: %v", err)
+    }
+    if allowlist.Len() > 0 || blocklist.Len() > 0 {
+        log.Printf("Allowing %d domains and blocking %d", allowlist.Len(), blocklist.Len())
+    }
+    urlFilter.SetDomainLists(allowlist, blocklist)
+    opts := &crawlOptions{
+        fetch:              fetchOptions(cfg),
+        tagRules:           tagRules,
+        scope:              scope,
+        urlFilter:          urlFilter,
+        budget:             crawler.Budget{MaxPages: *maxPages, MaxBytes: *maxBytes, MaxDuration: *maxDuration},
+        seen:               crawler.SeenOptions{Capacity: *bloomCapacity, Memory: *seenMemory, FalsePositiveRate: *bloomFP, Verify: *bloomVerify},
+        resolveRedirects:   *resolveRedirects,
+        maxResponseSize:    *maxResponseSize,
+        unknownContent:     unknownContent,
+        checkpointInterval: *checkpointInterval,
+        minQuality:         *minQuality,
+        minImportance:      *minImportance,
+        paginationDepth:    *paginationDepth,
+        holdout:            *holdout,
+        persistentDedup:    *persistentDedup,
+        dedupCache:         *dedupCache,
+        nearDuplicate:      *nearDuplicate,
+        writeBatch:         *writeBatch,
+        writeFlushInterval: *writeFlushInterval,
+        maxAttempts:        *maxAttempts,
+        retryBackoff:       *retryBackoff,
+        resume:             *resume,
+        stallTimeout:       *stallTimeout,
+        drainTimeout:       *drainTimeout,
+        autoscale:          crawler.Autoscale{Min: *minWorkers, Max: *maxWorkers},
+        hostConcurrency:    *hostConcurrency,
+        dnsPrefetch:        *dnsPrefetch,
+        strictLanguages:    *strictLanguages,
+        robotsTTL:          *robotsTTL,
+        statsPath:          *statsPath,
+        harvestThreshold:   *harvestThreshold,
+        mirrorDir:          *mirrorDir,
+    }
+    for _, language := range strings.Split(*languages, ",") {
+        if language = strings.TrimSpace(language); language != "" {
+            opts.languages = append(opts.languages, language)
+        }
+    }
+    switch *fetchStrategy {
+    case "get":
+        opts.fetchStrategy = crawler.DefaultStrategy
+    case "head-first":
+        opts.fetchStrategy = crawler.HeadFirstStrategy
+    default:
+        log.Fatalf("Invalid -fetch: %s. Use 'get' or 'head-first'", *fetchStrategy)
+    }
+    if *holdout < 0 || *holdout > 1 {
+        log.Fatalf("-holdout must be between 0 and 1")
+    }
+    if *harvestThreshold < 0 || *harvestThreshold > 1 {
+        log.Fatalf("-harvest-threshold must be between 0 and 1")
+    }
+    if *topicKeywords != "" || *topicDocs != "" {
+        if opts.topic, err = crawler.LoadTopic(splitList(*topicKeywords), splitList(*topicDocs)); err != nil {
+            log.Fatalf("Invalid -topic: %v", err)
+        }
+    }
+    if *maxWorkers > 0 && (*minWorkers < 1 || *minWorkers > *maxWorkers) {
+        log.Fatalf("-min-workers must be between 1 and -max-workers")
+    }
+    if opts.progress, err = progress.ParseMode(*progressMode); err != nil {
+        log.Fatalf("Invalid -progress: %v", err)
+    }
+    if mode == "continuous" || mode == "refresh" {
+        if *refreshShare < 0 || *refreshShare > 1 {
+            log.Fatalf("-refresh-share must be between 0 and 1")
+        }
+        if *requestRate < 0 {
+            log.Fatalf("-rate must not be negative")
+        }
+        opts.revisit = &crawler.RevisitPolicy{
+            MinInterval:  *minRevisit,
+            MaxInterval:  *maxRevisit,
+            RefreshShare: *refreshShare,
+        }
+        opts.rate = *requestRate
+    }
+    notifies := *notifyWebhook != "" || *notifySlack != "" || *notifyEmail != ""
+    switch {
+    case *diffs && mode != "continuous" && mode != "refresh":
+        log.Fatalf("-diffs needs -continuous or -refresh, whose revisits find changes")
+    case notifies && !*diffs:
+        log.Fatalf("-notify-webhook, -notify-slack, and -notify-email need -diffs")
+    case len(watchPatterns) > 0 && !notifies:
+        log.Fatalf("-watch needs -notify-webhook, -notify-slack, or -notify-email")
+    }
+    if *diffs {
+        opts.changes = &crawler.ChangeMonitor{}
+        if len(watchPatterns) > 0 {
+            if opts.changes.Watch, err = crawler.NewURLFilter(watchPatterns, nil); err != nil {
+                log.Fatalf("Invalid -watch: %v", err)
+            }
+        }
+        if *notifyWebhook != "" {
+            opts.changes.Notifiers = append(opts.changes.Notifiers, output.NewChangeWebhook(*notifyWebhook))
+        }
+        if *notifySlack != "" {
+            opts.changes.Notifiers = append(opts.changes.Notifiers, output.NewSlackNotifier(*notifySlack))
+        }
+        if *notifyEmail != "" {
+            if cfg.SMTPURL == "" {
+                log.Fatalf("-notify-email needs SMTP_URL")
+            }
+            email, err := output.NewEmailNotifier(cfg.SMTPURL, cfg.NotifyFrom, splitList(*notifyEmail))
+            if err != nil {
+                log.Fatalf("Invalid -notify-email: %v", err)
+            }
+            opts.changes.Notifiers = append(opts.changes.Notifiers, email)
+        }
+    }
+
+    if *stallWebhook != "" {
+        opts.stallAlerters = append(opts.stallAlerters, output.NewStallWebhook(*stallWebhook))
+    }
+
+    if cfg.KafkaBrokers != "" {
+        kafkaSink := output.NewKafkaSink(strings.Split(cfg.KafkaBrokers, ","), cfg.KafkaTopic, cfg.KafkaAttempts)
+        defer kafkaSink.Close()
+        opts.sinks = append(opts.sinks, kafkaSink)
+    }
+
+    if opts.proxies = loadProxies(cfg); opts.proxies != nil {
+        defer logProxies(opts.proxies)
+    }
+
+    if *pipelinePath != "" {
+        pipelines, err := pipeline.Load(*pipelinePath)
+        if err != nil {
+            log.Fatalf("Invalid -pipeline: %v", err)
+        }
+        for _, p := range pipelines {
+            defer p.Close()
+            opts.sinks = append(opts.sinks, p)
+        }
+        defer logPipelines(pipelines)
+    }
+
+    opts.auditLog, opts.auth, opts.headers = site.load()
+    if opts.auditLog != nil {
+        defer opts.auditLog.Close()
+    }
+
+    if *priorityRulesPath != "" && traditional {
+        log.Fatalf("-priority-rules is only used by the smart crawler")
+    }
+    // Loaded here as well as in the fetch options, which replays do not take
+    if cfg.PriorityRules != "" || *priorityRulesPath != "" {
+        if opts.priorityRules, err = crawler.LoadPriorityRules(cfg.PriorityRules, *priorityRulesPath); err != nil {
+            log.Fatalf("Invalid -priority-rules: %v", err)
+        }
+    }
+    // Replays do not take the fetch options, which load them otherwise
+    if cfg.ExtractionRules != "" && *warcPath != "" {
+        if opts.extraction, err = crawler.LoadExtractionRules(cfg.ExtractionRules); err != nil {
+            log.Fatalf("Invalid EXTRACTION_RULES: %v", err)
+        }
+    }
+    if *linkSelector != "" {
+        if opts.linkSelector, err = crawler.ParseSelector(*linkSelector); err != nil {
+            log.Fatalf("Invalid -links: %v", err)
+        }
+    }
+    opts.normalizer = &utils.URLNormalizer{
+        TrackingParams:    splitList(*trackingParams),
+        KeepTrailingSlash: *keepTrailingSlash,
+        SessionParams:     splitList(*sessionParams),
+    }
+    if *documents != "" {
+        if traditional {
+            log.Fatalf("-documents is only supported by the smart crawler")
+        }
+        if opts.documents, err = crawler.ParseDocumentFormats(*documents); err != nil {
+            log.Fatalf("Invalid -documents: %v", err)
+        }
+    }
+    if *spam {
+        if *spamThreshold <= 0 || *spamThreshold >= 1 {
+            log.Fatalf("-spam-threshold must be between 0 and 1")
+        }
+        opts.spam = &crawler.SpamFilter{Threshold: *spamThreshold}
+    }
+    if *imageThumbnails && !*images {
+        log.Fatalf("-image-thumbnails needs -images")
+    }
+    if *thumbnailSize <= 0 {
+        log.Fatalf("-thumbnail-size must be positive")
+    }
+    if *scriptPath != "" {
+        if traditional {
+            log.Fatalf("-script is only run by the smart crawler")
+        }
+        if opts.script, err = crawler.LoadScript(*scriptPath); err != nil {
+            log.Fatalf("Invalid -script: %v", err)
+        }
+    }
+    if *linkModelPath != "" {
+        if traditional {
+            log.Fatalf("-link-model is only used by the smart crawler")
+        }
+        model, err := crawler.LoadLinkModel(*linkModelPath)
+        if err == nil {
+            stats := model.Stats()
+            log.Printf("Loaded the link model from %s (%d features, %d updates)", *linkModelPath, stats.Features, stats.Updates)
+        } else if os.IsNotExist(err) {
+            model = crawler.NewLinkModel()
+        } else {
+            log.Fatalf("Failed to load -link-model: %v", err)
+        }
+        opts.linkModel = model
+        defer saveLinkModel(model, *linkModelPath)
+    }
+
+    if *cookiesPath != "" {
+        opts.cookies = crawler.NewCookieJar()
+        if err := opts.cookies.Load(*cookiesPath); err == nil {
+            log.Printf("Loaded %d cookies from %s", opts.cookies.Len(), *cookiesPath)
+        } else if !os.IsNotExist(err) {
+            log.Fatalf("Failed to load -cookies: %v", err)
+        }
+        defer saveCookies(opts.cookies, *cookiesPath)
+    }
+
+    switch *frontierKind {
+    case "postgres":
+    case "heap":
+        if *heapSize <= 0 {
+            log.Fatalf("-heap-size must be positive")
+        }
+        if *holdout > 0 {
+            log.Fatalf("-holdout needs -frontier=postgres")
+        }
+        opts.heapSize = *heapSize
+    case "redis":
+        redisFrontier, err := frontier.NewRedis(cfg.RedisURL, cfg.RedisPrefix)
+        if err != nil {
+            log.Fatalf("Failed to connect to Redis frontier: %v", err)
+        }
+        defer redisFrontier.Close()
+        opts.frontier = redisFrontier
+    default:
+        log.Fatalf("Invalid frontier: %s. Use 'postgres', 'heap', or 'redis'", *frontierKind)
+    }
+
+    db := store.open(cfg)
+    defer db.Close()
+    defer startTracing(cfg)()
+
+    // Repair what crashed runs of this seed left behind
+    if mode != "refresh" {
+        repaired, err := db.Repair(opts.normalizer.Normalize(*url), *staleAfter)
+        if err != nil {
+            log.Fatalf("Startup checks failed: %v", err)
+        }
+        logRepairs(repaired)
+    }
+
+    if *images {
+        opts.images = &crawler.ImageOptions{ThumbnailSize: *thumbnailSize}
+        if *imageThumbnails {
+            // Thumbnails go where page bodies do
+            blobs := requirePostgres(db, "-image-thumbnails").BlobStore()
+            if blobs == nil {
+                log.Fatalf("-image-thumbnails needs BLOB_STORE to store thumbnails in")
+            }
+            opts.images.Thumbnails = blobs
+        }
+    }
+
+    ctx, cancel := signalContext()
+    defer cancel()
+
+    if opts.proxies != nil && cfg.ProxyCheckURL != "" {
+        go opts.proxies.HealthCheck(ctx, cfg.ProxyCheckURL, time.Minute)
+    }
+
+    switch mode {
+    case "traditional", "sitemap", "mirror":
+        runTraditionalCrawler(ctx, db, opts, mode, *url, *depth, *workers)
+    case "smart", "continuous":
+        runSmartCrawler(ctx, db, opts, *url, *depth, *workers)
+    case "refresh":
+        runRefresh(ctx, db, opts, *crawlID, *workers)
+    case "replay":
+        runReplay(ctx, db, opts, *warcPath, *url, *depth, *workers)
+    }
+}
+
+// crawlOptions carries the optional crawler settings shared by every way
+// of crawling
+type crawlOptions struct {
+    fetch          []crawler.Option // USER_AGENT, REQUEST_TIMEOUT, and RATE_LIMIT
+    tagRules       []crawler.TagRule
+    scope          crawler.Scope
+    urlFilter      *crawler.URLFilter
+    budget         crawler.Budget
+    seen           crawler.SeenOptions
+    auditLog       *audit.Log
+    unknownContent crawler.UnknownContentAction
+    frontier       crawler.Frontier // nil keeps the Postgres crawl_queue
+    heapSize       int              // Serves crawl_queue from memory when set
+    sinks          []crawler.PageSink
+    proxies        *crawler.ProxyPool
+    cookies        *crawler.CookieJar // nil gives each crawler an empty jar
+    linkModel      *crawler.LinkModel // nil gives the smart crawler an untrained model
+    priorityRules  *crawler.PriorityRules // PRIORITY_RULES and -priority-rules; nil for the defaults
+    script         *crawler.Script        // nil runs no script
+    extraction     *crawler.ExtractionRules // EXTRACTION_RULES, for replays; other crawls get them with the fetch options
+    linkSelector   *crawler.Selector        // -links; nil follows every link
+    images         *crawler.ImageOptions    // -images; nil records none
+    normalizer     *utils.URLNormalizer     // -tracking-params, -keep-trailing-slash, and -session-params
+    spam           *crawler.SpamFilter      // -spam; nil flags none
+    auth           *crawler.Auth
+    headers        *crawler.HeaderOverrides
+
+    checkpointInterval time.Duration
+    resume             bool
+    resolveRedirects   bool
+    maxResponseSize    int64
+    minQuality         float64
+    minImportance      float64
+    paginationDepth    int
+    holdout            float64
+    persistentDedup    bool
+    dedupCache         int
+    nearDuplicate      float64
+    writeBatch         int
+    writeFlushInterval time.Duration
+    maxAttempts        int
+    retryBackoff       time.Duration
+
+    fetchStrategy crawler.StrategySelector
+    robotsTTL     time.Duration
+    stallTimeout  time.Duration
+    stallAlerters []crawler.StallAlerter
+    drainTimeout  time.Duration
+    autoscale     crawler.Autoscale
+
+    hostConcurrency int
+    dnsPrefetch     bool
+
+    languages       []string
+    strictLanguages bool
+
+    revisit *crawler.RevisitPolicy // Set with -continuous and -refresh
+    changes *crawler.ChangeMonitor // -diffs; nil stores no diffs
+    rate    float64                // -rate; 0 keeps the fetch options' rate limit
+
+    progress  progress.Mode
+    statsPath string // Where to write the final stats as JSON, if set
+
+    harvestThreshold float64        // 0 does not track the harvest rate
+    topic            *crawler.Topic // nil crawls without one
+
+    mirrorDir string // Where -crawler=mirror writes its offline copy
+
+    documents crawler.DocumentFormats // Documents the smart crawler saves the text of
+}
+
+// liveOptions are the constructor options of a crawler fetching live: how
+// it reaches the network, then crawlerOptions
+func (o *crawlOptions) liveOptions(workers int) []crawler.Option {
+    options := append([]crawler.Option(nil), o.fetch...)
+    if o.rate > 0 {
+        options = append(options, crawler.WithRateLimit(o.rate, int(math.Ceil(2*o.rate))))
+    }
+    if o.proxies != nil {
+        options = append(options, crawler.WithProxies(o.proxies))
+    }
+    if o.cookies != nil {
+        options = append(options, crawler.WithCookieJar(o.cookies))
+    }
+    if o.auth != nil {
+        options = append(options, crawler.WithAuth(o.auth))
+    }
+    if o.headers != nil {
+        options = append(options, crawler.WithHeaders(o.headers))
+    }
+    if o.auditLog != nil {
+        options = append(options, crawler.WithAuditLog(o.auditLog))
+    }
+    return append(options, o.crawlerOptions(workers)...)
+}
+
+// crawlerOptions are the constructor options of every crawl, whether it
+// fetches live or replays an archive
+func (o *crawlOptions) crawlerOptions(workers int) []crawler.Option {
+    options := []crawler.Option{
+        crawler.WithWorkers(workers),
+        crawler.WithTagRules(o.tagRules),
+        crawler.WithScope(o.scope),
+        crawler.WithBudget(o.budget),
+        crawler.WithSeenFilter(o.seen),
+        crawler.WithResolveRedirects(o.resolveRedirects),
+        crawler.WithMaxResponseSize(o.maxResponseSize),
+    }
+    if o.urlFilter != nil {
+        options = append(options, crawler.WithURLFilter(o.urlFilter))
+    }
+    for _, sink := range o.sinks {
+        options = append(options, crawler.WithPageSink(sink))
+    }
+    if o.harvestThreshold > 0 {
+        options = append(options, crawler.WithHarvestThreshold(o.harvestThreshold))
+    }
+    if o.topic != nil {
+        options = append(options, crawler.WithTopic(o.topic))
+    }
+    if o.linkModel != nil {
+        options = append(options, crawler.WithLinkModel(o.linkModel))
+    }
+    if o.priorityRules != nil {
+        options = append(options, crawler.WithPriorityRules(o.priorityRules))
+    }
+    if o.script != nil {
+        options = append(options, crawler.WithScript(o.script))
+    }
+    if o.extraction != nil {
+        options = append(options, crawler.WithExtractionRules(o.extraction))
+    }
+    if o.linkSelector != nil {
+        options = append(options, crawler.WithLinkSelector(o.linkSelector))
+    }
+    if o.images != nil {
+        options = append(options, crawler.WithImages(*o.images))
+    }
+    if o.normalizer != nil {
+        options = append(options, crawler.WithURLNormalizer(o.normalizer))
+    }
+    if o.spam != nil {
+        options = append(options, crawler.WithSpamFilter(*o.spam))
+    }
+    return options
+}
+
+// watch shows the progress of a crawl and lets signals control it, until
+// the returned function is called once the crawl has returned
+func (o *crawlOptions) watch(label string, c controllable) func() {
+    stopProgress := progress.Show(o.progress, label, c)
+    stopControl := controlBySignals(label, c)
+    return func() {
+        stopControl()
+        stopProgress()
+    }
+}
+
+// watchStalls logs the smart crawler's stalls and passes them to the
+// configured alerters
+func (o *crawlOptions) watchStalls(c *crawler.Smart) {
+    c.SetStallTimeout(o.stallTimeout)
+    c.AddStallAlerter(crawler.StallAlertFunc(func(ctx context.Context, report *models.StallReport) error {
+        log.Printf("Crawl %d (%s) stalled: %s", report.CrawlID, report.CrawlUUID, report.Diagnosis)
+        return nil
+    }))
+    for _, alerter := range o.stallAlerters {
+        c.AddStallAlerter(alerter)
+    }
+}
+
+// runTraditionalCrawler runs the traditional crawler breadth-first, with
+// mode "sitemap" as an audit of the site's sitemaps, or with mode "mirror"
+// writing an offline copy of the site
+func runTraditionalCrawler(ctx context.Context, db database.Store, opts *crawlOptions, mode, startURL string, maxDepth, workers int) {
+    name := "Traditional crawler"
+    switch mode {
+    case "sitemap":
+        name = "Sitemap audit"
+        log.Printf("Starting sitemap audit of %s with %d workers", startURL, workers)
+    case "mirror":
+        name = "Mirror"
+        log.Printf("Mirroring %s with depth %d and %d workers to %s", startURL, maxDepth, workers, opts.mirrorDir)
+    default:
+        log.Printf("Starting traditional crawler on %s with depth %d and %d workers", startURL, maxDepth, workers)
+    }
+
+    traditionalCrawler, err := crawler.NewTraditional(db, opts.liveOptions(workers)...)
+    if err != nil {
+        log.Fatalf("Invalid crawler configuration: %v", err)
+    }
+    traditionalCrawler.SetSitemapOnly(mode == "sitemap")
+    if mode == "mirror" {
+        traditionalCrawler.SetMirror(opts.mirrorDir)
+    }
+    start := time.Now()
+
+    stopWatching := opts.watch(mode, traditionalCrawler)
+    stats, err := traditionalCrawler.Crawl(ctx, startURL, maxDepth)
+    stopWatching()
+    if err != nil {
+        log.Fatalf("%s failed: %v", name, err)
+    }
+
+    duration := time.Since(start)
+    log.Printf("%s completed in %v", name, duration)
+    log.Printf("Stats: %+v", stats)
+    logProtocols(stats)
+    logTiming(stats)
+    logLoad(stats)
+    logHosts(stats)
+    logHarvest(stats)
+    logMirror(stats)
+    opts.writeStats(stats)
+}
+
+func runSmartCrawler(ctx context.Context, db database.Store, opts *crawlOptions, startURL string, maxDepth, workers int) {
+    log.Printf("Starting smart crawler on %s with depth %d and %d workers", startURL, maxDepth, workers)
+
+    smartCrawler, err := crawler.NewSmart(db, opts.liveOptions(workers)...)
+    if err != nil {
+        log.Fatalf("Invalid crawler configuration: %v", err)
+    }
+    opts.watchStalls(smartCrawler)
+    smartCrawler.ContentHandlers().SetUnknownAction(opts.unknownContent)
+    if opts.frontier != nil {
+        smartCrawler.SetFrontier(opts.frontier)
+    }
+    smartCrawler.SetHeapFrontier(opts.heapSize)
+    smartCrawler.SetExpansionThreshold(opts.minQuality, opts.minImportance)
+    smartCrawler.SetPaginationDepth(opts.paginationDepth)
+    smartCrawler.SetCheckpointInterval(opts.checkpointInterval)
+    smartCrawler.SetResume(opts.resume)
+    smartCrawler.SetHoldout(opts.holdout)
+    smartCrawler.SetFetchStrategy(opts.fetchStrategy)
+    smartCrawler.SetRobotsTTL(opts.robotsTTL)
+    smartCrawler.SetLanguages(opts.languages, opts.strictLanguages)
+    if opts.persistentDedup {
+        smartCrawler.SetPersistentDuplicates(opts.dedupCache)
+    }
+    smartCrawler.SetNearDuplicateThreshold(opts.nearDuplicate)
+    smartCrawler.SetWriteBatch(opts.writeBatch, opts.writeFlushInterval)
+    smartCrawler.SetRetries(opts.maxAttempts, opts.retryBackoff)
+    smartCrawler.SetDrainTimeout(opts.drainTimeout)
+    smartCrawler.SetAutoscale(opts.autoscale)
+    smartCrawler.SetHostConcurrency(opts.hostConcurrency)
+    smartCrawler.SetDNSPrefetch(opts.dnsPrefetch)
+    smartCrawler.SetDocuments(opts.documents)
+    smartCrawler.SetChangeMonitor(opts.changes)
+    if opts.revisit != nil {
+        smartCrawler.SetContinuous(*opts.revisit)
+        log.Printf("Crawling continuously, revisiting pages every %v to %v", opts.revisit.MinInterval, opts.revisit.MaxInterval)
+    }
+    if opts.resume {
+        log.Printf("Resuming from the last checkpoint of %s", startURL)
+    }
+    label := "smart"
+    if opts.revisit != nil {
+        label = "continuous"
+    }
+    start := time.Now()
+
+    stopWatching := opts.watch(label, smartCrawler)
+    stats, err := smartCrawler.Crawl(ctx, startURL, maxDepth)
+    stopWatching()
+    if err != nil {
+        log.Fatalf("Smart crawler failed: %v", err)
+    }
+
+    duration := time.Since(start)
+    log.Printf("Smart crawler completed in %v", duration)
+    log.Printf("Stats: %+v", stats)
+    for rule, filtered := range stats.FilteredURLs {
+        log.Printf("Filtered by %s: %d URLs", rule, filtered)
+    }
+    if stats.URLsReleased > 0 {
+        log.Printf("Returned %d claimed but unfetched URLs to the queue; continue the crawl with '-resume'", stats.URLsReleased)
+    }
+    if stats.URLsFailed > 0 {
+        log.Printf("%d URLs failed every attempt; list them with 'smart-crawler queue -crawl-id=%d'", stats.URLsFailed, stats.CrawlID)
+    }
+    logFetches(stats)
+    logProtocols(stats)
+    logTiming(stats)
+    logLoad(stats)
+    logHosts(stats)
+    logHarvest(stats)
+    logConcurrency(stats)
+    logEvaluation(stats)
+    opts.writeStats(stats)
+}
+
+// saveCookies writes the crawl's cookies back for the next run
+func saveCookies(jar *crawler.CookieJar, path string) {
+    if err := jar.Save(path); err != nil {
+        log.Printf("Failed to save cookies to %s: %v", path, err)
+        return
+    }
+    log.Printf("Saved %d cookies to %s", jar.Len(), path)
+}
+
+// saveLinkModel writes what the link model learned back for the next crawl
+func saveLinkModel(model *crawler.LinkModel, path string) {
+    if err := model.Save(path); err != nil {
+        log.Printf("Failed to save the link model to %s: %v", path, err)
+        return
+    }
+    stats := model.Stats()
+    log.Printf("Saved the link model to %s (%d features, %d updates, mean error %.3f)", path, stats.Features, stats.Updates, stats.MeanError)
+}
+
+// logPipelines reports what each pipeline stage processed
+func logPipelines(pipelines []*pipeline.Pipeline) {
+    for _, p := range pipelines {
+        for i, stage := range p.Stats() {
+            log.Printf("Pipeline %s stage %d (%s): %d processed, %d dropped, %d errors, %v",
+                p.Name(), i+1, stage.Processor, stage.Processed, stage.Dropped, stage.Errors, stage.Duration.Round(time.Millisecond))
+        }
+    }
+}
+
+// logFetches reports the requests and bytes each fetch strategy took
+func logFetches(stats *models.CrawlStats) {
+    for strategy, usage := range stats.Fetches {
+        log.Printf("Fetched %d URLs %s: %d requests (%d HEAD), %d not modified, %d bodies avoided, %d bytes",
+            usage.URLs, strategy, usage.Requests, usage.HeadRequests, usage.NotModified, usage.BodiesAvoided, usage.Bytes)
+    }
+}
+
+// logProtocols reports the pages fetched over each HTTP version and how long
+// they took on average
+func logProtocols(stats *models.CrawlStats) {
+    for protocol, usage := range stats.Protocols {
+        log.Printf("Fetched %d pages over %s in %v on average",
+            usage.Pages, protocol, (usage.LoadTime / time.Duration(usage.Pages)).Round(time.Millisecond))
+    }
+}
+
+// logTiming reports the percentiles of each phase of the crawl's fetches
+func logTiming(stats *models.CrawlStats) {
+    timing := stats.Timing
+    if timing == nil {
+        return
+    }
+    for _, phase := range []struct {
+        name        string
+        percentiles models.Percentiles
+    }{
+        {"DNS", timing.DNS},
+        {"connect", timing.Connect},
+        {"TLS", timing.TLS},
+        {"TTFB", timing.TTFB},
+        {"download", timing.Download},
+    } {
+        p := phase.percentiles
+        log.Printf("Fetch %s: p50 %.1fms, p90 %.1fms, p99 %.1fms, max %.1fms", phase.name, p.P50, p.P90, p.P99, p.Max)
+    }
+}
+
+// logLoad reports the percentiles of the crawl's page load times, its
+// rates, and the pages per status code
+func logLoad(stats *models.CrawlStats) {
+    if p := stats.Latency; p != nil {
+        log.Printf("Page load: p50 %.1fms, p90 %.1fms, p99 %.1fms, max %.1fms", p.P50, p.P90, p.P99, p.Max)
+    }
+    if stats.PagesPerSecond > 0 {
+        log.Printf("Throughput: %.2f pages/s, %.0f bytes/s", stats.PagesPerSecond, stats.BytesPerSecond)
+    }
+    if len(stats.StatusCodes) > 0 {
+        codes := make([]int, 0, len(stats.StatusCodes))
+        for code := range stats.StatusCodes {
+            codes = append(codes, code)
+        }
+        sort.Ints(codes)
+        counts := make([]string, len(codes))
+        for i, code := range codes {
+            counts[i] = fmt.Sprintf("%d: %d", code, stats.StatusCodes[code])
+        }
+        log.Printf("Status codes: %s", strings.Join(counts, ", "))
+    }
+}
+
+// logHarvest reports the crawl's harvest rate, overall and over its last
+// pages
+func logHarvest(stats *models.CrawlStats) {
+    h := stats.Harvest
+    if h == nil {
+        return
+    }
+    line := fmt.Sprintf("Harvest rate: %.1f%% (%d of %d pages with relevance at least %.2f)", h.Rate*100, h.Relevant, h.Pages, h.Threshold)
+    if n := len(h.Samples); n > 0 {
+        line += fmt.Sprintf(", %.1f%% over pages %d-%d", h.Samples[n-1].WindowRate*100, h.Samples[n-1].Pages-h.Step+1, h.Samples[n-1].Pages)
+    }
+    log.Print(line)
+}
+
+func logMirror(stats *models.CrawlStats) {
+    m := stats.Mirror
+    if m == nil {
+        return
+    }
+    log.Printf("Mirrored %d pages and %d assets (%d bytes) to %s, %d errors", m.Pages, m.Assets, m.Bytes, m.Dir, m.Errors)
+}
+
+// loggedHosts is how many hosts a crawl's report lists
+const loggedHosts = 10
+
+// logHosts reports the hosts a crawl fetched the most pages from, when it
+// reached more than one
+func logHosts(stats *models.CrawlStats) {
+    if len(stats.Hosts) < 2 {
+        return
+    }
+    hosts, _ := crawler.SortHosts(stats.Hosts, "pages")
+    for _, host := range hosts[:min(loggedHosts, len(hosts))] {
+        line := fmt.Sprintf("Host %s: %d pages, %d bytes, %d errors, %v avg load",
+            host.Host, host.Pages, host.Bytes, host.Errors, host.AvgLoadTime.Round(time.Millisecond))
+        if len(host.Skipped) > 0 {
+            reasons := make([]string, 0, len(host.Skipped))
+            for reason, n := range host.Skipped {
+                reasons = append(reasons, fmt.Sprintf("%s %d", reason, n))
+            }
+            sort.Strings(reasons)
+            line += ", skipped " + strings.Join(reasons, ", ")
+        }
+        log.Print(line)
+    }
+    if len(hosts) > loggedHosts {
+        log.Printf("... and %d more hosts; -stats-json has them all", len(hosts)-loggedHosts)
+    }
+}
+
+// writeStats writes the crawl's stats to -stats-json
+func (o *crawlOptions) writeStats(stats *models.CrawlStats) {
+    if o.statsPath == "" {
+        return
+    }
+    data, err := json.MarshalIndent(stats, "", "  ")
+    if err == nil {
+        err = os.WriteFile(o.statsPath, append(data, '\n'), 0o644)
+    }
+    if err != nil {
+        log.Printf("Failed to write -stats-json: %v", err)
+        return
+    }
+    log.Printf("Wrote the crawl's stats to %s", o.statsPath)
+}
+
+// logConcurrency reports the sizes an autoscaled worker pool went through
+func logConcurrency(stats *models.CrawlStats) {
+    if len(stats.Concurrency) == 0 {
+        return
+    }
+    sizes := make([]string, len(stats.Concurrency))
+    for i, sample := range stats.Concurrency {
+        sizes[i] = fmt.Sprintf("%d at %v (%s)", sample.Workers, sample.Elapsed.Round(time.Second), sample.Reason)
+    }
+    log.Printf("Worker pool sizes: %s", strings.Join(sizes, ", "))
+}
+
+func runRefresh(ctx context.Context, db database.Store, opts *crawlOptions, crawlID int64, workers int) {
+    if crawlID == 0 {
+        log.Fatalf("-refresh requires -crawl-id")
+    }
+    log.Printf("Refreshing pages of crawl %d due for a revisit with %d workers", crawlID, workers)
+
+    smartCrawler, err := crawler.NewSmart(db, opts.liveOptions(workers)...)
+    if err != nil {
+        log.Fatalf("Invalid crawler configuration: %v", err)
+    }
+    opts.watchStalls(smartCrawler)
+    smartCrawler.ContentHandlers().SetUnknownAction(opts.unknownContent)
+    smartCrawler.SetContinuous(*opts.revisit)
+    smartCrawler.SetRobotsTTL(opts.robotsTTL)
+    smartCrawler.SetDrainTimeout(opts.drainTimeout)
+    smartCrawler.SetAutoscale(opts.autoscale)
+    smartCrawler.SetHostConcurrency(opts.hostConcurrency)
+    smartCrawler.SetDNSPrefetch(opts.dnsPrefetch)
+    smartCrawler.SetDocuments(opts.documents)
+    smartCrawler.SetChangeMonitor(opts.changes)
+    start := time.Now()
+
+    stopWatching := opts.watch("refresh", smartCrawler)
+    stats, err := smartCrawler.Refresh(ctx, crawlID)
+    stopWatching()
+    if err != nil {
+        log.Fatalf("Refresh failed: %v", err)
+    }
+
+    log.Printf("Refresh completed in %v: %d pages revisited, %d changed, %d not modified, %d errors",
+        time.Since(start), stats.PagesRefreshed, stats.PagesChanged, stats.PagesNotModified, stats.Errors)
+    logFetches(stats)
+    logProtocols(stats)
+    logTiming(stats)
+    logLoad(stats)
+    logHosts(stats)
+    logHarvest(stats)
+    logConcurrency(stats)
+    opts.writeStats(stats)
+}
+
+// logEvaluation reports a holdout evaluation, comparing what the smart and
+// baseline policies' URLs yielded
+func logEvaluation(stats *models.CrawlStats) {
+    for _, policy := range []string{crawler.PolicySmart, crawler.PolicyBaseline} {
+        if yield := stats.Evaluation[policy]; yield != nil {
+            log.Printf("Policy %s: %d pages, %d skipped, %d errors, avg quality %.3f, avg importance %.3f",
+                policy, yield.Pages, yield.Skipped, yield.Errors, yield.AvgQuality, yield.AvgImportance)
+        }
+    }
+    smart, baseline := stats.Evaluation[crawler.PolicySmart], stats.Evaluation[crawler.PolicyBaseline]
+    if smart != nil && baseline != nil && smart.Pages > 0 && baseline.Pages > 0 {
+        log.Printf("Smart prioritization quality lift over baseline: %+.3f", smart.AvgQuality-baseline.AvgQuality)
+    }
+}
+
+func runReplay(ctx context.Context, db database.Store, opts *crawlOptions, warcPath, startURL string, maxDepth, workers int) {
+    archive, err := replay.LoadWARC(warcPath)
+    if err != nil {
+        log.Fatalf("Failed to load archive: %v", err)
+    }
+    if archive.Len() == 0 {
+        log.Fatalf("Archive %s contains no HTTP responses", warcPath)
+    }
+
+    if !archive.Has(startURL) {
+        startURL = archive.First()
+    }
+    log.Printf("Replaying %d archived responses from %s starting at %s with depth %d and %d workers", archive.Len(), warcPath, startURL, maxDepth, workers)
+
+    // None of the live options: replayed requests never reach the network,
+    // so they are not proxied, authenticated, or audited
+    replayOptions := append(opts.crawlerOptions(workers), crawler.WithClient(&http.Client{
+        Transport: &replay.Transport{Archive: archive},
+    }))
+    smartCrawler, err := crawler.NewSmart(db, replayOptions...)
+    if err != nil {
+        log.Fatalf("Invalid crawler configuration: %v", err)
+    }
+    // The archive has whatever robots.txt allowed when it was captured
+    smartCrawler.SetRobotsTTL(0)
+    smartCrawler.ContentHandlers().SetUnknownAction(opts.unknownContent)
+    smartCrawler.SetExpansionThreshold(opts.minQuality, opts.minImportance)
+    smartCrawler.SetPaginationDepth(opts.paginationDepth)
+    smartCrawler.SetNearDuplicateThreshold(opts.nearDuplicate)
+    smartCrawler.SetWriteBatch(opts.writeBatch, opts.writeFlushInterval)
+    smartCrawler.SetHoldout(opts.holdout)
+    smartCrawler.SetHostConcurrency(opts.hostConcurrency)
+    start := time.Now()
+
+    stopWatching := opts.watch("replay", smartCrawler)
+    stats, err := smartCrawler.Crawl(ctx, startURL, maxDepth)
+    stopWatching()
+    if err != nil {
+        log.Fatalf("Replay failed: %v", err)
+    }
+
+    duration := time.Since(start)
+    log.Printf("Replay completed in %v", duration)
+    log.Printf("Stats: %+v", stats)
+    logLoad(stats)
+    logHosts(stats)
+    logHarvest(stats)
+    logEvaluation(stats)
+    opts.writeStats(stats)
+}
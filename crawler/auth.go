@@ -0,0 +1,304 @@
+package crawler
+
+import (
+    "context"
+    "encoding/base64"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "net/url"
+    "os"
+    "strings"
+
+    "github.com/PuerkitoBio/goquery"
+)
+
+// SiteAuth is how the crawler authenticates to one domain. Any combination
+// of static headers, a bearer token or basic credentials, and a form login
+// may be set.
+type SiteAuth struct {
+    // "docs.example.com" for that host only, "*.example.com" for
+    // example.com and every host below it
+    Domain    string            `json:"domain"`
+    Headers   map[string]string `json:"headers"` // Sent as is, e.g. {"X-Api-Key": "..."}
+    Bearer    string            `json:"bearer"`
+    Basic     *BasicAuth        `json:"basic"`
+    FormLogin *FormLogin        `json:"form_login"`
+}
+
+type BasicAuth struct {
+    Username string `json:"username"`
+    Password string `json:"password"`
+}
+
+// FormLogin is a login form submitted before the crawl starts. The session
+// cookies it sets stay in the crawler's cookie jar.
+type FormLogin struct {
+    URL string `json:"url"` // Page with the login form
+    // CSS selector of the form; the default is the first form with a
+    // password field
+    Form string `json:"form"`
+    // Values to submit by input name. The form's other inputs, like hidden
+    // CSRF tokens, are submitted with the values the page gave them.
+    Fields map[string]string `json:"fields"`
+    // Optional CSS selector that only matches once logged in, e.g.
+    // "a.logout", checked on the page the form leads to
+    Check string `json:"check"`
+}
+
+// Auth holds the credentials of each site a crawl authenticates to. Headers
+// are only ever sent to requests for their own domain.
+type Auth struct {
+    sites []SiteAuth
+}
+
+func NewAuth(sites []SiteAuth) (*Auth, error) {
+    for i, site := range sites {
+        if strings.Trim(site.Domain, "*.") == "" {
+            return nil, fmt.Errorf("auth site %d has no domain", i+1)
+        }
+        sites[i].Domain = strings.ToLower(site.Domain)
+        if site.Bearer != "" && site.Basic != nil {
+            return nil, fmt.Errorf("auth site %s: set bearer or basic, not both", site.Domain)
+        }
+        if login := site.FormLogin; login != nil {
+            if parsed, err := url.Parse(login.URL); err != nil || parsed.Host == "" {
+                return nil, fmt.Errorf("auth site %s: invalid form_login url %q", site.Domain, login.URL)
+            }
+            if len(login.Fields) == 0 {
+                return nil, fmt.Errorf("auth site %s: form_login has no fields", site.Domain)
+            }
+        }
+    }
+    return &Auth{sites: sites}, nil
+}
+
+// LoadAuthFile reads a JSON auth file, e.g.
+//
+//  {"sites": [
+//      {"domain": "docs.example.com", "basic": {"username": "crawler", "password": "${DOCS_PASSWORD}"}},
+//      {"domain": "*.api.example.com", "bearer": "${API_TOKEN}"},
+//      {"domain": "wiki.example.com", "form_login": {"url": "https://wiki.example.com/login",
+//          "fields": {"user": "crawler", "pass": "${WIKI_PASSWORD}"}, "check": "a.logout"}}
+//  ]}
+//
+// ${VAR} references are replaced with environment variables, so secrets
+// can stay out of the file.
+func LoadAuthFile(path string) (*Auth, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+    var file struct {
+        Sites []SiteAuth `json:"sites"`
+    }
+    if err := json.Unmarshal([]byte(os.ExpandEnv(string(data))), &file); err != nil {
+        return nil, fmt.Errorf("invalid auth file %s: %w", path, err)
+    }
+    return NewAuth(file.Sites)
+}
+
+// Sites returns how many sites have credentials
+func (a *Auth) Sites() int {
+    return len(a.sites)
+}
+
+func (s *SiteAuth) matches(host string) bool {
+    return matchesDomain(s.Domain, host)
+}
+
+// matchesDomain reports whether host is domain, or for "*.example.com"
+// example.com or any host below it
+func matchesDomain(domain, host string) bool {
+    if parent, ok := strings.CutPrefix(domain, "*."); ok {
+        return host == parent || strings.HasSuffix(host, "."+parent)
+    }
+    return host == domain
+}
+
+// authorize returns req with the headers of every site matching its host,
+// cloning it before any change. Headers the request already has are kept.
+func (a *Auth) authorize(req *http.Request) *http.Request {
+    host := strings.ToLower(req.URL.Hostname())
+    authorized := req
+    set := func(name, value string) {
+        if authorized.Header.Get(name) != "" {
+            return
+        }
+        if authorized == req {
+            authorized = req.Clone(req.Context())
+        }
+        authorized.Header.Set(name, value)
+    }
+
+    for i := range a.sites {
+        site := &a.sites[i]
+        if !site.matches(host) {
+            continue
+        }
+        for name, value := range site.Headers {
+            set(name, value)
+        }
+        switch {
+        case site.Bearer != "":
+            set("Authorization", "Bearer "+site.Bearer)
+        case site.Basic != nil:
+            credentials := site.Basic.Username + ":" + site.Basic.Password
+            set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(credentials)))
+        }
+    }
+    return authorized
+}
+
+// authTransport adds each site's auth headers to its requests
+type authTransport struct {
+    base http.RoundTripper
+    auth *Auth
+}
+
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+    base := t.base
+    if base == nil {
+        base = http.DefaultTransport
+    }
+    return base.RoundTrip(t.auth.authorize(req))
+}
+
+// Login submits every site's login form with client, whose cookie jar keeps
+// the session cookies for the crawl
+func (a *Auth) Login(ctx context.Context, client *http.Client) error {
+    for _, site := range a.sites {
+        if site.FormLogin == nil {
+            continue
+        }
+        if client.Jar == nil {
+            return errors.New("form login needs a client with a cookie jar")
+        }
+        if err := site.FormLogin.submit(ctx, client); err != nil {
+            return fmt.Errorf("login to %s failed: %w", site.Domain, err)
+        }
+    }
+    return nil
+}
+
+func (l *FormLogin) submit(ctx context.Context, client *http.Client) error {
+    page, pageURL, err := getDocument(ctx, client, http.MethodGet, l.URL, nil)
+    if err != nil {
+        return err
+    }
+
+    selector := l.Form
+    if selector == "" {
+        selector = "form:has(input[type=password])"
+    }
+    form := page.Find(selector).First()
+    if form.Length() == 0 {
+        return fmt.Errorf("no form matching %q on %s", selector, pageURL)
+    }
+
+    values := formValues(form)
+    for name, value := range l.Fields {
+        values.Set(name, value)
+    }
+
+    action := pageURL
+    if attr, ok := form.Attr("action"); ok && strings.TrimSpace(attr) != "" {
+        ref, err := url.Parse(strings.TrimSpace(attr))
+        if err != nil {
+            return fmt.Errorf("invalid form action %q", attr)
+        }
+        action = pageURL.ResolveReference(ref)
+    }
+
+    method, _ := form.Attr("method")
+    var result *goquery.Document
+    if strings.EqualFold(method, http.MethodPost) {
+        result, _, err = getDocument(ctx, client, http.MethodPost, action.String(), values)
+    } else {
+        target := *action
+        target.RawQuery = values.Encode()
+        result, _, err = getDocument(ctx, client, http.MethodGet, target.String(), nil)
+    }
+    if err != nil {
+        return err
+    }
+    if l.Check != "" && result.Find(l.Check).Length() == 0 {
+        return fmt.Errorf("%q not found after submitting the form, check the credentials", l.Check)
+    }
+    return nil
+}
+
+// formValues collects what a browser would submit for the form's inputs as
+// the page set them
+func formValues(form *goquery.Selection) url.Values {
+    values := url.Values{}
+    form.Find("input[name]").Each(func(_ int, input *goquery.Selection) {
+        name, _ := input.Attr("name")
+        value, _ := input.Attr("value")
+        switch kind, _ := input.Attr("type"); strings.ToLower(kind) {
+        case "submit", "button", "image", "reset", "file":
+            return
+        case "checkbox", "radio":
+            if _, checked := input.Attr("checked"); !checked {
+                return
+            }
+            if value == "" {
+                value = "on"
+            }
+        }
+        values.Add(name, value)
+    })
+    form.Find("textarea[name]").Each(func(_ int, textarea *goquery.Selection) {
+        name, _ := textarea.Attr("name")
+        values.Add(name, textarea.Text())
+    })
+    form.Find("select[name]").Each(func(_ int, sel *goquery.Selection) {
+        name, _ := sel.Attr("name")
+        option := sel.Find("option[selected]").First()
+        if option.Length() == 0 {
+            option = sel.Find("option").First()
+        }
+        if option.Length() == 0 {
+            return
+        }
+        value, ok := option.Attr("value")
+        if !ok {
+            value = strings.TrimSpace(option.Text())
+        }
+        values.Add(name, value)
+    })
+    return values
+}
+
+// getDocument requests a page and parses it, returning the URL it ended up
+// at after redirects
+func getDocument(ctx context.Context, client *http.Client, method, rawURL string, form url.Values) (*goquery.Document, *url.URL, error) {
+    var body io.Reader
+    if form != nil {
+        body = strings.NewReader(form.Encode())
+    }
+    req, err := http.NewRequestWithContext(ctx, method, rawURL, body)
+    if err != nil {
+        return nil, nil, err
+    }
+    if form != nil {
+        req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+    }
+
+    resp, err := client.Do(req)
+    if err != nil {
+        return nil, nil, err
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode >= 400 {
+        return nil, nil, fmt.Errorf("%s %s: status %d", method, rawURL, resp.StatusCode)
+    }
+
+    doc, err := goquery.NewDocumentFromReader(resp.Body)
+    if err != nil {
+        return nil, nil, err
+    }
+    return doc, resp.Request.URL, nil
+}
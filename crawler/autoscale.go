@@ -0,0 +1,289 @@
+package crawler
+
+import (
+    "context"
+    "sync"
+    "time"
+
+    "golang.org/x/time/rate"
+
+    "smart-crawler/models"
+)
+
+// Autoscale lets the smart crawler size its worker pool between Min and Max
+// workers instead of running a fixed number. The pool starts at the
+// crawler's worker count, kept within those bounds.
+type Autoscale struct {
+    Min      int
+    Max      int
+    Interval time.Duration // Between resizes; 0 for DefaultAutoscaleInterval
+}
+
+// DefaultAutoscaleInterval is how often an autoscaled pool is resized
+const DefaultAutoscaleInterval = 10 * time.Second
+
+const (
+    // Share of a window's fetches failing, or answered 429 or 5xx, above
+    // which the pool shrinks
+    scaleErrorRate = 0.1
+    // Fetch latency, as a multiple of the baseline, above which the pool
+    // shrinks, and below which it may grow
+    scaleSlowdown = 2.0
+    scaleHealthy  = 1.3
+    // Share of workers waiting for URLs above which, when the frontier ran
+    // short, the queue is starving them
+    scaleStarvedIdle = 0.5
+    // Fetches a window needs before its latency and errors are judged
+    scaleMinFetches = 5
+    // How often idle workers are counted within a window
+    idleSampleInterval = time.Second
+)
+
+// SetAutoscale resizes the worker pool as the crawl runs: it grows while
+// fetches are quick and succeed and the frontier has more URLs than the
+// workers keep up with, and shrinks when the servers slow down, fail or
+// throttle, or the frontier runs short and leaves workers idle. It does not grow past what the rate limit allows. Each size
+// chosen is recorded in CrawlStats.Concurrency. A Max of 0 keeps the pool
+// fixed, as it is by default.
+func (s *Smart) SetAutoscale(scale Autoscale) {
+    if scale.Max <= 0 {
+        s.autoscale = nil
+        return
+    }
+    scale.Min = max(scale.Min, 1)
+    scale.Max = max(scale.Max, scale.Min)
+    if scale.Interval <= 0 {
+        scale.Interval = DefaultAutoscaleInterval
+    }
+    s.autoscale = &scale
+}
+
+// workerPool runs the smart crawler's workers. It is resized from one
+// goroutine at a time: run starts it, then the autoscaler takes over until
+// the crawl finishes.
+type workerPool struct {
+    wg     sync.WaitGroup
+    work   func(retire <-chan struct{})
+    retire chan struct{} // Each value sent retires one worker
+    size   int
+}
+
+// newWorkerPool returns an empty pool of up to limit workers running work,
+// which returns when told to on retire
+func newWorkerPool(limit int, work func(retire <-chan struct{})) *workerPool {
+    return &workerPool{work: work, retire: make(chan struct{}, limit)}
+}
+
+// resize starts or retires workers until size are running. A worker retires
+// once it is between URLs. Growing first keeps workers not yet retired, so
+// the pool never runs more workers than its limit.
+func (p *workerPool) resize(size int) {
+    for ; p.size < size; p.size++ {
+        select {
+        case <-p.retire:
+        default:
+            p.wg.Add(1)
+            go func() {
+                defer p.wg.Done()
+                p.work(p.retire)
+            }()
+        }
+    }
+    for ; p.size > size; p.size-- {
+        p.retire <- struct{}{}
+    }
+}
+
+// wait returns once every worker has returned
+func (p *workerPool) wait() {
+    p.wg.Wait()
+}
+
+// autoscaler decides the size of an autoscaled pool from the fetches, pulls,
+// and idle workers of each interval. Workers observe fetches and the
+// dispatcher pulls while the scaling goroutine samples and decides, hence
+// the lock.
+type autoscaler struct {
+    scale    Autoscale
+    size     int
+    baseline time.Duration // Fetch latency while the servers are healthy
+    samples  []models.ConcurrencySample
+
+    mutex    sync.Mutex
+    fetches  int
+    failures int
+    latency  time.Duration // Summed over the window's fetches
+    idle     float64       // Summed share of workers idle, per sample
+    idleRuns int
+    pulls    int
+    short    int // Pulls the frontier could not fill
+}
+
+func newAutoscaler(scale Autoscale, workers int) *autoscaler {
+    return &autoscaler{scale: scale, size: min(max(workers, scale.Min), scale.Max)}
+}
+
+// observe records a settled fetch and how long it took
+func (a *autoscaler) observe(result smartCrawlResult, took time.Duration) {
+    if a == nil || result.Skipped {
+        return
+    }
+    a.mutex.Lock()
+    defer a.mutex.Unlock()
+
+    a.fetches++
+    a.latency += took
+    if result.Error != nil || (result.Page != nil && (result.Page.StatusCode == 429 || result.Page.StatusCode >= 500)) {
+        a.failures++
+    }
+}
+
+// pulled records a pull from the frontier that asked for requested URLs
+// and got got. A pull skipped as the workers were behind counts as full.
+func (a *autoscaler) pulled(requested, got int) {
+    if a == nil {
+        return
+    }
+    a.mutex.Lock()
+    defer a.mutex.Unlock()
+
+    a.pulls++
+    if got < requested {
+        a.short++
+    }
+}
+
+// sampleIdle records how many of the pool's workers are waiting for URLs
+func (a *autoscaler) sampleIdle(idle int) {
+    a.mutex.Lock()
+    defer a.mutex.Unlock()
+
+    a.idle += float64(idle) / float64(a.size)
+    a.idleRuns++
+}
+
+// reset forgets the window, as while the crawl is paused
+func (a *autoscaler) reset() {
+    a.mutex.Lock()
+    defer a.mutex.Unlock()
+
+    a.fetches, a.failures, a.latency = 0, 0, 0
+    a.idle, a.idleRuns = 0, 0
+    a.pulls, a.short = 0, 0
+}
+
+// decide closes the window and returns the pool size it calls for, and why
+// the size changed, or "" when it holds. rateBound is set when the crawl
+// already fetches as fast as the rate limit allows, so more workers would
+// only wait on it.
+func (a *autoscaler) decide(rateBound bool) (int, string) {
+    a.mutex.Lock()
+    fetches, failures, latency := a.fetches, a.failures, a.latency
+    backlog, starved := a.pulls > 0 && a.short == 0, a.short > 0
+    idle := 0.0
+    if a.idleRuns > 0 {
+        idle = a.idle / float64(a.idleRuns)
+    }
+    a.mutex.Unlock()
+    a.reset()
+
+    size := a.size
+    shrink := max(size/4, 1)
+    starved = starved && idle > scaleStarvedIdle
+    if fetches < scaleMinFetches {
+        if starved {
+            return a.resize(size-max(int(idle*float64(size))/2, 1), "starved")
+        }
+        return size, ""
+    }
+
+    avg := latency / time.Duration(fetches)
+    baseline := a.baseline
+    switch {
+    case a.baseline == 0 || avg < a.baseline:
+        a.baseline = avg
+    default:
+        // Drift towards slower servers, so a site that stays slow is not
+        // shrunk forever
+        a.baseline += (avg - a.baseline) / 10
+    }
+
+    switch {
+    case float64(failures)/float64(fetches) > scaleErrorRate:
+        return a.resize(size-shrink, "errors")
+    case baseline > 0 && float64(avg) > float64(baseline)*scaleSlowdown:
+        return a.resize(size-shrink, "latency")
+    case starved:
+        return a.resize(size-max(int(idle*float64(size))/2, 1), "starved")
+    case backlog && !rateBound && (baseline == 0 || float64(avg) <= float64(baseline)*scaleHealthy):
+        return a.resize(size+max(size/4, 1), "healthy")
+    }
+    return size, ""
+}
+
+// resize keeps size within the bounds and records it as the pool's
+func (a *autoscaler) resize(size int, reason string) (int, string) {
+    size = min(max(size, a.scale.Min), a.scale.Max)
+    if size == a.size {
+        return size, ""
+    }
+    a.size = size
+    return size, reason
+}
+
+// runAutoscaler resizes pool until the returned function is called, which
+// waits for the last resize. elapsed gives the crawl's running time for the
+// samples.
+func (s *Smart) runAutoscaler(ctx context.Context, scaler *autoscaler, pool *workerPool, pacer *pullPacer, elapsed func() time.Duration) func() {
+    scaler.samples = append(scaler.samples, models.ConcurrencySample{Elapsed: elapsed(), Workers: scaler.size, Reason: "start"})
+
+    done := make(chan struct{})
+    stopped := make(chan struct{})
+    go func() {
+        defer close(stopped)
+        sample := time.NewTicker(idleSampleInterval)
+        defer sample.Stop()
+        decide := time.NewTicker(scaler.scale.Interval)
+        defer decide.Stop()
+        windowStart := time.Now()
+
+        for {
+            select {
+            case <-done:
+                return
+            case <-ctx.Done():
+                return
+            case <-sample.C:
+                scaler.sampleIdle(pacer.idle())
+            case <-decide.C:
+                window := time.Since(windowStart)
+                windowStart = time.Now()
+                if s.gate.isPaused() {
+                    scaler.reset()
+                    continue
+                }
+                scaler.mutex.Lock()
+                fetchRate := float64(scaler.fetches) / window.Seconds()
+                scaler.mutex.Unlock()
+                limit := s.limiter.Limit()
+                rateBound := limit != rate.Inf && fetchRate >= 0.9*float64(limit)
+
+                size, reason := scaler.decide(rateBound)
+                if reason == "" {
+                    continue
+                }
+                pool.resize(size)
+                pacer.setWorkers(size)
+                scaler.samples = append(scaler.samples, models.ConcurrencySample{Elapsed: elapsed(), Workers: size, Reason: reason})
+            }
+        }
+    }()
+
+    var once sync.Once
+    return func() {
+        once.Do(func() {
+            close(done)
+            <-stopped
+        })
+    }
+}
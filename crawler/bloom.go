@@ -0,0 +1,194 @@
+package crawler
+
+import (
+    "encoding/binary"
+    "errors"
+    "hash/fnv"
+    "math"
+    "sync"
+)
+
+// BloomFilter is a fixed-size set that never forgets a key but may report
+// a key it was never given, with a bounded false-positive rate. Its memory
+// depends on the capacity it was sized for, not on how many keys it holds.
+type BloomFilter struct {
+    bits  []uint64
+    m     uint64 // Number of bits
+    k     uint64 // Hash functions per key
+    mutex sync.Mutex
+}
+
+// NewBloomFilter sizes a filter to hold capacity keys at the given
+// false-positive rate. Beyond capacity the rate degrades gradually.
+func NewBloomFilter(capacity uint, falsePositiveRate float64) *BloomFilter {
+    if capacity == 0 {
+        capacity = 1
+    }
+    if falsePositiveRate <= 0 || falsePositiveRate >= 1 {
+        falsePositiveRate = 0.001
+    }
+
+    m := uint64(math.Ceil(-float64(capacity) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2)))
+    k := uint64(math.Max(1, math.Round(float64(m)/float64(capacity)*math.Ln2)))
+    return &BloomFilter{
+        bits: make([]uint64, (m+63)/64),
+        m:    m,
+        k:    k,
+    }
+}
+
+// TestAndAdd adds key and reports whether it may have been added before
+func (b *BloomFilter) TestAndAdd(key string) bool {
+    h1, h2 := bloomHashes(key)
+
+    b.mutex.Lock()
+    defer b.mutex.Unlock()
+
+    present := true
+    for i := uint64(0); i < b.k; i++ {
+        bit := (h1 + i*h2) % b.m
+        word, mask := bit/64, uint64(1)<<(bit%64)
+        if b.bits[word]&mask == 0 {
+            present = false
+            b.bits[word] |= mask
+        }
+    }
+    return present
+}
+
+// Test reports whether key may have been added, without adding it
+func (b *BloomFilter) Test(key string) bool {
+    h1, h2 := bloomHashes(key)
+
+    b.mutex.Lock()
+    defer b.mutex.Unlock()
+
+    for i := uint64(0); i < b.k; i++ {
+        bit := (h1 + i*h2) % b.m
+        if b.bits[bit/64]&(uint64(1)<<(bit%64)) == 0 {
+            return false
+        }
+    }
+    return true
+}
+
+// bloomHashes derives the two base hashes combined into k indexes. FNV
+// alone spreads similar keys poorly, so it is run through the splitmix64
+// finalizer. Hashes must be stable across runs for checkpoints to restore.
+func bloomHashes(key string) (uint64, uint64) {
+    hash := fnv.New64a()
+    hash.Write([]byte(key))
+    sum := hash.Sum64()
+    // An odd step visits every bit before repeating
+    return mix64(sum), mix64(sum^0x9e3779b97f4a7c15) | 1
+}
+
+func mix64(x uint64) uint64 {
+    x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+    x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+    return x ^ (x >> 31)
+}
+
+// MarshalBinary encodes the filter for a checkpoint
+func (b *BloomFilter) MarshalBinary() ([]byte, error) {
+    b.mutex.Lock()
+    defer b.mutex.Unlock()
+
+    data := make([]byte, 16+8*len(b.bits))
+    binary.BigEndian.PutUint64(data[0:], b.m)
+    binary.BigEndian.PutUint64(data[8:], b.k)
+    for i, word := range b.bits {
+        binary.BigEndian.PutUint64(data[16+8*i:], word)
+    }
+    return data, nil
+}
+
+// UnmarshalBinary restores a filter encoded by MarshalBinary, replacing its
+// size and contents
+func (b *BloomFilter) UnmarshalBinary(data []byte) error {
+    if len(data) < 16 {
+        return errors.New("bloom filter: truncated data")
+    }
+    m, k := binary.BigEndian.Uint64(data[0:]), binary.BigEndian.Uint64(data[8:])
+    if m == 0 || k == 0 || uint64(len(data)-16) != 8*((m+63)/64) {
+        return errors.New("bloom filter: corrupt data")
+    }
+
+    bits := make([]uint64, (m+63)/64)
+    for i := range bits {
+        bits[i] = binary.BigEndian.Uint64(data[16+8*i:])
+    }
+
+    b.mutex.Lock()
+    defer b.mutex.Unlock()
+    b.bits, b.m, b.k = bits, m, k
+    return nil
+}
+
+// SeenOptions bounds the memory of the sets of URLs and content hashes a
+// crawl has seen. The zero value keeps exact sets that spill to disk past
+// DefaultSeenMemory keys.
+type SeenOptions struct {
+    Capacity          uint    // Expected distinct keys; 0 keeps exact sets
+    Memory            int     // Keys an exact set holds in memory before spilling to disk; 0 for DefaultSeenMemory
+    FalsePositiveRate float64
+    // Verify confirms every Bloom filter hit against the database, so a
+    // false positive never drops a page. It costs a query per repeat.
+    Verify bool
+}
+
+// WithSeenFilter bounds the memory of the crawler's seen sets, its visited
+// URLs or the smart crawler's content hashes, with opts. With opts.Verify,
+// Bloom filter hits are confirmed against the crawl's saved pages, so a
+// false positive never drops a page, though the traditional crawler may
+// then fetch a URL still queued twice.
+func WithSeenFilter(opts SeenOptions) Option {
+    return func(o *options) error {
+        if opts.Memory < 0 {
+            return errors.New("seen set memory must not be negative")
+        }
+        o.seen = opts
+        return nil
+    }
+}
+
+// seenSet records keys and reports repeats
+type seenSet interface {
+    // testAndAdd adds key and reports whether it was seen before
+    testAndAdd(key string) bool
+    // close frees what the set keeps on disk
+    close()
+}
+
+// bloomSeenSet is a Bloom filter whose hits are optionally confirmed by
+// verify. If verify fails the hit is trusted.
+type bloomSeenSet struct {
+    filter *BloomFilter
+    verify func(key string) (bool, error)
+}
+
+func (s *bloomSeenSet) testAndAdd(key string) bool {
+    if !s.filter.TestAndAdd(key) {
+        return false
+    }
+    if s.verify == nil {
+        return true
+    }
+    seen, err := s.verify(key)
+    return seen || err != nil
+}
+
+func (s *bloomSeenSet) close() {}
+
+// newSeenSet builds the set opts describes, with verify as the database
+// check used when opts.Verify is set
+func newSeenSet(opts SeenOptions, verify func(key string) (bool, error)) seenSet {
+    if opts.Capacity == 0 {
+        return newSpillSet(opts.Memory)
+    }
+    set := &bloomSeenSet{filter: NewBloomFilter(opts.Capacity, opts.FalsePositiveRate)}
+    if opts.Verify {
+        set.verify = verify
+    }
+    return set
+}
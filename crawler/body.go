@@ -0,0 +1,68 @@
+package crawler
+
+import (
+    "bytes"
+    "crypto/md5"
+    "fmt"
+    "io"
+)
+
+// DefaultMaxResponseSize is how much of a response body the crawlers read
+// before cutting it off, so one huge file cannot exhaust memory
+const DefaultMaxResponseSize int64 = 10 << 20
+
+// WithMaxResponseSize caps how many bytes of each response body are read;
+// the rest is discarded and the page marked truncated. It is
+// DefaultMaxResponseSize by default; 0 removes the cap.
+func WithMaxResponseSize(max int64) Option {
+    return func(o *options) error {
+        if max < 0 {
+            return fmt.Errorf("max response size must not be negative, got %d", max)
+        }
+        o.maxResponseSize = max
+        return nil
+    }
+}
+
+// responseBody is a response body read up to the size cap
+type responseBody struct {
+    data      []byte
+    hash      string // MD5 of data, computed as it streamed in
+    truncated bool   // The response had more than the cap
+
+    encoding       string // Content-Encoding it was decoded from, if any
+    compressedSize int64  // Bytes of the compressed body read
+}
+
+// readBody reads body up to max bytes, or all of it when max is 0,
+// hashing it on the way in. The cap applies to the decoded body, so a small
+// compressed response cannot expand past it. wire, if set, is the
+// request's wireStats.
+func readBody(body io.Reader, max int64, wire *wireStats) (*responseBody, error) {
+    hasher := md5.New()
+    reader := body
+    if max > 0 {
+        reader = io.LimitReader(body, max)
+    }
+
+    var buf bytes.Buffer
+    if _, err := buf.ReadFrom(io.TeeReader(reader, hasher)); err != nil {
+        return nil, err
+    }
+    read := &responseBody{data: buf.Bytes(), hash: fmt.Sprintf("%x", hasher.Sum(nil))}
+
+    // One more byte tells a body of exactly max bytes from a longer one
+    if max > 0 && int64(len(read.data)) == max {
+        var probe [1]byte
+        n, err := io.ReadFull(body, probe[:])
+        if n > 0 {
+            read.truncated = true
+        } else if err != nil && err != io.EOF {
+            return nil, err
+        }
+    }
+    if wire != nil {
+        read.encoding, read.compressedSize = wire.encoding, wire.compressedSize()
+    }
+    return read, nil
+}
@@ -0,0 +1,110 @@
+package crawler
+
+import (
+    "context"
+    "errors"
+    "sync/atomic"
+    "time"
+
+    "smart-crawler/models"
+)
+
+// Reasons a crawl stopped, reported in CrawlStats.StopReason
+const (
+    StopCompleted   = "completed" // Frontier exhausted within the depth limit
+    StopCancelled   = "cancelled"
+    StopMaxPages    = "max_pages"
+    StopMaxBytes    = "max_bytes"
+    StopMaxDuration = "max_duration"
+)
+
+// Budget caps the size of a crawl. Zero fields are unlimited.
+type Budget struct {
+    MaxPages    int
+    MaxBytes    int64
+    MaxDuration time.Duration // Wall-clock time of one run, not counting resumed runs
+}
+
+// WithBudget stops the crawl once it has fetched budget.MaxPages pages or
+// budget.MaxBytes bytes of content, or has run for budget.MaxDuration. Pages
+// being fetched are still saved; the smart crawler defers the URLs left in
+// its queue for SetResume. The reason is reported in CrawlStats.StopReason.
+func WithBudget(budget Budget) Option {
+    return func(o *options) error {
+        if budget.MaxPages < 0 || budget.MaxBytes < 0 || budget.MaxDuration < 0 {
+            return errors.New("budget limits must not be negative")
+        }
+        o.budget = budget
+        return nil
+    }
+}
+
+// budgetTracker counts fetched pages and bytes against a Budget. Workers
+// record pages as their fetches complete while the dispatcher and the results
+// processor check whether the budget is spent, so counters are atomic. Pages
+// already being fetched when the budget runs out are still saved, so a crawl
+// can overshoot by up to the number of workers. The deadline is checked
+// lazily, whenever the budget is.
+type budgetTracker struct {
+    limits   Budget
+    pages    int64 // atomic
+    bytes    int64 // atomic
+    deadline time.Time
+    reason   atomic.Value
+}
+
+// newBudgetTracker starts from stats, so a resumed crawl counts what it
+// crawled before the interruption.
+func newBudgetTracker(limits Budget, stats *models.CrawlStats) *budgetTracker {
+    b := &budgetTracker{
+        limits: limits,
+        pages:  int64(stats.PagesProcessed),
+        bytes:  stats.TotalSize,
+    }
+    if limits.MaxDuration > 0 {
+        b.deadline = time.Now().Add(limits.MaxDuration)
+    }
+    b.check()
+    return b
+}
+
+// record counts a fetched page of size bytes
+func (b *budgetTracker) record(size int64) {
+    atomic.AddInt64(&b.pages, 1)
+    atomic.AddInt64(&b.bytes, size)
+    b.check()
+}
+
+func (b *budgetTracker) check() {
+    switch {
+    case b.limits.MaxPages > 0 && atomic.LoadInt64(&b.pages) >= int64(b.limits.MaxPages):
+        b.reason.CompareAndSwap(nil, StopMaxPages)
+    case b.limits.MaxBytes > 0 && atomic.LoadInt64(&b.bytes) >= b.limits.MaxBytes:
+        b.reason.CompareAndSwap(nil, StopMaxBytes)
+    }
+}
+
+// exhausted reports whether any limit has been reached
+func (b *budgetTracker) exhausted() bool {
+    if !b.deadline.IsZero() && time.Now().After(b.deadline) {
+        b.reason.CompareAndSwap(nil, StopMaxDuration)
+    }
+    return b.stopReason() != ""
+}
+
+// stopReason names the limit that was reached first, or is empty
+func (b *budgetTracker) stopReason() string {
+    reason, _ := b.reason.Load().(string)
+    return reason
+}
+
+// stopReason explains why a crawl finished
+func stopReason(ctx context.Context, budget *budgetTracker) string {
+    if reason := budget.stopReason(); reason != "" {
+        return reason
+    }
+    if ctx.Err() != nil {
+        return StopCancelled
+    }
+    return StopCompleted
+}
@@ -0,0 +1,63 @@
+package crawler
+
+import (
+    "net/url"
+    "strings"
+    "sync"
+
+    "github.com/PuerkitoBio/goquery"
+)
+
+// canonicalURL is the URL a page names as its own with <link
+// rel="canonical">, resolved against pageURL, or "" if it names none. Only
+// the first is used, as search engines do, and it must be http or https.
+func canonicalURL(doc *goquery.Document, pageURL string) string {
+    href, ok := doc.Find(`link[rel~="canonical"][href]`).First().Attr("href")
+    if !ok || strings.TrimSpace(href) == "" {
+        return ""
+    }
+    resolved, err := url.Parse(resolveURL(pageURL, strings.TrimSpace(href)))
+    if err != nil || (resolved.Scheme != "http" && resolved.Scheme != "https") || resolved.Host == "" {
+        return ""
+    }
+    resolved.Fragment = ""
+    return resolved.String()
+}
+
+// How many canonical URLs a crawl remembers before starting over; past that
+// variants are caught by the store alone
+const maxCanonicalClaims = 100000
+
+// canonicalClaims remembers which URL of the running crawl first named each
+// canonical URL, so variants fetched at the same time are not all saved
+// before any of them reaches the store
+type canonicalClaims struct {
+    claims map[string]string
+    mutex  sync.Mutex
+}
+
+func newCanonicalClaims() *canonicalClaims {
+    return &canonicalClaims{claims: make(map[string]string)}
+}
+
+// claim reports whether the page at rawURL may be saved for canonical,
+// which it may unless another URL named canonical first
+func (c *canonicalClaims) claim(canonical, rawURL string) bool {
+    c.mutex.Lock()
+    defer c.mutex.Unlock()
+
+    if first, ok := c.claims[canonical]; ok {
+        return first == rawURL
+    }
+    if len(c.claims) >= maxCanonicalClaims {
+        c.claims = make(map[string]string)
+    }
+    c.claims[canonical] = rawURL
+    return true
+}
+
+// nonCanonical reports whether a page fetched as rawURL, ending up at
+// finalURL, names some other URL as canonical
+func nonCanonical(canonical, rawURL, finalURL string) bool {
+    return canonical != "" && canonical != rawURL && canonical != finalURL
+}
@@ -0,0 +1,306 @@
+package crawler
+
+import (
+    "context"
+    "fmt"
+    "strings"
+
+    "golang.org/x/net/html"
+
+    "smart-crawler/models"
+)
+
+// Lines of unchanged text shown around each change of a diff
+const diffContext = 3
+
+// Most pairs of lines compared between the changed middles of two versions;
+// larger rewrites are shown as everything removed and added
+const maxDiffCells = 4_000_000
+
+// Most bytes of a diff stored; the rest is cut at a line
+const maxDiffSize = 64 << 10
+
+// Elements whose text starts and ends a line of a page's diffed text
+var diffBlocks = map[string]bool{
+    "address": true, "article": true, "aside": true, "blockquote": true, "br": true,
+    "dd": true, "details": true, "div": true, "dl": true, "dt": true,
+    "figcaption": true, "figure": true, "footer": true, "form": true,
+    "h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+    "header": true, "hr": true, "li": true, "main": true, "nav": true,
+    "ol": true, "p": true, "pre": true, "section": true, "summary": true,
+    "table": true, "td": true, "th": true, "tr": true, "ul": true,
+}
+
+// ChangeNotifier is told when a watched page changes, e.g. to post to a
+// webhook or send an email
+type ChangeNotifier interface {
+    NotifyChange(ctx context.Context, change *models.PageChange) error
+}
+
+// ChangeMonitor records what revisits find changed in pages and tells its
+// notifiers about changes to watched pages
+type ChangeMonitor struct {
+    Watch     *URLFilter // Pages whose changes are notified; nil for every page
+    Notifiers []ChangeNotifier
+}
+
+// SetChangeMonitor makes continuous crawls and refreshes store a diff of
+// the text of each page a revisit finds changed, in the page_changes table,
+// and notify monitor's notifiers of the changes to pages it watches.
+// Notifications are sent in the background; the crawl waits for them before
+// it returns. nil stores no diffs.
+func (s *Smart) SetChangeMonitor(monitor *ChangeMonitor) {
+    s.changes = monitor
+}
+
+// detectChange diffs a revisited page that came back changed against the
+// version saved before it is overwritten
+func (s *Smart) detectChange(ctx context.Context, result smartCrawlResult) *models.PageChange {
+    if s.changes == nil {
+        return nil
+    }
+    previousHash, previous, err := s.db.GetSavedContent(s.crawlID, result.URL)
+    if err != nil {
+        s.emit(ctx, Event{Type: ErrorOccurred, URL: result.URL, Err: fmt.Errorf("reading the previous version: %w", err)})
+        return nil
+    }
+    page := result.Page
+    diff, added, removed := diffLines(textLines(previous, page.ContentType), textLines(page.Content, page.ContentType))
+    return &models.PageChange{
+        CrawlID:      s.crawlID,
+        CrawlUUID:    s.crawlUUID,
+        URL:          result.URL,
+        PreviousHash: previousHash,
+        Hash:         page.Hash,
+        Added:        added,
+        Removed:      removed,
+        Diff:         diff,
+    }
+}
+
+// recordChange stores the change found in a page once it is saved, and
+// notifies of it if the page is watched
+func (s *Smart) recordChange(ctx context.Context, change *models.PageChange, page *models.Page) {
+    if change == nil {
+        return
+    }
+    change.PageID, change.Title = page.ID, page.Title
+    if err := s.db.SavePageChange(change); err != nil {
+        s.emit(ctx, Event{Type: ErrorOccurred, URL: change.URL, Err: err})
+        return
+    }
+    if !s.changes.Watch.Allow(change.URL) {
+        return
+    }
+    for _, notifier := range s.changes.Notifiers {
+        s.notifications.Add(1)
+        go func(notifier ChangeNotifier) {
+            defer s.notifications.Done()
+            if err := notifier.NotifyChange(ctx, change); err != nil {
+                s.emit(ctx, Event{Type: ErrorOccurred, URL: change.URL, Err: fmt.Errorf("change notification failed: %w", err)})
+            }
+        }(notifier)
+    }
+}
+
+// textLines is the text of a page's content as it reads, one line per
+// block of an HTML page, without blank lines
+func textLines(content, contentType string) []string {
+    var lines []string
+    if !strings.Contains(strings.ToLower(contentType), "html") {
+        for _, line := range strings.Split(content, "\n") {
+            if line = strings.Join(strings.Fields(line), " "); line != "" {
+                lines = append(lines, line)
+            }
+        }
+        return lines
+    }
+
+    root, err := html.Parse(strings.NewReader(content))
+    if err != nil {
+        return textLines(content, "text/plain")
+    }
+    var line strings.Builder
+    flush := func() {
+        if text := strings.Join(strings.Fields(line.String()), " "); text != "" {
+            lines = append(lines, text)
+        }
+        line.Reset()
+    }
+    var walk func(n *html.Node)
+    walk = func(n *html.Node) {
+        switch n.Type {
+        case html.TextNode:
+            line.WriteString(n.Data)
+            return
+        case html.ElementNode:
+            switch n.Data {
+            case "head", "script", "style", "noscript", "template":
+                return
+            }
+        }
+        block := n.Type == html.ElementNode && diffBlocks[n.Data]
+        if block {
+            flush()
+        }
+        for child := n.FirstChild; child != nil; child = child.NextSibling {
+            walk(child)
+        }
+        if block {
+            flush()
+        }
+    }
+    walk(root)
+    flush()
+    return lines
+}
+
+// diffOp is a line of a diff: kept (' '), removed ('-'), or added ('+')
+type diffOp struct {
+    kind byte
+    line string
+}
+
+// diffLines is a unified diff of before and after, with diffContext lines
+// around each change, and how many lines were added and removed
+func diffLines(before, after []string) (string, int, int) {
+    // Most changes touch a small part of a page, so only what lies between
+    // the common start and end is compared
+    prefix := 0
+    for prefix < len(before) && prefix < len(after) && before[prefix] == after[prefix] {
+        prefix++
+    }
+    suffix := 0
+    for suffix < len(before)-prefix && suffix < len(after)-prefix &&
+        before[len(before)-1-suffix] == after[len(after)-1-suffix] {
+        suffix++
+    }
+
+    ops := make([]diffOp, 0, len(before)+len(after))
+    for _, line := range before[:prefix] {
+        ops = append(ops, diffOp{' ', line})
+    }
+    ops = append(ops, diffMiddle(before[prefix:len(before)-suffix], after[prefix:len(after)-suffix])...)
+    for _, line := range before[len(before)-suffix:] {
+        ops = append(ops, diffOp{' ', line})
+    }
+    return unifiedDiff(ops)
+}
+
+// diffMiddle is the shortest edit from before to after by their longest
+// common subsequence of lines
+func diffMiddle(before, after []string) []diffOp {
+    var ops []diffOp
+    if len(before)*len(after) > maxDiffCells {
+        for _, line := range before {
+            ops = append(ops, diffOp{'-', line})
+        }
+        for _, line := range after {
+            ops = append(ops, diffOp{'+', line})
+        }
+        return ops
+    }
+
+    // common[i][j] is the longest common subsequence of before[i:] and after[j:]
+    width := len(after) + 1
+    common := make([]int32, (len(before)+1)*width)
+    for i := len(before) - 1; i >= 0; i-- {
+        for j := len(after) - 1; j >= 0; j-- {
+            if before[i] == after[j] {
+                common[i*width+j] = common[(i+1)*width+j+1] + 1
+            } else {
+                common[i*width+j] = max(common[(i+1)*width+j], common[i*width+j+1])
+            }
+        }
+    }
+    i, j := 0, 0
+    for i < len(before) && j < len(after) {
+        switch {
+        case before[i] == after[j]:
+            ops = append(ops, diffOp{' ', before[i]})
+            i++
+            j++
+        case common[(i+1)*width+j] >= common[i*width+j+1]:
+            ops = append(ops, diffOp{'-', before[i]})
+            i++
+        default:
+            ops = append(ops, diffOp{'+', after[j]})
+            j++
+        }
+    }
+    for ; i < len(before); i++ {
+        ops = append(ops, diffOp{'-', before[i]})
+    }
+    for ; j < len(after); j++ {
+        ops = append(ops, diffOp{'+', after[j]})
+    }
+    return ops
+}
+
+// unifiedDiff writes ops as hunks of changes with their context, cut at
+// maxDiffSize, and counts the lines added and removed
+func unifiedDiff(ops []diffOp) (string, int, int) {
+    // Line numbers in before and after where each op starts
+    oldLines := make([]int, len(ops)+1)
+    newLines := make([]int, len(ops)+1)
+    added, removed := 0, 0
+    for k, op := range ops {
+        oldLines[k+1], newLines[k+1] = oldLines[k], newLines[k]
+        if op.kind != '+' {
+            oldLines[k+1]++
+        }
+        if op.kind != '-' {
+            newLines[k+1]++
+        }
+        switch op.kind {
+        case '+':
+            added++
+        case '-':
+            removed++
+        }
+    }
+
+    var diff strings.Builder
+    truncated := false
+    for k := 0; k < len(ops) && !truncated; {
+        for k < len(ops) && ops[k].kind == ' ' {
+            k++
+        }
+        if k == len(ops) {
+            break
+        }
+        // A hunk runs until the unchanged lines between two changes are
+        // too many to show as the context of both
+        start, end := max(k-diffContext, 0), k+1
+        for next := k + 1; next < len(ops) && next-end <= 2*diffContext; next++ {
+            if ops[next].kind != ' ' {
+                end = next + 1
+            }
+        }
+        stop := min(end+diffContext, len(ops))
+
+        oldCount, newCount := oldLines[stop]-oldLines[start], newLines[stop]-newLines[start]
+        fmt.Fprintf(&diff, "@@ -%s +%s @@\n", hunkRange(oldLines[start], oldCount), hunkRange(newLines[start], newCount))
+        for _, op := range ops[start:stop] {
+            if diff.Len()+len(op.line)+2 > maxDiffSize {
+                diff.WriteString("... diff truncated\n")
+                truncated = true
+                break
+            }
+            diff.WriteByte(op.kind)
+            diff.WriteString(op.line)
+            diff.WriteByte('\n')
+        }
+        k = stop
+    }
+    return diff.String(), added, removed
+}
+
+// hunkRange is a hunk header's start,count for count lines after line
+// before, numbered from 1, where an empty range names the line before it
+func hunkRange(before, count int) string {
+    if count == 0 {
+        return fmt.Sprintf("%d,0", before)
+    }
+    return fmt.Sprintf("%d,%d", before+1, count)
+}
@@ -0,0 +1,62 @@
+package crawler
+
+import (
+    "encoding/json"
+    "fmt"
+    "time"
+
+    "smart-crawler/models"
+)
+
+// Checkpoint is the in-memory state of a smart crawl that lives in neither
+// the frontier nor the saved pages: the running stats, and the filter of a
+// Bloom filter duplicate detector. An exact detector is restored from the
+// content hashes of the crawl's pages instead, so a checkpoint stays small
+// however many it has seen.
+type Checkpoint struct {
+    StartURL   string            `json:"start_url"`
+    MaxDepth   int               `json:"max_depth"`
+    Stats      models.CrawlStats `json:"stats"`
+    SeenFilter []byte            `json:"seen_filter,omitempty"`
+    SavedAt    time.Time         `json:"saved_at"`
+}
+
+func (s *Smart) saveCheckpoint(startURL string, maxDepth int, stats *models.CrawlStats) error {
+    seenFilter, err := s.duplicateDetector.SnapshotFilter()
+    if err != nil {
+        return err
+    }
+
+    state, err := json.Marshal(Checkpoint{
+        StartURL:   startURL,
+        MaxDepth:   maxDepth,
+        Stats:      *stats,
+        SeenFilter: seenFilter,
+        SavedAt:    time.Now(),
+    })
+    if err != nil {
+        return err
+    }
+
+    if err := s.db.SaveCheckpoint(startURL, state); err != nil {
+        return fmt.Errorf("failed to save checkpoint: %w", err)
+    }
+    return nil
+}
+
+// loadCheckpoint returns the last checkpoint for startURL, or nil if none
+func (s *Smart) loadCheckpoint(startURL string) (*Checkpoint, error) {
+    state, err := s.db.LoadCheckpoint(startURL)
+    if err != nil {
+        return nil, fmt.Errorf("failed to load checkpoint: %w", err)
+    }
+    if state == nil {
+        return nil, nil
+    }
+
+    var checkpoint Checkpoint
+    if err := json.Unmarshal(state, &checkpoint); err != nil {
+        return nil, fmt.Errorf("failed to decode checkpoint: %w", err)
+    }
+    return &checkpoint, nil
+}
@@ -0,0 +1,251 @@
+package crawler
+
+import (
+    "bufio"
+    "fmt"
+    "net/http"
+    "net/http/cookiejar"
+    "net/url"
+    "os"
+    "path/filepath"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    "golang.org/x/net/publicsuffix"
+)
+
+// CookieJar is an http.CookieJar that can be saved to and loaded from a
+// Netscape cookies file, the format curl and browser export extensions use,
+// so a crawl that logged in keeps its session across runs. The standard
+// jar does the matching; CookieJar remembers what was set so it can be
+// written out.
+type CookieJar struct {
+    jar     *cookiejar.Jar
+    entries map[string]*cookieEntry // domain;path;name -> cookie
+    mutex   sync.Mutex
+}
+
+// cookieEntry is one line of a Netscape cookies file
+type cookieEntry struct {
+    domain   string // Leading "." for a domain cookie, bare host otherwise
+    path     string
+    secure   bool
+    httpOnly bool
+    expires  time.Time // Zero for a session cookie
+    name     string
+    value    string
+}
+
+func (e *cookieEntry) key() string {
+    return e.domain + ";" + e.path + ";" + e.name
+}
+
+func (e *cookieEntry) expired(now time.Time) bool {
+    return !e.expires.IsZero() && !e.expires.After(now)
+}
+
+// NewCookieJar creates an empty jar that refuses cookies set on public
+// suffixes like "co.uk"
+func NewCookieJar() *CookieJar {
+    // cookiejar.New never fails
+    jar, _ := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+    return &CookieJar{jar: jar, entries: make(map[string]*cookieEntry)}
+}
+
+func (j *CookieJar) Cookies(u *url.URL) []*http.Cookie {
+    return j.jar.Cookies(u)
+}
+
+func (j *CookieJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+    j.jar.SetCookies(u, cookies)
+
+    j.mutex.Lock()
+    defer j.mutex.Unlock()
+
+    now := time.Now()
+    host := strings.ToLower(u.Hostname())
+    for _, cookie := range cookies {
+        entry := &cookieEntry{
+            domain:   host,
+            path:     cookie.Path,
+            secure:   cookie.Secure,
+            httpOnly: cookie.HttpOnly,
+            name:     cookie.Name,
+            value:    cookie.Value,
+        }
+        if domain := strings.ToLower(strings.TrimPrefix(cookie.Domain, ".")); domain != "" {
+            // The jar ignores cookies for domains the host is not part of
+            if domain != host && !strings.HasSuffix(host, "."+domain) {
+                continue
+            }
+            entry.domain = "." + domain
+        }
+        if !strings.HasPrefix(entry.path, "/") {
+            entry.path = defaultCookiePath(u.Path)
+        }
+
+        switch {
+        case cookie.MaxAge < 0:
+            entry.expires = now
+        case cookie.MaxAge > 0:
+            entry.expires = now.Add(time.Duration(cookie.MaxAge) * time.Second)
+        case !cookie.Expires.IsZero():
+            entry.expires = cookie.Expires
+        }
+        if entry.expired(now) {
+            delete(j.entries, entry.key())
+            continue
+        }
+        j.entries[entry.key()] = entry
+    }
+}
+
+// defaultCookiePath is the path a cookie set without one applies to, per
+// RFC 6265 section 5.1.4
+func defaultCookiePath(path string) string {
+    if path == "" || path[0] != '/' {
+        return "/"
+    }
+    i := strings.LastIndex(path, "/")
+    if i == 0 {
+        return "/"
+    }
+    return path[:i]
+}
+
+// Len returns how many unexpired cookies the jar holds
+func (j *CookieJar) Len() int {
+    j.mutex.Lock()
+    defer j.mutex.Unlock()
+
+    now := time.Now()
+    count := 0
+    for _, entry := range j.entries {
+        if !entry.expired(now) {
+            count++
+        }
+    }
+    return count
+}
+
+// Load adds the cookies in a Netscape cookies file to the jar, skipping
+// expired ones. Lines prefixed "#HttpOnly_" are HttpOnly cookies; other
+// lines starting with "#" are comments.
+func (j *CookieJar) Load(path string) error {
+    file, err := os.Open(path)
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+
+    now := time.Now()
+    scanner := bufio.NewScanner(file)
+    for lineNum := 1; scanner.Scan(); lineNum++ {
+        line := strings.TrimRight(scanner.Text(), "\r")
+        httpOnly := strings.HasPrefix(line, "#HttpOnly_")
+        if httpOnly {
+            line = strings.TrimPrefix(line, "#HttpOnly_")
+        }
+        if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+            continue
+        }
+
+        fields := strings.Split(line, "\t")
+        if len(fields) != 7 {
+            return fmt.Errorf("%s:%d: expected 7 tab-separated fields, got %d", path, lineNum, len(fields))
+        }
+        expiresUnix, err := strconv.ParseInt(fields[4], 10, 64)
+        if err != nil {
+            return fmt.Errorf("%s:%d: invalid expiry %q", path, lineNum, fields[4])
+        }
+
+        domain := strings.ToLower(fields[0])
+        cookie := &http.Cookie{
+            Name:     fields[5],
+            Value:    fields[6],
+            Path:     fields[2],
+            Secure:   strings.EqualFold(fields[3], "TRUE"),
+            HttpOnly: httpOnly,
+        }
+        // The include-subdomains flag and the leading dot say the same thing
+        if strings.HasPrefix(domain, ".") || strings.EqualFold(fields[1], "TRUE") {
+            domain = strings.TrimPrefix(domain, ".")
+            cookie.Domain = domain
+        }
+        if expiresUnix > 0 {
+            cookie.Expires = time.Unix(expiresUnix, 0)
+            if !cookie.Expires.After(now) {
+                continue
+            }
+        }
+
+        scheme := "http"
+        if cookie.Secure {
+            scheme = "https"
+        }
+        j.SetCookies(&url.URL{Scheme: scheme, Host: domain, Path: cookie.Path}, []*http.Cookie{cookie})
+    }
+    return scanner.Err()
+}
+
+// Save writes the jar's unexpired cookies, session cookies included, to a
+// Netscape cookies file. Session cookies are written with expiry 0.
+func (j *CookieJar) Save(path string) error {
+    j.mutex.Lock()
+    now := time.Now()
+    entries := make([]*cookieEntry, 0, len(j.entries))
+    for _, entry := range j.entries {
+        if !entry.expired(now) {
+            entries = append(entries, entry)
+        }
+    }
+    j.mutex.Unlock()
+    sort.Slice(entries, func(a, b int) bool { return entries[a].key() < entries[b].key() })
+
+    // Write beside the file and rename, so a crash never leaves it half
+    // written
+    tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+    if err != nil {
+        return err
+    }
+    defer os.Remove(tmp.Name())
+
+    writer := bufio.NewWriter(tmp)
+    fmt.Fprintln(writer, "# Netscape HTTP Cookie File")
+    for _, entry := range entries {
+        prefix := ""
+        if entry.httpOnly {
+            prefix = "#HttpOnly_"
+        }
+        var expires int64
+        if !entry.expires.IsZero() {
+            expires = entry.expires.Unix()
+        }
+        fmt.Fprintf(writer, "%s%s\t%s\t%s\t%s\t%d\t%s\t%s\n", prefix, entry.domain,
+            netscapeBool(strings.HasPrefix(entry.domain, ".")), entry.path, netscapeBool(entry.secure),
+            expires, entry.name, entry.value)
+    }
+    if err := writer.Flush(); err != nil {
+        tmp.Close()
+        return err
+    }
+    // Cookies can be credentials
+    if err := tmp.Chmod(0600); err != nil {
+        tmp.Close()
+        return err
+    }
+    if err := tmp.Close(); err != nil {
+        return err
+    }
+    return os.Rename(tmp.Name(), path)
+}
+
+func netscapeBool(b bool) string {
+    if b {
+        return "TRUE"
+    }
+    return "FALSE"
+}
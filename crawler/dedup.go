@@ -0,0 +1,138 @@
+package crawler
+
+import (
+    "container/list"
+    "hash/fnv"
+    "strings"
+    "sync"
+    "unicode"
+
+    "smart-crawler/database"
+)
+
+// DefaultDedupCacheSize is how many content hashes a persistent duplicate
+// detector keeps in memory by default
+const DefaultDedupCacheSize = 100000
+
+// NewPersistentDuplicateDetector records content hashes in db, so duplicates
+// are recognized across restarts, recrawls, and crawler instances sharing the
+// database. The most recently seen cacheSize hashes are also kept in memory
+// to spare a query for repeats.
+func NewPersistentDuplicateDetector(db database.Store, cacheSize int) *DuplicateDetector {
+    if cacheSize <= 0 {
+        cacheSize = DefaultDedupCacheSize
+    }
+    return &DuplicateDetector{
+        store: db,
+        cache: newHashCache(cacheSize),
+    }
+}
+
+// Check reports whether the content with this hash was seen before, and if
+// so the crawl that first saved it, recording it otherwise. An in-memory
+// detector only knows the running crawl. A persistent one also stores the
+// simhash of text, for near-duplicate analysis.
+func (dd *DuplicateDetector) Check(crawlID int64, url, hash, text string) (bool, int64, error) {
+    if dd.store == nil {
+        return dd.IsDuplicate(hash), crawlID, nil
+    }
+
+    if firstCrawlID, ok := dd.cache.get(hash); ok {
+        return true, firstCrawlID, nil
+    }
+    claimed, firstCrawlID, err := dd.store.ClaimContentHash(crawlID, url, hash, int64(simHash(text)))
+    if err != nil {
+        return false, crawlID, err
+    }
+    dd.cache.add(hash, firstCrawlID)
+    return !claimed, firstCrawlID, nil
+}
+
+// simHash fingerprints text so that similar texts differ in few bits: each
+// three-word shingle votes on every bit by its own hash, and the majority
+// wins.
+func simHash(text string) uint64 {
+    words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+        return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+    })
+    if len(words) == 0 {
+        return 0
+    }
+
+    const shingle = 3
+    var votes [64]int
+    for i := 0; i+shingle <= len(words) || i == 0; i++ {
+        end := i + shingle
+        if end > len(words) {
+            end = len(words)
+        }
+        hash := fnv.New64a()
+        hash.Write([]byte(strings.Join(words[i:end], " ")))
+        feature := hash.Sum64()
+        for bit := 0; bit < 64; bit++ {
+            if feature&(1<<bit) != 0 {
+                votes[bit]++
+            } else {
+                votes[bit]--
+            }
+        }
+    }
+
+    var fingerprint uint64
+    for bit, vote := range votes {
+        if vote > 0 {
+            fingerprint |= 1 << bit
+        }
+    }
+    return fingerprint
+}
+
+// hashCache is a least-recently-used map of content hashes to the crawl
+// that first saved them
+type hashCache struct {
+    capacity int
+    order    *list.List // Front is most recent
+    entries  map[string]*list.Element
+    mutex    sync.Mutex
+}
+
+type hashCacheEntry struct {
+    hash    string
+    crawlID int64
+}
+
+func newHashCache(capacity int) *hashCache {
+    return &hashCache{
+        capacity: capacity,
+        order:    list.New(),
+        entries:  make(map[string]*list.Element),
+    }
+}
+
+func (c *hashCache) get(hash string) (int64, bool) {
+    c.mutex.Lock()
+    defer c.mutex.Unlock()
+
+    element, ok := c.entries[hash]
+    if !ok {
+        return 0, false
+    }
+    c.order.MoveToFront(element)
+    return element.Value.(*hashCacheEntry).crawlID, true
+}
+
+func (c *hashCache) add(hash string, crawlID int64) {
+    c.mutex.Lock()
+    defer c.mutex.Unlock()
+
+    if element, ok := c.entries[hash]; ok {
+        c.order.MoveToFront(element)
+        return
+    }
+    c.entries[hash] = c.order.PushFront(&hashCacheEntry{hash: hash, crawlID: crawlID})
+    if c.order.Len() > c.capacity {
+        oldest := c.order.Back()
+        c.order.Remove(oldest)
+        delete(c.entries, oldest.Value.(*hashCacheEntry).hash)
+    }
+}
@@ -0,0 +1,474 @@
+package crawler
+
+import (
+    "bufio"
+    "context"
+    "encoding/binary"
+    "errors"
+    "io"
+    "math/rand"
+    "net"
+    "net/http/httptrace"
+    "net/netip"
+    "os"
+    "strings"
+    "sync"
+    "time"
+
+    "golang.org/x/net/dns/dnsmessage"
+)
+
+// DNSOptions configures a DNSCache
+type DNSOptions struct {
+    // Servers are the nameservers ("host" or "host:port") asked directly, so
+    // answers come with their TTL. Empty reads them from /etc/resolv.conf.
+    // Names they cannot answer, and every name where there are none (as on
+    // Windows), go to the system resolver, whose answers are kept for
+    // systemDNSTTL.
+    Servers []string
+    // Bounds on how long an answer is kept, whatever its TTL
+    MinTTL time.Duration
+    MaxTTL time.Duration
+    // How long a name that does not resolve is remembered as such; 0 looks
+    // it up again every time
+    NegativeTTL time.Duration
+}
+
+// DefaultDNSOptions keeps answers for their TTL, but at least 5 seconds and
+// at most an hour, and names that do not resolve for a minute
+var DefaultDNSOptions = DNSOptions{
+    MinTTL:      5 * time.Second,
+    MaxTTL:      time.Hour,
+    NegativeTTL: time.Minute,
+}
+
+const (
+    // How long answers of the system resolver, which does not report TTLs,
+    // are kept, within MinTTL and MaxTTL
+    systemDNSTTL = 5 * time.Minute
+    // How long a lookup that failed without an answer, e.g. timed out, is
+    // remembered, at most NegativeTTL
+    dnsFailureTTL = 5 * time.Second
+    // Wait for one nameserver's answer before asking the next
+    dnsQueryTimeout = 3 * time.Second
+    // Names cached before expired answers are dropped to make room
+    maxDNSEntries = 100000
+    // Lookups prefetching runs at once
+    dnsPrefetchers = 8
+)
+
+// SetDNSPrefetch resolves the hosts of URLs as they are claimed from the
+// frontier, while they wait for a worker, so that fetching them does not
+// start with a lookup. It needs WithDNSCache.
+func (s *Smart) SetDNSPrefetch(enabled bool) {
+    s.dnsPrefetch = enabled
+}
+
+// DNSCache resolves the hostnames the crawlers connect to and caches the
+// answers for their TTL, so a crawl does not look up the same host before
+// each of its requests. Names that do not resolve are cached too, so the
+// queued URLs of a dead domain fail at once. Concurrent lookups of one name
+// share a query. It is safe for concurrent use, and one cache may be shared
+// by several crawlers.
+type DNSCache struct {
+    opts    DNSOptions
+    servers []string
+    dialer  *net.Dialer
+
+    mutex   sync.Mutex
+    entries map[string]*dnsEntry
+
+    prefetching chan struct{}
+}
+
+// dnsEntry is a cached lookup, or one under way until ready is closed
+type dnsEntry struct {
+    ready   chan struct{}
+    addrs   []netip.Addr
+    err     error
+    expires time.Time
+}
+
+// NewDNSCache returns a cache resolving through opts.Servers, or the
+// nameservers of /etc/resolv.conf when none are given
+func NewDNSCache(opts DNSOptions) *DNSCache {
+    servers := append([]string(nil), opts.Servers...)
+    if len(servers) == 0 {
+        servers = systemNameservers()
+    }
+    for i, server := range servers {
+        if _, _, err := net.SplitHostPort(server); err != nil {
+            servers[i] = net.JoinHostPort(strings.Trim(server, "[]"), "53")
+        }
+    }
+    return &DNSCache{
+        opts:        opts,
+        servers:     servers,
+        dialer:      &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second},
+        entries:     make(map[string]*dnsEntry),
+        prefetching: make(chan struct{}, dnsPrefetchers),
+    }
+}
+
+// systemNameservers reads the nameservers of /etc/resolv.conf
+func systemNameservers() []string {
+    file, err := os.Open("/etc/resolv.conf")
+    if err != nil {
+        return nil
+    }
+    defer file.Close()
+
+    var servers []string
+    scanner := bufio.NewScanner(file)
+    for scanner.Scan() {
+        fields := strings.Fields(scanner.Text())
+        if len(fields) >= 2 && fields[0] == "nameserver" {
+            servers = append(servers, fields[1])
+        }
+    }
+    return servers
+}
+
+// Lookup returns the addresses of host, IPv4 first, from the cache or by
+// resolving it
+func (c *DNSCache) Lookup(ctx context.Context, host string) ([]netip.Addr, error) {
+    host = strings.ToLower(strings.TrimSuffix(host, "."))
+    now := time.Now()
+
+    c.mutex.Lock()
+    entry := c.entries[host]
+    if entry != nil {
+        select {
+        case <-entry.ready:
+            if now.After(entry.expires) {
+                entry = nil
+            }
+        default:
+        }
+    }
+    if entry == nil {
+        entry = &dnsEntry{ready: make(chan struct{})}
+        c.evict(now)
+        c.entries[host] = entry
+        // Not cut short by the first caller giving up, as others may wait
+        go c.resolve(context.WithoutCancel(ctx), host, entry)
+    }
+    c.mutex.Unlock()
+
+    select {
+    case <-entry.ready:
+        return entry.addrs, entry.err
+    case <-ctx.Done():
+        return nil, ctx.Err()
+    }
+}
+
+// evict drops expired answers once the cache is full, then any answers if
+// it still is
+func (c *DNSCache) evict(now time.Time) {
+    if len(c.entries) < maxDNSEntries {
+        return
+    }
+    for host, entry := range c.entries {
+        select {
+        case <-entry.ready:
+            if now.After(entry.expires) {
+                delete(c.entries, host)
+            }
+        default:
+        }
+    }
+    for host := range c.entries {
+        if len(c.entries) < maxDNSEntries {
+            break
+        }
+        delete(c.entries, host)
+    }
+}
+
+// resolve looks host up and settles entry
+func (c *DNSCache) resolve(ctx context.Context, host string, entry *dnsEntry) {
+    ttl := time.Duration(0)
+    if len(c.servers) > 0 && strings.Contains(host, ".") {
+        entry.addrs, ttl, entry.err = c.query(ctx, host)
+    }
+    if len(entry.addrs) == 0 {
+        // The system resolver also reads the hosts file, and knows names
+        // without a dot
+        entry.addrs, entry.err = net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+        ttl = systemDNSTTL
+    }
+
+    switch {
+    case entry.err == nil && len(entry.addrs) > 0:
+        ttl = max(ttl, c.opts.MinTTL)
+        if c.opts.MaxTTL > 0 {
+            ttl = min(ttl, c.opts.MaxTTL)
+        }
+        sortAddrs(entry.addrs)
+    case isNotFound(entry.err) || entry.err == nil:
+        entry.addrs = nil
+        entry.err = &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+        ttl = c.opts.NegativeTTL
+    default:
+        ttl = min(dnsFailureTTL, c.opts.NegativeTTL)
+    }
+    entry.expires = time.Now().Add(ttl)
+    close(entry.ready)
+}
+
+func isNotFound(err error) bool {
+    var dnsErr *net.DNSError
+    return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
+
+// sortAddrs puts IPv4 addresses first, as hosts without IPv6 routes are
+// still common
+func sortAddrs(addrs []netip.Addr) {
+    v4 := 0
+    for i, addr := range addrs {
+        if addr.Unmap().Is4() {
+            addrs[v4], addrs[i] = addrs[i], addrs[v4]
+            v4++
+        }
+    }
+}
+
+// query asks the nameservers in turn for host's A and AAAA records, and
+// returns the addresses with the shortest TTL of the answers
+func (c *DNSCache) query(ctx context.Context, host string) ([]netip.Addr, time.Duration, error) {
+    name, err := dnsmessage.NewName(host + ".")
+    if err != nil {
+        return nil, 0, err
+    }
+
+    var lastErr error
+    for _, server := range c.servers {
+        type answer struct {
+            addrs []netip.Addr
+            ttl   time.Duration
+            err   error
+        }
+        answers := make(chan answer, 2)
+        for _, qtype := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+            go func() {
+                addrs, ttl, err := exchange(ctx, server, name, qtype)
+                answers <- answer{addrs, ttl, err}
+            }()
+        }
+
+        var addrs []netip.Addr
+        ttl := time.Duration(-1)
+        notFound := 0
+        lastErr = nil
+        for range 2 {
+            a := <-answers
+            switch {
+            case isNotFound(a.err):
+                notFound++
+            case a.err != nil:
+                lastErr = a.err
+            default:
+                addrs = append(addrs, a.addrs...)
+                if len(a.addrs) > 0 && (ttl < 0 || a.ttl < ttl) {
+                    ttl = a.ttl
+                }
+            }
+        }
+        if len(addrs) > 0 {
+            return addrs, ttl, nil
+        }
+        if notFound == 2 {
+            return nil, 0, &net.DNSError{Err: "no such host", Name: host, Server: server, IsNotFound: true}
+        }
+        // Without records of either type the name has no address
+        if lastErr == nil {
+            return nil, 0, nil
+        }
+    }
+    return nil, 0, lastErr
+}
+
+// exchange sends one question to server over UDP, or over TCP when the
+// answer does not fit a datagram, and returns the addresses answered with
+// the shortest TTL of the answer records
+func exchange(ctx context.Context, server string, name dnsmessage.Name, qtype dnsmessage.Type) ([]netip.Addr, time.Duration, error) {
+    id := uint16(rand.Intn(1 << 16))
+    question, err := (&dnsmessage.Message{
+        Header:    dnsmessage.Header{ID: id, RecursionDesired: true},
+        Questions: []dnsmessage.Question{{Name: name, Type: qtype, Class: dnsmessage.ClassINET}},
+    }).Pack()
+    if err != nil {
+        return nil, 0, err
+    }
+
+    ctx, cancel := context.WithTimeout(ctx, dnsQueryTimeout)
+    defer cancel()
+    reply, err := roundTrip(ctx, "udp", server, question)
+    if err != nil {
+        return nil, 0, err
+    }
+    var msg dnsmessage.Message
+    if err := msg.Unpack(reply); err != nil || msg.Header.Truncated {
+        if reply, err = roundTrip(ctx, "tcp", server, question); err != nil {
+            return nil, 0, err
+        }
+        if err := msg.Unpack(reply); err != nil {
+            return nil, 0, err
+        }
+    }
+    if msg.Header.ID != id || !msg.Header.Response {
+        return nil, 0, errors.New("mismatched DNS reply")
+    }
+
+    switch msg.Header.RCode {
+    case dnsmessage.RCodeSuccess:
+    case dnsmessage.RCodeNameError:
+        return nil, 0, &net.DNSError{Err: "no such host", Name: name.String(), Server: server, IsNotFound: true}
+    default:
+        return nil, 0, &net.DNSError{Err: "server answered " + msg.Header.RCode.String(), Name: name.String(), Server: server, IsTemporary: true}
+    }
+
+    var addrs []netip.Addr
+    ttl := time.Duration(-1)
+    for _, record := range msg.Answers {
+        // CNAMEs on the way count towards the TTL too
+        if recordTTL := time.Duration(record.Header.TTL) * time.Second; ttl < 0 || recordTTL < ttl {
+            ttl = recordTTL
+        }
+        switch body := record.Body.(type) {
+        case *dnsmessage.AResource:
+            addrs = append(addrs, netip.AddrFrom4(body.A))
+        case *dnsmessage.AAAAResource:
+            addrs = append(addrs, netip.AddrFrom16(body.AAAA))
+        }
+    }
+    return addrs, max(ttl, 0), nil
+}
+
+// roundTrip sends a DNS message to server and reads the reply, framed with
+// a length over TCP
+func roundTrip(ctx context.Context, network, server string, msg []byte) ([]byte, error) {
+    var dialer net.Dialer
+    conn, err := dialer.DialContext(ctx, network, server)
+    if err != nil {
+        return nil, err
+    }
+    defer conn.Close()
+    if deadline, ok := ctx.Deadline(); ok {
+        conn.SetDeadline(deadline)
+    }
+
+    if network == "udp" {
+        if _, err := conn.Write(msg); err != nil {
+            return nil, err
+        }
+        reply := make([]byte, 4096)
+        n, err := conn.Read(reply)
+        return reply[:n], err
+    }
+
+    framed := binary.BigEndian.AppendUint16(nil, uint16(len(msg)))
+    if _, err := conn.Write(append(framed, msg...)); err != nil {
+        return nil, err
+    }
+    var length [2]byte
+    if _, err := io.ReadFull(conn, length[:]); err != nil {
+        return nil, err
+    }
+    reply := make([]byte, binary.BigEndian.Uint16(length[:]))
+    _, err = io.ReadFull(conn, reply)
+    return reply, err
+}
+
+// DialContext connects to address through the cache, trying each of the
+// host's addresses in turn. Use it as an http.Transport's DialContext.
+func (c *DNSCache) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+    host, port, err := net.SplitHostPort(address)
+    if err != nil {
+        return c.dialer.DialContext(ctx, network, address)
+    }
+    if _, err := netip.ParseAddr(host); err == nil {
+        return c.dialer.DialContext(ctx, network, address)
+    }
+
+    addrs, err := c.lookupTraced(ctx, host)
+    if err != nil {
+        return nil, &net.OpError{Op: "dial", Net: network, Err: err}
+    }
+    var firstErr error
+    for _, addr := range addrs {
+        if (network == "tcp4" && !addr.Unmap().Is4()) || (network == "tcp6" && addr.Unmap().Is4()) {
+            continue
+        }
+        conn, err := c.dialer.DialContext(ctx, network, net.JoinHostPort(addr.String(), port))
+        if err == nil {
+            return conn, nil
+        }
+        if firstErr == nil {
+            firstErr = err
+        }
+        if ctx.Err() != nil {
+            break
+        }
+    }
+    if firstErr == nil {
+        firstErr = &net.OpError{Op: "dial", Net: network, Err: &net.DNSError{Err: "no suitable address", Name: host}}
+    }
+    return nil, firstErr
+}
+
+// lookupTraced is Lookup reporting to the httptrace.ClientTrace of ctx, as
+// the system resolver does when net/http dials
+func (c *DNSCache) lookupTraced(ctx context.Context, host string) ([]netip.Addr, error) {
+    trace := httptrace.ContextClientTrace(ctx)
+    if trace != nil && trace.DNSStart != nil {
+        trace.DNSStart(httptrace.DNSStartInfo{Host: host})
+    }
+    addrs, err := c.Lookup(ctx, host)
+    if trace != nil && trace.DNSDone != nil {
+        ips := make([]net.IPAddr, len(addrs))
+        for i, addr := range addrs {
+            ips[i] = net.IPAddr{IP: addr.AsSlice(), Zone: addr.Zone()}
+        }
+        trace.DNSDone(httptrace.DNSDoneInfo{Addrs: ips, Err: err})
+    }
+    return addrs, err
+}
+
+// Prefetch starts resolving host in the background unless it is cached or
+// being resolved, or dnsPrefetchers lookups are under way already, so the
+// fetch that needs it does not wait on the lookup
+func (c *DNSCache) Prefetch(host string) {
+    if h, _, err := net.SplitHostPort(host); err == nil {
+        host = h
+    }
+    if _, err := netip.ParseAddr(host); err == nil || host == "" {
+        return
+    }
+    host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+    c.mutex.Lock()
+    entry := c.entries[host]
+    c.mutex.Unlock()
+    if entry != nil {
+        select {
+        case <-entry.ready:
+            if time.Now().Before(entry.expires) {
+                return
+            }
+        default:
+            return
+        }
+    }
+
+    select {
+    case c.prefetching <- struct{}{}:
+    default:
+        return
+    }
+    go func() {
+        defer func() { <-c.prefetching }()
+        c.Lookup(context.Background(), host)
+    }()
+}
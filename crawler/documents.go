@@ -0,0 +1,207 @@
+package crawler
+
+import (
+    "archive/zip"
+    "bytes"
+    "context"
+    "encoding/xml"
+    "errors"
+    "fmt"
+    "io"
+    "path"
+    "strings"
+
+    "github.com/ledongthuc/pdf"
+
+    "smart-crawler/utils"
+)
+
+// The media type of Word documents
+const docxMediaType = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+
+// Most a part of a Word document is unpacked to, so a zip bomb cannot
+// exhaust memory
+const maxDocxPartSize = 64 << 20
+
+// DocumentFormats are the document formats a smart crawl follows links to
+// and extracts the text of
+type DocumentFormats struct {
+    PDF  bool
+    DOCX bool
+}
+
+// ParseDocumentFormats parses a comma-separated list of document formats,
+// "pdf" and "docx"
+func ParseDocumentFormats(list string) (DocumentFormats, error) {
+    var formats DocumentFormats
+    for _, format := range strings.Split(list, ",") {
+        format = strings.ToLower(strings.TrimSpace(format))
+        switch format {
+        case "":
+        case "pdf":
+            formats.PDF = true
+        case "docx":
+            formats.DOCX = true
+        default:
+            return formats, fmt.Errorf("unknown document format %q; use pdf or docx", format)
+        }
+    }
+    return formats, nil
+}
+
+// SetDocuments makes the crawl follow links to documents of formats, which
+// crawls otherwise skip, and save them as pages whose content is their
+// text, keeping their content type. A document whose text cannot be
+// extracted, such as an encrypted or truncated one, is saved without it.
+func (s *Smart) SetDocuments(formats DocumentFormats) {
+    s.documents = formats
+    if formats.PDF {
+        s.handlers.Register("application/pdf", s.documentHandler(pdfText))
+    }
+    if formats.DOCX {
+        s.handlers.Register(docxMediaType, s.documentHandler(docxText))
+    }
+}
+
+// followsDocument reports whether the crawl fetches the document at rawURL
+func (s *Smart) followsDocument(rawURL string) bool {
+    if !utils.IsValidURLFor(rawURL, utils.URLKinds{Documents: true}) {
+        return false
+    }
+    lower := strings.ToLower(rawURL)
+    return s.documents.PDF && strings.Contains(lower, ".pdf") || s.documents.DOCX && strings.Contains(lower, ".docx")
+}
+
+// documentHandler stores the text extract takes out of a document, titled
+// by its metadata or else its file name
+func (s *Smart) documentHandler(extract func(body []byte) (title, text string, err error)) ContentHandler {
+    return ContentHandlerFunc(func(content *Content) (*HandledContent, error) {
+        handled := &HandledContent{Title: path.Base(content.URL)}
+        title, text, err := extract(content.Body)
+        if err != nil {
+            ctx := content.Context
+            if ctx == nil {
+                ctx = context.Background()
+            }
+            s.emit(ctx, Event{Type: ErrorOccurred, URL: content.URL, Err: fmt.Errorf("extracting text: %w", err)})
+            return handled, nil
+        }
+        // Text columns take neither NUL bytes nor invalid UTF-8
+        text = strings.ToValidUTF8(strings.ReplaceAll(text, "\x00", ""), "")
+        if title = strings.TrimSpace(strings.ToValidUTF8(title, "")); title != "" {
+            handled.Title = title
+        }
+        handled.Text = text
+        words := strings.Fields(text)
+        handled.PlainText = strings.Join(words[:min(len(words), plainTextWords)], " ")
+        return handled, nil
+    })
+}
+
+// pdfText is the text of a PDF's pages and the title in its metadata
+func pdfText(body []byte) (title, text string, err error) {
+    // The parser panics on some malformed files
+    defer func() {
+        if r := recover(); r != nil {
+            err = fmt.Errorf("malformed PDF: %v", r)
+        }
+    }()
+    reader, err := pdf.NewReader(bytes.NewReader(body), int64(len(body)))
+    if err != nil {
+        return "", "", err
+    }
+    plain, err := reader.GetPlainText()
+    if err != nil {
+        return "", "", err
+    }
+    var buf strings.Builder
+    if _, err := io.Copy(&buf, plain); err != nil {
+        return "", "", err
+    }
+    return reader.Trailer().Key("Info").Key("Title").Text(), buf.String(), nil
+}
+
+// docxText is the text of a Word document's paragraphs, one per line, and
+// the title in its properties
+func docxText(body []byte) (title, text string, err error) {
+    archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+    if err != nil {
+        return "", "", err
+    }
+    document, err := docxPart(archive, "word/document.xml")
+    if err != nil {
+        return "", "", err
+    }
+    if document == nil {
+        return "", "", errors.New("not a Word document: no word/document.xml")
+    }
+
+    var buf strings.Builder
+    decoder := xml.NewDecoder(bytes.NewReader(document))
+    inText := false
+    for {
+        token, err := decoder.Token()
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            return "", "", err
+        }
+        switch t := token.(type) {
+        case xml.StartElement:
+            switch t.Name.Local {
+            case "t":
+                inText = true
+            case "tab":
+                buf.WriteByte('\t')
+            case "br", "cr":
+                buf.WriteByte('\n')
+            }
+        case xml.EndElement:
+            switch t.Name.Local {
+            case "t":
+                inText = false
+            case "p":
+                buf.WriteByte('\n')
+            }
+        case xml.CharData:
+            if inText {
+                buf.Write(t)
+            }
+        }
+    }
+
+    if core, err := docxPart(archive, "docProps/core.xml"); err == nil && core != nil {
+        var properties struct {
+            Title string `xml:"title"`
+        }
+        if xml.Unmarshal(core, &properties) == nil {
+            title = properties.Title
+        }
+    }
+    return title, buf.String(), nil
+}
+
+// docxPart is the unpacked part of a Word document at name, or nil if it
+// has none
+func docxPart(archive *zip.Reader, name string) ([]byte, error) {
+    for _, file := range archive.File {
+        if file.Name != name {
+            continue
+        }
+        part, err := file.Open()
+        if err != nil {
+            return nil, err
+        }
+        defer part.Close()
+        data, err := io.ReadAll(io.LimitReader(part, maxDocxPartSize+1))
+        if err != nil {
+            return nil, err
+        }
+        if len(data) > maxDocxPartSize {
+            return nil, fmt.Errorf("%s is larger than %d bytes unpacked", name, maxDocxPartSize)
+        }
+        return data, nil
+    }
+    return nil, nil
+}
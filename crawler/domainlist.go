@@ -0,0 +1,222 @@
+package crawler
+
+import (
+    "bufio"
+    "context"
+    "fmt"
+    "io"
+    "net"
+    "net/http"
+    "net/url"
+    "os"
+    "strings"
+    "time"
+    "unicode/utf8"
+
+    "golang.org/x/net/idna"
+)
+
+// Most bytes read of a domain list fetched over HTTP
+const maxDomainListSize = 64 << 20
+
+// Names hosts files map to themselves rather than block
+var hostsFileNames = map[string]bool{
+    "localhost": true, "localhost.localdomain": true, "local": true, "broadcasthost": true,
+    "ip6-localhost": true, "ip6-loopback": true, "ip6-localnet": true, "ip6-mcastprefix": true,
+    "ip6-allnodes": true, "ip6-allrouters": true, "ip6-allhosts": true, "0.0.0.0": true,
+}
+
+// DomainList is a set of domains, each standing for itself and every
+// subdomain: "example.com" matches example.com and ads.example.com. A host
+// is looked up by its own name and then each parent domain, one hash lookup
+// per label, however long the list. Each domain remembers the list it came
+// from, for counting what each list filtered.
+type DomainList struct {
+    domains map[string]int // Domain to the index of its source
+    sources []string
+}
+
+func NewDomainList() *DomainList {
+    return &DomainList{domains: make(map[string]int)}
+}
+
+// LoadDomainList reads domain lists from files and http(s) URLs. Each line
+// names a domain, as a plain domain, a hosts file entry like
+// "0.0.0.0 ads.example.com", or an Adblock rule like "||ads.example.com^".
+// Blank lines, comments, and lines of other rules are skipped. A nil client
+// fetches with a 30 second timeout.
+func LoadDomainList(ctx context.Context, client *http.Client, sources ...string) (*DomainList, error) {
+    if client == nil {
+        client = &http.Client{Timeout: 30 * time.Second}
+    }
+    list := NewDomainList()
+    for _, source := range sources {
+        if err := list.load(ctx, client, source); err != nil {
+            return nil, fmt.Errorf("domain list %s: %w", source, err)
+        }
+    }
+    return list, nil
+}
+
+func (l *DomainList) load(ctx context.Context, client *http.Client, source string) error {
+    if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+        file, err := os.Open(source)
+        if err != nil {
+            return err
+        }
+        defer file.Close()
+        return l.Read(file, source)
+    }
+
+    req, err := http.NewRequestWithContext(ctx, "GET", source, nil)
+    if err != nil {
+        return err
+    }
+    resp, err := client.Do(req)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode != http.StatusOK {
+        return fmt.Errorf("fetching the list: %s", resp.Status)
+    }
+    return l.Read(io.LimitReader(resp.Body, maxDomainListSize), source)
+}
+
+// Read adds the domains of a list in any of the formats LoadDomainList
+// reads, under source
+func (l *DomainList) Read(r io.Reader, source string) error {
+    scanner := bufio.NewScanner(r)
+    scanner.Buffer(make([]byte, 64<<10), 1<<20)
+    for scanner.Scan() {
+        for _, domain := range listLineDomains(scanner.Text()) {
+            l.Add(domain, source)
+        }
+    }
+    return scanner.Err()
+}
+
+// Add puts domain and its subdomains on the list, counted under source.
+// Names that are not domains are ignored.
+func (l *DomainList) Add(domain, source string) {
+    domain = domainKey(strings.TrimPrefix(strings.TrimPrefix(domain, "*"), "."))
+    if domain == "" {
+        return
+    }
+    if _, ok := l.domains[domain]; ok {
+        return
+    }
+    index := len(l.sources) - 1
+    if index < 0 || l.sources[index] != source {
+        l.sources = append(l.sources, source)
+        index++
+    }
+    l.domains[domain] = index
+}
+
+// Len is how many domains are on the list
+func (l *DomainList) Len() int {
+    if l == nil {
+        return 0
+    }
+    return len(l.domains)
+}
+
+// match finds the most specific domain of the list that host is or is under,
+// returning the list it came from and its length
+func (l *DomainList) match(host string) (string, int, bool) {
+    if l.Len() == 0 {
+        return "", 0, false
+    }
+    // IP addresses only match themselves
+    if net.ParseIP(host) != nil {
+        index, ok := l.domains[host]
+        if !ok {
+            return "", 0, false
+        }
+        return l.sources[index], len(host), true
+    }
+    for domain := host; ; {
+        if index, ok := l.domains[domain]; ok {
+            return l.sources[index], len(domain), true
+        }
+        dot := strings.IndexByte(domain, '.')
+        if dot < 0 {
+            return "", 0, false
+        }
+        domain = domain[dot+1:]
+    }
+}
+
+// listLineDomains is the domains a line of a domain list names
+func listLineDomains(line string) []string {
+    line = strings.TrimSpace(line)
+    // "#" comments lines of plain lists and hosts files; "!" and "[" start
+    // comments and headers of Adblock lists
+    if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "!") || strings.HasPrefix(line, "[") {
+        return nil
+    }
+    if i := strings.Index(line, " #"); i >= 0 {
+        line = line[:i]
+    }
+
+    // ||ads.example.com^ blocks the domain; rules with paths, wildcards, or
+    // options limiting where they apply, and exceptions, are not domains
+    if rule, ok := strings.CutPrefix(line, "||"); ok {
+        domain, rest, _ := strings.Cut(rule, "^")
+        if strings.ContainsAny(domain, "/*") || rest != "" && rest != "$important" {
+            return nil
+        }
+        return []string{domain}
+    }
+
+    fields := strings.Fields(line)
+    if len(fields) > 1 && net.ParseIP(fields[0]) != nil {
+        var domains []string
+        for _, name := range fields[1:] {
+            if !hostsFileNames[strings.ToLower(name)] {
+                domains = append(domains, name)
+            }
+        }
+        return domains
+    }
+    if len(fields) != 1 {
+        return nil
+    }
+    if strings.Contains(fields[0], "://") {
+        u, err := url.Parse(fields[0])
+        if err != nil {
+            return nil
+        }
+        return []string{u.Hostname()}
+    }
+    return fields
+}
+
+// domainKey is how a domain or host is looked up: lowercase ASCII, without
+// a trailing dot; "" when it is not a host name
+func domainKey(name string) string {
+    name = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), ".")
+    if name == "" {
+        return ""
+    }
+    if net.ParseIP(name) != nil {
+        return name
+    }
+    ascii := name
+    if strings.IndexFunc(name, func(r rune) bool { return r >= utf8.RuneSelf }) >= 0 {
+        var err error
+        if ascii, err = idna.Lookup.ToASCII(name); err != nil {
+            return ""
+        }
+    }
+    for _, r := range ascii {
+        if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '.' || r == '_') {
+            return ""
+        }
+    }
+    if strings.HasPrefix(ascii, ".") || strings.Contains(ascii, "..") {
+        return ""
+    }
+    return ascii
+}
@@ -0,0 +1,75 @@
+package crawler
+
+import (
+    "context"
+    "fmt"
+    "sync"
+    "time"
+
+    "smart-crawler/models"
+)
+
+// DefaultDrainTimeout is how long fetches under way when a smart crawl is
+// stopped are given to finish
+const DefaultDrainTimeout = 10 * time.Second
+
+// ReleasingFrontier is a Frontier that can hand back claimed URLs, which the
+// smart crawler does with those it has not fetched when it is stopped
+type ReleasingFrontier interface {
+    Frontier
+    // Release returns claimed URLs to the queue as pending, for this or
+    // another crawler to claim again, and returns how many it returned
+    Release(urls []string) (int, error)
+}
+
+func (f *dbFrontier) Release(urls []string) (int, error) {
+    return f.db.ReleaseURLs(f.crawlID, urls)
+}
+
+// SetDrainTimeout sets how long fetches under way when the crawl's context
+// is cancelled may take to finish. Their pages are saved as usual. URLs
+// claimed from the frontier but not yet fetched, and fetches the timeout
+// cuts off, are returned to a ReleasingFrontier, so a resumed crawl or
+// another instance picks them up at once rather than after the claims
+// expire. The default is DefaultDrainTimeout; 0 cancels fetches at once.
+func (s *Smart) SetDrainTimeout(timeout time.Duration) {
+    s.drainTimeout = timeout
+}
+
+// unfetched collects the URLs a stopped crawl claimed but did not fetch
+type unfetched struct {
+    mutex sync.Mutex
+    urls  []string
+}
+
+func (u *unfetched) add(urls ...models.URLPriority) {
+    u.mutex.Lock()
+    defer u.mutex.Unlock()
+
+    for _, url := range urls {
+        // Revisits are leased rather than claimed and come due again once
+        // the lease runs out
+        if !url.Refresh {
+            u.urls = append(u.urls, url.URL)
+        }
+    }
+}
+
+// release returns the unfetched URLs to the frontier and returns how many
+// it took back
+func (s *Smart) release(ctx context.Context, left *unfetched) int {
+    left.mutex.Lock()
+    urls := left.urls
+    left.urls = nil
+    left.mutex.Unlock()
+
+    frontier, ok := s.frontier.(ReleasingFrontier)
+    if !ok || len(urls) == 0 {
+        return 0
+    }
+    released, err := frontier.Release(urls)
+    if err != nil {
+        s.emit(ctx, Event{Type: ErrorOccurred, Err: fmt.Errorf("failed to return %d unfetched URLs to the queue: %w", len(urls), err)})
+    }
+    return released
+}
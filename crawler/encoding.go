@@ -0,0 +1,157 @@
+package crawler
+
+import (
+    "bufio"
+    "compress/flate"
+    "compress/gzip"
+    "compress/zlib"
+    "context"
+    "fmt"
+    "io"
+    "net/http"
+    "strings"
+
+    "github.com/andybalholm/brotli"
+)
+
+// acceptEncoding is what the crawlers ask servers to compress bodies with
+const acceptEncoding = "gzip, deflate, br"
+
+// decodingTransport asks for compressed responses and decodes gzip,
+// deflate, and brotli bodies, so everything above it, from hashing to
+// parsing, sees the content as sent. Go's transport only does this for
+// gzip, and then hides how large the compressed body was.
+type decodingTransport struct {
+    base http.RoundTripper
+}
+
+func (t *decodingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+    base := t.base
+    if base == nil {
+        base = http.DefaultTransport
+    }
+    // Ranges of a compressed body cannot be decoded on their own
+    if req.Header.Get("Accept-Encoding") == "" && req.Header.Get("Range") == "" {
+        req = req.Clone(req.Context())
+        req.Header.Set("Accept-Encoding", acceptEncoding)
+    }
+
+    resp, err := base.RoundTrip(req)
+    if err != nil {
+        return nil, err
+    }
+    encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+    switch encoding {
+    case "gzip", "x-gzip", "deflate", "br":
+    default:
+        // Not encoded, or with something the crawler cannot decode
+        return resp, nil
+    }
+    if req.Method == http.MethodHead || resp.StatusCode == http.StatusNoContent || resp.StatusCode == http.StatusNotModified {
+        return resp, nil
+    }
+
+    body := &decodedBody{raw: resp.Body, counter: &countingReader{reader: resp.Body}, encoding: encoding}
+    if wire, ok := req.Context().Value(wireStatsKey{}).(*wireStats); ok {
+        wire.set(encoding, body.counter)
+    }
+    resp.Body = body
+    resp.Header.Del("Content-Encoding")
+    resp.Header.Del("Content-Length")
+    resp.ContentLength = -1
+    resp.Uncompressed = true
+    return resp, nil
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+    reader io.Reader
+    n      int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+    n, err := c.reader.Read(p)
+    c.n += int64(n)
+    return n, err
+}
+
+// decodedBody is a compressed response body that reads decoded. The
+// decoder is only created on the first read, since gzip and brotli read a
+// header up front.
+type decodedBody struct {
+    raw      io.ReadCloser
+    counter  *countingReader
+    encoding string
+    decoder  io.Reader
+    err      error
+}
+
+func (b *decodedBody) Read(p []byte) (int, error) {
+    if b.decoder == nil && b.err == nil {
+        b.decoder, b.err = newDecoder(b.encoding, bufio.NewReader(b.counter))
+        if b.err != nil {
+            b.err = fmt.Errorf("failed to decode %s body: %w", b.encoding, b.err)
+        }
+    }
+    if b.err != nil {
+        return 0, b.err
+    }
+    return b.decoder.Read(p)
+}
+
+func (b *decodedBody) Close() error {
+    if closer, ok := b.decoder.(io.Closer); ok && b.err == nil {
+        closer.Close()
+    }
+    return b.raw.Close()
+}
+
+type wireStatsKey struct{}
+
+// wireStats tells a fetch how the response it got was encoded. The client
+// wraps response bodies, so the decodedBody cannot be asked directly.
+type wireStats struct {
+    encoding string
+    counter  *countingReader
+}
+
+// withWireStats returns a context whose requests report to the returned
+// wireStats. After redirects it describes the last response.
+func withWireStats(ctx context.Context) (context.Context, *wireStats) {
+    wire := &wireStats{}
+    return context.WithValue(ctx, wireStatsKey{}, wire), wire
+}
+
+func (w *wireStats) set(encoding string, counter *countingReader) {
+    w.encoding, w.counter = encoding, counter
+}
+
+// compressedSize is how many bytes of the compressed body have been read,
+// 0 if it was not compressed
+func (w *wireStats) compressedSize() int64 {
+    if w == nil || w.counter == nil {
+        return 0
+    }
+    return w.counter.n
+}
+
+func newDecoder(encoding string, compressed *bufio.Reader) (io.Reader, error) {
+    // Redirects and errors often come with an encoding but no body
+    if _, err := compressed.Peek(1); err == io.EOF {
+        return compressed, nil
+    }
+    switch encoding {
+    case "br":
+        return brotli.NewReader(compressed), nil
+    case "deflate":
+        // "deflate" is meant to be zlib-wrapped, but some servers send raw
+        // deflate; a zlib header tells them apart
+        header, err := compressed.Peek(2)
+        if err == nil && header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+            return zlib.NewReader(compressed)
+        }
+        return flate.NewReader(compressed), nil
+    default:
+        return gzip.NewReader(compressed)
+    }
+}
@@ -0,0 +1,115 @@
+package crawler
+
+import (
+    "math/rand"
+    "time"
+
+    "smart-crawler/models"
+)
+
+// Frontier policies compared by a holdout evaluation, as recorded in
+// URLPriority.Policy, CrawlStats.Evaluation, and page tags
+const (
+    PolicySmart    = "smart"    // Priority order
+    PolicyBaseline = "baseline" // Queue order
+)
+
+// evaluationTagSource is the page_tags source of the policy tags
+const evaluationTagSource = "evaluation"
+
+// holdout routes a random share of each frontier pull through the baseline
+// policy. Both policies draw from the same queue in the same crawl, so they
+// face the same site, time, and budget, and the difference in what they
+// yield measures the prioritization itself. It is only used by the
+// dispatcher, so the generator needs no lock.
+type holdout struct {
+    fraction float64
+    rng      *rand.Rand
+}
+
+func newHoldout(fraction float64) *holdout {
+    return &holdout{
+        fraction: fraction,
+        rng:      rand.New(rand.NewSource(time.Now().UnixNano())),
+    }
+}
+
+// split decides, slot by slot, how many of a batch the baseline fills
+func (h *holdout) split(batch int) int {
+    baseline := 0
+    for i := 0; i < batch; i++ {
+        if h.rng.Float64() < h.fraction {
+            baseline++
+        }
+    }
+    return baseline
+}
+
+// next claims batch URLs from frontier, each labelled with the policy that
+// chose it. The policies pull in random order, and a URL both chose goes to
+// whichever pulled first, so neither is favored.
+func (h *holdout) next(frontier BaselineFrontier, batch int) ([]models.URLPriority, error) {
+    baseline := h.split(batch)
+    pulls := []struct {
+        policy string
+        limit  int
+        next   func(limit int) ([]models.URLPriority, error)
+    }{
+        {PolicySmart, batch - baseline, frontier.Next},
+        {PolicyBaseline, baseline, frontier.NextOldest},
+    }
+    if h.rng.Intn(2) == 0 {
+        pulls[0], pulls[1] = pulls[1], pulls[0]
+    }
+
+    var urls []models.URLPriority
+    picked := make(map[string]bool)
+    for _, pull := range pulls {
+        if pull.limit == 0 {
+            continue
+        }
+        claimed, err := pull.next(pull.limit)
+        if err != nil {
+            return urls, err
+        }
+        for _, url := range claimed {
+            if picked[url.URL] {
+                continue
+            }
+            picked[url.URL] = true
+            url.Policy = pull.policy
+            urls = append(urls, url)
+        }
+    }
+    return urls, nil
+}
+
+// recordYield adds the outcome of a frontier decision to its policy's yield
+func recordYield(stats *models.CrawlStats, result smartCrawlResult) {
+    // A URL claimed again while its first fetch was in flight is not a
+    // decision of its own
+    if result.Policy == "" || result.Reason == "already_crawled" {
+        return
+    }
+    if stats.Evaluation == nil {
+        stats.Evaluation = make(map[string]*models.PolicyYield)
+    }
+    yield := stats.Evaluation[result.Policy]
+    if yield == nil {
+        yield = &models.PolicyYield{}
+        stats.Evaluation[result.Policy] = yield
+    }
+
+    switch {
+    case result.Error != nil:
+        yield.Errors++
+    case result.Skipped:
+        yield.Skipped++
+    default:
+        // Running means, so a checkpoint can resume them
+        yield.Pages++
+        n := float64(yield.Pages)
+        yield.AvgQuality += (result.Page.ContentQuality - yield.AvgQuality) / n
+        yield.AvgImportance += (result.Page.Importance - yield.AvgImportance) / n
+    }
+}
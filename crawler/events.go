@@ -0,0 +1,111 @@
+package crawler
+
+import (
+    "context"
+    "log"
+    "sync"
+    "time"
+
+    "smart-crawler/models"
+)
+
+type EventType string
+
+const (
+    PageCrawled    EventType = "page_crawled"
+    LinkDiscovered EventType = "link_discovered"
+    CrawlFinished  EventType = "crawl_finished"
+    ErrorOccurred  EventType = "error_occurred"
+    CrawlStalled   EventType = "crawl_stalled"
+)
+
+// Event describes something observable that happened during a crawl. Only
+// the fields relevant to Type are set, besides the crawl session's id and
+// UUID, which every event carries once the session has been created.
+type Event struct {
+    Type      EventType
+    Time      time.Time
+    CrawlID   int64
+    CrawlUUID string
+    URL       string
+    Page  *models.Page        // PageCrawled
+    Link  *models.URLPriority // LinkDiscovered
+    Stats *models.CrawlStats  // CrawlFinished
+    Err   error               // ErrorOccurred
+    Stall *models.StallReport // CrawlStalled
+}
+
+const eventBufferSize = 256
+
+// eventEmitter is embedded by crawlers to publish events to embedders.
+// Events are only produced once Events has been called, so crawls without a
+// consumer pay nothing.
+type eventEmitter struct {
+    events chan Event
+    mutex  sync.Mutex
+    logger *log.Logger // Set at construction; logs errors, stalls, and finished crawls
+
+    crawlID   int64 // Session events are stamped with
+    crawlUUID string
+}
+
+// session sets the crawl session later events belong to
+func (e *eventEmitter) session(crawlID int64, crawlUUID string) {
+    e.mutex.Lock()
+    defer e.mutex.Unlock()
+
+    e.crawlID, e.crawlUUID = crawlID, crawlUUID
+}
+
+// Events returns the channel crawl events are delivered on. Call it before
+// Crawl and drain it continuously: a full channel applies backpressure to the
+// crawl. The channel is never closed; a CrawlFinished event marks the end of
+// each crawl.
+func (e *eventEmitter) Events() <-chan Event {
+    e.mutex.Lock()
+    defer e.mutex.Unlock()
+
+    if e.events == nil {
+        e.events = make(chan Event, eventBufferSize)
+    }
+    return e.events
+}
+
+func (e *eventEmitter) emit(ctx context.Context, event Event) {
+    e.mutex.Lock()
+    events := e.events
+    event.CrawlID, event.CrawlUUID = e.crawlID, e.crawlUUID
+    e.mutex.Unlock()
+
+    if e.logger != nil {
+        switch event.Type {
+        case ErrorOccurred:
+            e.logger.Printf("crawl %s: error at %s: %v", event.CrawlUUID, event.URL, event.Err)
+        case CrawlFinished:
+            e.logger.Printf("crawl %s of %s finished: %+v", event.CrawlUUID, event.URL, event.Stats)
+        case CrawlStalled:
+            e.logger.Printf("crawl %d (%s) stalled: %s", event.Stall.CrawlID, event.CrawlUUID, event.Stall.Diagnosis)
+        }
+    }
+
+    if events == nil {
+        return
+    }
+
+    event.Time = time.Now()
+
+    // After cancellation only deliver if there is room, so shutdown never
+    // blocks on a consumer that has gone away.
+    if ctx.Err() != nil {
+        select {
+        case events <- event:
+        default:
+        }
+        return
+    }
+
+    select {
+    case events <- event:
+    case <-ctx.Done():
+    }
+}
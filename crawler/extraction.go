@@ -0,0 +1,268 @@
+package crawler
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/url"
+    "os"
+    "regexp"
+    "strconv"
+    "strings"
+
+    "github.com/PuerkitoBio/goquery"
+    "github.com/antchfx/htmlquery"
+    "github.com/antchfx/xpath"
+
+    "smart-crawler/database"
+    "smart-crawler/models"
+)
+
+// ExtractionRule extracts named fields from the pages of a site, turning
+// them into a record saved with the page
+type ExtractionRule struct {
+    Name string `json:"name"`
+    // "shop.example.com" for that host only, "*.example.com" for
+    // example.com and every host below it; empty for every site
+    Domain string `json:"domain"`
+    // Regex the URL's path must match; empty for every page of the site
+    Path   string            `json:"path"`
+    Fields []ExtractionField `json:"fields"`
+
+    path *regexp.Regexp
+}
+
+// ExtractionField is a field of an extracted record: the text of the first
+// element matching Selector, or its Attr attribute, or its inner HTML. A
+// field may select with XPath instead of a CSS selector; an XPath that
+// selects attributes or text, like //a/@href, or computes a value, like
+// normalize-space(//h1), takes that as the field's value.
+type ExtractionField struct {
+    Name     string `json:"name"`
+    Selector string `json:"selector"`
+    XPath    string `json:"xpath"`
+    Attr     string `json:"attr"` // href and src are made absolute
+    HTML     bool   `json:"html"`
+    All      bool   `json:"all"` // A list of every match instead of the first
+
+    selector *Selector
+}
+
+// ExtractionRules are the extraction rules crawlers apply to the HTML pages
+// they save. Every rule matching a page's URL yields a record, unless none
+// of its fields matched anything.
+type ExtractionRules struct {
+    rules []ExtractionRule
+}
+
+// NewExtractionRules checks rules and compiles their patterns and selectors
+func NewExtractionRules(rules []ExtractionRule) (*ExtractionRules, error) {
+    names := make(map[string]bool)
+    for i := range rules {
+        rule := &rules[i]
+        if rule.Name == "" {
+            return nil, fmt.Errorf("extraction rule %d has no name", i+1)
+        }
+        if names[rule.Name] {
+            return nil, fmt.Errorf("extraction rule %s is defined twice", rule.Name)
+        }
+        names[rule.Name] = true
+        rule.Domain = strings.ToLower(rule.Domain)
+        if rule.Path != "" {
+            path, err := regexp.Compile(rule.Path)
+            if err != nil {
+                return nil, fmt.Errorf("extraction rule %s: invalid path: %w", rule.Name, err)
+            }
+            rule.path = path
+        }
+        if len(rule.Fields) == 0 {
+            return nil, fmt.Errorf("extraction rule %s has no fields", rule.Name)
+        }
+        for j := range rule.Fields {
+            field := &rule.Fields[j]
+            if field.Name == "" {
+                return nil, fmt.Errorf("extraction rule %s: field %d has no name", rule.Name, j+1)
+            }
+            var selector *Selector
+            var err error
+            switch {
+            case field.Selector != "" && field.XPath != "":
+                err = errors.New("has both a selector and an xpath")
+            case field.XPath != "":
+                selector, err = compileXPath(field.XPath)
+            default:
+                selector, err = compileCSS(field.Selector)
+            }
+            if err != nil {
+                return nil, fmt.Errorf("extraction rule %s: field %s: %w", rule.Name, field.Name, err)
+            }
+            field.selector = selector
+        }
+    }
+    return &ExtractionRules{rules: rules}, nil
+}
+
+// LoadExtractionRules reads a JSON extraction rules file, e.g.
+//
+//  {"rules": [
+//      {"name": "product", "domain": "*.shop.example", "path": "^/p/",
+//          "fields": [
+//              {"name": "title", "selector": "h1"},
+//              {"name": "price", "selector": "[itemprop=price]", "attr": "content"},
+//              {"name": "images", "selector": ".gallery img", "attr": "src", "all": true},
+//              {"name": "brand", "xpath": "//th[.='Brand']/following-sibling::td"}
+//          ]}
+//  ]}
+func LoadExtractionRules(path string) (*ExtractionRules, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+    var file struct {
+        Rules []ExtractionRule `json:"rules"`
+    }
+    if err := json.Unmarshal(data, &file); err != nil {
+        return nil, fmt.Errorf("invalid extraction rules file %s: %w", path, err)
+    }
+    return NewExtractionRules(file.Rules)
+}
+
+// WithExtractionRules extracts records from the HTML pages a crawler saves
+// by rules, into the extractions table
+func WithExtractionRules(rules *ExtractionRules) Option {
+    return func(o *options) error {
+        if rules == nil {
+            return errors.New("extraction rules must not be nil")
+        }
+        o.extraction = rules
+        return nil
+    }
+}
+
+// Rules returns how many rules there are
+func (r *ExtractionRules) Rules() int {
+    return len(r.rules)
+}
+
+// saveExtractions replaces the records of a freshly saved page with those
+// it was just extracted, when the crawl has extraction rules
+func saveExtractions(db database.Store, rules *ExtractionRules, page *models.Page) error {
+    if rules == nil {
+        return nil
+    }
+    return db.SaveExtractions(page.CrawlID, page.ID, page.URL, page.Extractions)
+}
+
+// extract is the records of the rules matching the page at pageURL
+func (r *ExtractionRules) extract(doc *goquery.Document, pageURL string) []models.Extraction {
+    if r == nil {
+        return nil
+    }
+    parsed, err := url.Parse(pageURL)
+    if err != nil {
+        return nil
+    }
+    host := strings.ToLower(parsed.Hostname())
+
+    var extractions []models.Extraction
+    for i := range r.rules {
+        rule := &r.rules[i]
+        if rule.Domain != "" && !matchesDomain(rule.Domain, host) {
+            continue
+        }
+        if rule.path != nil && !rule.path.MatchString(parsed.Path) {
+            continue
+        }
+        fields := make(map[string]interface{}, len(rule.Fields))
+        found := false
+        for _, field := range rule.Fields {
+            values := field.extract(doc, parsed)
+            switch {
+            case field.All:
+                fields[field.Name] = values
+            case len(values) > 0:
+                fields[field.Name] = values[0]
+            default:
+                fields[field.Name] = nil
+            }
+            found = found || len(values) > 0
+        }
+        if found {
+            extractions = append(extractions, models.Extraction{Rule: rule.Name, Fields: fields})
+        }
+    }
+    return extractions
+}
+
+// extract is the field's values on the page doc, at base
+func (f *ExtractionField) extract(doc *goquery.Document, base *url.URL) []string {
+    if f.selector.xpath == nil {
+        return f.values(f.selector.find(doc.Selection), base)
+    }
+
+    values := []string{}
+    switch result := f.selector.evaluate(doc.Get(0)).(type) {
+    case *xpath.NodeIterator:
+        for (f.All || len(values) == 0) && result.MoveNext() {
+            nav := result.Current().(*htmlquery.NodeNavigator)
+            switch nav.NodeType() {
+            case xpath.AttributeNode:
+                value := strings.TrimSpace(nav.Value())
+                if name := nav.LocalName(); name == "href" || name == "src" {
+                    if ref, err := base.Parse(value); err == nil {
+                        value = ref.String()
+                    }
+                }
+                values = append(values, value)
+            case xpath.TextNode:
+                if text := strings.Join(strings.Fields(nav.Value()), " "); text != "" {
+                    values = append(values, text)
+                }
+            case xpath.ElementNode:
+                values = append(values, f.values(doc.FindNodes(nav.Current()), base)...)
+            }
+        }
+    case string:
+        if result = strings.TrimSpace(result); result != "" {
+            values = append(values, result)
+        }
+    case float64:
+        values = append(values, strconv.FormatFloat(result, 'f', -1, 64))
+    case bool:
+        values = append(values, strconv.FormatBool(result))
+    }
+    return values
+}
+
+// values is what the field takes from each element of matches; elements
+// without the attribute are left out
+func (f *ExtractionField) values(matches *goquery.Selection, base *url.URL) []string {
+    values := []string{}
+    matches.EachWithBreak(func(_ int, el *goquery.Selection) bool {
+        var value string
+        switch {
+        case f.Attr != "":
+            attr, ok := el.Attr(f.Attr)
+            if !ok {
+                return true
+            }
+            value = strings.TrimSpace(attr)
+            if f.Attr == "href" || f.Attr == "src" {
+                if ref, err := base.Parse(value); err == nil {
+                    value = ref.String()
+                }
+            }
+        case f.HTML:
+            html, err := el.Html()
+            if err != nil {
+                return true
+            }
+            value = strings.TrimSpace(html)
+        default:
+            value = strings.Join(strings.Fields(el.Text()), " ")
+        }
+        values = append(values, value)
+        return f.All
+    })
+    return values
+}
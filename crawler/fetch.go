@@ -0,0 +1,241 @@
+package crawler
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "net/http"
+
+    "smart-crawler/models"
+)
+
+var (
+    errRedirectLoop = errors.New("redirect loop")
+    // A redirect led to a URL this crawl has already saved
+    errRedirectToCrawled = errors.New("redirect to a page already crawled")
+)
+
+// FetchStrategy is how a URL is requested
+type FetchStrategy string
+
+const (
+    // StrategyGet downloads the URL with a plain GET
+    StrategyGet FetchStrategy = "get"
+    // StrategyConditional sends the saved page's validators with the GET,
+    // so an unchanged page comes back as 304 Not Modified without a body
+    StrategyConditional FetchStrategy = "conditional"
+    // StrategyHeadFirst sends HEAD and only downloads the body if a content
+    // handler wants its type, e.g. to inventory large assets cheaply
+    StrategyHeadFirst FetchStrategy = "head_first"
+)
+
+// StrategySelector picks the fetch strategy for each URL
+type StrategySelector func(url models.URLPriority) FetchStrategy
+
+// DefaultStrategy revisits saved pages conditionally and fetches everything
+// else with GET
+func DefaultStrategy(url models.URLPriority) FetchStrategy {
+    if url.Refresh {
+        return StrategyConditional
+    }
+    return StrategyGet
+}
+
+// HeadFirstStrategy revisits saved pages conditionally and checks everything
+// else with HEAD before downloading it
+func HeadFirstStrategy(url models.URLPriority) FetchStrategy {
+    if url.Refresh {
+        return StrategyConditional
+    }
+    return StrategyHeadFirst
+}
+
+// fetchResponse is what fetching a URL got back. Body is only read when a
+// handler wants the content and it was not reported unchanged.
+type fetchResponse struct {
+    Request     *http.Request // The last request sent, after any redirects
+    StatusCode  int
+    Header      http.Header
+    FinalURL    string               // Empty unless redirects were followed
+    Redirects   []models.RedirectHop // Followed to FinalURL
+    Body        []byte
+    BodyHash    string // MD5 of Body
+    Truncated   bool   // Body was cut off at the size cap
+    Encoding    string // Content-Encoding Body was decoded from
+    WireSize    int64  // Compressed size of Body, 0 if it was not compressed
+    Protocol    string // HTTP version of the last response, e.g. HTTP/2.0
+    TLS         *models.TLSInfo // Of the last response, nil over plain HTTP
+    Timing      *models.RequestTiming // Of the GET, nil if there was none
+    Handler     ContentHandler // nil if no handler wants the content type
+    MediaType   string
+    NotModified bool
+    Usage       models.FetchUsage
+}
+
+// fetch requests urlPriority by strategy. The worker has already waited on
+// the rate limiter for the first request; a GET after a HEAD waits again.
+// The usage is filled in even when an error is returned.
+func (s *Smart) fetch(ctx context.Context, urlPriority models.URLPriority, strategy FetchStrategy) (fetched *fetchResponse, err error) {
+    ctx, span := startFetchSpan(ctx, strategy)
+    defer func() { endFetchSpan(span, fetched, err) }()
+
+    fetched = &fetchResponse{}
+    fetched.Usage.URLs = 1
+
+    if strategy == StrategyHeadFirst {
+        resp, redirects, err := s.request(ctx, http.MethodHead, urlPriority, false)
+        fetched.Usage.Requests++
+        fetched.Usage.HeadRequests++
+        if err != nil {
+            return fetched, err
+        }
+        resp.Body.Close()
+
+        // Servers that refuse HEAD are asked with GET
+        if resp.StatusCode != http.StatusMethodNotAllowed && resp.StatusCode != http.StatusNotImplemented {
+            fetched.StatusCode, fetched.Header, fetched.Protocol = resp.StatusCode, resp.Header, resp.Proto
+            fetched.TLS = tlsInfo(resp.TLS)
+            fetched.setRedirects(resp, redirects)
+            fetched.Handler, fetched.MediaType = s.handlers.Lookup(resp.Header.Get("Content-Type"))
+            if fetched.Handler == nil {
+                fetched.Usage.BodiesAvoided++
+                return fetched, nil
+            }
+        }
+        if err := s.limiter.Wait(ctx); err != nil {
+            return fetched, err
+        }
+    }
+
+    conditional := strategy == StrategyConditional
+    getCtx, wire := withWireStats(ctx)
+    getCtx, timer := withFetchTimer(getCtx)
+    resp, redirects, err := s.request(getCtx, http.MethodGet, urlPriority, conditional)
+    fetched.Usage.Requests++
+    if err != nil {
+        return fetched, err
+    }
+    defer resp.Body.Close()
+    // Taken after the body is read, when it is
+    defer func() { fetched.Timing = timer.timing() }()
+
+    fetched.StatusCode, fetched.Header, fetched.Protocol = resp.StatusCode, resp.Header, resp.Proto
+    fetched.TLS = tlsInfo(resp.TLS)
+    fetched.setRedirects(resp, redirects)
+    if conditional && resp.StatusCode == http.StatusNotModified {
+        fetched.NotModified = true
+        fetched.Usage.NotModified++
+        return fetched, nil
+    }
+
+    // Smart content type filtering
+    fetched.Handler, fetched.MediaType = s.handlers.Lookup(resp.Header.Get("Content-Type"))
+    if fetched.Handler == nil {
+        return fetched, nil
+    }
+
+    body, err := readBody(resp.Body, s.maxResponseSize, wire)
+    if err != nil {
+        return fetched, err
+    }
+    fetched.Body, fetched.BodyHash, fetched.Truncated = body.data, body.hash, body.truncated
+    fetched.Encoding, fetched.WireSize = body.encoding, body.compressedSize
+    if body.encoding != "" {
+        fetched.Usage.Bytes += body.compressedSize
+    } else {
+        fetched.Usage.Bytes += int64(len(body.data))
+    }
+    return fetched, nil
+}
+
+func (f *fetchResponse) setRedirects(resp *http.Response, redirects []models.RedirectHop) {
+    f.Request = resp.Request
+    f.Redirects = redirects
+    f.FinalURL = ""
+    if len(redirects) > 0 {
+        f.FinalURL = resp.Request.URL.String()
+    }
+}
+
+// request sends one request for urlPriority, with the saved page's
+// validators when conditional, and returns the redirects it followed. It
+// stops at a redirect loop, after maxRedirectHops redirects, at a redirect
+// robots.txt disallows, and, unless this is a revisit, at a redirect to a
+// page the crawl already saved, so two queued URLs leading to the same place
+// are only downloaded once.
+func (s *Smart) request(ctx context.Context, method string, urlPriority models.URLPriority, conditional bool) (*http.Response, []models.RedirectHop, error) {
+    req, err := http.NewRequestWithContext(ctx, method, urlPriority.URL, nil)
+    if err != nil {
+        return nil, nil, err
+    }
+
+    var redirects []models.RedirectHop
+    client := *s.client
+    client.CheckRedirect = func(next *http.Request, via []*http.Request) error {
+        redirects = append(redirects, models.RedirectHop{
+            URL:        via[len(via)-1].URL.String(),
+            StatusCode: next.Response.StatusCode,
+        })
+        target := next.URL.String()
+        for _, previous := range via {
+            if previous.URL.String() == target {
+                return fmt.Errorf("%w at %s", errRedirectLoop, target)
+            }
+        }
+        if len(via) >= maxRedirectHops {
+            return fmt.Errorf("stopped after %d redirects", maxRedirectHops)
+        }
+        allowed, err := s.robotsAllowed(next.Context(), next.URL)
+        if err != nil {
+            return err
+        }
+        if !allowed {
+            return errRobotsDisallowed
+        }
+        if !urlPriority.Refresh {
+            if crawled, err := s.db.IsURLCrawled(s.crawlID, target); err == nil && crawled {
+                return errRedirectToCrawled
+            }
+        }
+        return nil
+    }
+
+    req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
+    // A revisit only needs the body if the page changed
+    if conditional {
+        if etag := urlPriority.Validators.ETag; etag != "" {
+            req.Header.Set("If-None-Match", etag)
+        }
+        if lastModified := urlPriority.Validators.LastModified; lastModified != "" {
+            req.Header.Set("If-Modified-Since", lastModified)
+        }
+    }
+    if err := s.beforeRequest(req); err != nil {
+        return nil, nil, err
+    }
+
+    resp, err := client.Do(req)
+    return resp, redirects, err
+}
+
+// recordFetch adds what a result's fetch cost to its strategy's usage
+func recordFetch(stats *models.CrawlStats, result smartCrawlResult) {
+    if result.Strategy == "" {
+        return
+    }
+    if stats.Fetches == nil {
+        stats.Fetches = make(map[string]*models.FetchUsage)
+    }
+    usage := stats.Fetches[string(result.Strategy)]
+    if usage == nil {
+        usage = &models.FetchUsage{}
+        stats.Fetches[string(result.Strategy)] = usage
+    }
+
+    usage.URLs += result.Fetch.URLs
+    usage.Requests += result.Fetch.Requests
+    usage.HeadRequests += result.Fetch.HeadRequests
+    usage.NotModified += result.Fetch.NotModified
+    usage.BodiesAvoided += result.Fetch.BodiesAvoided
+    usage.Bytes += result.Fetch.Bytes
+}
@@ -0,0 +1,145 @@
+package crawler
+
+import (
+    "time"
+
+    "smart-crawler/database"
+    "smart-crawler/models"
+)
+
+// Frontier is the queue of URLs the smart crawler still has to visit. It
+// may be shared by several crawler instances.
+type Frontier interface {
+    // Add enqueues URLs, raising the priority of ones already queued
+    Add(urls []models.URLPriority) error
+    // Next claims up to limit of the highest priority pending URLs
+    Next(limit int) ([]models.URLPriority, error)
+    // Done marks a claimed URL as processed
+    Done(url string) error
+}
+
+// BaselineFrontier is a Frontier that can also hand out URLs in the order
+// they were queued, which holdout evaluations use as the baseline policy.
+type BaselineFrontier interface {
+    Frontier
+    // NextOldest claims up to limit pending URLs, oldest first, ignoring
+    // priority
+    NextOldest(limit int) ([]models.URLPriority, error)
+}
+
+// ShardedFrontier is a Frontier that can pass over hosts when claiming,
+// which the smart crawler does for hosts that already have as many URLs
+// waiting as their concurrency cap lets it fetch soon
+type ShardedFrontier interface {
+    Frontier
+    // NextExcept claims like Next, leaving the URLs of hosts (host and
+    // port, as in net/url) pending
+    NextExcept(limit int, hosts []string) ([]models.URLPriority, error)
+}
+
+// PrunableFrontier is a Frontier that can drop pending URLs, which the smart
+// crawler does when a site's robots.txt changes to disallow them
+type PrunableFrontier interface {
+    Frontier
+    // Prune removes the pending URLs starting with origin (scheme and host,
+    // e.g. "https://example.com") for which disallowed returns true, and
+    // returns how many it removed. Removed URLs are not queued again.
+    Prune(origin string, disallowed func(url string) bool) (int, error)
+}
+
+// How often a dbFrontier returns the stale claims of crashed crawlers to
+// the queue
+const reapInterval = time.Minute
+
+// RetryingFrontier is a Frontier that retries URLs whose fetch failed and
+// gives up on them after a number of attempts
+type RetryingFrontier interface {
+    Frontier
+    // Fail records a failed fetch of a claimed URL in place of Done. The
+    // URL is retried later, or dead-lettered once out of attempts, which
+    // Fail reports.
+    Fail(url, message string) (bool, error)
+    // Retrying reports whether failed URLs are waiting to be retried
+    Retrying() (bool, error)
+}
+
+// dbFrontier is the default frontier backed by the store's crawl_queue,
+// scoped to one crawl session. Next claims URLs, so crawler instances
+// sharing the session never fetch the same one.
+type dbFrontier struct {
+    db      database.Store
+    crawlID int64
+    reaped  time.Time // When stale claims were last returned
+
+    maxAttempts int           // Failed fetches allowed per URL
+    backoff     time.Duration // Wait before the first retry, doubling with each
+}
+
+// newDBFrontier returns the crawl_queue frontier of the running crawl
+func (s *Smart) newDBFrontier() *dbFrontier {
+    return &dbFrontier{db: s.db, crawlID: s.crawlID, maxAttempts: s.maxAttempts, backoff: s.retryBackoff}
+}
+
+func (f *dbFrontier) Add(urls []models.URLPriority) error {
+    return f.db.AddToQueue(f.crawlID, urls)
+}
+
+func (f *dbFrontier) Next(limit int) ([]models.URLPriority, error) {
+    return f.NextExcept(limit, nil)
+}
+
+func (f *dbFrontier) NextExcept(limit int, hosts []string) ([]models.URLPriority, error) {
+    if err := f.reap(); err != nil {
+        return nil, err
+    }
+    return f.db.GetNextURLs(f.crawlID, limit, hosts)
+}
+
+func (f *dbFrontier) NextOldest(limit int) ([]models.URLPriority, error) {
+    if err := f.reap(); err != nil {
+        return nil, err
+    }
+    return f.db.GetOldestURLs(f.crawlID, limit)
+}
+
+// reap returns URLs claimed longer than database.QueueClaimTimeout ago to
+// the queue, at most once per reapInterval
+func (f *dbFrontier) reap() error {
+    if time.Since(f.reaped) < reapInterval {
+        return nil
+    }
+    if _, err := f.db.ReapQueue(database.QueueClaimTimeout); err != nil {
+        return err
+    }
+    f.reaped = time.Now()
+    return nil
+}
+
+func (f *dbFrontier) Done(url string) error {
+    return f.db.MarkURLProcessed(f.crawlID, url)
+}
+
+func (f *dbFrontier) Fail(url, message string) (bool, error) {
+    return f.db.FailURL(f.crawlID, url, message, f.maxAttempts, f.backoff)
+}
+
+func (f *dbFrontier) Retrying() (bool, error) {
+    return f.db.HasPendingRetries(f.crawlID)
+}
+
+func (f *dbFrontier) Prune(origin string, disallowed func(url string) bool) (int, error) {
+    pending, err := f.db.GetPendingURLs(f.crawlID, origin)
+    if err != nil {
+        return 0, err
+    }
+    var drop []string
+    for _, url := range pending {
+        if disallowed(url) {
+            drop = append(drop, url)
+        }
+    }
+    if len(drop) == 0 {
+        return 0, nil
+    }
+    return f.db.DisallowQueuedURLs(f.crawlID, drop)
+}
@@ -0,0 +1,322 @@
+package crawler
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "encoding/xml"
+    "fmt"
+    "mime"
+    "net/url"
+    "path"
+    "strings"
+    "sync"
+    "unicode/utf8"
+
+    "github.com/PuerkitoBio/goquery"
+
+    "smart-crawler/models"
+    "smart-crawler/utils"
+)
+
+// Content is a fetched response body handed to a ContentHandler
+type Content struct {
+    Context     context.Context // The page's trace, for handlers' own spans; may be nil
+    URL         string
+    ContentType string // Full Content-Type header value
+    MediaType   string // Parsed media type, e.g. "text/html"
+    Body        []byte
+    Depth       int
+    Priority    int // The page's own queue priority, which its links inherit under a topic
+}
+
+// HandledContent is what a ContentHandler extracted from a body
+type HandledContent struct {
+    Title          string
+    Text           string // Stored as the page content; may differ from the raw body
+    Context        models.URLContext
+    Links          []models.URLPriority
+    StructuredData []models.StructuredItem // Embedded JSON-LD, microdata, OpenGraph, and Twitter card data
+    Canonical      string                  // The page's rel=canonical URL, if it has one
+    PlainText      string                  // Start of the visible text near-duplicates are judged on; Text when empty
+    Extractions    []models.Extraction     // Records of the crawl's extraction rules
+    Images         []models.Image          // The page's images, when the crawl records them
+    Spam           *SpamVerdict            // When the crawl filters spam; the links of spam are not followed
+}
+
+// ContentHandler processes bodies of the media types it is registered for
+type ContentHandler interface {
+    Handle(content *Content) (*HandledContent, error)
+}
+
+type ContentHandlerFunc func(content *Content) (*HandledContent, error)
+
+func (f ContentHandlerFunc) Handle(content *Content) (*HandledContent, error) {
+    return f(content)
+}
+
+// UnknownContentAction decides what happens to media types with no handler
+type UnknownContentAction string
+
+const (
+    UnknownContentSkip  UnknownContentAction = "skip"
+    UnknownContentStore UnknownContentAction = "store"
+)
+
+func ParseUnknownContentAction(s string) (UnknownContentAction, error) {
+    switch action := UnknownContentAction(strings.ToLower(s)); action {
+    case UnknownContentSkip, UnknownContentStore:
+        return action, nil
+    }
+    return "", fmt.Errorf("invalid unknown content action %q, use 'skip' or 'store'", s)
+}
+
+// ContentHandlers maps media types to handlers. Lookup tries the exact media
+// type, then its structured syntax suffix (application/rss+xml falls back to
+// application/xml), then a "type/*" wildcard.
+type ContentHandlers struct {
+    handlers      map[string]ContentHandler
+    unknownAction UnknownContentAction
+    mutex         sync.RWMutex
+}
+
+func NewContentHandlers() *ContentHandlers {
+    return &ContentHandlers{
+        handlers:      make(map[string]ContentHandler),
+        unknownAction: UnknownContentSkip,
+    }
+}
+
+func (h *ContentHandlers) Register(mediaType string, handler ContentHandler) {
+    h.mutex.Lock()
+    defer h.mutex.Unlock()
+
+    h.handlers[strings.ToLower(mediaType)] = handler
+}
+
+func (h *ContentHandlers) SetUnknownAction(action UnknownContentAction) {
+    h.mutex.Lock()
+    defer h.mutex.Unlock()
+
+    h.unknownAction = action
+}
+
+// Lookup returns the handler for contentType, falling back to storeHandler
+// when unknown types are stored, or nil when they are skipped.
+func (h *ContentHandlers) Lookup(contentType string) (ContentHandler, string) {
+    mediaType, _, err := mime.ParseMediaType(contentType)
+    if err != nil {
+        mediaType = strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+    }
+
+    h.mutex.RLock()
+    defer h.mutex.RUnlock()
+
+    candidates := []string{mediaType}
+    if major, minor, ok := strings.Cut(mediaType, "/"); ok {
+        if i := strings.LastIndex(minor, "+"); i >= 0 {
+            candidates = append(candidates, "application/"+minor[i+1:])
+        }
+        candidates = append(candidates, major+"/*")
+    }
+
+    for _, candidate := range candidates {
+        if handler, exists := h.handlers[candidate]; exists {
+            return handler, mediaType
+        }
+    }
+
+    if h.unknownAction == UnknownContentStore {
+        return ContentHandlerFunc(handleStoreOnly), mediaType
+    }
+    return nil, mediaType
+}
+
+// handleStoreOnly keeps textual bodies as-is and extracts no links. Binary
+// bodies are not stored as text.
+func handleStoreOnly(content *Content) (*HandledContent, error) {
+    handled := &HandledContent{Title: path.Base(content.URL)}
+    if isText(content.Body) {
+        handled.Text = string(content.Body)
+    }
+    return handled, nil
+}
+
+func handlePlainText(content *Content) (*HandledContent, error) {
+    text := string(content.Body)
+    title, _, _ := strings.Cut(strings.TrimSpace(text), "\n")
+    if len(title) > 100 {
+        title = title[:100]
+    }
+    return &HandledContent{Title: strings.TrimSpace(title), Text: text}, nil
+}
+
+// handleJSON stores the document and takes a top-level "title" or "name"
+// field as the title when present.
+func handleJSON(content *Content) (*HandledContent, error) {
+    var doc map[string]interface{}
+    handled := &HandledContent{Text: string(content.Body)}
+    if err := json.Unmarshal(content.Body, &doc); err == nil {
+        for _, key := range []string{"title", "name"} {
+            if title, ok := doc[key].(string); ok {
+                handled.Title = title
+                break
+            }
+        }
+    }
+    return handled, nil
+}
+
+// handleXML follows <loc> and <link> elements and href attributes, which
+// covers sitemaps, RSS, and Atom feeds.
+func handleXML(content *Content) (*HandledContent, error) {
+    handled := &HandledContent{Text: string(content.Body)}
+    decoder := xml.NewDecoder(bytes.NewReader(content.Body))
+    decoder.Strict = false
+
+    var current string
+    seen := make(map[string]bool)
+    addLink := func(raw string) {
+        link := resolveURL(content.URL, strings.TrimSpace(raw))
+        if link == "" || seen[link] || !utils.IsValidURL(link) {
+            return
+        }
+        seen[link] = true
+        handled.Links = append(handled.Links, models.URLPriority{
+            URL:      link,
+            Priority: 50,
+            Depth:    content.Depth + 1,
+            Parent:   content.URL,
+        })
+    }
+
+    for {
+        token, err := decoder.Token()
+        if err != nil {
+            break
+        }
+
+        switch t := token.(type) {
+        case xml.StartElement:
+            current = t.Name.Local
+            for _, attr := range t.Attr {
+                if attr.Name.Local == "href" {
+                    addLink(attr.Value)
+                }
+            }
+        case xml.CharData:
+            switch current {
+            case "loc", "link":
+                addLink(string(t))
+            case "title":
+                if handled.Title == "" {
+                    handled.Title = strings.TrimSpace(string(t))
+                }
+            }
+        case xml.EndElement:
+            current = ""
+        }
+    }
+
+    return handled, nil
+}
+
+// handlePDF records the document without storing its binary body
+func handlePDF(content *Content) (*HandledContent, error) {
+    return &HandledContent{Title: path.Base(content.URL)}, nil
+}
+
+// handleHTML is the smart crawler's analysis and link prioritization
+func (s *Smart) handleHTML(content *Content) (*HandledContent, error) {
+    ctx := content.Context
+    if ctx == nil {
+        ctx = context.Background()
+    }
+    _, span := tracer.Start(ctx, "parse")
+    doc, err := goquery.NewDocumentFromReader(bytes.NewReader(content.Body))
+    endSpan(span, err)
+    if err != nil {
+        return nil, err
+    }
+
+    _, span = tracer.Start(ctx, "analyze")
+    defer span.End()
+    removeIgnoredSections(doc)
+    pageContext := s.contentAnalyzer.AnalyzeContent(doc, string(content.Body))
+    // Relevance to the crawl's topic, whatever the analyzer
+    if s.topic != nil {
+        pageContext.Relevance = s.topic.analyze(topicText(doc))
+    }
+    pages := findPagination(doc, content.URL)
+    if pages.listing {
+        pageContext.ContentType = listingContentType
+    }
+
+    handled := &HandledContent{
+        Title:          doc.Find("title").Text(),
+        Text:           string(content.Body),
+        Context:        pageContext,
+        StructuredData: extractStructuredData(doc, content.URL),
+        Canonical:      canonicalURL(doc, content.URL),
+        PlainText:      visibleText(doc),
+        Extractions:    s.extraction.extract(doc, content.URL),
+        Images:         s.images.collect(ctx, doc, content.URL),
+        Spam:           s.spam.classify(doc, content.URL),
+    }
+    if s.script != nil {
+        fields, err := s.script.extractFields(doc, content.URL)
+        if err != nil {
+            s.emit(ctx, Event{Type: ErrorOccurred, URL: content.URL, Err: err})
+        }
+        if len(fields) > 0 {
+            handled.StructuredData = append(handled.StructuredData, models.StructuredItem{Format: "script", Properties: fields})
+        }
+    }
+    if s.shouldExpand(pageContext, content.Depth) && !handled.Spam.flagged() {
+        handled.Links = s.extractSmartLinks(doc, content.URL, pageContext, content.Depth, content.Priority, pages)
+    }
+
+    return handled, nil
+}
+
+// Words of a page's visible text kept for near-duplicate lookups, more than
+// the store samples
+const plainTextWords = 500
+
+// visibleText returns the first words of the text a page's body shows,
+// without scripts and styles
+func visibleText(doc *goquery.Document) string {
+    body := doc.Find("body")
+    if body.Length() == 0 {
+        return ""
+    }
+    return strings.Join(collectWords(body.Get(0), true, nil, plainTextWords), " ")
+}
+
+func (s *Smart) registerDefaultHandlers() {
+    s.handlers.Register("text/html", ContentHandlerFunc(s.handleHTML))
+    s.handlers.Register("application/xhtml+xml", ContentHandlerFunc(s.handleHTML))
+    s.handlers.Register("text/plain", ContentHandlerFunc(handlePlainText))
+    s.handlers.Register("application/json", ContentHandlerFunc(handleJSON))
+    s.handlers.Register("application/xml", ContentHandlerFunc(handleXML))
+    s.handlers.Register("text/xml", ContentHandlerFunc(handleXML))
+    s.handlers.Register("application/pdf", ContentHandlerFunc(handlePDF))
+}
+
+func isText(body []byte) bool {
+    return !bytes.ContainsRune(body, 0) && utf8.Valid(body)
+}
+
+func resolveURL(baseURL, href string) string {
+    base, err := url.Parse(baseURL)
+    if err != nil {
+        return ""
+    }
+
+    link, err := url.Parse(href)
+    if err != nil {
+        return ""
+    }
+
+    return base.ResolveReference(link).String()
+}
@@ -0,0 +1,76 @@
+package crawler
+
+import (
+    "fmt"
+
+    "smart-crawler/models"
+)
+
+const (
+    // harvestStep is how many pages apart a crawl's first harvest samples are
+    harvestStep = 10
+    // harvestSamples is how many samples a crawl keeps; a longer crawl
+    // drops every other one, doubling the step
+    harvestSamples = 100
+)
+
+// WithHarvestThreshold tracks the crawl's harvest rate: the fraction of the
+// pages it processed whose relevance is at least threshold, overall and as
+// the crawl went on. A page's relevance is its relevance to WithTopic's
+// topic, or without one its content quality; the traditional crawler scores
+// either for this alone.
+func WithHarvestThreshold(threshold float64) Option {
+    return func(o *options) error {
+        if threshold <= 0 || threshold > 1 {
+            return fmt.Errorf("harvest threshold must be above 0 and at most 1, got %v", threshold)
+        }
+        o.harvestThreshold = threshold
+        return nil
+    }
+}
+
+// recordHarvest counts a processed page of the given relevance towards the
+// harvest rate, kept in stats so a checkpoint resumes it. threshold 0 does
+// not track it.
+func recordHarvest(stats *models.CrawlStats, threshold, relevance float64) {
+    if threshold <= 0 {
+        return
+    }
+    h := stats.Harvest
+    if h == nil {
+        h = &models.HarvestStats{Threshold: threshold, Step: harvestStep}
+        stats.Harvest = h
+    }
+    h.Pages++
+    if relevance >= threshold {
+        h.Relevant++
+    }
+    h.Rate = float64(h.Relevant) / float64(h.Pages)
+    if h.Pages%h.Step != 0 {
+        return
+    }
+
+    sample := models.HarvestSample{Pages: h.Pages, Relevant: h.Relevant, Rate: h.Rate}
+    var previous models.HarvestSample
+    if len(h.Samples) > 0 {
+        previous = h.Samples[len(h.Samples)-1]
+    }
+    sample.WindowRate = float64(h.Relevant-previous.Relevant) / float64(h.Pages-previous.Pages)
+    h.Samples = append(h.Samples, sample)
+    if len(h.Samples) < harvestSamples {
+        return
+    }
+
+    // Keep the samples at multiples of the doubled step, their window rates
+    // now taken over it
+    kept := h.Samples[:0]
+    previous = models.HarvestSample{}
+    for i := 1; i < len(h.Samples); i += 2 {
+        sample := h.Samples[i]
+        sample.WindowRate = float64(sample.Relevant-previous.Relevant) / float64(sample.Pages-previous.Pages)
+        kept = append(kept, sample)
+        previous = sample
+    }
+    h.Samples = kept
+    h.Step *= 2
+}
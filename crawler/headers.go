@@ -0,0 +1,145 @@
+package crawler
+
+import (
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "os"
+    "sort"
+    "strings"
+)
+
+// SiteHeaders are request headers sent to one domain on top of, or in
+// place of, the crawler's own, e.g. an API key, an Accept-Language, or a
+// distinct User-Agent for a site that asked for one
+type SiteHeaders struct {
+    // "docs.example.com" for that host only, "*.example.com" for
+    // example.com and every host below it
+    Domain    string            `json:"domain"`
+    UserAgent string            `json:"user_agent"`
+    Headers   map[string]string `json:"headers"`
+}
+
+// HeaderOverrides sets each domain's headers on its requests, replacing any
+// the crawler set itself. Where several entries match a host, the most
+// specific domain wins.
+type HeaderOverrides struct {
+    sites []SiteHeaders // Least specific first
+}
+
+func NewHeaderOverrides(sites []SiteHeaders) (*HeaderOverrides, error) {
+    for i, site := range sites {
+        if strings.Trim(site.Domain, "*.") == "" {
+            return nil, fmt.Errorf("header site %d has no domain", i+1)
+        }
+        sites[i].Domain = strings.ToLower(site.Domain)
+        if site.UserAgent == "" && len(site.Headers) == 0 {
+            return nil, fmt.Errorf("header site %s sets no headers", site.Domain)
+        }
+        for name := range site.Headers {
+            if strings.EqualFold(name, "Host") {
+                return nil, fmt.Errorf("header site %s: Host cannot be overridden", site.Domain)
+            }
+        }
+    }
+    // Later entries overwrite earlier ones, so exact hosts go after
+    // wildcards and longer domains after shorter ones
+    sort.SliceStable(sites, func(a, b int) bool { return specificity(sites[a].Domain) < specificity(sites[b].Domain) })
+    return &HeaderOverrides{sites: sites}, nil
+}
+
+func specificity(domain string) int {
+    if strings.HasPrefix(domain, "*.") {
+        return 2 * (len(domain) - 2)
+    }
+    return 2*len(domain) + 1
+}
+
+// LoadHeadersFile reads a JSON headers file, e.g.
+//
+//  {"sites": [
+//      {"domain": "*.example.com", "headers": {"Accept-Language": "de-DE"}},
+//      {"domain": "api.example.com", "user_agent": "SmartCrawler/1.0 (+ops@example.org)",
+//          "headers": {"X-Api-Key": "${EXAMPLE_API_KEY}"}}
+//  ]}
+//
+// ${VAR} references are replaced with environment variables.
+func LoadHeadersFile(path string) (*HeaderOverrides, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+    var file struct {
+        Sites []SiteHeaders `json:"sites"`
+    }
+    if err := json.Unmarshal([]byte(os.ExpandEnv(string(data))), &file); err != nil {
+        return nil, fmt.Errorf("invalid headers file %s: %w", path, err)
+    }
+    return NewHeaderOverrides(file.Sites)
+}
+
+// Sites returns how many domains have headers
+func (h *HeaderOverrides) Sites() int {
+    return len(h.sites)
+}
+
+// apply returns req with the headers of every entry matching its host,
+// cloned if any apply
+func (h *HeaderOverrides) apply(req *http.Request) *http.Request {
+    host := strings.ToLower(req.URL.Hostname())
+    overridden := req
+    set := func(name, value string) {
+        if overridden == req {
+            overridden = req.Clone(req.Context())
+        }
+        overridden.Header.Set(name, value)
+    }
+
+    for i := range h.sites {
+        site := &h.sites[i]
+        if !matchesDomain(site.Domain, host) {
+            continue
+        }
+        for name, value := range site.Headers {
+            set(name, value)
+        }
+        if site.UserAgent != "" {
+            set("User-Agent", site.UserAgent)
+        }
+    }
+    return overridden
+}
+
+// headersTransport applies header overrides to every request, including
+// robots.txt, redirects, and form logins
+type headersTransport struct {
+    base      http.RoundTripper
+    overrides *HeaderOverrides
+}
+
+func (t *headersTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+    base := t.base
+    if base == nil {
+        base = http.DefaultTransport
+    }
+    return base.RoundTrip(t.overrides.apply(req))
+}
+
+// userAgentTransport sends the crawler's User-Agent with every request that
+// does not set its own
+type userAgentTransport struct {
+    base  http.RoundTripper
+    agent string
+}
+
+func (t *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+    base := t.base
+    if base == nil {
+        base = http.DefaultTransport
+    }
+    if req.Header.Get("User-Agent") == "" {
+        req = req.Clone(req.Context())
+        req.Header.Set("User-Agent", t.agent)
+    }
+    return base.RoundTrip(req)
+}
@@ -0,0 +1,611 @@
+package crawler
+
+import (
+    "container/heap"
+    "context"
+    "fmt"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+
+    "smart-crawler/models"
+)
+
+// DefaultHeapFrontierSize is how many URLs the in-memory frontier holds
+// before it spills the lowest priority ones to crawl_queue
+const DefaultHeapFrontierSize = 100000
+
+const (
+    // How often queued writes are persisted to crawl_queue
+    writeBehindInterval = time.Second
+    // Queued writes at which they are persisted without waiting
+    writeBehindBatch = 1000
+    // Least time between refills from crawl_queue while the heap has URLs
+    refillInterval = time.Second
+    // URLs claimed from crawl_queue per refill
+    refillBatch = 500
+    // Share of its size a spilling heap is cut back to, so it does not
+    // spill again on the next few adds
+    spillTarget = 0.75
+    // Pending URLs whose priorities fall in the same band of this width are
+    // handed out round-robin by parent, as crawl_queue does
+    heapFairnessBand = 10
+)
+
+// SetHeapFrontier serves the crawl_queue frontier from an in-memory priority
+// heap of up to size URLs, so pulls no longer query the database. URLs are
+// written to crawl_queue in the background, every second or every 1000
+// writes, so an interrupted crawl can still be resumed, less at most its
+// last second of discoveries. Past size URLs the lowest priority ones are
+// dropped from memory, and claimed back from crawl_queue once the heap runs
+// low; the URLs it has seen are remembered in sets that spill to disk past
+// size keys. The heap is private to this process: a session shared by
+// several instances needs a shared frontier, and holdout evaluation the
+// plain crawl_queue. 0, the default, turns it off.
+func (s *Smart) SetHeapFrontier(size int) {
+    s.heapSize = max(size, 0)
+}
+
+// queueFrontier reports whether the frontier is the store's crawl_queue,
+// served directly or through a heap
+func (s *Smart) queueFrontier() bool {
+    switch s.frontier.(type) {
+    case *dbFrontier, *heapFrontier:
+        return true
+    }
+    return false
+}
+
+// heapEntry is a URL in the heap frontier
+type heapEntry struct {
+    url     models.URLPriority
+    band    int
+    rank    int // URLs of the same parent queued in the band before it
+    seq     int64
+    index   int  // Position in the heap
+    claimed bool // Claimed from crawl_queue, so in_progress there
+    taken   bool // Handed out and not yet settled, so out of the heap
+}
+
+// queueKey is what crawl_queue holds a URL once by: its fingerprint, or the
+// URL itself when it has none
+func queueKey(url models.URLPriority) string {
+    if url.Fingerprint != "" {
+        return url.Fingerprint
+    }
+    return url.URL
+}
+
+// bandRanks counts the URLs of one parent queued in one band
+type bandRanks struct {
+    next   int // Rank of the next URL queued
+    queued int // URLs still in the heap
+}
+
+// urlHeap orders entries as crawl_queue hands them out: by band, then one
+// URL per parent in turn, then by priority and age
+type urlHeap []*heapEntry
+
+func (h urlHeap) Len() int {
+    return len(h)
+}
+
+func (h urlHeap) Less(i, j int) bool {
+    a, b := h[i], h[j]
+    switch {
+    case a.band != b.band:
+        return a.band > b.band
+    case a.rank != b.rank:
+        return a.rank < b.rank
+    case a.url.Priority != b.url.Priority:
+        return a.url.Priority > b.url.Priority
+    }
+    return a.seq < b.seq
+}
+
+func (h urlHeap) Swap(i, j int) {
+    h[i], h[j] = h[j], h[i]
+    h[i].index = i
+    h[j].index = j
+}
+
+func (h *urlHeap) Push(x interface{}) {
+    entry := x.(*heapEntry)
+    entry.index = len(*h)
+    *h = append(*h, entry)
+}
+
+func (h *urlHeap) Pop() interface{} {
+    old := *h
+    entry := old[len(old)-1]
+    old[len(old)-1] = nil
+    *h = old[:len(old)-1]
+    return entry
+}
+
+// queueWrite is a change to crawl_queue waiting to be persisted
+type queueWrite struct {
+    add     []models.URLPriority
+    done    string
+    release string
+}
+
+// heapFrontier serves a crawl's URLs from memory, keeping crawl_queue up to
+// date behind it. It remembers the fingerprint of every URL it has seen, and
+// of those it is done with, as crawl_queue's uniqueness would, so a URL and
+// its variants are queued once per crawl. Only the URLs it holds are kept
+// in memory as they are; the sets of those seen and done spill to disk like
+// the crawlers' seen sets, so its memory stays bounded however many URLs
+// the crawl discovers.
+type heapFrontier struct {
+    db      *dbFrontier
+    size    int
+    onError func(error)
+
+    mutex    sync.Mutex
+    heap     urlHeap
+    entries  map[string]*heapEntry // Queued and taken URLs
+    keys     map[string]*heapEntry // The same entries by queueKey
+    seenKeys *spillSet             // queueKey of every URL seen
+    doneKeys *spillSet             // queueKey of URLs done, failed, or pruned
+    ranks    map[string]*bandRanks // By band and parent, while it has URLs queued
+    seq      int64
+    stored   int // URLs pending in crawl_queue and not in the heap
+    refilled time.Time
+    writes   []queueWrite
+
+    ready      chan struct{} // Receives when URLs are added to the heap
+    flushMutex sync.Mutex    // Keeps flushes in order
+    wake       chan struct{}
+    done       chan struct{}
+    stopped    chan struct{}
+    closeOnce  sync.Once
+}
+
+// newHeapFrontier returns a heap frontier over the crawl_queue of the
+// running crawl, counting what a resumed crawl left there. Write errors are
+// reported as events.
+func (s *Smart) newHeapFrontier(ctx context.Context) (*heapFrontier, error) {
+    db := s.newDBFrontier()
+    stored, err := db.Pending()
+    if err != nil {
+        return nil, fmt.Errorf("failed to count queued URLs: %w", err)
+    }
+    f := &heapFrontier{
+        db:       db,
+        size:     s.heapSize,
+        entries:  make(map[string]*heapEntry),
+        keys:     make(map[string]*heapEntry),
+        seenKeys: newSpillSet(s.heapSize),
+        doneKeys: newSpillSet(s.heapSize),
+        ranks:    make(map[string]*bandRanks),
+        stored:   stored,
+        ready:    make(chan struct{}, 1),
+        wake:     make(chan struct{}, 1),
+        done:     make(chan struct{}),
+        stopped:  make(chan struct{}),
+        onError:  func(err error) {
+            s.emit(ctx, Event{Type: ErrorOccurred, Err: fmt.Errorf("failed to persist the frontier: %w", err)})
+        },
+    }
+    go f.writeBehind()
+    return f, nil
+}
+
+func (f *heapFrontier) Add(urls []models.URLPriority) error {
+    f.mutex.Lock()
+    var persist []models.URLPriority
+    added := false
+    for _, url := range urls {
+        key := queueKey(url)
+        if entry := f.keys[key]; entry != nil {
+            if entry.taken {
+                continue
+            }
+            // Raised like crawl_queue raises a queued URL
+            if url.Priority > entry.url.Priority {
+                f.unrank(entry)
+                entry.url.Priority = url.Priority
+                f.rank(entry)
+                heap.Fix(&f.heap, entry.index)
+            }
+            // A variant of a URL seen before counts as that URL
+            url.URL = entry.url.URL
+        } else if !f.seenKeys.testAndAdd(key) {
+            f.push(url, false)
+            added = true
+        } else if f.doneKeys.contains(key) {
+            continue
+        }
+        // Otherwise it is pending in crawl_queue only, which raises it by
+        // its fingerprint
+        persist = append(persist, url)
+    }
+    if len(persist) > 0 {
+        f.writes = append(f.writes, queueWrite{add: persist})
+    }
+    f.spill()
+    full := len(f.writes) >= writeBehindBatch
+    f.mutex.Unlock()
+
+    if added {
+        notify(f.ready)
+    }
+    if full {
+        notify(f.wake)
+    }
+    return nil
+}
+
+// push queues a URL in the heap
+func (f *heapFrontier) push(url models.URLPriority, claimed bool) {
+    f.seq++
+    entry := &heapEntry{url: url, seq: f.seq, claimed: claimed}
+    f.rank(entry)
+    heap.Push(&f.heap, entry)
+    f.entries[url.URL] = entry
+    f.keys[queueKey(url)] = entry
+}
+
+// forget drops an entry that is no longer queued or taken
+func (f *heapFrontier) forget(entry *heapEntry) {
+    delete(f.entries, entry.url.URL)
+    delete(f.keys, queueKey(entry.url))
+}
+
+// rank places an entry after the URLs its parent already has queued in its
+// band
+func (f *heapFrontier) rank(entry *heapEntry) {
+    entry.band = entry.url.Priority / heapFairnessBand
+    key := fmt.Sprintf("%d %s", entry.band, entry.url.Parent)
+    ranks := f.ranks[key]
+    if ranks == nil {
+        ranks = &bandRanks{}
+        f.ranks[key] = ranks
+    }
+    entry.rank = ranks.next
+    ranks.next++
+    ranks.queued++
+}
+
+// unrank counts an entry out of its band as it leaves the heap. Once its
+// parent has no URLs queued in the band, the band's ranks for it start over,
+// as crawl_queue ranks only pending URLs.
+func (f *heapFrontier) unrank(entry *heapEntry) {
+    key := fmt.Sprintf("%d %s", entry.band, entry.url.Parent)
+    ranks := f.ranks[key]
+    if ranks == nil {
+        return
+    }
+    ranks.queued--
+    if ranks.queued <= 0 {
+        delete(f.ranks, key)
+    }
+}
+
+// spill drops the lowest priority URLs from a heap grown past its size.
+// They are left to crawl_queue, releasing those claimed from it.
+func (f *heapFrontier) spill() {
+    if f.size <= 0 || len(f.heap) <= f.size {
+        return
+    }
+    sort.Sort(f.heap)
+    keep := int(float64(f.size) * spillTarget)
+    for _, entry := range f.heap[keep:] {
+        f.unrank(entry)
+        f.forget(entry)
+        f.stored++
+        if entry.claimed {
+            f.writes = append(f.writes, queueWrite{release: entry.url.URL})
+        }
+    }
+    clear(f.heap[keep:])
+    f.heap = f.heap[:keep]
+    // A sorted slice is a valid heap
+    for i, entry := range f.heap {
+        entry.index = i
+    }
+}
+
+func (f *heapFrontier) Next(limit int) ([]models.URLPriority, error) {
+    return f.NextExcept(limit, nil)
+}
+
+func (f *heapFrontier) NextExcept(limit int, hosts []string) ([]models.URLPriority, error) {
+    if err := f.refill(limit, hosts); err != nil {
+        return nil, err
+    }
+
+    f.mutex.Lock()
+    defer f.mutex.Unlock()
+
+    except := make(map[string]bool, len(hosts))
+    for _, host := range hosts {
+        except[host] = true
+    }
+    var urls []models.URLPriority
+    var passed []*heapEntry
+    for len(urls) < limit && len(f.heap) > 0 {
+        entry := heap.Pop(&f.heap).(*heapEntry)
+        if except[urlHost(entry.url.URL)] {
+            passed = append(passed, entry)
+            continue
+        }
+        entry.taken = true
+        f.unrank(entry)
+        urls = append(urls, entry.url)
+    }
+    for _, entry := range passed {
+        heap.Push(&f.heap, entry)
+    }
+    return urls, nil
+}
+
+// refill claims URLs back from crawl_queue when the heap cannot fill a pull
+// and URLs were left there, or when it is empty, which is also how the end
+// of the frontier and retries coming due are noticed. crawl_queue holds the
+// heap's URLs too and hands those out first, so they are claimed along the
+// way until the claims turn up URLs the heap lacks.
+func (f *heapFrontier) refill(limit int, hosts []string) error {
+    f.mutex.Lock()
+    due := len(f.heap) == 0 || (len(f.heap) < limit && f.stored > 0 && time.Since(f.refilled) >= refillInterval)
+    batch := refillBatch
+    if f.size > 0 {
+        batch = min(batch, f.size-len(f.heap))
+    }
+    batch = max(batch, limit)
+    f.mutex.Unlock()
+    if !due {
+        return nil
+    }
+
+    if err := f.flush(); err != nil {
+        return err
+    }
+    for {
+        urls, err := f.db.NextExcept(batch, hosts)
+        if err != nil {
+            return err
+        }
+
+        f.mutex.Lock()
+        f.refilled = time.Now()
+        added := 0
+        for _, url := range urls {
+            key := queueKey(url)
+            if entry := f.keys[key]; entry != nil {
+                // Released again should it be spilled or left unfetched
+                entry.claimed = true
+                continue
+            }
+            if f.seenKeys.testAndAdd(key) && f.doneKeys.contains(key) {
+                continue
+            }
+            // Spilled, released, or retrying, or left by a resumed crawl:
+            // counted as stored either way
+            f.stored = max(f.stored-1, 0)
+            f.push(url, true)
+            added++
+        }
+        f.spill()
+        f.mutex.Unlock()
+
+        if added > 0 || len(urls) < batch {
+            return nil
+        }
+    }
+}
+
+func (f *heapFrontier) Done(url string) error {
+    f.mutex.Lock()
+    defer f.mutex.Unlock()
+
+    key := url
+    if entry := f.entries[url]; entry != nil {
+        if !entry.taken {
+            heap.Remove(&f.heap, entry.index)
+            f.unrank(entry)
+        }
+        f.forget(entry)
+        key = queueKey(entry.url)
+    }
+    f.doneKeys.testAndAdd(key)
+    f.writes = append(f.writes, queueWrite{done: url})
+    return nil
+}
+
+func (f *heapFrontier) Fail(url, message string) (bool, error) {
+    // The URL's row may not be written yet
+    if err := f.flush(); err != nil {
+        return false, err
+    }
+    failed, err := f.db.Fail(url, message)
+    if err != nil {
+        return false, err
+    }
+
+    f.mutex.Lock()
+    defer f.mutex.Unlock()
+
+    key := url
+    if entry := f.entries[url]; entry != nil {
+        f.forget(entry)
+        key = queueKey(entry.url)
+    }
+    if failed {
+        f.doneKeys.testAndAdd(key)
+    } else {
+        // Claimed back from crawl_queue once its backoff has passed
+        f.stored++
+    }
+    return failed, nil
+}
+
+func (f *heapFrontier) Retrying() (bool, error) {
+    return f.db.Retrying()
+}
+
+// Pending counts the URLs in the heap and those left in crawl_queue
+func (f *heapFrontier) Pending() (int, error) {
+    f.mutex.Lock()
+    defer f.mutex.Unlock()
+
+    return len(f.heap) + f.stored, nil
+}
+
+// Release returns URLs handed out but not fetched to crawl_queue. Those
+// served from the heap were never claimed there and are pending already.
+func (f *heapFrontier) Release(urls []string) (int, error) {
+    if err := f.flush(); err != nil {
+        return 0, err
+    }
+
+    f.mutex.Lock()
+    var claimed []string
+    released := 0
+    for _, url := range urls {
+        entry := f.entries[url]
+        if entry == nil || !entry.taken {
+            continue
+        }
+        f.forget(entry)
+        f.stored++
+        if entry.claimed {
+            claimed = append(claimed, url)
+        } else {
+            released++
+        }
+    }
+    f.mutex.Unlock()
+
+    if len(claimed) == 0 {
+        return released, nil
+    }
+    n, err := f.db.Release(claimed)
+    return released + n, err
+}
+
+// Prune drops disallowed URLs from the heap and from what was left in
+// crawl_queue
+func (f *heapFrontier) Prune(origin string, disallowed func(url string) bool) (int, error) {
+    f.mutex.Lock()
+    var dropped []*heapEntry
+    for _, entry := range f.heap {
+        if strings.HasPrefix(entry.url.URL, origin) && disallowed(entry.url.URL) {
+            dropped = append(dropped, entry)
+        }
+    }
+    for _, entry := range dropped {
+        heap.Remove(&f.heap, entry.index)
+        f.unrank(entry)
+        f.forget(entry)
+        f.doneKeys.testAndAdd(queueKey(entry.url))
+        // Pending again, to be marked disallowed with the rest
+        if entry.claimed {
+            f.writes = append(f.writes, queueWrite{release: entry.url.URL})
+        }
+    }
+    f.mutex.Unlock()
+
+    // The dropped URLs are pending in crawl_queue too, and are marked there
+    // so a resumed crawl skips them as well
+    if err := f.flush(); err != nil {
+        return len(dropped), err
+    }
+    pruned, err := f.db.Prune(origin, disallowed)
+    if err != nil {
+        return len(dropped), err
+    }
+    stored := max(pruned-len(dropped), 0)
+
+    f.mutex.Lock()
+    f.stored = max(f.stored-stored, 0)
+    f.mutex.Unlock()
+    return len(dropped) + stored, nil
+}
+
+// writeBehind persists queued writes every writeBehindInterval, or sooner
+// once writeBehindBatch have queued, until the frontier is closed
+func (f *heapFrontier) writeBehind() {
+    defer close(f.stopped)
+    ticker := time.NewTicker(writeBehindInterval)
+    defer ticker.Stop()
+    for {
+        select {
+        case <-f.done:
+            return
+        case <-ticker.C:
+        case <-f.wake:
+        }
+        if err := f.flush(); err != nil {
+            f.onError(err)
+        }
+    }
+}
+
+// notify sends on a channel of one slot unless a value is waiting already
+func notify(ch chan struct{}) {
+    select {
+    case ch <- struct{}{}:
+    default:
+    }
+}
+
+// flush persists the queued writes in order, consecutive adds and releases
+// together. Those a failure stops are queued again, ahead of any made since.
+func (f *heapFrontier) flush() error {
+    f.flushMutex.Lock()
+    defer f.flushMutex.Unlock()
+
+    f.mutex.Lock()
+    writes := f.writes
+    f.writes = nil
+    f.mutex.Unlock()
+
+    for len(writes) > 0 {
+        n := 1
+        var err error
+        switch write := writes[0]; {
+        case write.add != nil:
+            var add []models.URLPriority
+            for n = 0; n < len(writes) && writes[n].add != nil; n++ {
+                add = append(add, writes[n].add...)
+            }
+            err = f.db.Add(add)
+        case write.done != "":
+            err = f.db.Done(write.done)
+        default:
+            var release []string
+            for n = 0; n < len(writes) && writes[n].release != ""; n++ {
+                release = append(release, writes[n].release)
+            }
+            _, err = f.db.Release(release)
+        }
+        if err != nil {
+            f.mutex.Lock()
+            f.writes = append(writes, f.writes...)
+            f.mutex.Unlock()
+            return err
+        }
+        writes = writes[n:]
+    }
+    return nil
+}
+
+// removeSpilled removes what the sets of URLs seen and done spilled to
+// disk, once the crawl is over
+func (f *heapFrontier) removeSpilled() {
+    f.seenKeys.close()
+    f.doneKeys.close()
+}
+
+// close persists the remaining writes and stops writing behind. The
+// frontier may still be used, writing through flushes of its own.
+func (f *heapFrontier) close() error {
+    f.closeOnce.Do(func() {
+        close(f.done)
+        <-f.stopped
+    })
+    return f.flush()
+}
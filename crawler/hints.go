@@ -0,0 +1,84 @@
+package crawler
+
+import (
+    "strconv"
+    "strings"
+
+    "github.com/PuerkitoBio/goquery"
+)
+
+// Site owners can steer the smart crawler from their own markup:
+//
+//   <meta name="smart-crawler" content="nofollow, priority=+10">
+//       page-wide: follow no links, or shift every link's priority
+//   <div data-crawler-ignore>...</div>
+//       skip the section for both content analysis and link discovery
+//   <a data-crawler-priority="90">, <nav data-crawler-priority="-20">
+//       set (absolute) or shift (signed) the priority of a link, or of every
+//       link inside the element
+const (
+    hintMetaSelector   = "meta[name='smart-crawler']"
+    hintIgnoreSelector = "[data-crawler-ignore]:not([data-crawler-ignore='false'])"
+    hintPriorityAttr   = "data-crawler-priority"
+)
+
+type pageHints struct {
+    nofollow       bool
+    priorityAdjust int
+}
+
+func parsePageHints(doc *goquery.Document) pageHints {
+    var hints pageHints
+
+    doc.Find(hintMetaSelector).Each(func(i int, sel *goquery.Selection) {
+        content, _ := sel.Attr("content")
+        for _, directive := range strings.Split(content, ",") {
+            directive = strings.ToLower(strings.TrimSpace(directive))
+            switch {
+            case directive == "nofollow":
+                hints.nofollow = true
+            case strings.HasPrefix(directive, "priority="):
+                if adjust, err := strconv.Atoi(strings.TrimPrefix(directive, "priority=")); err == nil {
+                    hints.priorityAdjust = adjust
+                }
+            }
+        }
+    })
+
+    return hints
+}
+
+// removeIgnoredSections drops sections marked data-crawler-ignore
+func removeIgnoredSections(doc *goquery.Document) {
+    doc.Find(hintIgnoreSelector).Remove()
+}
+
+// applyPriorityHint applies the closest data-crawler-priority on the link or
+// its ancestors. A signed value shifts priority; an unsigned one replaces it.
+func applyPriorityHint(sel *goquery.Selection, priority int) int {
+    hinted := sel.Closest("[" + hintPriorityAttr + "]")
+    if hinted.Length() == 0 {
+        return priority
+    }
+
+    raw := strings.TrimSpace(hinted.AttrOr(hintPriorityAttr, ""))
+    value, err := strconv.Atoi(raw)
+    if err != nil {
+        return priority
+    }
+
+    if strings.HasPrefix(raw, "+") || strings.HasPrefix(raw, "-") {
+        return priority + value
+    }
+    return value
+}
+
+func clampPriority(priority int) int {
+    if priority < 1 {
+        return 1
+    }
+    if priority > 100 {
+        return 100
+    }
+    return priority
+}
@@ -0,0 +1,211 @@
+package crawler
+
+import (
+    "net/url"
+    "sync"
+
+    "smart-crawler/models"
+)
+
+// DefaultHostConcurrency is how many of the smart crawler's fetches may be
+// under way against one host at a time
+const DefaultHostConcurrency = 4
+
+const (
+    // URLs a host may have waiting, as a multiple of its cap, before pulls
+    // pass over it
+    hostBacklogFactor = 2
+    // Claimed URLs waiting for workers, across hosts, at which pulls stop
+    maxQueuedURLs = 1000
+)
+
+// SetHostConcurrency caps how many fetches run against one host at once, so
+// a slow host holds at most that many workers while the others keep
+// fetching from other hosts. Workers take URLs from the hosts below their
+// cap in turn. A frontier that implements ShardedFrontier is not pulled from
+// for a host that already has twice its cap waiting. The default is
+// DefaultHostConcurrency; 0 lifts the cap.
+func (s *Smart) SetHostConcurrency(limit int) {
+    s.hostConcurrency = max(limit, 0)
+}
+
+// hostQueue holds the URLs claimed from the frontier until workers take
+// them, sharded by host. Its dispatcher hands them out on out in turn
+// across hosts, passing over hosts with limit fetches under way.
+type hostQueue struct {
+    limit int                     // Fetches per host; 0 for no limit
+    out   chan models.URLPriority // Closed once the queue is closed and empty
+    wake  chan struct{}
+
+    mutex  sync.Mutex
+    shards map[string]*hostShard
+    ring   []string // Hosts with URLs waiting, in turn order
+    next   int      // Position in ring of the host to take from next
+    queued int
+    closed bool
+}
+
+// hostShard is one host's part of a hostQueue
+type hostShard struct {
+    waiting  []models.URLPriority
+    inFlight int // Taken by workers and not yet done
+}
+
+func newHostQueue(limit int) *hostQueue {
+    q := &hostQueue{
+        limit:  limit,
+        out:    make(chan models.URLPriority),
+        wake:   make(chan struct{}, 1),
+        shards: make(map[string]*hostShard),
+    }
+    go q.dispatch()
+    return q
+}
+
+// urlHost is the host and port of rawURL, or rawURL itself when it has none
+func urlHost(rawURL string) string {
+    if parsed, err := url.Parse(rawURL); err == nil && parsed.Host != "" {
+        return parsed.Host
+    }
+    return rawURL
+}
+
+func (q *hostQueue) add(urls ...models.URLPriority) {
+    q.mutex.Lock()
+    for _, u := range urls {
+        host := urlHost(u.URL)
+        shard := q.shards[host]
+        if shard == nil {
+            shard = &hostShard{}
+            q.shards[host] = shard
+        }
+        if len(shard.waiting) == 0 {
+            q.ring = append(q.ring, host)
+        }
+        shard.waiting = append(shard.waiting, u)
+        q.queued++
+    }
+    q.mutex.Unlock()
+    q.signal()
+}
+
+// done frees the host slot of a URL taken from out, once its fetch has
+// settled
+func (q *hostQueue) done(rawURL string) {
+    host := urlHost(rawURL)
+    q.mutex.Lock()
+    if shard := q.shards[host]; shard != nil {
+        shard.inFlight--
+        if shard.inFlight <= 0 && len(shard.waiting) == 0 {
+            delete(q.shards, host)
+        }
+    }
+    q.mutex.Unlock()
+    q.signal()
+}
+
+// close lets the dispatcher hand out what is left, limits aside, and then
+// close out
+func (q *hostQueue) close() {
+    q.mutex.Lock()
+    q.closed = true
+    q.mutex.Unlock()
+    q.signal()
+}
+
+func (q *hostQueue) signal() {
+    select {
+    case q.wake <- struct{}{}:
+    default:
+    }
+}
+
+func (q *hostQueue) dispatch() {
+    defer close(q.out)
+    for {
+        u, ok, drained := q.take()
+        if drained {
+            return
+        }
+        if !ok {
+            <-q.wake
+            continue
+        }
+        q.out <- u
+    }
+}
+
+// take removes the next URL of the first host in turn below its limit, and
+// reports whether there was one, or whether the queue is closed and empty.
+// A closed queue ignores limits, as its URLs are only handed back.
+func (q *hostQueue) take() (models.URLPriority, bool, bool) {
+    q.mutex.Lock()
+    defer q.mutex.Unlock()
+
+    for i := range q.ring {
+        pos := (q.next + i) % len(q.ring)
+        host := q.ring[pos]
+        shard := q.shards[host]
+        if q.limit > 0 && shard.inFlight >= q.limit && !q.closed {
+            continue
+        }
+
+        u := shard.waiting[0]
+        shard.waiting = shard.waiting[1:]
+        shard.inFlight++
+        q.queued--
+        q.next = pos + 1
+        if len(shard.waiting) == 0 {
+            shard.waiting = nil
+            q.ring = append(q.ring[:pos], q.ring[pos+1:]...)
+            q.next = pos
+        }
+        if len(q.ring) > 0 {
+            q.next %= len(q.ring)
+        }
+        return u, true, false
+    }
+    return models.URLPriority{}, false, q.closed && q.queued == 0
+}
+
+// len is how many URLs are waiting
+func (q *hostQueue) len() int {
+    q.mutex.Lock()
+    defer q.mutex.Unlock()
+
+    return q.queued
+}
+
+// available is how many waiting URLs workers could take without waiting on
+// a fetch to finish
+func (q *hostQueue) available() int {
+    q.mutex.Lock()
+    defer q.mutex.Unlock()
+
+    if q.limit == 0 {
+        return q.queued
+    }
+    available := 0
+    for _, shard := range q.shards {
+        available += min(len(shard.waiting), max(q.limit-shard.inFlight, 0))
+    }
+    return available
+}
+
+// backlogged returns the hosts with enough URLs waiting that pulling more
+// of theirs would only crowd out other hosts
+func (q *hostQueue) backlogged() []string {
+    q.mutex.Lock()
+    defer q.mutex.Unlock()
+
+    if q.limit == 0 {
+        return nil
+    }
+    var hosts []string
+    for host, shard := range q.shards {
+        if len(shard.waiting) >= q.limit*hostBacklogFactor {
+            hosts = append(hosts, host)
+        }
+    }
+    return hosts
+}
@@ -0,0 +1,101 @@
+package crawler
+
+import (
+    "fmt"
+    "sort"
+    "strings"
+    "time"
+
+    "smart-crawler/models"
+)
+
+const (
+    // maxStatHosts is how many hosts a crawl keeps stats for; later hosts
+    // are added up under otherHosts, so a crawl fanning out across the web
+    // keeps its stats bounded
+    maxStatHosts = 10000
+    otherHosts   = "(other)"
+)
+
+// hostStats returns the stats of rawURL's host, adding them if need be
+func hostStats(stats *models.CrawlStats, rawURL string) *models.HostStats {
+    if stats.Hosts == nil {
+        stats.Hosts = make(map[string]*models.HostStats)
+    }
+    host := urlHost(rawURL)
+    if _, ok := stats.Hosts[host]; !ok && len(stats.Hosts) >= maxStatHosts {
+        host = otherHosts
+    }
+    hs := stats.Hosts[host]
+    if hs == nil {
+        hs = &models.HostStats{}
+        stats.Hosts[host] = hs
+    }
+    return hs
+}
+
+// recordHostPage counts a processed page against its host
+func recordHostPage(stats *models.CrawlStats, page *models.Page) {
+    hs := hostStats(stats, page.URL)
+    hs.Pages++
+    hs.Bytes += page.Size
+    // A running mean, so a checkpoint can resume it
+    loadTime := time.Duration(page.LoadTime) * time.Millisecond
+    hs.AvgLoadTime += (loadTime - hs.AvgLoadTime) / time.Duration(hs.Pages)
+}
+
+// recordHostError counts a failed fetch against its host
+func recordHostError(stats *models.CrawlStats, rawURL string) {
+    hostStats(stats, rawURL).Errors++
+}
+
+// recordHostSkip counts a page skipped for reason against its host
+func recordHostSkip(stats *models.CrawlStats, rawURL, reason string) {
+    hs := hostStats(stats, rawURL)
+    if hs.Skipped == nil {
+        hs.Skipped = make(map[string]int)
+    }
+    hs.Skipped[reason]++
+}
+
+// HostOrders are the orders SortHosts accepts
+var HostOrders = []string{"pages", "bytes", "errors", "skipped", "load_time"}
+
+// SortHosts lists hosts by order, largest first and then by name, or fails
+// if order is not one of HostOrders
+func SortHosts(hosts map[string]*models.HostStats, order string) ([]models.HostSummary, error) {
+    var key func(*models.HostStats) float64
+    switch order {
+    case "pages":
+        key = func(hs *models.HostStats) float64 { return float64(hs.Pages) }
+    case "bytes":
+        key = func(hs *models.HostStats) float64 { return float64(hs.Bytes) }
+    case "errors":
+        key = func(hs *models.HostStats) float64 { return float64(hs.Errors) }
+    case "skipped":
+        key = func(hs *models.HostStats) float64 {
+            skipped := 0
+            for _, n := range hs.Skipped {
+                skipped += n
+            }
+            return float64(skipped)
+        }
+    case "load_time":
+        key = func(hs *models.HostStats) float64 { return float64(hs.AvgLoadTime) }
+    default:
+        return nil, fmt.Errorf("invalid host order %q (want one of %s)", order, strings.Join(HostOrders, ", "))
+    }
+
+    summaries := make([]models.HostSummary, 0, len(hosts))
+    for host, hs := range hosts {
+        summaries = append(summaries, models.HostSummary{Host: host, HostStats: *hs})
+    }
+    sort.Slice(summaries, func(i, j int) bool {
+        a, b := key(&summaries[i].HostStats), key(&summaries[j].HostStats)
+        if a != b {
+            return a > b
+        }
+        return summaries[i].Host < summaries[j].Host
+    })
+    return summaries, nil
+}
@@ -0,0 +1,390 @@
+package crawler
+
+import (
+    "bytes"
+    "context"
+    "encoding/xml"
+    "errors"
+    "fmt"
+    "image"
+    _ "image/gif"
+    "image/jpeg"
+    _ "image/png"
+    "io"
+    "mime"
+    "net/http"
+    "net/url"
+    "strconv"
+    "strings"
+    "sync"
+
+    "github.com/PuerkitoBio/goquery"
+    _ "golang.org/x/image/bmp"
+    "golang.org/x/image/draw"
+    _ "golang.org/x/image/webp"
+    "golang.org/x/time/rate"
+
+    "smart-crawler/blobstore"
+    "smart-crawler/database"
+    "smart-crawler/models"
+)
+
+// Bytes fetched of an image to read its dimensions: enough for the headers
+// of every format, short of JPEGs carrying very large metadata
+const imageHeaderBytes = 64 << 10
+
+// Images of a page whose files are read at once
+const imageWorkers = 4
+
+// Most pixels an image may have for a thumbnail to be made of it, so a
+// small file cannot make the crawler decode a gigapixel canvas
+const maxThumbnailPixels = 40_000_000
+
+// DefaultThumbnailSize is the longest side of thumbnails, in pixels
+const DefaultThumbnailSize = 256
+
+// ImageOptions configures recording the images of crawled pages
+type ImageOptions struct {
+    // Where to store a JPEG thumbnail of each image; nil stores none and
+    // fetches only the start of image files
+    Thumbnails blobstore.Store
+    // Longest side of thumbnails in pixels; 0 for DefaultThumbnailSize
+    ThumbnailSize int
+}
+
+// WithImages records the <img> elements of the HTML pages a crawler saves
+// into the images table: their src, srcset, alt text, and width and height
+// attributes, with the dimensions, format, and size of the image file. Only
+// the start of each file is fetched, with a Range request, unless
+// thumbnails are stored, which needs the whole file. Each image is fetched
+// once per crawl, however many pages show it.
+func WithImages(images ImageOptions) Option {
+    return func(o *options) error {
+        if images.ThumbnailSize < 0 {
+            return errors.New("thumbnail size must not be negative")
+        }
+        if images.ThumbnailSize == 0 {
+            images.ThumbnailSize = DefaultThumbnailSize
+        }
+        o.images = &images
+        return nil
+    }
+}
+
+// imageRecorder reads the image files of a running crawl's pages
+type imageRecorder struct {
+    options ImageOptions
+    client  *http.Client
+    limiter *rate.Limiter
+    maxSize int64
+
+    mu    sync.Mutex
+    files map[string]*imageRead // Each image URL read or being read
+}
+
+// imageRead is a read of an image file, whose file is set once done closes
+type imageRead struct {
+    done chan struct{}
+    file imageFile
+}
+
+// imageFile is what an image file gave
+type imageFile struct {
+    width, height int
+    format        string
+    contentType   string
+    size          int64
+    thumbnailKey  string
+    err           string
+}
+
+func newImageRecorder(options *ImageOptions, client *http.Client, limiter *rate.Limiter, maxSize int64) *imageRecorder {
+    if options == nil {
+        return nil
+    }
+    return &imageRecorder{
+        options: *options,
+        client:  client,
+        limiter: limiter,
+        maxSize: maxSize,
+        files:   make(map[string]*imageRead),
+    }
+}
+
+// saveImages replaces the images of a freshly saved page with those it was
+// just found to show, when the crawl records images
+func saveImages(db database.Store, recorder *imageRecorder, page *models.Page) error {
+    if recorder == nil {
+        return nil
+    }
+    return db.SaveImages(page.CrawlID, page.ID, page.URL, page.Images)
+}
+
+// collect is the images of the page doc at pageURL, with what their files
+// give. Inline data: images are left out.
+func (r *imageRecorder) collect(ctx context.Context, doc *goquery.Document, pageURL string) []models.Image {
+    if r == nil {
+        return nil
+    }
+    base, err := url.Parse(pageURL)
+    if err != nil {
+        return nil
+    }
+    if href, ok := doc.Find("base[href]").First().Attr("href"); ok {
+        if parsed, err := base.Parse(strings.TrimSpace(href)); err == nil {
+            base = parsed
+        }
+    }
+
+    var images []models.Image
+    doc.Find("img").Each(func(_ int, el *goquery.Selection) {
+        src := strings.TrimSpace(el.AttrOr("src", ""))
+        srcset := strings.TrimSpace(el.AttrOr("srcset", ""))
+        // Lazy-loaded images keep their file in data- attributes until
+        // they scroll into view, showing a placeholder meanwhile
+        if lazy := strings.TrimSpace(el.AttrOr("data-src", "")); lazy != "" && (src == "" || strings.HasPrefix(src, "data:")) {
+            src = lazy
+        }
+        if srcset == "" {
+            srcset = strings.TrimSpace(el.AttrOr("data-srcset", ""))
+        }
+        if src == "" || strings.HasPrefix(src, "data:") {
+            return
+        }
+        ref, err := base.Parse(src)
+        if err != nil || ref.Scheme != "http" && ref.Scheme != "https" {
+            return
+        }
+        ref.Fragment = ""
+        images = append(images, models.Image{
+            Src:        ref.String(),
+            Srcset:     srcset,
+            Alt:        strings.Join(strings.Fields(el.AttrOr("alt", "")), " "),
+            HTMLWidth:  strings.TrimSpace(el.AttrOr("width", "")),
+            HTMLHeight: strings.TrimSpace(el.AttrOr("height", "")),
+        })
+    })
+
+    var wg sync.WaitGroup
+    slots := make(chan struct{}, imageWorkers)
+    for i := range images {
+        slots <- struct{}{}
+        wg.Add(1)
+        go func(image *models.Image) {
+            defer func() {
+                <-slots
+                wg.Done()
+            }()
+            file := r.file(ctx, image.Src)
+            image.Width, image.Height = file.width, file.height
+            image.Format, image.ContentType, image.Size = file.format, file.contentType, file.size
+            image.ThumbnailKey, image.Error = file.thumbnailKey, file.err
+        }(&images[i])
+    }
+    wg.Wait()
+    return images
+}
+
+// file is what the image file at src gives, read once per crawl: pages
+// showing an image being read wait for that read
+func (r *imageRecorder) file(ctx context.Context, src string) imageFile {
+    r.mu.Lock()
+    read, ok := r.files[src]
+    if !ok {
+        read = &imageRead{done: make(chan struct{})}
+        r.files[src] = read
+    }
+    r.mu.Unlock()
+    if ok {
+        select {
+        case <-read.done:
+            return read.file
+        case <-ctx.Done():
+            return imageFile{err: ctx.Err().Error()}
+        }
+    }
+
+    read.file = r.read(ctx, src)
+    // An image a cancelled crawl did not get to is read again next time
+    if ctx.Err() != nil {
+        r.mu.Lock()
+        delete(r.files, src)
+        r.mu.Unlock()
+    }
+    close(read.done)
+    return read.file
+}
+
+// read fetches the image file at src, only its start unless a thumbnail is
+// made of it
+func (r *imageRecorder) read(ctx context.Context, src string) imageFile {
+    var file imageFile
+    if err := r.limiter.Wait(ctx); err != nil {
+        file.err = err.Error()
+        return file
+    }
+    req, err := http.NewRequestWithContext(ctx, "GET", src, nil)
+    if err != nil {
+        file.err = err.Error()
+        return file
+    }
+    whole := r.options.Thumbnails != nil
+    if !whole {
+        req.Header.Set("Range", fmt.Sprintf("bytes=0-%d", imageHeaderBytes-1))
+    }
+    resp, err := r.client.Do(req)
+    if err != nil {
+        file.err = err.Error()
+        return file
+    }
+    defer resp.Body.Close()
+
+    switch {
+    case resp.StatusCode == http.StatusPartialContent:
+        // Content-Range: bytes 0-65535/1048576
+        if _, total, ok := strings.Cut(resp.Header.Get("Content-Range"), "/"); ok {
+            file.size, _ = strconv.ParseInt(total, 10, 64)
+        }
+    case resp.StatusCode >= 200 && resp.StatusCode < 300:
+        file.size = max(resp.ContentLength, 0)
+    default:
+        file.err = resp.Status
+        return file
+    }
+    file.contentType = resp.Header.Get("Content-Type")
+
+    // Servers ignoring Range send the whole file, of which only the start
+    // is read before the connection is dropped
+    var data []byte
+    var hash string
+    truncated := true
+    if whole {
+        read, err := readBody(resp.Body, r.maxSize, nil)
+        if err != nil {
+            file.err = err.Error()
+            return file
+        }
+        data, hash, truncated = read.data, read.hash, read.truncated
+        if !truncated {
+            file.size = int64(len(data))
+        }
+    } else if data, err = io.ReadAll(io.LimitReader(resp.Body, imageHeaderBytes)); err != nil {
+        file.err = err.Error()
+        return file
+    }
+
+    config, format, err := image.DecodeConfig(bytes.NewReader(data))
+    if err != nil {
+        if width, height, ok := svgSize(data, file.contentType); ok {
+            file.width, file.height, file.format = width, height, "svg"
+            return file
+        }
+        file.err = fmt.Sprintf("reading image: %v", err)
+        return file
+    }
+    file.width, file.height, file.format = config.Width, config.Height, format
+
+    if whole && !truncated && config.Width*config.Height <= maxThumbnailPixels {
+        if file.thumbnailKey, err = r.storeThumbnail(ctx, data, hash); err != nil {
+            file.err = err.Error()
+        }
+    }
+    return file
+}
+
+// storeThumbnail stores a JPEG of the image data scaled down to fit the
+// thumbnail size, on white where it is transparent, and returns its key.
+// It is keyed by the image's content hash, so an image at several URLs has
+// one thumbnail.
+func (r *imageRecorder) storeThumbnail(ctx context.Context, data []byte, hash string) (string, error) {
+    img, _, err := image.Decode(bytes.NewReader(data))
+    if err != nil {
+        return "", fmt.Errorf("decoding image: %w", err)
+    }
+    bounds := img.Bounds()
+    width, height := bounds.Dx(), bounds.Dy()
+    if width == 0 || height == 0 {
+        return "", errors.New("image is empty")
+    }
+    // Smaller images keep their size
+    if size := r.options.ThumbnailSize; width > size || height > size {
+        if width >= height {
+            width, height = size, max(height*size/width, 1)
+        } else {
+            width, height = max(width*size/height, 1), size
+        }
+    }
+
+    thumbnail := image.NewRGBA(image.Rect(0, 0, width, height))
+    draw.Draw(thumbnail, thumbnail.Bounds(), image.White, image.Point{}, draw.Src)
+    draw.CatmullRom.Scale(thumbnail, thumbnail.Bounds(), img, bounds, draw.Over, nil)
+    var buf bytes.Buffer
+    if err := jpeg.Encode(&buf, thumbnail, &jpeg.Options{Quality: 85}); err != nil {
+        return "", err
+    }
+
+    key := blobstore.ThumbnailKey(hash, "jpg")
+    if err := r.options.Thumbnails.Put(ctx, key, buf.Bytes()); err != nil {
+        return "", fmt.Errorf("storing thumbnail in %s: %w", r.options.Thumbnails, err)
+    }
+    return key, nil
+}
+
+// svgSize reads the dimensions of an SVG image from its root element's
+// width and height, or else its viewBox
+func svgSize(data []byte, contentType string) (int, int, bool) {
+    if media, _, _ := mime.ParseMediaType(contentType); media != "image/svg+xml" && !bytes.Contains(data, []byte("<svg")) {
+        return 0, 0, false
+    }
+    decoder := xml.NewDecoder(bytes.NewReader(data))
+    decoder.Strict = false
+    for {
+        token, err := decoder.Token()
+        if err != nil {
+            return 0, 0, false
+        }
+        root, ok := token.(xml.StartElement)
+        if !ok {
+            continue
+        }
+        if root.Name.Local != "svg" {
+            return 0, 0, false
+        }
+        var width, height float64
+        var viewBox string
+        for _, attr := range root.Attr {
+            switch attr.Name.Local {
+            case "width":
+                width = svgLength(attr.Value)
+            case "height":
+                height = svgLength(attr.Value)
+            case "viewBox":
+                viewBox = attr.Value
+            }
+        }
+        if width <= 0 || height <= 0 {
+            // min-x min-y width height
+            box := strings.Fields(strings.ReplaceAll(viewBox, ",", " "))
+            if len(box) != 4 {
+                return 0, 0, false
+            }
+            width, _ = strconv.ParseFloat(box[2], 64)
+            height, _ = strconv.ParseFloat(box[3], 64)
+        }
+        if width <= 0 || height <= 0 {
+            return 0, 0, false
+        }
+        return int(width + 0.5), int(height + 0.5), true
+    }
+}
+
+// svgLength is an SVG length in pixels; 0 for percentages and units other
+// than px
+func svgLength(value string) float64 {
+    value = strings.TrimSuffix(strings.TrimSpace(value), "px")
+    length, err := strconv.ParseFloat(value, 64)
+    if err != nil {
+        return 0
+    }
+    return length
+}
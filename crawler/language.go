@@ -0,0 +1,138 @@
+package crawler
+
+import (
+    "net/url"
+    "strings"
+    "sync/atomic"
+)
+
+// offLanguage is the FilteredURLs key for links dropped by language routing
+const offLanguage = "language (off-target)"
+
+const (
+    targetLanguageBoost = 10
+    offLanguagePenalty  = 30
+)
+
+// ISO 639-1 codes recognized as URL path segments, subdomains, and query
+// values. Two-letter segments outside this set, like /us/ or /my/, are not
+// taken as languages.
+var languageCodes = map[string]bool{
+    "ar": true, "bg": true, "bn": true, "ca": true, "cs": true, "da": true, "de": true,
+    "el": true, "en": true, "es": true, "et": true, "fa": true, "fi": true, "fr": true,
+    "he": true, "hi": true, "hr": true, "hu": true, "id": true, "it": true, "ja": true,
+    "ko": true, "lt": true, "lv": true, "ms": true, "nb": true, "nl": true, "no": true,
+    "pl": true, "pt": true, "ro": true, "ru": true, "sk": true, "sl": true, "sr": true,
+    "sv": true, "sw": true, "ta": true, "th": true, "tr": true, "uk": true, "ur": true,
+    "vi": true, "zh": true,
+}
+
+// Language names as language switchers label their links
+var languageNames = map[string]string{
+    "english": "en", "deutsch": "de", "français": "fr", "francais": "fr",
+    "español": "es", "espanol": "es", "italiano": "it", "português": "pt",
+    "portugues": "pt", "nederlands": "nl", "polski": "pl", "русский": "ru",
+    "українська": "uk", "svenska": "sv", "dansk": "da", "norsk": "no",
+    "suomi": "fi", "čeština": "cs", "magyar": "hu", "română": "ro",
+    "türkçe": "tr", "ελληνικά": "el", "العربية": "ar", "עברית": "he",
+    "हिन्दी": "hi", "日本語": "ja", "한국어": "ko", "中文": "zh",
+    "简体中文": "zh", "繁體中文": "zh", "tiếng việt": "vi", "bahasa indonesia": "id",
+    "ไทย": "th",
+}
+
+// Query parameters sites select the language with
+var languageParams = []string{"lang", "language", "hl", "locale"}
+
+// languageRouter scores links by the language their URL or anchor hints at,
+// so off-language pages are not fetched only to be discarded
+type languageRouter struct {
+    targets map[string]bool
+    strict  bool  // Drop off-language links instead of demoting them
+    dropped int64 // atomic
+}
+
+func newLanguageRouter(languages []string, strict bool) *languageRouter {
+    targets := make(map[string]bool)
+    for _, language := range languages {
+        if code := languageCode(language); code != "" {
+            targets[code] = true
+        }
+    }
+    if len(targets) == 0 {
+        return nil
+    }
+    return &languageRouter{targets: targets, strict: strict}
+}
+
+// route adjusts a link's priority by its language, or reports that the link
+// should be dropped. Links with no language hint are left alone.
+func (r *languageRouter) route(rawURL, hreflang, anchor string, priority int) (int, bool) {
+    if r == nil {
+        return priority, true
+    }
+    language := detectLinkLanguage(rawURL, hreflang, anchor)
+    switch {
+    case language == "":
+        return priority, true
+    case r.targets[language]:
+        return priority + targetLanguageBoost, true
+    case r.strict:
+        atomic.AddInt64(&r.dropped, 1)
+        return priority, false
+    }
+    return priority - offLanguagePenalty, true
+}
+
+func (r *languageRouter) droppedCount() int {
+    if r == nil {
+        return 0
+    }
+    return int(atomic.LoadInt64(&r.dropped))
+}
+
+// detectLinkLanguage returns the language a link leads to, from the most
+// explicit hint available: its hreflang, a language path prefix, subdomain,
+// or query parameter, or an anchor naming a language. It returns "" when
+// nothing hints at one.
+func detectLinkLanguage(rawURL, hreflang, anchor string) string {
+    if code := languageCode(hreflang); code != "" {
+        return code
+    }
+
+    if parsed, err := url.Parse(rawURL); err == nil {
+        // Only "de" or "de-at" style segments, not /it-services/
+        segment := strings.SplitN(strings.TrimPrefix(parsed.Path, "/"), "/", 2)[0]
+        if len(segment) == 2 || (len(segment) == 5 && strings.ContainsAny(segment[2:3], "-_")) {
+            if code := languageCode(segment); code != "" {
+                return code
+            }
+        }
+
+        labels := strings.Split(parsed.Hostname(), ".")
+        if len(labels) > 2 && languageCodes[strings.ToLower(labels[0])] {
+            return strings.ToLower(labels[0])
+        }
+
+        query := parsed.Query()
+        for _, param := range languageParams {
+            if code := languageCode(query.Get(param)); code != "" {
+                return code
+            }
+        }
+    }
+
+    return languageNames[strings.ToLower(strings.TrimSpace(anchor))]
+}
+
+// languageCode reduces a language tag like "de", "de-AT", or "pt_BR" to its
+// recognized ISO 639-1 code, or ""
+func languageCode(tag string) string {
+    tag = strings.ToLower(strings.TrimSpace(tag))
+    if i := strings.IndexAny(tag, "-_"); i >= 0 {
+        tag = tag[:i]
+    }
+    if languageCodes[tag] {
+        return tag
+    }
+    return ""
+}
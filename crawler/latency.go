@@ -0,0 +1,157 @@
+package crawler
+
+import (
+    "math"
+    "sort"
+    "time"
+
+    "smart-crawler/models"
+)
+
+const (
+    // latencyGrowth is the ratio between the bounds of neighbouring latency
+    // buckets, so a percentile is within half a percent of the true value
+    latencyGrowth = 1.01
+    // throughputWindow is the first width of a crawl's throughput windows
+    throughputWindow = 10 * time.Second
+    // throughputWindows is how many windows a crawl keeps; a longer crawl
+    // merges neighbouring ones, doubling their width
+    throughputWindows = 120
+)
+
+// recordPage adds a processed page to the counts that carry over into a
+// resumed crawl: its status code and the running average load time.
+// PagesProcessed must already count it.
+func recordPage(stats *models.CrawlStats, page *models.Page) {
+    if page.StatusCode != 0 {
+        if stats.StatusCodes == nil {
+            stats.StatusCodes = make(map[int]int)
+        }
+        stats.StatusCodes[page.StatusCode]++
+    }
+    if stats.PagesProcessed > 0 {
+        loadTime := time.Duration(page.LoadTime) * time.Millisecond
+        stats.AvgLoadTime += (loadTime - stats.AvgLoadTime) / time.Duration(stats.PagesProcessed)
+    }
+}
+
+// loadRecorder keeps the load time distribution and throughput of one run
+// of a crawl in bounded memory: load times in a histogram of logarithmic
+// buckets, and pages and bytes in windows that widen as the run goes on.
+// Pages are recorded from one goroutine.
+type loadRecorder struct {
+    start   time.Time
+    buckets map[int]int // Load times by bucket; values under a microsecond in bucket -1
+    count   int
+    max     time.Duration
+
+    width   time.Duration
+    windows []throughputCount
+}
+
+type throughputCount struct {
+    pages int
+    bytes int64
+}
+
+func newLoadRecorder() *loadRecorder {
+    return &loadRecorder{start: time.Now(), buckets: make(map[int]int), width: throughputWindow}
+}
+
+func (r *loadRecorder) add(page *models.Page) {
+    loadTime := time.Duration(page.LoadTime) * time.Millisecond
+    r.buckets[latencyBucket(loadTime)]++
+    r.count++
+    r.max = max(r.max, loadTime)
+
+    i := int(time.Since(r.start) / r.width)
+    for i >= throughputWindows {
+        r.widen()
+        i = int(time.Since(r.start) / r.width)
+    }
+    for len(r.windows) <= i {
+        r.windows = append(r.windows, throughputCount{})
+    }
+    r.windows[i].pages++
+    r.windows[i].bytes += page.Size
+}
+
+// widen merges each pair of windows into one twice as wide
+func (r *loadRecorder) widen() {
+    merged := make([]throughputCount, (len(r.windows)+1)/2)
+    for i, window := range r.windows {
+        merged[i/2].pages += window.pages
+        merged[i/2].bytes += window.bytes
+    }
+    r.windows = merged
+    r.width *= 2
+}
+
+// latencyBucket is the bucket d falls in
+func latencyBucket(d time.Duration) int {
+    micros := float64(d) / float64(time.Microsecond)
+    if micros < 1 {
+        return -1
+    }
+    return int(math.Log(micros) / math.Log(latencyGrowth))
+}
+
+// latencyOf is the middle of a bucket, in milliseconds
+func latencyOf(bucket int) float64 {
+    if bucket < 0 {
+        return 0
+    }
+    low := math.Pow(latencyGrowth, float64(bucket))
+    return low * (1 + latencyGrowth) / 2 / 1000
+}
+
+// finish sets the run's load time percentiles, rates, and throughput
+// windows on stats
+func (r *loadRecorder) finish(stats *models.CrawlStats) {
+    elapsed := time.Since(r.start)
+    var pages int
+    var bytes int64
+    stats.Throughput = nil
+    for i, window := range r.windows {
+        end := time.Duration(i+1) * r.width
+        seconds := r.width.Seconds()
+        if end > elapsed {
+            seconds = (elapsed - time.Duration(i)*r.width).Seconds()
+            end = elapsed
+        }
+        sample := models.ThroughputSample{Elapsed: end, Pages: window.pages, Bytes: window.bytes}
+        if seconds > 0 {
+            sample.PagesPerSecond = float64(window.pages) / seconds
+            sample.BytesPerSecond = float64(window.bytes) / seconds
+        }
+        stats.Throughput = append(stats.Throughput, sample)
+        pages += window.pages
+        bytes += window.bytes
+    }
+    if seconds := elapsed.Seconds(); seconds > 0 {
+        stats.PagesPerSecond = float64(pages) / seconds
+        stats.BytesPerSecond = float64(bytes) / seconds
+    }
+
+    stats.Latency = nil
+    if r.count == 0 {
+        return
+    }
+    buckets := make([]int, 0, len(r.buckets))
+    for bucket := range r.buckets {
+        buckets = append(buckets, bucket)
+    }
+    sort.Ints(buckets)
+    // The nearest rank, like the fetch timing percentiles
+    rank := func(p float64) float64 {
+        target := max(int(math.Ceil(p*float64(r.count))), 1)
+        seen := 0
+        for _, bucket := range buckets {
+            if seen += r.buckets[bucket]; seen >= target {
+                return min(latencyOf(bucket), milliseconds(r.max))
+            }
+        }
+        return milliseconds(r.max)
+    }
+    stats.Latency = &models.Percentiles{P50: rank(0.5), P90: rank(0.9), P99: rank(0.99), Max: milliseconds(r.max)}
+}
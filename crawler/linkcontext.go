@@ -0,0 +1,207 @@
+package crawler
+
+import (
+    "strings"
+
+    "github.com/PuerkitoBio/goquery"
+    "golang.org/x/net/html"
+
+    "smart-crawler/models"
+)
+
+const (
+    linkContextWords   = 20 // Words kept on each side of a link
+    maxContextLevels   = 3  // Ancestors climbed for surrounding text
+    maxContextSiblings = 20 // Siblings looked at per level
+    maxHeadingLevels   = 10 // Ancestors climbed for the section heading
+    maxClassHints      = 10 // CSS classes kept per link
+)
+
+// Anchors that say nothing about their target, so the surrounding text is
+// scored instead
+var genericAnchors = map[string]bool{
+    "": true, "here": true, "click here": true, "more": true, "read more": true,
+    "learn more": true, "see more": true, "continue": true, "continue reading": true,
+    "details": true, "more details": true, "view": true, "link": true, "this": true,
+    "go": true, "full story": true, "read the full story": true, "next": true,
+}
+
+// Elements whose text belongs to them alone, so surrounding text is not
+// looked for beyond them
+var contextBoundaries = map[string]bool{
+    "body": true, "main": true, "section": true, "article": true, "aside": true,
+    "nav": true, "header": true, "footer": true, "form": true, "li": true, "td": true, "th": true,
+}
+
+// extractLinkContext captures a link's anchor and the text around it: the
+// words just before and after it, looking up to a few ancestors within the
+// same section or list item when its own siblings have too few, and the
+// heading of the section it is in
+func extractLinkContext(sel *goquery.Selection) models.LinkContext {
+    rel, _ := sel.Attr("rel")
+    anchor := strings.Join(strings.Fields(sel.Text()), " ")
+    if anchor == "" {
+        // Image links are described by their alt text
+        alt, _ := sel.Find("img[alt]").First().Attr("alt")
+        anchor = strings.Join(strings.Fields(alt), " ")
+    }
+
+    node := sel.Get(0)
+    return models.LinkContext{
+        Anchor:  anchor,
+        Rel:     rel,
+        Before:  wordsAround(node, false),
+        After:   wordsAround(node, true),
+        Heading: sectionHeading(node),
+        Classes: classHints(node),
+    }
+}
+
+// classHints lists the CSS classes of a link and of the few ancestors it is
+// styled within, nearest first, like "btn-next pagination". They tell
+// navigation, footers, and buttons apart where the markup is otherwise alike.
+func classHints(n *html.Node) string {
+    var classes []string
+    seen := make(map[string]bool)
+    for level := 0; n != nil && n.Type == html.ElementNode && level <= maxContextLevels; level++ {
+        for _, attr := range n.Attr {
+            if attr.Key != "class" {
+                continue
+            }
+            for _, class := range strings.Fields(attr.Val) {
+                if !seen[class] && len(classes) < maxClassHints {
+                    seen[class] = true
+                    classes = append(classes, class)
+                }
+            }
+        }
+        if n.Data == "body" {
+            break
+        }
+        n = n.Parent
+    }
+    return strings.Join(classes, " ")
+}
+
+// isGenericAnchor reports whether anchor text carries no signal of its own
+func isGenericAnchor(anchor string) bool {
+    normalized := strings.Trim(strings.ToLower(anchor), " .…»›→>:!")
+    return genericAnchors[normalized] || len([]rune(normalized)) < 3
+}
+
+// scoringText is what a link's keywords are judged on: its anchor, or the
+// text around it when the anchor is generic
+func scoringText(link models.LinkContext) string {
+    if !isGenericAnchor(link.Anchor) {
+        return link.Anchor
+    }
+    return strings.Join([]string{link.Heading, link.Before, link.After}, " ")
+}
+
+// wordsAround collects up to linkContextWords words next to n, after it when
+// forward and before it otherwise
+func wordsAround(n *html.Node, forward bool) string {
+    var words []string
+    for level := 0; n != nil && level < maxContextLevels && len(words) < linkContextWords; level++ {
+        sibling := n.PrevSibling
+        if forward {
+            sibling = n.NextSibling
+        }
+        for i := 0; sibling != nil && i < maxContextSiblings && len(words) < linkContextWords; i++ {
+            words = collectWords(sibling, forward, words, linkContextWords)
+            if forward {
+                sibling = sibling.NextSibling
+            } else {
+                sibling = sibling.PrevSibling
+            }
+        }
+
+        n = n.Parent
+        if n == nil || n.Type != html.ElementNode || contextBoundaries[n.Data] {
+            break
+        }
+    }
+
+    if !forward {
+        // Collected nearest first
+        for i, j := 0, len(words)-1; i < j; i, j = i+1, j-1 {
+            words[i], words[j] = words[j], words[i]
+        }
+    }
+    return strings.Join(words, " ")
+}
+
+// collectWords appends the words of n's text until there are limit, walking
+// from its start when forward and from its end otherwise
+func collectWords(n *html.Node, forward bool, words []string, limit int) []string {
+    switch n.Type {
+    case html.TextNode:
+        fields := strings.Fields(n.Data)
+        for i := range fields {
+            if len(words) >= limit {
+                break
+            }
+            if forward {
+                words = append(words, fields[i])
+            } else {
+                words = append(words, fields[len(fields)-1-i])
+            }
+        }
+        return words
+    case html.ElementNode:
+        if n.Data == "script" || n.Data == "style" || n.Data == "noscript" {
+            return words
+        }
+    }
+
+    child := n.LastChild
+    if forward {
+        child = n.FirstChild
+    }
+    for child != nil && len(words) < limit {
+        words = collectWords(child, forward, words, limit)
+        if forward {
+            child = child.NextSibling
+        } else {
+            child = child.PrevSibling
+        }
+    }
+    return words
+}
+
+// sectionHeading returns the nearest heading above n: a preceding sibling of
+// n or of one of its ancestors that is a heading or a header holding one
+func sectionHeading(n *html.Node) string {
+    for level := 0; n != nil && level < maxHeadingLevels; level++ {
+        sibling := n.PrevSibling
+        for i := 0; sibling != nil && i < maxContextSiblings; i++ {
+            if heading := headingOf(sibling); heading != nil {
+                return strings.Join(collectWords(heading, true, nil, linkContextWords), " ")
+            }
+            sibling = sibling.PrevSibling
+        }
+
+        n = n.Parent
+        if n == nil || n.Type != html.ElementNode || n.Data == "body" {
+            break
+        }
+    }
+    return ""
+}
+
+func headingOf(n *html.Node) *html.Node {
+    if n.Type != html.ElementNode {
+        return nil
+    }
+    switch n.Data {
+    case "h1", "h2", "h3", "h4", "h5", "h6":
+        return n
+    case "header", "hgroup":
+        for child := n.FirstChild; child != nil; child = child.NextSibling {
+            if heading := headingOf(child); heading != nil {
+                return heading
+            }
+        }
+    }
+    return nil
+}
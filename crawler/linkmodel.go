@@ -0,0 +1,286 @@
+package crawler
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "math"
+    "net/url"
+    "os"
+    "path"
+    "path/filepath"
+    "strings"
+    "sync"
+    "unicode"
+
+    "github.com/PuerkitoBio/goquery"
+
+    "smart-crawler/models"
+)
+
+const (
+    // linkLearningRate is the step of each online update
+    linkLearningRate = 0.05
+    // linkRegularization shrinks the weights a feature updates, so rare
+    // features do not run away on a few pages
+    linkRegularization = 1e-4
+    // maxLinkFeatures is how many features a model learns weights for;
+    // features first seen after that are ignored, so a crawl across the web
+    // keeps the model bounded
+    maxLinkFeatures = 200000
+    // maxPendingLinks is how many queued links a model remembers the
+    // features of until their pages are fetched; the oldest are forgotten
+    maxPendingLinks = 100000
+    // linkModelVersion is the format of saved models
+    linkModelVersion = 1
+)
+
+// LinkModel predicts how good the page behind a link will be from the
+// link's features: the words of its anchor and URL path, the quality of the
+// page it is on, and where on that page it sits. It is a logistic regression
+// learned online: each fetched HTML page's content quality is the label of
+// the link it was found through. It learns on top of the priority rules,
+// which it starts from untrained. Save and LoadLinkModel carry it across
+// crawls. A LinkModel is safe for concurrent use.
+type LinkModel struct {
+    mutex   sync.Mutex
+    weights map[string]float64
+    bias    float64
+    updates int64
+    loss    float64 // Running mean absolute error of the predictions learned from
+
+    pending map[string]pendingLink // Queued links, by URL
+    order   []string               // Pending URLs, oldest first
+}
+
+// pendingLink is a queued link the model will learn from once its page is
+// fetched
+type pendingLink struct {
+    features []string
+    offset   float64 // What the priority rules added to its logit
+}
+
+// LinkModelStats summarizes what a model has learned
+type LinkModelStats struct {
+    Features  int     `json:"features"`
+    Updates   int64   `json:"updates"`
+    MeanError float64 `json:"mean_error"` // Recent mean absolute error of its predictions, 0-1
+}
+
+// linkModelFile is the saved form of a model
+type linkModelFile struct {
+    Version   int                `json:"version"`
+    Bias      float64            `json:"bias"`
+    Updates   int64              `json:"updates"`
+    MeanError float64            `json:"mean_error"`
+    Weights   map[string]float64 `json:"weights"`
+}
+
+// NewLinkModel returns an untrained model, which ranks links by the
+// priority rules alone until it has learned otherwise
+func NewLinkModel() *LinkModel {
+    return &LinkModel{weights: make(map[string]float64), pending: make(map[string]pendingLink)}
+}
+
+// LoadLinkModel reads a model saved by Save. A missing file is returned as
+// an error satisfying os.IsNotExist.
+func LoadLinkModel(path string) (*LinkModel, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+    var file linkModelFile
+    if err := json.Unmarshal(data, &file); err != nil {
+        return nil, fmt.Errorf("%s: %w", path, err)
+    }
+    if file.Version != linkModelVersion {
+        return nil, fmt.Errorf("%s: unsupported link model version %d", path, file.Version)
+    }
+    m := NewLinkModel()
+    m.bias, m.updates, m.loss = file.Bias, file.Updates, file.MeanError
+    for feature, weight := range file.Weights {
+        m.weights[feature] = weight
+    }
+    return m, nil
+}
+
+// Save writes the model's weights to path, replacing it whole
+func (m *LinkModel) Save(path string) error {
+    m.mutex.Lock()
+    file := linkModelFile{Version: linkModelVersion, Bias: m.bias, Updates: m.updates, MeanError: m.loss, Weights: make(map[string]float64, len(m.weights))}
+    for feature, weight := range m.weights {
+        if weight != 0 {
+            file.Weights[feature] = weight
+        }
+    }
+    m.mutex.Unlock()
+    data, err := json.MarshalIndent(file, "", "  ")
+    if err != nil {
+        return err
+    }
+
+    // Write beside the file and rename, so a crash never leaves it half
+    // written
+    tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+    if err != nil {
+        return err
+    }
+    defer os.Remove(tmp.Name())
+    if _, err := tmp.Write(data); err != nil {
+        tmp.Close()
+        return err
+    }
+    if err := tmp.Close(); err != nil {
+        return err
+    }
+    return os.Rename(tmp.Name(), path)
+}
+
+// Stats summarizes what the model has learned
+func (m *LinkModel) Stats() LinkModelStats {
+    m.mutex.Lock()
+    defer m.mutex.Unlock()
+    return LinkModelStats{Features: len(m.weights), Updates: m.updates, MeanError: m.loss}
+}
+
+// WithLinkModel ranks the smart crawler's links with model, which learns
+// from the crawl, instead of a new untrained one
+func WithLinkModel(model *LinkModel) Option {
+    return func(o *options) error {
+        if model == nil {
+            return errors.New("link model must not be nil")
+        }
+        o.linkModel = model
+        return nil
+    }
+}
+
+// predict is the quality, 0 to 1, the model expects of the page behind a
+// link with features, offset by the priority rules' logit
+func (m *LinkModel) predict(features []string, offset float64) float64 {
+    m.mutex.Lock()
+    defer m.mutex.Unlock()
+    return m.score(features, offset)
+}
+
+// score is predict with the mutex held
+func (m *LinkModel) score(features []string, offset float64) float64 {
+    z := m.bias + offset
+    for _, feature := range features {
+        z += m.weights[feature]
+    }
+    return 1 / (1 + math.Exp(-z))
+}
+
+// remember keeps the features of a link to rawURL until its page is
+// fetched. The first link found to a URL is the one that queued it.
+func (m *LinkModel) remember(rawURL string, features []string, offset float64) {
+    m.mutex.Lock()
+    defer m.mutex.Unlock()
+    if _, ok := m.pending[rawURL]; ok {
+        return
+    }
+    m.pending[rawURL] = pendingLink{features: features, offset: offset}
+    m.order = append(m.order, rawURL)
+    for len(m.pending) > maxPendingLinks && len(m.order) > 0 {
+        delete(m.pending, m.order[0])
+        m.order = m.order[1:]
+    }
+    // Drop the forgotten and learned URLs the queue still holds once they
+    // make up most of it
+    if len(m.order) > 2*len(m.pending)+1024 {
+        kept := make([]string, 0, len(m.pending))
+        for _, u := range m.order {
+            if _, ok := m.pending[u]; ok {
+                kept = append(kept, u)
+            }
+        }
+        m.order = kept
+    }
+}
+
+// learn updates the model with the quality of the page fetched from rawURL,
+// the label of the link that queued it. URLs the model has no features
+// for, like seeds, are ignored.
+func (m *LinkModel) learn(rawURL string, quality float64) {
+    m.mutex.Lock()
+    defer m.mutex.Unlock()
+    link, ok := m.pending[rawURL]
+    if !ok {
+        return
+    }
+    delete(m.pending, rawURL)
+
+    // Cross-entropy with the quality as a soft label
+    predicted := m.score(link.features, link.offset)
+    gradient := quality - predicted
+    m.bias += linkLearningRate * gradient
+    for _, feature := range link.features {
+        weight, known := m.weights[feature]
+        if !known && len(m.weights) >= maxLinkFeatures {
+            continue
+        }
+        m.weights[feature] = weight + linkLearningRate*(gradient-linkRegularization*weight)
+    }
+    m.updates++
+    m.loss += (math.Abs(gradient) - m.loss) / float64(min(m.updates, 1000))
+}
+
+// linkFeatures describes a link for the model: the words of its anchor, or
+// of its context when the anchor is generic, and of its URL path; its rel
+// and classes; the region of the page it sits in; and the quality and
+// importance of that page
+func linkFeatures(sel *goquery.Selection, text models.LinkContext, linkURL, pageURL string, pageContext models.URLContext) []string {
+    seen := make(map[string]bool)
+    var features []string
+    add := func(feature string) {
+        if !seen[feature] {
+            seen[feature] = true
+            features = append(features, feature)
+        }
+    }
+
+    for term := range topicTerms(scoringText(text)) {
+        add("anchor:" + term)
+    }
+    if parsed, err := url.Parse(linkURL); err == nil {
+        for _, segment := range strings.FieldsFunc(strings.ToLower(parsed.Path), func(r rune) bool {
+            return !unicode.IsLetter(r)
+        }) {
+            if len(segment) > 1 && !stopWords[segment] {
+                add("path:" + stemTerm(segment))
+            }
+        }
+        if ext := path.Ext(parsed.Path); ext != "" {
+            add("ext:" + strings.ToLower(ext))
+        }
+        if parsed.RawQuery != "" {
+            add("query")
+        }
+        if parsed.Hostname() != urlHost(pageURL) {
+            add("external")
+        }
+        add(fmt.Sprintf("segments:%d", min(strings.Count(strings.Trim(parsed.Path, "/"), "/")+1, 5)))
+    }
+    for _, rel := range strings.Fields(strings.ToLower(text.Rel)) {
+        add("rel:" + rel)
+    }
+    for _, class := range strings.Fields(strings.ToLower(text.Classes)) {
+        for _, hint := range []string{"nav", "menu", "content", "article", "footer", "sidebar", "button", "tag", "share"} {
+            if strings.Contains(class, hint) {
+                add("class:" + hint)
+            }
+        }
+    }
+    if sel != nil {
+        region := "body"
+        if ancestor := sel.Closest("nav, header, footer, aside, main, article"); ancestor.Length() > 0 {
+            region = goquery.NodeName(ancestor)
+        }
+        add("region:" + region)
+    }
+    // Page scores in fifths
+    add(fmt.Sprintf("quality:%d", int(math.Min(pageContext.ContentQuality, 0.99)*5)))
+    add(fmt.Sprintf("importance:%d", int(math.Min(pageContext.Importance, 0.99)*5)))
+    return features
+}
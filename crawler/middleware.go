@@ -0,0 +1,82 @@
+package crawler
+
+import (
+    "crypto/md5"
+    "errors"
+    "fmt"
+    "net/http"
+)
+
+// ErrSkip is returned by a request hook to skip a URL, or by a response hook
+// to drop a response, without it counting as an error. Hooks may wrap it to
+// say why.
+var ErrSkip = errors.New("skipped by middleware")
+
+// RequestHook runs before each request the smart crawler sends, HEAD as well
+// as GET, after the crawler has set its own headers. It may change req's
+// headers. Returning ErrSkip skips the URL; any other error fails it.
+type RequestHook func(req *http.Request) error
+
+// Response is a response as response hooks see it
+type Response struct {
+    Request    *http.Request // The last request, after any redirects
+    StatusCode int
+    Header     http.Header
+    Body       []byte // nil when no content handler wants the content type
+}
+
+// ResponseHook runs on each response the smart crawler fetches, before its
+// content is handled; a page revisited unchanged has no response to run on.
+// It may replace Body or change Header, and what it leaves is what is
+// handled and saved. Returning ErrSkip drops the page; any other error
+// fails it.
+type ResponseHook func(resp *Response) error
+
+// AddRequestHook adds hook to the hooks run before each request, in the
+// order they were added, so cross-cutting concerns like signing requests or
+// filtering URLs compose without changing the crawler. Add hooks before
+// crawling.
+func (s *Smart) AddRequestHook(hook RequestHook) {
+    s.requestHooks = append(s.requestHooks, hook)
+}
+
+// AddResponseHook adds hook to the hooks run on each response, in the order
+// they were added. Add hooks before crawling.
+func (s *Smart) AddResponseHook(hook ResponseHook) {
+    s.responseHooks = append(s.responseHooks, hook)
+}
+
+// beforeRequest runs the request hooks on req, stopping at the first error
+func (s *Smart) beforeRequest(req *http.Request) error {
+    for _, hook := range s.requestHooks {
+        if err := hook(req); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// afterResponse runs the response hooks on fetched, stopping at the first
+// error, and takes back what they changed
+func (s *Smart) afterResponse(fetched *fetchResponse) error {
+    if len(s.responseHooks) == 0 {
+        return nil
+    }
+    resp := &Response{
+        Request:    fetched.Request,
+        StatusCode: fetched.StatusCode,
+        Header:     fetched.Header,
+        Body:       fetched.Body,
+    }
+    for _, hook := range s.responseHooks {
+        if err := hook(resp); err != nil {
+            return err
+        }
+    }
+    fetched.Header = resp.Header
+    if fetched.Handler != nil {
+        fetched.Body = resp.Body
+        fetched.BodyHash = fmt.Sprintf("%x", md5.Sum(resp.Body))
+    }
+    return nil
+}
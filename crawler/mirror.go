@@ -0,0 +1,474 @@
+package crawler
+
+import (
+    "bytes"
+    "context"
+    "crypto/sha1"
+    "encoding/hex"
+    "fmt"
+    "mime"
+    "net/http"
+    "net/url"
+    "os"
+    pathpkg "path"
+    "path/filepath"
+    "regexp"
+    "strings"
+    "sync"
+
+    "github.com/PuerkitoBio/goquery"
+    "golang.org/x/net/html"
+    "golang.org/x/time/rate"
+
+    "smart-crawler/models"
+    "smart-crawler/utils"
+)
+
+// Attributes mirrored pages link through. Assets are what a page needs to
+// display; links to other pages are rewritten but not followed from here.
+var mirrorAttrs = []struct {
+    selector string
+    attr     string
+    asset    bool
+}{
+    {"a[href]", "href", false},
+    {"area[href]", "href", false},
+    {"iframe[src]", "src", false},
+    {"link[href]", "href", true},
+    {"script[src]", "src", true},
+    {"img[src]", "src", true},
+    {"img[srcset]", "srcset", true},
+    {"source[src]", "src", true},
+    {"source[srcset]", "srcset", true},
+    {"video[src]", "src", true},
+    {"video[poster]", "poster", true},
+    {"audio[src]", "src", true},
+    {"track[src]", "src", true},
+    {"embed[src]", "src", true},
+    {"input[type=image][src]", "src", true},
+}
+
+// The link relations whose targets a page displays with
+var assetRels = map[string]bool{
+    "stylesheet":       true,
+    "icon":             true,
+    "apple-touch-icon": true,
+    "preload":          true,
+    "modulepreload":    true,
+}
+
+// url(...) and @import references of a stylesheet, quoted or not
+var cssRef = regexp.MustCompile(`url\(\s*(?:"([^"]*)"|'([^']*)'|([^)"'\s]*))\s*\)|@import\s+(?:"([^"]*)"|'([^']*)')`)
+
+// SetMirror makes Crawl write a browsable offline copy of what it crawls to
+// dir, like wget --mirror --page-requisites --convert-links: every page it
+// fetches, with the stylesheets, scripts, and images they use, laid out by
+// host and path. Assets within scope are fetched whatever the depth, count
+// against no budget, and are not saved as pages. Once the crawl ends, links
+// between copied files are rewritten to relative paths and the others to
+// absolute URLs. The crawl is recorded as a "mirror" crawl; "" turns
+// mirroring off.
+func (t *Traditional) SetMirror(dir string) {
+    t.mirrorDir = dir
+}
+
+// mirror is the offline copy of a running crawl
+type mirror struct {
+    dir     string
+    client  *http.Client
+    limiter *rate.Limiter
+    maxSize int64
+    scope   *scopeFilter
+    filter  *URLFilter
+    onError func(url string, err error)
+
+    mu        sync.Mutex
+    files     map[string]string // Path of each copied URL under dir, redirects included
+    claimed   map[string]bool   // Assets fetched or being fetched
+    documents []mirroredDocument
+    stats     models.MirrorStats
+}
+
+// mirroredDocument is a copied page or stylesheet whose links are rewritten
+// when the crawl ends
+type mirroredDocument struct {
+    path string
+    base *url.URL // What its relative links resolve against
+    css  bool
+}
+
+func (t *Traditional) newMirror(ctx context.Context, scope *scopeFilter) *mirror {
+    return &mirror{
+        dir:     t.mirrorDir,
+        client:  t.client,
+        limiter: t.limiter,
+        maxSize: t.maxResponseSize,
+        scope:   scope,
+        filter:  t.urlFilter,
+        onError: func(url string, err error) {
+            t.emit(ctx, Event{Type: ErrorOccurred, URL: url, Err: err})
+        },
+        files:   make(map[string]string),
+        claimed: make(map[string]bool),
+        stats:   models.MirrorStats{Dir: t.mirrorDir},
+    }
+}
+
+// savePage copies a fetched page and the assets it uses. Error pages are
+// left out.
+func (m *mirror) savePage(ctx context.Context, pageURL string, resp *http.Response, body []byte, doc *goquery.Document) {
+    if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+        return
+    }
+    final := resp.Request.URL
+    path, contentType, ok := m.write(final, pageURL, resp.Header.Get("Content-Type"), body, false)
+    if !ok || mediaType(contentType) != "text/html" && mediaType(contentType) != "application/xhtml+xml" {
+        return
+    }
+
+    base := final
+    if href, ok := doc.Find("base[href]").First().Attr("href"); ok {
+        if parsed, err := final.Parse(strings.TrimSpace(href)); err == nil {
+            base = parsed
+        }
+    }
+    m.addDocument(mirroredDocument{path: path, base: base})
+
+    var assets []string
+    mirrorLinks(doc, func(ref string, asset bool) string {
+        if asset {
+            if target, err := base.Parse(strings.TrimSpace(ref)); err == nil {
+                assets = append(assets, target.String())
+            }
+        }
+        return ref
+    })
+    for _, asset := range assets {
+        m.fetchAsset(ctx, asset)
+    }
+}
+
+// fetchAsset copies an asset within scope that is not yet copied, and the
+// assets a stylesheet references in turn
+func (m *mirror) fetchAsset(ctx context.Context, assetURL string) {
+    if !utils.IsValidURLFor(assetURL, utils.URLKinds{Assets: true}) || !m.scope.allows(assetURL) || !m.filter.Allow(assetURL) || !m.claim(assetURL) {
+        return
+    }
+    if err := m.limiter.Wait(ctx); err != nil {
+        return
+    }
+    req, err := http.NewRequestWithContext(ctx, "GET", assetURL, nil)
+    if err != nil {
+        m.fail(assetURL, err)
+        return
+    }
+    resp, err := m.client.Do(req)
+    if err != nil {
+        m.fail(assetURL, err)
+        return
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+        m.fail(assetURL, fmt.Errorf("asset %s: %s", assetURL, resp.Status))
+        return
+    }
+    read, err := readBody(resp.Body, m.maxSize, nil)
+    if err != nil {
+        m.fail(assetURL, err)
+        return
+    }
+    if read.truncated {
+        m.fail(assetURL, fmt.Errorf("asset %s is larger than the max response size", assetURL))
+        return
+    }
+
+    final := resp.Request.URL
+    path, contentType, ok := m.write(final, assetURL, resp.Header.Get("Content-Type"), read.data, true)
+    if !ok || mediaType(contentType) != "text/css" {
+        return
+    }
+    m.addDocument(mirroredDocument{path: path, base: final, css: true})
+    var refs []string
+    rewriteCSS(string(read.data), func(ref string) string {
+        if target, err := final.Parse(strings.TrimSpace(ref)); err == nil {
+            refs = append(refs, target.String())
+        }
+        return ref
+    })
+    for _, ref := range refs {
+        m.fetchAsset(ctx, ref)
+    }
+}
+
+// claim reports whether assetURL is not yet copied, and marks it copied
+func (m *mirror) claim(assetURL string) bool {
+    key := mirrorKey(assetURL)
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    if m.claimed[key] {
+        return false
+    }
+    m.claimed[key] = true
+    _, copied := m.files[key]
+    return !copied
+}
+
+// write copies body, fetched from requested and served from final, to its
+// path under the mirror's directory, and returns the path and the content
+// type it was copied as
+func (m *mirror) write(final *url.URL, requested, contentType string, body []byte, asset bool) (string, string, bool) {
+    if contentType == "" {
+        contentType = http.DetectContentType(body)
+    }
+    path := localPath(final, contentType)
+    full := filepath.Join(m.dir, filepath.FromSlash(path))
+    err := os.MkdirAll(filepath.Dir(full), 0o755)
+    if err == nil {
+        err = os.WriteFile(full, body, 0o644)
+    }
+    if err != nil {
+        m.fail(final.String(), err)
+        return "", "", false
+    }
+
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    m.files[mirrorKey(final.String())] = path
+    m.files[mirrorKey(requested)] = path
+    if asset {
+        m.stats.Assets++
+    } else {
+        m.stats.Pages++
+    }
+    m.stats.Bytes += int64(len(body))
+    return path, contentType, true
+}
+
+func (m *mirror) addDocument(document mirroredDocument) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    m.documents = append(m.documents, document)
+}
+
+func (m *mirror) fail(url string, err error) {
+    m.mu.Lock()
+    m.stats.Errors++
+    m.mu.Unlock()
+    m.onError(url, err)
+}
+
+// finish rewrites the links of the copied pages and stylesheets, once every
+// file is written, and reports what the copy holds
+func (m *mirror) finish() *models.MirrorStats {
+    for _, document := range m.documents {
+        if err := m.convert(document); err != nil {
+            m.fail(document.base.String(), fmt.Errorf("rewriting links of %s: %w", document.path, err))
+        }
+    }
+    stats := m.stats
+    return &stats
+}
+
+// convert rewrites the links of a copied document in place
+func (m *mirror) convert(document mirroredDocument) error {
+    full := filepath.Join(m.dir, filepath.FromSlash(document.path))
+    data, err := os.ReadFile(full)
+    if err != nil {
+        return err
+    }
+    if document.css {
+        rewritten := rewriteCSS(string(data), func(ref string) string {
+            return m.localRef(document, ref)
+        })
+        return os.WriteFile(full, []byte(rewritten), 0o644)
+    }
+
+    doc, err := goquery.NewDocumentFromReader(bytes.NewReader(data))
+    if err != nil {
+        return err
+    }
+    // Links are resolved against it already, and relative paths must not be
+    doc.Find("base").Remove()
+    mirrorLinks(doc, func(ref string, _ bool) string {
+        return m.localRef(document, ref)
+    })
+    var out bytes.Buffer
+    if err := html.Render(&out, doc.Get(0)); err != nil {
+        return err
+    }
+    return os.WriteFile(full, out.Bytes(), 0o644)
+}
+
+// localRef is ref, a link of document, as a relative path to the file it
+// points to when that was copied, or as an absolute URL otherwise.
+// Fragments, and links that are not HTTP, are left as they are.
+func (m *mirror) localRef(document mirroredDocument, ref string) string {
+    trimmed := strings.TrimSpace(ref)
+    if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+        return ref
+    }
+    target, err := document.base.Parse(trimmed)
+    if err != nil || (target.Scheme != "http" && target.Scheme != "https") {
+        return ref
+    }
+
+    path, ok := m.files[mirrorKey(target.String())]
+    if !ok {
+        return target.String()
+    }
+    rel, err := filepath.Rel(filepath.FromSlash(pathpkg.Dir(document.path)), filepath.FromSlash(path))
+    if err != nil {
+        return target.String()
+    }
+    local := (&url.URL{Path: filepath.ToSlash(rel)}).EscapedPath()
+    if target.Fragment != "" {
+        local += "#" + target.EscapedFragment()
+    }
+    return local
+}
+
+// mirrorLinks replaces every URL reference of a page, in link attributes,
+// srcsets, and inline styles, by what visit returns for it. asset tells
+// whether the page needs what the reference points to in order to display.
+func mirrorLinks(doc *goquery.Document, visit func(ref string, asset bool) string) {
+    for _, link := range mirrorAttrs {
+        doc.Find(link.selector).Each(func(_ int, s *goquery.Selection) {
+            value, _ := s.Attr(link.attr)
+            asset := link.asset
+            switch goquery.NodeName(s) {
+            case "link":
+                rel, _ := s.Attr("rel")
+                asset = false
+                for _, token := range strings.Fields(strings.ToLower(rel)) {
+                    asset = asset || assetRels[token]
+                }
+            case "a", "area":
+                // Links straight to images, like a gallery's full-size ones
+                asset = utils.IsAssetURL(value)
+            }
+            if link.attr == "srcset" {
+                s.SetAttr(link.attr, rewriteSrcset(value, func(ref string) string { return visit(ref, asset) }))
+                return
+            }
+            s.SetAttr(link.attr, visit(value, asset))
+        })
+    }
+
+    inline := func(ref string) string { return visit(ref, true) }
+    doc.Find("[style]").Each(func(_ int, s *goquery.Selection) {
+        style, _ := s.Attr("style")
+        s.SetAttr("style", rewriteCSS(style, inline))
+    })
+    doc.Find("style").Each(func(_ int, s *goquery.Selection) {
+        for node := s.Get(0).FirstChild; node != nil; node = node.NextSibling {
+            if node.Type == html.TextNode {
+                node.Data = rewriteCSS(node.Data, inline)
+            }
+        }
+    })
+}
+
+// rewriteSrcset replaces the URL of each candidate of a srcset by what
+// rewrite returns for it, keeping the width and density descriptors
+func rewriteSrcset(srcset string, rewrite func(string) string) string {
+    candidates := strings.Split(srcset, ",")
+    for i, candidate := range candidates {
+        fields := strings.Fields(candidate)
+        if len(fields) == 0 {
+            continue
+        }
+        fields[0] = rewrite(fields[0])
+        candidates[i] = strings.Join(fields, " ")
+    }
+    return strings.Join(candidates, ", ")
+}
+
+// rewriteCSS replaces the url() and @import references of a stylesheet by
+// what rewrite returns for them. data: URLs are left alone.
+func rewriteCSS(css string, rewrite func(string) string) string {
+    var out strings.Builder
+    last := 0
+    for _, match := range cssRef.FindAllStringSubmatchIndex(css, -1) {
+        // The group that matched holds the reference
+        for group := 1; group < len(match)/2; group++ {
+            start, end := match[2*group], match[2*group+1]
+            if start < 0 {
+                continue
+            }
+            ref := css[start:end]
+            if ref == "" || strings.HasPrefix(strings.ToLower(ref), "data:") {
+                break
+            }
+            out.WriteString(css[last:start])
+            out.WriteString(rewrite(ref))
+            last = end
+            break
+        }
+    }
+    out.WriteString(css[last:])
+    return out.String()
+}
+
+// localPath is where u is copied to, relative to the mirror's directory:
+// under its host, at its path, with index.html for directories. A query is
+// folded into the file name as a hash, and HTML and CSS files get their
+// extension, so the copy opens in a browser without a server.
+func localPath(u *url.URL, contentType string) string {
+    p := u.Path
+    if p == "" || strings.HasSuffix(p, "/") {
+        p += "index.html"
+    }
+    segments := strings.Split(pathpkg.Clean("/" + p), "/")[1:]
+    for i := range segments {
+        segments[i] = safeFileName(segments[i])
+    }
+
+    name := segments[len(segments)-1]
+    ext := strings.ToLower(pathpkg.Ext(name))
+    if u.RawQuery != "" {
+        sum := sha1.Sum([]byte(u.RawQuery))
+        name = strings.TrimSuffix(name, pathpkg.Ext(name)) + "@" + hex.EncodeToString(sum[:4]) + pathpkg.Ext(name)
+    }
+    switch mediaType(contentType) {
+    case "text/html", "application/xhtml+xml":
+        if ext != ".html" && ext != ".htm" {
+            name += ".html"
+        }
+    case "text/css":
+        if ext != ".css" {
+            name += ".css"
+        }
+    }
+    segments[len(segments)-1] = name
+    return safeFileName(u.Host) + "/" + strings.Join(segments, "/")
+}
+
+// safeFileName replaces the characters Windows does not allow in file
+// names, and control characters
+func safeFileName(name string) string {
+    return strings.Map(func(r rune) rune {
+        if r < 0x20 || strings.ContainsRune(`<>:"\|?*`, r) {
+            return '_'
+        }
+        return r
+    }, name)
+}
+
+// mirrorKey is what a copied URL is looked up by: the URL without its
+// fragment
+func mirrorKey(rawURL string) string {
+    u, err := url.Parse(rawURL)
+    if err != nil {
+        return rawURL
+    }
+    u.Fragment, u.RawFragment = "", ""
+    return u.String()
+}
+
+func mediaType(contentType string) string {
+    parsed, _, err := mime.ParseMediaType(contentType)
+    if err != nil {
+        return ""
+    }
+    return parsed
+}
@@ -0,0 +1,353 @@
+package crawler
+
+import (
+    "errors"
+    "fmt"
+    "log"
+    "net/http"
+    "slices"
+    "strings"
+    "time"
+
+    "golang.org/x/net/http2"
+    "golang.org/x/time/rate"
+
+    "smart-crawler/audit"
+    "smart-crawler/replay"
+    "smart-crawler/utils"
+)
+
+// Option configures a crawler built by NewSmart or NewTraditional. Invalid
+// values are reported as errors by the constructor.
+type Option func(*options) error
+
+// options collects what Options set. Each constructor starts from its own
+// defaults.
+type options struct {
+    workers  int
+    limit    rate.Limit
+    burst    int
+    client   *http.Client
+    analyzer ContentAnalyzer
+    scope    Scope
+    logger   *log.Logger
+    proxies  *ProxyPool
+    jar      http.CookieJar
+    auth     *Auth
+    headers  *HeaderOverrides
+    dns      *DNSCache
+    http     *HTTPOptions // nil keeps a given client's transport as it is
+    cache    *replay.Cache
+
+    userAgent string
+    timeout   time.Duration // 0 keeps the client's own
+
+    harvestThreshold float64 // 0 does not track the harvest rate
+    topic            *Topic  // nil crawls without one
+    linkModel        *LinkModel
+    priorityRules    *PriorityRules
+    scorer           PriorityScorer
+    script           *Script
+    extraction       *ExtractionRules
+    images           *ImageOptions // nil records no images
+    linkSelector     *Selector // nil follows every link
+    normalizer       *utils.URLNormalizer // nil normalizes like utils.NormalizeURL
+    spam             *SpamFilter          // nil flags no spam
+
+    tagRules         []TagRule
+    urlFilter        *URLFilter
+    budget           Budget
+    seen             SeenOptions
+    resolveRedirects bool
+    maxResponseSize  int64 // 0 reads bodies whole
+    sinks            pageSinks
+    auditLog         *audit.Log // nil records no requests
+}
+
+const defaultWorkers = 10
+
+// DefaultUserAgent is the User-Agent crawlers send unless WithUserAgent or
+// a per-domain override sets another
+const DefaultUserAgent = "SmartCrawler/1.0"
+
+// DefaultRequestTimeout bounds each request of the default client, from
+// dialing to reading the body
+const DefaultRequestTimeout = 30 * time.Second
+
+// WithWorkers sets how many pages are fetched concurrently
+func WithWorkers(workers int) Option {
+    return func(o *options) error {
+        if workers < 1 {
+            return fmt.Errorf("workers must be at least 1, got %d", workers)
+        }
+        o.workers = workers
+        return nil
+    }
+}
+
+// WithRateLimit caps requests per second, allowing bursts of burst requests
+func WithRateLimit(perSecond float64, burst int) Option {
+    return func(o *options) error {
+        if perSecond <= 0 || burst < 1 {
+            return fmt.Errorf("rate limit must be positive with a burst of at least 1, got %v/s burst %d", perSecond, burst)
+        }
+        o.limit, o.burst = rate.Limit(perSecond), burst
+        return nil
+    }
+}
+
+// WithUserAgent sends agent as the User-Agent of every request, robots.txt
+// included, and matches robots.txt rules against its product token, the
+// part before the first "/" or space
+func WithUserAgent(agent string) Option {
+    return func(o *options) error {
+        if strings.TrimSpace(agent) == "" || strings.ContainsAny(agent, "\r\n") {
+            return fmt.Errorf("user agent must be a non-empty single line, got %q", agent)
+        }
+        o.userAgent = agent
+        return nil
+    }
+}
+
+// WithRequestTimeout bounds each request, whether the client is the default
+// or one given with WithClient
+func WithRequestTimeout(timeout time.Duration) Option {
+    return func(o *options) error {
+        if timeout <= 0 {
+            return fmt.Errorf("request timeout must be positive, got %v", timeout)
+        }
+        o.timeout = timeout
+        return nil
+    }
+}
+
+// WithClient fetches with a copy of client, e.g. for a proxy, different
+// timeouts, or a replay.Transport to run the pipeline against an archive
+// offline. The crawler wraps the copy's transport, not client's.
+func WithClient(client *http.Client) Option {
+    return func(o *options) error {
+        if client == nil {
+            return errors.New("client must not be nil")
+        }
+        copied := *client
+        o.client = &copied
+        return nil
+    }
+}
+
+// WithProxies sends requests through pool. It replaces the transport of the
+// client, whether the default or one given with WithClient.
+func WithProxies(pool *ProxyPool) Option {
+    return func(o *options) error {
+        if pool == nil {
+            return errors.New("proxy pool must not be nil")
+        }
+        o.proxies = pool
+        return nil
+    }
+}
+
+// WithCookieJar keeps cookies in jar, e.g. a CookieJar loaded from a file
+// so the crawl starts logged in. Without it each crawler gets an empty
+// CookieJar, unless the client given with WithClient has a jar.
+func WithCookieJar(jar http.CookieJar) Option {
+    return func(o *options) error {
+        if jar == nil {
+            return errors.New("cookie jar must not be nil")
+        }
+        o.jar = jar
+        return nil
+    }
+}
+
+// WithAuth authenticates to the sites in auth: their headers are added to
+// every request for their domain, and their login forms are submitted when
+// a crawl starts.
+func WithAuth(auth *Auth) Option {
+    return func(o *options) error {
+        if auth == nil {
+            return errors.New("auth must not be nil")
+        }
+        o.auth = auth
+        return nil
+    }
+}
+
+// WithHeaders sends the per-domain headers and User-Agents in overrides,
+// leaving other domains' requests as they were
+func WithHeaders(overrides *HeaderOverrides) Option {
+    return func(o *options) error {
+        if overrides == nil {
+            return errors.New("header overrides must not be nil")
+        }
+        o.headers = overrides
+        return nil
+    }
+}
+
+// WithDNSCache resolves hostnames through cache, connecting with its
+// DialContext. It applies to the default client, and to one given with
+// WithClient whose transport is an *http.Transport, which is copied first.
+// Requests sent through WithProxies are resolved as before.
+func WithDNSCache(cache *DNSCache) Option {
+    return func(o *options) error {
+        if cache == nil {
+            return errors.New("DNS cache must not be nil")
+        }
+        o.dns = cache
+        return nil
+    }
+}
+
+// WithURLNormalizer normalizes the seed and every discovered URL with
+// normalizer before it is queued, so the variants of a URL are fetched
+// once. Without it crawlers normalize like utils.NormalizeURL.
+func WithURLNormalizer(normalizer *utils.URLNormalizer) Option {
+    return func(o *options) error {
+        if normalizer == nil {
+            return errors.New("URL normalizer must not be nil")
+        }
+        o.normalizer = normalizer
+        return nil
+    }
+}
+
+// WithReplayCache sends requests through cache, which replays the responses
+// it recorded and records the rest, so crawlers sharing it fetch the same
+// responses at the same latency. It sits beneath decoding, authentication,
+// and header overrides, so it records responses as they came over the wire.
+func WithReplayCache(cache *replay.Cache) Option {
+    return func(o *options) error {
+        if cache == nil {
+            return errors.New("replay cache must not be nil")
+        }
+        o.cache = cache
+        return nil
+    }
+}
+
+// WithAnalyzer scores pages with analyzer instead of a DefaultAnalyzer.
+// Only the smart crawler analyzes content.
+func WithAnalyzer(analyzer ContentAnalyzer) Option {
+    return func(o *options) error {
+        if analyzer == nil {
+            return errors.New("analyzer must not be nil")
+        }
+        o.analyzer = analyzer
+        return nil
+    }
+}
+
+// WithScope restricts which discovered links are followed, relative to the
+// start URL. The default is ScopeUnrestricted.
+func WithScope(scope Scope) Option {
+    return func(o *options) error {
+        parsed, err := ParseScope(string(scope))
+        if err != nil {
+            return err
+        }
+        o.scope = parsed
+        return nil
+    }
+}
+
+// WithLogger logs errors, stalls, and finished crawls to logger, whether or not
+// Events is being drained
+func WithLogger(logger *log.Logger) Option {
+    return func(o *options) error {
+        if logger == nil {
+            return errors.New("logger must not be nil")
+        }
+        o.logger = logger
+        return nil
+    }
+}
+
+// WithAuditLog records every outgoing request, with the rate rule in force,
+// to log
+func WithAuditLog(log *audit.Log) Option {
+    return func(o *options) error {
+        if log == nil {
+            return errors.New("audit log must not be nil")
+        }
+        o.auditLog = log
+        return nil
+    }
+}
+
+// buildOptions applies opts over a crawler's default rate limit
+func buildOptions(opts []Option, limit rate.Limit, burst int) (*options, error) {
+    o := &options{
+        workers:          defaultWorkers,
+        limit:            limit,
+        burst:            burst,
+        userAgent:        DefaultUserAgent,
+        resolveRedirects: true,
+        maxResponseSize:  DefaultMaxResponseSize,
+    }
+    for _, opt := range opts {
+        if err := opt(o); err != nil {
+            return nil, err
+        }
+    }
+    if o.client == nil {
+        o.client = &http.Client{
+            Timeout: DefaultRequestTimeout,
+            Transport: &http.Transport{
+                MaxIdleConns:    100,
+                IdleConnTimeout: 90 * time.Second,
+            },
+        }
+        if o.http == nil {
+            o.http = &DefaultHTTPOptions
+        }
+    }
+    if o.timeout > 0 {
+        o.client.Timeout = o.timeout
+    }
+    if o.proxies != nil {
+        o.client.Transport = o.proxies
+    } else if transport, ok := o.client.Transport.(*http.Transport); ok && (o.dns != nil || o.http != nil) {
+        transport = transport.Clone()
+        if o.dns != nil {
+            // Cloning a transport that negotiates HTTP/2 offers h2 in the
+            // copy's TLS config, which a DialContext would leave offered
+            // but no longer spoken
+            if transport.TLSClientConfig != nil && slices.Contains(transport.TLSClientConfig.NextProtos, http2.NextProtoTLS) {
+                transport.ForceAttemptHTTP2 = true
+            }
+            transport.DialContext = o.dns.DialContext
+        }
+        o.client.Transport = transport
+        if o.http != nil {
+            configured, err := o.http.configure(transport, o.dns)
+            if err != nil {
+                return nil, err
+            }
+            o.client.Transport = configured
+        }
+    }
+    if o.cache != nil {
+        base := o.client.Transport
+        if base == nil {
+            base = http.DefaultTransport
+        }
+        o.client.Transport = o.cache.Transport(base)
+    }
+    o.client.Transport = &decodingTransport{base: o.client.Transport}
+    if o.auth != nil {
+        o.client.Transport = &authTransport{base: o.client.Transport, auth: o.auth}
+    }
+    // Inside the header overrides, so a site's own User-Agent wins
+    o.client.Transport = &userAgentTransport{base: o.client.Transport, agent: o.userAgent}
+    if o.headers != nil {
+        o.client.Transport = &headersTransport{base: o.client.Transport, overrides: o.headers}
+    }
+    // Sites that set a session cookie on the first response expect it back
+    if o.jar != nil {
+        o.client.Jar = o.jar
+    } else if o.client.Jar == nil {
+        o.client.Jar = NewCookieJar()
+    }
+    return o, nil
+}
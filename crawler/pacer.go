@@ -0,0 +1,127 @@
+package crawler
+
+import (
+    "sync/atomic"
+    "time"
+)
+
+const (
+    initialPullInterval = 500 * time.Millisecond
+    minPullInterval     = 50 * time.Millisecond
+    maxPullInterval     = 5 * time.Second
+    maxBatchFactor      = 10 // Upper bound on a pull, as a multiple of workers
+)
+
+// pullPacer decides how many URLs the smart crawler pulls from the database
+// queue and how long it waits between pulls. Idle workers shorten the interval
+// so fast sites are not starved, while a saturated queue or an empty frontier
+// lengthens it so slow sites do not hammer the database.
+type pullPacer struct {
+    workers     int64 // atomic, as an autoscaled pool resizes it
+    idleWorkers int64 // atomic
+    avgFetchNs  int64 // atomic, exponentially weighted moving average
+    pending     int64 // atomic, URLs dispatched but not yet settled
+    interval    time.Duration
+}
+
+func newPullPacer(workers int) *pullPacer {
+    return &pullPacer{
+        workers:  int64(workers),
+        interval: initialPullInterval,
+    }
+}
+
+// setWorkers records the size of a resized worker pool
+func (p *pullPacer) setWorkers(workers int) {
+    atomic.StoreInt64(&p.workers, int64(workers))
+}
+
+func (p *pullPacer) workerIdle() {
+    atomic.AddInt64(&p.idleWorkers, 1)
+}
+
+func (p *pullPacer) workerBusy() {
+    atomic.AddInt64(&p.idleWorkers, -1)
+}
+
+func (p *pullPacer) idle() int {
+    return int(atomic.LoadInt64(&p.idleWorkers))
+}
+
+func (p *pullPacer) recordFetch(d time.Duration) {
+    for {
+        old := atomic.LoadInt64(&p.avgFetchNs)
+        next := int64(d)
+        if old != 0 {
+            next = old + (int64(d)-old)/5 // alpha = 0.2
+        }
+        if atomic.CompareAndSwapInt64(&p.avgFetchNs, old, next) {
+            return
+        }
+    }
+}
+
+func (p *pullPacer) avgFetch() time.Duration {
+    return time.Duration(atomic.LoadInt64(&p.avgFetchNs))
+}
+
+// batchSize returns how many URLs to pull so the workers stay busy until the
+// next pull, given how many URLs are already buffered in the in-memory queue.
+func (p *pullPacer) batchSize(queued int) int {
+    workers := int(atomic.LoadInt64(&p.workers))
+    want := workers * 2
+    if avg := p.avgFetch(); avg > 0 {
+        want = int(float64(workers) * float64(p.interval) / float64(avg))
+    }
+
+    if idle := p.idle(); want < idle {
+        want = idle
+    }
+
+    want -= queued
+    if want < 0 {
+        want = 0
+    }
+    if limit := workers * maxBatchFactor; want > limit {
+        want = limit
+    }
+
+    return want
+}
+
+// next adjusts and returns the pull interval after a pull that asked for
+// requested URLs and received got.
+func (p *pullPacer) next(requested, got int) time.Duration {
+    switch {
+    case requested == 0 || got == 0:
+        // Queue already saturated or frontier empty: back off
+        p.interval *= 2
+    case p.idle() > 0:
+        // Workers are waiting for work: pull sooner
+        p.interval /= 2
+    }
+
+    if p.interval < minPullInterval {
+        p.interval = minPullInterval
+    }
+    if p.interval > maxPullInterval {
+        p.interval = maxPullInterval
+    }
+
+    return p.interval
+}
+
+// dispatched records a URL handed to the worker queue
+func (p *pullPacer) dispatched() {
+    atomic.AddInt64(&p.pending, 1)
+}
+
+// settled records that a dispatched URL has been fully processed
+func (p *pullPacer) settled() {
+    atomic.AddInt64(&p.pending, -1)
+}
+
+// inFlight returns how many dispatched URLs have not yet settled
+func (p *pullPacer) inFlight() int {
+    return int(atomic.LoadInt64(&p.pending))
+}
@@ -0,0 +1,195 @@
+package crawler
+
+import (
+    "net/url"
+    "regexp"
+    "strconv"
+    "strings"
+    "sync"
+    "sync/atomic"
+
+    "github.com/PuerkitoBio/goquery"
+)
+
+// DefaultPaginationDepth is how many pages past the first the smart crawler
+// follows a paginated listing
+const DefaultPaginationDepth = 20
+
+const (
+    // URLContext.ContentType of listing pages and the links to their other
+    // pages
+    listingContentType = "listing"
+    // FilteredURLs key for continuation pages past the pagination depth
+    paginationFiltered = "pagination (too deep)"
+    // Continuation pages get this priority whatever their anchor ("Next",
+    // "2") says, less paginationDecay for each page past the first, so a
+    // listing is walked in order
+    paginationPriority = 60
+    paginationDecay    = 2
+    // How many continuation pages a crawl remembers the position of
+    maxPaginationTracked = 100000
+)
+
+// Query parameters listings number their pages with. "p" is left out, as
+// WordPress and others use it for post IDs.
+var pageParams = map[string]bool{"page": true, "pg": true, "paged": true, "pagenum": true, "page_num": true}
+
+// "/page/3" at the end of a path
+var pagePathPattern = regexp.MustCompile(`(?i)/page/(\d+)/?$`)
+
+// pageNumber returns the page of a listing rawURL is, from a page query
+// parameter or a /page/N path, with the listing it belongs to as returned
+// by listingOf. ok is false when it carries no page number.
+func pageNumber(rawURL string) (listing string, page int, ok bool) {
+    u, err := url.Parse(rawURL)
+    if err != nil {
+        return "", 0, false
+    }
+    query := u.Query()
+    for name, values := range query {
+        if !pageParams[strings.ToLower(name)] || len(values) != 1 {
+            continue
+        }
+        if n, err := strconv.Atoi(values[0]); err == nil && n >= 1 {
+            query.Del(name)
+            u.RawQuery = query.Encode()
+            return listingKey(u), n, true
+        }
+    }
+    if match := pagePathPattern.FindStringSubmatchIndex(u.Path); match != nil {
+        if n, err := strconv.Atoi(u.Path[match[2]:match[3]]); err == nil && n >= 1 {
+            u.Path, u.RawPath = u.Path[:match[0]], ""
+            return listingKey(u), n, true
+        }
+    }
+    return "", 0, false
+}
+
+// listingOf names the listing rawURL is a page of, the same for every page
+// of it, whether or not the URL carries a page number
+func listingOf(rawURL string) string {
+    if listing, _, ok := pageNumber(rawURL); ok {
+        return listing
+    }
+    u, err := url.Parse(rawURL)
+    if err != nil {
+        return rawURL
+    }
+    u.RawQuery = u.Query().Encode()
+    return listingKey(u)
+}
+
+func listingKey(u *url.URL) string {
+    key := *u
+    key.Fragment, key.RawPath = "", ""
+    key.Path = strings.TrimSuffix(key.Path, "/")
+    return key.String()
+}
+
+// Directions of a continuation link
+const (
+    pageNumbered = iota // Carries its page number
+    pageNext
+    pagePrev
+)
+
+// pagination is what a page says about the paginated listing it is part of
+type pagination struct {
+    listing bool           // The page is part of a paginated listing
+    links   map[string]int // Continuation page URL -> direction
+}
+
+// findPagination finds the links of a page that lead to other pages of its
+// listing: rel=next and rel=prev links, in the head or the body, and links
+// numbering pages of the same listing, like ?page=3 or /page/3
+func findPagination(doc *goquery.Document, pageURL string) pagination {
+    found := pagination{links: make(map[string]int)}
+    listing := listingOf(pageURL)
+    _, _, found.listing = pageNumber(pageURL)
+
+    doc.Find("a[href], link[href]").Each(func(_ int, sel *goquery.Selection) {
+        href, _ := sel.Attr("href")
+        link := resolveURL(pageURL, strings.TrimSpace(href))
+        if link == "" || link == pageURL {
+            return
+        }
+        rel, _ := sel.Attr("rel")
+        rels := strings.Fields(strings.ToLower(rel))
+        for _, r := range rels {
+            switch r {
+            case "next":
+                found.links[link] = pageNext
+                return
+            case "prev", "previous":
+                found.links[link] = pagePrev
+                return
+            }
+        }
+        if goquery.NodeName(sel) != "a" {
+            return
+        }
+        if linkListing, _, ok := pageNumber(link); ok && linkListing == listing {
+            found.links[link] = pageNumbered
+        }
+    })
+    if len(found.links) > 0 {
+        found.listing = true
+    }
+    return found
+}
+
+// paginationTracker decides which continuation pages of listings a crawl
+// follows, by how far past the first page of its listing each one is
+type paginationTracker struct {
+    maxDepth  int
+    positions map[string]int // Continuation page URL -> pages past the first
+    dropped   atomic.Int64
+    mutex     sync.Mutex
+}
+
+func newPaginationTracker(maxDepth int) *paginationTracker {
+    return &paginationTracker{maxDepth: maxDepth, positions: make(map[string]int)}
+}
+
+// position is how many pages past the first of its listing pageURL is
+func (t *paginationTracker) position(pageURL string) int {
+    if _, page, ok := pageNumber(pageURL); ok {
+        return page - 1
+    }
+    t.mutex.Lock()
+    defer t.mutex.Unlock()
+    return t.positions[pageURL]
+}
+
+// follow returns the position of a continuation page linked from pageURL in
+// direction, and whether it is within the pagination depth. Numbered pages
+// are placed by their number, others one step from pageURL.
+func (t *paginationTracker) follow(pageURL, link string, direction int) (int, bool) {
+    var position int
+    if _, page, ok := pageNumber(link); ok {
+        position = page - 1
+    } else if direction == pagePrev {
+        position = max(t.position(pageURL)-1, 0)
+    } else {
+        position = t.position(pageURL) + 1
+    }
+    if position > t.maxDepth {
+        t.dropped.Add(1)
+        return position, false
+    }
+
+    t.mutex.Lock()
+    defer t.mutex.Unlock()
+    if len(t.positions) >= maxPaginationTracked {
+        t.positions = make(map[string]int)
+    }
+    t.positions[link] = position
+    return position, true
+}
+
+func (t *paginationTracker) droppedCount() int {
+    if t == nil {
+        return 0
+    }
+    return int(t.dropped.Load())
+}
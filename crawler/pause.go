@@ -0,0 +1,98 @@
+package crawler
+
+import (
+    "context"
+    "sync"
+)
+
+// pauseGate holds workers back from starting fetches while a crawl is
+// paused
+type pauseGate struct {
+    mutex  sync.Mutex
+    paused chan struct{} // Closed on resume; nil while running
+}
+
+// pause reports whether the gate was open
+func (g *pauseGate) pause() bool {
+    g.mutex.Lock()
+    defer g.mutex.Unlock()
+
+    if g.paused != nil {
+        return false
+    }
+    g.paused = make(chan struct{})
+    return true
+}
+
+// resume reports whether the gate was closed
+func (g *pauseGate) resume() bool {
+    g.mutex.Lock()
+    defer g.mutex.Unlock()
+
+    if g.paused == nil {
+        return false
+    }
+    close(g.paused)
+    g.paused = nil
+    return true
+}
+
+func (g *pauseGate) isPaused() bool {
+    g.mutex.Lock()
+    defer g.mutex.Unlock()
+
+    return g.paused != nil
+}
+
+// wait blocks while the gate is closed, until it is opened or ctx is done
+func (g *pauseGate) wait(ctx context.Context) error {
+    g.mutex.Lock()
+    paused := g.paused
+    g.mutex.Unlock()
+
+    if paused == nil {
+        return nil
+    }
+    select {
+    case <-paused:
+        return nil
+    case <-ctx.Done():
+        return ctx.Err()
+    }
+}
+
+// Pause stops workers from starting fetches until Resume; fetches already
+// under way finish and are saved. A paused crawl is not reported as
+// stalled, but a MaxDuration budget keeps running. Pause reports
+// whether the crawler was running, and may be called from any goroutine,
+// before or during a crawl.
+func (s *Smart) Pause() bool {
+    return s.gate.pause()
+}
+
+// Resume lets a paused crawl fetch again, reporting whether it was paused
+func (s *Smart) Resume() bool {
+    return s.gate.resume()
+}
+
+// Paused reports whether the crawler is paused
+func (s *Smart) Paused() bool {
+    return s.gate.isPaused()
+}
+
+// Pause stops workers from starting fetches until Resume; fetches already
+// under way finish and are saved. It reports whether the crawler was
+// running, and may be called from any goroutine, before or during a crawl.
+func (t *Traditional) Pause() bool {
+    return t.gate.pause()
+}
+
+// Resume lets a paused crawl fetch again, reporting whether it was paused
+func (t *Traditional) Resume() bool {
+    return t.gate.resume()
+}
+
+// Paused reports whether the crawler is paused
+func (t *Traditional) Paused() bool {
+    return t.gate.isPaused()
+}
@@ -0,0 +1,21 @@
+package crawler
+
+import (
+    "golang.org/x/time/rate"
+
+    "smart-crawler/audit"
+)
+
+// limiterRule describes the rate rule a limiter currently enforces. Requests
+// made without consulting robots.txt are recorded with robots "none".
+func limiterRule(limiter *rate.Limiter, robotsChecked bool) audit.Rule {
+    rule := audit.Rule{
+        Rate:   float64(limiter.Limit()),
+        Burst:  limiter.Burst(),
+        Robots: "none",
+    }
+    if robotsChecked {
+        rule.Robots = "checked"
+    }
+    return rule
+}
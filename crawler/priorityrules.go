@@ -0,0 +1,236 @@
+package crawler
+
+import (
+    "bytes"
+    "errors"
+    "fmt"
+    "io"
+    "net/url"
+    "os"
+    "regexp"
+    "strings"
+
+    "gopkg.in/yaml.v3"
+
+    "smart-crawler/models"
+)
+
+// priorityPoint is the logit of a point of priority near the middle of the
+// range, where rule weights are added to the link model's
+const priorityPoint = 1.0 / 25
+
+// PriorityRules are the tunable parts of link priority, weighted in points
+// of priority: a link gains the weight of each rule it matches, on top of
+// what the link model has learned. Load them with LoadPriorityRules, or
+// build them and pass them to WithPriorityRules.
+type PriorityRules struct {
+    // Keywords match a link's anchor, or the text around a generic one; a
+    // rule counts once however many of its words match
+    Keywords []WordRule `yaml:"keywords" json:"keywords"`
+    // Classes match the CSS classes of a link and its near ancestors
+    Classes []WordRule `yaml:"classes" json:"classes"`
+    // Rel weighs the values of a link's rel attribute, e.g. nofollow
+    Rel map[string]float64 `yaml:"rel" json:"rel"`
+    // Paths match the path and query of a link's URL
+    Paths []PatternRule `yaml:"paths" json:"paths"`
+    // Domains boost or demote links to a domain and its subdomains; the most
+    // specific matching domain counts
+    Domains []DomainRule `yaml:"domains" json:"domains"`
+    // Importance is added per unit of the linking page's importance (0-1)
+    Importance float64 `yaml:"importance" json:"importance"`
+}
+
+// WordRule weighs links whose text contains any of Words, case-insensitively
+type WordRule struct {
+    Words  []string `yaml:"words" json:"words"`
+    Weight float64  `yaml:"weight" json:"weight"`
+}
+
+// PatternRule weighs links whose URL path matches the regex Pattern
+type PatternRule struct {
+    Pattern string  `yaml:"pattern" json:"pattern"`
+    Weight  float64 `yaml:"weight" json:"weight"`
+
+    re *regexp.Regexp
+}
+
+// DomainRule weighs links to Domain and its subdomains
+type DomainRule struct {
+    Domain string  `yaml:"domain" json:"domain"`
+    Weight float64 `yaml:"weight" json:"weight"`
+}
+
+// priorityRulesFile is a rules file; a section it leaves out keeps the
+// rules below it
+type priorityRulesFile struct {
+    Keywords   *[]WordRule         `yaml:"keywords"`
+    Classes    *[]WordRule         `yaml:"classes"`
+    Rel        *map[string]float64 `yaml:"rel"`
+    Paths      *[]PatternRule      `yaml:"paths"`
+    Domains    *[]DomainRule       `yaml:"domains"`
+    Importance *float64            `yaml:"importance"`
+}
+
+// DefaultPriorityRules are the rules links are weighed by unless a rules
+// file replaces them
+func DefaultPriorityRules() *PriorityRules {
+    return &PriorityRules{
+        Keywords: []WordRule{
+            {Words: []string{"article", "news", "blog", "content", "post", "story", "research", "documentation"}, Weight: 20},
+            {Words: []string{"login", "register", "contact", "about", "terms", "privacy", "sitemap"}, Weight: -15},
+        },
+        Classes: []WordRule{
+            {Words: []string{"nav", "menu"}, Weight: -10},
+            {Words: []string{"content", "article"}, Weight: 15},
+        },
+        Rel:        map[string]float64{"nofollow": -30},
+        Importance: 20,
+    }
+}
+
+// LoadPriorityRules layers the YAML rules files at paths over the default
+// rules, in order: each section a file sets replaces that section of the
+// rules below it, so `keywords: []` drops the default keywords. Empty paths
+// are skipped.
+func LoadPriorityRules(paths ...string) (*PriorityRules, error) {
+    rules := DefaultPriorityRules()
+    for _, path := range paths {
+        if path == "" {
+            continue
+        }
+        data, err := os.ReadFile(path)
+        if err != nil {
+            return nil, err
+        }
+        var file priorityRulesFile
+        decoder := yaml.NewDecoder(bytes.NewReader(data))
+        decoder.KnownFields(true)
+        if err := decoder.Decode(&file); err != nil && !errors.Is(err, io.EOF) {
+            return nil, fmt.Errorf("%s: %w", path, err)
+        }
+        if file.Keywords != nil {
+            rules.Keywords = *file.Keywords
+        }
+        if file.Classes != nil {
+            rules.Classes = *file.Classes
+        }
+        if file.Rel != nil {
+            rules.Rel = *file.Rel
+        }
+        if file.Paths != nil {
+            rules.Paths = *file.Paths
+        }
+        if file.Domains != nil {
+            rules.Domains = *file.Domains
+        }
+        if file.Importance != nil {
+            rules.Importance = *file.Importance
+        }
+        if err := rules.compile(); err != nil {
+            return nil, fmt.Errorf("%s: %w", path, err)
+        }
+    }
+    return rules, nil
+}
+
+// compile checks the rules and compiles their patterns
+func (r *PriorityRules) compile() error {
+    for i := range r.Paths {
+        re, err := regexp.Compile(r.Paths[i].Pattern)
+        if err != nil {
+            return fmt.Errorf("invalid path pattern %q: %w", r.Paths[i].Pattern, err)
+        }
+        r.Paths[i].re = re
+    }
+    for i, rule := range r.Domains {
+        domain := strings.Trim(strings.ToLower(strings.TrimSpace(rule.Domain)), ".")
+        if domain == "" {
+            return errors.New("domain rule without a domain")
+        }
+        r.Domains[i].Domain = domain
+    }
+    rel := make(map[string]float64, len(r.Rel))
+    for value, weight := range r.Rel {
+        rel[strings.ToLower(value)] = weight
+    }
+    r.Rel = rel
+    for _, rules := range [][]WordRule{r.Keywords, r.Classes} {
+        for _, rule := range rules {
+            if len(rule.Words) == 0 {
+                return errors.New("word rule without words")
+            }
+        }
+    }
+    return nil
+}
+
+// WithPriorityRules weighs the smart crawler's links by rules instead of
+// DefaultPriorityRules. The traditional crawler does not rank links and
+// ignores them.
+func WithPriorityRules(rules *PriorityRules) Option {
+    return func(o *options) error {
+        if rules == nil {
+            return errors.New("priority rules must not be nil")
+        }
+        if err := rules.compile(); err != nil {
+            return err
+        }
+        o.priorityRules = rules
+        return nil
+    }
+}
+
+// weigh is the priority, in points, a link to linkURL gains from the rules
+func (r *PriorityRules) weigh(text models.LinkContext, linkURL string, pageContext models.URLContext) float64 {
+    weight := r.Importance * pageContext.Importance
+
+    anchor := strings.ToLower(scoringText(text))
+    for _, rule := range r.Keywords {
+        if containsAny(anchor, rule.Words) {
+            weight += rule.Weight
+        }
+    }
+    classes := strings.ToLower(text.Classes)
+    for _, rule := range r.Classes {
+        if containsAny(classes, rule.Words) {
+            weight += rule.Weight
+        }
+    }
+    for _, rel := range strings.Fields(strings.ToLower(text.Rel)) {
+        weight += r.Rel[rel]
+    }
+
+    parsed, err := url.Parse(linkURL)
+    if err != nil {
+        return weight
+    }
+    target := parsed.EscapedPath()
+    if parsed.RawQuery != "" {
+        target += "?" + parsed.RawQuery
+    }
+    for _, rule := range r.Paths {
+        if rule.re != nil && rule.re.MatchString(target) {
+            weight += rule.Weight
+        }
+    }
+    host := strings.ToLower(parsed.Hostname())
+    matched := ""
+    var domainWeight float64
+    for _, rule := range r.Domains {
+        if (host == rule.Domain || strings.HasSuffix(host, "."+rule.Domain)) && len(rule.Domain) > len(matched) {
+            matched, domainWeight = rule.Domain, rule.Weight
+        }
+    }
+    return weight + domainWeight
+}
+
+// containsAny reports whether text contains any of words, which are
+// matched lower-cased
+func containsAny(text string, words []string) bool {
+    for _, word := range words {
+        if word != "" && strings.Contains(text, strings.ToLower(word)) {
+            return true
+        }
+    }
+    return false
+}
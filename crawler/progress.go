@@ -0,0 +1,137 @@
+package crawler
+
+import (
+    "sort"
+    "sync"
+    "time"
+
+    "smart-crawler/models"
+)
+
+// SizedFrontier is a Frontier that can count its pending URLs, which
+// progress displays use to estimate how much of a crawl is left
+type SizedFrontier interface {
+    Frontier
+    // Pending returns how many URLs are waiting to be fetched
+    Pending() (int, error)
+}
+
+func (f *dbFrontier) Pending() (int, error) {
+    return f.db.CountPendingURLs(f.crawlID)
+}
+
+// progressTracker keeps the counters behind Progress. Workers update it as
+// fetches start and settle while a display polls it from another goroutine,
+// so it is locked, and a crawl's frontier and budget are copied in when the
+// crawl starts rather than read from the crawler.
+type progressTracker struct {
+    mutex   sync.Mutex
+    running bool
+    crawlID int64
+    started time.Time
+    fetched int
+    skipped int
+    errors  int
+    bytes   int64
+    hosts   map[string]int // Fetches in flight per host
+
+    pending   func() (int, error) // nil when the queue cannot be counted
+    pageLimit int                 // Pages the budget has left at the start; 0 for no limit
+    deadline  time.Time
+}
+
+// start resets the counters for a crawl. pending counts its queue, and
+// limits with stats the pages and time the budget leaves it.
+func (p *progressTracker) start(crawlID int64, pending func() (int, error), limits Budget, stats *models.CrawlStats) {
+    p.mutex.Lock()
+    defer p.mutex.Unlock()
+
+    p.running, p.crawlID, p.started = true, crawlID, time.Now()
+    p.fetched, p.skipped, p.errors, p.bytes = 0, 0, 0, 0
+    p.hosts = make(map[string]int)
+    p.pending = pending
+    p.pageLimit = 0
+    if limits.MaxPages > 0 {
+        p.pageLimit = max(limits.MaxPages-stats.PagesProcessed, 1)
+    }
+    p.deadline = time.Time{}
+    if limits.MaxDuration > 0 {
+        p.deadline = p.started.Add(limits.MaxDuration)
+    }
+}
+
+// stop marks the crawl finished
+func (p *progressTracker) stop() {
+    p.mutex.Lock()
+    defer p.mutex.Unlock()
+
+    p.running = false
+}
+
+// begin records a fetch of rawURL starting and returns its host for settle
+func (p *progressTracker) begin(rawURL string) string {
+    host := urlHost(rawURL)
+
+    p.mutex.Lock()
+    defer p.mutex.Unlock()
+
+    p.hosts[host]++
+    return host
+}
+
+// settle records how the fetch begun for host turned out
+func (p *progressTracker) settle(host string, skipped bool, err error, bytes int64) {
+    p.mutex.Lock()
+    defer p.mutex.Unlock()
+
+    if p.hosts[host]--; p.hosts[host] <= 0 {
+        delete(p.hosts, host)
+    }
+    switch {
+    case err != nil:
+        p.errors++
+    case skipped:
+        p.skipped++
+    default:
+        p.fetched++
+    }
+    p.bytes += bytes
+}
+
+func (p *progressTracker) snapshot() models.CrawlProgress {
+    p.mutex.Lock()
+    progress := models.CrawlProgress{
+        CrawlID:      p.crawlID,
+        Running:      p.running,
+        PagesFetched: p.fetched,
+        PagesSkipped: p.skipped,
+        Errors:       p.errors,
+        Bytes:        p.bytes,
+        Remaining:    -1,
+        Deadline:     p.deadline,
+    }
+    if !p.started.IsZero() {
+        progress.Elapsed = time.Since(p.started)
+    }
+    for host, inFlight := range p.hosts {
+        progress.InFlight += inFlight
+        progress.ActiveHosts = append(progress.ActiveHosts, host)
+    }
+    pending, pageLimit := p.pending, p.pageLimit
+    p.mutex.Unlock()
+
+    sort.Strings(progress.ActiveHosts)
+    // Counted outside the lock, as it may query the database
+    if pending != nil {
+        if queued, err := pending(); err == nil {
+            progress.Remaining = queued
+        }
+    }
+    if pageLimit > 0 {
+        left := max(pageLimit-progress.PagesFetched, 0)
+        if progress.Remaining < 0 || left < progress.Remaining {
+            progress.Remaining = left
+        }
+    }
+    return progress
+}
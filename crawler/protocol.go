@@ -0,0 +1,399 @@
+package crawler
+
+import (
+    "context"
+    "crypto/tls"
+    "fmt"
+    "net"
+    "net/http"
+    "net/http/httptrace"
+    "net/netip"
+    "slices"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/quic-go/quic-go"
+    "github.com/quic-go/quic-go/http3"
+    "golang.org/x/net/http2"
+
+    "smart-crawler/models"
+)
+
+// tlsInfo describes the TLS connection of a response, or is nil for one
+// over plain HTTP
+func tlsInfo(state *tls.ConnectionState) *models.TLSInfo {
+    if state == nil {
+        return nil
+    }
+    info := &models.TLSInfo{
+        Version:     tls.VersionName(state.Version),
+        CipherSuite: tls.CipherSuiteName(state.CipherSuite),
+    }
+    if len(state.PeerCertificates) > 0 {
+        cert := state.PeerCertificates[0]
+        info.CertSubject = cert.Subject.CommonName
+        info.CertIssuer = cert.Issuer.CommonName
+        if len(cert.Issuer.Organization) > 0 {
+            info.CertIssuer = cert.Issuer.Organization[0]
+        }
+        info.CertExpiry = cert.NotAfter
+    }
+    return info
+}
+
+// recordProtocol counts page under the HTTP version it was fetched over
+func recordProtocol(stats *models.CrawlStats, page *models.Page) {
+    if page.Protocol == "" {
+        return
+    }
+    if stats.Protocols == nil {
+        stats.Protocols = make(map[string]*models.ProtocolUsage)
+    }
+    usage := stats.Protocols[page.Protocol]
+    if usage == nil {
+        usage = &models.ProtocolUsage{}
+        stats.Protocols[page.Protocol] = usage
+    }
+    usage.Pages++
+    usage.LoadTime += time.Duration(page.LoadTime) * time.Millisecond
+}
+
+// HTTPVersion is the newest HTTP version a crawler offers servers
+type HTTPVersion string
+
+const (
+    HTTP1 HTTPVersion = "1.1"
+    // HTTP/2 where the server negotiates it over TLS, HTTP/1.1 elsewhere
+    HTTP2 HTTPVersion = "2"
+    // Experimental: HTTP/3 over QUIC to hosts that advertise it, HTTP/2 or
+    // HTTP/1.1 until they have and wherever QUIC fails
+    HTTP3 HTTPVersion = "3"
+)
+
+// ParseHTTPVersion parses "1.1", "2", or "3", with or without an "HTTP/"
+// prefix
+func ParseHTTPVersion(s string) (HTTPVersion, error) {
+    version := HTTPVersion(strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(s)), "HTTP/"))
+    switch version {
+    case HTTP1, HTTP2, HTTP3:
+        return version, nil
+    case "1":
+        return HTTP1, nil
+    }
+    return "", fmt.Errorf("unknown HTTP version %q, expected 1.1, 2, or 3", s)
+}
+
+// HTTPOptions tunes the connections of the default client's transport
+type HTTPOptions struct {
+    Version HTTPVersion // HTTP2 if empty
+    // Connections per host, dialing and idle ones included. Over HTTP/2 and
+    // HTTP/3 a host's requests share one connection, opening another only
+    // once the server's stream limit is reached; a limit of 1 keeps them
+    // on one. 0 for no limit.
+    MaxConnsPerHost int
+    // Idle connections kept per host for reuse; 0 for the default of 10
+    MaxIdleConnsPerHost int
+}
+
+// DefaultHTTPOptions are the connection settings of the default client
+var DefaultHTTPOptions = HTTPOptions{Version: HTTP2, MaxIdleConnsPerHost: 10}
+
+const (
+    // An HTTP/2 connection silent for this long is pinged, and closed if
+    // the ping is not answered within http2PingTimeout, so requests are not
+    // sent down connections a NAT or load balancer dropped
+    http2ReadIdleTimeout = 30 * time.Second
+    http2PingTimeout     = 15 * time.Second
+    // How long an Alt-Svc advertisement is trusted when it gives no ma
+    altSvcDefaultMaxAge = 24 * time.Hour
+    // How long a host whose QUIC connection failed is fetched over TCP
+    // before HTTP/3 is tried again
+    http3BrokenTTL = 5 * time.Minute
+    // QUIC connections idle this long are closed
+    http3IdleTimeout = 90 * time.Second
+    // How long a QUIC handshake may take before the host is taken to be
+    // unreachable over UDP and fetched over TCP instead
+    http3HandshakeTimeout = 3 * time.Second
+)
+
+// WithHTTP sets the HTTP version and per-host connection limits. It applies
+// to the default client, and to one given with WithClient whose transport
+// is an *http.Transport, which is copied first. Requests sent through
+// WithProxies keep the proxies' transports.
+func WithHTTP(opts HTTPOptions) Option {
+    return func(o *options) error {
+        if opts.Version == "" {
+            opts.Version = HTTP2
+        }
+        if _, err := ParseHTTPVersion(string(opts.Version)); err != nil {
+            return err
+        }
+        if opts.MaxConnsPerHost < 0 || opts.MaxIdleConnsPerHost < 0 {
+            return fmt.Errorf("connections per host must not be negative, got %d and %d idle", opts.MaxConnsPerHost, opts.MaxIdleConnsPerHost)
+        }
+        o.http = &opts
+        return nil
+    }
+}
+
+// configure applies the options to transport, a copy the crawler owns, and
+// returns the round tripper to send requests with
+func (h HTTPOptions) configure(transport *http.Transport, dns *DNSCache) (http.RoundTripper, error) {
+    if h.MaxConnsPerHost > 0 {
+        transport.MaxConnsPerHost = h.MaxConnsPerHost
+    }
+    if h.MaxIdleConnsPerHost > 0 {
+        transport.MaxIdleConnsPerHost = h.MaxIdleConnsPerHost
+    }
+    if h.Version == HTTP1 {
+        // A non-nil empty map is how net/http is told not to negotiate h2,
+        // which a cloned transport may still offer
+        transport.ForceAttemptHTTP2 = false
+        transport.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+        if transport.TLSClientConfig != nil {
+            transport.TLSClientConfig.NextProtos = slices.DeleteFunc(transport.TLSClientConfig.NextProtos, func(proto string) bool {
+                return proto == http2.NextProtoTLS
+            })
+        }
+        return transport, nil
+    }
+
+    // A DialContext or TLS config would otherwise turn HTTP/2 off
+    transport.ForceAttemptHTTP2 = true
+    h2, err := http2.ConfigureTransports(transport)
+    if err != nil {
+        return nil, fmt.Errorf("failed to enable HTTP/2: %w", err)
+    }
+    h2.ReadIdleTimeout = http2ReadIdleTimeout
+    h2.PingTimeout = http2PingTimeout
+    if h.Version != HTTP3 {
+        return transport, nil
+    }
+    return newHTTP3Transport(transport, dns), nil
+}
+
+// http3Transport sends requests to hosts that advertised HTTP/3 in an
+// Alt-Svc header over QUIC, and everything else over base. A host whose
+// QUIC connection fails goes back to base for http3BrokenTTL, its request
+// retried there when it has no body that was already sent.
+type http3Transport struct {
+    base http.RoundTripper
+    quic *http3.Transport
+    dns  *DNSCache
+
+    mutex  sync.Mutex
+    alts   map[string]altService // By host:port of the origin
+    broken map[string]time.Time  // Until when each origin is kept off QUIC
+
+    udpOnce sync.Once
+    udp     *quic.Transport
+    udpErr  error
+}
+
+// altService is where an origin advertised it serves HTTP/3
+type altService struct {
+    port    string
+    expires time.Time
+}
+
+func newHTTP3Transport(base *http.Transport, dns *DNSCache) *http3Transport {
+    t := &http3Transport{
+        base:   base,
+        dns:    dns,
+        alts:   make(map[string]altService),
+        broken: make(map[string]time.Time),
+    }
+    var tlsConfig *tls.Config
+    if base.TLSClientConfig != nil {
+        tlsConfig = base.TLSClientConfig.Clone()
+    }
+    t.quic = &http3.Transport{
+        TLSClientConfig: tlsConfig,
+        QUICConfig: &quic.Config{
+            HandshakeIdleTimeout: http3HandshakeTimeout,
+            MaxIdleTimeout:       http3IdleTimeout,
+            KeepAlivePeriod:      http2ReadIdleTimeout,
+        },
+        Dial:            t.dial,
+    }
+    return t
+}
+
+// origin is the host:port a request's connection is keyed by
+func origin(req *http.Request) string {
+    host, port := req.URL.Hostname(), req.URL.Port()
+    if port == "" {
+        port = "443"
+    }
+    return net.JoinHostPort(host, port)
+}
+
+func (t *http3Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+    if req.URL.Scheme != "https" {
+        return t.base.RoundTrip(req)
+    }
+    key := origin(req)
+    if t.advertised(key) {
+        resp, err := t.quic.RoundTrip(req)
+        if err == nil {
+            return resp, nil
+        }
+        if req.Context().Err() != nil {
+            return nil, err
+        }
+        t.markBroken(key)
+        if req.Body != nil && req.Body != http.NoBody {
+            if req.GetBody == nil {
+                return nil, err
+            }
+            body, bodyErr := req.GetBody()
+            if bodyErr != nil {
+                return nil, err
+            }
+            req = req.Clone(req.Context())
+            req.Body = body
+        }
+    }
+
+    resp, err := t.base.RoundTrip(req)
+    if err != nil {
+        return nil, err
+    }
+    if header := resp.Header.Get("Alt-Svc"); header != "" {
+        t.learn(key, header)
+    }
+    return resp, nil
+}
+
+// advertised reports whether origin has a live HTTP/3 advertisement and has
+// not recently failed over QUIC
+func (t *http3Transport) advertised(origin string) bool {
+    t.mutex.Lock()
+    defer t.mutex.Unlock()
+
+    now := time.Now()
+    if until, ok := t.broken[origin]; ok {
+        if now.Before(until) {
+            return false
+        }
+        delete(t.broken, origin)
+    }
+    alt, ok := t.alts[origin]
+    if ok && now.After(alt.expires) {
+        delete(t.alts, origin)
+        return false
+    }
+    return ok
+}
+
+func (t *http3Transport) markBroken(origin string) {
+    t.mutex.Lock()
+    defer t.mutex.Unlock()
+
+    t.broken[origin] = time.Now().Add(http3BrokenTTL)
+}
+
+// learn records the HTTP/3 endpoint of an Alt-Svc header. Only alternatives
+// on the origin's own host are used, so the certificate checked is always
+// the origin's.
+func (t *http3Transport) learn(origin, header string) {
+    t.mutex.Lock()
+    defer t.mutex.Unlock()
+
+    if strings.TrimSpace(header) == "clear" {
+        delete(t.alts, origin)
+        return
+    }
+    for _, entry := range strings.Split(header, ",") {
+        params := strings.Split(entry, ";")
+        protocol, authority, ok := strings.Cut(strings.TrimSpace(params[0]), "=")
+        if !ok || protocol != http3.NextProtoH3 {
+            continue
+        }
+        host, port, err := net.SplitHostPort(strings.Trim(authority, `"`))
+        if err != nil || host != "" {
+            continue
+        }
+        maxAge := altSvcDefaultMaxAge
+        for _, param := range params[1:] {
+            if value, ok := strings.CutPrefix(strings.TrimSpace(param), "ma="); ok {
+                if seconds, err := strconv.Atoi(value); err == nil {
+                    maxAge = time.Duration(seconds) * time.Second
+                }
+            }
+        }
+        t.alts[origin] = altService{port: port, expires: time.Now().Add(maxAge)}
+        return
+    }
+}
+
+// dial opens a QUIC connection to the port addr's origin advertised,
+// resolving its host through the DNS cache when there is one. Every
+// connection shares one UDP socket.
+func (t *http3Transport) dial(ctx context.Context, addr string, tlsConfig *tls.Config, config *quic.Config) (*quic.Conn, error) {
+    t.udpOnce.Do(func() {
+        conn, err := net.ListenUDP("udp", nil)
+        if err != nil {
+            t.udpErr = err
+            return
+        }
+        t.udp = &quic.Transport{Conn: conn}
+    })
+    if t.udpErr != nil {
+        return nil, t.udpErr
+    }
+
+    host, port, err := net.SplitHostPort(addr)
+    if err != nil {
+        return nil, err
+    }
+    t.mutex.Lock()
+    if alt, ok := t.alts[addr]; ok {
+        port = alt.port
+    }
+    t.mutex.Unlock()
+
+    var addrs []netip.Addr
+    if ip, err := netip.ParseAddr(host); err == nil {
+        addrs = []netip.Addr{ip}
+    } else if t.dns != nil {
+        if addrs, err = t.dns.lookupTraced(ctx, host); err != nil {
+            return nil, err
+        }
+    } else if addrs, err = net.DefaultResolver.LookupNetIP(ctx, "ip", host); err != nil {
+        return nil, err
+    }
+
+    numericPort, err := strconv.ParseUint(port, 10, 16)
+    if err != nil {
+        return nil, fmt.Errorf("invalid port %q: %w", port, err)
+    }
+    // The handshake, TLS included, is timed as the connection's
+    trace := httptrace.ContextClientTrace(ctx)
+    var firstErr error
+    for _, ip := range addrs {
+        udpAddr := net.UDPAddrFromAddrPort(netip.AddrPortFrom(ip, uint16(numericPort)))
+        if trace != nil && trace.ConnectStart != nil {
+            trace.ConnectStart("udp", udpAddr.String())
+        }
+        conn, err := t.udp.DialEarly(ctx, udpAddr, tlsConfig, config)
+        if trace != nil && trace.ConnectDone != nil {
+            trace.ConnectDone("udp", udpAddr.String(), err)
+        }
+        if err == nil {
+            return conn, nil
+        }
+        if firstErr == nil {
+            firstErr = err
+        }
+        if ctx.Err() != nil {
+            break
+        }
+    }
+    if firstErr == nil {
+        firstErr = &net.DNSError{Err: "no suitable address", Name: host}
+    }
+    return nil, firstErr
+}
@@ -0,0 +1,199 @@
+package crawler
+
+import (
+    "context"
+    "net/http"
+    "net/url"
+    "strings"
+    "sync"
+
+    "golang.org/x/time/rate"
+
+    "smart-crawler/models"
+)
+
+// URL shorteners whose links are resolved with a request before queueing
+var shortenerHosts = map[string]bool{
+    "t.co": true, "bit.ly": true, "bitly.com": true, "tinyurl.com": true, "goo.gl": true,
+    "ow.ly": true, "buff.ly": true, "is.gd": true, "v.gd": true, "lnkd.in": true,
+    "fb.me": true, "t.ly": true, "rebrand.ly": true, "cutt.ly": true, "rb.gy": true,
+    "tiny.cc": true, "dlvr.it": true, "trib.al": true, "amzn.to": true, "shorturl.at": true,
+    "bl.ink": true, "s.id": true,
+}
+
+// Outbound-tracking redirectors, keyed by host and path or by host alone,
+// to the query parameter holding the target. These are unwrapped without a
+// request.
+var trackingRedirects = map[string]string{
+    "www.google.com/url":              "q",
+    "google.com/url":                  "q",
+    "l.facebook.com/l.php":            "u",
+    "lm.facebook.com/l.php":           "u",
+    "l.instagram.com":                 "u",
+    "www.youtube.com/redirect":        "q",
+    "out.reddit.com":                  "url",
+    "slack-redir.net/link":            "url",
+    "www.linkedin.com/redir/redirect": "url",
+    "vk.com/away.php":                 "to",
+    "t.umblr.com/redirect":            "z",
+    "steamcommunity.com/linkfilter/":  "url",
+}
+
+const (
+    maxRedirectHops   = 10
+    maxResolvedCached = 100000
+)
+
+// isRedirector reports whether rawURL goes through a known shortener or
+// tracking redirector, so its scope can only be judged once resolved
+func isRedirector(rawURL string) bool {
+    parsed, err := url.Parse(rawURL)
+    if err != nil {
+        return false
+    }
+    host := strings.ToLower(parsed.Hostname())
+    return shortenerHosts[host] || trackingParam(host, parsed.Path) != ""
+}
+
+func trackingParam(host, path string) string {
+    if param, ok := trackingRedirects[host+path]; ok {
+        return param
+    }
+    return trackingRedirects[host]
+}
+
+// unwrapTracking returns the target embedded in a tracking redirect URL, or
+// "" if rawURL is not one
+func unwrapTracking(parsed *url.URL) string {
+    param := trackingParam(strings.ToLower(parsed.Hostname()), parsed.Path)
+    if param == "" {
+        return ""
+    }
+    target := parsed.Query().Get(param)
+    if !strings.HasPrefix(target, "http://") && !strings.HasPrefix(target, "https://") {
+        return ""
+    }
+    return target
+}
+
+// WithResolveRedirects controls whether links through URL shorteners and
+// tracking redirectors are replaced by their final targets before queueing.
+// It is on by default; each mapping is saved with the crawl.
+func WithResolveRedirects(enabled bool) Option {
+    return func(o *options) error {
+        o.resolveRedirects = enabled
+        return nil
+    }
+}
+
+// redirectResolver maps redirector URLs to their final targets for one
+// crawl, caching results and saving each new mapping with record.
+type redirectResolver struct {
+    record   func(from, to string) error
+    resolved map[string]string
+    mutex    sync.Mutex
+}
+
+func newRedirectResolver(record func(from, to string) error) *redirectResolver {
+    return &redirectResolver{
+        record:   record,
+        resolved: make(map[string]string),
+    }
+}
+
+// resolve returns the final target of rawURL, or rawURL itself if it is not
+// a known redirector or cannot be resolved. Shorteners are requested with
+// client, waiting on limiter. The error only reports a mapping that could
+// not be saved; the target is still returned.
+func (r *redirectResolver) resolve(ctx context.Context, client *http.Client, limiter *rate.Limiter, rawURL string) (string, error) {
+    if r == nil || !isRedirector(rawURL) {
+        return rawURL, nil
+    }
+
+    r.mutex.Lock()
+    target, ok := r.resolved[rawURL]
+    r.mutex.Unlock()
+    if ok {
+        return target, nil
+    }
+
+    target = rawURL
+    // A shortener may lead to a tracking redirect and vice versa
+    for hops := 0; hops < maxRedirectHops; hops++ {
+        parsed, err := url.Parse(target)
+        if err != nil {
+            break
+        }
+        if unwrapped := unwrapTracking(parsed); unwrapped != "" {
+            target = unwrapped
+            continue
+        }
+        if !shortenerHosts[strings.ToLower(parsed.Hostname())] {
+            break
+        }
+        followed := followRedirects(ctx, client, limiter, target)
+        if followed == "" || followed == target {
+            break
+        }
+        target = followed
+    }
+
+    r.mutex.Lock()
+    if len(r.resolved) >= maxResolvedCached {
+        r.resolved = make(map[string]string)
+    }
+    r.resolved[rawURL] = target
+    r.mutex.Unlock()
+
+    if target == rawURL {
+        return target, nil
+    }
+    return target, r.record(rawURL, target)
+}
+
+// resolveLinks replaces redirector links with their targets
+func (r *redirectResolver) resolveLinks(ctx context.Context, client *http.Client, limiter *rate.Limiter, links []models.URLPriority) error {
+    var firstErr error
+    for i := range links {
+        target, err := r.resolve(ctx, client, limiter, links[i].URL)
+        if err != nil && firstErr == nil {
+            firstErr = err
+        }
+        links[i].URL = target
+    }
+    return firstErr
+}
+
+// followRedirects returns where rawURL finally leads, or "" if it cannot be
+// requested. HEAD is tried first so no body is downloaded.
+func followRedirects(ctx context.Context, base *http.Client, limiter *rate.Limiter, rawURL string) string {
+    client := *base
+    client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+        if len(via) >= maxRedirectHops {
+            return http.ErrUseLastResponse
+        }
+        return nil
+    }
+
+    for _, method := range []string{http.MethodHead, http.MethodGet} {
+        if err := limiter.Wait(ctx); err != nil {
+            return ""
+        }
+        req, err := http.NewRequestWithContext(ctx, method, rawURL, nil)
+        if err != nil {
+            return ""
+        }
+        resp, err := client.Do(req)
+        if err != nil {
+            return ""
+        }
+        resp.Body.Close()
+
+        // Some shorteners refuse HEAD
+        if method == http.MethodHead && (resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented) {
+            continue
+        }
+        return resp.Request.URL.String()
+    }
+    return ""
+}
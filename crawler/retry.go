@@ -0,0 +1,62 @@
+package crawler
+
+import (
+    "context"
+    "time"
+
+    "smart-crawler/models"
+)
+
+// DefaultMaxAttempts is how many failed fetches of a URL the smart crawler
+// allows before dead-lettering it
+const DefaultMaxAttempts = 3
+
+// DefaultRetryBackoff is how long a URL whose fetch failed waits before it
+// is retried; the wait doubles with each further failure
+const DefaultRetryBackoff = 30 * time.Second
+
+// SetRetries retries URLs whose fetch failed, after backoff and then twice
+// as long after each further failure, until they have failed maxAttempts
+// times. They are then marked failed with their last error, to be listed
+// and requeued with the queue command. It applies to frontiers that
+// implement RetryingFrontier; a maxAttempts of 1 dead-letters a URL on its
+// first failure.
+func (s *Smart) SetRetries(maxAttempts int, backoff time.Duration) {
+    s.maxAttempts = max(maxAttempts, 1)
+    s.retryBackoff = backoff
+}
+
+// settleURL marks a fetched URL done in the frontier or, when its fetch
+// failed, has the frontier retry or dead-letter it. Revisits are not
+// queued, so they are only marked done.
+func (s *Smart) settleURL(ctx context.Context, urlPriority models.URLPriority, result *smartCrawlResult) {
+    frontier, ok := s.frontier.(RetryingFrontier)
+    if result.Error == nil || urlPriority.Refresh || !ok {
+        s.frontier.Done(urlPriority.URL)
+        return
+    }
+
+    failed, err := frontier.Fail(urlPriority.URL, result.Error.Error())
+    if err != nil {
+        s.emit(ctx, Event{Type: ErrorOccurred, URL: urlPriority.URL, Err: err})
+        s.frontier.Done(urlPriority.URL)
+        return
+    }
+    result.DeadLettered = failed
+    result.Retrying = !failed
+}
+
+// retriesPending reports whether failed URLs are waiting out their backoff,
+// in which case the crawl is not finished though the frontier is empty
+func (s *Smart) retriesPending(ctx context.Context) bool {
+    frontier, ok := s.frontier.(RetryingFrontier)
+    if !ok || s.refreshing {
+        return false
+    }
+    pending, err := frontier.Retrying()
+    if err != nil {
+        s.emit(ctx, Event{Type: ErrorOccurred, Err: err})
+        return false
+    }
+    return pending
+}
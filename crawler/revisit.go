@@ -0,0 +1,49 @@
+package crawler
+
+import (
+    "math"
+    "time"
+
+    "smart-crawler/models"
+)
+
+// RevisitPolicy configures continuous crawling, where pages already saved
+// are refetched as they become due while new links are still discovered.
+type RevisitPolicy struct {
+    MinInterval time.Duration
+    MaxInterval time.Duration
+    // RefreshShare is the fraction of each pull given to due revisits. The
+    // rest goes to discovery; either side's unused share goes to the other.
+    RefreshShare float64
+}
+
+var DefaultRevisitPolicy = RevisitPolicy{
+    MinInterval:  time.Hour,
+    MaxInterval:  7 * 24 * time.Hour,
+    RefreshShare: 0.5,
+}
+
+// interval estimates how long until a page changes again: the time it has
+// been observed divided by the changes seen plus one. A page that never
+// changes is revisited at roughly doubling intervals; one that changes on
+// most visits keeps being revisited about as often as it changes. history
+// is nil for a page just saved for the first time.
+func (p RevisitPolicy) interval(history *models.RevisitHistory) time.Duration {
+    if history == nil {
+        return p.MinInterval
+    }
+
+    interval := history.Observed / time.Duration(history.Changes+1)
+    if interval < p.MinInterval {
+        return p.MinInterval
+    }
+    if p.MaxInterval > 0 && interval > p.MaxInterval {
+        return p.MaxInterval
+    }
+    return interval
+}
+
+// refreshLimit is how many due revisits to claim in a pull of batch URLs
+func (p RevisitPolicy) refreshLimit(batch int) int {
+    return int(math.Ceil(float64(batch) * p.RefreshShare))
+}
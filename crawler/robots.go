@@ -0,0 +1,322 @@
+package crawler
+
+import (
+    "bufio"
+    "bytes"
+    "context"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "net/url"
+    "regexp"
+    "strings"
+    "sync"
+    "time"
+)
+
+// DefaultRobotsTTL is how long the smart crawler trusts a site's robots.txt
+// before fetching it again
+const DefaultRobotsTTL = time.Hour
+
+const (
+    // How soon a robots.txt that could not be fetched is tried again
+    robotsRetry = time.Minute
+    // RFC 9309 asks crawlers to parse at least 500 KiB
+    robotsMaxSize = 500 << 10
+    // FilteredURLs key for queued URLs dropped when robots.txt changed
+    robotsFiltered = "robots.txt"
+)
+
+// errRobotsDisallowed is returned for a redirect to a URL robots.txt
+// disallows
+var errRobotsDisallowed = errors.New("disallowed by robots.txt")
+
+type robotsRule struct {
+    allow   bool
+    pattern string
+    match   *regexp.Regexp
+}
+
+// robotsRules are the rules of the robots.txt group that applies to the
+// crawler. No rules allows everything.
+type robotsRules struct {
+    rules       []robotsRule
+    disallowAll bool // robots.txt could not be fetched
+}
+
+var robotsAllowAll = &robotsRules{}
+
+func newRobotsRule(allow bool, pattern string) robotsRule {
+    // "*" matches any characters and a trailing "$" anchors the end
+    anchored := strings.HasSuffix(pattern, "$")
+    parts := strings.Split(strings.TrimSuffix(pattern, "$"), "*")
+    for i, part := range parts {
+        parts[i] = regexp.QuoteMeta(part)
+    }
+    expr := "^" + strings.Join(parts, ".*")
+    if anchored {
+        expr += "$"
+    }
+    return robotsRule{allow: allow, pattern: pattern, match: regexp.MustCompile(expr)}
+}
+
+// parseRobots returns the rules of the groups naming agent, or of the "*"
+// groups if none does
+func parseRobots(body []byte, agent string) *robotsRules {
+    type group struct {
+        agents []string
+        rules  []robotsRule
+    }
+    var groups []*group
+    var current *group
+    inAgents := false
+
+    scanner := bufio.NewScanner(bytes.NewReader(body))
+    for scanner.Scan() {
+        line := scanner.Text()
+        if i := strings.IndexByte(line, '#'); i >= 0 {
+            line = line[:i]
+        }
+        key, value, ok := strings.Cut(line, ":")
+        if !ok {
+            continue
+        }
+        value = strings.TrimSpace(value)
+
+        switch strings.ToLower(strings.TrimSpace(key)) {
+        case "user-agent":
+            // Consecutive user-agent lines share one group
+            if !inAgents {
+                current = &group{}
+                groups = append(groups, current)
+                inAgents = true
+            }
+            current.agents = append(current.agents, strings.ToLower(value))
+        case "allow", "disallow":
+            inAgents = false
+            // An empty disallow allows everything
+            if current == nil || value == "" {
+                continue
+            }
+            current.rules = append(current.rules, newRobotsRule(strings.EqualFold(strings.TrimSpace(key), "allow"), value))
+        }
+    }
+
+    collect := func(name string) *robotsRules {
+        var rules *robotsRules
+        for _, g := range groups {
+            for _, a := range g.agents {
+                if a == name {
+                    if rules == nil {
+                        rules = &robotsRules{}
+                    }
+                    rules.rules = append(rules.rules, g.rules...)
+                    break
+                }
+            }
+        }
+        return rules
+    }
+    if rules := collect(agent); rules != nil {
+        return rules
+    }
+    if rules := collect("*"); rules != nil {
+        return rules
+    }
+    return robotsAllowAll
+}
+
+// allows applies the longest matching rule to u's path and query, allow
+// winning ties
+func (r *robotsRules) allows(u *url.URL) bool {
+    if r.disallowAll {
+        return false
+    }
+    path := u.EscapedPath()
+    if path == "" {
+        path = "/"
+    }
+    if u.RawQuery != "" {
+        path += "?" + u.RawQuery
+    }
+
+    allowed, longest := true, -1
+    for _, rule := range r.rules {
+        if !rule.match.MatchString(path) {
+            continue
+        }
+        if n := len(rule.pattern); n > longest || (n == longest && rule.allow) {
+            allowed, longest = rule.allow, n
+        }
+    }
+    return allowed
+}
+
+// String lists the rules, so a refetch can tell whether they changed
+func (r *robotsRules) String() string {
+    if r.disallowAll {
+        return "disallow all"
+    }
+    var b strings.Builder
+    for _, rule := range r.rules {
+        if rule.allow {
+            b.WriteString("allow: ")
+        } else {
+            b.WriteString("disallow: ")
+        }
+        b.WriteString(rule.pattern)
+        b.WriteByte('\n')
+    }
+    return b.String()
+}
+
+func robotsOrigin(u *url.URL) string {
+    return strings.ToLower(u.Scheme) + "://" + strings.ToLower(u.Host)
+}
+
+// robotsFetcher requests a robots.txt, returning its status and body
+type robotsFetcher func(ctx context.Context, robotsURL string) (int, []byte, error)
+
+type robotsEntry struct {
+    rules   *robotsRules // nil until fetched
+    expires time.Time
+    mutex   sync.Mutex // Held while fetching, so a host is asked once
+}
+
+// robotsChange is a refetched robots.txt whose rules differ from before
+type robotsChange struct {
+    origin string
+    rules  *robotsRules
+}
+
+// robotsCache holds the robots.txt rules of each origin a crawl visits,
+// fetching them again once they are ttl old
+type robotsCache struct {
+    ttl     time.Duration
+    agent   string // Product token matched against user-agent lines
+    fetch   robotsFetcher
+    origins map[string]*robotsEntry
+    mutex   sync.Mutex
+}
+
+func newRobotsCache(ttl time.Duration, agent string, fetch robotsFetcher) *robotsCache {
+    return &robotsCache{ttl: ttl, agent: agent, fetch: fetch, origins: make(map[string]*robotsEntry)}
+}
+
+// robotsToken returns the product token of a User-Agent, the part robots.txt
+// user-agent lines name: "smartcrawler" for "SmartCrawler/1.0 (+https://...)"
+func robotsToken(userAgent string) string {
+    token, _, _ := strings.Cut(userAgent, "/")
+    token, _, _ = strings.Cut(token, " ")
+    return strings.ToLower(token)
+}
+
+// allowed reports whether robots.txt lets the crawler fetch u. When a
+// refetch finds the rules changed, the change is returned too.
+//
+// Per RFC 9309 a missing robots.txt (4xx) allows everything and one that
+// cannot be fetched (5xx or a network error) disallows everything, until it
+// is tried again after robotsRetry. Rules fetched earlier stay in force
+// while a refetch fails.
+func (c *robotsCache) allowed(ctx context.Context, u *url.URL) (bool, *robotsChange, error) {
+    if u.Path == "/robots.txt" {
+        return true, nil, nil
+    }
+    origin := robotsOrigin(u)
+
+    c.mutex.Lock()
+    entry := c.origins[origin]
+    if entry == nil {
+        entry = &robotsEntry{}
+        c.origins[origin] = entry
+    }
+    c.mutex.Unlock()
+
+    entry.mutex.Lock()
+    defer entry.mutex.Unlock()
+
+    var change *robotsChange
+    if now := time.Now(); !now.Before(entry.expires) {
+        status, body, err := c.fetch(ctx, origin+"/robots.txt")
+        if ctx.Err() != nil {
+            return false, nil, ctx.Err()
+        }
+
+        var rules *robotsRules
+        switch {
+        case err != nil || status >= 500:
+            entry.expires = now.Add(robotsRetry)
+            if entry.rules == nil {
+                entry.rules = &robotsRules{disallowAll: true}
+            }
+        case status >= 200 && status < 300:
+            rules = parseRobots(body, c.agent)
+        default:
+            rules = robotsAllowAll
+        }
+        if rules != nil {
+            if entry.rules != nil && entry.rules.String() != rules.String() {
+                change = &robotsChange{origin: origin, rules: rules}
+            }
+            entry.rules = rules
+            entry.expires = now.Add(c.ttl)
+        }
+    }
+    return entry.rules.allows(u), change, nil
+}
+
+// fetchRobots requests a robots.txt with the crawler's client, after
+// waiting on the rate limiter like any other request
+func (s *Smart) fetchRobots(ctx context.Context, robotsURL string) (int, []byte, error) {
+    if err := s.limiter.Wait(ctx); err != nil {
+        return 0, nil, err
+    }
+    req, err := http.NewRequestWithContext(ctx, http.MethodGet, robotsURL, nil)
+    if err != nil {
+        return 0, nil, err
+    }
+    resp, err := s.client.Do(req)
+    if err != nil {
+        return 0, nil, err
+    }
+    defer resp.Body.Close()
+
+    body, err := io.ReadAll(io.LimitReader(resp.Body, robotsMaxSize))
+    if err != nil {
+        return 0, nil, fmt.Errorf("failed to read %s: %w", robotsURL, err)
+    }
+    return resp.StatusCode, body, nil
+}
+
+// robotsAllowed reports whether robots.txt lets the crawl fetch u. When the
+// rules changed since they were last fetched, queued URLs they now disallow
+// are pruned from the frontier.
+func (s *Smart) robotsAllowed(ctx context.Context, u *url.URL) (bool, error) {
+    if s.robots == nil {
+        return true, nil
+    }
+    allowed, change, err := s.robots.allowed(ctx, u)
+    if err != nil {
+        return false, err
+    }
+    if change != nil {
+        s.pruneDisallowed(ctx, change)
+    }
+    return allowed, nil
+}
+
+func (s *Smart) pruneDisallowed(ctx context.Context, change *robotsChange) {
+    prunable, ok := s.frontier.(PrunableFrontier)
+    if !ok {
+        return
+    }
+    pruned, err := prunable.Prune(change.origin, func(raw string) bool {
+        u, err := url.Parse(raw)
+        return err == nil && robotsOrigin(u) == change.origin && !change.rules.allows(u)
+    })
+    if err != nil {
+        s.emit(ctx, Event{Type: ErrorOccurred, URL: change.origin + "/robots.txt", Err: fmt.Errorf("failed to prune disallowed URLs: %w", err)})
+    }
+    s.robotsPruned.Add(int64(pruned))
+}
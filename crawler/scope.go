@@ -0,0 +1,80 @@
+package crawler
+
+import (
+    "fmt"
+    "net/url"
+    "strings"
+
+    "golang.org/x/net/publicsuffix"
+)
+
+// Scope decides which discovered links are eligible to be crawled,
+// relative to the start URL
+type Scope string
+
+const (
+    ScopeSameHost     Scope = "same-host"    // Exactly the seed host
+    ScopeSameDomain   Scope = "same-domain"  // Any host under the seed's registrable domain
+    ScopeSubdomains   Scope = "subdomains"   // The seed host and hosts below it
+    ScopeUnrestricted Scope = "unrestricted" // Any host
+)
+
+func ParseScope(s string) (Scope, error) {
+    switch scope := Scope(s); scope {
+    case ScopeSameHost, ScopeSameDomain, ScopeSubdomains, ScopeUnrestricted:
+        return scope, nil
+    case "":
+        return ScopeUnrestricted, nil
+    default:
+        return "", fmt.Errorf("invalid scope %q, use 'same-host', 'same-domain', 'subdomains', or 'unrestricted'", s)
+    }
+}
+
+// scopeFilter applies a Scope to the seed of one crawl
+type scopeFilter struct {
+    scope  Scope
+    host   string
+    domain string
+}
+
+func newScopeFilter(scope Scope, startURL string) *scopeFilter {
+    f := &scopeFilter{scope: scope}
+    if u, err := url.Parse(startURL); err == nil {
+        f.host = strings.ToLower(u.Hostname())
+        f.domain = registrableDomain(f.host)
+    }
+    return f
+}
+
+// registrableDomain returns the public suffix plus one label, e.g.
+// example.co.uk for www.example.co.uk. Hosts without one, such as IP
+// addresses and localhost, are their own domain.
+func registrableDomain(host string) string {
+    domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+    if err != nil {
+        return host
+    }
+    return domain
+}
+
+func (f *scopeFilter) allows(rawURL string) bool {
+    if f == nil || f.scope == ScopeUnrestricted || f.scope == "" {
+        return true
+    }
+
+    u, err := url.Parse(rawURL)
+    if err != nil {
+        return false
+    }
+    host := strings.ToLower(u.Hostname())
+
+    switch f.scope {
+    case ScopeSameHost:
+        return host == f.host
+    case ScopeSameDomain:
+        return registrableDomain(host) == f.domain
+    case ScopeSubdomains:
+        return host == f.host || strings.HasSuffix(host, "."+f.host)
+    }
+    return true
+}
@@ -0,0 +1,67 @@
+package crawler
+
+import (
+    "errors"
+    "math"
+
+    "github.com/PuerkitoBio/goquery"
+
+    "smart-crawler/models"
+)
+
+// ContentAnalyzer scores the pages the smart crawler fetches. Its scores
+// decide whether a page's links are followed and are saved with the page;
+// the crawler fills in Relevance itself when it has a topic. An analyzer is
+// called from every worker at once, so it must be safe for concurrent use.
+type ContentAnalyzer interface {
+    // AnalyzeContent scores an HTML page, parsed as doc from content
+    AnalyzeContent(doc *goquery.Document, content string) models.URLContext
+}
+
+// PriorityScorer ranks the links the smart crawler finds. The crawler
+// adjusts its priority for a topic, site owner hints, and languages, and
+// ranks the pages of a listing itself. A scorer is called from every worker
+// at once, so it must be safe for concurrent use.
+type PriorityScorer interface {
+    // ScoreLink is the priority of link, 0 to 100; higher is fetched sooner
+    ScoreLink(link Link) int
+}
+
+// Link is a link found on a page, as a PriorityScorer sees it
+type Link struct {
+    URL         string
+    Depth       int                // Links from the page at Depth 0 are at Depth 1
+    Text        models.LinkContext // Its anchor, the text around it, its rel and classes
+    Selection   *goquery.Selection // Its element on the page
+    PageURL     string
+    PageContext models.URLContext // The ContentAnalyzer's scores of the page
+}
+
+// WithScorer ranks the smart crawler's links with scorer instead of the
+// link model and priority rules, so it cannot be combined with
+// WithLinkModel or WithPriorityRules
+func WithScorer(scorer PriorityScorer) Option {
+    return func(o *options) error {
+        if scorer == nil {
+            return errors.New("scorer must not be nil")
+        }
+        o.scorer = scorer
+        return nil
+    }
+}
+
+// modelScorer is the default PriorityScorer: the quality the link model
+// expects of the page behind a link, weighed by the priority rules. It
+// remembers each link it scores, so the model learns from the page once
+// fetched.
+type modelScorer struct {
+    model *LinkModel
+    rules *PriorityRules
+}
+
+func (m *modelScorer) ScoreLink(link Link) int {
+    features := linkFeatures(link.Selection, link.Text, link.URL, link.PageURL, link.PageContext)
+    offset := m.rules.weigh(link.Text, link.URL, link.PageContext) * priorityPoint
+    m.model.remember(link.URL, features, offset)
+    return int(math.Round(100 * m.model.predict(features, offset)))
+}
@@ -0,0 +1,286 @@
+package crawler
+
+import (
+    "errors"
+    "fmt"
+    "log"
+    "math"
+    "strings"
+
+    "github.com/PuerkitoBio/goquery"
+    "github.com/andybalholm/cascadia"
+    "go.starlark.net/starlark"
+    "go.starlark.net/starlarkstruct"
+    "go.starlark.net/syntax"
+
+    "smart-crawler/models"
+)
+
+// maxScriptSteps bounds each call into a script, so a runaway loop fails
+// the call instead of stalling a worker
+const maxScriptSteps = 1000000
+
+// Script is a Starlark file whose callbacks customize a smart crawl without
+// changing the crawler. Each callback is optional:
+//
+//   - should_follow(url, context) decides whether a found link is queued;
+//     context has the link's parent, depth, priority, anchor, and rel
+//   - score_link(anchor, url) returns the link's priority, 0 to 100, or None
+//     to keep the crawler's
+//   - extract(doc) returns a dict of fields saved with an HTML page as its
+//     "script" structured data; doc has the page's url, title, and text, and
+//     select(css) returns the matching elements, each with text, html,
+//     attr(name), and select(css)
+//
+// The file is run once when loaded, and its globals are frozen, so the
+// callbacks can be called from every worker at once.
+type Script struct {
+    path         string
+    shouldFollow starlark.Callable
+    scoreLink    starlark.Callable
+    extract      starlark.Callable
+}
+
+// LoadScript runs the Starlark file at path and picks up its callbacks. A
+// file defining none of them is an error.
+func LoadScript(path string) (*Script, error) {
+    thread := scriptThread(path)
+    globals, err := starlark.ExecFileOptions(&syntax.FileOptions{}, thread, path, nil, nil)
+    if err != nil {
+        return nil, fmt.Errorf("loading script: %w", err)
+    }
+
+    script := &Script{path: path}
+    for name, callback := range map[string]*starlark.Callable{
+        "should_follow": &script.shouldFollow,
+        "score_link":    &script.scoreLink,
+        "extract":       &script.extract,
+    } {
+        value, ok := globals[name]
+        if !ok {
+            continue
+        }
+        fn, ok := value.(starlark.Callable)
+        if !ok {
+            return nil, fmt.Errorf("%s: %s is a %s, not a function", path, name, value.Type())
+        }
+        *callback = fn
+    }
+    if script.shouldFollow == nil && script.scoreLink == nil && script.extract == nil {
+        return nil, fmt.Errorf("%s defines none of should_follow, score_link, and extract", path)
+    }
+    return script, nil
+}
+
+// WithScript runs script's callbacks during the smart crawler's crawls. The
+// traditional crawler does not run scripts.
+func WithScript(script *Script) Option {
+    return func(o *options) error {
+        if script == nil {
+            return errors.New("script must not be nil")
+        }
+        o.script = script
+        return nil
+    }
+}
+
+// scriptThread is a thread for one call into a script; threads are cheap,
+// and each call gets its own so calls can run at once
+func scriptThread(path string) *starlark.Thread {
+    thread := &starlark.Thread{
+        Name: path,
+        Print: func(_ *starlark.Thread, msg string) {
+            log.Printf("%s: %s", path, msg)
+        },
+    }
+    thread.SetMaxExecutionSteps(maxScriptSteps)
+    return thread
+}
+
+func (sc *Script) call(fn starlark.Callable, args ...starlark.Value) (starlark.Value, error) {
+    result, err := starlark.Call(scriptThread(sc.path), fn, args, nil)
+    if err != nil {
+        return nil, fmt.Errorf("script %s: %w", fn.Name(), err)
+    }
+    return result, nil
+}
+
+// follow reports whether the script wants link queued
+func (sc *Script) follow(link models.URLPriority) (bool, error) {
+    if sc.shouldFollow == nil {
+        return true, nil
+    }
+    context := starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+        "parent":   starlark.String(link.Parent),
+        "depth":    starlark.MakeInt(link.Depth),
+        "priority": starlark.MakeInt(link.Priority),
+        "anchor":   starlark.String(link.LinkContext.Anchor),
+        "rel":      starlark.String(link.LinkContext.Rel),
+    })
+    result, err := sc.call(sc.shouldFollow, starlark.String(link.URL), context)
+    if err != nil {
+        return true, err
+    }
+    return bool(result.Truth()), nil
+}
+
+// score is the priority the script gives link, if it gives one
+func (sc *Script) score(link models.URLPriority) (int, bool, error) {
+    if sc.scoreLink == nil {
+        return 0, false, nil
+    }
+    result, err := sc.call(sc.scoreLink, starlark.String(link.LinkContext.Anchor), starlark.String(link.URL))
+    if err != nil {
+        return 0, false, err
+    }
+    switch result := result.(type) {
+    case starlark.NoneType:
+        return 0, false, nil
+    case starlark.Int, starlark.Float:
+        f, _ := starlark.AsFloat(result)
+        return clampPriority(int(math.Round(f))), true, nil
+    }
+    return 0, false, fmt.Errorf("script score_link returned a %s, not a number", result.Type())
+}
+
+// extractFields runs the script's extract on the page at pageURL, or
+// returns nil without one
+func (sc *Script) extractFields(doc *goquery.Document, pageURL string) (map[string]interface{}, error) {
+    if sc.extract == nil {
+        return nil, nil
+    }
+    page := starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+        "url":    starlark.String(pageURL),
+        "title":  starlark.String(strings.TrimSpace(doc.Find("title").First().Text())),
+        "text":   starlark.String(visibleText(doc)),
+        "select": scriptSelection{doc.Selection}.selectBuiltin(),
+    })
+    result, err := sc.call(sc.extract, page)
+    if err != nil {
+        return nil, err
+    }
+    if result == starlark.None {
+        return nil, nil
+    }
+    if _, ok := result.(*starlark.Dict); !ok {
+        return nil, fmt.Errorf("script extract returned a %s, not a dict", result.Type())
+    }
+    fields, err := fromStarlark(result)
+    if err != nil {
+        return nil, fmt.Errorf("script extract: %w", err)
+    }
+    return fields.(map[string]interface{}), nil
+}
+
+// fromStarlark converts a value a script returned to its JSON counterpart
+func fromStarlark(value starlark.Value) (interface{}, error) {
+    switch value := value.(type) {
+    case starlark.NoneType:
+        return nil, nil
+    case starlark.Bool:
+        return bool(value), nil
+    case starlark.Int:
+        if i, ok := value.Int64(); ok {
+            return i, nil
+        }
+        f, _ := starlark.AsFloat(value)
+        return f, nil
+    case starlark.Float:
+        return float64(value), nil
+    case starlark.String:
+        return string(value), nil
+    case scriptSelection:
+        return strings.TrimSpace(value.sel.Text()), nil
+    case *starlark.Dict:
+        fields := make(map[string]interface{}, value.Len())
+        for _, item := range value.Items() {
+            key, ok := item[0].(starlark.String)
+            if !ok {
+                return nil, fmt.Errorf("dict key %s is not a string", item[0])
+            }
+            field, err := fromStarlark(item[1])
+            if err != nil {
+                return nil, err
+            }
+            fields[string(key)] = field
+        }
+        return fields, nil
+    case starlark.Iterable:
+        // Lists and tuples
+        var items []interface{}
+        iter := value.Iterate()
+        defer iter.Done()
+        var item starlark.Value
+        for iter.Next(&item) {
+            converted, err := fromStarlark(item)
+            if err != nil {
+                return nil, err
+            }
+            items = append(items, converted)
+        }
+        return items, nil
+    }
+    return nil, fmt.Errorf("cannot save a %s", value.Type())
+}
+
+// scriptSelection is an element of a page, or the page, as scripts see it
+type scriptSelection struct {
+    sel *goquery.Selection
+}
+
+func (s scriptSelection) String() string        { return fmt.Sprintf("<element %s>", goquery.NodeName(s.sel)) }
+func (s scriptSelection) Type() string          { return "element" }
+func (s scriptSelection) Freeze()               {}
+func (s scriptSelection) Truth() starlark.Bool  { return s.sel.Length() > 0 }
+func (s scriptSelection) Hash() (uint32, error) { return 0, errors.New("unhashable type: element") }
+
+func (s scriptSelection) AttrNames() []string {
+    return []string{"attr", "html", "select", "text"}
+}
+
+func (s scriptSelection) Attr(name string) (starlark.Value, error) {
+    switch name {
+    case "text":
+        return starlark.String(strings.TrimSpace(s.sel.Text())), nil
+    case "html":
+        html, err := goquery.OuterHtml(s.sel)
+        if err != nil {
+            return nil, err
+        }
+        return starlark.String(html), nil
+    case "attr":
+        return starlark.NewBuiltin("attr", func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+            var attr string
+            if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &attr); err != nil {
+                return nil, err
+            }
+            if value, ok := s.sel.Attr(attr); ok {
+                return starlark.String(value), nil
+            }
+            return starlark.None, nil
+        }), nil
+    case "select":
+        return s.selectBuiltin(), nil
+    }
+    return nil, nil
+}
+
+// selectBuiltin is select(css), the elements under s matching a CSS
+// selector, in document order
+func (s scriptSelection) selectBuiltin() *starlark.Builtin {
+    return starlark.NewBuiltin("select", func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+        var selector string
+        if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &selector); err != nil {
+            return nil, err
+        }
+        compiled, err := cascadia.Compile(selector)
+        if err != nil {
+            return nil, err
+        }
+        var elements []starlark.Value
+        s.sel.FindMatcher(compiled).Each(func(_ int, el *goquery.Selection) {
+            elements = append(elements, scriptSelection{el})
+        })
+        return starlark.NewList(elements), nil
+    })
+}
@@ -0,0 +1,116 @@
+package crawler
+
+import (
+    "errors"
+    "fmt"
+    "strings"
+    "sync"
+
+    "github.com/PuerkitoBio/goquery"
+    "github.com/andybalholm/cascadia"
+    "github.com/antchfx/htmlquery"
+    "github.com/antchfx/xpath"
+    "golang.org/x/net/html"
+)
+
+// Selector picks elements out of a page by a CSS selector or an XPath
+// expression. XPath reaches what CSS cannot, such as elements by their text
+// (//a[contains(text(), 'Next')]) or by what comes before them
+// (//h2[.='Specs']/following-sibling::table).
+type Selector struct {
+    expr string
+    css  cascadia.Selector
+    // Evaluating an expression changes its state, so evaluations take turns;
+    // the node sets they return are copies, iterated at once
+    xpath *xpath.Expr
+    mu    sync.Mutex
+}
+
+// ParseSelector compiles expr as XPath when it starts with / or (, like
+// //main//a or (//table)[2], and as a CSS selector otherwise
+func ParseSelector(expr string) (*Selector, error) {
+    expr = strings.TrimSpace(expr)
+    if strings.HasPrefix(expr, "/") || strings.HasPrefix(expr, "(") {
+        return compileXPath(expr)
+    }
+    return compileCSS(expr)
+}
+
+func compileCSS(expr string) (*Selector, error) {
+    css, err := cascadia.Compile(expr)
+    if err != nil {
+        return nil, err
+    }
+    return &Selector{expr: expr, css: css}, nil
+}
+
+func compileXPath(expr string) (*Selector, error) {
+    compiled, err := xpath.Compile(expr)
+    if err != nil {
+        return nil, fmt.Errorf("invalid XPath %q: %w", expr, err)
+    }
+    return &Selector{expr: expr, xpath: compiled}, nil
+}
+
+// WithLinkSelector restricts the links crawlers follow to the a[href]
+// elements selector selects or that are inside what it selects, such as
+// an article's body or a listing's results. The smart crawler still
+// follows the pages of a paginated listing.
+func WithLinkSelector(selector *Selector) Option {
+    return func(o *options) error {
+        if selector == nil {
+            return errors.New("link selector must not be nil")
+        }
+        o.linkSelector = selector
+        return nil
+    }
+}
+
+func (s *Selector) String() string {
+    return s.expr
+}
+
+// evaluate is what the XPath expression evaluates to under node: a node
+// iterator, or a string, number, or boolean
+func (s *Selector) evaluate(node *html.Node) interface{} {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    return s.xpath.Evaluate(htmlquery.CreateXPathNavigator(node))
+}
+
+// find is the elements under sel the selector selects, in document order.
+// Attribute and text nodes an XPath expression selects stand for the
+// element they belong to; other results select nothing.
+func (s *Selector) find(sel *goquery.Selection) *goquery.Selection {
+    if s.css != nil {
+        return sel.FindMatcher(s.css)
+    }
+    var nodes []*html.Node
+    for _, root := range sel.Nodes {
+        it, ok := s.evaluate(root).(*xpath.NodeIterator)
+        if !ok {
+            continue
+        }
+        for it.MoveNext() {
+            // An attribute's navigator is at the element it belongs to
+            node := it.Current().(*htmlquery.NodeNavigator).Current()
+            if node.Type != html.ElementNode {
+                node = node.Parent
+            }
+            if node != nil && node.Type == html.ElementNode {
+                nodes = append(nodes, node)
+            }
+        }
+    }
+    return sel.FindNodes(nodes...)
+}
+
+// linkElements is the a[href] elements of doc, or with selector, those it
+// selects or that are inside what it selects
+func linkElements(doc *goquery.Document, selector *Selector) *goquery.Selection {
+    if selector == nil {
+        return doc.Find("a[href]")
+    }
+    found := selector.find(doc.Selection)
+    return found.Filter("a[href]").AddSelection(found.Find("a[href]"))
+}
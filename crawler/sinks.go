@@ -0,0 +1,37 @@
+package crawler
+
+import (
+    "context"
+    "errors"
+
+    "smart-crawler/models"
+)
+
+// PageSink receives every page a crawler saves, e.g. to stream it to a
+// message bus for downstream indexers.
+type PageSink interface {
+    Publish(ctx context.Context, page *models.Page) error
+}
+
+// WithPageSink publishes every saved page to sink. It can be given more
+// than once.
+func WithPageSink(sink PageSink) Option {
+    return func(o *options) error {
+        if sink == nil {
+            return errors.New("page sink must not be nil")
+        }
+        o.sinks = append(o.sinks, sink)
+        return nil
+    }
+}
+
+type pageSinks []PageSink
+
+func (p pageSinks) publish(ctx context.Context, page *models.Page) error {
+    for _, sink := range p {
+        if err := sink.Publish(ctx, page); err != nil {
+            return err
+        }
+    }
+    return nil
+}
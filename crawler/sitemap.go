@@ -0,0 +1,197 @@
+package crawler
+
+import (
+    "bufio"
+    "bytes"
+    "compress/gzip"
+    "context"
+    "encoding/xml"
+    "fmt"
+    "io"
+    "net/http"
+    "net/url"
+    "strings"
+
+    "smart-crawler/models"
+    "smart-crawler/utils"
+)
+
+const (
+    // The sitemap protocol caps a sitemap at 50 MB uncompressed
+    maxSitemapSize = 50 << 20
+    // Most sitemaps an audit reads, indexes included, so a generated index
+    // that lists itself or loops cannot keep it reading forever
+    maxSitemaps = 10000
+)
+
+// SetSitemapOnly makes Crawl an audit of the site's sitemaps instead of a
+// breadth-first crawl: it fetches every URL the sitemaps list, following
+// sitemap indexes, and no links. The sitemaps are those robots.txt names,
+// or /sitemap.xml; a start URL ending in .xml, .xml.gz, or .txt is read as
+// the sitemap itself. Each page is saved with its status and metadata at
+// depth 0, with the sitemap listing it as its parent, and the crawl is
+// recorded as a "sitemap" crawl. maxDepth is ignored.
+func (t *Traditional) SetSitemapOnly(enabled bool) {
+    t.sitemapOnly = enabled
+}
+
+// queueSitemapURLs queues the URLs of startURL's sitemaps that are in scope
+// and not yet visited, until they run out, the budget is spent, or ctx is
+// cancelled. Sitemaps that cannot be read count as errors.
+func (t *Traditional) queueSitemapURLs(ctx context.Context, startURL string, scope *scopeFilter, visited seenSet, queue chan<- models.URLPriority, stats *models.CrawlStats) {
+    sitemaps := t.findSitemaps(ctx, startURL)
+    read := make(map[string]bool)
+    for len(sitemaps) > 0 && len(read) < maxSitemaps {
+        sitemap := sitemaps[0]
+        sitemaps = sitemaps[1:]
+        if read[sitemap] {
+            continue
+        }
+        read[sitemap] = true
+        if ctx.Err() != nil || t.budgetTracker.exhausted() {
+            return
+        }
+
+        body, err := t.fetchSitemap(ctx, sitemap)
+        if err != nil {
+            stats.Errors++
+            t.emit(ctx, Event{Type: ErrorOccurred, URL: sitemap, Err: err})
+            continue
+        }
+        pages, indexed, err := parseSitemap(body, sitemap)
+        if err != nil {
+            stats.Errors++
+            t.emit(ctx, Event{Type: ErrorOccurred, URL: sitemap, Err: err})
+            continue
+        }
+        sitemaps = append(sitemaps, indexed...)
+        for _, page := range pages {
+            page = t.normalizer.Normalize(page)
+            if !scope.allows(page) || !t.urlFilter.Allow(page) || visited.testAndAdd(t.normalizer.Fingerprint(page)) {
+                continue
+            }
+            listed := models.URLPriority{URL: page, Parent: sitemap}
+            select {
+            case queue <- listed:
+            case <-ctx.Done():
+                return
+            }
+            t.emit(ctx, Event{Type: LinkDiscovered, URL: page, Link: &listed})
+        }
+    }
+}
+
+// findSitemaps is where the audit of startURL starts: startURL itself when
+// it names a sitemap, else the sitemaps robots.txt lists, else /sitemap.xml
+func (t *Traditional) findSitemaps(ctx context.Context, startURL string) []string {
+    start, err := url.Parse(startURL)
+    if err != nil {
+        return nil
+    }
+    path := strings.ToLower(start.Path)
+    for _, suffix := range []string{".xml", ".xml.gz", ".txt"} {
+        if strings.HasSuffix(path, suffix) {
+            return []string{startURL}
+        }
+    }
+
+    root := &url.URL{Scheme: start.Scheme, Host: start.Host}
+    robots := root.ResolveReference(&url.URL{Path: "/robots.txt"}).String()
+    if body, err := t.fetchSitemap(ctx, robots); err == nil {
+        if sitemaps := robotsSitemaps(body); len(sitemaps) > 0 {
+            return sitemaps
+        }
+    }
+    return []string{root.ResolveReference(&url.URL{Path: "/sitemap.xml"}).String()}
+}
+
+// fetchSitemap reads the sitemap or robots.txt at sitemapURL, gunzipping
+// it when it is compressed
+func (t *Traditional) fetchSitemap(ctx context.Context, sitemapURL string) ([]byte, error) {
+    if err := t.limiter.Wait(ctx); err != nil {
+        return nil, err
+    }
+    req, err := http.NewRequestWithContext(ctx, "GET", sitemapURL, nil)
+    if err != nil {
+        return nil, err
+    }
+    resp, err := t.client.Do(req)
+    if err != nil {
+        return nil, err
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode != http.StatusOK {
+        return nil, fmt.Errorf("sitemap %s: %s", sitemapURL, resp.Status)
+    }
+
+    body := bufio.NewReader(resp.Body)
+    var reader io.Reader = body
+    // .xml.gz files are served as gzip data, not gzip-encoded XML
+    if magic, _ := body.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+        gz, err := gzip.NewReader(body)
+        if err != nil {
+            return nil, fmt.Errorf("sitemap %s: %w", sitemapURL, err)
+        }
+        defer gz.Close()
+        reader = gz
+    }
+    return io.ReadAll(io.LimitReader(reader, maxSitemapSize))
+}
+
+// robotsSitemaps is the Sitemap lines of a robots.txt, which apply
+// whatever the user agent
+func robotsSitemaps(body []byte) []string {
+    var sitemaps []string
+    scanner := bufio.NewScanner(bytes.NewReader(body))
+    for scanner.Scan() {
+        key, value, ok := strings.Cut(scanner.Text(), ":")
+        if !ok || !strings.EqualFold(strings.TrimSpace(key), "sitemap") {
+            continue
+        }
+        if value = strings.TrimSpace(value); utils.IsValidURL(value) {
+            sitemaps = append(sitemaps, value)
+        }
+    }
+    return sitemaps
+}
+
+// parseSitemap is the page URLs a sitemap lists and the sitemaps a sitemap
+// index lists. A sitemap that is not XML is read as the text format, one
+// URL per line.
+func parseSitemap(body []byte, sitemapURL string) (pages, sitemaps []string, err error) {
+    valid := func(locs []string) []string {
+        var urls []string
+        for _, loc := range locs {
+            if loc = resolveURL(sitemapURL, strings.TrimSpace(loc)); loc != "" && utils.IsValidURL(loc) {
+                urls = append(urls, loc)
+            }
+        }
+        return urls
+    }
+
+    trimmed := bytes.TrimSpace(body)
+    if !bytes.HasPrefix(trimmed, []byte("<")) {
+        return valid(strings.Split(string(trimmed), "\n")), nil, nil
+    }
+    var file struct {
+        URLs []struct {
+            Loc string `xml:"loc"`
+        } `xml:"url"`
+        Sitemaps []struct {
+            Loc string `xml:"loc"`
+        } `xml:"sitemap"`
+    }
+    decoder := xml.NewDecoder(bytes.NewReader(trimmed))
+    decoder.Strict = false
+    if err := decoder.Decode(&file); err != nil {
+        return nil, nil, fmt.Errorf("invalid sitemap %s: %w", sitemapURL, err)
+    }
+    var pageLocs, sitemapLocs []string
+    for _, u := range file.URLs {
+        pageLocs = append(pageLocs, u.Loc)
+    }
+    for _, s := range file.Sitemaps {
+        sitemapLocs = append(sitemapLocs, s.Loc)
+    }
+    return valid(pageLocs), valid(sitemapLocs), nil
+}
@@ -2,323 +2,1229 @@ package crawler
 
 import (
     "context"
-    "crypto/md5"
+    "errors"
     "fmt"
-    "io"
+    "math"
     "net/http"
     "net/url"
     "strings"
     "sync"
+    "sync/atomic"
     "time"
 
     "github.com/PuerkitoBio/goquery"
+    "go.opentelemetry.io/otel/trace"
+    "golang.org/x/net/html"
     "golang.org/x/time/rate"
 
+    "smart-crawler/audit"
     "smart-crawler/database"
     "smart-crawler/models"
     "smart-crawler/utils"
 )
 
 type Smart struct {
-    db               *database.PostgresDB
+    eventEmitter
+    db               database.Store
     client           *http.Client
+    userAgent        string
     limiter          *rate.Limiter
     workers          int
-    contentAnalyzer  *ContentAnalyzer
+    contentAnalyzer  ContentAnalyzer
     duplicateDetector *DuplicateDetector
+    duplicates       func() *DuplicateDetector // Builds each crawl's duplicateDetector
+    nearDuplicate    float64 // Similarity at which pages are skipped; 0 disables it
+    handlers         *ContentHandlers
+    frontier         Frontier
+    tagRules         []TagRule
+    sinks            pageSinks
+    requestHooks     []RequestHook
+    responseHooks    []ResponseHook
+
+    checkpointInterval time.Duration // 0 disables checkpoints
+    resume             bool
+
+    writeBatch         int           // Pages saved per transaction
+    writeFlushInterval time.Duration // Longest a fetched page waits to be saved
+
+    maxAttempts  int           // Failed fetches allowed per URL
+    retryBackoff time.Duration // Wait before a failed URL's first retry
+
+    drainTimeout time.Duration // Grace for fetches under way when stopped
+
+    autoscale *Autoscale  // nil for a fixed pool of workers
+    scaler    *autoscaler // sizes the running crawl's pool; nil when fixed
+
+    heapSize int // URLs the in-memory frontier holds; 0 serves crawl_queue directly
+
+    hostConcurrency int        // Fetches per host; 0 for no limit
+    queue           *hostQueue // URLs the running crawl claimed, waiting for workers
+
+    minExpandQuality    float64
+    minExpandImportance float64
+
+    paginationDepth int
+    pagination      *paginationTracker // continuation pages of the running crawl
+
+    scope       Scope
+    scopeFilter *scopeFilter // scope applied to the running crawl's seed
+    urlFilter   *URLFilter
+    crawlID     int64        // Session of the running crawl
+    crawlUUID   string
+
+    budget        Budget
+    budgetTracker *budgetTracker // budget spent by the running crawl
+    progress      progressTracker
+    gate          pauseGate
+
+    revisit    *RevisitPolicy // nil for a batch crawl
+    refreshing bool           // Set while Refresh runs
+
+    changes       *ChangeMonitor // nil stores no diffs of changed pages
+    notifications sync.WaitGroup // change notifications being sent
+
+    resolveRedirects bool
+    redirects        *redirectResolver // nil unless resolving for the running crawl
+
+    canonicals *canonicalClaims // canonical URLs named in the running crawl
+
+    maxResponseSize int64 // 0 reads bodies whole
+
+    holdout *holdout // nil unless evaluating against the baseline policy
+
+    strategy StrategySelector
+
+    languages       []string
+    strictLanguages bool
+    languageRouter  *languageRouter // routes links of the running crawl; nil without target languages
+
+    stallTimeout  time.Duration // 0 disables stall detection
+    stallAlerters []StallAlerter
+    stalls        *stallMonitor // stalls of the running crawl
+    timings       *timingReservoir // fetch timings of the running crawl
+    loads         *loadRecorder    // load times and throughput of the running crawl
+
+    harvestThreshold float64 // 0 does not track the harvest rate
+    scorer           PriorityScorer
+    linkModel        *LinkModel // Learns from fetched pages; nil with a custom scorer
+    topic            *Topic     // nil crawls without one
+    script           *Script    // nil runs no script
+    extraction       *ExtractionRules // nil extracts nothing
+    imageOptions     *ImageOptions    // nil records no images
+    images           *imageRecorder   // images of the running crawl's pages
+    linkSelector     *Selector        // nil follows every link
+    normalizer       *utils.URLNormalizer // nil normalizes like utils.NormalizeURL
+    spam             *SpamFilter          // nil flags no spam
+    documents        DocumentFormats  // Documents followed for their text
+
+    robotsTTL    time.Duration // 0 ignores robots.txt
+    robots       *robotsCache  // robots.txt rules seen by the running crawl
+    robotsPruned atomic.Int64  // Queued URLs dropped by robots.txt changes
+
+    auth *Auth // nil without credentials
+
+    dns         *DNSCache // nil without WithDNSCache
+    dnsPrefetch bool
 }
 
-func NewSmart(db *database.PostgresDB, workers int) *Smart {
-    return &Smart{
-        db: db,
-        client: &http.Client{
-            Timeout: 30 * time.Second,
-            Transport: &http.Transport{
-                MaxIdleConns:        100,
-                MaxIdleConnsPerHost: 10,
-                IdleConnTimeout:     90 * time.Second,
-            },
-        },
-        limiter:           rate.NewLimiter(rate.Limit(15), 30), // Higher rate for smart crawler
-        workers:           workers,
-        contentAnalyzer:   NewContentAnalyzer(),
-        duplicateDetector: NewDuplicateDetector(),
+// NewSmart builds a smart crawler that writes to db. Without options it runs
+// 10 workers at 15 requests per second, with bursts of 30.
+func NewSmart(db database.Store, opts ...Option) (*Smart, error) {
+    o, err := buildOptions(opts, rate.Limit(15), 30) // Higher rate for smart crawler
+    if err != nil {
+        return nil, err
+    }
+    if o.analyzer == nil {
+        o.analyzer = NewDefaultAnalyzer()
+    }
+    if o.scorer != nil && (o.linkModel != nil || o.priorityRules != nil) {
+        return nil, errors.New("a custom scorer does not use the link model or priority rules")
+    }
+    if o.scorer == nil {
+        if o.linkModel == nil {
+            o.linkModel = NewLinkModel()
+        }
+        if o.priorityRules == nil {
+            o.priorityRules = DefaultPriorityRules()
+        }
+        o.scorer = &modelScorer{model: o.linkModel, rules: o.priorityRules}
+    }
+
+    s := &Smart{
+        eventEmitter:       eventEmitter{logger: o.logger},
+        db:                 db,
+        client:             o.client,
+        userAgent:          o.userAgent,
+        limiter:            rate.NewLimiter(o.limit, o.burst),
+        workers:            o.workers,
+        contentAnalyzer:    o.analyzer,
+        harvestThreshold:   o.harvestThreshold,
+        scorer:             o.scorer,
+        linkModel:          o.linkModel,
+        topic:              o.topic,
+        script:             o.script,
+        extraction:         o.extraction,
+        imageOptions:       o.images,
+        linkSelector:       o.linkSelector,
+        normalizer:         o.normalizer,
+        spam:               o.spam,
+        duplicates:         NewDuplicateDetector,
+        handlers:           NewContentHandlers(),
+        frontier:           &dbFrontier{db: db},
+        scope:              o.scope,
+        urlFilter:          o.urlFilter,
+        budget:             o.budget,
+        tagRules:           o.tagRules,
+        sinks:              o.sinks,
+        resolveRedirects:   o.resolveRedirects,
+        strategy:           DefaultStrategy,
+        stallTimeout:       DefaultStallTimeout,
+        robotsTTL:          DefaultRobotsTTL,
+        maxResponseSize:    o.maxResponseSize,
+        paginationDepth:    DefaultPaginationDepth,
+        writeBatch:         DefaultWriteBatch,
+        writeFlushInterval: DefaultWriteFlushInterval,
+        maxAttempts:        DefaultMaxAttempts,
+        retryBackoff:       DefaultRetryBackoff,
+        drainTimeout:       DefaultDrainTimeout,
+        hostConcurrency:    DefaultHostConcurrency,
+        auth:               o.auth,
+        dns:                o.dns,
+    }
+    if o.seen != (SeenOptions{}) {
+        s.duplicates = func() *DuplicateDetector {
+            return NewBloomDuplicateDetector(o.seen, func(hash string) (bool, error) {
+                return s.db.HasContentHash(s.crawlID, hash)
+            })
+        }
+    }
+    if o.auditLog != nil {
+        s.client.Transport = &audit.Transport{
+            Base: s.client.Transport,
+            Log:  o.auditLog,
+            Rule: func() audit.Rule { return limiterRule(s.limiter, s.robotsTTL > 0) },
+        }
+    }
+    s.registerDefaultHandlers()
+    return s, nil
+}
+
+// ContentHandlers returns the registry of per-media-type handlers, so new
+// content types can be supported by registering a handler.
+func (s *Smart) ContentHandlers() *ContentHandlers {
+    return s.handlers
+}
+
+// SetFrontier replaces the Postgres crawl_queue with another frontier, such
+// as one shared between crawler instances.
+func (s *Smart) SetFrontier(frontier Frontier) {
+    s.frontier = frontier
+}
+
+// SetFetchStrategy chooses how each URL is fetched, e.g. HeadFirstStrategy
+// to check content types before downloading. nil restores DefaultStrategy.
+// CrawlStats.Fetches accounts for the requests and bytes of each strategy.
+func (s *Smart) SetFetchStrategy(selector StrategySelector) {
+    if selector == nil {
+        selector = DefaultStrategy
+    }
+    s.strategy = selector
+}
+
+// SetLanguages steers the crawl toward pages in languages (ISO 639-1 codes
+// like "en" or "de") by the hints links carry before they are fetched:
+// hreflang, a language path prefix, subdomain, or query parameter, or an
+// anchor naming a language. Links hinting at a target language are boosted
+// and others demoted, or dropped when strict. Links without hints are left
+// alone.
+func (s *Smart) SetLanguages(languages []string, strict bool) {
+    s.languages = languages
+    s.strictLanguages = strict
+}
+
+// SetStallTimeout sets how long the crawl may go without a successful fetch
+// while URLs are pending before it is reported stalled: a CrawlStalled event
+// is emitted, each stall alerter is called, and CrawlStats.Stalls counts it.
+// The default is DefaultStallTimeout; 0 disables detection.
+func (s *Smart) SetStallTimeout(after time.Duration) {
+    s.stallTimeout = after
+}
+
+// AddStallAlerter tells alerter about every stall
+func (s *Smart) AddStallAlerter(alerter StallAlerter) {
+    s.stallAlerters = append(s.stallAlerters, alerter)
+}
+
+// SetRobotsTTL sets how long a site's robots.txt is trusted before it is
+// fetched again, so long crawls follow rules the site changes midway. When
+// the rules change, queued URLs they now disallow are dropped from the
+// frontier if it implements PrunableFrontier, and counted in
+// CrawlStats.FilteredURLs. The default is DefaultRobotsTTL; 0 stops the
+// crawler from consulting robots.txt, e.g. when replaying an archive.
+func (s *Smart) SetRobotsTTL(ttl time.Duration) {
+    s.robotsTTL = ttl
+}
+
+// SetCheckpointInterval periodically persists the duplicate detector and
+// stats so an interrupted crawl can be resumed. A final checkpoint is written
+// when the crawl stops.
+func (s *Smart) SetCheckpointInterval(interval time.Duration) {
+    s.checkpointInterval = interval
+}
+
+// SetResume makes Crawl restore the last checkpoint for its start URL and
+// continue from the pending frontier rather than reseeding.
+func (s *Smart) SetResume(resume bool) {
+    s.resume = resume
+}
+
+// SetExpansionThreshold stops the crawler from following links on HTML pages
+// whose content quality or importance falls below the given scores. Such
+// pages are still stored; the start page is always expanded.
+func (s *Smart) SetExpansionThreshold(minQuality, minImportance float64) {
+    s.minExpandQuality = minQuality
+    s.minExpandImportance = minImportance
+}
+
+// SetPaginationDepth sets how many pages past the first a paginated listing
+// is followed. Links between the pages of a listing, found by rel=next and
+// rel=prev or by page numbers like ?page=3 and /page/3, get a priority of
+// their own and do not count against the crawl depth; listing pages are
+// expanded whatever their content quality. Continuation pages past the
+// depth are counted in CrawlStats.FilteredURLs. The default is
+// DefaultPaginationDepth; 0 follows no continuation pages.
+func (s *Smart) SetPaginationDepth(pages int) {
+    s.paginationDepth = pages
+}
+
+// SetContinuous makes Crawl run until cancelled or out of budget, revisiting
+// saved pages as policy makes them due alongside discovering new ones. An
+// empty frontier no longer ends the crawl.
+func (s *Smart) SetContinuous(policy RevisitPolicy) {
+    s.revisit = &policy
+}
+
+// SetPersistentDuplicates keeps the duplicate detector's content hashes in
+// the database instead of memory, with the cacheSize most recent in front,
+// so duplicates are recognized across restarts, recrawls, and instances.
+// Content an earlier crawl saved is skipped as unchanged but its links are
+// still followed. It replaces the detector WithSeenFilter bounds.
+func (s *Smart) SetPersistentDuplicates(cacheSize int) {
+    s.duplicates = func() *DuplicateDetector {
+        return NewPersistentDuplicateDetector(s.db, cacheSize)
+    }
+}
+
+// SetNearDuplicateThreshold skips pages whose title and text are at least
+// similarity (0-1, e.g. 0.9) alike to a page the crawl already saved, such
+// as print views or the same article under another section. The store
+// compares the start of each page by trigrams. 0 disables it.
+func (s *Smart) SetNearDuplicateThreshold(similarity float64) {
+    s.nearDuplicate = similarity
+}
+
+// SetHoldout measures how much the prioritization helps within the crawl
+// itself: a random fraction of frontier pulls takes URLs in queue order
+// instead, and CrawlStats.Evaluation compares what the URLs each policy chose
+// yielded. Saved pages are tagged policy:smart or policy:baseline. The
+// frontier must implement BaselineFrontier. 0 disables it.
+func (s *Smart) SetHoldout(fraction float64) {
+    s.holdout = nil
+    if fraction > 0 {
+        s.holdout = newHoldout(fraction)
     }
 }
 
 func (s *Smart) Crawl(ctx context.Context, startURL string, maxDepth int) (*models.CrawlStats, error) {
-    start := time.Now()
+    if _, ok := s.frontier.(BaselineFrontier); s.holdout != nil && !ok {
+        return nil, fmt.Errorf("holdout evaluation needs a frontier that can serve URLs in queue order")
+    }
+    if s.heapSize > 0 && s.holdout != nil {
+        return nil, fmt.Errorf("holdout evaluation needs the crawl_queue frontier without a heap")
+    }
+    if s.nearDuplicate > 0 {
+        if err := s.db.PrepareSimilarity(); err != nil {
+            return nil, err
+        }
+    }
     stats := &models.CrawlStats{}
+    startURL = s.normalizer.Normalize(startURL)
+
+    // Each crawl gets a detector of its own, whose hashes spilled to disk go
+    // once the crawl ends, after its last checkpoint
+    s.duplicateDetector = s.duplicates()
+    defer s.duplicateDetector.Close()
+
+    // Restore state from a previous, interrupted crawl of the same seed
+    var resumed bool
+    var elapsedBefore time.Duration
+    if s.resume {
+        checkpoint, err := s.loadCheckpoint(startURL)
+        if err != nil {
+            return nil, err
+        }
+        if checkpoint != nil {
+            *stats = checkpoint.Stats
+            elapsedBefore = checkpoint.Stats.Duration
+            if err := s.duplicateDetector.Restore(s.db, stats.CrawlID, checkpoint.SeenFilter); err != nil {
+                return nil, fmt.Errorf("failed to restore checkpoint: %w", err)
+            }
+            resumed = true
+        }
+    }
+
+    if !resumed {
+        mode := "smart"
+        if s.revisit != nil {
+            mode = "continuous"
+        }
+        crawlID, crawlUUID, err := s.db.CreateCrawl(mode, startURL, maxDepth)
+        if err != nil {
+            return nil, fmt.Errorf("failed to create crawl: %w", err)
+        }
+        stats.CrawlID, stats.CrawlUUID = crawlID, crawlUUID
+    }
+    s.crawlID, s.crawlUUID = stats.CrawlID, stats.CrawlUUID
+    s.session(s.crawlID, s.crawlUUID)
+    s.scopeFilter = newScopeFilter(s.scope, startURL)
+    s.budgetTracker = newBudgetTracker(s.budget, stats)
+    s.redirects = nil
+    if s.resolveRedirects {
+        crawlID := s.crawlID
+        s.redirects = newRedirectResolver(func(from, to string) error {
+            return s.db.SaveRedirect(crawlID, from, to)
+        })
+    }
+    s.canonicals = newCanonicalClaims()
+    if s.queueFrontier() {
+        s.frontier = s.newDBFrontier()
+        // URLs a previous run deferred when its budget ran out, or claimed
+        // when it was interrupted
+        if resumed {
+            if err := s.db.RequeueDeferred(s.crawlID); err != nil {
+                return nil, fmt.Errorf("failed to requeue deferred URLs: %w", err)
+            }
+        }
+        if s.heapSize > 0 {
+            heap, err := s.newHeapFrontier(context.WithoutCancel(ctx))
+            if err != nil {
+                return nil, err
+            }
+            defer heap.removeSpilled()
+            s.frontier = heap
+        }
+    }
+
+    return s.run(ctx, startURL, maxDepth, stats, elapsedBefore, !resumed)
+}
+
+// Refresh refetches the saved pages of an earlier crawl that are due for a
+// revisit, and returns once none are left. Each page is rescheduled by how
+// often its content has changed across revisits, under the policy set by
+// SetContinuous or DefaultRevisitPolicy. Pages never scheduled are due at
+// once. No links are followed, and the crawl's own stats are left as they
+// were.
+func (s *Smart) Refresh(ctx context.Context, crawlID int64) (*models.CrawlStats, error) {
+    revisit := s.revisit
+    if s.revisit == nil {
+        policy := DefaultRevisitPolicy
+        s.revisit = &policy
+    }
+    s.refreshing = true
+    defer func() {
+        s.revisit = revisit
+        s.refreshing = false
+    }()
+
+    if _, err := s.db.ScheduleUnscheduled(crawlID); err != nil {
+        return nil, fmt.Errorf("failed to schedule revisits: %w", err)
+    }
+
+    crawlUUID, err := s.db.GetCrawlUUID(crawlID)
+    if err != nil {
+        return nil, fmt.Errorf("failed to load crawl %d: %w", crawlID, err)
+    }
+    stats := &models.CrawlStats{CrawlID: crawlID, CrawlUUID: crawlUUID}
+    s.crawlID, s.crawlUUID = crawlID, crawlUUID
+    s.session(crawlID, crawlUUID)
+    s.scopeFilter = nil
+    s.budgetTracker = newBudgetTracker(s.budget, stats)
+    s.redirects = nil
+    // Revisits are not queued, so a heap would sit empty
+    if s.queueFrontier() {
+        s.frontier = s.newDBFrontier()
+    }
+
+    return s.run(ctx, "", math.MaxInt, stats, 0, false)
+}
+
+// Progress returns a snapshot of the running crawl, or of the last one once
+// it has finished. It may be called from any goroutine.
+func (s *Smart) Progress() models.CrawlProgress {
+    progress := s.progress.snapshot()
+    progress.Paused = s.gate.isPaused()
+    return progress
+}
+
+// run dispatches URLs to the workers until the frontier, or in a refresh the
+// due revisits, run out. seed queues startURL first.
+func (s *Smart) run(ctx context.Context, startURL string, maxDepth int, stats *models.CrawlStats, elapsedBefore time.Duration, seed bool) (*models.CrawlStats, error) {
+    start := time.Now()
+    if s.auth != nil {
+        if err := s.auth.Login(ctx, s.client); err != nil {
+            return nil, err
+        }
+    }
+    s.stalls = newStallMonitor(s.stallTimeout)
+    s.timings = newTimingReservoir()
+    s.loads = newLoadRecorder()
+    s.languageRouter = newLanguageRouter(s.languages, s.strictLanguages)
+    s.pagination = newPaginationTracker(s.paginationDepth)
+    s.images = newImageRecorder(s.imageOptions, s.client, s.limiter, s.maxResponseSize)
+    s.robots = nil
+    if s.robotsTTL > 0 {
+        s.robots = newRobotsCache(s.robotsTTL, robotsToken(s.userAgent), s.fetchRobots)
+    }
+    s.robotsPruned.Store(0)
+
+    mode := "smart"
+    if s.refreshing {
+        mode = "refresh"
+    } else if s.revisit != nil {
+        mode = "continuous"
+    }
+    ctx, span := startCrawlSpan(ctx, mode, s.crawlID, startURL)
+    defer span.End()
 
     // Priority queue implementation
-    urlQueue := make(chan models.URLPriority, 1000)
+    queue := newHostQueue(s.hostConcurrency)
+    s.queue = queue
     results := make(chan smartCrawlResult, 100)
 
-    // Start workers
-    var wg sync.WaitGroup
-    for i := 0; i < s.workers; i++ {
-        wg.Add(1)
-        go s.smartWorker(ctx, &wg, urlQueue, results)
+    // URLs claimed from the frontier wait in queue. Refreshes work
+    // through due revisits, which the frontier does not count.
+    var pending func() (int, error)
+    if sized, ok := s.frontier.(SizedFrontier); ok && !s.refreshing {
+        pending = func() (int, error) {
+            queued, err := sized.Pending()
+            return queued + queue.len(), err
+        }
+    }
+    s.progress.start(s.crawlID, pending, s.budget, stats)
+    defer s.progress.stop()
+
+    // Fetches run under work, which outlives ctx by the drain timeout so
+    // those under way when the crawl is stopped can finish. URLs they do
+    // not get to are collected in left and handed back to the frontier.
+    work, stopWork := context.WithCancel(context.WithoutCancel(ctx))
+    defer stopWork()
+    left := &unfetched{}
+
+    // Start workers, and the autoscaler resizing them
+    workers, limit := s.workers, s.workers
+    s.scaler = nil
+    if s.autoscale != nil {
+        s.scaler = newAutoscaler(*s.autoscale, s.workers)
+        workers, limit = s.scaler.size, s.autoscale.Max
+    }
+    pacer := newPullPacer(workers)
+    pool := newWorkerPool(limit, func(retire <-chan struct{}) {
+        s.smartWorker(ctx, work, queue, results, pacer, left, retire)
+    })
+    pool.resize(workers)
+    stopScaling := func() {}
+    if s.scaler != nil {
+        stopScaling = s.runAutoscaler(ctx, s.scaler, pool, pacer, func() time.Duration {
+            return elapsedBefore + time.Since(start)
+        })
     }
 
     // Results processor
-    go s.processSmartResults(ctx, results, stats, urlQueue)
+    checkpoint := func() {
+        // A refresh would overwrite the crawl's own checkpoint
+        if s.refreshing {
+            return
+        }
+        // A resumed crawl continues from crawl_queue, so bring it up to date
+        if heap, ok := s.frontier.(*heapFrontier); ok {
+            if err := heap.flush(); err != nil {
+                s.emit(ctx, Event{Type: ErrorOccurred, URL: startURL, Err: fmt.Errorf("failed to persist the frontier: %w", err)})
+            }
+        }
+        stats.Duration = elapsedBefore + time.Since(start)
+        if err := s.saveCheckpoint(startURL, maxDepth, stats); err != nil {
+            s.emit(ctx, Event{Type: ErrorOccurred, URL: startURL, Err: err})
+        }
+    }
+
+    // Drained pages are saved after ctx is cancelled
+    processed := make(chan struct{})
+    go func() {
+        s.processSmartResults(context.WithoutCancel(ctx), results, stats, pacer, checkpoint)
+        close(processed)
+    }()
+
+    finish := func() (*models.CrawlStats, error) {
+        stopScaling()
+        queue.close()
+        if ctx.Err() != nil {
+            drain := time.AfterFunc(s.drainTimeout, stopWork)
+            defer drain.Stop()
+        }
+        pool.wait()
+        close(results)
+        <-processed
+        s.notifications.Wait()
+        if heap, ok := s.frontier.(*heapFrontier); ok {
+            if err := heap.close(); err != nil {
+                s.emit(ctx, Event{Type: ErrorOccurred, URL: startURL, Err: fmt.Errorf("failed to persist the frontier: %w", err)})
+            }
+        }
+        stats.URLsReleased = s.release(ctx, left)
+        if s.scaler != nil {
+            stats.Concurrency = append(stats.Concurrency, s.scaler.samples...)
+        }
+        if s.checkpointInterval > 0 {
+            checkpoint()
+        }
+        stats.Duration = elapsedBefore + time.Since(start)
+        stats.FilteredURLs = s.urlFilter.Filtered()
+        if dropped := s.languageRouter.droppedCount(); dropped > 0 {
+            if stats.FilteredURLs == nil {
+                stats.FilteredURLs = make(map[string]int)
+            }
+            stats.FilteredURLs[offLanguage] = dropped
+        }
+        if dropped := s.pagination.droppedCount(); dropped > 0 {
+            if stats.FilteredURLs == nil {
+                stats.FilteredURLs = make(map[string]int)
+            }
+            stats.FilteredURLs[paginationFiltered] = dropped
+        }
+        if pruned := s.robotsPruned.Load(); pruned > 0 {
+            if stats.FilteredURLs == nil {
+                stats.FilteredURLs = make(map[string]int)
+            }
+            stats.FilteredURLs[robotsFiltered] = int(pruned)
+        }
+        stats.StopReason = stopReason(ctx, s.budgetTracker)
+        stats.DeferredURLs = 0
+        stats.Stalls += s.stalls.count()
+        stats.Timing = s.timings.percentiles()
+        s.loads.finish(stats)
+        if s.queueFrontier() && !s.refreshing && s.budgetTracker.stopReason() != "" {
+            // Keep what the budget cut off for a resumed crawl
+            deferred, err := s.db.DeferQueue(s.crawlID)
+            if err != nil {
+                s.emit(ctx, Event{Type: ErrorOccurred, URL: startURL, Err: err})
+            }
+            stats.DeferredURLs = deferred
+        }
+        if !s.refreshing {
+            if err := s.db.FinishCrawl(s.crawlID, stats); err != nil {
+                s.emit(ctx, Event{Type: ErrorOccurred, URL: startURL, Err: err})
+            }
+        }
+        s.emit(ctx, Event{Type: CrawlFinished, URL: startURL, Stats: stats})
+        return stats, nil
+    }
 
     // Add initial URL with high priority
     initialURL := models.URLPriority{
-        URL:      startURL,
-        Priority: 100,
-        Depth:    0,
+        URL:         startURL,
+        Fingerprint: s.normalizer.Fingerprint(startURL),
+        Priority:    100,
+        Depth:       0,
         Context: models.URLContext{
             Importance: 1.0,
         },
     }
 
-    urlQueue <- initialURL
-    s.db.AddToQueue([]models.URLPriority{initialURL})
+    // A resumed crawl continues from the frontier instead of the seed
+    if seed {
+        pacer.dispatched()
+        queue.add(initialURL)
+        s.frontier.Add([]models.URLPriority{initialURL})
+    }
 
-    // Smart crawling with adaptive depth and priority
-    ticker := time.NewTicker(500 * time.Millisecond)
-    defer ticker.Stop()
+    // Smart crawling with adaptive depth and priority. The pull batch and
+    // interval follow worker idleness and average fetch time. A heap
+    // frontier also says when URLs are added, as pulling from it is cheap.
+    var ready <-chan struct{}
+    if heap, ok := s.frontier.(*heapFrontier); ok {
+        ready = heap.ready
+    }
+    timer := time.NewTimer(pacer.interval)
+    defer timer.Stop()
 
     for {
         select {
         case <-ctx.Done():
-            close(urlQueue)
-            wg.Wait()
-            close(results)
-            stats.Duration = time.Since(start)
-            return stats, nil
-        case <-ticker.C:
-            // Get next batch of URLs from database
-            nextURLs, err := s.db.GetNextURLs(s.workers * 2)
-            if err != nil {
+            return finish()
+        case <-timer.C:
+        case <-ready:
+            // URLs were added while workers wait: pull now rather than at
+            // the next tick
+            if pacer.idle() == 0 {
                 continue
             }
+            timer.Stop()
+        }
+
+        if s.budgetTracker.exhausted() {
+            // Stop pulling and let pages already being fetched drain
+            if pacer.inFlight() == 0 {
+                return finish()
+            }
+            timer.Reset(minPullInterval)
+            continue
+        }
+
+        // Get next batch of URLs from database
+        batch := 0
+        if queue.len() < maxQueuedURLs {
+            batch = pacer.batchSize(queue.available())
+        }
+        if batch == 0 {
+            // The workers are behind, so URLs are pending
+            s.scaler.pulled(0, 0)
+            s.watchStall(ctx, true, pacer)
+            timer.Reset(pacer.next(0, 0))
+            continue
+        }
+
+        // Sampled before the pull: if nothing was in flight then, no
+        // result can have added URLs the pull did not see.
+        inFlight := pacer.inFlight()
 
-            if len(nextURLs) == 0 {
-                // No more URLs to process
-                time.Sleep(1 * time.Second)
+        nextURLs, err := s.pull(batch)
+        if err != nil {
+            s.emit(ctx, Event{Type: ErrorOccurred, URL: startURL, Err: err})
+            timer.Reset(pacer.next(batch, 0))
+            continue
+        }
+        s.scaler.pulled(batch, len(nextURLs))
+
+        if len(nextURLs) == 0 && inFlight == 0 && (s.revisit == nil || s.refreshing) && !s.retriesPending(ctx) {
+            // Frontier exhausted, or nothing left due in a refresh
+            return finish()
+        }
+        s.watchStall(ctx, len(nextURLs) > 0 || inFlight > 0, pacer)
+        timer.Reset(pacer.next(batch, len(nextURLs)))
+
+        for _, urlPriority := range nextURLs {
+            if urlPriority.Depth > maxDepth {
+                // Retire it so it does not crowd the head of the queue
+                s.frontier.Done(urlPriority.URL)
                 continue
             }
 
-            for _, urlPriority := range nextURLs {
-                if urlPriority.Depth <= maxDepth {
-                    select {
-                    case urlQueue <- urlPriority:
-                    case <-ctx.Done():
-                        close(urlQueue)
-                        wg.Wait()
-                        close(results)
-                        stats.Duration = time.Since(start)
-                        return stats, nil
-                    }
-                }
+            pacer.dispatched()
+            queue.add(urlPriority)
+            if s.dnsPrefetch && s.dns != nil {
+                s.dns.Prefetch(urlHost(urlPriority.URL))
             }
         }
     }
 }
 
-func (s *Smart) smartWorker(ctx context.Context, wg *sync.WaitGroup, urlQueue <-chan models.URLPriority, results chan<- smartCrawlResult) {
-    defer wg.Done()
+// watchStall reports the crawl if it has stalled with URLs pending. A paused
+// crawl has not stalled.
+func (s *Smart) watchStall(ctx context.Context, pending bool, pacer *pullPacer) {
+    if !pending || s.gate.isPaused() {
+        s.stalls.idle()
+        return
+    }
+    report := s.stalls.check(s.crawlID, s.crawlUUID, pacer.inFlight())
+    if report == nil {
+        return
+    }
+    s.emit(ctx, Event{Type: CrawlStalled, Stall: report})
+    for _, alerter := range s.stallAlerters {
+        if err := alerter.Alert(ctx, report); err != nil {
+            s.emit(ctx, Event{Type: ErrorOccurred, Err: fmt.Errorf("stall alert failed: %w", err)})
+        }
+    }
+}
 
-    for urlPriority := range urlQueue {
-        if ctx.Err() != nil {
-            return
+// pull takes the next batch of URLs to fetch. A continuous crawl splits the
+// batch between pages due for a revisit and the frontier; a refresh only
+// takes due pages.
+func (s *Smart) pull(batch int) ([]models.URLPriority, error) {
+    if s.revisit == nil {
+        return s.next(batch)
+    }
+    if s.refreshing {
+        return s.db.DueForRefresh(s.crawlID, batch, s.revisit.MinInterval)
+    }
+
+    due, err := s.db.DueForRefresh(s.crawlID, s.revisit.refreshLimit(batch), s.revisit.MinInterval)
+    if err != nil {
+        return nil, err
+    }
+    discovered, err := s.next(batch - len(due))
+    if err != nil {
+        return due, err
+    }
+
+    // Hand discovery's unused share back to revisits
+    if spare := batch - len(due) - len(discovered); spare > 0 && len(due) > 0 {
+        more, err := s.db.DueForRefresh(s.crawlID, spare, s.revisit.MinInterval)
+        if err != nil {
+            return append(due, discovered...), err
         }
+        due = append(due, more...)
+    }
+    return append(due, discovered...), nil
+}
 
-        // Advanced rate limiting based on priority
-        if err := s.limiter.Wait(ctx); err != nil {
-            continue
+// next claims URLs from the frontier, through the holdout when evaluating.
+// A sharded frontier passes over the hosts already backlogged.
+func (s *Smart) next(limit int) ([]models.URLPriority, error) {
+    if s.holdout != nil {
+        return s.holdout.next(s.frontier.(BaselineFrontier), limit)
+    }
+    if sharded, ok := s.frontier.(ShardedFrontier); ok {
+        if hosts := s.queue.backlogged(); len(hosts) > 0 {
+            return sharded.NextExcept(limit, hosts)
         }
+    }
+    return s.frontier.Next(limit)
+}
 
-        result := s.smartCrawlPage(ctx, urlPriority)
+// smartWorker fetches the URLs queue hands it until the queue is closed and
+// empty, or until it is retired between URLs
+func (s *Smart) smartWorker(ctx, work context.Context, queue *hostQueue, results chan<- smartCrawlResult, pacer *pullPacer, left *unfetched, retire <-chan struct{}) {
+    for {
+        pacer.workerIdle()
+        var urlPriority models.URLPriority
+        ok := false
         select {
-        case results <- result:
-        case <-ctx.Done():
+        case urlPriority, ok = <-queue.out:
+        case <-retire:
+            pacer.workerBusy()
+            return
+        }
+        pacer.workerBusy()
+        if !ok {
             return
         }
 
-        s.db.MarkURLProcessed(urlPriority.URL)
+        s.visit(ctx, work, urlPriority, results, pacer, left)
+        queue.done(urlPriority.URL)
     }
 }
 
-func (s *Smart) smartCrawlPage(ctx context.Context, urlPriority models.URLPriority) smartCrawlResult {
-    start := time.Now()
+// visit fetches a URL and passes the result on. Once ctx is cancelled it
+// starts no more fetches and collects the URLs it is handed in left;
+// fetches already started run under work.
+func (s *Smart) visit(ctx, work context.Context, urlPriority models.URLPriority, results chan<- smartCrawlResult, pacer *pullPacer, left *unfetched) {
+    if ctx.Err() != nil {
+        left.add(urlPriority)
+        pacer.settled()
+        return
+    }
 
-    // Check if URL is already crawled
-    crawled, err := s.db.IsURLCrawled(urlPriority.URL)
-    if err == nil && crawled {
-        return smartCrawlResult{Skipped: true, Reason: "already_crawled"}
+    // Over budget: leave the URL in the frontier, where the crawl's end
+    // defers it
+    if s.budgetTracker.exhausted() {
+        pacer.settled()
+        return
     }
 
-    req, err := http.NewRequestWithContext(ctx, "GET", urlPriority.URL, nil)
-    if err != nil {
-        return smartCrawlResult{Error: err}
+    // Advanced rate limiting based on priority
+    if err := s.limiter.Wait(ctx); err != nil {
+        left.add(urlPriority)
+        pacer.settled()
+        return
     }
 
-    req.Header.Set("User-Agent", "SmartCrawler/1.0")
-    req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
+    // Held here while the crawl is paused, after the limiter so that
+    // workers already waiting on it do not fetch once paused
+    if err := s.gate.wait(ctx); err != nil {
+        left.add(urlPriority)
+        pacer.settled()
+        return
+    }
 
-    resp, err := s.client.Do(req)
+    fetchStart := time.Now()
+    host := s.progress.begin(urlPriority.URL)
+    pageCtx, span := startPageSpan(work, urlPriority)
+    result := s.smartCrawlPage(pageCtx, urlPriority)
+    if result.Error != nil && work.Err() != nil {
+        // Cut off by the drain timeout rather than failed
+        s.progress.settle(host, true, nil, result.Fetch.Bytes)
+        endPageSpan(span, true, "drain_timeout", nil)
+        left.add(urlPriority)
+        pacer.settled()
+        return
+    }
+    result.URL = urlPriority.URL
+    result.Policy = urlPriority.Policy
+    result.Span = span.SpanContext()
+    s.progress.settle(host, result.Skipped, result.Error, result.Fetch.Bytes)
+    if !result.Skipped {
+        pacer.recordFetch(time.Since(fetchStart))
+        s.scaler.observe(result, time.Since(fetchStart))
+    }
+    if result.Error == nil && !result.Skipped {
+        var size int64
+        if result.Page != nil {
+            size = result.Page.Size
+        }
+        s.budgetTracker.record(size)
+    }
+
+    // Mark before handing off so a settled result is never still pending
+    s.settleURL(pageCtx, urlPriority, &result)
+    endPageSpan(span, result.Skipped, result.Reason, result.Error)
+
+    // The results processor reads until results is closed, so a page
+    // fetched while draining is not dropped
+    results <- result
+}
+
+func (s *Smart) smartCrawlPage(ctx context.Context, urlPriority models.URLPriority) (result smartCrawlResult) {
+    start := time.Now()
+
+    // Check if URL is already crawled. Revisits are expected to be.
+    if !urlPriority.Refresh {
+        crawled, err := s.db.IsURLCrawled(s.crawlID, urlPriority.URL)
+        if err == nil && crawled {
+            return smartCrawlResult{Skipped: true, Reason: "already_crawled"}
+        }
+    }
+
+    if parsed, err := url.Parse(urlPriority.URL); err == nil {
+        allowed, err := s.robotsAllowed(ctx, parsed)
+        if err != nil {
+            return smartCrawlResult{Error: err}
+        }
+        if !allowed {
+            return smartCrawlResult{Skipped: true, Reason: "robots_disallowed"}
+        }
+    }
+
+    strategy := s.strategy(urlPriority)
+    fetched, err := s.fetch(ctx, urlPriority, strategy)
+    defer func() {
+        result.Strategy, result.Fetch = strategy, fetched.Usage
+    }()
+    if err == nil && !fetched.NotModified {
+        err = s.afterResponse(fetched)
+    }
+    if errors.Is(err, ErrSkip) {
+        return smartCrawlResult{Skipped: true, Reason: "middleware"}
+    }
+    if errors.Is(err, errRedirectToCrawled) {
+        return smartCrawlResult{Skipped: true, Reason: "redirect_to_crawled"}
+    }
+    if errors.Is(err, errRobotsDisallowed) {
+        return smartCrawlResult{Skipped: true, Reason: "robots_disallowed"}
+    }
     if err != nil {
         return smartCrawlResult{Error: err}
     }
-    defer resp.Body.Close()
 
-    // Smart content type filtering
-    contentType := resp.Header.Get("Content-Type")
-    if !s.isRelevantContent(contentType) {
+    validators := models.Validators{
+        ETag:         fetched.Header.Get("ETag"),
+        LastModified: fetched.Header.Get("Last-Modified"),
+    }
+    if fetched.NotModified {
+        return smartCrawlResult{Refresh: true, NotModified: true, Validators: validators}
+    }
+    if fetched.Handler == nil {
         return smartCrawlResult{Skipped: true, Reason: "irrelevant_content_type"}
     }
 
-    body, err := io.ReadAll(resp.Body)
+    contentType := fetched.Header.Get("Content-Type")
+    body := fetched.Body
+    hash := fetched.BodyHash
+
+    // Content analysis and link extraction for this media type
+    // Relative links resolve against where redirects led
+    baseURL := urlPriority.URL
+    if fetched.FinalURL != "" {
+        baseURL = fetched.FinalURL
+    }
+    handleCtx, span := startHandleSpan(ctx, fetched.MediaType)
+    handled, err := fetched.Handler.Handle(&Content{
+        Context:     handleCtx,
+        URL:         baseURL,
+        ContentType: contentType,
+        MediaType:   fetched.MediaType,
+        Body:        body,
+        Depth:       urlPriority.Depth,
+        Priority:    urlPriority.Priority,
+    })
+    endSpan(span, err)
     if err != nil {
         return smartCrawlResult{Error: err}
     }
+    handled.Context.LastModified = time.Now()
 
-    // Duplicate detection
-    hash := fmt.Sprintf("%x", md5.Sum(body))
-    if s.duplicateDetector.IsDuplicate(hash) {
-        return smartCrawlResult{Skipped: true, Reason: "duplicate_content"}
+    // A variant of a page already saved under the same canonical URL, like
+    // one with tracking parameters, is not saved again
+    if !urlPriority.Refresh && handled.Canonical != "" {
+        if !s.canonicals.claim(handled.Canonical, urlPriority.URL) {
+            return smartCrawlResult{Skipped: true, Reason: "canonical_crawled"}
+        }
+        if nonCanonical(handled.Canonical, urlPriority.URL, fetched.FinalURL) {
+            // Saved before the crawl was resumed
+            crawled, err := s.db.IsURLCrawled(s.crawlID, handled.Canonical)
+            if err != nil {
+                s.emit(ctx, Event{Type: ErrorOccurred, URL: urlPriority.URL, Err: err})
+            }
+            if crawled {
+                return smartCrawlResult{Skipped: true, Reason: "canonical_crawled"}
+            }
+        }
     }
 
-    doc, err := goquery.NewDocumentFromReader(strings.NewReader(string(body)))
-    if err != nil {
-        return smartCrawlResult{Error: err}
+    // Duplicate detection. A revisit compares against the page's own hash
+    // when it is processed instead.
+    var unchanged bool
+    if !urlPriority.Refresh {
+        duplicate, firstCrawlID, err := s.duplicateDetector.Check(s.crawlID, urlPriority.URL, hash, handled.Text)
+        if err != nil {
+            s.emit(ctx, Event{Type: ErrorOccurred, URL: urlPriority.URL, Err: err})
+        }
+        if duplicate && firstCrawlID == s.crawlID {
+            return smartCrawlResult{Skipped: true, Reason: "duplicate_content"}
+        }
+        // Saved by an earlier crawl: not stored again, but its links are
+        // still followed so a recrawl reaches the pages that did change
+        unchanged = duplicate
+    }
+    // Pages fetched at the same time are not compared with each other, only
+    // with those already saved
+    plainText := handled.PlainText
+    if plainText == "" {
+        plainText = handled.Text
+    }
+    if !urlPriority.Refresh && !unchanged && s.nearDuplicate > 0 && strings.TrimSpace(plainText) != "" {
+        similar, err := s.db.FindSimilarPage(s.crawlID, handled.Title, plainText, s.nearDuplicate)
+        if err != nil {
+            s.emit(ctx, Event{Type: ErrorOccurred, URL: urlPriority.URL, Err: err})
+        }
+        if similar != nil {
+            return smartCrawlResult{Skipped: true, Reason: "near_duplicate"}
+        }
     }
 
-    // Content analysis
-    context := s.contentAnalyzer.AnalyzeContent(doc, string(body))
-    context.LastModified = time.Now()
+    // Scope is judged on where redirector links lead, not on the redirector
+    if err := s.redirects.resolveLinks(ctx, s.client, s.limiter, handled.Links); err != nil {
+        s.emit(ctx, Event{Type: ErrorOccurred, URL: urlPriority.URL, Err: err})
+    }
+    if unchanged {
+        return smartCrawlResult{Skipped: true, Reason: "unchanged_content", Links: s.filterLinks(ctx, handled.Links)}
+    }
 
     page := &models.Page{
-        URL:         urlPriority.URL,
-        Title:       doc.Find("title").Text(),
-        Content:     string(body),
-        StatusCode:  resp.StatusCode,
-        ContentType: contentType,
-        Size:        int64(len(body)),
-        LoadTime:    time.Since(start).Milliseconds(),
-        Depth:       urlPriority.Depth,
-        ParentURL:   urlPriority.Parent,
-        Hash:        hash,
-     }
-
-    // Extract links with smart prioritization
-    links := s.extractSmartLinks(doc, urlPriority.URL, context, urlPriority.Depth)
+        CrawlID:        s.crawlID,
+        CrawlUUID:      s.crawlUUID,
+        URL:            urlPriority.URL,
+        Fingerprint:    s.normalizer.Fingerprint(urlPriority.URL),
+        Title:          handled.Title,
+        Content:        handled.Text,
+        StatusCode:     fetched.StatusCode,
+        ContentType:    contentType,
+        Size:           int64(len(body)),
+        LoadTime:       time.Since(start).Milliseconds(),
+        Depth:          urlPriority.Depth,
+        ParentURL:      urlPriority.Parent,
+        Hash:           hash,
+        Importance:     handled.Context.Importance,
+        ContentQuality: handled.Context.ContentQuality,
+        LinkDensity:    handled.Context.LinkDensity,
+        Relevance:      handled.Context.Relevance,
+        ETag:           validators.ETag,
+        LastModified:   validators.LastModified,
+        FinalURL:       fetched.FinalURL,
+        RedirectChain:  fetched.Redirects,
+        Truncated:      fetched.Truncated,
+        Encoding:       fetched.Encoding,
+        CompressedSize: fetched.WireSize,
+        Protocol:       fetched.Protocol,
+        Headers:        fetched.Header,
+        TLS:            fetched.TLS,
+        Timing:         fetched.Timing,
+        StructuredData: handled.StructuredData,
+        CanonicalURL:   handled.Canonical,
+        Extractions:    handled.Extractions,
+        Images:         handled.Images,
+        Listing:        handled.Context.ContentType == listingContentType,
+        PlainText:      plainText,
+        Body:           body,
+    }
+    applyOpenGraph(page, handled.StructuredData)
+    handled.Spam.apply(page)
 
     return smartCrawlResult{
-        Page:  page,
-        Links: links,
+        Page: page,
+        // Links from handlers other than HTML (sitemaps, feeds, registered
+        // handlers) and resolved redirector targets have not been scoped yet
+        Links:      s.filterLinks(ctx, handled.Links),
+        Refresh:    urlPriority.Refresh,
+        Validators: validators,
     }
 }
 
-func (s *Smart) extractSmartLinks(doc *goquery.Document, baseURL string, pageContext models.URLContext, parentDepth int) []models.URLPriority {
+// linkAllowed reports whether a discovered URL may be enqueued
+func (s *Smart) linkAllowed(url string) bool {
+    return s.scopeFilter.allows(url) && s.urlFilter.Allow(url)
+}
+
+// filterLinks normalizes and fingerprints links and keeps those that may be
+// enqueued, and that the script wants followed, with the priorities it gives
+// them. Links with the same fingerprint are kept once, at the highest
+// priority. A failing script call is reported and leaves the link as it was.
+func (s *Smart) filterLinks(ctx context.Context, links []models.URLPriority) []models.URLPriority {
+    kept := links[:0]
+    index := make(map[string]int, len(links))
+    for _, link := range links {
+        link.URL = s.normalizer.Normalize(link.URL)
+        link.Fingerprint = s.normalizer.Fingerprint(link.URL)
+        if i, ok := index[link.Fingerprint]; ok {
+            if link.Priority > kept[i].Priority {
+                kept[i].Priority = link.Priority
+                kept[i].Context.Importance = link.Context.Importance
+            }
+            continue
+        }
+        if !s.linkAllowed(link.URL) {
+            continue
+        }
+        if s.script != nil {
+            follow, err := s.script.follow(link)
+            if err != nil {
+                s.emit(ctx, Event{Type: ErrorOccurred, URL: link.URL, Err: err})
+            }
+            if !follow {
+                continue
+            }
+            priority, scored, err := s.script.score(link)
+            if err != nil {
+                s.emit(ctx, Event{Type: ErrorOccurred, URL: link.URL, Err: err})
+            }
+            if scored {
+                link.Priority = priority
+                link.Context.Importance = float64(priority) / 100.0
+            }
+        }
+        index[link.Fingerprint] = len(kept)
+        kept = append(kept, link)
+    }
+    return kept
+}
+
+func (s *Smart) shouldExpand(pageContext models.URLContext, depth int) bool {
+    // Listings score low on content by nature, but lead to the content
+    if depth == 0 || pageContext.ContentType == listingContentType {
+        return true
+    }
+    return pageContext.ContentQuality >= s.minExpandQuality && pageContext.Importance >= s.minExpandImportance
+}
+
+func (s *Smart) extractSmartLinks(doc *goquery.Document, baseURL string, pageContext models.URLContext, parentDepth, parentPriority int, pages pagination) []models.URLPriority {
     var links []models.URLPriority
 
-    doc.Find("a[href]").Each(func(i int, sel *goquery.Selection) {
+    // Site owner hints
+    hints := parsePageHints(doc)
+    if hints.nofollow {
+        return nil
+    }
+
+    // With a link selector, only the links it selects are followed, along
+    // with the pages of a listing
+    var selected map[*html.Node]bool
+    if s.linkSelector != nil {
+        selected = make(map[*html.Node]bool)
+        for _, node := range linkElements(doc, s.linkSelector).Nodes {
+            selected[node] = true
+        }
+    }
+
+    // <link rel="next"> and rel="prev" lead to a listing's other pages too
+    doc.Find("a[href], link[rel][href]").Each(func(i int, sel *goquery.Selection) {
         href, exists := sel.Attr("href")
         if !exists {
             return
         }
 
         absoluteURL := s.makeAbsoluteURL(baseURL, href)
-        if absoluteURL == "" || !utils.IsValidURL(absoluteURL) {
+        if absoluteURL == "" || !utils.IsValidURL(absoluteURL) && !s.followsDocument(absoluteURL) {
+            return
+        }
+        direction, continuation := pages.links[absoluteURL]
+        absoluteURL = s.normalizer.Normalize(absoluteURL)
+        if !continuation && (goquery.NodeName(sel) != "a" || selected != nil && !selected[sel.Get(0)]) {
+            return
+        }
+        // Redirector links are scoped once resolved
+        if !s.linkAllowed(absoluteURL) && (s.redirects == nil || !isRedirector(absoluteURL)) {
             return
         }
 
-        // Smart link prioritization
-        priority := s.calculateLinkPriority(sel, pageContext)
+        // Smart link prioritization. The next page of a listing stays at
+        // the listing's depth, and is only as deep as the pagination depth
+        // allows.
+        text := extractLinkContext(sel)
+        depth := parentDepth + 1
+        contentType := s.guessContentType(absoluteURL)
+        var priority int
+        if continuation {
+            position, follow := s.pagination.follow(baseURL, absoluteURL, direction)
+            if !follow {
+                return
+            }
+            priority = paginationPriority - paginationDecay*position + hints.priorityAdjust
+            depth, contentType = parentDepth, listingContentType
+        } else {
+            priority = clampPriority(s.scorer.ScoreLink(Link{
+                URL:         absoluteURL,
+                Depth:       depth,
+                Text:        text,
+                Selection:   sel,
+                PageURL:     baseURL,
+                PageContext: pageContext,
+            }))
+            // A focused crawl follows the topic first
+            if s.topic != nil {
+                score := linkScore(pageContext.Relevance, parentPriority, s.topic.Relevance(scoringText(text)))
+                priority = topicPriority(priority, score)
+            }
+            priority += hints.priorityAdjust
+        }
+        priority = applyPriorityHint(sel, priority)
+
+        // Language routing, before the link costs a fetch
+        hreflang, _ := sel.Attr("hreflang")
+        priority, keep := s.languageRouter.route(absoluteURL, hreflang, text.Anchor, priority)
+        if !keep {
+            return
+        }
+        priority = clampPriority(priority)
         
         linkContext := models.URLContext{
             Importance:     float64(priority) / 100.0,
-            ContentType:    s.guessContentType(absoluteURL),
+            ContentType:    contentType,
             LinkDensity:    pageContext.LinkDensity,
         }
 
         links = append(links, models.URLPriority{
-            URL:      absoluteURL,
-            Priority: priority,
-            Depth:    parentDepth + 1,
-            Parent:   baseURL,
-            Context:  linkContext,
+            URL:         absoluteURL,
+            Priority:    priority,
+            Depth:       depth,
+            Parent:      baseURL,
+            Context:     linkContext,
+            LinkContext: text,
         })
     })
 
     return links
 }
 
-func (s *Smart) calculateLinkPriority(sel *goquery.Selection, pageContext models.URLContext) int {
-    priority := 50 // Base priority
-
-    // Analyze anchor text
-    anchorText := strings.TrimSpace(sel.Text())
-    
-    // High priority keywords
-    highPriorityKeywords := []string{"article", "news", "blog", "content", "post", "story", "research", "documentation"}
-    for _, keyword := range highPriorityKeywords {
-        if strings.Contains(strings.ToLower(anchorText), keyword) {
-            priority += 20
-            break
-        }
-    }
-
-    // Low priority keywords (navigation, etc.)
-    lowPriorityKeywords := []string{"login", "register", "contact", "about", "terms", "privacy", "sitemap"}
-    for _, keyword := range lowPriorityKeywords {
-        if strings.Contains(strings.ToLower(anchorText), keyword) {
-            priority -= 15
-            break
-        }
-    }
-
-    // Check rel attribute
-    if rel, exists := sel.Attr("rel"); exists {
-        if strings.Contains(rel, "nofollow") {
-            priority -= 30
-        }
-    }
-
-    // Check class attribute for semantic hints
-    if class, exists := sel.Attr("class"); exists {
-        if strings.Contains(class, "nav") || strings.Contains(class, "menu") {
-            priority -= 10
-        }
-        if strings.Contains(class, "content") || strings.Contains(class, "article") {
-            priority += 15
-        }
-    }
-
-    // Boost priority based on page importance
-    priority += int(pageContext.Importance * 20)
-
-    // Ensure priority is within bounds
-    if priority < 1 {
-        priority = 1
-    }
-    if priority > 100 {
-        priority = 100
-    }
-
-    return priority
-}
-
-func (s *Smart) isRelevantContent(contentType string) bool {
-    relevantTypes := []string{
-        "text/html",
-        "application/xhtml+xml",
-        "text/plain",
-    }
-
-    for _, relevantType := range relevantTypes {
-        if strings.Contains(contentType, relevantType) {
-            return true
-        }
-    }
-    return false
-}
-
 func (s *Smart) guessContentType(url string) string {
     lower := strings.ToLower(url)
     
@@ -356,63 +1262,237 @@ func (s *Smart) makeAbsoluteURL(baseURL, href string) string {
     return resolved.String()
 }
 
-func (s *Smart) processSmartResults(ctx context.Context, results <-chan smartCrawlResult, stats *models.CrawlStats, urlQueue chan<- models.URLPriority) {
-    for result := range results {
-        if result.Error != nil {
-            stats.Errors++
-            continue
+// processSmartResults owns stats while the crawl runs, so checkpoints are
+// taken from here to get a consistent snapshot. Pages to save are buffered
+// and saved in batches; a buffered result has not settled, so the crawl
+// does not finish before its links are queued.
+func (s *Smart) processSmartResults(ctx context.Context, results <-chan smartCrawlResult, stats *models.CrawlStats, pacer *pullPacer, checkpoint func()) {
+    var tick <-chan time.Time
+    if s.checkpointInterval > 0 {
+        ticker := time.NewTicker(s.checkpointInterval)
+        defer ticker.Stop()
+        tick = ticker.C
+    }
+    var flushTick <-chan time.Time
+    if s.writeBatch > 1 && s.writeFlushInterval > 0 {
+        ticker := time.NewTicker(s.writeFlushInterval)
+        defer ticker.Stop()
+        flushTick = ticker.C
+    }
+
+    var pending []pendingWrite
+    flush := func() {
+        s.flushWrites(ctx, pending, stats)
+        for range pending {
+            pacer.settled()
         }
+        pending = pending[:0]
+    }
 
-        if result.Skipped {
-            stats.PagesSkipped++
-            continue
+    for {
+        select {
+        case result, ok := <-results:
+            if !ok {
+                flush()
+                return
+            }
+            write, save := s.processSmartResult(ctx, result, stats)
+            if !save {
+                pacer.settled()
+                continue
+            }
+            pending = append(pending, write)
+            if len(pending) >= s.writeBatch {
+                flush()
+            }
+        case <-flushTick:
+            flush()
+        case <-tick:
+            flush()
+            checkpoint()
         }
+    }
+}
 
-        if err := s.db.SavePage(result.Page); err != nil {
-            stats.Errors++
-            continue
+// processSmartResult records a result and reports whether its page is to be
+// saved, which pageSaved finishes once it is
+func (s *Smart) processSmartResult(ctx context.Context, result smartCrawlResult, stats *models.CrawlStats) (pendingWrite, bool) {
+    recordYield(stats, result)
+    recordFetch(stats, result)
+    s.stalls.observe(result)
+
+    if result.Error != nil {
+        stats.Errors++
+        recordHostError(stats, result.URL)
+        if result.Retrying {
+            stats.URLsRetried++
         }
+        if result.DeadLettered {
+            stats.URLsFailed++
+        }
+        s.emit(ctx, Event{Type: ErrorOccurred, URL: result.URL, Err: result.Error})
+        return pendingWrite{}, false
+    }
 
-        // Add discovered links to queue
-        if len(result.Links) > 0 {
-            if err := s.db.AddToQueue(result.Links); err != nil {
-                // Log error but continue
-            }
+    if result.Skipped {
+        stats.PagesSkipped++
+        recordHostSkip(stats, result.URL, result.Reason)
+        s.enqueueLinks(ctx, result)
+        return pendingWrite{}, false
+    }
+
+    // A revisit only rewrites the page when its content changed
+    var history *models.RevisitHistory
+    var change *models.PageChange
+    if result.Refresh {
+        hash := "" // Unchanged by the server's word
+        if !result.NotModified {
+            hash = result.Page.Hash
+        }
+        var err error
+        history, err = s.db.RecordRevisit(s.crawlID, result.URL, hash, result.Validators)
+        if err != nil {
+            stats.Errors++
+            s.emit(ctx, Event{Type: ErrorOccurred, URL: result.URL, Err: err})
+            return pendingWrite{}, false
+        }
+        stats.PagesRefreshed++
+        if result.NotModified {
+            stats.PagesNotModified++
+        }
+        if !history.Changed {
+            s.scheduleRevisit(ctx, result.URL, history)
+            return pendingWrite{}, false
         }
+        stats.PagesChanged++
+        change = s.detectChange(ctx, result)
+    }
 
-        stats.PagesProcessed++
-        stats.TotalSize += result.Page.Size
-        
-        if stats.PagesProcessed > 0 {
-            stats.AvgLoadTime = time.Duration(stats.TotalSize/int64(stats.PagesProcessed)) * time.Millisecond
+    return pendingWrite{result: result, history: history, change: change}, true
+}
+
+// pageSaved finishes processing a result once its page and links are saved
+func (s *Smart) pageSaved(ctx context.Context, write pendingWrite, stats *models.CrawlStats) {
+    result := write.result
+    if err := applyTagRules(s.db, s.tagRules, result.Page); err != nil {
+        s.emit(ctx, Event{Type: ErrorOccurred, URL: result.URL, Err: err})
+    }
+    if err := saveExtractions(s.db, s.extraction, result.Page); err != nil {
+        s.emit(ctx, Event{Type: ErrorOccurred, URL: result.URL, Err: err})
+    }
+    if err := saveImages(s.db, s.images, result.Page); err != nil {
+        s.emit(ctx, Event{Type: ErrorOccurred, URL: result.URL, Err: err})
+    }
+    s.recordChange(ctx, write.change, result.Page)
+    if result.Policy != "" {
+        if err := s.db.AddPageTags(result.Page.ID, []string{"policy:" + result.Policy}, evaluationTagSource); err != nil {
+            s.emit(ctx, Event{Type: ErrorOccurred, URL: result.URL, Err: err})
+        }
+    }
+    // The page now stands for its canonical URL, so a queued entry for it
+    // is folded into this one rather than fetched
+    if page := result.Page; nonCanonical(page.CanonicalURL, page.URL, page.FinalURL) {
+        if err := s.frontier.Done(page.CanonicalURL); err != nil {
+            s.emit(ctx, Event{Type: ErrorOccurred, URL: result.URL, Err: err})
         }
     }
+    if err := s.sinks.publish(ctx, result.Page); err != nil {
+        s.emit(ctx, Event{Type: ErrorOccurred, URL: result.URL, Err: err})
+    }
+    s.emit(ctx, Event{Type: PageCrawled, URL: result.URL, Page: result.Page})
+
+    s.enqueueLinks(ctx, result)
+
+    stats.PagesProcessed++
+    stats.TotalSize += result.Page.Size
+    if result.Page.Truncated {
+        stats.PagesTruncated++
+    }
+    if result.Page.Spam {
+        stats.PagesSpam++
+    }
+    recordProtocol(stats, result.Page)
+    recordPage(stats, result.Page)
+    recordHostPage(stats, result.Page)
+    relevance := result.Page.ContentQuality
+    if s.topic != nil {
+        relevance = result.Page.Relevance
+    }
+    recordHarvest(stats, s.harvestThreshold, relevance)
+    // The page's quality is the label of the link that queued it
+    if s.linkModel != nil && strings.Contains(result.Page.ContentType, "html") {
+        s.linkModel.learn(result.URL, result.Page.ContentQuality)
+    }
+    s.timings.add(result.Page)
+    s.loads.add(result.Page)
+
+    if s.revisit != nil {
+        s.scheduleRevisit(ctx, result.URL, write.history)
+    }
+}
+
+// enqueueLinks adds a result's discovered links to the frontier, unless the
+// budget is spent or this is a refresh
+func (s *Smart) enqueueLinks(ctx context.Context, result smartCrawlResult) {
+    if len(result.Links) == 0 || s.refreshing || s.budgetTracker.exhausted() {
+        return
+    }
+    if err := s.frontier.Add(result.Links); err != nil {
+        s.emit(ctx, Event{Type: ErrorOccurred, URL: result.URL, Err: err})
+    }
+    for i := range result.Links {
+        s.emit(ctx, Event{Type: LinkDiscovered, URL: result.Links[i].URL, Link: &result.Links[i]})
+    }
+}
+
+// scheduleRevisit sets when a continuous crawl or refresh next refetches a saved page
+func (s *Smart) scheduleRevisit(ctx context.Context, url string, history *models.RevisitHistory) {
+    if err := s.db.ScheduleRevisit(s.crawlID, url, s.revisit.interval(history)); err != nil {
+        s.emit(ctx, Event{Type: ErrorOccurred, URL: url, Err: err})
+    }
 }
 
 type smartCrawlResult struct {
+    URL     string
     Page    *models.Page
     Links   []models.URLPriority
     Skipped bool
     Reason  string
     Error   error
+    Refresh bool
+    Policy  string // Set in a holdout evaluation
+
+    Strategy FetchStrategy     // How the URL was fetched; empty if it was not
+    Fetch    models.FetchUsage // What fetching it cost
+
+    NotModified bool              // A revisit answered 304; Page is nil
+    Validators  models.Validators // Sent with a revisit's response
+
+    Retrying     bool // The fetch failed and the URL is queued to be retried
+    DeadLettered bool // The fetch failed on the URL's last attempt
+
+    Span trace.SpanContext // The page's trace, which its save links to
 }
 
-// Content Analyzer
-type ContentAnalyzer struct {
-    stopWords map[string]bool
+// Words too common to say anything about a page
+var stopWords = map[string]bool{
+    "a": true, "an": true, "and": true, "are": true, "as": true, "at": true, "be": true, "by": true,
+    "for": true, "from": true, "has": true, "he": true, "in": true, "is": true, "it": true, "its": true,
+    "of": true, "on": true, "that": true, "the": true, "to": true, "was": true, "will": true, "with": true,
 }
 
-func NewContentAnalyzer() *ContentAnalyzer {
-    stopWords := map[string]bool{
-        "a": true, "an": true, "and": true, "are": true, "as": true, "at": true, "be": true, "by": true,
-        "for": true, "from": true, "has": true, "he": true, "in": true, "is": true, "it": true, "its": true,
-        "of": true, "on": true, "that": true, "the": true, "to": true, "was": true, "will": true, "with": true,
-    }
+// DefaultAnalyzer is the ContentAnalyzer the smart crawler uses unless
+// WithAnalyzer sets another. It scores pages on their length, structure,
+// and metadata.
+type DefaultAnalyzer struct {
+    stopWords map[string]bool
+}
 
-    return &ContentAnalyzer{stopWords: stopWords}
+func NewDefaultAnalyzer() *DefaultAnalyzer {
+    return &DefaultAnalyzer{stopWords: stopWords}
 }
 
-func (ca *ContentAnalyzer) AnalyzeContent(doc *goquery.Document, content string) models.URLContext {
+func (ca *DefaultAnalyzer) AnalyzeContent(doc *goquery.Document, content string) models.URLContext {
     context := models.URLContext{}
 
     // Calculate content quality based on various factors
@@ -427,7 +1507,7 @@ func (ca *ContentAnalyzer) AnalyzeContent(doc *goquery.Document, content string)
     return context
 }
 
-func (ca *ContentAnalyzer) calculateContentQuality(doc *goquery.Document, content string) float64 {
+func (ca *DefaultAnalyzer) calculateContentQuality(doc *goquery.Document, content string) float64 {
     score := 0.0
 
     // Text length factor
@@ -462,7 +1542,7 @@ func (ca *ContentAnalyzer) calculateContentQuality(doc *goquery.Document, conten
     return score
 }
 
-func (ca *ContentAnalyzer) calculateLinkDensity(doc *goquery.Document) float64 {
+func (ca *DefaultAnalyzer) calculateLinkDensity(doc *goquery.Document) float64 {
     textLength := len(doc.Find("body").Text())
     linkTextLength := len(doc.Find("a").Text())
 
@@ -478,7 +1558,7 @@ func (ca *ContentAnalyzer) calculateLinkDensity(doc *goquery.Document) float64 {
     return density
 }
 
-func (ca *ContentAnalyzer) calculateImportance(doc *goquery.Document, content string) float64 {
+func (ca *DefaultAnalyzer) calculateImportance(doc *goquery.Document, content string) float64 {
     importance := 0.5 // Base importance
 
     // Title analysis
@@ -512,29 +1592,71 @@ func (ca *ContentAnalyzer) calculateImportance(doc *goquery.Document, content st
 
 // Duplicate Detector
 type DuplicateDetector struct {
-    seenHashes map[string]bool
-    mutex      sync.RWMutex
+    hashes *spillSet      // Exact, spilling to disk past its memory limit
+    filter *bloomSeenSet  // Replaces hashes when memory is bounded
+    store  database.Store // Replaces hashes when persistent
+    cache  *hashCache     // Hashes recently seen in store
 }
 
+// NewDuplicateDetector keeps seen hashes exactly, holding up to
+// DefaultSeenMemory in memory and spilling the rest to disk
 func NewDuplicateDetector() *DuplicateDetector {
     return &DuplicateDetector{
-        seenHashes: make(map[string]bool),
+        hashes: newSpillSet(DefaultSeenMemory),
+    }
+}
+
+// NewBloomDuplicateDetector keeps seen hashes in a Bloom filter sized by
+// opts, confirming hits with verify if opts.Verify is set. A zero capacity
+// returns an exact detector holding opts.Memory hashes in memory.
+func NewBloomDuplicateDetector(opts SeenOptions, verify func(hash string) (bool, error)) *DuplicateDetector {
+    if opts.Capacity == 0 {
+        return &DuplicateDetector{hashes: newSpillSet(opts.Memory)}
     }
+    return &DuplicateDetector{filter: newSeenSet(opts, verify).(*bloomSeenSet)}
+}
+
+// Restore brings the detector of a resumed crawl back to what it had seen:
+// a Bloom filter from the filter its checkpoint saved, and an exact
+// detector, or a filter with none saved, from the content hashes of the
+// pages the crawl saved. A persistent detector already has them.
+func (dd *DuplicateDetector) Restore(db database.Store, crawlID int64, filter []byte) error {
+    switch {
+    case dd.store != nil:
+        return nil
+    case dd.filter != nil && filter != nil:
+        return dd.filter.filter.UnmarshalBinary(filter)
+    }
+    return db.ForEachContentHash(crawlID, func(hash string) error {
+        if dd.filter != nil {
+            dd.filter.filter.TestAndAdd(hash)
+        } else {
+            dd.hashes.testAndAdd(hash)
+        }
+        return nil
+    })
+}
+
+// Close removes the hashes an exact detector spilled to disk, forgetting
+// every hash it has seen
+func (dd *DuplicateDetector) Close() {
+    if dd.hashes != nil {
+        dd.hashes.close()
+    }
+}
+
+// SnapshotFilter encodes the Bloom filter, or returns nil for an exact
+// detector
+func (dd *DuplicateDetector) SnapshotFilter() ([]byte, error) {
+    if dd.filter == nil {
+        return nil, nil
+    }
+    return dd.filter.filter.MarshalBinary()
 }
 
 func (dd *DuplicateDetector) IsDuplicate(hash string) bool {
-    dd.mutex.RLock()
-    defer dd.mutex.RUnlock()
-    
-    if dd.seenHashes[hash] {
-        return true
+    if dd.filter != nil {
+        return dd.filter.testAndAdd(hash)
     }
-    
-    dd.mutex.RUnlock()
-    dd.mutex.Lock()
-    dd.seenHashes[hash] = true
-    dd.mutex.Unlock()
-    dd.mutex.RLock()
-    
-    return false
+    return dd.hashes.testAndAdd(hash)
 }
@@ -0,0 +1,487 @@
+package crawler
+
+import (
+    "errors"
+    "math"
+    "net/url"
+    "sort"
+    "strconv"
+    "strings"
+    "unicode"
+
+    "github.com/PuerkitoBio/goquery"
+    "golang.org/x/net/html"
+
+    "smart-crawler/models"
+)
+
+// DefaultSpamThreshold is the spam score above which a page is flagged
+const DefaultSpamThreshold = 0.6
+
+// Most words of a page's visible text the classifier reads
+const spamWords = 5000
+
+// Hosts serving ads, whose scripts and frames mark ad slots
+var adHosts = []string{
+    "doubleclick.net", "googlesyndication.com", "googleadservices.com", "adservice.google.com",
+    "amazon-adsystem.com", "adnxs.com", "taboola.com", "outbrain.com", "criteo.com", "criteo.net",
+    "pubmatic.com", "rubiconproject.com", "openx.net", "media.net", "revcontent.com", "mgid.com",
+    "popads.net", "propellerads.com", "adsterra.com", "exoclick.com", "juicyads.com",
+}
+
+// Class and id words naming an ad slot
+var adWords = map[string]bool{
+    "ad": true, "ads": true, "adsbygoogle": true, "advert": true, "adverts": true,
+    "advertisement": true, "advertising": true, "sponsored": true, "adslot": true, "adunit": true,
+}
+
+// How much each signal weighs in the spam score at full strength. One of
+// the strong signals flags a page by itself at the default threshold; the
+// weaker ones, which ordinary hubs and news sites show too, only together.
+var spamWeights = map[string]float64{
+    "keyword_stuffing": 0.7,
+    "hidden_text":      0.7,
+    "doorway":          0.8,
+    "link_farm":        0.5,
+    "ad_density":       0.5,
+    "link_density":     0.35,
+}
+
+// SpamVerdict is what a SpamClassifier made of a page
+type SpamVerdict struct {
+    Score   float64  // 0 to 1
+    Signals []string // What raised the score, strongest first, e.g. "hidden_text"
+    Spam    bool     // The score is above the crawl's threshold; set by the crawler
+}
+
+// SpamClassifier scores how likely an HTML page is spam or too low in
+// quality for its links to be worth following
+type SpamClassifier interface {
+    ClassifySpam(doc *goquery.Document, pageURL string) SpamVerdict
+}
+
+// SpamFilter flags the HTML pages a SpamClassifier scores above Threshold
+type SpamFilter struct {
+    // Score above which a page is spam; 0 for DefaultSpamThreshold
+    Threshold float64
+    // nil for a DefaultSpamClassifier
+    Classifier SpamClassifier
+}
+
+// WithSpamFilter scores each HTML page a crawler saves for spam. Pages
+// scoring above the filter's threshold are still saved, flagged as spam,
+// but their links are not followed.
+func WithSpamFilter(filter SpamFilter) Option {
+    return func(o *options) error {
+        if filter.Threshold < 0 || filter.Threshold >= 1 {
+            return errors.New("spam threshold must be at least 0 and below 1")
+        }
+        if filter.Threshold == 0 {
+            filter.Threshold = DefaultSpamThreshold
+        }
+        if filter.Classifier == nil {
+            filter.Classifier = NewDefaultSpamClassifier()
+        }
+        o.spam = &filter
+        return nil
+    }
+}
+
+// classify is the verdict on the page doc at pageURL; nil when the crawl
+// does not filter spam
+func (f *SpamFilter) classify(doc *goquery.Document, pageURL string) *SpamVerdict {
+    if f == nil {
+        return nil
+    }
+    verdict := f.Classifier.ClassifySpam(doc, pageURL)
+    verdict.Spam = verdict.Score > f.Threshold
+    return &verdict
+}
+
+// apply records the verdict on page
+func (v *SpamVerdict) apply(page *models.Page) {
+    if v == nil {
+        return
+    }
+    page.SpamScore, page.SpamSignals, page.Spam = v.Score, v.Signals, v.Spam
+}
+
+// flagged reports whether the verdict is spam; false without one
+func (v *SpamVerdict) flagged() bool {
+    return v != nil && v.Spam
+}
+
+// DefaultSpamClassifier is the SpamClassifier of WithSpamFilter unless the
+// filter sets another. It looks for keyword stuffing, text hidden by inline
+// styles, pages crowded with ads or links, link farms, and doorway pages
+// that send visitors on elsewhere.
+type DefaultSpamClassifier struct {
+    stopWords map[string]bool
+}
+
+func NewDefaultSpamClassifier() *DefaultSpamClassifier {
+    return &DefaultSpamClassifier{stopWords: stopWords}
+}
+
+func (c *DefaultSpamClassifier) ClassifySpam(doc *goquery.Document, pageURL string) SpamVerdict {
+    body := doc.Find("body")
+    if body.Length() == 0 {
+        return SpamVerdict{}
+    }
+    words := spamTokens(collectWords(body.Get(0), true, nil, spamWords))
+    hidden, visible := hiddenTextLength(body.Get(0))
+
+    strengths := map[string]float64{
+        "keyword_stuffing": c.keywordStuffing(doc, words),
+        "hidden_text":      hiddenTextStrength(hidden, visible),
+        "ad_density":       adDensity(doc, len(words)),
+        "doorway":          doorway(doc, pageURL, len(words)),
+    }
+    strengths["link_density"], strengths["link_farm"] = linkSignals(doc, pageURL, len(words))
+
+    // The chances that each signal alone is wrong multiply
+    verdict := SpamVerdict{}
+    clean := 1.0
+    for signal, strength := range strengths {
+        if strength > 0 {
+            clean *= 1 - spamWeights[signal]*strength
+            verdict.Signals = append(verdict.Signals, signal)
+        }
+    }
+    verdict.Score = math.Round((1-clean)*1000) / 1000
+    sortSignals(verdict.Signals, strengths)
+    return verdict
+}
+
+// sortSignals orders signals by how much they added to the score
+func sortSignals(signals []string, strengths map[string]float64) {
+    sort.Slice(signals, func(i, j int) bool {
+        a, b := spamWeights[signals[i]]*strengths[signals[i]], spamWeights[signals[j]]*strengths[signals[j]]
+        if a != b {
+            return a > b
+        }
+        return signals[i] < signals[j]
+    })
+}
+
+// keywordStuffing is how far the most repeated word of the text, or of the
+// title, goes past what natural writing repeats, 0 to 1
+func (c *DefaultSpamClassifier) keywordStuffing(doc *goquery.Document, words []string) float64 {
+    strength := 0.0
+    // Short texts repeat their subject often without being stuffed
+    if len(words) >= 50 {
+        counts := make(map[string]int)
+        top := 0
+        for _, word := range words {
+            if c.stopWords[word] || len([]rune(word)) < 3 {
+                continue
+            }
+            counts[word]++
+            top = max(top, counts[word])
+        }
+        // Natural text rarely gives one word more than a few percent
+        share := float64(top) / float64(len(words))
+        strength = clamp01((share - 0.06) / 0.1)
+    }
+
+    titleCounts := make(map[string]int)
+    for _, word := range spamTokens(strings.Fields(doc.Find("title").First().Text())) {
+        if !c.stopWords[word] && len([]rune(word)) >= 3 {
+            titleCounts[word]++
+            if titleCounts[word] >= 3 {
+                strength = max(strength, 0.8)
+            }
+        }
+    }
+
+    // Meta keywords are ignored by search engines today, except by those
+    // still stuffing them
+    var keywords string
+    doc.Find("meta[name]").Each(func(_ int, meta *goquery.Selection) {
+        if strings.EqualFold(meta.AttrOr("name", ""), "keywords") {
+            keywords = meta.AttrOr("content", "")
+        }
+    })
+    if terms := len(strings.Split(keywords, ",")); keywords != "" && terms > 30 {
+        strength = max(strength, clamp01(float64(terms-30)/50))
+    }
+    return strength
+}
+
+// hiddenTextStrength is how much of a page's text is hidden, once it is
+// enough to matter, 0 to 1. Menus and dialogs hide some text on many pages.
+func hiddenTextStrength(hidden, visible int) float64 {
+    if hidden < 200 {
+        return 0
+    }
+    share := float64(hidden) / float64(hidden+visible)
+    return clamp01((share - 0.15) / 0.35)
+}
+
+// hiddenTextLength measures the text under n that inline styles hide, and
+// the rest, in bytes without surrounding space
+func hiddenTextLength(n *html.Node) (int, int) {
+    hidden, visible := 0, 0
+    var walk func(n *html.Node, hiding bool)
+    walk = func(n *html.Node, hiding bool) {
+        switch n.Type {
+        case html.TextNode:
+            length := len(strings.TrimSpace(n.Data))
+            if hiding {
+                hidden += length
+            } else {
+                visible += length
+            }
+            return
+        case html.ElementNode:
+            switch n.Data {
+            case "script", "style", "noscript", "template":
+                return
+            }
+            if !hiding {
+                for _, attr := range n.Attr {
+                    if attr.Key == "style" && hidingStyle(attr.Val) {
+                        hiding = true
+                    }
+                }
+            }
+        }
+        for child := n.FirstChild; child != nil; child = child.NextSibling {
+            walk(child, hiding)
+        }
+    }
+    walk(n, false)
+    return hidden, visible
+}
+
+// hidingStyle reports whether an inline style hides an element's text: not
+// displayed, invisible, transparent, too small to read, moved off screen,
+// or coloured like its background
+func hidingStyle(style string) bool {
+    declarations := make(map[string]string)
+    for _, declaration := range strings.Split(strings.ToLower(style), ";") {
+        property, value, ok := strings.Cut(declaration, ":")
+        if !ok {
+            continue
+        }
+        value = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(value), "!important"))
+        declarations[strings.TrimSpace(property)] = value
+    }
+
+    if declarations["display"] == "none" || declarations["visibility"] == "hidden" {
+        return true
+    }
+    if opacity, ok := declarations["opacity"]; ok {
+        if value, err := strconv.ParseFloat(opacity, 64); err == nil && value == 0 {
+            return true
+        }
+    }
+    if size, unit, ok := cssLength(declarations["font-size"]); ok && (size == 0 || unit == "px" && size <= 1) {
+        return true
+    }
+    for _, property := range []string{"text-indent", "left", "top", "margin-left"} {
+        if offset, unit, ok := cssLength(declarations[property]); ok && offset <= -999 && (unit == "px" || unit == "em" || unit == "") {
+            return true
+        }
+    }
+    if declarations["overflow"] == "hidden" {
+        for _, property := range []string{"height", "width"} {
+            if size, _, ok := cssLength(declarations[property]); ok && size == 0 {
+                return true
+            }
+        }
+    }
+    color := declarations["color"]
+    background := declarations["background-color"]
+    if background == "" {
+        background = declarations["background"]
+    }
+    return color != "" && color == background
+}
+
+// cssLength parses a CSS length like "-9999px" into its number and unit
+func cssLength(value string) (float64, string, bool) {
+    end := strings.IndexFunc(value, func(r rune) bool {
+        return !unicode.IsDigit(r) && r != '.' && r != '-' && r != '+'
+    })
+    if end < 0 {
+        end = len(value)
+    }
+    number, err := strconv.ParseFloat(value[:end], 64)
+    if err != nil {
+        return 0, "", false
+    }
+    return number, strings.TrimSpace(value[end:]), true
+}
+
+// adDensity is how crowded with ad slots a page is for its text, 0 to 1:
+// full at four ads per hundred words
+func adDensity(doc *goquery.Document, words int) float64 {
+    ads := 0
+    // An ad slot's own frames and scripts are not counted again
+    var walk func(n *html.Node)
+    walk = func(n *html.Node) {
+        if n.Type == html.ElementNode && isAdSlot(n) {
+            ads++
+            return
+        }
+        for child := n.FirstChild; child != nil; child = child.NextSibling {
+            walk(child)
+        }
+    }
+    for _, body := range doc.Find("body").Nodes {
+        walk(body)
+    }
+    if ads < 3 {
+        return 0
+    }
+    perHundred := float64(ads) * 100 / float64(max(words, 100))
+    return clamp01((perHundred - 1) / 3)
+}
+
+// isAdSlot reports whether an element holds an ad: a frame or script from an
+// ad network, an ad tag's markup, or a class or id naming an ad
+func isAdSlot(n *html.Node) bool {
+    attrs := make(map[string]string, len(n.Attr))
+    for _, attr := range n.Attr {
+        attrs[attr.Key] = attr.Val
+    }
+    if n.Data == "iframe" || n.Data == "script" {
+        src, err := url.Parse(attrs["src"])
+        return err == nil && adHost(src.Hostname())
+    }
+    if _, ok := attrs["data-ad-slot"]; ok || strings.HasPrefix(attrs["id"], "div-gpt-ad") {
+        return true
+    }
+    // Words of the class and id, so "ad-banner" is an ad but "header" is not
+    names := strings.ToLower(attrs["class"] + " " + attrs["id"])
+    for _, word := range strings.FieldsFunc(names, func(r rune) bool { return !unicode.IsLetter(r) }) {
+        if adWords[word] {
+            return true
+        }
+    }
+    return false
+}
+
+// adHost reports whether host is, or is under, one of the adHosts
+func adHost(host string) bool {
+    host = strings.ToLower(host)
+    for _, ad := range adHosts {
+        if host == ad || strings.HasSuffix(host, "."+ad) {
+            return true
+        }
+    }
+    return false
+}
+
+// linkSignals measures a page's links against its text: link_density, how
+// much of the text is links on a page of many links, and link_farm, links
+// out to many unrelated sites, each 0 to 1
+func linkSignals(doc *goquery.Document, pageURL string, words int) (float64, float64) {
+    base, err := url.Parse(pageURL)
+    if err != nil {
+        return 0, 0
+    }
+    host := strings.TrimPrefix(strings.ToLower(base.Hostname()), "www.")
+    links, external, linkWords := 0, 0, 0
+    hosts := make(map[string]bool)
+    doc.Find("body a[href]").Each(func(_ int, a *goquery.Selection) {
+        link, err := base.Parse(strings.TrimSpace(a.AttrOr("href", "")))
+        if err != nil || link.Scheme != "http" && link.Scheme != "https" {
+            return
+        }
+        links++
+        linkWords += len(collectWords(a.Get(0), true, nil, spamWords))
+        if linkHost := strings.TrimPrefix(strings.ToLower(link.Hostname()), "www."); linkHost != host {
+            external++
+            hosts[linkHost] = true
+        }
+    })
+    if links < 20 {
+        return 0, 0
+    }
+
+    density := 0.0
+    if words > 0 {
+        density = clamp01((float64(linkWords)/float64(words) - 0.6) / 0.3)
+    }
+    farm := 0.0
+    if float64(external) >= 0.5*float64(links) {
+        farm = clamp01(float64(len(hosts)-15) / 35)
+    }
+    return density, farm
+}
+
+// doorway is how much a page looks like a doorway, made to rank and pass
+// visitors on rather than to be read, 0 to 1: it refreshes to another page
+// at once, or redirects with a script or funnels its links to one other
+// site without saying much
+func doorway(doc *goquery.Document, pageURL string, words int) float64 {
+    strength := 0.0
+    doc.Find("meta[http-equiv]").Each(func(_ int, meta *goquery.Selection) {
+        if !strings.EqualFold(meta.AttrOr("http-equiv", ""), "refresh") {
+            return
+        }
+        // content="0; url=https://example.com/"
+        delay, target, _ := strings.Cut(meta.AttrOr("content", ""), ";")
+        seconds, err := strconv.ParseFloat(strings.TrimSpace(delay), 64)
+        if err == nil && seconds <= 3 && strings.Contains(strings.ToLower(target), "url") {
+            strength = 1
+        }
+    })
+    if strength == 1 || words >= 150 {
+        return strength
+    }
+
+    doc.Find("script:not([src])").EachWithBreak(func(_ int, script *goquery.Selection) bool {
+        code := strings.ReplaceAll(script.Text(), " ", "")
+        for _, redirect := range []string{"location.href=", "location.replace(", "location.assign(", "window.location=", "document.location=", "top.location="} {
+            if strings.Contains(code, redirect) {
+                strength = 0.8
+                return false
+            }
+        }
+        return true
+    })
+
+    base, err := url.Parse(pageURL)
+    if err != nil {
+        return strength
+    }
+    host := strings.TrimPrefix(strings.ToLower(base.Hostname()), "www.")
+    targets := make(map[string]int)
+    links := 0
+    doc.Find("body a[href]").Each(func(_ int, a *goquery.Selection) {
+        if link, err := base.Parse(strings.TrimSpace(a.AttrOr("href", ""))); err == nil && link.Host != "" {
+            links++
+            if linkHost := strings.TrimPrefix(strings.ToLower(link.Hostname()), "www."); linkHost != host {
+                targets[linkHost]++
+            }
+        }
+    })
+    for _, count := range targets {
+        if links >= 3 && float64(count) >= 0.7*float64(links) {
+            strength = max(strength, 0.6)
+        }
+    }
+    return strength
+}
+
+// spamTokens lowercases words and trims the punctuation around them,
+// dropping those left empty
+func spamTokens(words []string) []string {
+    tokens := make([]string, 0, len(words))
+    for _, word := range words {
+        word = strings.TrimFunc(strings.ToLower(word), func(r rune) bool {
+            return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+        })
+        if word != "" {
+            tokens = append(tokens, word)
+        }
+    }
+    return tokens
+}
+
+func clamp01(value float64) float64 {
+    return math.Max(0, math.Min(1, value))
+}
@@ -0,0 +1,363 @@
+package crawler
+
+import (
+    "bufio"
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+    "sort"
+    "sync"
+)
+
+// DefaultSeenMemory is how many keys an exact seen set holds in memory
+// before it spills them to disk
+const DefaultSeenMemory = 1 << 20
+
+const (
+    // Keys per block of a spilled run. The first key of each block is kept
+    // in memory to find the one block a key can be in.
+    spillBlockKeys = 64
+    // Runs of one level merged into a run of the next
+    spillFanout = 4
+    // False-positive rate of each run's Bloom filter
+    spillFalsePositiveRate = 0.01
+)
+
+var errCorruptRun = errors.New("seen set: corrupt spill run")
+
+// spillSet is an exact seen set whose memory stays bounded however many
+// keys it holds, built like an LSM tree. Keys go into an in-memory table,
+// which is written out as a sorted run once it holds limit keys. A run keeps
+// only a Bloom filter and the first key of each block in memory, a few bytes
+// per key, and a lookup reads at most one block of each run whose filter
+// does not rule the key out. Runs are merged spillFanout at a time into runs
+// of the next level, so lookups check a few runs per level. Run files live
+// in a temporary directory made on the first spill and removed by close.
+type spillSet struct {
+    limit   int
+    spillAt int // Table size at which to spill; raised when a spill fails
+    memory  map[string]struct{}
+    dir     string
+    runs    []*spillRun
+    nextRun int
+    mutex   sync.Mutex
+}
+
+// spillRun is one sorted file of keys, each a uvarint length and its bytes
+type spillRun struct {
+    path    string
+    file    *os.File
+    level   int
+    keys    int
+    filter  *BloomFilter
+    index   []string // First key of each block
+    offsets []int64  // Offset of each block, then the end of the file
+}
+
+func newSpillSet(limit int) *spillSet {
+    if limit <= 0 {
+        limit = DefaultSeenMemory
+    }
+    return &spillSet{limit: limit, spillAt: limit, memory: make(map[string]struct{})}
+}
+
+func (s *spillSet) testAndAdd(key string) bool {
+    s.mutex.Lock()
+    defer s.mutex.Unlock()
+
+    if s.has(key) {
+        return true
+    }
+    s.memory[key] = struct{}{}
+    if len(s.memory) >= s.spillAt {
+        // Keys that cannot be spilled stay in memory until the next try
+        if err := s.spill(); err != nil {
+            s.spillAt = len(s.memory) + s.limit
+        }
+    }
+    return false
+}
+
+// contains reports whether key was added, without adding it
+func (s *spillSet) contains(key string) bool {
+    s.mutex.Lock()
+    defer s.mutex.Unlock()
+
+    return s.has(key)
+}
+
+func (s *spillSet) has(key string) bool {
+    if _, ok := s.memory[key]; ok {
+        return true
+    }
+    for _, run := range s.runs {
+        found, err := run.contains(key)
+        // A run that cannot be read is trusted to hold the key, as an
+        // unconfirmed Bloom filter hit is
+        if found || err != nil {
+            return true
+        }
+    }
+    return false
+}
+
+// close removes the spilled runs, leaving the set empty
+func (s *spillSet) close() {
+    s.mutex.Lock()
+    defer s.mutex.Unlock()
+
+    for _, run := range s.runs {
+        run.file.Close()
+    }
+    if s.dir != "" {
+        os.RemoveAll(s.dir)
+    }
+    s.memory = make(map[string]struct{})
+    s.runs, s.dir, s.spillAt = nil, "", s.limit
+}
+
+// spill writes the in-memory table out as a run of level 0, then merges
+// levels that have filled up
+func (s *spillSet) spill() error {
+    keys := make([]string, 0, len(s.memory))
+    for key := range s.memory {
+        keys = append(keys, key)
+    }
+    sort.Strings(keys)
+
+    writer, err := s.createRun(0, len(keys))
+    if err != nil {
+        return err
+    }
+    for _, key := range keys {
+        if err := writer.add(key); err != nil {
+            writer.run.remove()
+            return err
+        }
+    }
+    run, err := writer.finish()
+    if err != nil {
+        return err
+    }
+    s.runs = append(s.runs, run)
+    s.memory = make(map[string]struct{})
+    s.spillAt = s.limit
+
+    // A failed merge leaves its runs as they are, still correct
+    s.compact()
+    return nil
+}
+
+// compact merges every spillFanout runs of a level into one of the next
+func (s *spillSet) compact() {
+    for {
+        levels := make(map[int][]*spillRun)
+        var full []*spillRun
+        for _, run := range s.runs {
+            levels[run.level] = append(levels[run.level], run)
+            if len(levels[run.level]) == spillFanout {
+                full = levels[run.level]
+                break
+            }
+        }
+        if full == nil {
+            return
+        }
+
+        merged, err := s.merge(full, full[0].level+1)
+        if err != nil {
+            return
+        }
+        runs := []*spillRun{merged}
+        for _, run := range s.runs {
+            if !containsRun(full, run) {
+                runs = append(runs, run)
+            }
+        }
+        for _, run := range full {
+            run.remove()
+        }
+        s.runs = runs
+    }
+}
+
+func containsRun(runs []*spillRun, run *spillRun) bool {
+    for _, r := range runs {
+        if r == run {
+            return true
+        }
+    }
+    return false
+}
+
+// merge writes the keys of runs, in order, to one run of level. Runs never
+// share a key, as a key is only added when no run holds it.
+func (s *spillSet) merge(runs []*spillRun, level int) (*spillRun, error) {
+    total := 0
+    cursors := make([]*runCursor, 0, len(runs))
+    for _, run := range runs {
+        cursor, err := run.cursor()
+        if err != nil {
+            return nil, err
+        }
+        cursors = append(cursors, cursor)
+        total += run.keys
+    }
+
+    writer, err := s.createRun(level, total)
+    if err != nil {
+        return nil, err
+    }
+    for {
+        var least *runCursor
+        for _, cursor := range cursors {
+            if cursor.key != nil && (least == nil || *cursor.key < *least.key) {
+                least = cursor
+            }
+        }
+        if least == nil {
+            break
+        }
+        if err := writer.add(*least.key); err != nil {
+            writer.run.remove()
+            return nil, err
+        }
+        if err := least.next(); err != nil {
+            writer.run.remove()
+            return nil, err
+        }
+    }
+    return writer.finish()
+}
+
+// runWriter writes a run's keys, which must come in order
+type runWriter struct {
+    run    *spillRun
+    writer *bufio.Writer
+    offset int64
+}
+
+func (s *spillSet) createRun(level, capacity int) (*runWriter, error) {
+    if s.dir == "" {
+        dir, err := os.MkdirTemp("", "smart-crawler-seen-")
+        if err != nil {
+            return nil, fmt.Errorf("seen set: %w", err)
+        }
+        s.dir = dir
+    }
+    s.nextRun++
+    path := filepath.Join(s.dir, fmt.Sprintf("run-%d", s.nextRun))
+    file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+    if err != nil {
+        return nil, fmt.Errorf("seen set: %w", err)
+    }
+    return &runWriter{
+        run: &spillRun{
+            path:   path,
+            file:   file,
+            level:  level,
+            filter: NewBloomFilter(uint(capacity), spillFalsePositiveRate),
+        },
+        writer: bufio.NewWriter(file),
+    }, nil
+}
+
+func (w *runWriter) add(key string) error {
+    if w.run.keys%spillBlockKeys == 0 {
+        w.run.index = append(w.run.index, key)
+        w.run.offsets = append(w.run.offsets, w.offset)
+    }
+    var size [binary.MaxVarintLen64]byte
+    n := binary.PutUvarint(size[:], uint64(len(key)))
+    if _, err := w.writer.Write(size[:n]); err != nil {
+        return err
+    }
+    if _, err := w.writer.WriteString(key); err != nil {
+        return err
+    }
+    w.offset += int64(n + len(key))
+    w.run.keys++
+    w.run.filter.TestAndAdd(key)
+    return nil
+}
+
+func (w *runWriter) finish() (*spillRun, error) {
+    if err := w.writer.Flush(); err != nil {
+        w.run.remove()
+        return nil, err
+    }
+    w.run.offsets = append(w.run.offsets, w.offset)
+    return w.run, nil
+}
+
+// contains reports whether key is in the run, reading the one block it
+// would be in unless the Bloom filter rules it out
+func (r *spillRun) contains(key string) (bool, error) {
+    if !r.filter.Test(key) {
+        return false, nil
+    }
+    block := sort.SearchStrings(r.index, key)
+    if block < len(r.index) && r.index[block] == key {
+        return true, nil
+    }
+    if block == 0 {
+        return false, nil
+    }
+    block--
+
+    data := make([]byte, r.offsets[block+1]-r.offsets[block])
+    if _, err := r.file.ReadAt(data, r.offsets[block]); err != nil {
+        return false, err
+    }
+    for len(data) > 0 {
+        size, n := binary.Uvarint(data)
+        if n <= 0 || uint64(len(data)-n) < size {
+            return false, errCorruptRun
+        }
+        switch entry := string(data[n : n+int(size)]); {
+        case entry == key:
+            return true, nil
+        case entry > key:
+            return false, nil
+        }
+        data = data[n+int(size):]
+    }
+    return false, nil
+}
+
+func (r *spillRun) remove() {
+    r.file.Close()
+    os.Remove(r.path)
+}
+
+// runCursor reads a run's keys in order; key is nil past the last
+type runCursor struct {
+    reader *bufio.Reader
+    key    *string
+}
+
+func (r *spillRun) cursor() (*runCursor, error) {
+    cursor := &runCursor{reader: bufio.NewReader(io.NewSectionReader(r.file, 0, r.offsets[len(r.offsets)-1]))}
+    return cursor, cursor.next()
+}
+
+func (c *runCursor) next() error {
+    size, err := binary.ReadUvarint(c.reader)
+    if err == io.EOF {
+        c.key = nil
+        return nil
+    }
+    if err != nil {
+        return err
+    }
+    data := make([]byte, size)
+    if _, err := io.ReadFull(c.reader, data); err != nil {
+        return errCorruptRun
+    }
+    key := string(data)
+    c.key = &key
+    return nil
+}
@@ -0,0 +1,218 @@
+package crawler
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "net"
+    "net/url"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+
+    "smart-crawler/models"
+)
+
+// DefaultStallTimeout is how long a crawl may go without a successful fetch,
+// while URLs are left to fetch, before it is reported as stalled
+const DefaultStallTimeout = 15 * time.Minute
+
+// StallAlerter is told when a crawl stalls, e.g. to page someone or post to
+// a webhook
+type StallAlerter interface {
+    Alert(ctx context.Context, report *models.StallReport) error
+}
+
+// StallAlertFunc adapts a function to a StallAlerter
+type StallAlertFunc func(ctx context.Context, report *models.StallReport) error
+
+func (f StallAlertFunc) Alert(ctx context.Context, report *models.StallReport) error {
+    return f(ctx, report)
+}
+
+// stallMonitor watches a crawl for stretches where URLs are pending but no
+// fetch succeeds, as when every host has banned or throttled the crawler.
+// Results are observed by the results processor and checked by the
+// dispatcher, hence the lock. Each stall is reported once; a successful fetch
+// rearms it.
+type stallMonitor struct {
+    after    time.Duration
+    since    time.Time
+    attempts int
+    outcomes map[string]map[string]int
+    alerted  bool
+    stalls   int
+    mutex    sync.Mutex
+}
+
+func newStallMonitor(after time.Duration) *stallMonitor {
+    if after <= 0 {
+        return nil
+    }
+    return &stallMonitor{
+        after:    after,
+        since:    time.Now(),
+        outcomes: make(map[string]map[string]int),
+    }
+}
+
+// observe records a settled fetch. Pages served with an error status are
+// saved like any other, but are not progress.
+func (m *stallMonitor) observe(result smartCrawlResult) {
+    if m == nil {
+        return
+    }
+    m.mutex.Lock()
+    defer m.mutex.Unlock()
+
+    outcome := stallOutcome(result)
+    if outcome == "" {
+        m.reset()
+        return
+    }
+
+    m.attempts++
+    host := "unknown"
+    if parsed, err := url.Parse(result.URL); err == nil && parsed.Host != "" {
+        host = parsed.Host
+    }
+    if m.outcomes[host] == nil {
+        m.outcomes[host] = make(map[string]int)
+    }
+    m.outcomes[host][outcome]++
+}
+
+// idle restarts the clock when nothing is left to fetch, as in a continuous
+// crawl waiting for revisits to come due, which is not a stall
+func (m *stallMonitor) idle() {
+    if m == nil {
+        return
+    }
+    m.mutex.Lock()
+    defer m.mutex.Unlock()
+
+    m.reset()
+}
+
+func (m *stallMonitor) reset() {
+    m.since = time.Now()
+    m.attempts = 0
+    m.outcomes = make(map[string]map[string]int)
+    m.alerted = false
+}
+
+// check returns a report when the crawl has stalled and not yet been
+// reported
+func (m *stallMonitor) check(crawlID int64, crawlUUID string, inFlight int) *models.StallReport {
+    if m == nil {
+        return nil
+    }
+    m.mutex.Lock()
+    defer m.mutex.Unlock()
+
+    if m.alerted || time.Since(m.since) < m.after {
+        return nil
+    }
+    m.alerted = true
+    m.stalls++
+
+    outcomes := make(map[string]map[string]int, len(m.outcomes))
+    for host, counts := range m.outcomes {
+        outcomes[host] = make(map[string]int, len(counts))
+        for outcome, n := range counts {
+            outcomes[host][outcome] = n
+        }
+    }
+    return &models.StallReport{
+        CrawlID:   crawlID,
+        CrawlUUID: crawlUUID,
+        Since:     m.since,
+        Attempts:  m.attempts,
+        InFlight:  inFlight,
+        Outcomes:  outcomes,
+        Diagnosis: diagnoseStall(time.Since(m.since), m.attempts, inFlight, outcomes),
+    }
+}
+
+// count is how many stalls have been reported
+func (m *stallMonitor) count() int {
+    if m == nil {
+        return 0
+    }
+    m.mutex.Lock()
+    defer m.mutex.Unlock()
+
+    return m.stalls
+}
+
+// stallOutcome classifies a result that made no progress, or returns "" for
+// a successful fetch
+func stallOutcome(result smartCrawlResult) string {
+    var netErr net.Error
+    switch {
+    case result.Error != nil && errors.As(result.Error, &netErr) && netErr.Timeout():
+        return "timeout"
+    case result.Error != nil:
+        return "error"
+    case result.Skipped:
+        return "skipped: " + result.Reason
+    case result.Page != nil && result.Page.StatusCode >= 400:
+        return fmt.Sprintf("HTTP %d", result.Page.StatusCode)
+    }
+    return ""
+}
+
+// diagnoseStall summarizes what the attempts since the last success ran
+// into, busiest hosts first
+func diagnoseStall(stalled time.Duration, attempts, inFlight int, outcomes map[string]map[string]int) string {
+    stalled = stalled.Round(time.Second)
+    if attempts == 0 {
+        return fmt.Sprintf("no fetch settled in %v with %d URLs in flight; workers may be waiting on the rate limit or on responses that never finish", stalled, inFlight)
+    }
+
+    type hostCount struct {
+        host  string
+        total int
+    }
+    hosts := make([]hostCount, 0, len(outcomes))
+    for host, counts := range outcomes {
+        total := 0
+        for _, n := range counts {
+            total += n
+        }
+        hosts = append(hosts, hostCount{host, total})
+    }
+    sort.Slice(hosts, func(i, j int) bool {
+        if hosts[i].total != hosts[j].total {
+            return hosts[i].total > hosts[j].total
+        }
+        return hosts[i].host < hosts[j].host
+    })
+
+    const maxHosts = 5
+    var parts []string
+    for i, h := range hosts {
+        if i == maxHosts {
+            parts = append(parts, fmt.Sprintf("%d more hosts", len(hosts)-maxHosts))
+            break
+        }
+        counts := outcomes[h.host]
+        kinds := make([]string, 0, len(counts))
+        for outcome := range counts {
+            kinds = append(kinds, outcome)
+        }
+        sort.Slice(kinds, func(i, j int) bool {
+            if counts[kinds[i]] != counts[kinds[j]] {
+                return counts[kinds[i]] > counts[kinds[j]]
+            }
+            return kinds[i] < kinds[j]
+        })
+        for j, kind := range kinds {
+            kinds[j] = fmt.Sprintf("%s x%d", kind, counts[kind])
+        }
+        parts = append(parts, fmt.Sprintf("%s (%s)", h.host, strings.Join(kinds, ", ")))
+    }
+    return fmt.Sprintf("no successful fetch in %v: %d attempts failed across %d hosts: %s",
+        stalled, attempts, len(hosts), strings.Join(parts, "; "))
+}
@@ -0,0 +1,236 @@
+package crawler
+
+import (
+    "encoding/json"
+    "strings"
+
+    "github.com/PuerkitoBio/goquery"
+
+    "smart-crawler/models"
+)
+
+// Formats of structured data found in pages
+const (
+    FormatJSONLD    = "json-ld"
+    FormatMicrodata = "microdata"
+    FormatOpenGraph = "opengraph"
+    FormatTwitter   = "twitter"
+)
+
+// extractStructuredData collects the JSON-LD objects, microdata items, and
+// OpenGraph and Twitter card tags embedded in a page. URLs in microdata and
+// in og:image and twitter:image are resolved against pageURL.
+func extractStructuredData(doc *goquery.Document, pageURL string) []models.StructuredItem {
+    var items []models.StructuredItem
+    items = append(items, extractJSONLD(doc)...)
+    items = append(items, extractMicrodata(doc, pageURL)...)
+    if item := extractMetaTags(doc, pageURL, FormatOpenGraph, "og:", "type"); item != nil {
+        items = append(items, *item)
+    }
+    if item := extractMetaTags(doc, pageURL, FormatTwitter, "twitter:", "card"); item != nil {
+        items = append(items, *item)
+    }
+    return items
+}
+
+// extractJSONLD parses each ld+json script, splitting top-level arrays and
+// @graph lists into their objects. Scripts that are not valid JSON are
+// skipped, as browsers and search engines do.
+func extractJSONLD(doc *goquery.Document) []models.StructuredItem {
+    var items []models.StructuredItem
+    var add func(value interface{})
+    add = func(value interface{}) {
+        switch v := value.(type) {
+        case []interface{}:
+            for _, element := range v {
+                add(element)
+            }
+        case map[string]interface{}:
+            if graph, ok := v["@graph"].([]interface{}); ok {
+                for _, element := range graph {
+                    add(element)
+                }
+                return
+            }
+            items = append(items, models.StructuredItem{Format: FormatJSONLD, Type: jsonLDType(v["@type"]), Properties: v})
+        }
+    }
+
+    doc.Find(`script[type="application/ld+json"]`).Each(func(_ int, script *goquery.Selection) {
+        var value interface{}
+        if err := json.Unmarshal([]byte(strings.TrimSpace(script.Text())), &value); err != nil {
+            return
+        }
+        add(value)
+    })
+    return items
+}
+
+// jsonLDType is an object's @type, or the first of its types when it has
+// several; the properties keep them all
+func jsonLDType(value interface{}) string {
+    typ, _ := firstValue(value).(string)
+    return typ
+}
+
+// extractMicrodata returns the page's top-level microdata items, with items
+// nested as property values
+func extractMicrodata(doc *goquery.Document, pageURL string) []models.StructuredItem {
+    var items []models.StructuredItem
+    doc.Find("[itemscope]:not([itemprop])").Each(func(_ int, scope *goquery.Selection) {
+        items = append(items, microdataItem(scope, pageURL))
+    })
+    return items
+}
+
+func microdataItem(scope *goquery.Selection, pageURL string) models.StructuredItem {
+    item := models.StructuredItem{Format: FormatMicrodata, Properties: make(map[string]interface{})}
+    // An item may list several types; the first is kept, and
+    // "https://schema.org/Product" is stored as "Product"
+    if itemTypes, _ := scope.Attr("itemtype"); len(strings.Fields(itemTypes)) > 0 {
+        itemType := strings.Fields(itemTypes)[0]
+        for _, prefix := range []string{"https://schema.org/", "http://schema.org/"} {
+            itemType = strings.TrimPrefix(itemType, prefix)
+        }
+        item.Type = itemType
+    }
+    if id, ok := scope.Attr("itemid"); ok {
+        item.Properties["@id"] = id
+    }
+
+    // Properties are the itemprop elements whose nearest item is this one
+    var walk func(parent *goquery.Selection)
+    walk = func(parent *goquery.Selection) {
+        parent.Children().Each(func(_ int, child *goquery.Selection) {
+            _, nested := child.Attr("itemscope")
+            if names, ok := child.Attr("itemprop"); ok {
+                var value interface{}
+                if nested {
+                    nestedItem := microdataItem(child, pageURL)
+                    if nestedItem.Type != "" {
+                        nestedItem.Properties["@type"] = nestedItem.Type
+                    }
+                    value = nestedItem.Properties
+                } else {
+                    value = microdataValue(child, pageURL)
+                }
+                for _, name := range strings.Fields(names) {
+                    addProperty(item.Properties, name, value)
+                }
+            }
+            if !nested {
+                walk(child)
+            }
+        })
+    }
+    walk(scope)
+    return item
+}
+
+// microdataValue is the value of a property element, per the HTML
+// microdata spec
+func microdataValue(element *goquery.Selection, pageURL string) string {
+    attr := func(name string) string {
+        value, _ := element.Attr(name)
+        return strings.TrimSpace(value)
+    }
+    switch goquery.NodeName(element) {
+    case "meta":
+        return attr("content")
+    case "audio", "embed", "iframe", "img", "source", "track", "video":
+        return absoluteURL(pageURL, attr("src"))
+    case "a", "area", "link":
+        return absoluteURL(pageURL, attr("href"))
+    case "object":
+        return absoluteURL(pageURL, attr("data"))
+    case "data", "meter":
+        return attr("value")
+    case "time":
+        if datetime, ok := element.Attr("datetime"); ok {
+            return strings.TrimSpace(datetime)
+        }
+    }
+    return strings.TrimSpace(element.Text())
+}
+
+// extractMetaTags collects the meta tags whose property or name starts with
+// prefix into one item, keyed without the prefix. A tag given more than once,
+// like og:image, becomes a list. The typeKey tag names the item's type.
+func extractMetaTags(doc *goquery.Document, pageURL, format, prefix, typeKey string) *models.StructuredItem {
+    properties := make(map[string]interface{})
+    doc.Find("meta[content]").Each(func(_ int, meta *goquery.Selection) {
+        name, _ := meta.Attr("property")
+        if !strings.HasPrefix(strings.ToLower(name), prefix) {
+            name, _ = meta.Attr("name")
+        }
+        if !strings.HasPrefix(strings.ToLower(name), prefix) {
+            return
+        }
+        key := strings.ToLower(name[len(prefix):])
+        value, _ := meta.Attr("content")
+        value = strings.TrimSpace(value)
+        if key == "" || value == "" {
+            return
+        }
+        if key == "image" || key == "image:url" || key == "image:secure_url" {
+            value = absoluteURL(pageURL, value)
+        }
+        addProperty(properties, key, value)
+    })
+    if len(properties) == 0 {
+        return nil
+    }
+    item := &models.StructuredItem{Format: format, Properties: properties}
+    item.Type, _ = firstValue(properties[typeKey]).(string)
+    return item
+}
+
+// absoluteURL resolves href against pageURL, keeping href as is if it
+// cannot be resolved
+func absoluteURL(pageURL, href string) string {
+    if href == "" {
+        return ""
+    }
+    if resolved := resolveURL(pageURL, href); resolved != "" {
+        return resolved
+    }
+    return href
+}
+
+// addProperty sets name, turning it into a list when it is already set
+func addProperty(properties map[string]interface{}, name string, value interface{}) {
+    existing, ok := properties[name]
+    if !ok {
+        properties[name] = value
+        return
+    }
+    if list, ok := existing.([]interface{}); ok {
+        properties[name] = append(list, value)
+        return
+    }
+    properties[name] = []interface{}{existing, value}
+}
+
+func firstValue(value interface{}) interface{} {
+    if list, ok := value.([]interface{}); ok {
+        if len(list) == 0 {
+            return nil
+        }
+        return list[0]
+    }
+    return value
+}
+
+// applyOpenGraph copies the OpenGraph title, description, and image of
+// items to their own page columns
+func applyOpenGraph(page *models.Page, items []models.StructuredItem) {
+    for _, item := range items {
+        if item.Format != FormatOpenGraph {
+            continue
+        }
+        page.OGTitle, _ = firstValue(item.Properties["title"]).(string)
+        page.OGDescription, _ = firstValue(item.Properties["description"]).(string)
+        page.OGImage, _ = firstValue(item.Properties["image"]).(string)
+        return
+    }
+}
@@ -0,0 +1,103 @@
+package crawler
+
+import (
+    "fmt"
+    "regexp"
+    "strings"
+
+    "smart-crawler/database"
+    "smart-crawler/models"
+)
+
+// TagRule attaches Tag to every crawled page whose Field matches Pattern.
+// Field is one of "url", "title", or "content".
+type TagRule struct {
+    Tag     string
+    Field   string
+    Pattern *regexp.Regexp
+}
+
+// ParseTagRules parses a semicolon separated list of "tag:field:regex"
+// entries, e.g. "docs:url:/docs/;golang:title:(?i)\bgo\b".
+func ParseTagRules(spec string) ([]TagRule, error) {
+    var rules []TagRule
+
+    for _, entry := range strings.Split(spec, ";") {
+        entry = strings.TrimSpace(entry)
+        if entry == "" {
+            continue
+        }
+
+        parts := strings.SplitN(entry, ":", 3)
+        if len(parts) != 3 || parts[0] == "" {
+            return nil, fmt.Errorf("invalid tag rule %q, expected tag:field:regex", entry)
+        }
+
+        field := strings.ToLower(parts[1])
+        if field != "url" && field != "title" && field != "content" {
+            return nil, fmt.Errorf("invalid tag rule %q: unknown field %q", entry, parts[1])
+        }
+
+        pattern, err := regexp.Compile(parts[2])
+        if err != nil {
+            return nil, fmt.Errorf("invalid tag rule %q: %w", entry, err)
+        }
+
+        rules = append(rules, TagRule{Tag: parts[0], Field: field, Pattern: pattern})
+    }
+
+    return rules, nil
+}
+
+// WithTagRules tags pages with rules as they are saved
+func WithTagRules(rules []TagRule) Option {
+    return func(o *options) error {
+        for _, rule := range rules {
+            if rule.Pattern == nil {
+                return fmt.Errorf("tag rule %q has no pattern", rule.Tag)
+            }
+            if rule.Field != "url" && rule.Field != "title" && rule.Field != "content" {
+                return fmt.Errorf("tag rule %q: unknown field %q", rule.Tag, rule.Field)
+            }
+        }
+        o.tagRules = rules
+        return nil
+    }
+}
+
+// matchTags returns the distinct tags whose rules match page
+func matchTags(rules []TagRule, page *models.Page) []string {
+    var tags []string
+    seen := make(map[string]bool)
+
+    for _, rule := range rules {
+        if seen[rule.Tag] {
+            continue
+        }
+
+        var value string
+        switch rule.Field {
+        case "url":
+            value = page.URL
+        case "title":
+            value = page.Title
+        case "content":
+            value = page.Content
+        }
+
+        if rule.Pattern.MatchString(value) {
+            seen[rule.Tag] = true
+            tags = append(tags, rule.Tag)
+        }
+    }
+
+    return tags
+}
+
+// applyTagRules tags a freshly saved page with every matching rule
+func applyTagRules(db database.Store, rules []TagRule, page *models.Page) error {
+    if len(rules) == 0 {
+        return nil
+    }
+    return db.AddPageTags(page.ID, matchTags(rules, page), "rule")
+}
@@ -0,0 +1,211 @@
+package crawler
+
+import (
+    "context"
+    "crypto/tls"
+    "math"
+    "math/rand"
+    "net/http/httptrace"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+
+    "smart-crawler/models"
+)
+
+// timingSamples is how many pages' timings a crawl keeps to take its
+// percentiles from
+const timingSamples = 10000
+
+// fetchTimer follows one fetch through httptrace. A redirected fetch runs
+// through the hooks once per response, and net/http may race two dials.
+type fetchTimer struct {
+    mutex        sync.Mutex
+    dnsStart     time.Time
+    connectStart time.Time
+    tlsStart     time.Time
+    wrote        time.Time
+    firstByte    time.Time
+    dns          time.Duration
+    connect      time.Duration
+    tls          time.Duration
+    ttfb         time.Duration
+    reused       bool
+}
+
+// withFetchTimer returns ctx with a trace that times the requests sent
+// with it
+func withFetchTimer(ctx context.Context) (context.Context, *fetchTimer) {
+    t := &fetchTimer{}
+    return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+        DNSStart: func(httptrace.DNSStartInfo) {
+            t.start(&t.dnsStart)
+        },
+        DNSDone: func(httptrace.DNSDoneInfo) {
+            t.stop(&t.dnsStart, &t.dns)
+        },
+        ConnectStart: func(network, addr string) {
+            t.start(&t.connectStart)
+        },
+        // Only the dial that won counts, timed from the first one started
+        ConnectDone: func(network, addr string, err error) {
+            if err == nil {
+                t.stop(&t.connectStart, &t.connect)
+            }
+        },
+        TLSHandshakeStart: func() {
+            t.start(&t.tlsStart)
+        },
+        TLSHandshakeDone: func(tls.ConnectionState, error) {
+            t.stop(&t.tlsStart, &t.tls)
+        },
+        GotConn: func(info httptrace.GotConnInfo) {
+            t.mutex.Lock()
+            defer t.mutex.Unlock()
+
+            t.reused = info.Reused
+        },
+        WroteRequest: func(httptrace.WroteRequestInfo) {
+            t.mutex.Lock()
+            defer t.mutex.Unlock()
+
+            t.wrote = time.Now()
+        },
+        GotFirstResponseByte: func() {
+            t.mutex.Lock()
+            defer t.mutex.Unlock()
+
+            t.firstByte = time.Now()
+            if !t.wrote.IsZero() {
+                t.ttfb = t.firstByte.Sub(t.wrote)
+            }
+        },
+    }), t
+}
+
+// start marks a phase begun, unless a concurrent attempt at it already has
+func (t *fetchTimer) start(at *time.Time) {
+    t.mutex.Lock()
+    defer t.mutex.Unlock()
+
+    if at.IsZero() {
+        *at = time.Now()
+    }
+}
+
+// stop adds the time since a phase began to its total
+func (t *fetchTimer) stop(at *time.Time, total *time.Duration) {
+    t.mutex.Lock()
+    defer t.mutex.Unlock()
+
+    if !at.IsZero() {
+        *total += time.Since(*at)
+        *at = time.Time{}
+    }
+}
+
+// timing returns the phases so far, the body taken to be read by now
+func (t *fetchTimer) timing() *models.RequestTiming {
+    t.mutex.Lock()
+    defer t.mutex.Unlock()
+
+    timing := &models.RequestTiming{
+        DNS:     milliseconds(t.dns),
+        Connect: milliseconds(t.connect),
+        TLS:     milliseconds(t.tls),
+        TTFB:    milliseconds(t.ttfb),
+        Reused:  t.reused,
+    }
+    if !t.firstByte.IsZero() {
+        timing.Download = milliseconds(time.Since(t.firstByte))
+    }
+    return timing
+}
+
+// milliseconds is d in milliseconds, to the microsecond
+func milliseconds(d time.Duration) float64 {
+    return float64(d.Microseconds()) / 1000
+}
+
+// timingReservoir keeps a uniform sample of a crawl's page timings, so the
+// percentiles of a long crawl take bounded memory. Results are recorded
+// from one goroutine.
+type timingReservoir struct {
+    samples []timingSample
+    seen    int
+    rng     *rand.Rand
+}
+
+// timingSample is a page's timing and whether its connection needed a TLS
+// handshake of its own
+type timingSample struct {
+    models.RequestTiming
+    tls bool
+}
+
+func newTimingReservoir() *timingReservoir {
+    return &timingReservoir{rng: rand.New(rand.NewSource(time.Now().UnixNano()))}
+}
+
+func (r *timingReservoir) add(page *models.Page) {
+    if page.Timing == nil {
+        return
+    }
+    final := page.URL
+    if page.FinalURL != "" {
+        final = page.FinalURL
+    }
+    sample := timingSample{
+        RequestTiming: *page.Timing,
+        tls:           strings.HasPrefix(final, "https:") && !strings.HasPrefix(page.Protocol, "HTTP/3"),
+    }
+    r.seen++
+    if len(r.samples) < timingSamples {
+        r.samples = append(r.samples, sample)
+        return
+    }
+    if i := r.rng.Intn(r.seen); i < timingSamples {
+        r.samples[i] = sample
+    }
+}
+
+// percentiles summarizes the sample, or returns nil if nothing was fetched
+func (r *timingReservoir) percentiles() *models.TimingPercentiles {
+    if r.seen == 0 {
+        return nil
+    }
+    var dns, connect, tlsTimes, ttfb, download []float64
+    for _, sample := range r.samples {
+        if !sample.Reused {
+            dns = append(dns, sample.DNS)
+            connect = append(connect, sample.Connect)
+            if sample.tls {
+                tlsTimes = append(tlsTimes, sample.TLS)
+            }
+        }
+        ttfb = append(ttfb, sample.TTFB)
+        download = append(download, sample.Download)
+    }
+    return &models.TimingPercentiles{
+        Fetches:  r.seen,
+        DNS:      percentilesOf(dns),
+        Connect:  percentilesOf(connect),
+        TLS:      percentilesOf(tlsTimes),
+        TTFB:     percentilesOf(ttfb),
+        Download: percentilesOf(download),
+    }
+}
+
+// percentilesOf takes the nearest-rank percentiles of values, sorting them
+func percentilesOf(values []float64) models.Percentiles {
+    if len(values) == 0 {
+        return models.Percentiles{}
+    }
+    sort.Float64s(values)
+    rank := func(p float64) float64 {
+        i := int(math.Ceil(p*float64(len(values)))) - 1
+        return values[min(max(i, 0), len(values)-1)]
+    }
+    return models.Percentiles{P50: rank(0.5), P90: rank(0.9), P99: rank(0.99), Max: values[len(values)-1]}
+}
@@ -0,0 +1,228 @@
+package crawler
+
+import (
+    "bytes"
+    "errors"
+    "fmt"
+    "math"
+    "net/http"
+    "os"
+    "strings"
+    "sync"
+    "unicode"
+
+    "github.com/PuerkitoBio/goquery"
+)
+
+const (
+    // topicWords is how many words of a page's visible text its relevance
+    // is judged on
+    topicWords = 2000
+    // topicInherit is the share of a link's topic score its page passes on;
+    // the rest comes from the link's own text
+    topicInherit = 0.6
+    // topicDecay is the share of what a page passes on that comes from its
+    // own score rather than its relevance. An irrelevant page passes on only
+    // this share, so a branch of irrelevant pages fades within a few links.
+    topicDecay = 0.5
+    // topicWeight is the share of a link's priority its topic score makes
+    // up under a topic; the rest is the link model's
+    topicWeight = 0.8
+)
+
+// Topic is what a focused crawl looks for: the terms of its keywords or
+// seed documents, weighted by TF-IDF. Document frequencies start from the
+// seed documents and grow with every page analyzed, so terms common across
+// the crawl weigh less as it goes on. A Topic is safe for concurrent use.
+type Topic struct {
+    terms map[string]float64 // Term frequencies of the keywords and seed documents
+
+    mutex sync.Mutex
+    docs  int            // Documents the frequencies were learned from
+    df    map[string]int // Documents each term appeared in
+}
+
+// NewTopic builds a topic from keywords and the texts of seed documents, or
+// fails if they have no terms
+func NewTopic(keywords []string, documents []string) (*Topic, error) {
+    t := &Topic{terms: make(map[string]float64), df: make(map[string]int)}
+    for _, keyword := range keywords {
+        for term := range topicTerms(keyword) {
+            t.terms[term]++
+        }
+    }
+    for _, document := range documents {
+        counts := topicTerms(document)
+        for term, n := range counts {
+            t.terms[term] += n
+        }
+        t.learn(counts)
+    }
+    if len(t.terms) == 0 {
+        return nil, errors.New("topic has no terms")
+    }
+    return t, nil
+}
+
+// WithTopic focuses the crawl on topic: each page is scored for its
+// relevance to it, and the smart crawler follows links from relevant pages,
+// and links whose text is relevant, first. The harvest rate then counts
+// relevant pages instead of good quality ones. Each crawler learns document
+// frequencies on its own copy of topic, so crawlers built alike score alike.
+func WithTopic(topic *Topic) Option {
+    return func(o *options) error {
+        if topic == nil {
+            return errors.New("topic must not be nil")
+        }
+        o.topic = topic.clone()
+        return nil
+    }
+}
+
+// clone copies t with the document frequencies learned so far
+func (t *Topic) clone() *Topic {
+    t.mutex.Lock()
+    defer t.mutex.Unlock()
+    c := &Topic{terms: t.terms, docs: t.docs, df: make(map[string]int, len(t.df))}
+    for term, n := range t.df {
+        c.df[term] = n
+    }
+    return c
+}
+
+// LoadTopic builds a topic from keywords and seed documents read from
+// paths, text or HTML
+func LoadTopic(keywords []string, paths []string) (*Topic, error) {
+    documents := make([]string, 0, len(paths))
+    for _, path := range paths {
+        body, err := os.ReadFile(path)
+        if err != nil {
+            return nil, fmt.Errorf("reading topic document: %w", err)
+        }
+        text := string(body)
+        if strings.HasPrefix(http.DetectContentType(body), "text/html") {
+            doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+            if err != nil {
+                return nil, fmt.Errorf("parsing topic document %s: %w", path, err)
+            }
+            removeIgnoredSections(doc)
+            text = topicText(doc)
+        }
+        documents = append(documents, text)
+    }
+    return NewTopic(keywords, documents)
+}
+
+// topicText is what a page's relevance is judged on: its title and the
+// start of its visible text
+func topicText(doc *goquery.Document) string {
+    text := doc.Find("title").Text()
+    if body := doc.Find("body"); body.Length() > 0 {
+        text += " " + strings.Join(collectWords(body.Get(0), true, nil, topicWords), " ")
+    }
+    return text
+}
+
+// Relevance is the cosine similarity of text's TF-IDF vector to the
+// topic's, 0 to 1. It does not count text towards the document frequencies.
+func (t *Topic) Relevance(text string) float64 {
+    return t.similarity(topicTerms(text), false)
+}
+
+// analyze is the relevance of a page's text, which then counts towards the
+// document frequencies
+func (t *Topic) analyze(text string) float64 {
+    return t.similarity(topicTerms(text), true)
+}
+
+func (t *Topic) similarity(counts map[string]float64, learn bool) float64 {
+    t.mutex.Lock()
+    defer t.mutex.Unlock()
+    if learn {
+        t.learn(counts)
+    }
+    if len(counts) == 0 {
+        return 0
+    }
+
+    var dot, textNorm, topicNorm float64
+    for term, n := range counts {
+        w := tfWeight(n) * t.idf(term)
+        textNorm += w * w
+        if topicN, ok := t.terms[term]; ok {
+            dot += w * tfWeight(topicN) * t.idf(term)
+        }
+    }
+    for term, n := range t.terms {
+        w := tfWeight(n) * t.idf(term)
+        topicNorm += w * w
+    }
+    if dot == 0 {
+        return 0
+    }
+    return min(dot/math.Sqrt(textNorm*topicNorm), 1)
+}
+
+// learn counts a document's terms towards the document frequencies; the
+// caller holds the mutex, or owns t
+func (t *Topic) learn(counts map[string]float64) {
+    t.docs++
+    for term := range counts {
+        t.df[term]++
+    }
+}
+
+// idf is the smoothed inverse document frequency of term, so terms no
+// document had yet still count
+func (t *Topic) idf(term string) float64 {
+    return math.Log(float64(1+t.docs)/float64(1+t.df[term])) + 1
+}
+
+// tfWeight dampens a term frequency, so a term repeated on a page does not
+// swamp the others
+func tfWeight(n float64) float64 {
+    return 1 + math.Log(n)
+}
+
+// linkScore is how promising a link is for the topic, 0 to 1: its text's
+// relevance blended with what its page passes on, the page's relevance and
+// a decayed share of its own score, which its priority carries. Cosines
+// against a short topic are small, so relevances are spread out by their
+// square root.
+func linkScore(pageRelevance float64, pagePriority int, textRelevance float64) float64 {
+    inherited := topicDecay*float64(pagePriority)/100 + (1-topicDecay)*math.Sqrt(pageRelevance)
+    return topicInherit*inherited + (1-topicInherit)*math.Sqrt(textRelevance)
+}
+
+// topicPriority blends a link's priority by the link model with its topic
+// score
+func topicPriority(priority int, score float64) int {
+    return int(math.Round(topicWeight*100*score + (1-topicWeight)*float64(priority)))
+}
+
+// topicTerms counts the terms of text: lower-cased words without stop
+// words, with plural and verb endings stripped
+func topicTerms(text string) map[string]float64 {
+    counts := make(map[string]float64)
+    words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+        return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+    })
+    for _, word := range words {
+        if len([]rune(word)) < 2 || stopWords[word] {
+            continue
+        }
+        counts[stemTerm(word)]++
+    }
+    return counts
+}
+
+// stemTerm strips the commonest English endings, so "crawlers" and
+// "crawling" match "crawler" and "crawl"
+func stemTerm(word string) string {
+    for _, suffix := range []string{"ing", "ed", "s"} {
+        if stem, ok := strings.CutSuffix(word, suffix); ok && len(stem) >= 3 && !strings.HasSuffix(stem, "s") {
+            return stem
+        }
+    }
+    return word
+}
@@ -0,0 +1,97 @@
+package crawler
+
+import (
+    "context"
+
+    "go.opentelemetry.io/otel"
+    "go.opentelemetry.io/otel/attribute"
+    "go.opentelemetry.io/otel/codes"
+    "go.opentelemetry.io/otel/trace"
+
+    "smart-crawler/models"
+)
+
+// tracer records the crawl pipeline with the global tracer provider, which
+// drops spans unless tracing was started. A crawl is one trace; each page
+// fetched is a trace of its own, linked to the crawl's, so a long crawl does
+// not grow one trace without bound. The batches that save pages belong to
+// the crawl's trace and link to the pages they saved.
+var tracer = otel.Tracer("smart-crawler/crawler")
+
+// startCrawlSpan starts the span covering a whole crawl
+func startCrawlSpan(ctx context.Context, mode string, crawlID int64, startURL string) (context.Context, trace.Span) {
+    return tracer.Start(ctx, "crawl", trace.WithAttributes(
+        attribute.String("crawl.mode", mode),
+        attribute.Int64("crawl.id", crawlID),
+        attribute.String("crawl.start_url", startURL),
+    ))
+}
+
+// startPageSpan starts the trace of a page, linked to the crawl in ctx
+func startPageSpan(ctx context.Context, urlPriority models.URLPriority) (context.Context, trace.Span) {
+    return tracer.Start(ctx, "crawl.page",
+        trace.WithNewRoot(),
+        trace.WithLinks(trace.LinkFromContext(ctx)),
+        trace.WithAttributes(
+            attribute.String("url.full", urlPriority.URL),
+            attribute.Int("crawl.depth", urlPriority.Depth),
+            attribute.Int("crawl.priority", urlPriority.Priority),
+        ))
+}
+
+// endPageSpan records how a page's crawl turned out
+func endPageSpan(span trace.Span, skipped bool, reason string, err error) {
+    if skipped {
+        span.SetAttributes(attribute.String("crawl.skip_reason", reason))
+    }
+    endSpan(span, err)
+}
+
+// startFetchSpan starts the span of a page's requests
+func startFetchSpan(ctx context.Context, strategy FetchStrategy) (context.Context, trace.Span) {
+    return tracer.Start(ctx, "fetch", trace.WithAttributes(attribute.String("crawl.fetch_strategy", string(strategy))))
+}
+
+// endFetchSpan records the response a fetch ended with
+func endFetchSpan(span trace.Span, fetched *fetchResponse, err error) {
+    if fetched.StatusCode != 0 {
+        span.SetAttributes(attribute.Int("http.response.status_code", fetched.StatusCode))
+    }
+    span.SetAttributes(
+        attribute.Int("crawl.requests", fetched.Usage.Requests),
+        attribute.Int64("crawl.bytes", fetched.Usage.Bytes),
+    )
+    if fetched.FinalURL != "" {
+        span.SetAttributes(attribute.String("crawl.final_url", fetched.FinalURL))
+    }
+    endSpan(span, err)
+}
+
+// startHandleSpan starts the span of a content handler; the HTML handler
+// adds its parse and analyze steps under it
+func startHandleSpan(ctx context.Context, mediaType string) (context.Context, trace.Span) {
+    return tracer.Start(ctx, "handle", trace.WithAttributes(attribute.String("crawl.media_type", mediaType)))
+}
+
+// startSaveSpan starts the span of a batch of pages being saved, linked to
+// the traces of the pages
+func startSaveSpan(ctx context.Context, pages []trace.SpanContext) (context.Context, trace.Span) {
+    links := make([]trace.Link, 0, len(pages))
+    for _, page := range pages {
+        if page.IsValid() {
+            links = append(links, trace.Link{SpanContext: page})
+        }
+    }
+    return tracer.Start(ctx, "save",
+        trace.WithLinks(links...),
+        trace.WithAttributes(attribute.Int("crawl.pages", len(pages))))
+}
+
+// endSpan ends span, marking it failed if err is set
+func endSpan(span trace.Span, err error) {
+    if err != nil {
+        span.RecordError(err)
+        span.SetStatus(codes.Error, err.Error())
+    }
+    span.End()
+}
@@ -2,55 +2,177 @@
 package crawler
 
 import (
+    "bytes"
     "context"
-    "crypto/md5"
+    "errors"
     "fmt"
     "io"
     "net/http"
     "net/url"
-    "strings"
     "sync"
     "time"
 
     "github.com/PuerkitoBio/goquery"
+    "go.opentelemetry.io/otel/attribute"
+    "go.opentelemetry.io/otel/trace"
     "golang.org/x/time/rate"
 
+    "smart-crawler/audit"
     "smart-crawler/database"
     "smart-crawler/models"
     "smart-crawler/utils"
 )
 
 type Traditional struct {
-    db      *database.PostgresDB
-    client  *http.Client
-    limiter *rate.Limiter
-    workers int
+    eventEmitter
+    db        database.Store
+    client    *http.Client
+    limiter   *rate.Limiter
+    workers   int
+    tagRules  []TagRule
+    sinks     pageSinks
+    scope     Scope
+    urlFilter *URLFilter
+    crawlID   int64 // Session of the running crawl
+    crawlUUID string
+
+    budget        Budget
+    budgetTracker *budgetTracker // budget spent by the running crawl
+    timings       *timingReservoir // fetch timings of the running crawl
+    loads         *loadRecorder    // load times and throughput of the running crawl
+
+    // Pages are scored for the harvest rate alone, when it is tracked
+    harvestThreshold float64
+    harvestAnalyzer  *DefaultAnalyzer
+    topic            *Topic // nil scores no relevance
+
+    extraction   *ExtractionRules // nil extracts nothing
+    imageOptions *ImageOptions    // nil records no images
+    images       *imageRecorder   // images of the running crawl's pages
+    linkSelector *Selector        // nil follows every link
+    normalizer   *utils.URLNormalizer // nil normalizes like utils.NormalizeURL
+    spam         *SpamFilter          // nil flags no spam
+    sitemapOnly  bool             // Fetch what the sitemaps list instead of following links
+    mirrorDir    string           // Where to write an offline copy; "" writes none
+    mirror       *mirror          // The running crawl's offline copy, with mirrorDir set
+    seen          SeenOptions
+    progress      progressTracker
+    gate          pauseGate
+
+    resolveRedirects bool
+    redirects        *redirectResolver // nil unless resolving for the running crawl
+
+    maxResponseSize int64 // 0 reads bodies whole
+
+    auth *Auth // nil without credentials
 }
 
-func NewTraditional(db *database.PostgresDB, workers int) *Traditional {
-    return &Traditional{
-        db: db,
-        client: &http.Client{
-            Timeout: 30 * time.Second,
-            Transport: &http.Transport{
-                MaxIdleConns:        100,
-                MaxIdleConnsPerHost: 10,
-                IdleConnTimeout:     90 * time.Second,
-            },
-        },
-        limiter: rate.NewLimiter(rate.Limit(10), 20), // 10 requests per second, burst of 20
-        workers: workers,
+// NewTraditional builds a breadth-first crawler that writes to db. Without
+// options it runs 10 workers at 10 requests per second, with bursts of 20.
+// It does not analyze content or rank links, so WithAnalyzer,
+// WithLinkModel, WithScorer, and WithScript are errors, though with WithHarvestThreshold it scores
+// pages for the harvest rate, against WithTopic's topic if there is one.
+func NewTraditional(db database.Store, opts ...Option) (*Traditional, error) {
+    o, err := buildOptions(opts, rate.Limit(10), 20)
+    if err != nil {
+        return nil, err
+    }
+    if o.analyzer != nil {
+        return nil, errors.New("the traditional crawler does not analyze content")
+    }
+    if o.linkModel != nil || o.scorer != nil {
+        return nil, errors.New("the traditional crawler does not rank links")
+    }
+    if o.script != nil {
+        return nil, errors.New("the traditional crawler does not run scripts")
+    }
+
+    t := &Traditional{
+        eventEmitter: eventEmitter{logger: o.logger},
+        db:           db,
+        client:       o.client,
+        limiter:      rate.NewLimiter(o.limit, o.burst),
+        workers:      o.workers,
+        scope:        o.scope,
+        urlFilter:    o.urlFilter,
+        budget:       o.budget,
+        seen:         o.seen,
+        tagRules:     o.tagRules,
+        sinks:        o.sinks,
+
+        harvestThreshold: o.harvestThreshold,
+        harvestAnalyzer:  NewDefaultAnalyzer(),
+        topic:            o.topic,
+        extraction:       o.extraction,
+        imageOptions:     o.images,
+        linkSelector:     o.linkSelector,
+        normalizer:       o.normalizer,
+        spam:             o.spam,
+
+        resolveRedirects: o.resolveRedirects,
+        maxResponseSize:  o.maxResponseSize,
+        auth:             o.auth,
+    }
+    if o.auditLog != nil {
+        t.client.Transport = &audit.Transport{
+            Base: t.client.Transport,
+            Log:  o.auditLog,
+            Rule: func() audit.Rule { return limiterRule(t.limiter, false) },
+        }
     }
+    return t, nil
 }
 
 func (t *Traditional) Crawl(ctx context.Context, startURL string, maxDepth int) (*models.CrawlStats, error) {
     start := time.Now()
-    stats := &models.CrawlStats{}
+    startURL = t.normalizer.Normalize(startURL)
+    if t.auth != nil {
+        if err := t.auth.Login(ctx, t.client); err != nil {
+            return nil, err
+        }
+    }
+
+    kind := "traditional"
+    switch {
+    case t.sitemapOnly:
+        kind = "sitemap"
+    case t.mirrorDir != "":
+        kind = "mirror"
+    }
+    crawlID, crawlUUID, err := t.db.CreateCrawl(kind, startURL, maxDepth)
+    if err != nil {
+        return nil, fmt.Errorf("failed to create crawl: %w", err)
+    }
+    t.crawlID, t.crawlUUID = crawlID, crawlUUID
+    t.session(crawlID, crawlUUID)
+    stats := &models.CrawlStats{CrawlID: crawlID, CrawlUUID: crawlUUID}
+    t.budgetTracker = newBudgetTracker(t.budget, stats)
+    t.timings = newTimingReservoir()
+    t.loads = newLoadRecorder()
+    t.redirects = nil
+    if t.resolveRedirects {
+        t.redirects = newRedirectResolver(func(from, to string) error {
+            return t.db.SaveRedirect(crawlID, from, to)
+        })
+    }
 
     // Simple queue implementation
     urlQueue := make(chan models.URLPriority, 1000)
     results := make(chan crawlResult, 100)
 
+    ctx, span := startCrawlSpan(ctx, kind, crawlID, startURL)
+    defer span.End()
+
+    t.progress.start(crawlID, func() (int, error) { return len(urlQueue), nil }, t.budget, stats)
+    defer t.progress.stop()
+
+    scope := newScopeFilter(t.scope, startURL)
+    t.mirror = nil
+    if t.mirrorDir != "" {
+        t.mirror = t.newMirror(ctx, scope)
+    }
+    t.images = newImageRecorder(t.imageOptions, t.client, t.limiter, t.maxResponseSize)
+
     // Start workers
     var wg sync.WaitGroup
     for i := 0; i < t.workers; i++ {
@@ -59,20 +181,33 @@ func (t *Traditional) Crawl(ctx context.Context, startURL string, maxDepth int)
     }
 
     // Results processor
-    go t.processResults(ctx, results, stats)
-
-    // Add initial URL
-    urlQueue <- models.URLPriority{
-        URL:   startURL,
-        Depth: 0,
+    processed := make(chan struct{})
+    go func() {
+        t.processResults(ctx, results, stats)
+        close(processed)
+    }()
+
+    // URLs are visited once per fingerprint
+    visited := newSeenSet(t.seen, func(fingerprint string) (bool, error) {
+        return t.db.IsFingerprintCrawled(crawlID, fingerprint)
+    })
+    defer visited.close()
+    if t.sitemapOnly {
+        t.queueSitemapURLs(ctx, startURL, scope, visited, urlQueue, stats)
+        // The workers fetch what was queued; no links are followed
+        maxDepth = -1
+    } else {
+        // Add initial URL
+        urlQueue <- models.URLPriority{
+            URL:   startURL,
+            Depth: 0,
+        }
+        visited.testAndAdd(t.normalizer.Fingerprint(startURL))
     }
 
-    visited := make(map[string]bool)
-    visited[startURL] = true
-
     // Simple BFS crawling
     for depth := 0; depth <= maxDepth; depth++ {
-        if ctx.Err() != nil {
+        if ctx.Err() != nil || t.budgetTracker.exhausted() {
             break
         }
 
@@ -89,22 +224,30 @@ func (t *Traditional) Crawl(ctx context.Context, startURL string, maxDepth int)
         }
 
         for _, currentURL := range levelURLs {
-            links, err := t.extractLinks(ctx, currentURL)
+            if err := t.gate.wait(ctx); err != nil {
+                break
+            }
+            links, err := t.extractLinks(ctx, currentURL, scope)
             if err != nil {
                 stats.Errors++
+                t.emit(ctx, Event{Type: ErrorOccurred, URL: currentURL, Err: err})
                 continue
             }
 
-            // Add new URLs to queue
+            // Add new URLs to queue, unless the budget is spent
+            if t.budgetTracker.exhausted() {
+                break
+            }
             for _, link := range links {
-                if !visited[link] {
-                    visited[link] = true
+                if !visited.testAndAdd(t.normalizer.Fingerprint(link)) {
                     if utils.IsValidURL(link) {
-                        urlQueue <- models.URLPriority{
+                        discovered := models.URLPriority{
                             URL:    link,
                             Depth:  depth + 1,
                             Parent: currentURL,
                         }
+                        urlQueue <- discovered
+                        t.emit(ctx, Event{Type: LinkDiscovered, URL: link, Link: &discovered})
                     }
                 }
             }
@@ -114,11 +257,31 @@ func (t *Traditional) Crawl(ctx context.Context, startURL string, maxDepth int)
     close(urlQueue)
     wg.Wait()
     close(results)
+    <-processed
+    if t.mirror != nil {
+        stats.Mirror = t.mirror.finish()
+    }
 
     stats.Duration = time.Since(start)
+    stats.FilteredURLs = t.urlFilter.Filtered()
+    stats.StopReason = stopReason(ctx, t.budgetTracker)
+    stats.Timing = t.timings.percentiles()
+    t.loads.finish(stats)
+    if err := t.db.FinishCrawl(crawlID, stats); err != nil {
+        t.emit(ctx, Event{Type: ErrorOccurred, URL: startURL, Err: err})
+    }
+    t.emit(ctx, Event{Type: CrawlFinished, URL: startURL, Stats: stats})
     return stats, nil
 }
 
+// Progress returns a snapshot of the running crawl, or of the last one once
+// it has finished. It may be called from any goroutine.
+func (t *Traditional) Progress() models.CrawlProgress {
+    progress := t.progress.snapshot()
+    progress.Paused = t.gate.isPaused()
+    return progress
+}
+
 func (t *Traditional) worker(ctx context.Context, wg *sync.WaitGroup, urlQueue <-chan models.URLPriority, results chan<- crawlResult) {
     defer wg.Done()
 
@@ -127,12 +290,35 @@ func (t *Traditional) worker(ctx context.Context, wg *sync.WaitGroup, urlQueue <
             return
         }
 
+        // Over budget: drain the queue without fetching
+        if t.budgetTracker.exhausted() {
+            continue
+        }
+
         // Rate limiting
         if err := t.limiter.Wait(ctx); err != nil {
             continue
         }
 
-        result := t.crawlPage(ctx, urlPriority)
+        // Held here while the crawl is paused
+        if err := t.gate.wait(ctx); err != nil {
+            continue
+        }
+
+        host := t.progress.begin(urlPriority.URL)
+        pageCtx, span := startPageSpan(ctx, urlPriority)
+        result := t.crawlPage(pageCtx, urlPriority)
+        result.URL = urlPriority.URL
+        result.Span = span.SpanContext()
+        endSpan(span, result.Error)
+        var size int64
+        if result.Page != nil {
+            size = result.Page.Size
+        }
+        t.progress.settle(host, false, result.Error, size)
+        if result.Error == nil {
+            t.budgetTracker.record(result.Page.Size)
+        }
         select {
         case results <- result:
         case <-ctx.Done():
@@ -144,46 +330,92 @@ func (t *Traditional) worker(ctx context.Context, wg *sync.WaitGroup, urlQueue <
 func (t *Traditional) crawlPage(ctx context.Context, urlPriority models.URLPriority) crawlResult {
     start := time.Now()
 
-    req, err := http.NewRequestWithContext(ctx, "GET", urlPriority.URL, nil)
+    fetchCtx, span := tracer.Start(ctx, "fetch")
+    reqCtx, wire := withWireStats(fetchCtx)
+    reqCtx, timer := withFetchTimer(reqCtx)
+    req, err := http.NewRequestWithContext(reqCtx, "GET", urlPriority.URL, nil)
     if err != nil {
+        endSpan(span, err)
         return crawlResult{Error: err}
     }
 
-    req.Header.Set("User-Agent", "SmartCrawler/1.0")
-
     resp, err := t.client.Do(req)
     if err != nil {
+        endSpan(span, err)
         return crawlResult{Error: err}
     }
     defer resp.Body.Close()
 
-    body, err := io.ReadAll(resp.Body)
+    read, err := readBody(resp.Body, t.maxResponseSize, wire)
+    timing := timer.timing()
+    span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+    endSpan(span, err)
     if err != nil {
         return crawlResult{Error: err}
     }
+    body := read.data
 
-    doc, err := goquery.NewDocumentFromReader(strings.NewReader(string(body)))
+    _, span = tracer.Start(ctx, "parse")
+    doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+    endSpan(span, err)
     if err != nil {
         return crawlResult{Error: err}
     }
 
     page := &models.Page{
-        URL:         urlPriority.URL,
-        Title:       doc.Find("title").Text(),
-        Content:     string(body),
-        StatusCode:  resp.StatusCode,
-        ContentType: resp.Header.Get("Content-Type"),
-        Size:        int64(len(body)),
-        LoadTime:    time.Since(start).Milliseconds(),
-        Depth:       urlPriority.Depth,
-        ParentURL:   urlPriority.Parent,
-        Hash:        fmt.Sprintf("%x", md5.Sum(body)),
-    }
-
-    return crawlResult{Page: page}
+        CrawlID:        t.crawlID,
+        CrawlUUID:      t.crawlUUID,
+        URL:            urlPriority.URL,
+        Fingerprint:    t.normalizer.Fingerprint(urlPriority.URL),
+        Title:          doc.Find("title").Text(),
+        Content:        string(body),
+        StatusCode:     resp.StatusCode,
+        ContentType:    resp.Header.Get("Content-Type"),
+        Size:           int64(len(body)),
+        LoadTime:       time.Since(start).Milliseconds(),
+        Depth:          urlPriority.Depth,
+        ParentURL:      urlPriority.Parent,
+        Hash:           read.hash,
+        Truncated:      read.truncated,
+        Encoding:       read.encoding,
+        CompressedSize: read.compressedSize,
+        Protocol:       resp.Proto,
+        Headers:        resp.Header,
+        TLS:            tlsInfo(resp.TLS),
+        Timing:         timing,
+        StructuredData: extractStructuredData(doc, urlPriority.URL),
+        CanonicalURL:   canonicalURL(doc, urlPriority.URL),
+        Extractions:    t.extraction.extract(doc, urlPriority.URL),
+        Images:         t.images.collect(ctx, doc, urlPriority.URL),
+        Body:           body,
+    }
+    if final := resp.Request.URL.String(); final != urlPriority.URL {
+        page.FinalURL = final
+    }
+    applyOpenGraph(page, page.StructuredData)
+    t.spam.classify(doc, urlPriority.URL).apply(page)
+    if t.mirror != nil {
+        t.mirror.savePage(ctx, urlPriority.URL, resp, body, doc)
+    }
+
+    result := crawlResult{Page: page}
+    if t.harvestThreshold > 0 {
+        analyzed := t.harvestAnalyzer.AnalyzeContent(doc, string(body))
+        result.Relevance = analyzed.ContentQuality
+        if t.topic != nil {
+            page.Relevance = t.topic.analyze(topicText(doc))
+            result.Relevance = page.Relevance
+        }
+    }
+    return result
 }
 
-func (t *Traditional) extractLinks(ctx context.Context, pageURL string) ([]string, error) {
+func (t *Traditional) extractLinks(ctx context.Context, pageURL string, scope *scopeFilter) ([]string, error) {
+    // This is a second fetch of the page, so it counts against the rate limit too
+    if err := t.limiter.Wait(ctx); err != nil {
+        return nil, err
+    }
+
     req, err := http.NewRequestWithContext(ctx, "GET", pageURL, nil)
     if err != nil {
         return nil, err
@@ -195,18 +427,40 @@ func (t *Traditional) extractLinks(ctx context.Context, pageURL string) ([]strin
     }
     defer resp.Body.Close()
 
-    doc, err := goquery.NewDocumentFromReader(resp.Body)
+    // Parsed as it streams in, up to the same cap as the page itself
+    var body io.Reader = resp.Body
+    if t.maxResponseSize > 0 {
+        body = io.LimitReader(resp.Body, t.maxResponseSize)
+    }
+    doc, err := goquery.NewDocumentFromReader(body)
     if err != nil {
         return nil, err
     }
+    // Spam is saved, flagged, but leads nowhere worth crawling
+    if t.spam.classify(doc, pageURL).flagged() {
+        return nil, nil
+    }
 
+    // Relative links resolve against where redirects led
+    baseURL := resp.Request.URL.String()
     var links []string
-    doc.Find("a[href]").Each(func(i int, s *goquery.Selection) {
+    linkElements(doc, t.linkSelector).Each(func(i int, s *goquery.Selection) {
         href, exists := s.Attr("href")
-        if exists {
-            if absoluteURL := t.makeAbsoluteURL(pageURL, href); absoluteURL != "" {
-                links = append(links, absoluteURL)
-            }
+        if !exists {
+            return
+        }
+        absoluteURL := t.makeAbsoluteURL(baseURL, href)
+        if absoluteURL == "" {
+            return
+        }
+        // Follow shorteners and tracking redirects so scope applies to the target
+        absoluteURL, err := t.redirects.resolve(ctx, t.client, t.limiter, absoluteURL)
+        if err != nil {
+            t.emit(ctx, Event{Type: ErrorOccurred, URL: pageURL, Err: err})
+        }
+        absoluteURL = t.normalizer.Normalize(absoluteURL)
+        if scope.allows(absoluteURL) && t.urlFilter.Allow(absoluteURL) {
+            links = append(links, absoluteURL)
         }
     })
 
@@ -231,20 +485,54 @@ func (t *Traditional) processResults(ctx context.Context, results <-chan crawlRe
     for result := range results {
         if result.Error != nil {
             stats.Errors++
+            recordHostError(stats, result.URL)
+            t.emit(ctx, Event{Type: ErrorOccurred, URL: result.URL, Err: result.Error})
             continue
         }
 
-        if err := t.db.SavePage(result.Page); err != nil {
+        _, span := startSaveSpan(ctx, []trace.SpanContext{result.Span})
+        err := t.db.SavePage(result.Page)
+        endSpan(span, err)
+        if err != nil {
             stats.Errors++
+            t.emit(ctx, Event{Type: ErrorOccurred, URL: result.URL, Err: err})
             continue
         }
+        if err := applyTagRules(t.db, t.tagRules, result.Page); err != nil {
+            t.emit(ctx, Event{Type: ErrorOccurred, URL: result.URL, Err: err})
+        }
+        if err := saveExtractions(t.db, t.extraction, result.Page); err != nil {
+            t.emit(ctx, Event{Type: ErrorOccurred, URL: result.URL, Err: err})
+        }
+        if err := saveImages(t.db, t.images, result.Page); err != nil {
+            t.emit(ctx, Event{Type: ErrorOccurred, URL: result.URL, Err: err})
+        }
+        if err := t.sinks.publish(ctx, result.Page); err != nil {
+            t.emit(ctx, Event{Type: ErrorOccurred, URL: result.URL, Err: err})
+        }
+        t.emit(ctx, Event{Type: PageCrawled, URL: result.URL, Page: result.Page})
 
         stats.PagesProcessed++
         stats.TotalSize += result.Page.Size
+        if result.Page.Truncated {
+            stats.PagesTruncated++
+        }
+        if result.Page.Spam {
+            stats.PagesSpam++
+        }
+        recordProtocol(stats, result.Page)
+        recordPage(stats, result.Page)
+        recordHostPage(stats, result.Page)
+        recordHarvest(stats, t.harvestThreshold, result.Relevance)
+        t.timings.add(result.Page)
+        t.loads.add(result.Page)
     }
 }
 
 type crawlResult struct {
-    Page  *models.Page
-    Error error
+    URL       string
+    Page      *models.Page
+    Error     error
+    Span      trace.SpanContext // The page's trace, which its save links to
+    Relevance float64           // For the harvest rate, when it is tracked
 }
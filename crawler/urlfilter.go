@@ -0,0 +1,162 @@
+package crawler
+
+import (
+    "errors"
+    "fmt"
+    "net/url"
+    "regexp"
+    "strings"
+    "sync"
+)
+
+// notIncluded is the count key for URLs that matched none of the include rules
+const notIncluded = "include (no match)"
+
+// notAllowlisted is the count key for URLs on no allowlisted domain
+const notAllowlisted = "allowlist (no match)"
+
+// URLFilter gates which discovered URLs are enqueued. A URL passes if its
+// host passes the domain lists, and it matches at least one include rule
+// (or there are none) and no exclude rule. It counts what each rule and
+// list filtered so patterns can be tuned.
+type URLFilter struct {
+    include []*regexp.Regexp
+    exclude []*regexp.Regexp
+
+    allowlist *DomainList // nil or empty allows every domain
+    blocklist *DomainList
+
+    mutex    sync.Mutex
+    filtered map[string]int
+}
+
+func NewURLFilter(include, exclude []string) (*URLFilter, error) {
+    f := &URLFilter{filtered: make(map[string]int)}
+
+    for _, pattern := range include {
+        re, err := regexp.Compile(pattern)
+        if err != nil {
+            return nil, fmt.Errorf("invalid include pattern %q: %w", pattern, err)
+        }
+        f.include = append(f.include, re)
+    }
+    for _, pattern := range exclude {
+        re, err := regexp.Compile(pattern)
+        if err != nil {
+            return nil, fmt.Errorf("invalid exclude pattern %q: %w", pattern, err)
+        }
+        f.exclude = append(f.exclude, re)
+    }
+
+    return f, nil
+}
+
+// WithURLFilter gates discovered URLs with filter's rules. What each rule
+// filtered is reported in CrawlStats.FilteredURLs.
+func WithURLFilter(filter *URLFilter) Option {
+    return func(o *options) error {
+        if filter == nil {
+            return errors.New("URL filter must not be nil")
+        }
+        o.urlFilter = filter
+        return nil
+    }
+}
+
+// SplitPatterns splits a ";" separated pattern list as used in the config
+func SplitPatterns(s string) []string {
+    var patterns []string
+    for _, pattern := range strings.Split(s, ";") {
+        if pattern = strings.TrimSpace(pattern); pattern != "" {
+            patterns = append(patterns, pattern)
+        }
+    }
+    return patterns
+}
+
+// SetDomainLists only lets through URLs whose host is on allowlist, or
+// under one of its domains, and none of blocklist's. When both lists match a
+// host, the more specific domain decides, so allowing cdn.example.com lets
+// it through a block of example.com, and the other way round. An empty or
+// nil allowlist allows every domain.
+func (f *URLFilter) SetDomainLists(allowlist, blocklist *DomainList) {
+    f.allowlist, f.blocklist = allowlist, blocklist
+}
+
+func (f *URLFilter) Allow(url string) bool {
+    if f == nil {
+        return true
+    }
+
+    if !f.allowDomain(url) {
+        return false
+    }
+    for _, re := range f.exclude {
+        if re.MatchString(url) {
+            f.count("exclude " + re.String())
+            return false
+        }
+    }
+
+    if len(f.include) == 0 {
+        return true
+    }
+    for _, re := range f.include {
+        if re.MatchString(url) {
+            return true
+        }
+    }
+    f.count(notIncluded)
+    return false
+}
+
+// allowDomain checks the host of rawURL against the domain lists, counting
+// what they filter. URLs without a host are left to the other rules.
+func (f *URLFilter) allowDomain(rawURL string) bool {
+    if f.allowlist.Len() == 0 && f.blocklist.Len() == 0 {
+        return true
+    }
+    u, err := url.Parse(rawURL)
+    if err != nil || u.Host == "" {
+        return true
+    }
+    host := domainKey(u.Hostname())
+
+    _, allowed, onAllowlist := f.allowlist.match(host)
+    if f.allowlist.Len() > 0 && !onAllowlist {
+        f.count(notAllowlisted)
+        return false
+    }
+    if list, blocked, onBlocklist := f.blocklist.match(host); onBlocklist && blocked > allowed {
+        f.count("blocklist " + list)
+        return false
+    }
+    return true
+}
+
+func (f *URLFilter) count(rule string) {
+    f.mutex.Lock()
+    f.filtered[rule]++
+    f.mutex.Unlock()
+}
+
+// Filtered returns how many URLs each rule has rejected so far, keyed by
+// "exclude <pattern>", "include (no match)", "blocklist <list>", or
+// "allowlist (no match)"
+func (f *URLFilter) Filtered() map[string]int {
+    if f == nil {
+        return nil
+    }
+
+    f.mutex.Lock()
+    defer f.mutex.Unlock()
+
+    if len(f.filtered) == 0 {
+        return nil
+    }
+    counts := make(map[string]int, len(f.filtered))
+    for rule, n := range f.filtered {
+        counts[rule] = n
+    }
+    return counts
+}
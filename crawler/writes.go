@@ -0,0 +1,101 @@
+package crawler
+
+import (
+    "context"
+    "fmt"
+    "time"
+
+    "go.opentelemetry.io/otel/attribute"
+    "go.opentelemetry.io/otel/codes"
+    "go.opentelemetry.io/otel/trace"
+
+    "smart-crawler/models"
+)
+
+// DefaultWriteBatch is how many fetched pages the smart crawler buffers
+// before saving them together
+const DefaultWriteBatch = 50
+
+// DefaultWriteFlushInterval is how long a fetched page may wait in the
+// buffer before it is saved anyway
+const DefaultWriteFlushInterval = 500 * time.Millisecond
+
+// pendingWrite is a fetched page waiting in the write-behind buffer
+type pendingWrite struct {
+    result  smartCrawlResult
+    history *models.RevisitHistory // Set for a revisit
+    change  *models.PageChange     // Set for a changed revisit with a change monitor
+}
+
+// SetWriteBatch buffers up to size fetched pages and saves them, with their
+// links, in one transaction, rather than a round trip per page. A page waits
+// at most interval; the buffer is also saved before each checkpoint and when
+// the crawl stops. A size of 1 saves each page as it arrives.
+func (s *Smart) SetWriteBatch(size int, interval time.Duration) {
+    s.writeBatch = max(size, 1)
+    s.writeFlushInterval = interval
+}
+
+// flushWrites saves the buffered pages and finishes processing them. If the
+// batch fails, its pages are saved one at a time, so only the pages that
+// cannot be saved are lost.
+func (s *Smart) flushWrites(ctx context.Context, pending []pendingWrite, stats *models.CrawlStats) {
+    if len(pending) == 0 {
+        return
+    }
+    writes := make([]models.PageWrite, len(pending))
+    pages := make([]trace.SpanContext, len(pending))
+    for i, write := range pending {
+        writes[i] = models.PageWrite{Page: write.result.Page, Links: pageLinks(write.result)}
+        pages[i] = write.result.Span
+    }
+    ctx, span := startSaveSpan(ctx, pages)
+    defer span.End()
+
+    if len(writes) > 1 {
+        err := s.db.SavePages(writes)
+        if err == nil {
+            for _, write := range pending {
+                s.pageSaved(ctx, write, stats)
+            }
+            return
+        }
+        // Retried below a page at a time
+        span.RecordError(err)
+    }
+    var failed int
+    for i, write := range pending {
+        if err := s.db.SavePages(writes[i : i+1]); err != nil {
+            failed++
+            span.RecordError(err, trace.WithAttributes(attribute.String("url.full", write.result.URL)))
+            stats.Errors++
+            s.emit(ctx, Event{Type: ErrorOccurred, URL: write.result.URL, Err: err})
+            continue
+        }
+        s.pageSaved(ctx, write, stats)
+    }
+    if failed > 0 {
+        span.SetStatus(codes.Error, fmt.Sprintf("%d of %d pages not saved", failed, len(pending)))
+    }
+}
+
+// pageLinks returns the links to record for a page, with the text around
+// them and the classes they are styled with, or nil when it has none
+func pageLinks(result smartCrawlResult) []models.Link {
+    if len(result.Links) == 0 {
+        return nil
+    }
+    links := make([]models.Link, len(result.Links))
+    for i, link := range result.Links {
+        links[i] = models.Link{
+            URL:     link.URL,
+            Anchor:  link.LinkContext.Anchor,
+            Rel:     link.LinkContext.Rel,
+            Before:  link.LinkContext.Before,
+            After:   link.LinkContext.After,
+            Heading: link.LinkContext.Heading,
+            Classes: link.LinkContext.Classes,
+        }
+    }
+    return links
+}
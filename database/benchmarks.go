@@ -0,0 +1,82 @@
+package database
+
+import (
+    "database/sql"
+    "encoding/json"
+    "fmt"
+
+    "smart-crawler/models"
+)
+
+// benchmarkQuery selects stored benchmark results, newest first, with an
+// optional limit
+func benchmarkQuery(limit int) (string, []interface{}) {
+    query := "SELECT id, ran_at, label, config, crawlers FROM benchmark_results ORDER BY ran_at DESC, id DESC"
+    if limit > 0 {
+        return query + " LIMIT $1", []interface{}{limit}
+    }
+    return query, nil
+}
+
+// encodeBenchmarkResult encodes a result's configuration and crawlers for
+// their JSON columns
+func encodeBenchmarkResult(result *models.BenchmarkResult) (string, string, error) {
+    config, err := json.Marshal(result.Config)
+    if err != nil {
+        return "", "", err
+    }
+    crawlers, err := json.Marshal(result.Crawlers)
+    if err != nil {
+        return "", "", err
+    }
+    return string(config), string(crawlers), nil
+}
+
+func scanBenchmarkResults(rows *sql.Rows) ([]models.BenchmarkResult, error) {
+    defer rows.Close()
+
+    var results []models.BenchmarkResult
+    for rows.Next() {
+        var result models.BenchmarkResult
+        var label sql.NullString
+        var config, crawlers string
+        if err := rows.Scan(&result.ID, &result.RanAt, &label, &config, &crawlers); err != nil {
+            return nil, err
+        }
+        result.Label = label.String
+        if err := json.Unmarshal([]byte(config), &result.Config); err != nil {
+            return nil, fmt.Errorf("benchmark result %d has a malformed config: %w", result.ID, err)
+        }
+        if err := json.Unmarshal([]byte(crawlers), &result.Crawlers); err != nil {
+            return nil, fmt.Errorf("benchmark result %d has malformed crawlers: %w", result.ID, err)
+        }
+        results = append(results, result)
+    }
+    return results, rows.Err()
+}
+
+// SaveBenchmarkResult stores a benchmark's result, setting its ID and the
+// time it was stored, and returns the ID
+func (p *PostgresDB) SaveBenchmarkResult(result *models.BenchmarkResult) (int64, error) {
+    config, crawlers, err := encodeBenchmarkResult(result)
+    if err != nil {
+        return 0, err
+    }
+    err = p.DB.QueryRow(`
+        INSERT INTO benchmark_results (label, config, crawlers)
+        VALUES (NULLIF($1, ''), $2, $3)
+        RETURNING id, ran_at
+    `, result.Label, config, crawlers).Scan(&result.ID, &result.RanAt)
+    return result.ID, err
+}
+
+// BenchmarkResults returns stored benchmark results, newest first, at most
+// limit of them unless limit is 0
+func (p *PostgresDB) BenchmarkResults(limit int) ([]models.BenchmarkResult, error) {
+    query, args := benchmarkQuery(limit)
+    rows, err := p.DB.Query(query, args...)
+    if err != nil {
+        return nil, err
+    }
+    return scanBenchmarkResults(rows)
+}
@@ -0,0 +1,309 @@
+package database
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "fmt"
+
+    "github.com/klauspost/compress/zstd"
+
+    "smart-crawler/blobstore"
+    "smart-crawler/models"
+)
+
+// Encodings of page_bodies rows. Rows written before compression have none
+// and, like identity rows, keep their body in content.
+const (
+    bodyZstd     = "zstd"
+    bodyIdentity = "identity" // Stored as is, as compression did not make it smaller
+)
+
+// EncodeAll and DecodeAll are safe for concurrent use
+var (
+    bodyEncoder, _ = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedDefault))
+    bodyDecoder, _ = zstd.NewReader(nil)
+)
+
+// encodeBody compresses a page body for storage. It returns the encoding
+// and either the plain content or the compressed bytes.
+func encodeBody(content string) (string, interface{}, []byte) {
+    compressed := bodyEncoder.EncodeAll([]byte(content), nil)
+    if len(compressed) >= len(content) {
+        return bodyIdentity, content, nil
+    }
+    return bodyZstd, nil, compressed
+}
+
+// SetBlobStore writes page bodies saved from now on to blobs instead of
+// page_bodies, which then only keeps their key. Bodies already stored stay
+// where they are and are read from there.
+func (p *PostgresDB) SetBlobStore(blobs blobstore.Store) {
+    p.blobs = blobs
+}
+
+// BlobStore returns the blob store page bodies are written to, or nil if
+// they stay in the database
+func (p *PostgresDB) BlobStore() blobstore.Store {
+    return p.blobs
+}
+
+// readBody returns the body of a page_bodies row, from the blob store when
+// it is kept there
+func (p *PostgresDB) readBody(encoding, content sql.NullString, compressed []byte, blobKey sql.NullString) (string, error) {
+    if blobKey.Valid {
+        if p.blobs == nil {
+            return "", fmt.Errorf("page body is in blob %s, but no blob store is configured", blobKey.String)
+        }
+        data, err := p.blobs.Get(context.Background(), blobKey.String)
+        if errors.Is(err, blobstore.ErrNotFound) {
+            return "", fmt.Errorf("page body blob %s is missing from %s", blobKey.String, p.blobs)
+        }
+        if err != nil {
+            return "", fmt.Errorf("failed to read page body blob: %w", err)
+        }
+        if encoding.String != bodyZstd {
+            return string(data), nil
+        }
+        compressed = data
+    }
+    if encoding.String != bodyZstd {
+        return content.String, nil
+    }
+    body, err := bodyDecoder.DecodeAll(compressed, nil)
+    if err != nil {
+        return "", fmt.Errorf("failed to decompress page body: %w", err)
+    }
+    return string(body), nil
+}
+
+// storeBodies writes the bodies of pages keyed by their content hash,
+// compressed with zstd. Identical bodies are stored once no matter how many
+// URLs serve them. With a blob store, a body is uploaded when its row is
+// first inserted, and a failed upload rolls the save back.
+func (p *PostgresDB) storeBodies(tx *sql.Tx, pages []*models.Page) error {
+    query := `
+        INSERT INTO page_bodies (hash, content, compressed_content, content_encoding, size)
+        VALUES ($1, $2, $3, $4, $5)
+        ON CONFLICT (hash) DO NOTHING
+    `
+    if p.blobs != nil {
+        query = `
+            INSERT INTO page_bodies (hash, blob_key, content_encoding, size)
+            VALUES ($1, $2, $3, $4)
+            ON CONFLICT (hash) DO NOTHING
+        `
+    }
+    stmt, err := tx.Prepare(query)
+    if err != nil {
+        return fmt.Errorf("failed to store page body: %w", err)
+    }
+    defer stmt.Close()
+
+    stored := make(map[string]bool, len(pages))
+    for _, page := range pages {
+        if stored[page.Hash] {
+            continue
+        }
+        stored[page.Hash] = true
+        if err := p.storeBody(stmt, page.Hash, page.Content); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func (p *PostgresDB) storeBody(stmt *sql.Stmt, hash, content string) error {
+    encoding, plain, compressed := encodeBody(content)
+    if p.blobs == nil {
+        if _, err := stmt.Exec(hash, plain, compressed, encoding, len(content)); err != nil {
+            return fmt.Errorf("failed to store page body: %w", err)
+        }
+        return nil
+    }
+
+    data, ext := compressed, "zst"
+    if encoding != bodyZstd {
+        data, ext = []byte(content), ""
+    }
+    key := blobstore.BodyKey(hash, ext)
+    result, err := stmt.Exec(hash, key, encoding, len(content))
+    if err != nil {
+        return fmt.Errorf("failed to store page body: %w", err)
+    }
+    if inserted, _ := result.RowsAffected(); inserted == 0 {
+        return nil
+    }
+    if err := p.blobs.Put(context.Background(), key, data); err != nil {
+        return fmt.Errorf("failed to store page body in %s: %w", p.blobs, err)
+    }
+    return nil
+}
+
+// refreshBodyRefs recounts references for the given hashes and drops bodies
+// that are no longer referenced. Recounting rather than incrementing keeps
+// ref_count correct even when concurrent saves race on the same URL. It
+// returns the blob keys of the dropped bodies, for deleteBlobs once the
+// transaction commits.
+func refreshBodyRefs(tx *sql.Tx, hashes ...string) ([]string, error) {
+    var orphans []string
+    for _, hash := range hashes {
+        if hash == "" {
+            continue
+        }
+
+        _, err := tx.Exec(`
+            UPDATE page_bodies
+            SET ref_count = (SELECT COUNT(*) FROM pages WHERE pages.hash = page_bodies.hash)
+            WHERE hash = $1
+        `, hash)
+        if err != nil {
+            return nil, fmt.Errorf("failed to update body references: %w", err)
+        }
+
+        var blobKey sql.NullString
+        err = tx.QueryRow("DELETE FROM page_bodies WHERE hash = $1 AND ref_count = 0 RETURNING blob_key", hash).Scan(&blobKey)
+        if err != nil && err != sql.ErrNoRows {
+            return nil, fmt.Errorf("failed to delete unreferenced body: %w", err)
+        }
+        if blobKey.Valid {
+            orphans = append(orphans, blobKey.String)
+        }
+    }
+
+    return orphans, nil
+}
+
+// deleteBlobs removes the blobs of bodies no page references anymore. A
+// blob that fails to delete only costs space, so errors are not returned.
+func (p *PostgresDB) deleteBlobs(keys []string) {
+    if p.blobs == nil {
+        return
+    }
+    for _, key := range keys {
+        p.blobs.Delete(context.Background(), key)
+    }
+}
+
+// GetPageContent returns the stored body of a page
+func (p *PostgresDB) GetPageContent(pageID int64) (string, error) {
+    var encoding, content, blobKey sql.NullString
+    var compressed []byte
+    err := p.DB.QueryRow(`
+        SELECT b.content_encoding, COALESCE(b.content, p.content), b.compressed_content, b.blob_key
+        FROM pages p
+        LEFT JOIN page_bodies b ON b.hash = p.hash
+        WHERE p.id = $1
+    `, pageID).Scan(&encoding, &content, &compressed, &blobKey)
+    if err != nil {
+        return "", err
+    }
+    return p.readBody(encoding, content, compressed, blobKey)
+}
+
+// CompressBodies compresses the page bodies stored before compression,
+// batchSize rows per transaction, so a large database is migrated without
+// holding locks for long. It returns how many bodies it rewrote and their
+// size before and after.
+func (p *PostgresDB) CompressBodies(batchSize int) (*models.BodyStorage, error) {
+    report := &models.BodyStorage{}
+    for {
+        n, err := p.compressBodyBatch(batchSize, report)
+        if err != nil {
+            return report, err
+        }
+        if n == 0 {
+            return report, nil
+        }
+    }
+}
+
+func (p *PostgresDB) compressBodyBatch(batchSize int, report *models.BodyStorage) (int, error) {
+    tx, err := p.DB.Begin()
+    if err != nil {
+        return 0, err
+    }
+    defer tx.Rollback()
+
+    rows, err := tx.Query(`
+        SELECT hash, COALESCE(content, '')
+        FROM page_bodies
+        WHERE content_encoding IS NULL
+        LIMIT $1
+        FOR UPDATE SKIP LOCKED
+    `, batchSize)
+    if err != nil {
+        return 0, err
+    }
+    bodies := make(map[string]string)
+    for rows.Next() {
+        var hash, content string
+        if err := rows.Scan(&hash, &content); err != nil {
+            rows.Close()
+            return 0, err
+        }
+        bodies[hash] = content
+    }
+    rows.Close()
+    if err := rows.Err(); err != nil {
+        return 0, err
+    }
+
+    for hash, content := range bodies {
+        encoding, plain, compressed := encodeBody(content)
+        _, err := tx.Exec(`
+            UPDATE page_bodies SET content = $2, compressed_content = $3, content_encoding = $4
+            WHERE hash = $1
+        `, hash, plain, compressed, encoding)
+        if err != nil {
+            return 0, err
+        }
+        report.Bodies++
+        report.Size += int64(len(content))
+        if compressed != nil {
+            report.StoredSize += int64(len(compressed))
+        } else {
+            report.StoredSize += int64(len(content))
+        }
+    }
+    return len(bodies), tx.Commit()
+}
+
+// BodyStorage reports how much space the distinct bodies of a crawl
+// session's pages take in page_bodies, against their uncompressed size
+func (p *PostgresDB) BodyStorage(crawlID int64) (*models.BodyStorage, error) {
+    report := &models.BodyStorage{}
+    err := p.DB.QueryRow(`
+        SELECT COUNT(*), COALESCE(SUM(size), 0),
+               COALESCE(SUM(COALESCE(octet_length(compressed_content), octet_length(content), 0)), 0)
+        FROM page_bodies
+        WHERE hash IN (SELECT hash FROM pages WHERE crawl_id = $1)
+    `, crawlID).Scan(&report.Bodies, &report.Size, &report.StoredSize)
+    return report, err
+}
+
+// DeletePage removes a page and releases its reference on the shared body
+func (p *PostgresDB) DeletePage(pageID int64) error {
+    tx, err := p.DB.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    var hash sql.NullString
+    err = tx.QueryRow("DELETE FROM pages WHERE id = $1 RETURNING hash", pageID).Scan(&hash)
+    if err != nil {
+        return err
+    }
+
+    orphans, err := refreshBodyRefs(tx, hash.String)
+    if err != nil {
+        return err
+    }
+
+    if err := tx.Commit(); err != nil {
+        return err
+    }
+    p.deleteBlobs(orphans)
+    return nil
+}
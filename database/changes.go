@@ -0,0 +1,92 @@
+package database
+
+import (
+    "database/sql"
+
+    "smart-crawler/models"
+)
+
+// savePageChange records a change a revisit found and sets its id and
+// detection time; both stores share the SQL
+func savePageChange(db *sql.DB, change *models.PageChange) error {
+    return db.QueryRow(`
+        INSERT INTO page_changes (page_id, crawl_id, url, previous_hash, hash, added, removed, diff)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+        RETURNING id, detected_at
+    `, change.PageID, change.CrawlID, change.URL, change.PreviousHash, change.Hash,
+        change.Added, change.Removed, change.Diff).Scan(&change.ID, &change.DetectedAt)
+}
+
+// GetSavedContent returns the hash and body of the page saved at url, which
+// a revisit compares the page it fetched against
+func (p *PostgresDB) GetSavedContent(crawlID int64, url string) (string, string, error) {
+    var hash, encoding, content, blobKey sql.NullString
+    var compressed []byte
+    err := p.DB.QueryRow(`
+        SELECT p.hash, b.content_encoding, COALESCE(b.content, p.content), b.compressed_content, b.blob_key
+        FROM pages p
+        LEFT JOIN page_bodies b ON b.hash = p.hash
+        WHERE p.crawl_id = $1 AND p.url = $2
+    `, crawlID, url).Scan(&hash, &encoding, &content, &compressed, &blobKey)
+    if err != nil {
+        return "", "", err
+    }
+    body, err := p.readBody(encoding, content, compressed, blobKey)
+    return hash.String, body, err
+}
+
+// SavePageChange records a change a revisit found in a page
+func (p *PostgresDB) SavePageChange(change *models.PageChange) error {
+    return savePageChange(p.DB, change)
+}
+
+const pageChangeColumns = `c.id, c.page_id, c.crawl_id, c.url, COALESCE(p.title, ''), COALESCE(c.previous_hash, ''),
+    COALESCE(c.hash, ''), c.added, c.removed, c.diff, c.detected_at`
+
+// ListPageChanges returns the changes revisits found in a crawl session's
+// pages, after the one with id afterID in the order they were found
+func (p *PostgresDB) ListPageChanges(crawlID int64, afterID int64, limit int) ([]models.PageChange, error) {
+    rows, err := p.DB.Query(`
+        SELECT `+pageChangeColumns+`
+        FROM page_changes c
+        LEFT JOIN pages p ON p.id = c.page_id
+        WHERE c.crawl_id = $1 AND c.id > $2
+        ORDER BY c.id
+        LIMIT $3
+    `, crawlID, afterID, limit)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+    return scanPageChanges(rows)
+}
+
+// GetPageChanges returns the changes revisits found in a page, newest first
+func (p *PostgresDB) GetPageChanges(pageID int64) ([]models.PageChange, error) {
+    rows, err := p.DB.Query(`
+        SELECT `+pageChangeColumns+`
+        FROM page_changes c
+        LEFT JOIN pages p ON p.id = c.page_id
+        WHERE c.page_id = $1
+        ORDER BY c.id DESC
+    `, pageID)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+    return scanPageChanges(rows)
+}
+
+func scanPageChanges(rows *sql.Rows) ([]models.PageChange, error) {
+    changes := []models.PageChange{}
+    for rows.Next() {
+        var change models.PageChange
+        err := rows.Scan(&change.ID, &change.PageID, &change.CrawlID, &change.URL, &change.Title,
+            &change.PreviousHash, &change.Hash, &change.Added, &change.Removed, &change.Diff, &change.DetectedAt)
+        if err != nil {
+            return nil, err
+        }
+        changes = append(changes, change)
+    }
+    return changes, rows.Err()
+}
@@ -0,0 +1,144 @@
+package database
+
+import (
+    "database/sql"
+
+    "github.com/google/uuid"
+
+    "smart-crawler/models"
+)
+
+// CreateCrawl starts a new crawl session and returns its id and UUID
+func (p *PostgresDB) CreateCrawl(mode, startURL string, maxDepth int) (int64, string, error) {
+    var id int64
+    crawlUUID := uuid.NewString()
+    err := p.DB.QueryRow(`
+        INSERT INTO crawls (uuid, mode, start_url, max_depth)
+        VALUES ($1, $2, $3, $4)
+        RETURNING id
+    `, crawlUUID, mode, startURL, maxDepth).Scan(&id)
+    return id, crawlUUID, err
+}
+
+// GetCrawlUUID returns the UUID of a crawl session, or sql.ErrNoRows if it
+// does not exist
+func (p *PostgresDB) GetCrawlUUID(id int64) (string, error) {
+    var crawlUUID string
+    err := p.DB.QueryRow("SELECT uuid FROM crawls WHERE id = $1", id).Scan(&crawlUUID)
+    return crawlUUID, err
+}
+
+// FinishCrawl records the final stats of a crawl session
+func (p *PostgresDB) FinishCrawl(id int64, stats *models.CrawlStats) error {
+    _, err := p.DB.Exec(`
+        UPDATE crawls SET
+            finished_at = CURRENT_TIMESTAMP,
+            pages_processed = $2,
+            pages_skipped = $3,
+            errors = $4,
+            total_size = $5,
+            stop_reason = $6
+        WHERE id = $1
+    `, id, stats.PagesProcessed, stats.PagesSkipped, stats.Errors, stats.TotalSize, stats.StopReason)
+    return err
+}
+
+const crawlColumns = `id, uuid, mode, start_url, max_depth, started_at, finished_at, pages_processed, pages_skipped, errors, total_size, stop_reason`
+
+func scanCrawl(row interface{ Scan(...interface{}) error }) (*models.Crawl, error) {
+    var crawl models.Crawl
+    var finishedAt sql.NullTime
+    var stopReason sql.NullString
+    err := row.Scan(&crawl.ID, &crawl.UUID, &crawl.Mode, &crawl.StartURL, &crawl.MaxDepth, &crawl.StartedAt, &finishedAt,
+        &crawl.Stats.PagesProcessed, &crawl.Stats.PagesSkipped, &crawl.Stats.Errors, &crawl.Stats.TotalSize, &stopReason)
+    if err != nil {
+        return nil, err
+    }
+
+    crawl.Stats.CrawlID = crawl.ID
+    crawl.Stats.CrawlUUID = crawl.UUID
+    crawl.Stats.StopReason = stopReason.String
+    if finishedAt.Valid {
+        crawl.FinishedAt = &finishedAt.Time
+        crawl.Stats.Duration = finishedAt.Time.Sub(crawl.StartedAt)
+    }
+    return &crawl, nil
+}
+
+// GetCrawl returns a crawl session, or sql.ErrNoRows if it does not exist
+func (p *PostgresDB) GetCrawl(id int64) (*models.Crawl, error) {
+    return scanCrawl(p.DB.QueryRow("SELECT "+crawlColumns+" FROM crawls WHERE id = $1", id))
+}
+
+// GetCrawlByUUID returns a crawl session by its UUID, or sql.ErrNoRows if
+// it does not exist
+func (p *PostgresDB) GetCrawlByUUID(crawlUUID string) (*models.Crawl, error) {
+    return scanCrawl(p.DB.QueryRow("SELECT "+crawlColumns+" FROM crawls WHERE uuid = $1", crawlUUID))
+}
+
+// ListCrawls returns crawl sessions, newest first
+func (p *PostgresDB) ListCrawls(limit int) ([]models.Crawl, error) {
+    rows, err := p.DB.Query("SELECT "+crawlColumns+" FROM crawls ORDER BY id DESC LIMIT $1", limit)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    crawls := []models.Crawl{}
+    for rows.Next() {
+        crawl, err := scanCrawl(rows)
+        if err != nil {
+            return nil, err
+        }
+        crawls = append(crawls, *crawl)
+    }
+
+    return crawls, rows.Err()
+}
+
+// DeleteCrawl removes a crawl session with its pages, links, and queue, and
+// releases the pages' references on shared bodies.
+func (p *PostgresDB) DeleteCrawl(id int64) error {
+    tx, err := p.DB.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    rows, err := tx.Query("SELECT DISTINCT hash FROM pages WHERE crawl_id = $1 AND hash IS NOT NULL", id)
+    if err != nil {
+        return err
+    }
+    var hashes []string
+    for rows.Next() {
+        var hash string
+        if err := rows.Scan(&hash); err != nil {
+            rows.Close()
+            return err
+        }
+        hashes = append(hashes, hash)
+    }
+    rows.Close()
+    if err := rows.Err(); err != nil {
+        return err
+    }
+
+    result, err := tx.Exec("DELETE FROM crawls WHERE id = $1", id)
+    if err != nil {
+        return err
+    }
+    if n, _ := result.RowsAffected(); n == 0 {
+        return sql.ErrNoRows
+    }
+
+    orphans, err := refreshBodyRefs(tx, hashes...)
+    if err != nil {
+        return err
+    }
+
+    if err := tx.Commit(); err != nil {
+        return err
+    }
+    p.deleteBlobs(orphans)
+    return nil
+}
@@ -0,0 +1,82 @@
+package database
+
+import (
+    "database/sql"
+    "time"
+
+    "smart-crawler/models"
+)
+
+// FailURL records a failed fetch of a claimed URL. The URL is queued again
+// once a backoff has passed, doubling with each failure, until it has
+// failed maxAttempts times; then it is marked failed with its last error
+// and left for RequeueFailed. It reports whether the URL was dead-lettered.
+// URLs that are not in the crawl's queue are ignored.
+func (p *PostgresDB) FailURL(crawlID int64, url, message string, maxAttempts int, backoff time.Duration) (bool, error) {
+    var status string
+    err := p.DB.QueryRow(`
+        UPDATE crawl_queue SET
+            attempts = COALESCE(attempts, 0) + 1,
+            last_error = $3,
+            status = CASE WHEN COALESCE(attempts, 0) + 1 >= $4 THEN 'failed' ELSE 'pending' END,
+            retry_at = CURRENT_TIMESTAMP + $5 * POWER(2, COALESCE(attempts, 0)) * INTERVAL '1 second'
+        WHERE crawl_id = $1 AND url = $2
+        RETURNING status
+    `, crawlID, url, message, maxAttempts, backoff.Seconds()).Scan(&status)
+    if err == sql.ErrNoRows {
+        return false, nil
+    }
+    return status == "failed", err
+}
+
+// HasPendingRetries reports whether failed URLs of a crawl are waiting out
+// their backoff
+func (p *PostgresDB) HasPendingRetries(crawlID int64) (bool, error) {
+    var pending bool
+    err := p.DB.QueryRow(`
+        SELECT EXISTS (
+            SELECT 1 FROM crawl_queue
+            WHERE crawl_id = $1 AND status = 'pending' AND retry_at > CURRENT_TIMESTAMP
+        )
+    `, crawlID).Scan(&pending)
+    return pending, err
+}
+
+// GetFailedURLs lists the dead-lettered URLs of a crawl, or of every crawl
+// when crawlID is 0, most recently failed first
+func (p *PostgresDB) GetFailedURLs(crawlID int64) ([]models.FailedURL, error) {
+    rows, err := p.DB.Query(`
+        SELECT crawl_id, url, COALESCE(attempts, 0), COALESCE(last_error, ''), COALESCE(last_attempt, scheduled_at)
+        FROM crawl_queue
+        WHERE status = 'failed' AND ($1 = 0 OR crawl_id = $1)
+        ORDER BY last_attempt DESC, id
+    `, crawlID)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var failed []models.FailedURL
+    for rows.Next() {
+        var url models.FailedURL
+        if err := rows.Scan(&url.CrawlID, &url.URL, &url.Attempts, &url.LastError, &url.LastAttempt); err != nil {
+            return nil, err
+        }
+        failed = append(failed, url)
+    }
+    return failed, rows.Err()
+}
+
+// RequeueFailed makes the dead-lettered URLs of a crawl pending again with
+// a fresh retry budget, and returns how many there were
+func (p *PostgresDB) RequeueFailed(crawlID int64) (int, error) {
+    result, err := p.DB.Exec(`
+        UPDATE crawl_queue SET status = 'pending', attempts = 0, retry_at = NULL, last_error = NULL
+        WHERE crawl_id = $1 AND status = 'failed'
+    `, crawlID)
+    if err != nil {
+        return 0, err
+    }
+    requeued, err := result.RowsAffected()
+    return int(requeued), err
+}
@@ -0,0 +1,1098 @@
+//go:build duckdb
+
+package database
+
+import (
+    "database/sql"
+    "fmt"
+    "strings"
+    "time"
+
+    "github.com/google/uuid"
+    _ "github.com/marcboeker/go-duckdb"
+
+    "smart-crawler/models"
+)
+
+// DuckDB stores crawls in a local DuckDB file, for crawling then analyzing
+// with DuckDB's SQL (or exporting with COPY ... TO 'pages.parquet') without
+// running a Postgres server. Bodies are stored inline in pages rather than
+// deduplicated, keeping page writes plain appends.
+type DuckDB struct {
+    DB            *sql.DB
+    schemaVersion int // Found before createTables migrated it
+}
+
+func NewDuckDB(path string) (Store, error) {
+    db, err := sql.Open("duckdb", path)
+    if err != nil {
+        return nil, fmt.Errorf("failed to open duckdb: %w", err)
+    }
+
+    // DuckDB is embedded and has a single writer; one connection avoids
+    // transaction conflicts between workers
+    db.SetMaxOpenConns(1)
+
+    duck := &DuckDB{DB: db}
+    if err := duck.createTables(); err != nil {
+        db.Close()
+        return nil, fmt.Errorf("failed to create tables: %w", err)
+    }
+
+    return duck, nil
+}
+
+func (d *DuckDB) createTables() error {
+    var err error
+    if d.schemaVersion, err = checkSchemaVersion(d.DB); err != nil {
+        return err
+    }
+
+    queries := []string{
+        `CREATE SEQUENCE IF NOT EXISTS crawls_id_seq`,
+        `CREATE SEQUENCE IF NOT EXISTS pages_id_seq`,
+        `CREATE SEQUENCE IF NOT EXISTS links_id_seq`,
+        `CREATE SEQUENCE IF NOT EXISTS benchmark_results_id_seq`,
+        `CREATE SEQUENCE IF NOT EXISTS extractions_id_seq`,
+        `CREATE SEQUENCE IF NOT EXISTS images_id_seq`,
+        `CREATE SEQUENCE IF NOT EXISTS page_changes_id_seq`,
+        `CREATE TABLE IF NOT EXISTS crawls (
+            id BIGINT PRIMARY KEY DEFAULT nextval('crawls_id_seq'),
+            uuid VARCHAR,
+            mode VARCHAR NOT NULL,
+            start_url VARCHAR NOT NULL,
+            max_depth INTEGER,
+            started_at TIMESTAMP DEFAULT current_timestamp,
+            finished_at TIMESTAMP,
+            pages_processed INTEGER DEFAULT 0,
+            pages_skipped INTEGER DEFAULT 0,
+            errors INTEGER DEFAULT 0,
+            total_size BIGINT DEFAULT 0,
+            stop_reason VARCHAR
+        )`,
+        `CREATE TABLE IF NOT EXISTS pages (
+            id BIGINT PRIMARY KEY DEFAULT nextval('pages_id_seq'),
+            crawl_id BIGINT NOT NULL,
+            url VARCHAR NOT NULL,
+            title VARCHAR,
+            content VARCHAR,
+            status_code INTEGER,
+            content_type VARCHAR,
+            size BIGINT,
+            load_time_ms BIGINT,
+            depth INTEGER,
+            parent_url VARCHAR,
+            crawled_at TIMESTAMP DEFAULT current_timestamp,
+            hash VARCHAR,
+            importance_score DOUBLE DEFAULT 0,
+            content_quality DOUBLE DEFAULT 0,
+            link_density DOUBLE DEFAULT 0,
+            first_crawled_at TIMESTAMP DEFAULT current_timestamp,
+            revisits INTEGER DEFAULT 0,
+            changes INTEGER DEFAULT 0,
+            next_crawl_at TIMESTAMP,
+            etag VARCHAR,
+            last_modified VARCHAR,
+            final_url VARCHAR,
+            redirect_chain JSON,
+            UNIQUE (crawl_id, url)
+        )`,
+        `CREATE TABLE IF NOT EXISTS crawl_queue (
+            crawl_id BIGINT NOT NULL,
+            url VARCHAR NOT NULL,
+            priority INTEGER DEFAULT 0,
+            depth INTEGER,
+            parent_url VARCHAR,
+            scheduled_at TIMESTAMP DEFAULT current_timestamp,
+            status VARCHAR DEFAULT 'pending',
+            PRIMARY KEY (crawl_id, url)
+        )`,
+        `CREATE TABLE IF NOT EXISTS links (
+            id BIGINT PRIMARY KEY DEFAULT nextval('links_id_seq'),
+            crawl_id BIGINT NOT NULL,
+            source_id BIGINT,
+            target_id BIGINT,
+            url VARCHAR NOT NULL,
+            anchor VARCHAR,
+            rel VARCHAR,
+            context_before VARCHAR,
+            context_after VARCHAR,
+            heading VARCHAR
+        )`,
+        `CREATE TABLE IF NOT EXISTS page_tags (
+            page_id BIGINT NOT NULL,
+            tag VARCHAR NOT NULL,
+            source VARCHAR DEFAULT 'manual',
+            created_at TIMESTAMP DEFAULT current_timestamp,
+            PRIMARY KEY (page_id, tag)
+        )`,
+        `CREATE TABLE IF NOT EXISTS crawl_checkpoints (
+            start_url VARCHAR PRIMARY KEY,
+            state JSON NOT NULL,
+            updated_at TIMESTAMP DEFAULT current_timestamp
+        )`,
+        `CREATE TABLE IF NOT EXISTS content_hashes (
+            hash VARCHAR PRIMARY KEY,
+            simhash BIGINT,
+            crawl_id BIGINT NOT NULL,
+            url VARCHAR,
+            first_seen TIMESTAMP DEFAULT current_timestamp
+        )`,
+        `CREATE TABLE IF NOT EXISTS url_redirects (
+            crawl_id BIGINT NOT NULL,
+            source_url VARCHAR NOT NULL,
+            target_url VARCHAR NOT NULL,
+            resolved_at TIMESTAMP DEFAULT current_timestamp,
+            PRIMARY KEY (crawl_id, source_url)
+        )`,
+        `CREATE TABLE IF NOT EXISTS extractions (
+            id BIGINT PRIMARY KEY DEFAULT nextval('extractions_id_seq'),
+            page_id BIGINT NOT NULL,
+            crawl_id BIGINT NOT NULL,
+            url VARCHAR NOT NULL,
+            rule VARCHAR NOT NULL,
+            data JSON NOT NULL,
+            extracted_at TIMESTAMP DEFAULT current_timestamp
+        )`,
+        `CREATE TABLE IF NOT EXISTS page_changes (
+            id BIGINT PRIMARY KEY DEFAULT nextval('page_changes_id_seq'),
+            page_id BIGINT NOT NULL,
+            crawl_id BIGINT NOT NULL,
+            url VARCHAR NOT NULL,
+            previous_hash VARCHAR,
+            hash VARCHAR,
+            added INTEGER NOT NULL,
+            removed INTEGER NOT NULL,
+            diff VARCHAR NOT NULL,
+            detected_at TIMESTAMP DEFAULT current_timestamp
+        )`,
+        `CREATE TABLE IF NOT EXISTS images (
+            id BIGINT PRIMARY KEY DEFAULT nextval('images_id_seq'),
+            page_id BIGINT NOT NULL,
+            crawl_id BIGINT NOT NULL,
+            page_url VARCHAR NOT NULL,
+            src VARCHAR NOT NULL,
+            srcset VARCHAR,
+            alt VARCHAR,
+            html_width VARCHAR,
+            html_height VARCHAR,
+            width INTEGER,
+            height INTEGER,
+            format VARCHAR,
+            content_type VARCHAR,
+            size BIGINT,
+            thumbnail_key VARCHAR,
+            error VARCHAR,
+            found_at TIMESTAMP DEFAULT current_timestamp
+        )`,
+        `CREATE TABLE IF NOT EXISTS benchmark_results (
+            id BIGINT PRIMARY KEY DEFAULT nextval('benchmark_results_id_seq'),
+            ran_at TIMESTAMP DEFAULT current_timestamp,
+            label VARCHAR,
+            config JSON NOT NULL,
+            crawlers JSON NOT NULL
+        )`,
+        `ALTER TABLE crawls ADD COLUMN IF NOT EXISTS stop_reason VARCHAR`,
+        `ALTER TABLE crawls ADD COLUMN IF NOT EXISTS uuid VARCHAR`,
+        `UPDATE crawls SET uuid = uuid()::VARCHAR WHERE uuid IS NULL`,
+        `ALTER TABLE pages ADD COLUMN IF NOT EXISTS first_crawled_at TIMESTAMP DEFAULT current_timestamp`,
+        `ALTER TABLE pages ADD COLUMN IF NOT EXISTS revisits INTEGER DEFAULT 0`,
+        `ALTER TABLE pages ADD COLUMN IF NOT EXISTS changes INTEGER DEFAULT 0`,
+        `ALTER TABLE pages ADD COLUMN IF NOT EXISTS next_crawl_at TIMESTAMP`,
+        `ALTER TABLE pages ADD COLUMN IF NOT EXISTS etag VARCHAR`,
+        `ALTER TABLE pages ADD COLUMN IF NOT EXISTS last_modified VARCHAR`,
+        `ALTER TABLE pages ADD COLUMN IF NOT EXISTS final_url VARCHAR`,
+        `ALTER TABLE pages ADD COLUMN IF NOT EXISTS redirect_chain JSON`,
+        `ALTER TABLE pages ADD COLUMN IF NOT EXISTS truncated BOOLEAN DEFAULT false`,
+        `ALTER TABLE pages ADD COLUMN IF NOT EXISTS content_encoding VARCHAR`,
+        `ALTER TABLE pages ADD COLUMN IF NOT EXISTS compressed_size BIGINT`,
+        `ALTER TABLE pages ADD COLUMN IF NOT EXISTS structured_data JSON`,
+        `ALTER TABLE pages ADD COLUMN IF NOT EXISTS og_title VARCHAR`,
+        `ALTER TABLE pages ADD COLUMN IF NOT EXISTS og_description VARCHAR`,
+        `ALTER TABLE pages ADD COLUMN IF NOT EXISTS og_image VARCHAR`,
+        `ALTER TABLE pages ADD COLUMN IF NOT EXISTS canonical_url VARCHAR`,
+        `ALTER TABLE pages ADD COLUMN IF NOT EXISTS listing BOOLEAN DEFAULT false`,
+        `ALTER TABLE links ADD COLUMN IF NOT EXISTS classes VARCHAR`,
+        `ALTER TABLE crawl_queue ADD COLUMN IF NOT EXISTS attempts INTEGER DEFAULT 0`,
+        `ALTER TABLE crawl_queue ADD COLUMN IF NOT EXISTS last_attempt TIMESTAMP`,
+        `ALTER TABLE crawl_queue ADD COLUMN IF NOT EXISTS last_error VARCHAR`,
+        `ALTER TABLE crawl_queue ADD COLUMN IF NOT EXISTS retry_at TIMESTAMP`,
+        // A list column cannot be updated by an upsert, so the sketch is
+        // kept as its list literal; similarity_sketch of older databases
+        // is left unused
+        `ALTER TABLE pages ADD COLUMN IF NOT EXISTS text_sketch VARCHAR`,
+        `ALTER TABLE pages ADD COLUMN IF NOT EXISTS protocol VARCHAR`,
+        `ALTER TABLE pages ADD COLUMN IF NOT EXISTS dns_ms DOUBLE`,
+        `ALTER TABLE pages ADD COLUMN IF NOT EXISTS connect_ms DOUBLE`,
+        `ALTER TABLE pages ADD COLUMN IF NOT EXISTS tls_ms DOUBLE`,
+        `ALTER TABLE pages ADD COLUMN IF NOT EXISTS ttfb_ms DOUBLE`,
+        `ALTER TABLE pages ADD COLUMN IF NOT EXISTS download_ms DOUBLE`,
+        `ALTER TABLE pages ADD COLUMN IF NOT EXISTS headers JSON`,
+        `ALTER TABLE pages ADD COLUMN IF NOT EXISTS tls JSON`,
+        `ALTER TABLE pages ADD COLUMN IF NOT EXISTS relevance DOUBLE DEFAULT 0`,
+        `ALTER TABLE crawl_queue ADD COLUMN IF NOT EXISTS fingerprint VARCHAR`,
+        `ALTER TABLE pages ADD COLUMN IF NOT EXISTS fingerprint VARCHAR`,
+        `ALTER TABLE pages ADD COLUMN IF NOT EXISTS spam BOOLEAN DEFAULT false`,
+        `ALTER TABLE pages ADD COLUMN IF NOT EXISTS spam_score DOUBLE DEFAULT 0`,
+        `ALTER TABLE pages ADD COLUMN IF NOT EXISTS spam_signals VARCHAR`,
+    }
+
+    for _, query := range queries {
+        if _, err := d.DB.Exec(query); err != nil {
+            return fmt.Errorf("failed to execute query %s: %w", query, err)
+        }
+    }
+
+    return recordSchemaVersion(d.DB, d.schemaVersion)
+}
+
+func (d *DuckDB) CreateCrawl(mode, startURL string, maxDepth int) (int64, string, error) {
+    var id int64
+    crawlUUID := uuid.NewString()
+    err := d.DB.QueryRow(`
+        INSERT INTO crawls (uuid, mode, start_url, max_depth)
+        VALUES ($1, $2, $3, $4)
+        RETURNING id
+    `, crawlUUID, mode, startURL, maxDepth).Scan(&id)
+    return id, crawlUUID, err
+}
+
+func (d *DuckDB) GetCrawlUUID(id int64) (string, error) {
+    var crawlUUID string
+    err := d.DB.QueryRow("SELECT uuid FROM crawls WHERE id = $1", id).Scan(&crawlUUID)
+    return crawlUUID, err
+}
+
+func (d *DuckDB) FinishCrawl(id int64, stats *models.CrawlStats) error {
+    _, err := d.DB.Exec(`
+        UPDATE crawls SET
+            finished_at = current_timestamp,
+            pages_processed = $2,
+            pages_skipped = $3,
+            errors = $4,
+            total_size = $5,
+            stop_reason = $6
+        WHERE id = $1
+    `, id, stats.PagesProcessed, stats.PagesSkipped, stats.Errors, stats.TotalSize, stats.StopReason)
+    return err
+}
+
+func (d *DuckDB) SavePage(page *models.Page) error {
+    return d.SavePages([]models.PageWrite{{Page: page}})
+}
+
+const duckPageRow = `($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, NULLIF($17, ''), $18, $19, NULLIF($20, ''), NULLIF($21, 0), $22, NULLIF($23, ''), NULLIF($24, ''), NULLIF($25, ''), NULLIF($26, ''), $27, NULLIF($28, ''), NULLIF($29, ''), $30, $31, $32, $33, $34, $35, $36, $37, NULLIF($38, ''), $39, $40, NULLIF($41, ''))`
+
+// SavePages saves a batch of pages and their links in one transaction,
+// the pages in multi-row upserts
+func (d *DuckDB) SavePages(writes []models.PageWrite) error {
+    if len(writes) == 0 {
+        return nil
+    }
+    tx, err := d.DB.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    unique := uniqueWrites(writes)
+    for start := 0; start < len(unique); start += pageBatchSize {
+        if err := d.upsertPages(tx, unique[start:min(start+pageBatchSize, len(unique))]); err != nil {
+            return err
+        }
+    }
+
+    // RETURNING on an upsert that updated reports a fresh sequence value
+    // rather than the existing row's id, so look them up instead
+    stmt, err := tx.Prepare("SELECT id FROM pages WHERE crawl_id = $1 AND url = $2")
+    if err != nil {
+        return err
+    }
+    defer stmt.Close()
+    for _, write := range writes {
+        if err := stmt.QueryRow(write.Page.CrawlID, write.Page.URL).Scan(&write.Page.ID); err != nil {
+            return err
+        }
+    }
+
+    if err := replaceLinks(tx, unique); err != nil {
+        return err
+    }
+    return tx.Commit()
+}
+
+func (d *DuckDB) upsertPages(tx *sql.Tx, writes []models.PageWrite) error {
+    args := make([]interface{}, 0, len(writes)*41)
+    for _, write := range writes {
+        page := write.Page
+        chain, err := redirectChain(page)
+        if err != nil {
+            return err
+        }
+        structured, err := structuredData(page)
+        if err != nil {
+            return err
+        }
+        headers, err := pageHeaders(page)
+        if err != nil {
+            return err
+        }
+        tls, err := pageTLS(page)
+        if err != nil {
+            return err
+        }
+        args = append(args, page.CrawlID, page.URL, page.Title, page.Content, page.StatusCode, page.ContentType,
+            page.Size, page.LoadTime, page.Depth, page.ParentURL, page.Hash,
+            page.Importance, page.ContentQuality, page.LinkDensity, page.ETag, page.LastModified,
+            page.FinalURL, chain, page.Truncated, page.Encoding, page.CompressedSize,
+            structured, page.OGTitle, page.OGDescription, page.OGImage, page.CanonicalURL, page.Listing,
+            similaritySketch(pageSample(page)), page.Protocol,
+        )
+        args = append(args, pageTiming(page)...)
+        args = append(args, headers, page.Relevance, tls, page.Fingerprint, page.Spam, page.SpamScore, strings.Join(page.SpamSignals, ","))
+    }
+
+    _, err := tx.Exec(`
+        INSERT INTO pages (crawl_id, url, title, content, status_code, content_type, size, load_time_ms, depth, parent_url, hash, importance_score, content_quality, link_density, etag, last_modified, final_url, redirect_chain, truncated, content_encoding, compressed_size, structured_data, og_title, og_description, og_image, canonical_url, listing, text_sketch, protocol, dns_ms, connect_ms, tls_ms, ttfb_ms, download_ms, headers, relevance, tls, fingerprint, spam, spam_score, spam_signals)
+        VALUES `+valuesRows(duckPageRow, len(writes), 41)+`
+        ON CONFLICT (crawl_id, url) DO UPDATE SET
+            title = excluded.title,
+            content = excluded.content,
+            status_code = excluded.status_code,
+            content_type = excluded.content_type,
+            size = excluded.size,
+            load_time_ms = excluded.load_time_ms,
+            crawled_at = now(),
+            hash = excluded.hash,
+            importance_score = excluded.importance_score,
+            content_quality = excluded.content_quality,
+            link_density = excluded.link_density,
+            etag = excluded.etag,
+            last_modified = excluded.last_modified,
+            final_url = excluded.final_url,
+            redirect_chain = excluded.redirect_chain,
+            truncated = excluded.truncated,
+            content_encoding = excluded.content_encoding,
+            compressed_size = excluded.compressed_size,
+            structured_data = excluded.structured_data,
+            og_title = excluded.og_title,
+            og_description = excluded.og_description,
+            og_image = excluded.og_image,
+            canonical_url = excluded.canonical_url,
+            listing = excluded.listing,
+            text_sketch = excluded.text_sketch,
+            protocol = excluded.protocol,
+            dns_ms = excluded.dns_ms,
+            connect_ms = excluded.connect_ms,
+            tls_ms = excluded.tls_ms,
+            ttfb_ms = excluded.ttfb_ms,
+            download_ms = excluded.download_ms,
+            headers = excluded.headers,
+            relevance = excluded.relevance,
+            tls = excluded.tls,
+            fingerprint = excluded.fingerprint,
+            spam = excluded.spam,
+            spam_score = excluded.spam_score,
+            spam_signals = excluded.spam_signals
+    `, args...)
+    return err
+}
+
+func (d *DuckDB) IsURLCrawled(crawlID int64, url string) (bool, error) {
+    var count int
+    err := d.DB.QueryRow("SELECT COUNT(*) FROM pages WHERE crawl_id = $1 AND (url = $2 OR final_url = $2 OR canonical_url = $2)", crawlID, url).Scan(&count)
+    return count > 0, err
+}
+
+func (d *DuckDB) IsFingerprintCrawled(crawlID int64, fingerprint string) (bool, error) {
+    var exists bool
+    err := d.DB.QueryRow("SELECT EXISTS (SELECT 1 FROM pages WHERE crawl_id = $1 AND fingerprint = $2)", crawlID, fingerprint).Scan(&exists)
+    return exists, err
+}
+
+func (d *DuckDB) HasContentHash(crawlID int64, hash string) (bool, error) {
+    var exists bool
+    err := d.DB.QueryRow("SELECT EXISTS (SELECT 1 FROM pages WHERE crawl_id = $1 AND hash = $2)", crawlID, hash).Scan(&exists)
+    return exists, err
+}
+
+func (d *DuckDB) ForEachContentHash(crawlID int64, fn func(hash string) error) error {
+    return forEachContentHash(d.DB, crawlID, fn)
+}
+
+func (d *DuckDB) ClaimContentHash(crawlID int64, url, hash string, simhash int64) (bool, int64, error) {
+    result, err := d.DB.Exec(`
+        INSERT INTO content_hashes (hash, simhash, crawl_id, url)
+        VALUES ($1, $2, $3, $4)
+        ON CONFLICT (hash) DO NOTHING
+    `, hash, simhash, crawlID, url)
+    if err != nil {
+        return false, 0, err
+    }
+    claimed, err := result.RowsAffected()
+    if err != nil {
+        return false, 0, err
+    }
+    if claimed > 0 {
+        return true, crawlID, nil
+    }
+
+    var holder int64
+    err = d.DB.QueryRow("SELECT crawl_id FROM content_hashes WHERE hash = $1", hash).Scan(&holder)
+    return false, holder, err
+}
+
+// PrepareSimilarity has nothing to set up, as DuckDB pages carry the
+// sketches FindSimilarPage compares
+func (d *DuckDB) PrepareSimilarity() error {
+    return nil
+}
+
+// FindSimilarPage compares MinHash sketches of trigrams, as DuckDB has no
+// trigram index: the share of the smallest hashes of both pages together
+// that each page has estimates their pg_trgm similarity. Every page of the
+// crawl is compared.
+func (d *DuckDB) FindSimilarPage(crawlID int64, title, text string, threshold float64) (*models.SimilarPage, error) {
+    sketch := similaritySketch(textSample(title, text))
+    if sketch == "" {
+        return nil, nil
+    }
+    var page models.SimilarPage
+    err := d.DB.QueryRow(`
+        WITH candidates AS (
+            SELECT id, url, title, hash, text_sketch::BIGINT[] AS sketch, $2::BIGINT[] AS other,
+                list_slice(list_sort(list_distinct(list_concat(text_sketch::BIGINT[], $2::BIGINT[]))), 1, $3) AS combined
+            FROM pages
+            WHERE crawl_id = $1 AND text_sketch IS NOT NULL
+        ), scored AS (
+            SELECT id, url, title, hash,
+                len(list_filter(combined, h -> list_contains(sketch, h) AND list_contains(other, h)))::DOUBLE / len(combined) AS score
+            FROM candidates
+        )
+        SELECT id, url, COALESCE(title, ''), COALESCE(hash, ''), score
+        FROM scored
+        WHERE score >= $4
+        ORDER BY score DESC
+        LIMIT 1
+    `, crawlID, sketch, sketchSize, threshold).Scan(&page.ID, &page.URL, &page.Title, &page.Hash, &page.Similarity)
+    if err == sql.ErrNoRows {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, err
+    }
+    return &page, nil
+}
+
+func (d *DuckDB) SaveRedirect(crawlID int64, sourceURL, targetURL string) error {
+    _, err := d.DB.Exec(`
+        INSERT INTO url_redirects (crawl_id, source_url, target_url)
+        VALUES ($1, $2, $3)
+        ON CONFLICT (crawl_id, source_url) DO NOTHING
+    `, crawlID, sourceURL, targetURL)
+    return err
+}
+
+func (d *DuckDB) SaveLinks(crawlID, sourceID int64, links []models.Link) error {
+    tx, err := d.DB.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    if _, err := tx.Exec("DELETE FROM links WHERE source_id = $1", sourceID); err != nil {
+        return err
+    }
+    links = linksFrom(sourceID, links)
+    for start := 0; start < len(links); start += linkBatchSize {
+        query, args := insertLinks(crawlID, links[start:min(start+linkBatchSize, len(links))])
+        if _, err := tx.Exec(query, args...); err != nil {
+            return err
+        }
+    }
+    if _, err := tx.Exec(resolveSavedTargets, sourceID); err != nil {
+        return err
+    }
+
+    return tx.Commit()
+}
+
+func (d *DuckDB) AddPageTags(pageID int64, tags []string, source string) error {
+    for _, tag := range tags {
+        _, err := d.DB.Exec(`
+            INSERT INTO page_tags (page_id, tag, source)
+            VALUES ($1, $2, $3)
+            ON CONFLICT (page_id, tag) DO NOTHING
+        `, pageID, tag, source)
+        if err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func (d *DuckDB) SaveExtractions(crawlID, pageID int64, url string, extractions []models.Extraction) error {
+    return saveExtractions(d.DB, crawlID, pageID, url, extractions)
+}
+
+// GetSavedContent reads the body from the pages row, where DuckDB keeps it
+func (d *DuckDB) GetSavedContent(crawlID int64, url string) (string, string, error) {
+    var hash, content string
+    err := d.DB.QueryRow(`
+        SELECT COALESCE(hash, ''), COALESCE(content, '')
+        FROM pages
+        WHERE crawl_id = $1 AND url = $2
+    `, crawlID, url).Scan(&hash, &content)
+    return hash, content, err
+}
+
+func (d *DuckDB) SavePageChange(change *models.PageChange) error {
+    return savePageChange(d.DB, change)
+}
+
+func (d *DuckDB) SaveImages(crawlID, pageID int64, url string, images []models.Image) error {
+    return saveImages(d.DB, crawlID, pageID, url, images)
+}
+
+func (d *DuckDB) AddToQueue(crawlID int64, urls []models.URLPriority) error {
+    tx, err := d.DB.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    for _, urlPriority := range urls {
+        // A URL whose fingerprint is queued under another URL raises its
+        // priority instead
+        fingerprint := queueFingerprint(urlPriority)
+        result, err := tx.Exec(`
+            UPDATE crawl_queue SET priority = greatest(priority, $3)
+            WHERE crawl_id = $1 AND fingerprint = $2 AND url <> $4
+        `, crawlID, fingerprint, urlPriority.Priority, urlPriority.URL)
+        if err != nil {
+            return err
+        }
+        if raised, err := result.RowsAffected(); err != nil || raised > 0 {
+            continue
+        }
+        _, err = tx.Exec(`
+            INSERT INTO crawl_queue (crawl_id, url, priority, depth, parent_url, fingerprint)
+            VALUES ($1, $2, $3, $4, $5, $6)
+            ON CONFLICT (crawl_id, url) DO UPDATE SET
+                priority = greatest(priority, excluded.priority),
+                fingerprint = coalesce(fingerprint, excluded.fingerprint)
+        `, crawlID, urlPriority.URL, urlPriority.Priority, urlPriority.Depth, urlPriority.Parent, fingerprint)
+        if err != nil {
+            return err
+        }
+    }
+
+    return tx.Commit()
+}
+
+// GetNextURLs claims URLs with the same per-parent fairness as the
+// Postgres queue, ranking the same limit*fairnessScan top candidates. DuckDB
+// has one writer, so claiming in a transaction is enough to keep a URL from
+// being handed out twice.
+func (d *DuckDB) GetNextURLs(crawlID int64, limit int, exceptHosts []string) ([]models.URLPriority, error) {
+    return d.claimURLs(crawlID, `
+        SELECT url, priority, depth, parent_url, fingerprint
+        FROM (
+            SELECT url, priority, depth, parent_url, fingerprint, scheduled_at,
+                   priority // $3 AS band,
+                   row_number() OVER (
+                       PARTITION BY priority // $3, coalesce(parent_url, '')
+                       ORDER BY priority DESC, scheduled_at ASC
+                   ) AS parent_rank
+            FROM (
+                SELECT url, priority, depth, parent_url, fingerprint, scheduled_at
+                FROM crawl_queue
+                WHERE crawl_id = $1 AND status = 'pending' AND (retry_at IS NULL OR retry_at <= current_timestamp::TIMESTAMP)
+                  AND ($4 = '' OR NOT list_contains(string_split($4, chr(10)), regexp_extract(url, '^[^:/]+://([^/?#]+)', 1)))
+                ORDER BY priority DESC, scheduled_at ASC
+                LIMIT $5
+            ) candidates
+        ) pending
+        ORDER BY band DESC, parent_rank ASC, priority DESC, scheduled_at ASC
+        LIMIT $2
+    `, crawlID, limit, fairnessBand, strings.Join(exceptHosts, "\n"), limit*fairnessScan)
+}
+
+// GetOldestURLs claims pending URLs in the order they were queued
+func (d *DuckDB) GetOldestURLs(crawlID int64, limit int) ([]models.URLPriority, error) {
+    return d.claimURLs(crawlID, `
+        SELECT url, priority, depth, parent_url, fingerprint
+        FROM crawl_queue
+        WHERE crawl_id = $1 AND status = 'pending' AND (retry_at IS NULL OR retry_at <= current_timestamp::TIMESTAMP)
+        ORDER BY scheduled_at ASC, rowid ASC
+        LIMIT $2
+    `, crawlID, limit)
+}
+
+// claimURLs marks the queue rows a query selects in_progress and returns
+// their URLs. It updates them one by one, as DuckDB rejects UPDATE ...
+// RETURNING on tables with a primary key.
+func (d *DuckDB) claimURLs(crawlID int64, query string, args ...interface{}) ([]models.URLPriority, error) {
+    tx, err := d.DB.Begin()
+    if err != nil {
+        return nil, err
+    }
+    defer tx.Rollback()
+
+    rows, err := tx.Query(query, args...)
+    if err != nil {
+        return nil, err
+    }
+    var urls []models.URLPriority
+    for rows.Next() {
+        var url models.URLPriority
+        var parent, fingerprint sql.NullString
+        if err := rows.Scan(&url.URL, &url.Priority, &url.Depth, &parent, &fingerprint); err != nil {
+            rows.Close()
+            return nil, err
+        }
+        url.Parent, url.Fingerprint = parent.String, fingerprint.String
+        urls = append(urls, url)
+    }
+    rows.Close()
+    if err := rows.Err(); err != nil {
+        return nil, err
+    }
+
+    stmt, err := tx.Prepare(`
+        UPDATE crawl_queue SET status = 'in_progress', last_attempt = current_timestamp::TIMESTAMP
+        WHERE crawl_id = $1 AND url = $2
+    `)
+    if err != nil {
+        return nil, err
+    }
+    defer stmt.Close()
+    for _, url := range urls {
+        if _, err := stmt.Exec(crawlID, url.URL); err != nil {
+            return nil, err
+        }
+    }
+
+    return urls, tx.Commit()
+}
+
+// Returns queue rows claimed more than $1 seconds ago to pending
+const reapDuckQueue = `
+    UPDATE crawl_queue SET status = 'pending'
+    WHERE status = 'in_progress' AND last_attempt < current_timestamp::TIMESTAMP - to_seconds($1::DOUBLE)
+`
+
+func (d *DuckDB) ReapQueue(staleAfter time.Duration) (int, error) {
+    result, err := d.DB.Exec(reapDuckQueue, staleAfter.Seconds())
+    if err != nil {
+        return 0, err
+    }
+    reaped, err := result.RowsAffected()
+    return int(reaped), err
+}
+
+// FailURL is the DuckDB version of PostgresDB.FailURL
+func (d *DuckDB) FailURL(crawlID int64, url, message string, maxAttempts int, backoff time.Duration) (bool, error) {
+    tx, err := d.DB.Begin()
+    if err != nil {
+        return false, err
+    }
+    defer tx.Rollback()
+
+    _, err = tx.Exec(`
+        UPDATE crawl_queue SET
+            attempts = coalesce(attempts, 0) + 1,
+            last_error = $3,
+            status = CASE WHEN coalesce(attempts, 0) + 1 >= $4 THEN 'failed' ELSE 'pending' END,
+            retry_at = current_timestamp::TIMESTAMP + to_seconds($5 * pow(2, coalesce(attempts, 0)))
+        WHERE crawl_id = $1 AND url = $2
+    `, crawlID, url, message, maxAttempts, backoff.Seconds())
+    if err != nil {
+        return false, err
+    }
+    var status string
+    err = tx.QueryRow("SELECT status FROM crawl_queue WHERE crawl_id = $1 AND url = $2", crawlID, url).Scan(&status)
+    if err == sql.ErrNoRows {
+        return false, nil
+    }
+    if err != nil {
+        return false, err
+    }
+    return status == "failed", tx.Commit()
+}
+
+func (d *DuckDB) HasPendingRetries(crawlID int64) (bool, error) {
+    var pending bool
+    err := d.DB.QueryRow(`
+        SELECT EXISTS (
+            SELECT 1 FROM crawl_queue
+            WHERE crawl_id = $1 AND status = 'pending' AND retry_at > current_timestamp::TIMESTAMP
+        )
+    `, crawlID).Scan(&pending)
+    return pending, err
+}
+
+func (d *DuckDB) GetFailedURLs(crawlID int64) ([]models.FailedURL, error) {
+    rows, err := d.DB.Query(`
+        SELECT crawl_id, url, coalesce(attempts, 0), coalesce(last_error, ''), coalesce(last_attempt, scheduled_at)
+        FROM crawl_queue
+        WHERE status = 'failed' AND ($1 = 0 OR crawl_id = $1)
+        ORDER BY last_attempt DESC, rowid
+    `, crawlID)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var failed []models.FailedURL
+    for rows.Next() {
+        var url models.FailedURL
+        if err := rows.Scan(&url.CrawlID, &url.URL, &url.Attempts, &url.LastError, &url.LastAttempt); err != nil {
+            return nil, err
+        }
+        failed = append(failed, url)
+    }
+    return failed, rows.Err()
+}
+
+func (d *DuckDB) RequeueFailed(crawlID int64) (int, error) {
+    result, err := d.DB.Exec(`
+        UPDATE crawl_queue SET status = 'pending', attempts = 0, retry_at = NULL, last_error = NULL
+        WHERE crawl_id = $1 AND status = 'failed'
+    `, crawlID)
+    if err != nil {
+        return 0, err
+    }
+    requeued, err := result.RowsAffected()
+    return int(requeued), err
+}
+
+func (d *DuckDB) MarkURLProcessed(crawlID int64, url string) error {
+    _, err := d.DB.Exec("UPDATE crawl_queue SET status = 'completed' WHERE crawl_id = $1 AND url = $2", crawlID, url)
+    return err
+}
+
+func (d *DuckDB) DeferQueue(crawlID int64) (int, error) {
+    result, err := d.DB.Exec("UPDATE crawl_queue SET status = 'deferred' WHERE crawl_id = $1 AND status IN ('pending', 'in_progress')", crawlID)
+    if err != nil {
+        return 0, err
+    }
+    deferred, err := result.RowsAffected()
+    return int(deferred), err
+}
+
+func (d *DuckDB) RequeueDeferred(crawlID int64) error {
+    _, err := d.DB.Exec("UPDATE crawl_queue SET status = 'pending' WHERE crawl_id = $1 AND status IN ('deferred', 'in_progress')", crawlID)
+    return err
+}
+
+func (d *DuckDB) CountPendingURLs(crawlID int64) (int, error) {
+    var pending int
+    err := d.DB.QueryRow(`
+        SELECT COUNT(*) FROM crawl_queue WHERE crawl_id = $1 AND status = 'pending'
+    `, crawlID).Scan(&pending)
+    return pending, err
+}
+
+func (d *DuckDB) GetPendingURLs(crawlID int64, origin string) ([]string, error) {
+    rows, err := d.DB.Query(`
+        SELECT url FROM crawl_queue
+        WHERE crawl_id = $1 AND status = 'pending' AND starts_with(url, $2)
+    `, crawlID, origin)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var urls []string
+    for rows.Next() {
+        var url string
+        if err := rows.Scan(&url); err != nil {
+            return nil, err
+        }
+        urls = append(urls, url)
+    }
+    return urls, rows.Err()
+}
+
+func (d *DuckDB) DisallowQueuedURLs(crawlID int64, urls []string) (int, error) {
+    tx, err := d.DB.Begin()
+    if err != nil {
+        return 0, err
+    }
+    defer tx.Rollback()
+
+    disallowed := 0
+    for _, url := range urls {
+        result, err := tx.Exec("UPDATE crawl_queue SET status = 'disallowed' WHERE crawl_id = $1 AND url = $2 AND status = 'pending'", crawlID, url)
+        if err != nil {
+            return 0, err
+        }
+        n, _ := result.RowsAffected()
+        disallowed += int(n)
+    }
+    return disallowed, tx.Commit()
+}
+
+func (d *DuckDB) ReleaseURLs(crawlID int64, urls []string) (int, error) {
+    tx, err := d.DB.Begin()
+    if err != nil {
+        return 0, err
+    }
+    defer tx.Rollback()
+
+    released := 0
+    for _, url := range urls {
+        result, err := tx.Exec("UPDATE crawl_queue SET status = 'pending' WHERE crawl_id = $1 AND url = $2 AND status = 'in_progress'", crawlID, url)
+        if err != nil {
+            return 0, err
+        }
+        n, _ := result.RowsAffected()
+        released += int(n)
+    }
+    return released, tx.Commit()
+}
+
+// DueForRefresh claims due pages in a transaction rather than with
+// UPDATE ... RETURNING, which DuckDB rejects on tables with a primary key
+func (d *DuckDB) DueForRefresh(crawlID int64, limit int, lease time.Duration) ([]models.URLPriority, error) {
+    tx, err := d.DB.Begin()
+    if err != nil {
+        return nil, err
+    }
+    defer tx.Rollback()
+
+    rows, err := tx.Query(`
+        SELECT id, url, COALESCE(depth, 0), COALESCE(parent_url, ''), COALESCE(etag, ''), COALESCE(last_modified, '')
+        FROM pages
+        WHERE crawl_id = $1 AND next_crawl_at <= current_timestamp::TIMESTAMP
+        ORDER BY next_crawl_at
+        LIMIT $2
+    `, crawlID, limit)
+    if err != nil {
+        return nil, err
+    }
+
+    var ids []int64
+    var urls []models.URLPriority
+    for rows.Next() {
+        var id int64
+        url := models.URLPriority{Refresh: true}
+        if err := rows.Scan(&id, &url.URL, &url.Depth, &url.Parent, &url.Validators.ETag, &url.Validators.LastModified); err != nil {
+            rows.Close()
+            return nil, err
+        }
+        ids = append(ids, id)
+        urls = append(urls, url)
+    }
+    rows.Close()
+    if err := rows.Err(); err != nil {
+        return nil, err
+    }
+
+    for _, id := range ids {
+        _, err := tx.Exec("UPDATE pages SET next_crawl_at = current_timestamp::TIMESTAMP + to_microseconds($2) WHERE id = $1",
+            id, lease.Microseconds())
+        if err != nil {
+            return nil, err
+        }
+    }
+
+    return urls, tx.Commit()
+}
+
+func (d *DuckDB) RecordRevisit(crawlID int64, url, hash string, validators models.Validators) (*models.RevisitHistory, error) {
+    tx, err := d.DB.Begin()
+    if err != nil {
+        return nil, err
+    }
+    defer tx.Rollback()
+
+    var history models.RevisitHistory
+    var observed float64
+    err = tx.QueryRow(`
+        SELECT epoch(current_timestamp::TIMESTAMP) - epoch(COALESCE(first_crawled_at, crawled_at)),
+               COALESCE(revisits, 0) + 1, COALESCE(changes, 0), $3 <> '' AND hash IS DISTINCT FROM $3
+        FROM pages
+        WHERE crawl_id = $1 AND url = $2
+    `, crawlID, url, hash).Scan(&observed, &history.Revisits, &history.Changes, &history.Changed)
+    if err != nil {
+        return nil, err
+    }
+    if history.Changed {
+        history.Changes++
+    }
+    history.Observed = time.Duration(observed * float64(time.Second))
+
+    _, err = tx.Exec(`
+        UPDATE pages SET
+            revisits = $3,
+            changes = $4,
+            etag = COALESCE(NULLIF($5, ''), etag),
+            last_modified = COALESCE(NULLIF($6, ''), last_modified)
+        WHERE crawl_id = $1 AND url = $2
+    `, crawlID, url, history.Revisits, history.Changes, validators.ETag, validators.LastModified)
+    if err != nil {
+        return nil, err
+    }
+
+    return &history, tx.Commit()
+}
+
+func (d *DuckDB) ScheduleRevisit(crawlID int64, url string, after time.Duration) error {
+    _, err := d.DB.Exec(`
+        UPDATE pages SET next_crawl_at = current_timestamp::TIMESTAMP + to_microseconds($3)
+        WHERE crawl_id = $1 AND url = $2
+    `, crawlID, url, after.Microseconds())
+    return err
+}
+
+func (d *DuckDB) ScheduleUnscheduled(crawlID int64) (int, error) {
+    result, err := d.DB.Exec(`
+        UPDATE pages SET next_crawl_at = current_timestamp::TIMESTAMP
+        WHERE crawl_id = $1 AND next_crawl_at IS NULL
+    `, crawlID)
+    if err != nil {
+        return 0, err
+    }
+    scheduled, err := result.RowsAffected()
+    return int(scheduled), err
+}
+
+func (d *DuckDB) SaveCheckpoint(startURL string, state []byte) error {
+    _, err := d.DB.Exec(`
+        INSERT INTO crawl_checkpoints (start_url, state, updated_at)
+        VALUES ($1, $2, current_timestamp)
+        ON CONFLICT (start_url) DO UPDATE SET
+            state = excluded.state,
+            updated_at = now()
+    `, startURL, string(state))
+    return err
+}
+
+func (d *DuckDB) LoadCheckpoint(startURL string) ([]byte, error) {
+    var state string
+    err := d.DB.QueryRow("SELECT state FROM crawl_checkpoints WHERE start_url = $1", startURL).Scan(&state)
+    if err == sql.ErrNoRows {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, err
+    }
+    return []byte(state), nil
+}
+
+func (d *DuckDB) SaveBenchmarkResult(result *models.BenchmarkResult) (int64, error) {
+    config, crawlers, err := encodeBenchmarkResult(result)
+    if err != nil {
+        return 0, err
+    }
+    err = d.DB.QueryRow(`
+        INSERT INTO benchmark_results (label, config, crawlers)
+        VALUES (NULLIF($1, ''), $2, $3)
+        RETURNING id, ran_at
+    `, result.Label, config, crawlers).Scan(&result.ID, &result.RanAt)
+    return result.ID, err
+}
+
+func (d *DuckDB) BenchmarkResults(limit int) ([]models.BenchmarkResult, error) {
+    query, args := benchmarkQuery(limit)
+    rows, err := d.DB.Query(query, args...)
+    if err != nil {
+        return nil, err
+    }
+    return scanBenchmarkResults(rows)
+}
+
+// SchemaReport is the DuckDB version of PostgresDB.SchemaReport
+func (d *DuckDB) SchemaReport() *models.RepairReport {
+    return schemaReport(d.schemaVersion)
+}
+
+// Repair is the DuckDB version of PostgresDB.Repair
+func (d *DuckDB) Repair(startURL string, staleAfter time.Duration) (*models.RepairReport, error) {
+    report := &models.RepairReport{}
+
+    tx, err := d.DB.Begin()
+    if err != nil {
+        return nil, err
+    }
+    defer tx.Rollback()
+
+    if staleAfter > 0 {
+        rows, err := tx.Query(`
+            SELECT id, last_active FROM (
+                SELECT c.id, greatest(
+                    c.started_at,
+                    coalesce((SELECT max(crawled_at) FROM pages WHERE crawl_id = c.id), c.started_at),
+                    coalesce((SELECT updated_at FROM crawl_checkpoints WHERE start_url = c.start_url), c.started_at)
+                ) AS last_active
+                FROM crawls c
+                WHERE c.finished_at IS NULL AND c.start_url = $2
+            )
+            WHERE last_active < current_timestamp::TIMESTAMP - to_seconds($1::DOUBLE)
+            ORDER BY id
+        `, staleAfter.Seconds(), startURL)
+        if err != nil {
+            return nil, fmt.Errorf("failed to find interrupted crawls: %w", err)
+        }
+        lastActive := make(map[int64]time.Time)
+        for rows.Next() {
+            var id int64
+            var at time.Time
+            if err := rows.Scan(&id, &at); err != nil {
+                rows.Close()
+                return nil, err
+            }
+            report.InterruptedCrawls = append(report.InterruptedCrawls, id)
+            lastActive[id] = at
+        }
+        rows.Close()
+        if err := rows.Err(); err != nil {
+            return nil, err
+        }
+
+        for _, id := range report.InterruptedCrawls {
+            _, err := tx.Exec(`
+                UPDATE crawls SET
+                    finished_at = $2,
+                    stop_reason = 'interrupted',
+                    pages_processed = (SELECT count(*) FROM pages WHERE crawl_id = $1)
+                WHERE id = $1
+            `, id, lastActive[id])
+            if err != nil {
+                return nil, fmt.Errorf("failed to close interrupted crawl %d: %w", id, err)
+            }
+        }
+    }
+
+    result, err := tx.Exec(`
+        UPDATE crawl_queue SET status = 'completed'
+        WHERE crawl_id IN (SELECT id FROM crawls WHERE start_url = $1)
+            AND status IN ('pending', 'in_progress')
+            AND EXISTS (SELECT 1 FROM pages WHERE pages.crawl_id = crawl_queue.crawl_id AND pages.url = crawl_queue.url)
+    `, startURL)
+    if err != nil {
+        return nil, fmt.Errorf("failed to complete saved queue rows: %w", err)
+    }
+    completed, _ := result.RowsAffected()
+    report.QueueRowsCompleted = int(completed)
+
+    result, err = tx.Exec(reapDuckQueue+` AND crawl_id IN (SELECT id FROM crawls WHERE start_url = $2)`, QueueClaimTimeout.Seconds(), startURL)
+    if err != nil {
+        return nil, fmt.Errorf("failed to release stale queue claims: %w", err)
+    }
+    released, _ := result.RowsAffected()
+    report.QueueClaimsReleased = int(released)
+
+    if err := tx.Commit(); err != nil {
+        return nil, err
+    }
+    return report, nil
+}
+
+func (d *DuckDB) Close() error {
+    return d.DB.Close()
+}
+
+var _ Store = (*DuckDB)(nil)
@@ -0,0 +1,11 @@
+//go:build !duckdb
+
+package database
+
+import "errors"
+
+// NewDuckDB is only available in binaries built with -tags duckdb, since the
+// DuckDB driver needs cgo.
+func NewDuckDB(path string) (Store, error) {
+    return nil, errors.New("DuckDB support is not compiled in; rebuild with -tags duckdb")
+}
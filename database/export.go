@@ -0,0 +1,137 @@
+package database
+
+import (
+    "database/sql"
+
+    "smart-crawler/models"
+)
+
+// ForEachCrawlPage calls fn with every page of a crawl session, including
+// its body, in id order. Rows are streamed so large crawls are not held in
+// memory.
+func (p *PostgresDB) ForEachCrawlPage(crawlID int64, fn func(*models.Page) error) error {
+    rows, err := p.DB.Query(`
+        SELECT p.id, p.url, COALESCE(p.title, ''), COALESCE(p.status_code, 0), COALESCE(p.content_type, ''),
+               COALESCE(p.size, 0), COALESCE(p.load_time_ms, 0), COALESCE(p.depth, 0), COALESCE(p.parent_url, ''),
+               p.crawled_at, COALESCE(p.hash, ''), p.importance_score, p.content_quality, p.link_density,
+               b.content_encoding, COALESCE(b.content, p.content), b.compressed_content, b.blob_key
+        FROM pages p
+        LEFT JOIN page_bodies b ON b.hash = p.hash
+        WHERE p.crawl_id = $1
+        ORDER BY p.id
+    `, crawlID)
+    if err != nil {
+        return err
+    }
+    defer rows.Close()
+
+    for rows.Next() {
+        page := models.Page{CrawlID: crawlID}
+        var encoding, content, blobKey sql.NullString
+        var compressed []byte
+        err := rows.Scan(&page.ID, &page.URL, &page.Title, &page.StatusCode, &page.ContentType,
+            &page.Size, &page.LoadTime, &page.Depth, &page.ParentURL,
+            &page.CrawledAt, &page.Hash, &page.Importance, &page.ContentQuality, &page.LinkDensity,
+            &encoding, &content, &compressed, &blobKey)
+        if err != nil {
+            return err
+        }
+        if page.Content, err = p.readBody(encoding, content, compressed, blobKey); err != nil {
+            return err
+        }
+        if err := fn(&page); err != nil {
+            return err
+        }
+    }
+
+    return rows.Err()
+}
+
+// ForEachCrawlEdge calls fn with every link discovered during a crawl
+// session, from the page it was found on to its target. Edges come from
+// the crawl queue and from the parents recorded on saved pages, so both
+// crawler modes produce a graph.
+func (p *PostgresDB) ForEachCrawlEdge(crawlID int64, fn func(from, to string) error) error {
+    rows, err := p.DB.Query(`
+        SELECT parent_url, url FROM crawl_queue
+        WHERE crawl_id = $1 AND parent_url IS NOT NULL AND parent_url <> ''
+        UNION
+        SELECT parent_url, url FROM pages
+        WHERE crawl_id = $1 AND parent_url IS NOT NULL AND parent_url <> ''
+        ORDER BY 1, 2
+    `, crawlID)
+    if err != nil {
+        return err
+    }
+    defer rows.Close()
+
+    for rows.Next() {
+        var from, to sql.NullString
+        if err := rows.Scan(&from, &to); err != nil {
+            return err
+        }
+        if err := fn(from.String, to.String); err != nil {
+            return err
+        }
+    }
+
+    return rows.Err()
+}
+
+// ForEachCrawlNode calls fn with every page of a crawl session, without its
+// body, in id order, for exporting the link graph
+func (p *PostgresDB) ForEachCrawlNode(crawlID int64, fn func(*models.Page) error) error {
+    rows, err := p.DB.Query(`
+        SELECT id, url, COALESCE(final_url, ''), COALESCE(title, ''), COALESCE(status_code, 0), COALESCE(depth, 0),
+               COALESCE(importance_score, 0), COALESCE(content_quality, 0), COALESCE(link_density, 0)
+        FROM pages
+        WHERE crawl_id = $1
+        ORDER BY id
+    `, crawlID)
+    if err != nil {
+        return err
+    }
+    defer rows.Close()
+
+    for rows.Next() {
+        page := models.Page{CrawlID: crawlID}
+        err := rows.Scan(&page.ID, &page.URL, &page.FinalURL, &page.Title, &page.StatusCode, &page.Depth,
+            &page.Importance, &page.ContentQuality, &page.LinkDensity)
+        if err != nil {
+            return err
+        }
+        if err := fn(&page); err != nil {
+            return err
+        }
+    }
+
+    return rows.Err()
+}
+
+// ForEachCrawlLink calls fn with every link the smart crawler recorded on
+// the pages of a crawl session, in id order. TargetID is 0 unless the target
+// is known to have been saved.
+func (p *PostgresDB) ForEachCrawlLink(crawlID int64, fn func(*models.Link) error) error {
+    rows, err := p.DB.Query(`
+        SELECT id, source_id, COALESCE(target_id, 0), url, COALESCE(anchor, ''), COALESCE(rel, '')
+        FROM links
+        WHERE crawl_id = $1
+        ORDER BY id
+    `, crawlID)
+    if err != nil {
+        return err
+    }
+    defer rows.Close()
+
+    for rows.Next() {
+        var link models.Link
+        if err := rows.Scan(&link.ID, &link.SourceID, &link.TargetID, &link.URL, &link.Anchor, &link.Rel); err != nil {
+            return err
+        }
+        if err := fn(&link); err != nil {
+            return err
+        }
+    }
+
+    return rows.Err()
+}
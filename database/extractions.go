@@ -0,0 +1,94 @@
+package database
+
+import (
+    "database/sql"
+    "encoding/json"
+
+    "smart-crawler/models"
+)
+
+// saveExtractions replaces the extracted records of a page with extractions
+// in one transaction; both stores share the SQL
+func saveExtractions(db *sql.DB, crawlID, pageID int64, url string, extractions []models.Extraction) error {
+    tx, err := db.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    // A revisited page keeps only what its latest version yielded
+    if _, err := tx.Exec("DELETE FROM extractions WHERE page_id = $1", pageID); err != nil {
+        return err
+    }
+    for _, extraction := range extractions {
+        data, err := json.Marshal(extraction.Fields)
+        if err != nil {
+            return err
+        }
+        _, err = tx.Exec(`
+            INSERT INTO extractions (page_id, crawl_id, url, rule, data)
+            VALUES ($1, $2, $3, $4, $5)
+        `, pageID, crawlID, url, extraction.Rule, string(data))
+        if err != nil {
+            return err
+        }
+    }
+
+    return tx.Commit()
+}
+
+// SaveExtractions replaces the records extraction rules took from a page
+func (p *PostgresDB) SaveExtractions(crawlID, pageID int64, url string, extractions []models.Extraction) error {
+    return saveExtractions(p.DB, crawlID, pageID, url, extractions)
+}
+
+// ListExtractions returns the records extracted in a crawl session, by
+// rule if rule is set, after the one with id afterID in the order they were
+// saved
+func (p *PostgresDB) ListExtractions(crawlID int64, rule string, afterID int64, limit int) ([]models.Extraction, error) {
+    rows, err := p.DB.Query(`
+        SELECT id, page_id, crawl_id, url, rule, data, extracted_at
+        FROM extractions
+        WHERE crawl_id = $1 AND ($2 = '' OR rule = $2) AND id > $3
+        ORDER BY id
+        LIMIT $4
+    `, crawlID, rule, afterID, limit)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+    return scanExtractions(rows)
+}
+
+// GetPageExtractions returns the records extracted from a page
+func (p *PostgresDB) GetPageExtractions(pageID int64) ([]models.Extraction, error) {
+    rows, err := p.DB.Query(`
+        SELECT id, page_id, crawl_id, url, rule, data, extracted_at
+        FROM extractions
+        WHERE page_id = $1
+        ORDER BY rule
+    `, pageID)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+    return scanExtractions(rows)
+}
+
+func scanExtractions(rows *sql.Rows) ([]models.Extraction, error) {
+    extractions := []models.Extraction{}
+    for rows.Next() {
+        var extraction models.Extraction
+        var data []byte
+        err := rows.Scan(&extraction.ID, &extraction.PageID, &extraction.CrawlID, &extraction.URL,
+            &extraction.Rule, &data, &extraction.ExtractedAt)
+        if err != nil {
+            return nil, err
+        }
+        if err := json.Unmarshal(data, &extraction.Fields); err != nil {
+            return nil, err
+        }
+        extractions = append(extractions, extraction)
+    }
+    return extractions, rows.Err()
+}
@@ -0,0 +1,140 @@
+package database
+
+import (
+    "database/sql"
+    "fmt"
+    "time"
+
+    "smart-crawler/models"
+)
+
+// SchemaVersion is the version of the schema createTables builds. Bump it
+// with a change that binaries built before it cannot work with, so they
+// refuse the database instead of misreading it.
+const SchemaVersion = 1
+
+// checkSchemaVersion returns the version a database was last migrated to,
+// 0 if it is new or predates versioning, and fails if a newer binary has
+// migrated it
+func checkSchemaVersion(db *sql.DB) (int, error) {
+    if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_version (version INTEGER NOT NULL)`); err != nil {
+        return 0, err
+    }
+    var version int
+    if err := db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&version); err != nil {
+        return 0, err
+    }
+    if version > SchemaVersion {
+        return version, fmt.Errorf("database schema is at version %d, newer than the %d this binary supports; upgrade the crawler", version, SchemaVersion)
+    }
+    return version, nil
+}
+
+func recordSchemaVersion(db *sql.DB, previous int) error {
+    if previous == SchemaVersion {
+        return nil
+    }
+    tx, err := db.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    if _, err := tx.Exec("DELETE FROM schema_version"); err != nil {
+        return err
+    }
+    if _, err := tx.Exec("INSERT INTO schema_version (version) VALUES ($1)", SchemaVersion); err != nil {
+        return err
+    }
+    return tx.Commit()
+}
+
+func schemaReport(previous int) *models.RepairReport {
+    return &models.RepairReport{
+        SchemaVersion:         SchemaVersion,
+        PreviousSchemaVersion: previous,
+        SchemaUpgraded:        previous != SchemaVersion,
+    }
+}
+
+// SchemaReport is what opening the database found of its schema version,
+// and whether it was migrated
+func (p *PostgresDB) SchemaReport() *models.RepairReport {
+    return schemaReport(p.schemaVersion)
+}
+
+// Repair fixes what crashed runs left behind in the crawl sessions of
+// startURL, and is run before a crawl of startURL starts or resumes. Sessions
+// never finished and with no page saved or checkpoint written for
+// staleAfter are marked finished with stop reason "interrupted", so they
+// stop looking like running crawls; -resume still continues them. Queue
+// rows left pending or claimed for pages that were saved are marked
+// completed, so the next run does not pull them only to skip them, and
+// other claims older than QueueClaimTimeout are returned to pending.
+// Sessions of other seeds, which may be running, are left alone. A
+// staleAfter of 0 leaves sessions unfinished.
+func (p *PostgresDB) Repair(startURL string, staleAfter time.Duration) (*models.RepairReport, error) {
+    report := &models.RepairReport{}
+
+    if staleAfter > 0 {
+        rows, err := p.DB.Query(`
+            WITH activity AS (
+                SELECT c.id, GREATEST(
+                    c.started_at,
+                    (SELECT MAX(crawled_at) FROM pages WHERE crawl_id = c.id),
+                    (SELECT updated_at FROM crawl_checkpoints WHERE start_url = c.start_url)
+                ) AS last_active
+                FROM crawls c
+                WHERE c.finished_at IS NULL AND c.start_url = $2
+            )
+            UPDATE crawls SET
+                finished_at = activity.last_active,
+                stop_reason = 'interrupted',
+                pages_processed = (SELECT COUNT(*) FROM pages WHERE crawl_id = crawls.id)
+            FROM activity
+            WHERE crawls.id = activity.id
+                AND activity.last_active < CURRENT_TIMESTAMP - $1 * INTERVAL '1 second'
+            RETURNING crawls.id
+        `, staleAfter.Seconds(), startURL)
+        if err != nil {
+            return nil, fmt.Errorf("failed to close interrupted crawls: %w", err)
+        }
+        for rows.Next() {
+            var id int64
+            if err := rows.Scan(&id); err != nil {
+                rows.Close()
+                return nil, err
+            }
+            report.InterruptedCrawls = append(report.InterruptedCrawls, id)
+        }
+        rows.Close()
+        if err := rows.Err(); err != nil {
+            return nil, err
+        }
+    }
+
+    result, err := p.DB.Exec(`
+        UPDATE crawl_queue SET status = 'completed'
+        WHERE crawl_id IN (SELECT id FROM crawls WHERE start_url = $1)
+            AND status IN ('pending', 'in_progress')
+            AND EXISTS (SELECT 1 FROM pages WHERE pages.crawl_id = crawl_queue.crawl_id AND pages.url = crawl_queue.url)
+    `, startURL)
+    if err != nil {
+        return nil, fmt.Errorf("failed to complete saved queue rows: %w", err)
+    }
+    completed, _ := result.RowsAffected()
+    report.QueueRowsCompleted = int(completed)
+
+    result, err = p.DB.Exec(`
+        UPDATE crawl_queue SET status = 'pending'
+        WHERE crawl_id IN (SELECT id FROM crawls WHERE start_url = $1)
+            AND status = 'in_progress' AND last_attempt < CURRENT_TIMESTAMP - $2 * INTERVAL '1 second'
+    `, startURL, QueueClaimTimeout.Seconds())
+    if err != nil {
+        return nil, fmt.Errorf("failed to release stale queue claims: %w", err)
+    }
+    released, _ := result.RowsAffected()
+    report.QueueClaimsReleased = int(released)
+
+    return report, nil
+}
@@ -0,0 +1,93 @@
+package database
+
+import (
+    "database/sql"
+
+    "smart-crawler/models"
+)
+
+// saveImages replaces the recorded images of a page with images in one
+// transaction; both stores share the SQL
+func saveImages(db *sql.DB, crawlID, pageID int64, url string, images []models.Image) error {
+    tx, err := db.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    // A revisited page keeps only the images its latest version shows
+    if _, err := tx.Exec("DELETE FROM images WHERE page_id = $1", pageID); err != nil {
+        return err
+    }
+    for _, image := range images {
+        _, err = tx.Exec(`
+            INSERT INTO images (page_id, crawl_id, page_url, src, srcset, alt, html_width, html_height,
+                width, height, format, content_type, size, thumbnail_key, error)
+            VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+        `, pageID, crawlID, url, image.Src, image.Srcset, image.Alt, image.HTMLWidth, image.HTMLHeight,
+            image.Width, image.Height, image.Format, image.ContentType, image.Size, image.ThumbnailKey, image.Error)
+        if err != nil {
+            return err
+        }
+    }
+
+    return tx.Commit()
+}
+
+// SaveImages replaces the images recorded for a page
+func (p *PostgresDB) SaveImages(crawlID, pageID int64, url string, images []models.Image) error {
+    return saveImages(p.DB, crawlID, pageID, url, images)
+}
+
+const imageColumns = `id, page_id, crawl_id, page_url, src, COALESCE(srcset, ''), COALESCE(alt, ''),
+    COALESCE(html_width, ''), COALESCE(html_height, ''), COALESCE(width, 0), COALESCE(height, 0),
+    COALESCE(format, ''), COALESCE(content_type, ''), COALESCE(size, 0), COALESCE(thumbnail_key, ''),
+    COALESCE(error, ''), found_at`
+
+// ListImages returns the images recorded in a crawl session, after the one
+// with id afterID in the order they were saved. Images shown on several
+// pages are listed once per page.
+func (p *PostgresDB) ListImages(crawlID int64, afterID int64, limit int) ([]models.Image, error) {
+    rows, err := p.DB.Query(`
+        SELECT `+imageColumns+`
+        FROM images
+        WHERE crawl_id = $1 AND id > $2
+        ORDER BY id
+        LIMIT $3
+    `, crawlID, afterID, limit)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+    return scanImages(rows)
+}
+
+// GetPageImages returns the images recorded for a page, in page order
+func (p *PostgresDB) GetPageImages(pageID int64) ([]models.Image, error) {
+    rows, err := p.DB.Query(`
+        SELECT `+imageColumns+`
+        FROM images
+        WHERE page_id = $1
+        ORDER BY id
+    `, pageID)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+    return scanImages(rows)
+}
+
+func scanImages(rows *sql.Rows) ([]models.Image, error) {
+    images := []models.Image{}
+    for rows.Next() {
+        var image models.Image
+        err := rows.Scan(&image.ID, &image.PageID, &image.CrawlID, &image.PageURL, &image.Src,
+            &image.Srcset, &image.Alt, &image.HTMLWidth, &image.HTMLHeight, &image.Width, &image.Height,
+            &image.Format, &image.ContentType, &image.Size, &image.ThumbnailKey, &image.Error, &image.FoundAt)
+        if err != nil {
+            return nil, err
+        }
+        images = append(images, image)
+    }
+    return images, rows.Err()
+}
@@ -3,13 +3,19 @@ package database
 import (
     "database/sql"
     "fmt"
+    "strconv"
+    "strings"
+    "time"
 
     _ "github.com/lib/pq"
+    "smart-crawler/blobstore"
     "smart-crawler/models"
 )
 
 type PostgresDB struct {
-    DB *sql.DB
+    DB            *sql.DB
+    schemaVersion int             // Found before createTables migrated it
+    blobs         blobstore.Store // Where new page bodies go; nil keeps them in page_bodies
 }
 
 func NewPostgresDB(databaseURL string) (*PostgresDB, error) {
@@ -31,10 +37,30 @@ func NewPostgresDB(databaseURL string) (*PostgresDB, error) {
 }
 
 func (p *PostgresDB) createTables() error {
+    var err error
+    if p.schemaVersion, err = checkSchemaVersion(p.DB); err != nil {
+        return err
+    }
+
     queries := []string{
+        `CREATE TABLE IF NOT EXISTS crawls (
+            id SERIAL PRIMARY KEY,
+            uuid TEXT,
+            mode TEXT NOT NULL,
+            start_url TEXT NOT NULL,
+            max_depth INTEGER,
+            started_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            finished_at TIMESTAMP,
+            pages_processed INTEGER DEFAULT 0,
+            pages_skipped INTEGER DEFAULT 0,
+            errors INTEGER DEFAULT 0,
+            total_size BIGINT DEFAULT 0,
+            stop_reason TEXT
+        )`,
         `CREATE TABLE IF NOT EXISTS pages (
             id SERIAL PRIMARY KEY,
-            url TEXT UNIQUE NOT NULL,
+            crawl_id BIGINT REFERENCES crawls(id) ON DELETE CASCADE,
+            url TEXT NOT NULL,
             title TEXT,
             content TEXT,
             status_code INTEGER,
@@ -47,19 +73,32 @@ func (p *PostgresDB) createTables() error {
             hash TEXT,
             importance_score FLOAT DEFAULT 0,
             content_quality FLOAT DEFAULT 0,
-            link_density FLOAT DEFAULT 0
+            link_density FLOAT DEFAULT 0,
+            first_crawled_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            revisits INTEGER DEFAULT 0,
+            changes INTEGER DEFAULT 0,
+            next_crawl_at TIMESTAMP,
+            etag TEXT,
+            last_modified TEXT,
+            final_url TEXT,
+            redirect_chain JSONB
         )`,
         `CREATE TABLE IF NOT EXISTS links (
             id SERIAL PRIMARY KEY,
+            crawl_id BIGINT REFERENCES crawls(id) ON DELETE CASCADE,
             source_id BIGINT REFERENCES pages(id),
             target_id BIGINT REFERENCES pages(id),
             url TEXT NOT NULL,
             anchor TEXT,
-            rel TEXT
+            rel TEXT,
+            context_before TEXT,
+            context_after TEXT,
+            heading TEXT
         )`,
         `CREATE TABLE IF NOT EXISTS crawl_queue (
             id SERIAL PRIMARY KEY,
-            url TEXT UNIQUE NOT NULL,
+            crawl_id BIGINT REFERENCES crawls(id) ON DELETE CASCADE,
+            url TEXT NOT NULL,
             priority INTEGER DEFAULT 0,
             depth INTEGER,
             parent_url TEXT,
@@ -68,10 +107,200 @@ func (p *PostgresDB) createTables() error {
             last_attempt TIMESTAMP,
             status TEXT DEFAULT 'pending'
         )`,
+        `CREATE TABLE IF NOT EXISTS page_bodies (
+            hash TEXT PRIMARY KEY,
+            content TEXT,
+            size BIGINT,
+            ref_count INTEGER DEFAULT 0,
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+        )`,
+        `CREATE TABLE IF NOT EXISTS page_tags (
+            page_id BIGINT REFERENCES pages(id) ON DELETE CASCADE,
+            tag TEXT NOT NULL,
+            source TEXT DEFAULT 'manual',
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            PRIMARY KEY (page_id, tag)
+        )`,
+        `CREATE TABLE IF NOT EXISTS crawl_checkpoints (
+            start_url TEXT PRIMARY KEY,
+            state JSONB NOT NULL,
+            updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+        )`,
+        `CREATE TABLE IF NOT EXISTS content_hashes (
+            hash TEXT PRIMARY KEY,
+            simhash BIGINT,
+            crawl_id BIGINT REFERENCES crawls(id) ON DELETE CASCADE,
+            url TEXT,
+            first_seen TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+        )`,
+        `CREATE TABLE IF NOT EXISTS subscriptions (
+            id SERIAL PRIMARY KEY,
+            name TEXT NOT NULL,
+            keywords JSONB NOT NULL DEFAULT '[]',
+            match_all BOOLEAN DEFAULT FALSE,
+            selector TEXT,
+            webhook_url TEXT,
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+        )`,
+        `CREATE TABLE IF NOT EXISTS subscription_matches (
+            id BIGSERIAL PRIMARY KEY,
+            subscription_id BIGINT REFERENCES subscriptions(id) ON DELETE CASCADE,
+            page_id BIGINT REFERENCES pages(id) ON DELETE CASCADE,
+            crawl_id BIGINT REFERENCES crawls(id) ON DELETE CASCADE,
+            url TEXT NOT NULL,
+            title TEXT,
+            snippet TEXT,
+            hash TEXT NOT NULL DEFAULT '',
+            matched_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            UNIQUE (subscription_id, page_id, hash)
+        )`,
+        `CREATE TABLE IF NOT EXISTS url_redirects (
+            crawl_id BIGINT REFERENCES crawls(id) ON DELETE CASCADE,
+            source_url TEXT NOT NULL,
+            target_url TEXT NOT NULL,
+            resolved_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            PRIMARY KEY (crawl_id, source_url)
+        )`,
+        `CREATE TABLE IF NOT EXISTS extractions (
+            id BIGSERIAL PRIMARY KEY,
+            page_id BIGINT REFERENCES pages(id) ON DELETE CASCADE,
+            crawl_id BIGINT REFERENCES crawls(id) ON DELETE CASCADE,
+            url TEXT NOT NULL,
+            rule TEXT NOT NULL,
+            data JSONB NOT NULL,
+            extracted_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+        )`,
+        `CREATE TABLE IF NOT EXISTS page_changes (
+            id BIGSERIAL PRIMARY KEY,
+            page_id BIGINT REFERENCES pages(id) ON DELETE CASCADE,
+            crawl_id BIGINT REFERENCES crawls(id) ON DELETE CASCADE,
+            url TEXT NOT NULL,
+            previous_hash TEXT,
+            hash TEXT,
+            added INTEGER NOT NULL,
+            removed INTEGER NOT NULL,
+            diff TEXT NOT NULL,
+            detected_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+        )`,
+        `CREATE TABLE IF NOT EXISTS images (
+            id BIGSERIAL PRIMARY KEY,
+            page_id BIGINT REFERENCES pages(id) ON DELETE CASCADE,
+            crawl_id BIGINT REFERENCES crawls(id) ON DELETE CASCADE,
+            page_url TEXT NOT NULL,
+            src TEXT NOT NULL,
+            srcset TEXT,
+            alt TEXT,
+            html_width TEXT,
+            html_height TEXT,
+            width INTEGER,
+            height INTEGER,
+            format TEXT,
+            content_type TEXT,
+            size BIGINT,
+            thumbnail_key TEXT,
+            error TEXT,
+            found_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+        )`,
+        `CREATE TABLE IF NOT EXISTS benchmark_results (
+            id BIGSERIAL PRIMARY KEY,
+            ran_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            label TEXT,
+            config JSONB NOT NULL,
+            crawlers JSONB NOT NULL
+        )`,
+        // Databases created before crawl sessions: URLs were unique globally,
+        // now only within a crawl. Rows written earlier keep a NULL crawl_id.
+        `ALTER TABLE pages ADD COLUMN IF NOT EXISTS crawl_id BIGINT REFERENCES crawls(id) ON DELETE CASCADE`,
+        `ALTER TABLE links ADD COLUMN IF NOT EXISTS crawl_id BIGINT REFERENCES crawls(id) ON DELETE CASCADE`,
+        `ALTER TABLE crawl_queue ADD COLUMN IF NOT EXISTS crawl_id BIGINT REFERENCES crawls(id) ON DELETE CASCADE`,
+        `ALTER TABLE crawls ADD COLUMN IF NOT EXISTS stop_reason TEXT`,
+        `ALTER TABLE crawls ADD COLUMN IF NOT EXISTS uuid TEXT`,
+        // Crawls recorded before UUIDs get one, so every session has one
+        `UPDATE crawls SET uuid = gen_random_uuid()::TEXT WHERE uuid IS NULL`,
+        `ALTER TABLE links ADD COLUMN IF NOT EXISTS context_before TEXT`,
+        `ALTER TABLE links ADD COLUMN IF NOT EXISTS context_after TEXT`,
+        `ALTER TABLE links ADD COLUMN IF NOT EXISTS heading TEXT`,
+        `ALTER TABLE links ADD COLUMN IF NOT EXISTS classes TEXT`,
+        `ALTER TABLE pages ADD COLUMN IF NOT EXISTS first_crawled_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP`,
+        `ALTER TABLE pages ADD COLUMN IF NOT EXISTS revisits INTEGER DEFAULT 0`,
+        `ALTER TABLE pages ADD COLUMN IF NOT EXISTS changes INTEGER DEFAULT 0`,
+        `ALTER TABLE pages ADD COLUMN IF NOT EXISTS next_crawl_at TIMESTAMP`,
+        `ALTER TABLE pages ADD COLUMN IF NOT EXISTS etag TEXT`,
+        `ALTER TABLE pages ADD COLUMN IF NOT EXISTS last_modified TEXT`,
+        `ALTER TABLE pages ADD COLUMN IF NOT EXISTS final_url TEXT`,
+        `ALTER TABLE pages ADD COLUMN IF NOT EXISTS redirect_chain JSONB`,
+        `ALTER TABLE pages ADD COLUMN IF NOT EXISTS truncated BOOLEAN DEFAULT FALSE`,
+        `ALTER TABLE pages ADD COLUMN IF NOT EXISTS content_encoding TEXT`,
+        `ALTER TABLE pages ADD COLUMN IF NOT EXISTS compressed_size BIGINT`,
+        `ALTER TABLE pages ADD COLUMN IF NOT EXISTS structured_data JSONB`,
+        `ALTER TABLE pages ADD COLUMN IF NOT EXISTS og_title TEXT`,
+        `ALTER TABLE pages ADD COLUMN IF NOT EXISTS og_description TEXT`,
+        `ALTER TABLE pages ADD COLUMN IF NOT EXISTS og_image TEXT`,
+        `ALTER TABLE pages ADD COLUMN IF NOT EXISTS canonical_url TEXT`,
+        `ALTER TABLE pages ADD COLUMN IF NOT EXISTS listing BOOLEAN DEFAULT FALSE`,
+        // Near-duplicate lookups compare the start of each page's visible
+        // text by trigrams; pages saved before have none and are not compared.
+        // Its pg_trgm index is made by PrepareSimilarity.
+        `ALTER TABLE pages ADD COLUMN IF NOT EXISTS text_sample TEXT`,
+        `ALTER TABLE pages ADD COLUMN IF NOT EXISTS protocol TEXT`,
+        // Where each fetch's time went, in milliseconds
+        `ALTER TABLE pages ADD COLUMN IF NOT EXISTS dns_ms DOUBLE PRECISION`,
+        `ALTER TABLE pages ADD COLUMN IF NOT EXISTS connect_ms DOUBLE PRECISION`,
+        `ALTER TABLE pages ADD COLUMN IF NOT EXISTS tls_ms DOUBLE PRECISION`,
+        `ALTER TABLE pages ADD COLUMN IF NOT EXISTS ttfb_ms DOUBLE PRECISION`,
+        `ALTER TABLE pages ADD COLUMN IF NOT EXISTS download_ms DOUBLE PRECISION`,
+        `ALTER TABLE pages ADD COLUMN IF NOT EXISTS headers JSONB`,
+        // The TLS version, cipher suite, and certificate of HTTPS fetches
+        `ALTER TABLE pages ADD COLUMN IF NOT EXISTS tls JSONB`,
+        // Relevance to the crawl's topic; 0 for crawls without one
+        `ALTER TABLE pages ADD COLUMN IF NOT EXISTS relevance FLOAT DEFAULT 0`,
+        // Bodies are stored zstd-compressed in compressed_content; those
+        // written before have no content_encoding until migrate -compress-bodies
+        `ALTER TABLE page_bodies ADD COLUMN IF NOT EXISTS content_encoding TEXT`,
+        `ALTER TABLE page_bodies ADD COLUMN IF NOT EXISTS compressed_content BYTEA`,
+        // Key of the body in the blob store, when it is kept there
+        `ALTER TABLE page_bodies ADD COLUMN IF NOT EXISTS blob_key TEXT`,
+        // Failed fetches wait until retry_at; the last error stays with URLs
+        // marked failed after their final attempt
+        `ALTER TABLE crawl_queue ADD COLUMN IF NOT EXISTS last_error TEXT`,
+        `ALTER TABLE crawl_queue ADD COLUMN IF NOT EXISTS retry_at TIMESTAMP`,
+        // Variants of a URL, e.g. with a session ID, share a fingerprint,
+        // by which the queue holds them once
+        `ALTER TABLE crawl_queue ADD COLUMN IF NOT EXISTS fingerprint TEXT`,
+        `ALTER TABLE pages ADD COLUMN IF NOT EXISTS fingerprint TEXT`,
+        // Pages the spam filter flagged, whose links were not followed, and
+        // the signals that scored them, comma-separated
+        `ALTER TABLE pages ADD COLUMN IF NOT EXISTS spam BOOLEAN DEFAULT FALSE`,
+        `ALTER TABLE pages ADD COLUMN IF NOT EXISTS spam_score FLOAT DEFAULT 0`,
+        `ALTER TABLE pages ADD COLUMN IF NOT EXISTS spam_signals TEXT`,
+        `ALTER TABLE pages DROP CONSTRAINT IF EXISTS pages_url_key`,
+        `ALTER TABLE crawl_queue DROP CONSTRAINT IF EXISTS crawl_queue_url_key`,
+        `CREATE UNIQUE INDEX IF NOT EXISTS idx_crawls_uuid ON crawls(uuid)`,
+        `CREATE UNIQUE INDEX IF NOT EXISTS idx_pages_crawl_url ON pages(crawl_id, url)`,
+        `CREATE UNIQUE INDEX IF NOT EXISTS idx_crawl_queue_crawl_url ON crawl_queue(crawl_id, url)`,
+        `CREATE INDEX IF NOT EXISTS idx_links_crawl ON links(crawl_id)`,
+        `CREATE INDEX IF NOT EXISTS idx_links_source ON links(source_id)`,
+        `CREATE INDEX IF NOT EXISTS idx_links_unresolved ON links(crawl_id, url) WHERE target_id IS NULL`,
+        `CREATE INDEX IF NOT EXISTS idx_pages_next_crawl ON pages(crawl_id, next_crawl_at)`,
         `CREATE INDEX IF NOT EXISTS idx_pages_url ON pages(url)`,
+        `CREATE INDEX IF NOT EXISTS idx_pages_final_url ON pages(crawl_id, final_url)`,
+        `CREATE INDEX IF NOT EXISTS idx_pages_canonical_url ON pages(crawl_id, canonical_url)`,
         `CREATE INDEX IF NOT EXISTS idx_pages_hash ON pages(hash)`,
         `CREATE INDEX IF NOT EXISTS idx_crawl_queue_priority ON crawl_queue(priority DESC, scheduled_at)`,
         `CREATE INDEX IF NOT EXISTS idx_crawl_queue_status ON crawl_queue(status)`,
+        `CREATE INDEX IF NOT EXISTS idx_crawl_queue_claim ON crawl_queue(crawl_id, status, priority DESC, scheduled_at)`,
+        `CREATE INDEX IF NOT EXISTS idx_crawl_queue_fingerprint ON crawl_queue(crawl_id, fingerprint)`,
+        `CREATE INDEX IF NOT EXISTS idx_pages_fingerprint ON pages(crawl_id, fingerprint)`,
+        `CREATE INDEX IF NOT EXISTS idx_pages_spam ON pages(crawl_id) WHERE spam`,
+        `CREATE INDEX IF NOT EXISTS idx_page_tags_tag ON page_tags(tag)`,
+        `CREATE INDEX IF NOT EXISTS idx_extractions_page ON extractions(page_id)`,
+        `CREATE INDEX IF NOT EXISTS idx_extractions_crawl_rule ON extractions(crawl_id, rule, id)`,
+        `CREATE INDEX IF NOT EXISTS idx_images_page ON images(page_id)`,
+        `CREATE INDEX IF NOT EXISTS idx_page_changes_page ON page_changes(page_id)`,
+        `CREATE INDEX IF NOT EXISTS idx_page_changes_crawl ON page_changes(crawl_id, id)`,
+        `CREATE INDEX IF NOT EXISTS idx_images_crawl ON images(crawl_id, id)`,
+        `CREATE INDEX IF NOT EXISTS idx_images_src ON images(crawl_id, src)`,
+        `CREATE INDEX IF NOT EXISTS idx_pages_structured_data ON pages USING GIN (structured_data jsonb_path_ops)`,
     }
 
     for _, query := range queries {
@@ -80,14 +309,138 @@ func (p *PostgresDB) createTables() error {
         }
     }
 
-    return nil
+    return recordSchemaVersion(p.DB, p.schemaVersion)
 }
 
+// SavePage upserts a page by crawl and URL. The body is stored once per content hash
+// in page_bodies and referenced from pages, so aliased URLs share storage.
 func (p *PostgresDB) SavePage(page *models.Page) error {
+    return p.SavePages([]models.PageWrite{{Page: page}})
+}
+
+// pageRow is one row of the pages upsert, numbered for its first page
+const pageRow = `($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, NULLIF($17, ''), $18, $19, NULLIF($20, ''), NULLIF($21, 0), $22, NULLIF($23, ''), NULLIF($24, ''), NULLIF($25, ''), NULLIF($26, ''), $27, $28, NULLIF($29, ''), $30, $31, $32, $33, $34, $35, $36, $37, NULLIF($38, ''), $39, $40, NULLIF($41, ''))`
+
+// SavePages saves a batch of pages and their links in one transaction: the
+// pages in multi-row upserts, their bodies and link resolution through
+// statements prepared once per batch. Each page gets its ID.
+func (p *PostgresDB) SavePages(writes []models.PageWrite) error {
+    if len(writes) == 0 {
+        return nil
+    }
+    tx, err := p.DB.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    unique := uniqueWrites(writes)
+    pages := make([]*models.Page, len(unique))
+    for i, write := range unique {
+        pages[i] = write.Page
+    }
+
+    // Lock the rows being replaced and note the bodies they release
+    oldHashes, err := lockPages(tx, pages)
+    if err != nil {
+        return err
+    }
+    if err := p.storeBodies(tx, pages); err != nil {
+        return err
+    }
+
+    ids := make(map[string]int64, len(pages))
+    for start := 0; start < len(pages); start += pageBatchSize {
+        if err := upsertPages(tx, pages[start:min(start+pageBatchSize, len(pages))], ids); err != nil {
+            return err
+        }
+    }
+    for _, write := range writes {
+        write.Page.ID = ids[pageKey(write.Page.CrawlID, write.Page.URL)]
+    }
+
+    if err := replaceLinks(tx, unique); err != nil {
+        return err
+    }
+
+    hashes := oldHashes
+    for _, page := range pages {
+        hashes = append(hashes, page.Hash)
+    }
+    orphans, err := refreshBodyRefs(tx, hashes...)
+    if err != nil {
+        return err
+    }
+
+    if err := tx.Commit(); err != nil {
+        return err
+    }
+    p.deleteBlobs(orphans)
+    return nil
+}
+
+// lockPages locks the stored rows of pages about to be rewritten and
+// returns the hashes of their bodies
+func lockPages(tx *sql.Tx, pages []*models.Page) ([]string, error) {
+    stmt, err := tx.Prepare("SELECT hash FROM pages WHERE crawl_id = $1 AND url = $2 FOR UPDATE")
+    if err != nil {
+        return nil, err
+    }
+    defer stmt.Close()
+
+    var hashes []string
+    for _, page := range pages {
+        var hash sql.NullString
+        err := stmt.QueryRow(page.CrawlID, page.URL).Scan(&hash)
+        if err != nil && err != sql.ErrNoRows {
+            return nil, err
+        }
+        if hash.Valid {
+            hashes = append(hashes, hash.String)
+        }
+    }
+    return hashes, nil
+}
+
+// upsertPages writes pages with distinct URLs in one statement and records
+// their IDs in ids by pageKey
+func upsertPages(tx *sql.Tx, pages []*models.Page, ids map[string]int64) error {
+    args := make([]interface{}, 0, len(pages)*41)
+    for _, page := range pages {
+        chain, err := redirectChain(page)
+        if err != nil {
+            return err
+        }
+        structured, err := structuredData(page)
+        if err != nil {
+            return err
+        }
+        headers, err := pageHeaders(page)
+        if err != nil {
+            return err
+        }
+        tls, err := pageTLS(page)
+        if err != nil {
+            return err
+        }
+        // Content lives in page_bodies; pages.content is only kept for rows
+        // written before content-addressed storage.
+        args = append(args,
+            page.URL, page.Title, nil, page.StatusCode, page.ContentType,
+            page.Size, page.LoadTime, page.Depth, page.ParentURL, page.Hash,
+            page.Importance, page.ContentQuality, page.LinkDensity, // <-- use directly
+            page.CrawlID, page.ETag, page.LastModified, page.FinalURL, chain, page.Truncated,
+            page.Encoding, page.CompressedSize, structured, page.OGTitle, page.OGDescription, page.OGImage, page.CanonicalURL, page.Listing,
+            pageSample(page), page.Protocol,
+        )
+        args = append(args, pageTiming(page)...)
+        args = append(args, headers, page.Relevance, tls, page.Fingerprint, page.Spam, page.SpamScore, strings.Join(page.SpamSignals, ","))
+    }
+
     query := `
-        INSERT INTO pages (url, title, content, status_code, content_type, size, load_time_ms, depth, parent_url, hash, importance_score, content_quality, link_density)
-        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
-        ON CONFLICT (url) DO UPDATE SET
+        INSERT INTO pages (url, title, content, status_code, content_type, size, load_time_ms, depth, parent_url, hash, importance_score, content_quality, link_density, crawl_id, etag, last_modified, final_url, redirect_chain, truncated, content_encoding, compressed_size, structured_data, og_title, og_description, og_image, canonical_url, listing, text_sample, protocol, dns_ms, connect_ms, tls_ms, ttfb_ms, download_ms, headers, relevance, tls, fingerprint, spam, spam_score, spam_signals)
+        VALUES ` + valuesRows(pageRow, len(pages), 41) + `
+        ON CONFLICT (crawl_id, url) DO UPDATE SET
             title = EXCLUDED.title,
             content = EXCLUDED.content,
             status_code = EXCLUDED.status_code,
@@ -98,36 +451,138 @@ func (p *PostgresDB) SavePage(page *models.Page) error {
             hash = EXCLUDED.hash,
             importance_score = EXCLUDED.importance_score,
             content_quality = EXCLUDED.content_quality,
-            link_density = EXCLUDED.link_density
-        RETURNING id`
-
-    err := p.DB.QueryRow(query,
-        page.URL, page.Title, page.Content, page.StatusCode, page.ContentType,
-        page.Size, page.LoadTime, page.Depth, page.ParentURL, page.Hash,
-        page.Importance, page.ContentQuality, page.LinkDensity, // <-- use directly
-    ).Scan(&page.ID)
+            link_density = EXCLUDED.link_density,
+            etag = EXCLUDED.etag,
+            last_modified = EXCLUDED.last_modified,
+            final_url = EXCLUDED.final_url,
+            redirect_chain = EXCLUDED.redirect_chain,
+            truncated = EXCLUDED.truncated,
+            content_encoding = EXCLUDED.content_encoding,
+            compressed_size = EXCLUDED.compressed_size,
+            structured_data = EXCLUDED.structured_data,
+            og_title = EXCLUDED.og_title,
+            og_description = EXCLUDED.og_description,
+            og_image = EXCLUDED.og_image,
+            canonical_url = EXCLUDED.canonical_url,
+            listing = EXCLUDED.listing,
+            text_sample = EXCLUDED.text_sample,
+            protocol = EXCLUDED.protocol,
+            dns_ms = EXCLUDED.dns_ms,
+            connect_ms = EXCLUDED.connect_ms,
+            tls_ms = EXCLUDED.tls_ms,
+            ttfb_ms = EXCLUDED.ttfb_ms,
+            download_ms = EXCLUDED.download_ms,
+            headers = EXCLUDED.headers,
+            relevance = EXCLUDED.relevance,
+            tls = EXCLUDED.tls,
+            fingerprint = EXCLUDED.fingerprint,
+            spam = EXCLUDED.spam,
+            spam_score = EXCLUDED.spam_score,
+            spam_signals = EXCLUDED.spam_signals
+        RETURNING id, crawl_id, url`
 
-    return err
+    rows, err := tx.Query(query, args...)
+    if err != nil {
+        return err
+    }
+    defer rows.Close()
+    for rows.Next() {
+        var id, crawlID int64
+        var url string
+        if err := rows.Scan(&id, &crawlID, &url); err != nil {
+            return err
+        }
+        ids[pageKey(crawlID, url)] = id
+    }
+    return rows.Err()
 }
 
-func (p *PostgresDB) IsURLCrawled(url string) (bool, error) {
+func (p *PostgresDB) IsURLCrawled(crawlID int64, url string) (bool, error) {
     var count int
-    err := p.DB.QueryRow("SELECT COUNT(*) FROM pages WHERE url = $1", url).Scan(&count)
+    err := p.DB.QueryRow("SELECT COUNT(*) FROM pages WHERE crawl_id = $1 AND (url = $2 OR final_url = $2 OR canonical_url = $2)", crawlID, url).Scan(&count)
     return count > 0, err
 }
 
-func (p *PostgresDB) AddToQueue(urls []models.URLPriority) error {
+// IsFingerprintCrawled reports whether a crawl has saved a page under a
+// URL with this fingerprint
+func (p *PostgresDB) IsFingerprintCrawled(crawlID int64, fingerprint string) (bool, error) {
+    var exists bool
+    err := p.DB.QueryRow("SELECT EXISTS (SELECT 1 FROM pages WHERE crawl_id = $1 AND fingerprint = $2)", crawlID, fingerprint).Scan(&exists)
+    return exists, err
+}
+
+// HasContentHash reports whether a crawl has saved a page with this hash
+func (p *PostgresDB) HasContentHash(crawlID int64, hash string) (bool, error) {
+    var exists bool
+    err := p.DB.QueryRow("SELECT EXISTS (SELECT 1 FROM pages WHERE crawl_id = $1 AND hash = $2)", crawlID, hash).Scan(&exists)
+    return exists, err
+}
+
+// ForEachContentHash calls fn with the content hash of every page a crawl
+// saved, so a resumed crawl can restore what its duplicate detector had seen
+func (p *PostgresDB) ForEachContentHash(crawlID int64, fn func(hash string) error) error {
+    return forEachContentHash(p.DB, crawlID, fn)
+}
+
+// ClaimContentHash records that a crawl saved content with this hash, unless
+// some crawl already did. It reports whether this call claimed the hash and
+// which crawl holds it.
+func (p *PostgresDB) ClaimContentHash(crawlID int64, url, hash string, simhash int64) (bool, int64, error) {
+    result, err := p.DB.Exec(`
+        INSERT INTO content_hashes (hash, simhash, crawl_id, url)
+        VALUES ($1, $2, $3, $4)
+        ON CONFLICT (hash) DO NOTHING
+    `, hash, simhash, crawlID, url)
+    if err != nil {
+        return false, 0, err
+    }
+    claimed, err := result.RowsAffected()
+    if err != nil {
+        return false, 0, err
+    }
+    if claimed > 0 {
+        return true, crawlID, nil
+    }
+
+    var holder int64
+    err = p.DB.QueryRow("SELECT crawl_id FROM content_hashes WHERE hash = $1", hash).Scan(&holder)
+    return false, holder, err
+}
+
+// SaveRedirect records that a shortener or tracking redirect URL found in a
+// crawl leads to targetURL
+func (p *PostgresDB) SaveRedirect(crawlID int64, sourceURL, targetURL string) error {
+    _, err := p.DB.Exec(`
+        INSERT INTO url_redirects (crawl_id, source_url, target_url)
+        VALUES ($1, $2, $3)
+        ON CONFLICT (crawl_id, source_url) DO NOTHING
+    `, crawlID, sourceURL, targetURL)
+    return err
+}
+
+// AddToQueue queues URLs once per fingerprint: a URL whose fingerprint is
+// queued under another URL raises that URL's priority instead
+func (p *PostgresDB) AddToQueue(crawlID int64, urls []models.URLPriority) error {
     tx, err := p.DB.Begin()
     if err != nil {
         return err
     }
     defer tx.Rollback()
 
+    raise, err := tx.Prepare(`
+        UPDATE crawl_queue SET priority = GREATEST(priority, $3)
+        WHERE crawl_id = $1 AND fingerprint = $2 AND url <> $4
+    `)
+    if err != nil {
+        return err
+    }
+    defer raise.Close()
     stmt, err := tx.Prepare(`
-        INSERT INTO crawl_queue (url, priority, depth, parent_url)
-        VALUES ($1, $2, $3, $4)
-        ON CONFLICT (url) DO UPDATE SET
-            priority = GREATEST(crawl_queue.priority, EXCLUDED.priority)
+        INSERT INTO crawl_queue (crawl_id, url, priority, depth, parent_url, fingerprint)
+        VALUES ($1, $2, $3, $4, $5, $6)
+        ON CONFLICT (crawl_id, url) DO UPDATE SET
+            priority = GREATEST(crawl_queue.priority, EXCLUDED.priority),
+            fingerprint = COALESCE(crawl_queue.fingerprint, EXCLUDED.fingerprint)
     `)
     if err != nil {
         return err
@@ -135,7 +590,15 @@ func (p *PostgresDB) AddToQueue(urls []models.URLPriority) error {
     defer stmt.Close()
 
     for _, urlPriority := range urls {
-        _, err := stmt.Exec(urlPriority.URL, urlPriority.Priority, urlPriority.Depth, urlPriority.Parent)
+        fingerprint := queueFingerprint(urlPriority)
+        result, err := raise.Exec(crawlID, fingerprint, urlPriority.Priority, urlPriority.URL)
+        if err != nil {
+            return err
+        }
+        if raised, err := result.RowsAffected(); err != nil || raised > 0 {
+            continue
+        }
+        _, err = stmt.Exec(crawlID, urlPriority.URL, urlPriority.Priority, urlPriority.Depth, urlPriority.Parent, fingerprint)
         if err != nil {
             return err
         }
@@ -144,16 +607,83 @@ func (p *PostgresDB) AddToQueue(urls []models.URLPriority) error {
     return tx.Commit()
 }
 
-func (p *PostgresDB) GetNextURLs(limit int) ([]models.URLPriority, error) {
-    query := `
-        SELECT url, priority, depth, parent_url
-        FROM crawl_queue
-        WHERE status = 'pending'
-        ORDER BY priority DESC, scheduled_at ASC
-        LIMIT $1
-    `
+const (
+    // Pending URLs whose priorities fall in the same band of this width are
+    // handed out round-robin by parent page.
+    fairnessBand = 10
+    // A claim ranks up to this many times its limit of top candidates
+    fairnessScan = 10
+)
+
+// GetNextURLs claims the highest priority pending URLs, marking them
+// in_progress. Within a priority band it takes one URL from each parent page
+// before a second from any, so a hub page with thousands of links cannot
+// monopolize the batch. Only the top limit*fairnessScan pending URLs, read
+// in order from idx_crawl_queue_claim, are ranked, so a claim costs the same
+// however large the frontier is. Rows another crawler is claiming are
+// skipped, so no URL is handed out twice. URLs of exceptHosts (host and
+// port, as in net/url) are left pending.
+func (p *PostgresDB) GetNextURLs(crawlID int64, limit int, exceptHosts []string) ([]models.URLPriority, error) {
+    return p.claimURLs(`
+        WITH candidates AS (
+            SELECT id, priority, parent_url, scheduled_at
+            FROM crawl_queue
+            WHERE crawl_id = $1 AND status = 'pending' AND (retry_at IS NULL OR retry_at <= CURRENT_TIMESTAMP)
+              AND ($4 = '' OR NOT COALESCE(substring(url from '^[^:/]+://([^/?#]+)'), '') = ANY(string_to_array($4, E'\n')))
+            ORDER BY priority DESC, scheduled_at ASC
+            LIMIT $5
+        ), ranked AS (
+            SELECT id, priority / $3 AS band,
+                   ROW_NUMBER() OVER (
+                       PARTITION BY priority / $3, COALESCE(parent_url, '')
+                       ORDER BY priority DESC, scheduled_at ASC
+                   ) AS parent_rank
+            FROM candidates
+        ), picked AS (
+            SELECT q.id, r.band, r.parent_rank
+            FROM crawl_queue q
+            JOIN ranked r ON r.id = q.id
+            WHERE q.status = 'pending'
+            ORDER BY r.band DESC, r.parent_rank ASC, q.priority DESC, q.scheduled_at ASC
+            LIMIT $2
+            FOR UPDATE OF q SKIP LOCKED
+        ), claimed AS (
+            UPDATE crawl_queue q SET status = 'in_progress', last_attempt = CURRENT_TIMESTAMP
+            FROM picked
+            WHERE q.id = picked.id
+            RETURNING q.url, q.priority, q.depth, q.parent_url, q.fingerprint, q.scheduled_at, picked.band, picked.parent_rank
+        )
+        SELECT url, priority, depth, parent_url, fingerprint
+        FROM claimed
+        ORDER BY band DESC, parent_rank ASC, priority DESC, scheduled_at ASC
+    `, crawlID, limit, fairnessBand, strings.Join(exceptHosts, "\n"), limit*fairnessScan)
+}
 
-    rows, err := p.DB.Query(query, limit)
+// GetOldestURLs claims pending URLs in the order they were queued, ignoring
+// priority. It is the baseline that holdout evaluations compare against.
+func (p *PostgresDB) GetOldestURLs(crawlID int64, limit int) ([]models.URLPriority, error) {
+    return p.claimURLs(`
+        WITH picked AS (
+            SELECT id FROM crawl_queue
+            WHERE crawl_id = $1 AND status = 'pending' AND (retry_at IS NULL OR retry_at <= CURRENT_TIMESTAMP)
+            ORDER BY scheduled_at ASC, id ASC
+            LIMIT $2
+            FOR UPDATE SKIP LOCKED
+        ), claimed AS (
+            UPDATE crawl_queue q SET status = 'in_progress', last_attempt = CURRENT_TIMESTAMP
+            FROM picked
+            WHERE q.id = picked.id
+            RETURNING q.id, q.url, q.priority, q.depth, q.parent_url, q.fingerprint, q.scheduled_at
+        )
+        SELECT url, priority, depth, parent_url, fingerprint
+        FROM claimed
+        ORDER BY scheduled_at ASC, id ASC
+    `, crawlID, limit)
+}
+
+// claimURLs runs a query claiming queue rows and returns their URLs
+func (p *PostgresDB) claimURLs(query string, args ...interface{}) ([]models.URLPriority, error) {
+    rows, err := p.DB.Query(query, args...)
     if err != nil {
         return nil, err
     }
@@ -162,42 +692,347 @@ func (p *PostgresDB) GetNextURLs(limit int) ([]models.URLPriority, error) {
     var urls []models.URLPriority
     for rows.Next() {
         var url models.URLPriority
-        err := rows.Scan(&url.URL, &url.Priority, &url.Depth, &url.Parent)
-        if err != nil {
+        var parent, fingerprint sql.NullString
+        if err := rows.Scan(&url.URL, &url.Priority, &url.Depth, &parent, &fingerprint); err != nil {
             return nil, err
         }
+        url.Parent, url.Fingerprint = parent.String, fingerprint.String
         urls = append(urls, url)
     }
 
-    return urls, nil
+    return urls, rows.Err()
+}
+
+// ReapQueue returns URLs claimed more than staleAfter ago and never marked
+// processed, as their crawler presumably died, to pending, and returns how
+// many
+func (p *PostgresDB) ReapQueue(staleAfter time.Duration) (int, error) {
+    result, err := p.DB.Exec(`
+        UPDATE crawl_queue SET status = 'pending'
+        WHERE status = 'in_progress' AND last_attempt < CURRENT_TIMESTAMP - $1 * INTERVAL '1 second'
+    `, staleAfter.Seconds())
+    if err != nil {
+        return 0, err
+    }
+    reaped, err := result.RowsAffected()
+    return int(reaped), err
+}
+
+func (p *PostgresDB) MarkURLProcessed(crawlID int64, url string) error {
+    _, err := p.DB.Exec("UPDATE crawl_queue SET status = 'completed' WHERE crawl_id = $1 AND url = $2", crawlID, url)
+    return err
+}
+
+// DeferQueue marks the pending URLs of a crawl stopped by its budget as
+// deferred, so they are kept for a resumed crawl, and returns how many. URLs
+// claimed but left unfetched when the budget ran out are deferred too.
+func (p *PostgresDB) DeferQueue(crawlID int64) (int, error) {
+    result, err := p.DB.Exec("UPDATE crawl_queue SET status = 'deferred' WHERE crawl_id = $1 AND status IN ('pending', 'in_progress')", crawlID)
+    if err != nil {
+        return 0, err
+    }
+    deferred, err := result.RowsAffected()
+    return int(deferred), err
 }
 
-func (p *PostgresDB) MarkURLProcessed(url string) error {
-    _, err := p.DB.Exec("UPDATE crawl_queue SET status = 'completed' WHERE url = $1", url)
+// RequeueDeferred makes the deferred URLs of a crawl pending again, along
+// with the URLs an interrupted run claimed and never finished
+func (p *PostgresDB) RequeueDeferred(crawlID int64) error {
+    _, err := p.DB.Exec("UPDATE crawl_queue SET status = 'pending' WHERE crawl_id = $1 AND status IN ('deferred', 'in_progress')", crawlID)
     return err
 }
 
-func (p *PostgresDB) GetSimilarContent(hash string, threshold float64) ([]models.Page, error) {
-    // Simplified similarity check - in production, use more sophisticated algorithms
-    query := `SELECT id, url, title, hash FROM pages WHERE hash = $1 LIMIT 5`
-    
-    rows, err := p.DB.Query(query, hash)
+// CountPendingURLs returns how many URLs of a crawl are queued to be
+// fetched, retries waiting out their backoff included
+func (p *PostgresDB) CountPendingURLs(crawlID int64) (int, error) {
+    var pending int
+    err := p.DB.QueryRow(`
+        SELECT COUNT(*) FROM crawl_queue WHERE crawl_id = $1 AND status = 'pending'
+    `, crawlID).Scan(&pending)
+    return pending, err
+}
+
+// GetPendingURLs returns the pending URLs of a crawl starting with origin,
+// e.g. "https://example.com"
+func (p *PostgresDB) GetPendingURLs(crawlID int64, origin string) ([]string, error) {
+    rows, err := p.DB.Query(`
+        SELECT url FROM crawl_queue
+        WHERE crawl_id = $1 AND status = 'pending' AND left(url, char_length($2::text)) = $2::text
+    `, crawlID, origin)
     if err != nil {
         return nil, err
     }
     defer rows.Close()
 
-    var pages []models.Page
+    var urls []string
     for rows.Next() {
-        var page models.Page
-        err := rows.Scan(&page.ID, &page.URL, &page.Title, &page.Hash)
+        var url string
+        if err := rows.Scan(&url); err != nil {
+            return nil, err
+        }
+        urls = append(urls, url)
+    }
+    return urls, rows.Err()
+}
+
+// DisallowQueuedURLs takes pending URLs that robots.txt no longer allows out
+// of a crawl's queue, marking them disallowed, and returns how many
+func (p *PostgresDB) DisallowQueuedURLs(crawlID int64, urls []string) (int, error) {
+    tx, err := p.DB.Begin()
+    if err != nil {
+        return 0, err
+    }
+    defer tx.Rollback()
+
+    stmt, err := tx.Prepare("UPDATE crawl_queue SET status = 'disallowed' WHERE crawl_id = $1 AND url = $2 AND status = 'pending'")
+    if err != nil {
+        return 0, err
+    }
+    defer stmt.Close()
+
+    disallowed := 0
+    for _, url := range urls {
+        result, err := stmt.Exec(crawlID, url)
+        if err != nil {
+            return 0, err
+        }
+        n, _ := result.RowsAffected()
+        disallowed += int(n)
+    }
+    return disallowed, tx.Commit()
+}
+
+// ReleaseURLs returns URLs a crawl claimed but did not fetch to its queue as
+// pending, and returns how many. URLs another crawler has since finished or
+// claimed again are left alone.
+func (p *PostgresDB) ReleaseURLs(crawlID int64, urls []string) (int, error) {
+    tx, err := p.DB.Begin()
+    if err != nil {
+        return 0, err
+    }
+    defer tx.Rollback()
+
+    stmt, err := tx.Prepare("UPDATE crawl_queue SET status = 'pending' WHERE crawl_id = $1 AND url = $2 AND status = 'in_progress'")
+    if err != nil {
+        return 0, err
+    }
+    defer stmt.Close()
+
+    released := 0
+    for _, url := range urls {
+        result, err := stmt.Exec(crawlID, url)
         if err != nil {
+            return 0, err
+        }
+        n, _ := result.RowsAffected()
+        released += int(n)
+    }
+    return released, tx.Commit()
+}
+
+// PrepareSimilarity sets up the pg_trgm extension and the trigram index on
+// pages' text samples that similarity lookups need. They are left out of the
+// startup migrations, as creating an extension takes a privilege managed
+// databases often withhold, and only near-duplicate lookups use them.
+func (p *PostgresDB) PrepareSimilarity() error {
+    var installed bool
+    err := p.DB.QueryRow("SELECT EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'pg_trgm')").Scan(&installed)
+    if err != nil {
+        return err
+    }
+    if !installed {
+        if _, err := p.DB.Exec("CREATE EXTENSION IF NOT EXISTS pg_trgm"); err != nil {
+            return fmt.Errorf("near-duplicate lookups need the pg_trgm extension, which could not be created (%v); have a database owner run CREATE EXTENSION pg_trgm", err)
+        }
+    }
+    _, err = p.DB.Exec("CREATE INDEX IF NOT EXISTS idx_pages_text_sample ON pages USING GIN (text_sample gin_trgm_ops)")
+    return err
+}
+
+// GetSimilarContent returns up to 5 pages, from any crawl, whose title and
+// text are at least threshold similar (0-1) to those of the pages with this
+// content hash, most similar first. Copies with the same hash are included.
+func (p *PostgresDB) GetSimilarContent(hash string, threshold float64) ([]models.SimilarPage, error) {
+    if err := p.PrepareSimilarity(); err != nil {
+        return nil, err
+    }
+    var sample sql.NullString
+    err := p.DB.QueryRow("SELECT text_sample FROM pages WHERE hash = $1 AND text_sample IS NOT NULL LIMIT 1", hash).Scan(&sample)
+    if err == sql.ErrNoRows {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, err
+    }
+    return p.similarPages(sample.String, threshold, 5, "")
+}
+
+// FindSimilarPage returns the page of a crawl whose title and text are most
+// similar to these, if any is at least threshold similar (0-1), by pg_trgm
+// trigram similarity on the start of each page
+func (p *PostgresDB) FindSimilarPage(crawlID int64, title, text string, threshold float64) (*models.SimilarPage, error) {
+    pages, err := p.similarPages(textSample(title, text), threshold, 1, "AND crawl_id = $3", crawlID)
+    if err != nil || len(pages) == 0 {
+        return nil, err
+    }
+    return &pages[0], nil
+}
+
+// similarPages looks up pages whose text sample is at least threshold
+// similar to sample. The threshold is set for the transaction only, so the
+// trigram index answers the % operator with it.
+func (p *PostgresDB) similarPages(sample string, threshold float64, limit int, filter string, args ...interface{}) ([]models.SimilarPage, error) {
+    if strings.TrimSpace(sample) == "" {
+        return nil, nil
+    }
+    tx, err := p.DB.Begin()
+    if err != nil {
+        return nil, err
+    }
+    defer tx.Rollback()
+
+    _, err = tx.Exec("SELECT set_config('pg_trgm.similarity_threshold', $1, true)", strconv.FormatFloat(threshold, 'f', -1, 64))
+    if err != nil {
+        return nil, err
+    }
+    rows, err := tx.Query(`
+        SELECT id, url, COALESCE(title, ''), COALESCE(hash, ''), similarity(text_sample, $1) AS score
+        FROM pages
+        WHERE text_sample % $1 `+filter+`
+        ORDER BY score DESC
+        LIMIT $2
+    `, append([]interface{}{sample, limit}, args...)...)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var pages []models.SimilarPage
+    for rows.Next() {
+        var page models.SimilarPage
+        if err := rows.Scan(&page.ID, &page.URL, &page.Title, &page.Hash, &page.Similarity); err != nil {
             return nil, err
         }
         pages = append(pages, page)
     }
+    return pages, rows.Err()
+}
+
+// SaveLinks replaces the links recorded for a page, e.g. when a revisit
+// found it changed. They are inserted linkBatchSize at a time, and those
+// whose target is already saved point at it.
+func (p *PostgresDB) SaveLinks(crawlID, sourceID int64, links []models.Link) error {
+    tx, err := p.DB.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    if _, err := tx.Exec("DELETE FROM links WHERE source_id = $1", sourceID); err != nil {
+        return err
+    }
+    links = linksFrom(sourceID, links)
+    for start := 0; start < len(links); start += linkBatchSize {
+        query, args := insertLinks(crawlID, links[start:min(start+linkBatchSize, len(links))])
+        if _, err := tx.Exec(query, args...); err != nil {
+            return err
+        }
+    }
+    if _, err := tx.Exec(resolveSavedTargets, sourceID); err != nil {
+        return err
+    }
+
+    return tx.Commit()
+}
+
+// AddPageTags attaches tags to a page; source records who applied them
+// (e.g. "rule" at crawl time or "manual" through the API).
+func (p *PostgresDB) AddPageTags(pageID int64, tags []string, source string) error {
+    if len(tags) == 0 {
+        return nil
+    }
+
+    tx, err := p.DB.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    stmt, err := tx.Prepare(`
+        INSERT INTO page_tags (page_id, tag, source)
+        VALUES ($1, $2, $3)
+        ON CONFLICT (page_id, tag) DO NOTHING
+    `)
+    if err != nil {
+        return err
+    }
+    defer stmt.Close()
+
+    for _, tag := range tags {
+        if _, err := stmt.Exec(pageID, tag, source); err != nil {
+            return err
+        }
+    }
+
+    return tx.Commit()
+}
+
+func (p *PostgresDB) RemovePageTag(pageID int64, tag string) error {
+    _, err := p.DB.Exec("DELETE FROM page_tags WHERE page_id = $1 AND tag = $2", pageID, tag)
+    return err
+}
 
-    return pages, nil
+func (p *PostgresDB) GetPageTags(pageID int64) ([]models.PageTag, error) {
+    rows, err := p.DB.Query(`
+        SELECT page_id, tag, source, created_at
+        FROM page_tags
+        WHERE page_id = $1
+        ORDER BY tag
+    `, pageID)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var tags []models.PageTag
+    for rows.Next() {
+        var tag models.PageTag
+        if err := rows.Scan(&tag.PageID, &tag.Tag, &tag.Source, &tag.CreatedAt); err != nil {
+            return nil, err
+        }
+        tags = append(tags, tag)
+    }
+
+    return tags, rows.Err()
+}
+
+func (p *PostgresDB) GetPagesByTag(tag string, limit int) ([]models.Page, error) {
+    list, err := p.QueryPages(PageQuery{Tag: tag, Limit: limit})
+    if err != nil {
+        return nil, err
+    }
+    return list.Pages, nil
+}
+
+func (p *PostgresDB) SaveCheckpoint(startURL string, state []byte) error {
+    _, err := p.DB.Exec(`
+        INSERT INTO crawl_checkpoints (start_url, state, updated_at)
+        VALUES ($1, $2, CURRENT_TIMESTAMP)
+        ON CONFLICT (start_url) DO UPDATE SET
+            state = EXCLUDED.state,
+            updated_at = CURRENT_TIMESTAMP
+    `, startURL, state)
+    return err
+}
+
+// LoadCheckpoint returns the saved state for startURL, or nil if there is none
+func (p *PostgresDB) LoadCheckpoint(startURL string) ([]byte, error) {
+    var state []byte
+    err := p.DB.QueryRow("SELECT state FROM crawl_checkpoints WHERE start_url = $1", startURL).Scan(&state)
+    if err == sql.ErrNoRows {
+        return nil, nil
+    }
+    return state, err
 }
 
 func (p *PostgresDB) Close() error {
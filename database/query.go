@@ -0,0 +1,252 @@
+package database
+
+import (
+    "database/sql"
+    "encoding/base64"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "strings"
+    "time"
+
+    "smart-crawler/models"
+)
+
+// ErrInvalidQuery wraps errors caused by a malformed PageQuery
+var ErrInvalidQuery = errors.New("invalid page query")
+
+// Sortable page columns and the SQL type used to compare cursor values
+var pageSortColumns = map[string]string{
+    "id":               "BIGINT",
+    "crawled_at":       "TIMESTAMP",
+    "depth":            "INTEGER",
+    "size":             "BIGINT",
+    "status_code":      "INTEGER",
+    "importance_score": "FLOAT",
+    "content_quality":  "FLOAT",
+    "load_time_ms":     "BIGINT",
+    "relevance":        "FLOAT",
+    "spam_score":       "FLOAT",
+}
+
+// PageQuery filters, sorts, and paginates stored pages. Zero values leave
+// a filter unset; pointer fields distinguish "unset" from zero.
+type PageQuery struct {
+    CrawlID       int64
+    CrawlUUID     string
+    Host          string
+    MinDepth      *int
+    MaxDepth      *int
+    StatusCode    int
+    MinQuality    *float64
+    MaxQuality    *float64
+    CrawledAfter  time.Time
+    CrawledBefore time.Time
+    Tag           string
+    SchemaType    string // Pages with a structured data item of this type, e.g. "Product"
+    Spam          *bool  // Pages the spam filter flagged, or those it did not
+
+    SortBy     string // One of pageSortColumns, defaults to "id"
+    Descending bool
+    Cursor     string // NextCursor of the previous page
+    Limit      int
+}
+
+type PageList struct {
+    Pages      []models.Page `json:"pages"`
+    NextCursor string        `json:"next_cursor,omitempty"`
+}
+
+// pageCursor is the keyset position after the last returned row
+type pageCursor struct {
+    Value string `json:"v"`
+    ID    int64  `json:"id"`
+}
+
+func encodeCursor(c pageCursor) string {
+    raw, _ := json.Marshal(c)
+    return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeCursor(s string) (pageCursor, error) {
+    var c pageCursor
+    raw, err := base64.RawURLEncoding.DecodeString(s)
+    if err != nil {
+        return c, fmt.Errorf("%w: bad cursor", ErrInvalidQuery)
+    }
+    if err := json.Unmarshal(raw, &c); err != nil {
+        return c, fmt.Errorf("%w: bad cursor", ErrInvalidQuery)
+    }
+    return c, nil
+}
+
+// queryBuilder accumulates WHERE clauses with numbered placeholders
+type queryBuilder struct {
+    conditions []string
+    args       []interface{}
+}
+
+func (b *queryBuilder) where(condition string, args ...interface{}) {
+    for _, arg := range args {
+        b.args = append(b.args, arg)
+        condition = strings.Replace(condition, "?", fmt.Sprintf("$%d", len(b.args)), 1)
+    }
+    b.conditions = append(b.conditions, condition)
+}
+
+func (b *queryBuilder) clause() string {
+    if len(b.conditions) == 0 {
+        return ""
+    }
+    return "WHERE " + strings.Join(b.conditions, " AND ")
+}
+
+func (p *PostgresDB) QueryPages(q PageQuery) (*PageList, error) {
+    sortBy := q.SortBy
+    if sortBy == "" {
+        sortBy = "id"
+    }
+    sortType, ok := pageSortColumns[sortBy]
+    if !ok {
+        return nil, fmt.Errorf("%w: unknown sort column %q", ErrInvalidQuery, sortBy)
+    }
+
+    limit := q.Limit
+    if limit <= 0 {
+        limit = 50
+    }
+
+    var b queryBuilder
+    if q.CrawlID != 0 {
+        b.where("p.crawl_id = ?", q.CrawlID)
+    }
+    if q.CrawlUUID != "" {
+        b.where("c.uuid = ?", q.CrawlUUID)
+    }
+    if q.Host != "" {
+        b.where("lower(substring(p.url from '^[a-zA-Z]+://([^/:?#]+)')) = lower(?)", q.Host)
+    }
+    if q.MinDepth != nil {
+        b.where("p.depth >= ?", *q.MinDepth)
+    }
+    if q.MaxDepth != nil {
+        b.where("p.depth <= ?", *q.MaxDepth)
+    }
+    if q.StatusCode != 0 {
+        b.where("p.status_code = ?", q.StatusCode)
+    }
+    if q.MinQuality != nil {
+        b.where("p.content_quality >= ?", *q.MinQuality)
+    }
+    if q.MaxQuality != nil {
+        b.where("p.content_quality <= ?", *q.MaxQuality)
+    }
+    if !q.CrawledAfter.IsZero() {
+        b.where("p.crawled_at >= ?", q.CrawledAfter)
+    }
+    if !q.CrawledBefore.IsZero() {
+        b.where("p.crawled_at < ?", q.CrawledBefore)
+    }
+    if q.Tag != "" {
+        b.where("EXISTS (SELECT 1 FROM page_tags t WHERE t.page_id = p.id AND t.tag = ?)", q.Tag)
+    }
+    if q.SchemaType != "" {
+        b.where("p.structured_data @> jsonb_build_array(jsonb_build_object('type', ?::TEXT))", q.SchemaType)
+    }
+    if q.Spam != nil {
+        b.where("COALESCE(p.spam, FALSE) = ?", *q.Spam)
+    }
+
+    order, cmp := "ASC", ">"
+    if q.Descending {
+        order, cmp = "DESC", "<"
+    }
+
+    if q.Cursor != "" {
+        cursor, err := decodeCursor(q.Cursor)
+        if err != nil {
+            return nil, err
+        }
+        if sortBy == "id" {
+            b.where("p.id "+cmp+" ?", cursor.ID)
+        } else {
+            b.where(fmt.Sprintf("(p.%s, p.id) %s (?::%s, ?)", sortBy, cmp, sortType), cursor.Value, cursor.ID)
+        }
+    }
+
+    orderBy := "p.id " + order
+    if sortBy != "id" {
+        orderBy = fmt.Sprintf("p.%s %s, p.id %s", sortBy, order, order)
+    }
+
+    // Fetch one extra row to know whether another page follows
+    b.args = append(b.args, limit+1)
+    query := fmt.Sprintf(`
+        SELECT p.id, p.crawl_id, COALESCE(c.uuid, ''), p.url, COALESCE(p.fingerprint, ''), p.title, p.status_code, p.content_type, p.size, p.load_time_ms, p.depth,
+               p.parent_url, p.crawled_at, p.hash, p.importance_score, p.content_quality, p.link_density, COALESCE(p.relevance, 0),
+               COALESCE(p.og_title, ''), COALESCE(p.og_description, ''), COALESCE(p.og_image, ''),
+               p.dns_ms, p.connect_ms, p.tls_ms, p.ttfb_ms, p.download_ms, COALESCE(p.final_url, ''), p.headers, p.tls,
+               COALESCE(p.spam, FALSE), COALESCE(p.spam_score, 0), COALESCE(p.spam_signals, ''), p.%s::TEXT
+        FROM pages p
+        LEFT JOIN crawls c ON c.id = p.crawl_id
+        %s
+        ORDER BY %s
+        LIMIT $%d`, sortBy, b.clause(), orderBy, len(b.args))
+
+    rows, err := p.DB.Query(query, b.args...)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    list := &PageList{Pages: []models.Page{}}
+    var sortValues []string
+    for rows.Next() {
+        var page models.Page
+        var crawlID sql.NullInt64
+        var sortValue string
+        var dns, connect, tls, ttfb, download sql.NullFloat64
+        var headers, tlsInfo []byte
+        var spamSignals string
+        err := rows.Scan(&page.ID, &crawlID, &page.CrawlUUID, &page.URL, &page.Fingerprint, &page.Title, &page.StatusCode, &page.ContentType,
+            &page.Size, &page.LoadTime, &page.Depth, &page.ParentURL, &page.CrawledAt, &page.Hash,
+            &page.Importance, &page.ContentQuality, &page.LinkDensity, &page.Relevance,
+            &page.OGTitle, &page.OGDescription, &page.OGImage,
+            &dns, &connect, &tls, &ttfb, &download, &page.FinalURL, &headers, &tlsInfo,
+            &page.Spam, &page.SpamScore, &spamSignals, &sortValue)
+        if err != nil {
+            return nil, err
+        }
+        if headers != nil {
+            if err := json.Unmarshal(headers, &page.Headers); err != nil {
+                return nil, err
+            }
+        }
+        if tlsInfo != nil {
+            if err := json.Unmarshal(tlsInfo, &page.TLS); err != nil {
+                return nil, err
+            }
+        }
+        page.CrawlID = crawlID.Int64
+        if spamSignals != "" {
+            page.SpamSignals = strings.Split(spamSignals, ",")
+        }
+        // Pages saved before fetches were timed have none
+        if ttfb.Valid {
+            page.Timing = &models.RequestTiming{DNS: dns.Float64, Connect: connect.Float64, TLS: tls.Float64, TTFB: ttfb.Float64, Download: download.Float64}
+        }
+        list.Pages = append(list.Pages, page)
+        sortValues = append(sortValues, sortValue)
+    }
+    if err := rows.Err(); err != nil {
+        return nil, err
+    }
+
+    if len(list.Pages) > limit {
+        list.Pages = list.Pages[:limit]
+        last := list.Pages[limit-1]
+        list.NextCursor = encodeCursor(pageCursor{Value: sortValues[limit-1], ID: last.ID})
+    }
+
+    return list, nil
+}
@@ -0,0 +1,89 @@
+package database
+
+import (
+    "time"
+
+    "smart-crawler/models"
+)
+
+// DueForRefresh claims up to limit pages of a crawl whose next_crawl_at has
+// passed, most overdue first. Claimed pages are pushed back by lease, so a
+// revisit that never completes is retried rather than lost, and concurrent
+// callers never claim the same page.
+func (p *PostgresDB) DueForRefresh(crawlID int64, limit int, lease time.Duration) ([]models.URLPriority, error) {
+    rows, err := p.DB.Query(`
+        UPDATE pages SET next_crawl_at = CURRENT_TIMESTAMP + $3 * INTERVAL '1 second'
+        WHERE id IN (
+            SELECT id FROM pages
+            WHERE crawl_id = $1 AND next_crawl_at <= CURRENT_TIMESTAMP
+            ORDER BY next_crawl_at
+            LIMIT $2
+            FOR UPDATE SKIP LOCKED
+        )
+        RETURNING url, COALESCE(depth, 0), COALESCE(parent_url, ''), COALESCE(etag, ''), COALESCE(last_modified, '')
+    `, crawlID, limit, lease.Seconds())
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var urls []models.URLPriority
+    for rows.Next() {
+        url := models.URLPriority{Refresh: true}
+        if err := rows.Scan(&url.URL, &url.Depth, &url.Parent, &url.Validators.ETag, &url.Validators.LastModified); err != nil {
+            return nil, err
+        }
+        urls = append(urls, url)
+    }
+
+    return urls, rows.Err()
+}
+
+// RecordRevisit counts a refetch of a saved page and whether it came back
+// with a different hash. The stored hash is left for SavePage to update. An
+// empty hash records a 304 Not Modified, which is never a change. Non-empty
+// validators replace the saved ones.
+func (p *PostgresDB) RecordRevisit(crawlID int64, url, hash string, validators models.Validators) (*models.RevisitHistory, error) {
+    var history models.RevisitHistory
+    var observed float64
+    err := p.DB.QueryRow(`
+        UPDATE pages SET
+            revisits = COALESCE(revisits, 0) + 1,
+            changes = COALESCE(changes, 0) + CASE WHEN $3 <> '' AND hash IS DISTINCT FROM $3 THEN 1 ELSE 0 END,
+            etag = COALESCE(NULLIF($4, ''), etag),
+            last_modified = COALESCE(NULLIF($5, ''), last_modified)
+        WHERE crawl_id = $1 AND url = $2
+        RETURNING EXTRACT(EPOCH FROM CURRENT_TIMESTAMP - COALESCE(first_crawled_at, crawled_at)),
+                  revisits, changes, $3 <> '' AND hash IS DISTINCT FROM $3
+    `, crawlID, url, hash, validators.ETag, validators.LastModified).Scan(&observed, &history.Revisits, &history.Changes, &history.Changed)
+    if err != nil {
+        return nil, err
+    }
+    history.Observed = time.Duration(observed * float64(time.Second))
+    return &history, nil
+}
+
+// ScheduleRevisit makes a saved page due for a refresh after the given delay.
+// Times are computed by the database, whose clock stamped the page.
+func (p *PostgresDB) ScheduleRevisit(crawlID int64, url string, after time.Duration) error {
+    _, err := p.DB.Exec(`
+        UPDATE pages SET next_crawl_at = CURRENT_TIMESTAMP + $3 * INTERVAL '1 second'
+        WHERE crawl_id = $1 AND url = $2
+    `, crawlID, url, after.Seconds())
+    return err
+}
+
+// ScheduleUnscheduled makes the pages of a crawl that were never scheduled
+// for a revisit due now, returning how many there were. Pages saved by a
+// batch crawl have no schedule until they are first refreshed.
+func (p *PostgresDB) ScheduleUnscheduled(crawlID int64) (int, error) {
+    result, err := p.DB.Exec(`
+        UPDATE pages SET next_crawl_at = CURRENT_TIMESTAMP
+        WHERE crawl_id = $1 AND next_crawl_at IS NULL
+    `, crawlID)
+    if err != nil {
+        return 0, err
+    }
+    scheduled, err := result.RowsAffected()
+    return int(scheduled), err
+}
@@ -0,0 +1,185 @@
+package database
+
+import (
+    "encoding/json"
+    "fmt"
+    "net/url"
+    "regexp"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+
+    "smart-crawler/models"
+)
+
+// SecurityHeaders are the response headers the security report checks
+// HTML pages for
+var SecurityHeaders = []string{
+    "Strict-Transport-Security",
+    "Content-Security-Policy",
+    "X-Frame-Options",
+    "X-Content-Type-Options",
+    "Referrer-Policy",
+    "Permissions-Policy",
+}
+
+// HSTS max-age below which browsers forget the policy too soon to protect
+// returning visitors; 180 days is the usual compliance floor
+const minHSTSMaxAge = 180 * 24 * time.Hour
+
+var hstsMaxAge = regexp.MustCompile(`(?i)max-age\s*=\s*"?(\d+)`)
+
+// SecurityReport summarizes, per host, the security headers a crawl's HTML
+// pages were served with and the TLS its pages were fetched over, with
+// findings for what falls short. Certificates expiring within
+// expiryWarning of now are flagged.
+func (p *PostgresDB) SecurityReport(crawlID int64, now time.Time, expiryWarning time.Duration) ([]models.HostSecurity, error) {
+    rows, err := p.DB.Query(`
+        SELECT url, content_type, headers, tls
+        FROM pages
+        WHERE crawl_id = $1`, crawlID)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    hosts := make(map[string]*models.HostSecurity)
+    for rows.Next() {
+        var pageURL, contentType string
+        var headerData, tlsData []byte
+        if err := rows.Scan(&pageURL, &contentType, &headerData, &tlsData); err != nil {
+            return nil, err
+        }
+        parsed, err := url.Parse(pageURL)
+        if err != nil {
+            continue
+        }
+        host := hosts[parsed.Host]
+        if host == nil {
+            host = &models.HostSecurity{
+                Host:         parsed.Host,
+                Headers:      make(map[string]models.SecurityHeader),
+                TLSVersions:  make(map[string]int),
+                CipherSuites: make(map[string]int),
+            }
+            hosts[parsed.Host] = host
+        }
+        host.Pages++
+
+        if tlsData != nil {
+            var info models.TLSInfo
+            if err := json.Unmarshal(tlsData, &info); err != nil {
+                return nil, err
+            }
+            host.HTTPS++
+            host.TLSVersions[info.Version]++
+            host.CipherSuites[info.CipherSuite]++
+            if !info.CertExpiry.IsZero() && (host.CertExpiry == nil || info.CertExpiry.Before(*host.CertExpiry)) {
+                expiry := info.CertExpiry
+                host.CertExpiry = &expiry
+                host.CertIssuer = info.CertIssuer
+            }
+        }
+
+        // Security headers protect documents; images and scripts go without
+        if !strings.Contains(strings.ToLower(contentType), "html") {
+            continue
+        }
+        host.Documents++
+        var headers map[string][]string
+        if headerData != nil {
+            if err := json.Unmarshal(headerData, &headers); err != nil {
+                return nil, err
+            }
+        }
+        for _, name := range SecurityHeaders {
+            values := headers[name]
+            if len(values) == 0 {
+                continue
+            }
+            header := host.Headers[name]
+            header.Documents++
+            if header.Value == "" {
+                header.Value = values[0]
+            }
+            host.Headers[name] = header
+        }
+    }
+    if err := rows.Err(); err != nil {
+        return nil, err
+    }
+
+    report := make([]models.HostSecurity, 0, len(hosts))
+    for _, host := range hosts {
+        host.Findings = securityFindings(host, now, expiryWarning)
+        report = append(report, *host)
+    }
+    sort.Slice(report, func(i, j int) bool { return report[i].Host < report[j].Host })
+    return report, nil
+}
+
+// securityFindings is what falls short on host, worst first
+func securityFindings(host *models.HostSecurity, now time.Time, expiryWarning time.Duration) []string {
+    var findings []string
+    if plain := host.Pages - host.HTTPS; plain > 0 {
+        findings = append(findings, fmt.Sprintf("%d of %d pages served over plain HTTP", plain, host.Pages))
+    }
+    for _, version := range []string{"SSL 3.0", "TLS 1.0", "TLS 1.1"} {
+        if pages := host.TLSVersions[version]; pages > 0 {
+            findings = append(findings, fmt.Sprintf("%d pages fetched over %s, below TLS 1.2", pages, version))
+        }
+    }
+    if host.CertExpiry != nil {
+        switch left := host.CertExpiry.Sub(now); {
+        case left <= 0:
+            findings = append(findings, fmt.Sprintf("certificate expired on %s", host.CertExpiry.Format("2006-01-02")))
+        case left < expiryWarning:
+            findings = append(findings, fmt.Sprintf("certificate expires on %s, in %d days", host.CertExpiry.Format("2006-01-02"), int(left.Hours()/24)))
+        }
+    }
+    if host.Documents == 0 {
+        return findings
+    }
+
+    missing := func(name string) bool {
+        header := host.Headers[name]
+        if header.Documents < host.Documents {
+            findings = append(findings, fmt.Sprintf("%s missing on %d of %d documents", name, host.Documents-header.Documents, host.Documents))
+        }
+        return header.Documents == 0
+    }
+    // HSTS is ignored over plain HTTP, so only HTTPS hosts need it
+    if host.HTTPS > 0 && !missing("Strict-Transport-Security") {
+        if maxAge, ok := hstsAge(host.Headers["Strict-Transport-Security"].Value); !ok || maxAge < minHSTSMaxAge {
+            findings = append(findings, "Strict-Transport-Security max-age below 180 days")
+        }
+    }
+    csp := host.Headers["Content-Security-Policy"].Value
+    if !missing("Content-Security-Policy") && strings.Contains(csp, "'unsafe-inline'") {
+        findings = append(findings, "Content-Security-Policy allows 'unsafe-inline'")
+    }
+    // CSP frame-ancestors supersedes X-Frame-Options
+    if !strings.Contains(strings.ToLower(csp), "frame-ancestors") {
+        missing("X-Frame-Options")
+    }
+    if !missing("X-Content-Type-Options") && !strings.EqualFold(strings.TrimSpace(host.Headers["X-Content-Type-Options"].Value), "nosniff") {
+        findings = append(findings, "X-Content-Type-Options is not nosniff")
+    }
+    missing("Referrer-Policy")
+    missing("Permissions-Policy")
+    return findings
+}
+
+// hstsAge is the max-age directive of a Strict-Transport-Security value
+func hstsAge(value string) (time.Duration, bool) {
+    match := hstsMaxAge.FindStringSubmatch(value)
+    if match == nil {
+        return 0, false
+    }
+    seconds, err := strconv.ParseInt(match[1], 10, 64)
+    if err != nil {
+        return 0, false
+    }
+    return time.Duration(seconds) * time.Second, true
+}
@@ -0,0 +1,94 @@
+package database
+
+import (
+    "hash/fnv"
+    "sort"
+    "strconv"
+    "strings"
+    "unicode"
+    "unicode/utf8"
+
+    "smart-crawler/models"
+)
+
+// Characters of a page's title and text compared for near-duplicates. The
+// start of a page is enough to tell copies apart, and keeps the trigram
+// index small.
+const textSampleLength = 2000
+
+// Trigram hashes kept in a DuckDB page's similarity sketch
+const sketchSize = 128
+
+// pageSample is the text sample of a page, from its visible text when the
+// crawler extracted it
+func pageSample(page *models.Page) string {
+    if page.PlainText != "" {
+        return textSample(page.Title, page.PlainText)
+    }
+    return textSample(page.Title, page.Content)
+}
+
+// textSample is what near-duplicate lookups compare a page by: its title
+// and the start of its text, whitespace collapsed
+func textSample(title, text string) string {
+    sample := strings.Join(strings.Fields(title+" "+text), " ")
+    if len(sample) <= textSampleLength {
+        return sample
+    }
+    // Cut on a rune boundary
+    cut := textSampleLength
+    for cut > 0 && !utf8.RuneStart(sample[cut]) {
+        cut--
+    }
+    return sample[:cut]
+}
+
+// trigrams returns the trigrams of text the way pg_trgm forms them: each
+// lowercased word of letters and digits, padded with two spaces in front
+// and one behind
+func trigrams(text string) map[string]bool {
+    set := make(map[string]bool)
+    words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+        return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+    })
+    for _, word := range words {
+        padded := []rune("  " + word + " ")
+        for i := 0; i+3 <= len(padded); i++ {
+            set[string(padded[i:i+3])] = true
+        }
+    }
+    return set
+}
+
+// similaritySketch is a bottom-k MinHash sketch of a text sample's
+// trigrams: the sketchSize smallest of their hashes, in order. Two sketches
+// estimate the share of trigrams their texts have in common, the
+// similarity pg_trgm computes exactly. It is formatted as a DuckDB list
+// literal, or "" for a text without trigrams.
+func similaritySketch(sample string) string {
+    set := trigrams(sample)
+    if len(set) == 0 {
+        return ""
+    }
+    hashes := make([]int64, 0, len(set))
+    for trigram := range set {
+        hash := fnv.New64a()
+        hash.Write([]byte(trigram))
+        hashes = append(hashes, int64(hash.Sum64()))
+    }
+    sort.Slice(hashes, func(i, j int) bool { return hashes[i] < hashes[j] })
+    if len(hashes) > sketchSize {
+        hashes = hashes[:sketchSize]
+    }
+
+    var b strings.Builder
+    b.WriteByte('[')
+    for i, hash := range hashes {
+        if i > 0 {
+            b.WriteByte(',')
+        }
+        b.WriteString(strconv.FormatInt(hash, 10))
+    }
+    b.WriteByte(']')
+    return b.String()
+}
@@ -0,0 +1,328 @@
+package database
+
+import (
+    "database/sql"
+    "encoding/json"
+    "fmt"
+    "regexp"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+
+    "smart-crawler/models"
+)
+
+// Store is the storage the crawlers write to while they run. PostgresDB
+// implements it along with the query, tagging, and session APIs used by the
+// server; DuckDB implements it for local crawl-then-analyze workflows.
+type Store interface {
+    CreateCrawl(mode, startURL string, maxDepth int) (int64, string, error)
+    GetCrawlUUID(id int64) (string, error)
+    FinishCrawl(id int64, stats *models.CrawlStats) error
+
+    SavePage(page *models.Page) error
+    SavePages(writes []models.PageWrite) error
+    IsURLCrawled(crawlID int64, url string) (bool, error)
+    IsFingerprintCrawled(crawlID int64, fingerprint string) (bool, error)
+    HasContentHash(crawlID int64, hash string) (bool, error)
+    ForEachContentHash(crawlID int64, fn func(hash string) error) error
+    ClaimContentHash(crawlID int64, url, hash string, simhash int64) (bool, int64, error)
+    PrepareSimilarity() error
+    FindSimilarPage(crawlID int64, title, text string, threshold float64) (*models.SimilarPage, error)
+    SaveRedirect(crawlID int64, sourceURL, targetURL string) error
+    AddPageTags(pageID int64, tags []string, source string) error
+    SaveExtractions(crawlID, pageID int64, url string, extractions []models.Extraction) error
+    SaveImages(crawlID, pageID int64, url string, images []models.Image) error
+    GetSavedContent(crawlID int64, url string) (string, string, error)
+    SavePageChange(change *models.PageChange) error
+    SaveLinks(crawlID, sourceID int64, links []models.Link) error
+
+    AddToQueue(crawlID int64, urls []models.URLPriority) error
+    GetNextURLs(crawlID int64, limit int, exceptHosts []string) ([]models.URLPriority, error)
+    GetOldestURLs(crawlID int64, limit int) ([]models.URLPriority, error)
+    MarkURLProcessed(crawlID int64, url string) error
+    DeferQueue(crawlID int64) (int, error)
+    ReapQueue(staleAfter time.Duration) (int, error)
+    FailURL(crawlID int64, url, message string, maxAttempts int, backoff time.Duration) (bool, error)
+    HasPendingRetries(crawlID int64) (bool, error)
+    GetFailedURLs(crawlID int64) ([]models.FailedURL, error)
+    RequeueFailed(crawlID int64) (int, error)
+    RequeueDeferred(crawlID int64) error
+    GetPendingURLs(crawlID int64, origin string) ([]string, error)
+    CountPendingURLs(crawlID int64) (int, error)
+    DisallowQueuedURLs(crawlID int64, urls []string) (int, error)
+    ReleaseURLs(crawlID int64, urls []string) (int, error)
+
+    DueForRefresh(crawlID int64, limit int, lease time.Duration) ([]models.URLPriority, error)
+    RecordRevisit(crawlID int64, url, hash string, validators models.Validators) (*models.RevisitHistory, error)
+    ScheduleRevisit(crawlID int64, url string, after time.Duration) error
+    ScheduleUnscheduled(crawlID int64) (int, error)
+
+    SaveCheckpoint(startURL string, state []byte) error
+    LoadCheckpoint(startURL string) ([]byte, error)
+
+    SchemaReport() *models.RepairReport
+    Repair(startURL string, staleAfter time.Duration) (*models.RepairReport, error)
+
+    SaveBenchmarkResult(result *models.BenchmarkResult) (int64, error)
+    BenchmarkResults(limit int) ([]models.BenchmarkResult, error)
+
+    Close() error
+}
+
+var _ Store = (*PostgresDB)(nil)
+
+// QueueClaimTimeout is how long a URL claimed from crawl_queue may stay
+// in_progress before ReapQueue returns it to pending for another crawler
+const QueueClaimTimeout = 5 * time.Minute
+
+// Links written per INSERT statement by SaveLinks; 9 parameters each keeps
+// a batch well under Postgres's limit of 65535
+const linkBatchSize = 500
+
+// Pages upserted per INSERT statement by SavePages, at 41 parameters each
+const pageBatchSize = 500
+
+var paramPattern = regexp.MustCompile(`\$\d+`)
+
+// queueFingerprint is what the queue holds a URL once by: its fingerprint,
+// or the URL itself when it has none
+func queueFingerprint(url models.URLPriority) string {
+    if url.Fingerprint != "" {
+        return url.Fingerprint
+    }
+    return url.URL
+}
+
+// valuesRows repeats a VALUES row written with parameters $1 to $perRow,
+// renumbering the parameters of each copy after those of the one before
+func valuesRows(row string, rows, perRow int) string {
+    var b strings.Builder
+    for i := 0; i < rows; i++ {
+        if i > 0 {
+            b.WriteString(", ")
+        }
+        offset := i * perRow
+        b.WriteString(paramPattern.ReplaceAllStringFunc(row, func(param string) string {
+            n, _ := strconv.Atoi(param[1:])
+            return "$" + strconv.Itoa(n+offset)
+        }))
+    }
+    return b.String()
+}
+
+// forEachContentHash calls fn with the content hash of every page a crawl
+// saved, streaming the rows
+func forEachContentHash(db *sql.DB, crawlID int64, fn func(hash string) error) error {
+    rows, err := db.Query("SELECT hash FROM pages WHERE crawl_id = $1 AND hash <> ''", crawlID)
+    if err != nil {
+        return err
+    }
+    defer rows.Close()
+
+    for rows.Next() {
+        var hash string
+        if err := rows.Scan(&hash); err != nil {
+            return err
+        }
+        if err := fn(hash); err != nil {
+            return err
+        }
+    }
+    return rows.Err()
+}
+
+// pageKey identifies the row a page is saved to
+func pageKey(crawlID int64, url string) string {
+    return strconv.FormatInt(crawlID, 10) + " " + url
+}
+
+// uniqueWrites keeps the last write of each page in a batch, as one upsert
+// cannot update a row twice, in key order, so concurrent batches lock rows
+// in the same order
+func uniqueWrites(writes []models.PageWrite) []models.PageWrite {
+    last := make(map[string]int, len(writes))
+    for i, write := range writes {
+        last[pageKey(write.Page.CrawlID, write.Page.URL)] = i
+    }
+    unique := make([]models.PageWrite, 0, len(last))
+    for i, write := range writes {
+        if last[pageKey(write.Page.CrawlID, write.Page.URL)] == i {
+            unique = append(unique, write)
+        }
+    }
+    sort.Slice(unique, func(i, j int) bool {
+        return pageKey(unique[i].Page.CrawlID, unique[i].Page.URL) < pageKey(unique[j].Page.CrawlID, unique[j].Page.URL)
+    })
+    return unique
+}
+
+// replaceLinks swaps the recorded links of a batch's saved pages for the
+// ones written with them, and points those links, and earlier ones to the
+// pages, at the pages they name
+func replaceLinks(tx *sql.Tx, writes []models.PageWrite) error {
+    var sources []int64
+    links := make(map[int64][]models.Link) // By crawl
+    for _, write := range writes {
+        if write.Links == nil {
+            continue
+        }
+        sources = append(sources, write.Page.ID)
+        links[write.Page.CrawlID] = append(links[write.Page.CrawlID], linksFrom(write.Page.ID, write.Links)...)
+    }
+
+    if len(sources) > 0 {
+        placeholders := make([]string, len(sources))
+        args := make([]interface{}, len(sources))
+        for i, id := range sources {
+            placeholders[i] = "$" + strconv.Itoa(i+1)
+            args[i] = id
+        }
+        if _, err := tx.Exec("DELETE FROM links WHERE source_id IN ("+strings.Join(placeholders, ", ")+")", args...); err != nil {
+            return err
+        }
+    }
+    for crawlID, crawlLinks := range links {
+        for start := 0; start < len(crawlLinks); start += linkBatchSize {
+            query, args := insertLinks(crawlID, crawlLinks[start:min(start+linkBatchSize, len(crawlLinks))])
+            if _, err := tx.Exec(query, args...); err != nil {
+                return err
+            }
+        }
+    }
+
+    if len(sources) > 0 {
+        stmt, err := tx.Prepare(resolveSavedTargets)
+        if err != nil {
+            return err
+        }
+        defer stmt.Close()
+        for _, id := range sources {
+            if _, err := stmt.Exec(id); err != nil {
+                return err
+            }
+        }
+    }
+    stmt, err := tx.Prepare(resolveLinksTo)
+    if err != nil {
+        return err
+    }
+    defer stmt.Close()
+    for _, write := range writes {
+        page := write.Page
+        if _, err := stmt.Exec(page.ID, page.CrawlID, page.URL, page.FinalURL, page.CanonicalURL); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// linksFrom returns copies of links with their source set to sourceID
+func linksFrom(sourceID int64, links []models.Link) []models.Link {
+    sourced := make([]models.Link, len(links))
+    for i, link := range links {
+        link.SourceID = sourceID
+        sourced[i] = link
+    }
+    return sourced
+}
+
+// insertLinks returns the INSERT statement and parameters for one batch of
+// links
+func insertLinks(crawlID int64, links []models.Link) (string, []interface{}) {
+    var query strings.Builder
+    query.WriteString("INSERT INTO links (crawl_id, source_id, url, anchor, rel, context_before, context_after, heading, classes) VALUES ")
+    args := make([]interface{}, 0, len(links)*9)
+    for i, link := range links {
+        if i > 0 {
+            query.WriteString(", ")
+        }
+        n := len(args)
+        fmt.Fprintf(&query, "($%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, NULLIF($%d, ''))", n+1, n+2, n+3, n+4, n+5, n+6, n+7, n+8, n+9)
+        args = append(args, crawlID, link.SourceID, link.URL, link.Anchor, link.Rel, link.Before, link.After, link.Heading, link.Classes)
+    }
+    return query.String(), args
+}
+
+// Points a page's new links at the pages of the crawl already saved under
+// their URL, whether requested at it, redirected to it, or naming it
+// canonical. Links to pages saved later are pointed at them by
+// resolveLinksTo.
+const resolveSavedTargets = `
+    UPDATE links SET target_id = (
+        SELECT MIN(p.id) FROM pages p
+        WHERE p.crawl_id = links.crawl_id
+          AND (p.url = links.url OR p.final_url = links.url OR p.canonical_url = links.url)
+    )
+    WHERE source_id = $1 AND target_id IS NULL
+`
+
+// Points the unresolved links of a crawl at a page just saved, by the URLs
+// it was requested at, redirected to, and names canonical
+const resolveLinksTo = `
+    UPDATE links SET target_id = $1
+    WHERE crawl_id = $2 AND target_id IS NULL AND url IN ($3, $4, $5)
+`
+
+// redirectChain encodes a page's redirect chain for its JSON column, or nil
+// when it was not redirected
+func redirectChain(page *models.Page) (interface{}, error) {
+    if len(page.RedirectChain) == 0 {
+        return nil, nil
+    }
+    chain, err := json.Marshal(page.RedirectChain)
+    if err != nil {
+        return nil, err
+    }
+    return string(chain), nil
+}
+
+// pageTiming returns a page's DNS, connect, TLS, TTFB, and download times
+// for their columns, all nil when it has no timing
+func pageTiming(page *models.Page) []interface{} {
+    timing := page.Timing
+    if timing == nil {
+        return []interface{}{nil, nil, nil, nil, nil}
+    }
+    return []interface{}{timing.DNS, timing.Connect, timing.TLS, timing.TTFB, timing.Download}
+}
+
+// pageHeaders encodes a page's response headers for their JSON column, or
+// nil when it has none
+func pageHeaders(page *models.Page) (interface{}, error) {
+    if len(page.Headers) == 0 {
+        return nil, nil
+    }
+    headers, err := json.Marshal(page.Headers)
+    if err != nil {
+        return nil, err
+    }
+    return string(headers), nil
+}
+
+// pageTLS encodes a page's TLS connection for its JSON column, or nil for
+// a page fetched over plain HTTP
+func pageTLS(page *models.Page) (interface{}, error) {
+    if page.TLS == nil {
+        return nil, nil
+    }
+    info, err := json.Marshal(page.TLS)
+    if err != nil {
+        return nil, err
+    }
+    return string(info), nil
+}
+
+// structuredData encodes a page's structured data items for their JSON
+// column, or nil when it had none
+func structuredData(page *models.Page) (interface{}, error) {
+    if len(page.StructuredData) == 0 {
+        return nil, nil
+    }
+    items, err := json.Marshal(page.StructuredData)
+    if err != nil {
+        return nil, err
+    }
+    return string(items), nil
+}
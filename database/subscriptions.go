@@ -0,0 +1,127 @@
+package database
+
+import (
+    "database/sql"
+    "encoding/json"
+
+    "smart-crawler/models"
+)
+
+const subscriptionColumns = `id, name, keywords, match_all, COALESCE(selector, ''), COALESCE(webhook_url, ''), created_at`
+
+func scanSubscription(row interface{ Scan(...interface{}) error }) (*models.Subscription, error) {
+    var sub models.Subscription
+    var keywords []byte
+    err := row.Scan(&sub.ID, &sub.Name, &keywords, &sub.MatchAll, &sub.Selector, &sub.WebhookURL, &sub.CreatedAt)
+    if err != nil {
+        return nil, err
+    }
+    if err := json.Unmarshal(keywords, &sub.Keywords); err != nil {
+        return nil, err
+    }
+    return &sub, nil
+}
+
+// CreateSubscription saves a subscription and sets its id and creation time
+func (p *PostgresDB) CreateSubscription(sub *models.Subscription) error {
+    keywords, err := json.Marshal(sub.Keywords)
+    if err != nil {
+        return err
+    }
+    if sub.Keywords == nil {
+        keywords = []byte("[]")
+    }
+
+    return p.DB.QueryRow(`
+        INSERT INTO subscriptions (name, keywords, match_all, selector, webhook_url)
+        VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''))
+        RETURNING id, created_at
+    `, sub.Name, string(keywords), sub.MatchAll, sub.Selector, sub.WebhookURL).Scan(&sub.ID, &sub.CreatedAt)
+}
+
+// GetSubscription returns a subscription, or sql.ErrNoRows if it does not
+// exist
+func (p *PostgresDB) GetSubscription(id int64) (*models.Subscription, error) {
+    return scanSubscription(p.DB.QueryRow("SELECT "+subscriptionColumns+" FROM subscriptions WHERE id = $1", id))
+}
+
+// ListSubscriptions returns every subscription, oldest first
+func (p *PostgresDB) ListSubscriptions() ([]models.Subscription, error) {
+    rows, err := p.DB.Query("SELECT " + subscriptionColumns + " FROM subscriptions ORDER BY id")
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    subs := []models.Subscription{}
+    for rows.Next() {
+        sub, err := scanSubscription(rows)
+        if err != nil {
+            return nil, err
+        }
+        subs = append(subs, *sub)
+    }
+
+    return subs, rows.Err()
+}
+
+// DeleteSubscription removes a subscription and its matches, or returns
+// sql.ErrNoRows if it does not exist
+func (p *PostgresDB) DeleteSubscription(id int64) error {
+    result, err := p.DB.Exec("DELETE FROM subscriptions WHERE id = $1", id)
+    if err != nil {
+        return err
+    }
+    if n, _ := result.RowsAffected(); n == 0 {
+        return sql.ErrNoRows
+    }
+    return nil
+}
+
+// SaveSubscriptionMatch records a match and sets its id and time, and
+// reports whether it is new: a page matching again with the same content
+// is not recorded twice.
+func (p *PostgresDB) SaveSubscriptionMatch(match *models.SubscriptionMatch, hash string) (bool, error) {
+    err := p.DB.QueryRow(`
+        INSERT INTO subscription_matches (subscription_id, page_id, crawl_id, url, title, snippet, hash)
+        VALUES ($1, $2, NULLIF($3, 0), $4, $5, $6, $7)
+        ON CONFLICT (subscription_id, page_id, hash) DO NOTHING
+        RETURNING id, matched_at
+    `, match.SubscriptionID, match.PageID, match.CrawlID, match.URL, match.Title, match.Snippet, hash).Scan(&match.ID, &match.MatchedAt)
+    if err == sql.ErrNoRows {
+        return false, nil
+    }
+    return err == nil, err
+}
+
+// ListSubscriptionMatches returns up to limit of a subscription's matches
+// with ids above afterID, oldest first, so a feed reader passes the last id
+// it has seen to get what is new
+func (p *PostgresDB) ListSubscriptionMatches(subscriptionID, afterID int64, limit int) ([]models.SubscriptionMatch, error) {
+    rows, err := p.DB.Query(`
+        SELECT m.id, m.subscription_id, m.page_id, COALESCE(m.crawl_id, 0), COALESCE(c.uuid, ''), m.url,
+               COALESCE(m.title, ''), COALESCE(m.snippet, ''), m.matched_at
+        FROM subscription_matches m
+        LEFT JOIN crawls c ON c.id = m.crawl_id
+        WHERE m.subscription_id = $1 AND m.id > $2
+        ORDER BY m.id
+        LIMIT $3
+    `, subscriptionID, afterID, limit)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    matches := []models.SubscriptionMatch{}
+    for rows.Next() {
+        var match models.SubscriptionMatch
+        err := rows.Scan(&match.ID, &match.SubscriptionID, &match.PageID, &match.CrawlID, &match.CrawlUUID,
+            &match.URL, &match.Title, &match.Snippet, &match.MatchedAt)
+        if err != nil {
+            return nil, err
+        }
+        matches = append(matches, match)
+    }
+
+    return matches, rows.Err()
+}
@@ -0,0 +1,34 @@
+package dataset
+
+import (
+    "crypto/hmac"
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/hex"
+)
+
+// urlHasher maps URLs to HMAC-SHA256 digests under a random key. Unlike a
+// plain hash, the digest of a known URL cannot be recomputed to find it in
+// the dataset, while equal URLs still hash alike so the graph stays intact.
+type urlHasher struct {
+    key []byte
+}
+
+func newURLHasher() (*urlHasher, error) {
+    key := make([]byte, 32)
+    if _, err := rand.Read(key); err != nil {
+        return nil, err
+    }
+    return &urlHasher{key: key}, nil
+}
+
+// hash returns the first 128 bits of the digest as hex. Empty URLs, such as
+// the seed's parent, stay empty.
+func (h *urlHasher) hash(url string) string {
+    if url == "" {
+        return ""
+    }
+    mac := hmac.New(sha256.New, h.key)
+    mac.Write([]byte(url))
+    return hex.EncodeToString(mac.Sum(nil)[:16])
+}
@@ -0,0 +1,292 @@
+package dataset
+
+import (
+    "bufio"
+    "encoding/xml"
+    "fmt"
+    "io"
+    "strconv"
+    "strings"
+
+    "smart-crawler/database"
+    "smart-crawler/models"
+)
+
+// GraphFormat is the file format a link graph is exported in
+type GraphFormat string
+
+const (
+    GraphML GraphFormat = "graphml"
+    DOT     GraphFormat = "dot"
+    GEXF    GraphFormat = "gexf"
+)
+
+func ParseGraphFormat(s string) (GraphFormat, error) {
+    switch format := GraphFormat(strings.ToLower(s)); format {
+    case GraphML, DOT, GEXF:
+        return format, nil
+    default:
+        return "", fmt.Errorf("invalid graph format %q, use 'graphml', 'dot', or 'gexf'", s)
+    }
+}
+
+// GraphStats counts what an exported graph holds
+type GraphStats struct {
+    Nodes int
+    Edges int
+}
+
+// graphWriter writes one graph format. Every node is written before the
+// first edge.
+type graphWriter interface {
+    begin(crawl *models.Crawl)
+    node(page *models.Page)
+    edge(id int, source, target int64, link *models.Link)
+    end()
+}
+
+// ExportGraph writes the link graph of a crawl session to w: its saved
+// pages as nodes, with their depth, importance, and content quality, and
+// the links between them as edges, with their anchor text and rel. Links
+// to pages the crawl did not save are left out. Crawls that recorded no
+// links, like traditional ones, get edges from the parent each page and
+// queued URL was found on, without anchors.
+func ExportGraph(db *database.PostgresDB, crawlID int64, w io.Writer, format GraphFormat) (*GraphStats, error) {
+    crawl, err := db.GetCrawl(crawlID)
+    if err != nil {
+        return nil, fmt.Errorf("failed to load crawl %d: %w", crawlID, err)
+    }
+
+    out := bufio.NewWriter(w)
+    var writer graphWriter
+    switch format {
+    case DOT:
+        writer = &dotWriter{out: out}
+    case GEXF:
+        writer = &gexfWriter{out: out}
+    default:
+        writer = &graphMLWriter{out: out}
+    }
+
+    stats := &GraphStats{}
+    writer.begin(crawl)
+
+    // Links name their targets by URL, and a page may have been reached at
+    // another URL than the one it was saved under
+    pageIDs := make(map[string]int64)
+    nodes := make(map[int64]bool)
+    err = db.ForEachCrawlNode(crawlID, func(page *models.Page) error {
+        pageIDs[page.URL] = page.ID
+        if page.FinalURL != "" {
+            if _, ok := pageIDs[page.FinalURL]; !ok {
+                pageIDs[page.FinalURL] = page.ID
+            }
+        }
+        nodes[page.ID] = true
+        writer.node(page)
+        stats.Nodes++
+        return nil
+    })
+    if err != nil {
+        return nil, fmt.Errorf("failed to read pages: %w", err)
+    }
+
+    addEdge := func(source, target int64, link *models.Link) {
+        if !nodes[source] || !nodes[target] {
+            return
+        }
+        stats.Edges++
+        writer.edge(stats.Edges, source, target, link)
+    }
+    recorded := false
+    err = db.ForEachCrawlLink(crawlID, func(link *models.Link) error {
+        recorded = true
+        target := link.TargetID
+        if target == 0 {
+            target = pageIDs[link.URL]
+        }
+        addEdge(link.SourceID, target, link)
+        return nil
+    })
+    if err != nil {
+        return nil, fmt.Errorf("failed to read links: %w", err)
+    }
+    if !recorded {
+        err = db.ForEachCrawlEdge(crawlID, func(from, to string) error {
+            addEdge(pageIDs[from], pageIDs[to], &models.Link{URL: to})
+            return nil
+        })
+        if err != nil {
+            return nil, fmt.Errorf("failed to read links: %w", err)
+        }
+    }
+
+    writer.end()
+    return stats, out.Flush()
+}
+
+func nodeID(pageID int64) string {
+    return "n" + strconv.FormatInt(pageID, 10)
+}
+
+func formatFloat(f float64) string {
+    return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// xmlText escapes s for XML text and attribute values
+func xmlText(s string) string {
+    var b strings.Builder
+    xml.EscapeText(&b, []byte(s))
+    return b.String()
+}
+
+// graphMLWriter writes GraphML, which networkx, Gephi, Cytoscape, and yEd
+// all read
+type graphMLWriter struct {
+    out *bufio.Writer
+}
+
+func (g *graphMLWriter) begin(crawl *models.Crawl) {
+    fmt.Fprintln(g.out, `<?xml version="1.0" encoding="UTF-8"?>`)
+    fmt.Fprintln(g.out, `<graphml xmlns="http://graphml.graphdrawing.org/xmlns">`)
+    for _, key := range []struct{ id, kind, typ string }{
+        {"url", "node", "string"},
+        {"title", "node", "string"},
+        {"status_code", "node", "int"},
+        {"depth", "node", "int"},
+        {"importance", "node", "double"},
+        {"content_quality", "node", "double"},
+        {"link_density", "node", "double"},
+        {"anchor", "edge", "string"},
+        {"rel", "edge", "string"},
+    } {
+        fmt.Fprintf(g.out, "  <key id=%q for=%q attr.name=%q attr.type=%q/>\n", key.id, key.kind, key.id, key.typ)
+    }
+    fmt.Fprintf(g.out, "  <graph id=\"crawl-%d\" edgedefault=\"directed\">\n", crawl.ID)
+}
+
+func (g *graphMLWriter) node(page *models.Page) {
+    fmt.Fprintf(g.out, "    <node id=\"%s\">", nodeID(page.ID))
+    g.data("url", page.URL)
+    g.data("title", page.Title)
+    g.data("status_code", strconv.Itoa(page.StatusCode))
+    g.data("depth", strconv.Itoa(page.Depth))
+    g.data("importance", formatFloat(page.Importance))
+    g.data("content_quality", formatFloat(page.ContentQuality))
+    g.data("link_density", formatFloat(page.LinkDensity))
+    fmt.Fprintln(g.out, "</node>")
+}
+
+func (g *graphMLWriter) edge(id int, source, target int64, link *models.Link) {
+    fmt.Fprintf(g.out, "    <edge id=\"e%d\" source=\"%s\" target=\"%s\">", id, nodeID(source), nodeID(target))
+    g.data("anchor", link.Anchor)
+    g.data("rel", link.Rel)
+    fmt.Fprintln(g.out, "</edge>")
+}
+
+func (g *graphMLWriter) data(key, value string) {
+    if value != "" {
+        fmt.Fprintf(g.out, "<data key=\"%s\">%s</data>", key, xmlText(value))
+    }
+}
+
+func (g *graphMLWriter) end() {
+    fmt.Fprintln(g.out, "  </graph>")
+    fmt.Fprintln(g.out, "</graphml>")
+}
+
+// dotWriter writes Graphviz DOT
+type dotWriter struct {
+    out *bufio.Writer
+}
+
+// dotQuote quotes s as a DOT string
+func dotQuote(s string) string {
+    s = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\r", "", "\n", `\n`).Replace(s)
+    return `"` + s + `"`
+}
+
+func (d *dotWriter) begin(crawl *models.Crawl) {
+    fmt.Fprintf(d.out, "digraph %s {\n", dotQuote(fmt.Sprintf("crawl-%d", crawl.ID)))
+}
+
+func (d *dotWriter) node(page *models.Page) {
+    label := page.Title
+    if strings.TrimSpace(label) == "" {
+        label = page.URL
+    }
+    fmt.Fprintf(d.out, "  %s [label=%s, url=%s, status_code=%d, depth=%d, importance=%s, content_quality=%s, link_density=%s];\n",
+        nodeID(page.ID), dotQuote(strings.TrimSpace(label)), dotQuote(page.URL), page.StatusCode, page.Depth,
+        formatFloat(page.Importance), formatFloat(page.ContentQuality), formatFloat(page.LinkDensity))
+}
+
+func (d *dotWriter) edge(id int, source, target int64, link *models.Link) {
+    fmt.Fprintf(d.out, "  %s -> %s [anchor=%s, rel=%s];\n", nodeID(source), nodeID(target), dotQuote(link.Anchor), dotQuote(link.Rel))
+}
+
+func (d *dotWriter) end() {
+    fmt.Fprintln(d.out, "}")
+}
+
+// gexfWriter writes GEXF 1.3, Gephi's own format
+type gexfWriter struct {
+    out   *bufio.Writer
+    edges bool // The edges element has been opened
+}
+
+func (g *gexfWriter) begin(crawl *models.Crawl) {
+    fmt.Fprintln(g.out, `<?xml version="1.0" encoding="UTF-8"?>`)
+    fmt.Fprintln(g.out, `<gexf xmlns="http://gexf.net/1.3" version="1.3">`)
+    fmt.Fprintf(g.out, "  <meta><creator>smart-crawler</creator><description>Crawl %d (%s) of %s</description></meta>\n",
+        crawl.ID, xmlText(crawl.UUID), xmlText(crawl.StartURL))
+    fmt.Fprintln(g.out, `  <graph defaultedgetype="directed" mode="static">`)
+    fmt.Fprintln(g.out, `    <attributes class="node">`)
+    for i, attr := range []struct{ title, typ string }{
+        {"url", "string"}, {"status_code", "integer"}, {"depth", "integer"},
+        {"importance", "double"}, {"content_quality", "double"}, {"link_density", "double"},
+    } {
+        fmt.Fprintf(g.out, "      <attribute id=\"%d\" title=%q type=%q/>\n", i, attr.title, attr.typ)
+    }
+    fmt.Fprintln(g.out, `    </attributes>`)
+    fmt.Fprintln(g.out, `    <attributes class="edge">`)
+    fmt.Fprintln(g.out, `      <attribute id="0" title="anchor" type="string"/>`)
+    fmt.Fprintln(g.out, `      <attribute id="1" title="rel" type="string"/>`)
+    fmt.Fprintln(g.out, `    </attributes>`)
+    fmt.Fprintln(g.out, `    <nodes>`)
+}
+
+func (g *gexfWriter) node(page *models.Page) {
+    label := strings.TrimSpace(page.Title)
+    if label == "" {
+        label = page.URL
+    }
+    fmt.Fprintf(g.out, "      <node id=\"%s\" label=\"%s\"><attvalues>", nodeID(page.ID), xmlText(label))
+    for i, value := range []string{
+        page.URL, strconv.Itoa(page.StatusCode), strconv.Itoa(page.Depth),
+        formatFloat(page.Importance), formatFloat(page.ContentQuality), formatFloat(page.LinkDensity),
+    } {
+        fmt.Fprintf(g.out, "<attvalue for=\"%d\" value=\"%s\"/>", i, xmlText(value))
+    }
+    fmt.Fprintln(g.out, "</attvalues></node>")
+}
+
+func (g *gexfWriter) edge(id int, source, target int64, link *models.Link) {
+    if !g.edges {
+        fmt.Fprintln(g.out, `    </nodes>`)
+        fmt.Fprintln(g.out, `    <edges>`)
+        g.edges = true
+    }
+    fmt.Fprintf(g.out, "      <edge id=\"e%d\" source=\"%s\" target=\"%s\"><attvalues>", id, nodeID(source), nodeID(target))
+    fmt.Fprintf(g.out, "<attvalue for=\"0\" value=\"%s\"/><attvalue for=\"1\" value=\"%s\"/>", xmlText(link.Anchor), xmlText(link.Rel))
+    fmt.Fprintln(g.out, "</attvalues></edge>")
+}
+
+func (g *gexfWriter) end() {
+    if !g.edges {
+        fmt.Fprintln(g.out, `    </nodes>`)
+        fmt.Fprintln(g.out, `    <edges>`)
+    }
+    fmt.Fprintln(g.out, `    </edges>`)
+    fmt.Fprintln(g.out, `  </graph>`)
+    fmt.Fprintln(g.out, `</gexf>`)
+}
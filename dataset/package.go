@@ -0,0 +1,289 @@
+package dataset
+
+import (
+    "archive/tar"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+    "time"
+
+    "github.com/klauspost/compress/zstd"
+    "github.com/parquet-go/parquet-go"
+
+    "smart-crawler/database"
+    "smart-crawler/models"
+)
+
+// Format is the encoding of the tables inside a dataset archive
+type Format string
+
+const (
+    FormatJSONL   Format = "jsonl"
+    FormatParquet Format = "parquet"
+)
+
+func ParseFormat(s string) (Format, error) {
+    switch format := Format(s); format {
+    case FormatJSONL, FormatParquet:
+        return format, nil
+    default:
+        return "", fmt.Errorf("invalid dataset format %q, use 'jsonl' or 'parquet'", s)
+    }
+}
+
+// Options controls what a dataset archive contains
+type Options struct {
+    Format Format
+    // Anonymize drops page titles and bodies, keeping only structure, scores,
+    // and timings, so the dataset can be shared without redistributing content
+    Anonymize bool
+    // HashURLs replaces every URL with a keyed hash. The key is random and
+    // not stored, so hashes are consistent within one archive only.
+    HashURLs bool
+}
+
+// Manifest describes a dataset archive; it is stored as manifest.json
+type Manifest struct {
+    Crawl      *models.Crawl  `json:"crawl"`
+    Format     Format         `json:"format"`
+    Anonymized bool           `json:"anonymized,omitempty"`
+    HashedURLs bool           `json:"hashed_urls,omitempty"`
+    CreatedAt  time.Time      `json:"created_at"`
+    Files      []ManifestFile `json:"files"`
+}
+
+type ManifestFile struct {
+    Name    string `json:"name"`
+    Records int    `json:"records"`
+    Size    int64  `json:"size"`
+    SHA256  string `json:"sha256"`
+}
+
+// PageRecord is one row of the pages table. CrawlUUID, on links too, lets
+// the tables of several archives be combined and still be told apart.
+type PageRecord struct {
+    ID             int64     `json:"id" parquet:"id"`
+    CrawlUUID      string    `json:"crawl_uuid" parquet:"crawl_uuid"`
+    URL            string    `json:"url" parquet:"url"`
+    Title          string    `json:"title" parquet:"title"`
+    StatusCode     int       `json:"status_code" parquet:"status_code"`
+    ContentType    string    `json:"content_type" parquet:"content_type"`
+    Size           int64     `json:"size" parquet:"size"`
+    LoadTimeMs     int64     `json:"load_time_ms" parquet:"load_time_ms"`
+    Depth          int       `json:"depth" parquet:"depth"`
+    ParentURL      string    `json:"parent_url" parquet:"parent_url"`
+    CrawledAt      time.Time `json:"crawled_at" parquet:"crawled_at,timestamp"`
+    Hash           string    `json:"hash" parquet:"hash"`
+    Importance     float64   `json:"importance" parquet:"importance"`
+    ContentQuality float64   `json:"content_quality" parquet:"content_quality"`
+    LinkDensity    float64   `json:"link_density" parquet:"link_density"`
+    Content        string    `json:"content" parquet:"content,zstd"`
+}
+
+// LinkRecord is one edge of the link graph
+type LinkRecord struct {
+    CrawlUUID string `json:"crawl_uuid" parquet:"crawl_uuid"`
+    From      string `json:"from" parquet:"from"`
+    To        string `json:"to" parquet:"to"`
+}
+
+// Package writes the pages, link graph, and manifest of a crawl session to
+// a zstd-compressed tar archive at outPath.
+func Package(db *database.PostgresDB, crawlID int64, outPath string, opts Options) (*Manifest, error) {
+    crawl, err := db.GetCrawl(crawlID)
+    if err != nil {
+        return nil, fmt.Errorf("failed to load crawl %d: %w", crawlID, err)
+    }
+
+    url := func(u string) string { return u }
+    if opts.HashURLs {
+        hasher, err := newURLHasher()
+        if err != nil {
+            return nil, err
+        }
+        url = hasher.hash
+        crawl.StartURL = url(crawl.StartURL)
+    }
+    format := opts.Format
+
+    // Tables are staged on disk because tar headers need their sizes
+    dir, err := os.MkdirTemp("", "smart-crawler-dataset-")
+    if err != nil {
+        return nil, err
+    }
+    defer os.RemoveAll(dir)
+
+    manifest := &Manifest{
+        Crawl:      crawl,
+        Format:     format,
+        Anonymized: opts.Anonymize,
+        HashedURLs: opts.HashURLs,
+        CreatedAt:  time.Now().UTC(),
+    }
+
+    pages, err := writeTable(dir, "pages."+string(format), format, func(write func(PageRecord) error) error {
+        return db.ForEachCrawlPage(crawlID, func(page *models.Page) error {
+            if opts.Anonymize {
+                page.Title, page.Content = "", ""
+            }
+            return write(PageRecord{
+                ID:             page.ID,
+                CrawlUUID:      crawl.UUID,
+                URL:            url(page.URL),
+                Title:          page.Title,
+                StatusCode:     page.StatusCode,
+                ContentType:    page.ContentType,
+                Size:           page.Size,
+                LoadTimeMs:     page.LoadTime,
+                Depth:          page.Depth,
+                ParentURL:      url(page.ParentURL),
+                CrawledAt:      page.CrawledAt,
+                Hash:           page.Hash,
+                Importance:     page.Importance,
+                ContentQuality: page.ContentQuality,
+                LinkDensity:    page.LinkDensity,
+                Content:        page.Content,
+            })
+        })
+    })
+    if err != nil {
+        return nil, fmt.Errorf("failed to write pages: %w", err)
+    }
+
+    links, err := writeTable(dir, "links."+string(format), format, func(write func(LinkRecord) error) error {
+        return db.ForEachCrawlEdge(crawlID, func(from, to string) error {
+            return write(LinkRecord{CrawlUUID: crawl.UUID, From: url(from), To: url(to)})
+        })
+    })
+    if err != nil {
+        return nil, fmt.Errorf("failed to write links: %w", err)
+    }
+    manifest.Files = []ManifestFile{*pages, *links}
+
+    manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+    if err != nil {
+        return nil, err
+    }
+    if err := os.WriteFile(filepath.Join(dir, "manifest.json"), manifestJSON, 0o644); err != nil {
+        return nil, err
+    }
+
+    // The manifest goes first so readers can inspect it without unpacking the rest
+    names := []string{"manifest.json", pages.Name, links.Name}
+    if err := writeArchive(outPath, dir, names); err != nil {
+        return nil, fmt.Errorf("failed to write archive: %w", err)
+    }
+
+    return manifest, nil
+}
+
+// writeTable creates dir/name and fills it with the records produced by
+// fill, encoded as format
+func writeTable[T any](dir, name string, format Format, fill func(write func(T) error) error) (*ManifestFile, error) {
+    file, err := os.Create(filepath.Join(dir, name))
+    if err != nil {
+        return nil, err
+    }
+    defer file.Close()
+
+    hash := sha256.New()
+    out := io.MultiWriter(file, hash)
+    records := 0
+
+    var write func(T) error
+    var flush func() error
+    switch format {
+    case FormatParquet:
+        writer := parquet.NewGenericWriter[T](out)
+        write = func(record T) error {
+            _, err := writer.Write([]T{record})
+            return err
+        }
+        flush = writer.Close
+    default:
+        encoder := json.NewEncoder(out)
+        write = func(record T) error { return encoder.Encode(record) }
+        flush = func() error { return nil }
+    }
+
+    err = fill(func(record T) error {
+        records++
+        return write(record)
+    })
+    if err != nil {
+        return nil, err
+    }
+    if err := flush(); err != nil {
+        return nil, err
+    }
+
+    info, err := file.Stat()
+    if err != nil {
+        return nil, err
+    }
+
+    return &ManifestFile{
+        Name:    name,
+        Records: records,
+        Size:    info.Size(),
+        SHA256:  hex.EncodeToString(hash.Sum(nil)),
+    }, file.Close()
+}
+
+func writeArchive(outPath, dir string, names []string) error {
+    out, err := os.Create(outPath)
+    if err != nil {
+        return err
+    }
+    defer out.Close()
+
+    compressed, err := zstd.NewWriter(out)
+    if err != nil {
+        return err
+    }
+    archive := tar.NewWriter(compressed)
+
+    for _, name := range names {
+        if err := addFile(archive, filepath.Join(dir, name), name); err != nil {
+            return err
+        }
+    }
+
+    if err := archive.Close(); err != nil {
+        return err
+    }
+    if err := compressed.Close(); err != nil {
+        return err
+    }
+    return out.Close()
+}
+
+func addFile(archive *tar.Writer, path, name string) error {
+    file, err := os.Open(path)
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+
+    info, err := file.Stat()
+    if err != nil {
+        return err
+    }
+
+    header, err := tar.FileInfoHeader(info, "")
+    if err != nil {
+        return err
+    }
+    header.Name = name
+    header.Mode = 0o644
+
+    if err := archive.WriteHeader(header); err != nil {
+        return err
+    }
+    _, err = io.Copy(archive, file)
+    return err
+}
@@ -0,0 +1,335 @@
+package frontier
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "strings"
+    "time"
+
+    "github.com/redis/go-redis/v9"
+
+    "smart-crawler/models"
+)
+
+// Claims not marked done within this long are returned to the queue, so
+// URLs held by a crashed instance are eventually crawled by another.
+const claimTimeout = 5 * time.Minute
+
+const (
+    // Pending URLs whose priorities fall in the same band of this width are
+    // claimed round-robin by parent page, as with the Postgres queue.
+    fairnessBand = 10
+    // A claim looks at up to this many times its limit of top candidates
+    fairnessScan = 10
+)
+
+// Keys, relative to the configured prefix:
+//   queue        sorted set of pending URLs scored by priority
+//   inflight     sorted set of claimed URLs scored by claim time
+//   meta         hash of URL to its JSON encoded URLPriority
+//   visited      set of every URL ever enqueued
+//   fingerprints hash of each URL fingerprint to the URL enqueued under it
+
+// addScript queues URLs once per fingerprint: a URL whose fingerprint was
+// enqueued under another URL raises that URL's priority instead
+var addScript = redis.NewScript(`
+local queue, meta, visited, fingerprints = KEYS[1], KEYS[2], KEYS[3], KEYS[4]
+for i = 1, #ARGV, 4 do
+    local url, priority, data, fingerprint = ARGV[i], ARGV[i + 1], ARGV[i + 2], ARGV[i + 3]
+    local first = redis.call('HGET', fingerprints, fingerprint)
+    if first then
+        url = first
+    else
+        redis.call('HSET', fingerprints, fingerprint, url)
+    end
+    if redis.call('SADD', visited, url) == 1 then
+        redis.call('ZADD', queue, priority, url)
+        redis.call('HSET', meta, url, data)
+    else
+        redis.call('ZADD', queue, 'XX', 'GT', priority, url)
+    end
+end
+return 0
+`)
+
+var claimScript = redis.NewScript(`
+local queue, inflight, meta = KEYS[1], KEYS[2], KEYS[3]
+local limit, now, stale = tonumber(ARGV[1]), tonumber(ARGV[2]), tonumber(ARGV[3])
+local width, scan = tonumber(ARGV[4]), tonumber(ARGV[5])
+local except = {}
+for i = 6, #ARGV do
+    except[ARGV[i]] = true
+end
+
+local expired = redis.call('ZRANGEBYSCORE', inflight, '-inf', stale)
+for _, url in ipairs(expired) do
+    local priority = 0
+    local data = redis.call('HGET', meta, url)
+    if data then
+        priority = cjson.decode(data).Priority or 0
+    end
+    redis.call('ZREM', inflight, url)
+    redis.call('ZADD', queue, priority, url)
+end
+
+-- Take the top candidates, less those of excepted hosts, and, within each
+-- priority band, hand them out round-robin by parent so one hub page cannot
+-- fill the whole claim
+local ranked = redis.call('ZREVRANGE', queue, 0, limit * scan - 1, 'WITHSCORES')
+local candidates = {}
+for j = 1, #ranked, 2 do
+    local host = string.match(ranked[j], '^[^:/]+://([^/?#]+)')
+    if not (host and except[host]) then
+        table.insert(candidates, ranked[j])
+        table.insert(candidates, ranked[j + 1])
+    end
+end
+local claimed = {}
+local i = 1
+while i <= #candidates and #claimed < limit do
+    local band = math.floor(tonumber(candidates[i + 1]) / width)
+    local byParent, parents = {}, {}
+    while i <= #candidates and math.floor(tonumber(candidates[i + 1]) / width) == band do
+        local url, parent = candidates[i], ''
+        local data = redis.call('HGET', meta, url)
+        if data then
+            parent = cjson.decode(data).Parent or ''
+        end
+        if not byParent[parent] then
+            byParent[parent] = {}
+            table.insert(parents, parent)
+        end
+        table.insert(byParent[parent], url)
+        i = i + 2
+    end
+
+    local round, took = 1, true
+    while took and #claimed < limit do
+        took = false
+        for _, parent in ipairs(parents) do
+            local url = byParent[parent][round]
+            if url and #claimed < limit then
+                table.insert(claimed, url)
+                took = true
+            end
+        end
+        round = round + 1
+    end
+end
+
+for _, url in ipairs(claimed) do
+    redis.call('ZREM', queue, url)
+    redis.call('ZADD', inflight, now, url)
+end
+return claimed
+`)
+
+// pruneScript removes URLs still pending; ones claimed since they were
+// scanned keep their metadata
+var pruneScript = redis.NewScript(`
+local queue, meta = KEYS[1], KEYS[2]
+local removed = 0
+for _, url in ipairs(ARGV) do
+    if redis.call('ZREM', queue, url) == 1 then
+        redis.call('HDEL', meta, url)
+        removed = removed + 1
+    end
+end
+return removed
+`)
+
+// releaseScript returns claimed URLs to the queue at their priority,
+// skipping ones no longer claimed
+var releaseScript = redis.NewScript(`
+local queue, inflight, meta = KEYS[1], KEYS[2], KEYS[3]
+local released = 0
+for _, url in ipairs(ARGV) do
+    if redis.call('ZREM', inflight, url) == 1 then
+        local priority = 0
+        local data = redis.call('HGET', meta, url)
+        if data then
+            priority = cjson.decode(data).Priority or 0
+        end
+        redis.call('ZADD', queue, priority, url)
+        released = released + 1
+    end
+end
+return released
+`)
+
+// Redis is a frontier shared by every crawler instance pointed at the same
+// Redis server and key prefix. Claims are atomic, so no two instances are
+// handed the same URL.
+type Redis struct {
+    client *redis.Client
+    prefix string
+}
+
+func NewRedis(redisURL, prefix string) (*Redis, error) {
+    options, err := redis.ParseURL(redisURL)
+    if err != nil {
+        return nil, fmt.Errorf("invalid redis url: %w", err)
+    }
+
+    client := redis.NewClient(options)
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    if err := client.Ping(ctx).Err(); err != nil {
+        client.Close()
+        return nil, fmt.Errorf("failed to ping redis: %w", err)
+    }
+
+    return &Redis{client: client, prefix: prefix}, nil
+}
+
+func (r *Redis) key(name string) string {
+    return r.prefix + ":" + name
+}
+
+func (r *Redis) Add(urls []models.URLPriority) error {
+    if len(urls) == 0 {
+        return nil
+    }
+
+    args := make([]interface{}, 0, len(urls)*4)
+    for _, url := range urls {
+        data, err := json.Marshal(url)
+        if err != nil {
+            return err
+        }
+        fingerprint := url.Fingerprint
+        if fingerprint == "" {
+            fingerprint = url.URL
+        }
+        args = append(args, url.URL, url.Priority, data, fingerprint)
+    }
+
+    keys := []string{r.key("queue"), r.key("meta"), r.key("visited"), r.key("fingerprints")}
+    return addScript.Run(context.Background(), r.client, keys, args...).Err()
+}
+
+func (r *Redis) Next(limit int) ([]models.URLPriority, error) {
+    return r.NextExcept(limit, nil)
+}
+
+// NextExcept claims like Next, passing over the URLs of hosts among the
+// top candidates
+func (r *Redis) NextExcept(limit int, hosts []string) ([]models.URLPriority, error) {
+    ctx := context.Background()
+    now := time.Now()
+
+    args := []interface{}{limit, now.Unix(), now.Add(-claimTimeout).Unix(), fairnessBand, fairnessScan}
+    for _, host := range hosts {
+        args = append(args, host)
+    }
+    keys := []string{r.key("queue"), r.key("inflight"), r.key("meta")}
+    claimed, err := claimScript.Run(ctx, r.client, keys, args...).StringSlice()
+    if err != nil || len(claimed) == 0 {
+        return nil, err
+    }
+
+    values, err := r.client.HMGet(ctx, r.key("meta"), claimed...).Result()
+    if err != nil {
+        return nil, err
+    }
+
+    urls := make([]models.URLPriority, 0, len(values))
+    for i, value := range values {
+        data, ok := value.(string)
+        if !ok {
+            // Metadata lost; crawl it as a bare URL rather than drop it
+            urls = append(urls, models.URLPriority{URL: claimed[i]})
+            continue
+        }
+
+        var url models.URLPriority
+        if err := json.Unmarshal([]byte(data), &url); err != nil {
+            return nil, err
+        }
+        urls = append(urls, url)
+    }
+
+    return urls, nil
+}
+
+func (r *Redis) Done(url string) error {
+    ctx := context.Background()
+
+    _, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+        pipe.ZRem(ctx, r.key("queue"), url)
+        pipe.ZRem(ctx, r.key("inflight"), url)
+        pipe.HDel(ctx, r.key("meta"), url)
+        return nil
+    })
+    return err
+}
+
+// Release hands claimed URLs back for any instance to claim
+func (r *Redis) Release(urls []string) (int, error) {
+    if len(urls) == 0 {
+        return 0, nil
+    }
+    args := make([]interface{}, len(urls))
+    for i, url := range urls {
+        args[i] = url
+    }
+    keys := []string{r.key("queue"), r.key("inflight"), r.key("meta")}
+    return releaseScript.Run(context.Background(), r.client, keys, args...).Int()
+}
+
+// Pending counts the URLs waiting to be claimed by any instance
+func (r *Redis) Pending() (int, error) {
+    n, err := r.client.ZCard(context.Background(), r.key("queue")).Result()
+    return int(n), err
+}
+
+// Prune removes pending URLs, leaving them in the visited set so they are
+// not queued again. URLs already claimed are not touched.
+func (r *Redis) Prune(origin string, disallowed func(url string) bool) (int, error) {
+    ctx := context.Background()
+
+    var drop []string
+    iter := r.client.ZScan(ctx, r.key("queue"), 0, globEscape(origin)+"*", 1000).Iterator()
+    for iter.Next(ctx) {
+        // ZSCAN returns members and scores alternately
+        url := iter.Val()
+        if !iter.Next(ctx) {
+            break
+        }
+        if disallowed(url) {
+            drop = append(drop, url)
+        }
+    }
+    if err := iter.Err(); err != nil {
+        return 0, err
+    }
+    if len(drop) == 0 {
+        return 0, nil
+    }
+
+    args := make([]interface{}, len(drop))
+    for i, url := range drop {
+        args[i] = url
+    }
+    keys := []string{r.key("queue"), r.key("meta")}
+    removed, err := pruneScript.Run(ctx, r.client, keys, args...).Int()
+    return removed, err
+}
+
+// globEscape escapes the characters special to Redis MATCH patterns
+func globEscape(s string) string {
+    var b strings.Builder
+    for _, r := range s {
+        switch r {
+        case '*', '?', '[', ']', '\\':
+            b.WriteByte('\\')
+        }
+        b.WriteRune(r)
+    }
+    return b.String()
+}
+
+func (r *Redis) Close() error {
+    return r.client.Close()
+}
@@ -3,42 +3,197 @@ package main
 import (
     "context"
     "flag"
+    "fmt"
     "log"
+    "math"
     "os"
     "os/signal"
+    "strings"
     "syscall"
     "time"
 
-    "smart-crawler/benchmark"
+    "smart-crawler/audit"
+    "smart-crawler/blobstore"
     "smart-crawler/config"
     "smart-crawler/crawler"
     "smart-crawler/database"
+    "smart-crawler/models"
+    "smart-crawler/tracing"
 )
 
+// command is a subcommand; run parses its own flags from args
+type command struct {
+    name    string
+    summary string
+    run     func(args []string)
+}
+
+var commands = []command{
+    {"crawl", "Crawl a site with the smart or traditional crawler, continuously, or from a WARC archive", runCrawl},
+    {"benchmark", "Compare the traditional and smart crawlers on a site", runBenchmark},
+    {"report", "Compare a benchmark result with earlier ones to catch regressions, or export them", runReport},
+    {"serve", "Run the REST API (and optionally gRPC) for starting and querying crawls", runServe},
+    {"search", "Query the pages stored by past crawls", runSearch},
+    {"export", "Write a crawl session as a dataset package or link graph", runExport},
+    {"queue", "List, or queue again, the URLs that failed every attempt", runQueue},
+    {"migrate", "Migrate the database schema and compress page bodies stored before compression", runMigrate},
+    {"audit", "Check a politeness audit log against the rate limits it declares", runAudit},
+    {"security", "Report the security headers and TLS of each host a crawl session fetched", runSecurity},
+}
+
 func main() {
-    // Command line flags
-    var (
-        mode = flag.String("mode", "smart", "Crawler mode: 'traditional', 'smart', or 'benchmark'")
-        url  = flag.String("url", "https://example.com", "Starting URL to crawl")
-        depth = flag.Int("depth", 3, "Maximum crawl depth")
-        workers = flag.Int("workers", 10, "Number of concurrent workers")
-    )
-    flag.Parse()
-
-    // Load configuration
-    cfg := config.Load()
-    
-    // Initialize database
-    db, err := database.NewPostgresDB(cfg.DatabaseURL)
+    if len(os.Args) < 2 {
+        usage()
+        os.Exit(2)
+    }
+
+    name, args := os.Args[1], os.Args[2:]
+    if name == "help" || name == "-h" || name == "-help" || name == "--help" {
+        if len(args) == 0 {
+            usage()
+            return
+        }
+        name, args = args[0], []string{"-h"}
+    }
+    for _, cmd := range commands {
+        if cmd.name == name {
+            cmd.run(args)
+            return
+        }
+    }
+
+    if strings.HasPrefix(name, "-") {
+        fmt.Fprintf(os.Stderr, "Flags follow a command; -mode was replaced by the commands below\n\n")
+    } else {
+        fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", name)
+    }
+    usage()
+    os.Exit(2)
+}
+
+func usage() {
+    out := os.Stderr
+    fmt.Fprintf(out, "Usage: smart-crawler <command> [flags]\n\nCommands:\n")
+    for _, cmd := range commands {
+        fmt.Fprintf(out, "  %-10s %s\n", cmd.name, cmd.summary)
+    }
+    fmt.Fprintf(out, "\nRun 'smart-crawler <command> -h' for the flags of a command.\n")
+}
+
+// newFlagSet returns the flags of a command, with help text that describes
+// it. args names its positional arguments, if it takes any.
+func newFlagSet(name, args, description string) *flag.FlagSet {
+    fs := flag.NewFlagSet(name, flag.ExitOnError)
+    fs.Usage = func() {
+        fmt.Fprintf(fs.Output(), "Usage: smart-crawler %s [flags]%s\n\n%s\n\nFlags:\n", name, args, description)
+        fs.PrintDefaults()
+    }
+    return fs
+}
+
+// parseFlags parses the flags of a command that takes no positional
+// arguments
+func parseFlags(fs *flag.FlagSet, args []string) {
+    fs.Parse(args)
+    if fs.NArg() > 0 {
+        fmt.Fprintf(fs.Output(), "Unexpected argument %q\n\n", fs.Arg(0))
+        fs.Usage()
+        os.Exit(2)
+    }
+}
+
+// loadConfig reads the environment, exiting on invalid settings
+func loadConfig() *config.Config {
+    cfg, err := config.Load()
+    if err != nil {
+        log.Fatalf("Invalid configuration:\n%v", err)
+    }
+    return cfg
+}
+
+// startTracing exports the crawl pipeline's spans when an OTLP endpoint is
+// set. The returned function flushes them before the command exits.
+func startTracing(cfg *config.Config) func() {
+    settings := tracing.Config{
+        Endpoint:       cfg.OTLPEndpoint,
+        TracesEndpoint: cfg.OTLPTracesEndpoint,
+        ServiceName:    cfg.ServiceName,
+    }
+    shutdown, err := tracing.Start(context.Background(), settings)
+    if err != nil {
+        log.Fatalf("Failed to start tracing: %v", err)
+    }
+    if settings.Enabled() {
+        log.Printf("Exporting traces as service %s", cfg.ServiceName)
+    }
+    return func() {
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        if err := shutdown(ctx); err != nil {
+            log.Printf("Failed to export traces: %v", err)
+        }
+    }
+}
+
+// storeFlags select the database of the commands that use one
+type storeFlags struct {
+    kind *string
+}
+
+func addStoreFlags(fs *flag.FlagSet) *storeFlags {
+    return &storeFlags{
+        kind: fs.String("store", "postgres", "Storage backend: 'postgres' or 'duckdb' (local file at DUCKDB_PATH)"),
+    }
+}
+
+// open connects to the selected store, checking its schema version, and
+// keeps page bodies in BLOB_STORE if it is set
+func (f *storeFlags) open(cfg *config.Config) database.Store {
+    var db database.Store
+    var err error
+    switch *f.kind {
+    case "postgres":
+        db, err = database.NewPostgresDB(cfg.DatabaseURL)
+    case "duckdb":
+        db, err = database.NewDuckDB(cfg.DuckDBPath)
+    default:
+        log.Fatalf("Invalid store: %s. Use 'postgres' or 'duckdb'", *f.kind)
+    }
     if err != nil {
         log.Fatalf("Failed to connect to database: %v", err)
     }
-    defer db.Close()
 
-    // Setup graceful shutdown
-    ctx, cancel := context.WithCancel(context.Background())
-    defer cancel()
+    // Page bodies in a directory or S3 bucket instead of the database
+    if cfg.BlobStore != "" {
+        blobs, err := blobstore.Open(cfg.BlobStore)
+        if err != nil {
+            log.Fatalf("Failed to open blob store: %v", err)
+        }
+        postgres, ok := db.(*database.PostgresDB)
+        if !ok {
+            log.Fatalf("BLOB_STORE requires -store=postgres")
+        }
+        postgres.SetBlobStore(blobs)
+        log.Printf("Storing page bodies in %s", blobs)
+    }
+
+    logRepairs(db.SchemaReport())
+    return db
+}
 
+// requirePostgres returns db for commands that need the full Postgres API
+func requirePostgres(db database.Store, command string) *database.PostgresDB {
+    postgres, ok := db.(*database.PostgresDB)
+    if !ok {
+        log.Fatalf("%s requires -store=postgres", command)
+    }
+    return postgres
+}
+
+// signalContext returns a context cancelled on Ctrl+C or SIGTERM, so crawls
+// and servers shut down gracefully
+func signalContext() (context.Context, context.CancelFunc) {
+    ctx, cancel := context.WithCancel(context.Background())
     go func() {
         sigChan := make(chan os.Signal, 1)
         signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
@@ -46,47 +201,151 @@ func main() {
         log.Println("Shutting down gracefully...")
         cancel()
     }()
+    return ctx, cancel
+}
 
-    switch *mode {
-    case "traditional":
-        runTraditionalCrawler(ctx, db, *url, *depth, *workers)
-    case "smart":
-        runSmartCrawler(ctx, db, *url, *depth, *workers)
-    case "benchmark":
-        benchmark.RunComparison(ctx, db, *url, *depth, *workers)
-    default:
-        log.Fatalf("Invalid mode: %s. Use 'traditional', 'smart', or 'benchmark'", *mode)
+// fetchOptions are the crawler options set from the environment. Without
+// RATE_LIMIT each crawler keeps its own rate.
+func fetchOptions(cfg *config.Config) []crawler.Option {
+    options := []crawler.Option{
+        crawler.WithUserAgent(cfg.UserAgent),
+        crawler.WithRequestTimeout(cfg.RequestTimeout),
+    }
+    if cfg.RateLimit > 0 {
+        // A burst of two seconds' worth, like the crawlers' defaults
+        options = append(options, crawler.WithRateLimit(cfg.RateLimit, int(math.Ceil(2*cfg.RateLimit))))
+    }
+    version, err := crawler.ParseHTTPVersion(cfg.HTTPVersion)
+    if err != nil {
+        log.Fatalf("Invalid HTTP_VERSION: %v", err)
+    }
+    httpOptions := crawler.DefaultHTTPOptions
+    httpOptions.Version = version
+    httpOptions.MaxConnsPerHost = cfg.HTTPMaxConnsPerHost
+    options = append(options, crawler.WithHTTP(httpOptions))
+    if cfg.PriorityRules != "" {
+        rules, err := crawler.LoadPriorityRules(cfg.PriorityRules)
+        if err != nil {
+            log.Fatalf("Invalid PRIORITY_RULES: %v", err)
+        }
+        options = append(options, crawler.WithPriorityRules(rules))
     }
+    if cfg.ExtractionRules != "" {
+        rules, err := crawler.LoadExtractionRules(cfg.ExtractionRules)
+        if err != nil {
+            log.Fatalf("Invalid EXTRACTION_RULES: %v", err)
+        }
+        options = append(options, crawler.WithExtractionRules(rules))
+    }
+    // One cache for every crawler the command runs
+    if cfg.DNSMaxTTL > 0 {
+        var servers []string
+        for _, server := range strings.Split(cfg.DNSServers, ",") {
+            if server = strings.TrimSpace(server); server != "" {
+                servers = append(servers, server)
+            }
+        }
+        options = append(options, crawler.WithDNSCache(crawler.NewDNSCache(crawler.DNSOptions{
+            Servers:     servers,
+            MinTTL:      cfg.DNSMinTTL,
+            MaxTTL:      cfg.DNSMaxTTL,
+            NegativeTTL: cfg.DNSNegativeTTL,
+        })))
+    }
+    return options
 }
 
-func runTraditionalCrawler(ctx context.Context, db *database.PostgresDB, startURL string, maxDepth, workers int) {
-    log.Printf("Starting traditional crawler on %s with depth %d and %d workers", startURL, maxDepth, workers)
-    
-    traditionalCrawler := crawler.NewTraditional(db, workers)
-    start := time.Now()
-    
-    stats, err := traditionalCrawler.Crawl(ctx, startURL, maxDepth)
+// loadProxies builds the pool of PROXY_LIST and PROXY_FILE, or returns nil
+// when neither is set
+func loadProxies(cfg *config.Config) *crawler.ProxyPool {
+    if cfg.ProxyList == "" && cfg.ProxyFile == "" {
+        return nil
+    }
+    proxyURLs := crawler.ParseProxyList(cfg.ProxyList)
+    if cfg.ProxyFile != "" {
+        fromFile, err := crawler.LoadProxyFile(cfg.ProxyFile)
+        if err != nil {
+            log.Fatalf("Failed to read PROXY_FILE: %v", err)
+        }
+        proxyURLs = append(proxyURLs, fromFile...)
+    }
+    rotation, err := crawler.ParseProxyRotation(cfg.ProxyRotation)
     if err != nil {
-        log.Fatalf("Traditional crawler failed: %v", err)
+        log.Fatalf("Invalid PROXY_ROTATION: %v", err)
     }
-    
-    duration := time.Since(start)
-    log.Printf("Traditional crawler completed in %v", duration)
-    log.Printf("Stats: %+v", stats)
+    pool, err := crawler.NewProxyPool(proxyURLs, rotation)
+    if err != nil {
+        log.Fatalf("Invalid proxy pool: %v", err)
+    }
+    log.Printf("Fetching through %d proxies, rotated %s", len(proxyURLs), rotation)
+    return pool
 }
 
-func runSmartCrawler(ctx context.Context, db *database.PostgresDB, startURL string, maxDepth, workers int) {
-    log.Printf("Starting smart crawler on %s with depth %d and %d workers", startURL, maxDepth, workers)
-    
-    smartCrawler := crawler.NewSmart(db, workers)
-    start := time.Now()
-    
-    stats, err := smartCrawler.Crawl(ctx, startURL, maxDepth)
-    if err != nil {
-        log.Fatalf("Smart crawler failed: %v", err)
+// siteFlags are the per-site request settings of the commands that crawl
+type siteFlags struct {
+    auditPath   *string
+    authPath    *string
+    headersPath *string
+}
+
+func addSiteFlags(fs *flag.FlagSet) *siteFlags {
+    return &siteFlags{
+        auditPath:   fs.String("audit", "", "Politeness audit log to append every request to, with the rate rule in force"),
+        authPath:    fs.String("auth", "", "JSON file of per-domain credentials: headers, bearer tokens, basic auth, or form logins"),
+        headersPath: fs.String("headers", "", "JSON file of per-domain request headers and User-Agents, sent in place of the crawler's own"),
+    }
+}
+
+// load reads the auth and header files and opens the audit log, each only
+// if given; the caller closes the audit log
+func (f *siteFlags) load() (*audit.Log, *crawler.Auth, *crawler.HeaderOverrides) {
+    var auditLog *audit.Log
+    var auth *crawler.Auth
+    var headers *crawler.HeaderOverrides
+    var err error
+    if *f.authPath != "" {
+        auth, err = crawler.LoadAuthFile(*f.authPath)
+        if err != nil {
+            log.Fatalf("Invalid -auth: %v", err)
+        }
+        log.Printf("Authenticating to %d sites", auth.Sites())
+    }
+    if *f.headersPath != "" {
+        headers, err = crawler.LoadHeadersFile(*f.headersPath)
+        if err != nil {
+            log.Fatalf("Invalid -headers: %v", err)
+        }
+        log.Printf("Overriding request headers for %d sites", headers.Sites())
+    }
+    if *f.auditPath != "" {
+        auditLog, err = audit.Open(*f.auditPath)
+        if err != nil {
+            log.Fatalf("Failed to open audit log: %v", err)
+        }
+    }
+    return auditLog, auth, headers
+}
+
+// logProxies reports what each proxy of the pool handled
+func logProxies(pool *crawler.ProxyPool) {
+    for _, proxy := range pool.Stats() {
+        log.Printf("Proxy %s: %d requests, %d failures, %d evictions, healthy: %v",
+            proxy.Proxy, proxy.Requests, proxy.Failures, proxy.Evictions, proxy.Healthy)
+    }
+}
+
+// logRepairs reports what the startup checks fixed
+func logRepairs(report *models.RepairReport) {
+    if report.SchemaUpgraded {
+        log.Printf("Database schema migrated from version %d to %d", report.PreviousSchemaVersion, report.SchemaVersion)
+    }
+    if len(report.InterruptedCrawls) > 0 {
+        log.Printf("Marked %d interrupted crawls as finished: %v", len(report.InterruptedCrawls), report.InterruptedCrawls)
+    }
+    if report.QueueRowsCompleted > 0 {
+        log.Printf("Completed %d queue entries for pages already saved", report.QueueRowsCompleted)
+    }
+    if report.QueueClaimsReleased > 0 {
+        log.Printf("Returned %d stale queue claims to pending", report.QueueClaimsReleased)
     }
-    
-    duration := time.Since(start)
-    log.Printf("Smart crawler completed in %v", duration)
-    log.Printf("Stats: %+v", stats)
 }
@@ -5,20 +5,178 @@ import (
     "time"
 )
 type Page struct {
-    ID             int64   `json:"id"`
-    URL            string  `json:"url"`
-    Title          string  `json:"title"`
-    Content        string  `json:"content"`
-    StatusCode     int     `json:"status_code"`
-    ContentType    string  `json:"content_type"`
-    Size           int64   `json:"size"`
-    LoadTime       int64   `json:"load_time"`
-    Depth          int     `json:"depth"`
-    ParentURL      string  `json:"parent_url"`
-    Hash           string  `json:"hash"`
-    Importance     float64 `json:"importance"`
-    ContentQuality float64 `json:"content_quality"`
-    LinkDensity    float64 `json:"link_density"`
+    ID             int64     `json:"id"`
+    CrawlID        int64     `json:"crawl_id,omitempty"`
+    CrawlUUID      string    `json:"crawl_uuid,omitempty"` // Set by the crawler; stored on the crawl, not the page
+    URL            string    `json:"url"`
+    Fingerprint    string    `json:"fingerprint,omitempty"` // Shared by the variants of the URL
+    Title          string    `json:"title"`
+    Content        string    `json:"content"`
+    StatusCode     int       `json:"status_code"`
+    ContentType    string    `json:"content_type"`
+    Size           int64     `json:"size"`
+    LoadTime       int64     `json:"load_time"`
+    Depth          int       `json:"depth"`
+    ParentURL      string    `json:"parent_url"`
+    CrawledAt      time.Time `json:"crawled_at"`
+    Hash           string    `json:"hash"`
+    Importance     float64   `json:"importance"`
+    ContentQuality float64   `json:"content_quality"`
+    LinkDensity    float64   `json:"link_density"`
+    // How closely the page matches the crawl's topic, 0 to 1; 0 without one
+    Relevance      float64   `json:"relevance,omitempty"`
+    ETag           string    `json:"etag,omitempty"`
+    LastModified   string    `json:"last_modified,omitempty"`
+
+    FinalURL      string        `json:"final_url,omitempty"`      // Where redirects led; empty if there were none
+    RedirectChain []RedirectHop `json:"redirect_chain,omitempty"` // Each redirect from URL to FinalURL, in order
+    Truncated     bool          `json:"truncated,omitempty"`      // Body cut off at the crawler's max response size
+
+    // Size is the decoded body; a compressed response also records how it
+    // was encoded and how many bytes came over the wire
+    Encoding       string `json:"encoding,omitempty"`
+    CompressedSize int64  `json:"compressed_size,omitempty"`
+    // The HTTP version the response came over, e.g. HTTP/2.0
+    Protocol string `json:"protocol,omitempty"`
+    // The headers of the final response, as received
+    Headers map[string][]string `json:"headers,omitempty"`
+    // The TLS connection the final response came over; nil over plain HTTP
+    TLS *TLSInfo `json:"tls,omitempty"`
+    // Where the fetch's time went; nil for pages not fetched over HTTP
+    Timing *RequestTiming `json:"timing,omitempty"`
+
+    // Embedded JSON-LD, microdata, OpenGraph, and Twitter card data, with
+    // the OpenGraph title, description, and image also kept on their own
+    StructuredData []StructuredItem `json:"structured_data,omitempty"`
+    // The URL the page names with <link rel="canonical">, which identifies
+    // it when several URLs serve it
+    CanonicalURL   string           `json:"canonical_url,omitempty"`
+    // One page of a paginated listing, whose content quality says little
+    // about the site
+    Listing        bool             `json:"listing,omitempty"`
+    OGTitle        string           `json:"og_title,omitempty"`
+    OGDescription  string           `json:"og_description,omitempty"`
+    OGImage        string           `json:"og_image,omitempty"`
+    // Records extracted by the crawl's extraction rules, saved to the
+    // extractions table
+    Extractions []Extraction `json:"extractions,omitempty"`
+    // The page's <img> elements when the crawl records images, saved to
+    // the images table
+    Images []Image `json:"images,omitempty"`
+    // How likely the page is spam, 0 to 1, and what said so, when the crawl
+    // filters spam. Spam pages are saved, but their links are not followed.
+    SpamScore   float64  `json:"spam_score,omitempty"`
+    SpamSignals []string `json:"spam_signals,omitempty"`
+    Spam        bool     `json:"spam,omitempty"`
+
+    // The start of the visible text, which near-duplicate lookups sample
+    // instead of Content when set
+    PlainText string `json:"-"`
+    // The raw response body, for event listeners; never stored
+    Body []byte `json:"-"`
+}
+
+// StructuredItem is one item of structured data embedded in a page: a
+// JSON-LD object, a microdata item, or the page's OpenGraph or Twitter card
+// tags
+type StructuredItem struct {
+    Format     string                 `json:"format"`         // json-ld, microdata, opengraph, or twitter
+    Type       string                 `json:"type,omitempty"` // e.g. "Product", or the og:type or twitter:card
+    Properties map[string]interface{} `json:"properties"`
+}
+
+// RedirectHop is one redirect a fetch followed: the URL that answered with
+// it and its status code
+type RedirectHop struct {
+    URL        string `json:"url"`
+    StatusCode int    `json:"status_code"`
+}
+
+// SimilarPage is a stored page found similar to some content, with the
+// share of trigrams they have in common (0-1)
+type SimilarPage struct {
+    ID         int64   `json:"id"`
+    URL        string  `json:"url"`
+    Title      string  `json:"title"`
+    Hash       string  `json:"hash"`
+    Similarity float64 `json:"similarity"`
+}
+
+// BodyStorage is the space page bodies take: their size and what storing
+// them compressed takes
+type BodyStorage struct {
+    Bodies     int   `json:"bodies"`
+    Size       int64 `json:"size"`
+    StoredSize int64 `json:"stored_size"`
+}
+
+// Extraction is the record an extraction rule took from a page: each of
+// its fields, with null for those that matched nothing
+type Extraction struct {
+    ID          int64                  `json:"id,omitempty"`
+    PageID      int64                  `json:"page_id,omitempty"`
+    CrawlID     int64                  `json:"crawl_id,omitempty"`
+    URL         string                 `json:"url,omitempty"`
+    Rule        string                 `json:"rule"`
+    Fields      map[string]interface{} `json:"fields"`
+    ExtractedAt time.Time              `json:"extracted_at,omitempty"`
+}
+
+// Image is an <img> element of a page, with the dimensions and size the
+// start of its file gives. Width and Height are 0, and Error says why, when
+// the file could not be read.
+type Image struct {
+    ID           int64     `json:"id,omitempty"`
+    PageID       int64     `json:"page_id,omitempty"`
+    CrawlID      int64     `json:"crawl_id,omitempty"`
+    PageURL      string    `json:"page_url,omitempty"`
+    Src          string    `json:"src"`
+    Srcset       string    `json:"srcset,omitempty"`
+    Alt          string    `json:"alt,omitempty"`
+    HTMLWidth    string    `json:"html_width,omitempty"`  // The element's width attribute
+    HTMLHeight   string    `json:"html_height,omitempty"` // The element's height attribute
+    Width        int       `json:"width,omitempty"`
+    Height       int       `json:"height,omitempty"`
+    Format       string    `json:"format,omitempty"` // e.g. "jpeg", "png", or "svg"
+    ContentType  string    `json:"content_type,omitempty"`
+    Size         int64     `json:"size,omitempty"`          // Bytes in the whole file; 0 if the server did not say
+    ThumbnailKey string    `json:"thumbnail_key,omitempty"` // Where its thumbnail is in the blob store
+    Error        string    `json:"error,omitempty"`
+    FoundAt      time.Time `json:"found_at,omitempty"`
+}
+
+type PageTag struct {
+    PageID    int64     `json:"page_id"`
+    Tag       string    `json:"tag"`
+    Source    string    `json:"source"`
+    CreatedAt time.Time `json:"created_at"`
+}
+
+// Subscription is a saved search run against every page a server crawl
+// saves. A page matches when its text has the keywords, any or all of them,
+// and, if Selector is set, an element matching it; with both, the keywords
+// are looked for in the selected elements' text.
+type Subscription struct {
+    ID         int64     `json:"id"`
+    Name       string    `json:"name"`
+    Keywords   []string  `json:"keywords,omitempty"`
+    MatchAll   bool      `json:"match_all,omitempty"`
+    Selector   string    `json:"selector,omitempty"`
+    WebhookURL string    `json:"webhook_url,omitempty"`
+    CreatedAt  time.Time `json:"created_at"`
+}
+
+// SubscriptionMatch is a page a subscription matched
+type SubscriptionMatch struct {
+    ID             int64     `json:"id"`
+    SubscriptionID int64     `json:"subscription_id"`
+    PageID         int64     `json:"page_id"`
+    CrawlID        int64     `json:"crawl_id"`
+    CrawlUUID      string    `json:"crawl_uuid,omitempty"`
+    URL            string    `json:"url"`
+    Title          string    `json:"title"`
+    Snippet        string    `json:"snippet"`
+    MatchedAt      time.Time `json:"matched_at"`
 }
 
 type Link struct {
@@ -28,15 +186,382 @@ type Link struct {
     URL      string `json:"url"`
     Anchor   string `json:"anchor"`
     Rel      string `json:"rel"`
+    Before   string `json:"before,omitempty"`  // Text just before the link
+    After    string `json:"after,omitempty"`   // Text just after it
+    Heading  string `json:"heading,omitempty"` // Heading of the section the link is in
+    Classes  string `json:"classes,omitempty"` // CSS classes of the link and its nearest ancestors
+}
+
+// PageWrite is a page to save with the links found on it. Nil Links leave
+// the links already recorded for the page as they are.
+type PageWrite struct {
+    Page  *Page
+    Links []Link
+}
+
+// LinkContext is the text a link appears in. An anchor like "read more"
+// says little about its target; the words around it and the heading of its
+// section say more. Classes are the CSS classes of the link and its
+// nearest ancestors.
+type LinkContext struct {
+    Anchor  string
+    Rel     string
+    Before  string
+    After   string
+    Heading string
+    Classes string
+}
+
+// Crawl is one crawl session; every page and queued URL belongs to one.
+// The UUID identifies it across databases and outputs, where ids of
+// different databases could collide.
+type Crawl struct {
+    ID         int64      `json:"id"`
+    UUID       string     `json:"uuid"`
+    Mode       string     `json:"mode"`
+    StartURL   string     `json:"start_url"`
+    MaxDepth   int        `json:"max_depth"`
+    StartedAt  time.Time  `json:"started_at"`
+    FinishedAt *time.Time `json:"finished_at,omitempty"`
+    Stats      CrawlStats `json:"stats"`
 }
 
 type CrawlStats struct {
-    PagesProcessed int           `json:"pages_processed"`
-    PagesSkipped   int           `json:"pages_skipped"`
-    Errors         int           `json:"errors"`
-    Duration       time.Duration `json:"duration"`
-    AvgLoadTime    time.Duration `json:"avg_load_time"`
-    TotalSize      int64         `json:"total_size"`
+    CrawlID        int64          `json:"crawl_id,omitempty"`
+    CrawlUUID      string         `json:"crawl_uuid,omitempty"`
+    PagesProcessed int            `json:"pages_processed"`
+    PagesSkipped   int            `json:"pages_skipped"`
+    Errors         int            `json:"errors"`
+    Duration       time.Duration  `json:"duration"`
+    AvgLoadTime    time.Duration  `json:"avg_load_time"` // Mean load time of the pages processed
+    TotalSize      int64          `json:"total_size"`
+    FilteredURLs   map[string]int `json:"filtered_urls,omitempty"`   // URLs rejected per include/exclude rule
+    StopReason     string         `json:"stop_reason,omitempty"`     // completed, cancelled, max_pages, max_bytes, max_duration, or interrupted
+    DeferredURLs   int            `json:"deferred_urls,omitempty"`   // Queued URLs kept for resume when a budget stopped the crawl
+    URLsReleased   int            `json:"urls_released,omitempty"`   // Claimed URLs returned to the queue unfetched when the crawl was stopped
+    PagesRefreshed int            `json:"pages_refreshed,omitempty"` // Revisits of known pages in continuous mode
+    PagesChanged   int            `json:"pages_changed,omitempty"`   // Revisits that found new content
+    URLsRetried    int            `json:"urls_retried,omitempty"`    // Failed fetches queued for another attempt
+    URLsFailed     int            `json:"urls_failed,omitempty"`     // URLs dead-lettered after their last attempt failed
+
+    PagesNotModified int                     `json:"pages_not_modified,omitempty"` // Revisits answered 304 Not Modified, without a body
+    Evaluation       map[string]*PolicyYield `json:"evaluation,omitempty"`         // Yield per frontier policy in a holdout evaluation
+    Stalls           int                     `json:"stalls,omitempty"`             // Times the crawl stalled with URLs left to fetch
+    PagesTruncated   int                     `json:"pages_truncated,omitempty"`    // Pages whose body was cut off at the max response size
+    PagesSpam        int                     `json:"pages_spam,omitempty"`         // Pages flagged as spam, whose links were not followed
+    Fetches          map[string]*FetchUsage  `json:"fetches,omitempty"`            // Requests and bytes per fetch strategy
+    Concurrency      []ConcurrencySample     `json:"concurrency,omitempty"`        // Worker pool sizes an autoscaled crawl chose, in order
+    Protocols        map[string]*ProtocolUsage `json:"protocols,omitempty"`        // Pages per negotiated HTTP version
+    Timing           *TimingPercentiles        `json:"timing,omitempty"`           // Percentiles of each fetch phase, from up to 10000 sampled pages
+    Resources        *ResourceUsage            `json:"resources,omitempty"`        // What the crawl cost the process, when benchmarked
+
+    StatusCodes    map[int]int        `json:"status_codes,omitempty"`     // Pages processed per HTTP status code
+    Latency        *Percentiles       `json:"latency,omitempty"`          // Percentiles of this run's page load times, from a histogram of all of them
+    PagesPerSecond float64            `json:"pages_per_second,omitempty"` // Over this run
+    BytesPerSecond float64            `json:"bytes_per_second,omitempty"`
+    Throughput     []ThroughputSample `json:"throughput,omitempty"` // This run's pages and bytes over time
+
+    Hosts map[string]*HostStats `json:"hosts,omitempty"` // By host and port; past 10000 hosts the rest under "(other)"
+
+    Harvest *HarvestStats `json:"harvest,omitempty"` // With a harvest threshold set
+
+    Mirror *MirrorStats `json:"mirror,omitempty"` // What a mirror crawl wrote to disk
+}
+
+// MirrorStats is the offline copy a mirror crawl wrote
+type MirrorStats struct {
+    Dir    string `json:"dir"`
+    Pages  int    `json:"pages"`
+    Assets int    `json:"assets"` // Stylesheets, scripts, and images the pages use
+    Bytes  int64  `json:"bytes"`
+    Errors int    `json:"errors"` // Assets that could not be fetched, and files that could not be written
+}
+
+// HarvestStats is a crawl's harvest rate: the fraction of the pages it
+// processed whose relevance reached Threshold
+type HarvestStats struct {
+    Threshold float64         `json:"threshold"`
+    Pages     int             `json:"pages"`
+    Relevant  int             `json:"relevant"`
+    Rate      float64         `json:"rate"`
+    Step      int             `json:"step"`              // Pages between samples
+    Samples   []HarvestSample `json:"samples,omitempty"` // The rate as the crawl went on, every Step pages
+}
+
+// HarvestSample is a crawl's harvest rate once it had processed Pages pages
+type HarvestSample struct {
+    Pages      int     `json:"pages"`
+    Relevant   int     `json:"relevant"`
+    Rate       float64 `json:"rate"`        // Over the crawl so far
+    WindowRate float64 `json:"window_rate"` // Over the pages since the previous sample
+}
+
+// HostStats is what a crawl fetched from one host
+type HostStats struct {
+    Pages       int            `json:"pages"`
+    Bytes       int64          `json:"bytes"`
+    Errors      int            `json:"errors"`            // Fetches that failed
+    Skipped     map[string]int `json:"skipped,omitempty"` // Pages skipped by reason, e.g. duplicate_content
+    AvgLoadTime time.Duration  `json:"avg_load_time"`     // Mean load time of Pages
+}
+
+// HostSummary is a host's stats with its name, for listing
+type HostSummary struct {
+    Host string `json:"host"`
+    HostStats
+}
+
+// ThroughputSample is what a crawl processed in one window of time, up to
+// Elapsed into its run
+type ThroughputSample struct {
+    Elapsed        time.Duration `json:"elapsed"`
+    Pages          int           `json:"pages"`
+    Bytes          int64         `json:"bytes"`
+    PagesPerSecond float64       `json:"pages_per_second"`
+    BytesPerSecond float64       `json:"bytes_per_second"`
+}
+
+// RequestTiming breaks a fetch down into phases, in milliseconds to the
+// microsecond. DNS,
+// Connect, and TLS are 0 when the request went over a connection kept
+// alive from an earlier one; over HTTP/3 the QUIC handshake, TLS included,
+// counts as Connect. Redirects followed add their phases up, but TTFB and
+// Download are those of the last response.
+type RequestTiming struct {
+    DNS      float64 `json:"dns"`
+    Connect  float64 `json:"connect"`
+    TLS      float64 `json:"tls"`
+    TTFB     float64 `json:"ttfb"`     // From the request being sent to the first byte of the response
+    Download float64 `json:"download"` // From the first byte to the end of the body
+    Reused   bool    `json:"reused,omitempty"`
+}
+
+// TimingPercentiles summarizes the phases of a crawl's fetches. DNS,
+// Connect, and TLS are taken over the fetches that went through them.
+type TimingPercentiles struct {
+    Fetches  int         `json:"fetches"`
+    DNS      Percentiles `json:"dns"`
+    Connect  Percentiles `json:"connect"`
+    TLS      Percentiles `json:"tls"`
+    TTFB     Percentiles `json:"ttfb"`
+    Download Percentiles `json:"download"`
+}
+
+// Percentiles of a duration, in milliseconds
+type Percentiles struct {
+    P50 float64 `json:"p50"`
+    P90 float64 `json:"p90"`
+    P99 float64 `json:"p99"`
+    Max float64 `json:"max"`
+}
+
+// ResourceUsage is the memory and garbage collection a benchmark run cost
+// the process, measured from its start to its end
+type ResourceUsage struct {
+    PeakRSS     int64         `json:"peak_rss"`    // Highest resident set size sampled during the run, in bytes
+    TotalAlloc  uint64        `json:"total_alloc"` // Heap bytes allocated, freed or not
+    Mallocs     uint64        `json:"mallocs"`     // Heap objects allocated
+    GCCycles    uint32        `json:"gc_cycles"`
+    GCPause     time.Duration `json:"gc_pause"`               // Stop-the-world pauses of those cycles, added up
+    CPUProfile  string        `json:"cpu_profile,omitempty"`  // pprof files written for the run, when profiling
+    HeapProfile string        `json:"heap_profile,omitempty"`
+}
+
+// TLSInfo is the TLS connection a response came over and the certificate
+// the server presented
+type TLSInfo struct {
+    Version     string    `json:"version"`      // e.g. TLS 1.3
+    CipherSuite string    `json:"cipher_suite"` // e.g. TLS_AES_128_GCM_SHA256
+    CertSubject string    `json:"cert_subject,omitempty"`
+    CertIssuer  string    `json:"cert_issuer,omitempty"`
+    CertExpiry  time.Time `json:"cert_expiry"`
+}
+
+// HostSecurity is the security posture a host's responses showed in a
+// crawl: which security headers its HTML pages were served with, and the
+// TLS its pages were fetched over
+type HostSecurity struct {
+    Host      string `json:"host"`
+    Pages     int    `json:"pages"`
+    Documents int    `json:"documents"` // HTML pages, whose headers are checked
+    HTTPS     int    `json:"https"`     // Pages fetched over TLS
+    // Documents served with each security header, by header name, and the
+    // value most of them had
+    Headers      map[string]SecurityHeader `json:"headers"`
+    TLSVersions  map[string]int            `json:"tls_versions,omitempty"`  // Pages by TLS version
+    CipherSuites map[string]int            `json:"cipher_suites,omitempty"` // Pages by cipher suite
+    CertIssuer   string                    `json:"cert_issuer,omitempty"`
+    CertExpiry   *time.Time                `json:"cert_expiry,omitempty"` // The soonest expiry presented
+    Findings     []string                  `json:"findings,omitempty"`    // What falls short, worst first
+}
+
+// SecurityHeader is how a host served one security header
+type SecurityHeader struct {
+    Documents int    `json:"documents"`
+    Value     string `json:"value,omitempty"`
+}
+
+// ProtocolUsage is what the pages fetched over one HTTP version took
+type ProtocolUsage struct {
+    Pages    int           `json:"pages"`
+    LoadTime time.Duration `json:"load_time"` // Summed over the pages
+}
+
+// FetchUsage is what fetching URLs with one strategy cost
+type FetchUsage struct {
+    URLs          int   `json:"urls"`
+    Requests      int   `json:"requests"` // HEAD and GET
+    HeadRequests  int   `json:"head_requests"`
+    NotModified   int   `json:"not_modified"`   // Conditional GETs answered 304
+    BodiesAvoided int   `json:"bodies_avoided"` // Not downloaded as HEAD showed no handler wants the type
+    Bytes         int64 `json:"bytes"`          // Bodies downloaded
+}
+
+// PolicyYield is what the URLs one frontier policy chose yielded during a
+// holdout evaluation
+type PolicyYield struct {
+    Pages         int     `json:"pages"`
+    Skipped       int     `json:"skipped"` // Duplicates and other skipped fetches
+    Errors        int     `json:"errors"`
+    AvgQuality    float64 `json:"avg_quality"`
+    AvgImportance float64 `json:"avg_importance"`
+}
+
+// ProxyStats is what one proxy of a pool has handled
+type ProxyStats struct {
+    Proxy     string `json:"proxy"` // Without credentials
+    Requests  int    `json:"requests"`
+    Failures  int    `json:"failures"`
+    Evictions int    `json:"evictions"`
+    Healthy   bool   `json:"healthy"`
+}
+
+// StallReport describes a crawl that has URLs left to fetch but has not
+// fetched a page successfully for a while
+type StallReport struct {
+    CrawlID   int64                     `json:"crawl_id"`
+    CrawlUUID string                    `json:"crawl_uuid,omitempty"`
+    Since     time.Time                 `json:"since"`     // Last successful fetch, or when the crawl started
+    Attempts  int                       `json:"attempts"`  // Fetches settled since then
+    InFlight  int                       `json:"in_flight"` // URLs dispatched but not yet settled
+    Outcomes  map[string]map[string]int `json:"outcomes"`  // Attempts per host and outcome, e.g. "HTTP 429" or "timeout"
+    Diagnosis string                    `json:"diagnosis"`
+}
+
+// ConcurrencySample records an autoscaled crawl resizing its worker pool
+type ConcurrencySample struct {
+    Elapsed time.Duration `json:"elapsed"` // Into the crawl, earlier runs of a resumed one included
+    Workers int           `json:"workers"`
+    Reason  string        `json:"reason"` // start, healthy, errors, latency, or starved
+}
+
+// CrawlProgress is a snapshot of a running crawl, for progress displays
+type CrawlProgress struct {
+    CrawlID      int64         `json:"crawl_id"`
+    Running      bool          `json:"running"`
+    Paused       bool          `json:"paused"`
+    Elapsed      time.Duration `json:"elapsed"`
+    PagesFetched int           `json:"pages_fetched"` // Fetched to be saved
+    PagesSkipped int           `json:"pages_skipped"`
+    Errors       int           `json:"errors"` // Failed fetches
+    Bytes        int64         `json:"bytes"`
+    InFlight     int           `json:"in_flight"`     // URLs being fetched
+    ActiveHosts  []string      `json:"active_hosts"`  // Hosts with a fetch in flight, sorted
+    Remaining    int           `json:"remaining"`     // URLs left to fetch, capped by the page budget; -1 when unknown
+    Deadline     time.Time     `json:"deadline"`      // When the duration budget ends the crawl; zero without one
+}
+
+// RepairReport is what the startup health check of a database found left
+// behind by crashed runs, and repaired
+type RepairReport struct {
+    SchemaVersion         int     `json:"schema_version"`
+    PreviousSchemaVersion int     `json:"previous_schema_version"` // 0 when unversioned or new
+    SchemaUpgraded        bool    `json:"schema_upgraded"`
+    InterruptedCrawls     []int64 `json:"interrupted_crawls,omitempty"`
+    QueueRowsCompleted    int     `json:"queue_rows_completed"`
+    QueueClaimsReleased   int     `json:"queue_claims_released"` // Claims of crashed runs returned to pending
+}
+
+// BenchmarkResult is what one benchmark measured, with the configuration it
+// ran under, kept so later benchmarks can be compared against it
+type BenchmarkResult struct {
+    ID       int64                        `json:"id"`
+    RanAt    time.Time                    `json:"ran_at"`
+    Label    string                       `json:"label,omitempty"` // Free text naming the build or setup, e.g. a commit
+    Config   BenchmarkConfig              `json:"config"`
+    Crawlers map[string]*BenchmarkCrawler `json:"crawlers"` // By crawler: traditional and smart
+}
+
+// BenchmarkConfig is the configuration a benchmark ran under
+type BenchmarkConfig struct {
+    StartURL   string `json:"start_url"`
+    MaxDepth   int    `json:"max_depth"`
+    Workers    int    `json:"workers"`
+    Iterations int    `json:"iterations"`
+    Warmup     int    `json:"warmup"`
+    // Anything else that shapes the results, such as the rate limit, HTTP
+    // version, or synthetic site
+    Settings map[string]string `json:"settings,omitempty"`
+}
+
+// BenchmarkCrawler is one crawler's measured runs in a benchmark
+type BenchmarkCrawler struct {
+    CrawlIDs []int64                  `json:"crawl_ids"`
+    Metrics  map[string]MetricSummary `json:"metrics"` // By metric, e.g. pages_per_second
+}
+
+// MetricSummary describes one metric over a crawler's measured runs
+type MetricSummary struct {
+    N      int     `json:"n"`
+    Mean   float64 `json:"mean"`
+    Median float64 `json:"median"`
+    StdDev float64 `json:"stddev"` // Sample standard deviation; 0 for a single run
+    // 95% confidence interval of the mean, by Student's t; the mean itself
+    // for a single run
+    CILow  float64 `json:"ci_low"`
+    CIHigh float64 `json:"ci_high"`
+}
+
+// FailedURL is a queued URL whose fetch failed as many times as a crawl
+// allowed, kept with its last error until it is requeued
+type FailedURL struct {
+    CrawlID     int64     `json:"crawl_id"`
+    URL         string    `json:"url"`
+    Attempts    int       `json:"attempts"`
+    LastError   string    `json:"last_error"`
+    LastAttempt time.Time `json:"last_attempt"`
+}
+
+// RevisitHistory is what a continuous crawl has observed of a page's changes
+type RevisitHistory struct {
+    Observed time.Duration // Since the page was first crawled
+    Revisits int
+    Changes  int
+    Changed  bool // The revisit just recorded found a new hash
+}
+
+// PageChange is what a revisit found changed in a page: a unified diff of
+// the lines of its text against the version saved before
+type PageChange struct {
+    ID           int64     `json:"id,omitempty"`
+    PageID       int64     `json:"page_id"`
+    CrawlID      int64     `json:"crawl_id"`
+    CrawlUUID    string    `json:"crawl_uuid,omitempty"`
+    URL          string    `json:"url"`
+    Title        string    `json:"title,omitempty"`
+    PreviousHash string    `json:"previous_hash"`
+    Hash         string    `json:"hash"`
+    Added        int       `json:"added"`   // Lines added
+    Removed      int       `json:"removed"` // Lines removed
+    Diff         string    `json:"diff"`
+    DetectedAt   time.Time `json:"detected_at"`
+}
+
+// Validators are the cache validators a server sent with a page, which make
+// a revisit conditional
+type Validators struct {
+    ETag         string
+    LastModified string
 }
 
 type URLPriority struct {
@@ -45,6 +570,12 @@ type URLPriority struct {
     Depth    int
     Parent   string
     Context  URLContext
+    Refresh  bool   // Revisit of a page already saved in this crawl
+    Policy   string // Frontier policy that chose the URL in a holdout evaluation
+
+    Fingerprint string      // What frontiers deduplicate the URL by; "" for the URL itself
+    Validators  Validators  // Of the saved page, for a revisit
+    LinkContext LinkContext // Of the link the URL was found through
 }
 
 type URLContext struct {
@@ -54,4 +585,5 @@ type URLContext struct {
     LinkDensity     float64
     ContentQuality  float64
     SimilarityScore float64
+    Relevance       float64 // To the crawl's topic; 0 without one
 }
@@ -0,0 +1,61 @@
+package output
+
+import (
+    "context"
+    "encoding/json"
+    "log"
+    "net/url"
+    "time"
+
+    "github.com/segmentio/kafka-go"
+
+    "smart-crawler/models"
+)
+
+// KafkaSink publishes saved pages as JSON to a Kafka topic, keyed by host so
+// all pages of a site land on the same partition in crawl order.
+type KafkaSink struct {
+    writer *kafka.Writer
+}
+
+// NewKafkaSink creates a sink writing to topic on brokers. Failed deliveries
+// are retried with backoff up to maxAttempts before being logged as lost.
+func NewKafkaSink(brokers []string, topic string, maxAttempts int) *KafkaSink {
+    writer := &kafka.Writer{
+        Addr:            kafka.TCP(brokers...),
+        Topic:           topic,
+        Balancer:        &kafka.Hash{},
+        MaxAttempts:     maxAttempts,
+        WriteBackoffMin: 100 * time.Millisecond,
+        WriteBackoffMax: 5 * time.Second,
+        RequiredAcks:    kafka.RequireAll,
+        Async:           true,
+        Completion: func(messages []kafka.Message, err error) {
+            if err != nil {
+                log.Printf("Kafka delivery of %d pages to %s failed after %d attempts: %v", len(messages), topic, maxAttempts, err)
+            }
+        },
+    }
+
+    return &KafkaSink{writer: writer}
+}
+
+func (k *KafkaSink) Publish(ctx context.Context, page *models.Page) error {
+    value, err := json.Marshal(page)
+    if err != nil {
+        return err
+    }
+
+    var key []byte
+    if u, err := url.Parse(page.URL); err == nil {
+        key = []byte(u.Hostname())
+    }
+
+    // Async writer: this only enqueues, delivery errors surface in Completion
+    return k.writer.WriteMessages(ctx, kafka.Message{Key: key, Value: value})
+}
+
+// Close flushes pending messages
+func (k *KafkaSink) Close() error {
+    return k.writer.Close()
+}
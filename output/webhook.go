@@ -0,0 +1,55 @@
+package output
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "time"
+
+    "smart-crawler/models"
+)
+
+// StallWebhook posts stall reports as JSON to a URL, e.g. a chat or paging
+// integration, so a stalled overnight crawl wakes someone up.
+type StallWebhook struct {
+    url    string
+    client *http.Client
+}
+
+func NewStallWebhook(url string) *StallWebhook {
+    return &StallWebhook{
+        url:    url,
+        client: &http.Client{Timeout: 10 * time.Second},
+    }
+}
+
+func (w *StallWebhook) Alert(ctx context.Context, report *models.StallReport) error {
+    return PostJSON(ctx, w.client, w.url, report)
+}
+
+// PostJSON posts v as JSON to url and fails unless it is accepted with a
+// 2xx status
+func PostJSON(ctx context.Context, client *http.Client, url string, v interface{}) error {
+    body, err := json.Marshal(v)
+    if err != nil {
+        return err
+    }
+
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+    if err != nil {
+        return err
+    }
+    req.Header.Set("Content-Type", "application/json")
+
+    resp, err := client.Do(req)
+    if err != nil {
+        return err
+    }
+    resp.Body.Close()
+    if resp.StatusCode >= 300 {
+        return fmt.Errorf("webhook %s answered %s", url, resp.Status)
+    }
+    return nil
+}
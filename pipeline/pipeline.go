@@ -0,0 +1,260 @@
+package pipeline
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "os"
+    "sync"
+    "time"
+
+    "smart-crawler/models"
+)
+
+// ErrDrop is returned by a processor to end the pipeline for a document
+// without an error, e.g. when a classifier finds it irrelevant
+var ErrDrop = errors.New("document dropped")
+
+// ErrorAction is what a stage's failure does to the rest of the pipeline
+type ErrorAction string
+
+const (
+    // OnErrorFail ends the pipeline and reports the error to the crawler
+    OnErrorFail ErrorAction = "fail"
+    // OnErrorContinue counts the error and runs the next stage
+    OnErrorContinue ErrorAction = "continue"
+    // OnErrorStop counts the error and quietly ends the pipeline
+    OnErrorStop ErrorAction = "stop"
+)
+
+// Document is a saved page as it passes through a pipeline. Page is a copy,
+// so a stage redacting it does not change what other sinks see.
+type Document struct {
+    Page   *models.Page
+    Fields map[string]string // Set by extract stages
+    Labels []string          // Set by classify stages
+}
+
+func (d *Document) hasLabel(labels []string) bool {
+    for _, want := range labels {
+        for _, label := range d.Labels {
+            if label == want {
+                return true
+            }
+        }
+    }
+    return false
+}
+
+// Record is how a document is written out by index and notify stages
+type Record struct {
+    URL       string            `json:"url"`
+    CrawlID   int64             `json:"crawl_id,omitempty"`
+    CrawlUUID string            `json:"crawl_uuid,omitempty"`
+    PageID    int64             `json:"page_id"`
+    Title     string            `json:"title"`
+    Content   string            `json:"content,omitempty"`
+    Fields    map[string]string `json:"fields,omitempty"`
+    Labels    []string          `json:"labels,omitempty"`
+    CrawledAt time.Time         `json:"crawled_at"`
+}
+
+func (d *Document) record(withContent bool) Record {
+    record := Record{
+        URL:       d.Page.URL,
+        CrawlID:   d.Page.CrawlID,
+        CrawlUUID: d.Page.CrawlUUID,
+        PageID:    d.Page.ID,
+        Title:     d.Page.Title,
+        Fields:    d.Fields,
+        Labels:    d.Labels,
+        CrawledAt: time.Now(),
+    }
+    if withContent {
+        record.Content = d.Page.Content
+    }
+    return record
+}
+
+// Processor is one step of a pipeline
+type Processor interface {
+    Process(ctx context.Context, doc *Document) error
+}
+
+// StageConfig names a registered processor and its parameters
+type StageConfig struct {
+    Processor string          `json:"processor"`
+    Params    json.RawMessage `json:"params"`
+    OnError   ErrorAction     `json:"on_error"` // Default "fail"
+}
+
+// Config is one pipeline: stages run in order on every saved page
+type Config struct {
+    Name   string        `json:"name"`
+    Stages []StageConfig `json:"stages"`
+}
+
+// File is the pipelines file, e.g.
+//
+//  {"pipelines": [{"name": "news", "stages": [
+//      {"processor": "extract", "params": {"fields": {"author": "meta[name=author]@content"}}},
+//      {"processor": "classify", "params": {"classes": {"outage": "(?i)outage|degraded"}}},
+//      {"processor": "redact", "params": {"patterns": ["email", "phone"]}, "on_error": "stop"},
+//      {"processor": "index", "params": {"path": "news.jsonl"}},
+//      {"processor": "notify", "params": {"url": "https://hooks.example.com/x", "labels": ["outage"]}, "on_error": "continue"}
+//  ]}]}
+type File struct {
+    Pipelines []Config `json:"pipelines"`
+}
+
+// StageStats is what one stage has done
+type StageStats struct {
+    Processor string        `json:"processor"`
+    Processed int64         `json:"processed"`
+    Dropped   int64         `json:"dropped"`
+    Errors    int64         `json:"errors"`
+    Duration  time.Duration `json:"duration"`
+}
+
+type stage struct {
+    processor Processor
+    onError   ErrorAction
+    stats     StageStats
+}
+
+// Pipeline runs saved pages through its stages. It is a crawler PageSink.
+type Pipeline struct {
+    name   string
+    stages []*stage
+    mutex  sync.Mutex
+}
+
+// New builds a pipeline from its config, with processors from the registry
+func New(config Config) (*Pipeline, error) {
+    if config.Name == "" {
+        return nil, errors.New("pipeline has no name")
+    }
+    if len(config.Stages) == 0 {
+        return nil, fmt.Errorf("pipeline %s has no stages", config.Name)
+    }
+
+    p := &Pipeline{name: config.Name}
+    for i, stageConfig := range config.Stages {
+        onError := stageConfig.OnError
+        switch onError {
+        case "":
+            onError = OnErrorFail
+        case OnErrorFail, OnErrorContinue, OnErrorStop:
+        default:
+            return nil, fmt.Errorf("pipeline %s stage %d: invalid on_error %q, use 'fail', 'continue', or 'stop'", config.Name, i+1, onError)
+        }
+
+        processor, err := newProcessor(stageConfig.Processor, stageConfig.Params)
+        if err != nil {
+            p.Close()
+            return nil, fmt.Errorf("pipeline %s stage %d: %w", config.Name, i+1, err)
+        }
+        p.stages = append(p.stages, &stage{
+            processor: processor,
+            onError:   onError,
+            stats:     StageStats{Processor: stageConfig.Processor},
+        })
+    }
+    return p, nil
+}
+
+// Load reads a pipelines file and builds every pipeline in it
+func Load(path string) ([]*Pipeline, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+    var file File
+    if err := json.Unmarshal(data, &file); err != nil {
+        return nil, fmt.Errorf("invalid pipelines file %s: %w", path, err)
+    }
+
+    var pipelines []*Pipeline
+    for _, config := range file.Pipelines {
+        p, err := New(config)
+        if err != nil {
+            for _, built := range pipelines {
+                built.Close()
+            }
+            return nil, err
+        }
+        pipelines = append(pipelines, p)
+    }
+    return pipelines, nil
+}
+
+func (p *Pipeline) Name() string {
+    return p.name
+}
+
+// Publish runs page through the stages. Only a failing stage set to "fail"
+// returns an error.
+func (p *Pipeline) Publish(ctx context.Context, page *models.Page) error {
+    copied := *page
+    doc := &Document{Page: &copied, Fields: make(map[string]string)}
+
+    for _, stage := range p.stages {
+        start := time.Now()
+        err := stage.processor.Process(ctx, doc)
+        p.record(stage, time.Since(start), err)
+
+        switch {
+        case err == nil:
+            continue
+        case errors.Is(err, ErrDrop):
+            return nil
+        case stage.onError == OnErrorContinue:
+            continue
+        case stage.onError == OnErrorStop:
+            return nil
+        }
+        return fmt.Errorf("pipeline %s stage %s: %w", p.name, stage.stats.Processor, err)
+    }
+    return nil
+}
+
+func (p *Pipeline) record(stage *stage, took time.Duration, err error) {
+    p.mutex.Lock()
+    defer p.mutex.Unlock()
+
+    stage.stats.Processed++
+    stage.stats.Duration += took
+    switch {
+    case errors.Is(err, ErrDrop):
+        stage.stats.Dropped++
+    case err != nil:
+        stage.stats.Errors++
+    }
+}
+
+// Stats returns each stage's counters, in stage order
+func (p *Pipeline) Stats() []StageStats {
+    p.mutex.Lock()
+    defer p.mutex.Unlock()
+
+    stats := make([]StageStats, len(p.stages))
+    for i, stage := range p.stages {
+        stats[i] = stage.stats
+    }
+    return stats
+}
+
+// Close releases what the stages hold open, like index files
+func (p *Pipeline) Close() error {
+    var firstErr error
+    for _, stage := range p.stages {
+        if closer, ok := stage.processor.(io.Closer); ok {
+            if err := closer.Close(); err != nil && firstErr == nil {
+                firstErr = err
+            }
+        }
+    }
+    return firstErr
+}
@@ -0,0 +1,360 @@
+package pipeline
+
+import (
+    "bufio"
+    "bytes"
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "os"
+    "regexp"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/PuerkitoBio/goquery"
+
+    "smart-crawler/output"
+)
+
+// Factory builds a processor from its stage's JSON params
+type Factory func(params json.RawMessage) (Processor, error)
+
+var (
+    registry      = make(map[string]Factory)
+    registryMutex sync.RWMutex
+)
+
+// Register makes a processor available to pipeline configs under name.
+// The built-in processors are extract, classify, redact, index, and notify.
+func Register(name string, factory Factory) {
+    registryMutex.Lock()
+    defer registryMutex.Unlock()
+
+    registry[strings.ToLower(name)] = factory
+}
+
+// Processors lists the registered processor names
+func Processors() []string {
+    registryMutex.RLock()
+    defer registryMutex.RUnlock()
+
+    names := make([]string, 0, len(registry))
+    for name := range registry {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    return names
+}
+
+func newProcessor(name string, params json.RawMessage) (Processor, error) {
+    registryMutex.RLock()
+    factory, exists := registry[strings.ToLower(name)]
+    registryMutex.RUnlock()
+    if !exists {
+        return nil, fmt.Errorf("unknown processor %q, use one of %s", name, strings.Join(Processors(), ", "))
+    }
+
+    processor, err := factory(params)
+    if err != nil {
+        return nil, fmt.Errorf("processor %s: %w", name, err)
+    }
+    return processor, nil
+}
+
+func init() {
+    Register("extract", newExtract)
+    Register("classify", newClassify)
+    Register("redact", newRedact)
+    Register("index", newIndex)
+    Register("notify", newNotify)
+}
+
+// decodeParams decodes a stage's params strictly, so a misspelled key fails
+// at startup instead of being ignored
+func decodeParams(params json.RawMessage, v interface{}) error {
+    if len(params) == 0 {
+        return nil
+    }
+    decoder := json.NewDecoder(bytes.NewReader(params))
+    decoder.DisallowUnknownFields()
+    return decoder.Decode(v)
+}
+
+// extract sets document fields from CSS selectors over the page's HTML. A
+// selector ending in "@attr" takes that attribute of the first match, e.g.
+// "meta[name=author]@content"; otherwise the matches' text is taken.
+type extract struct {
+    fields map[string]extractField
+}
+
+type extractField struct {
+    selector string
+    attr     string
+}
+
+func newExtract(params json.RawMessage) (Processor, error) {
+    var config struct {
+        Fields map[string]string `json:"fields"`
+    }
+    if err := decodeParams(params, &config); err != nil {
+        return nil, err
+    }
+    if len(config.Fields) == 0 {
+        return nil, fmt.Errorf("no fields to extract")
+    }
+
+    e := &extract{fields: make(map[string]extractField)}
+    for name, selector := range config.Fields {
+        field := extractField{selector: selector}
+        if i := strings.LastIndex(selector, "@"); i > 0 {
+            field.selector, field.attr = selector[:i], selector[i+1:]
+        }
+        e.fields[name] = field
+    }
+    return e, nil
+}
+
+func (e *extract) Process(ctx context.Context, doc *Document) error {
+    body := doc.Page.Body
+    if len(body) == 0 {
+        return nil
+    }
+    if !strings.Contains(strings.ToLower(doc.Page.ContentType), "html") {
+        return nil
+    }
+
+    html, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+    if err != nil {
+        return err
+    }
+    for name, field := range e.fields {
+        selection := html.Find(field.selector)
+        if selection.Length() == 0 {
+            continue
+        }
+        value := strings.Join(strings.Fields(selection.Text()), " ")
+        if field.attr != "" {
+            value, _ = selection.First().Attr(field.attr)
+        }
+        doc.Fields[name] = value
+    }
+    return nil
+}
+
+// classify labels a document with every class whose pattern matches its
+// title and content, or an extracted field. With drop_unmatched, documents
+// no class matches go no further.
+type classify struct {
+    classes       []labelPattern
+    field         string
+    dropUnmatched bool
+}
+
+type labelPattern struct {
+    label   string
+    pattern *regexp.Regexp
+}
+
+func newClassify(params json.RawMessage) (Processor, error) {
+    var config struct {
+        Classes       map[string]string `json:"classes"`
+        Field         string            `json:"field"`
+        DropUnmatched bool              `json:"drop_unmatched"`
+    }
+    if err := decodeParams(params, &config); err != nil {
+        return nil, err
+    }
+    if len(config.Classes) == 0 {
+        return nil, fmt.Errorf("no classes")
+    }
+
+    c := &classify{field: config.Field, dropUnmatched: config.DropUnmatched}
+    for label, expr := range config.Classes {
+        pattern, err := regexp.Compile(expr)
+        if err != nil {
+            return nil, fmt.Errorf("class %s: %w", label, err)
+        }
+        c.classes = append(c.classes, labelPattern{label, pattern})
+    }
+    // Labels come out in a stable order
+    sort.Slice(c.classes, func(i, j int) bool { return c.classes[i].label < c.classes[j].label })
+    return c, nil
+}
+
+func (c *classify) Process(ctx context.Context, doc *Document) error {
+    text := doc.Page.Title + "\n" + doc.Page.Content
+    if c.field != "" {
+        text = doc.Fields[c.field]
+    }
+
+    matched := false
+    for _, class := range c.classes {
+        if class.pattern.MatchString(text) {
+            matched = true
+            if !doc.hasLabel([]string{class.label}) {
+                doc.Labels = append(doc.Labels, class.label)
+            }
+        }
+    }
+    if !matched && c.dropUnmatched {
+        return ErrDrop
+    }
+    return nil
+}
+
+// Patterns the redact processor knows by name
+var redactPatterns = map[string]*regexp.Regexp{
+    "email": regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+    "phone": regexp.MustCompile(`\+?\d[\d\s().-]{7,}\d`),
+    "ipv4":  regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`),
+}
+
+// redact replaces matches of named or custom patterns in the title,
+// content, and extracted fields
+type redact struct {
+    patterns    []*regexp.Regexp
+    replacement string
+}
+
+func newRedact(params json.RawMessage) (Processor, error) {
+    config := struct {
+        Patterns    []string `json:"patterns"`
+        Replacement string   `json:"replacement"`
+    }{Replacement: "[REDACTED]"}
+    if err := decodeParams(params, &config); err != nil {
+        return nil, err
+    }
+    if len(config.Patterns) == 0 {
+        return nil, fmt.Errorf("no patterns")
+    }
+
+    r := &redact{replacement: config.Replacement}
+    for _, expr := range config.Patterns {
+        pattern, named := redactPatterns[expr]
+        if !named {
+            var err error
+            if pattern, err = regexp.Compile(expr); err != nil {
+                return nil, err
+            }
+        }
+        r.patterns = append(r.patterns, pattern)
+    }
+    return r, nil
+}
+
+func (r *redact) Process(ctx context.Context, doc *Document) error {
+    for _, pattern := range r.patterns {
+        doc.Page.Title = pattern.ReplaceAllLiteralString(doc.Page.Title, r.replacement)
+        doc.Page.Content = pattern.ReplaceAllLiteralString(doc.Page.Content, r.replacement)
+        for name, value := range doc.Fields {
+            doc.Fields[name] = pattern.ReplaceAllLiteralString(value, r.replacement)
+        }
+    }
+    // The raw body would leak what was redacted to later stages
+    doc.Page.Body = nil
+    return nil
+}
+
+// index writes each document as a JSON line to a file, or posts it to a
+// URL such as a search engine's ingest endpoint
+type index struct {
+    url     string
+    client  *http.Client
+    content bool
+
+    file   *os.File
+    writer *bufio.Writer
+    mutex  sync.Mutex
+}
+
+func newIndex(params json.RawMessage) (Processor, error) {
+    var config struct {
+        Path    string `json:"path"`
+        URL     string `json:"url"`
+        Content *bool  `json:"content"` // Include page content (default true)
+    }
+    if err := decodeParams(params, &config); err != nil {
+        return nil, err
+    }
+    if (config.Path == "") == (config.URL == "") {
+        return nil, fmt.Errorf("set one of path or url")
+    }
+
+    i := &index{url: config.URL, content: config.Content == nil || *config.Content}
+    if config.URL != "" {
+        i.client = &http.Client{Timeout: 10 * time.Second}
+        return i, nil
+    }
+    file, err := os.OpenFile(config.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+    if err != nil {
+        return nil, err
+    }
+    i.file, i.writer = file, bufio.NewWriter(file)
+    return i, nil
+}
+
+func (i *index) Process(ctx context.Context, doc *Document) error {
+    record := doc.record(i.content)
+    if i.url != "" {
+        return output.PostJSON(ctx, i.client, i.url, record)
+    }
+
+    line, err := json.Marshal(record)
+    if err != nil {
+        return err
+    }
+    i.mutex.Lock()
+    defer i.mutex.Unlock()
+    _, err = i.writer.Write(append(line, '\n'))
+    return err
+}
+
+func (i *index) Close() error {
+    if i.file == nil {
+        return nil
+    }
+    i.mutex.Lock()
+    defer i.mutex.Unlock()
+
+    if err := i.writer.Flush(); err != nil {
+        i.file.Close()
+        return err
+    }
+    return i.file.Close()
+}
+
+// notify posts a document, without its content, to a webhook; with labels
+// set, only documents carrying one of them
+type notify struct {
+    url    string
+    labels []string
+    client *http.Client
+}
+
+func newNotify(params json.RawMessage) (Processor, error) {
+    var config struct {
+        URL    string   `json:"url"`
+        Labels []string `json:"labels"`
+    }
+    if err := decodeParams(params, &config); err != nil {
+        return nil, err
+    }
+    if config.URL == "" {
+        return nil, fmt.Errorf("no url")
+    }
+    return &notify{
+        url:    config.URL,
+        labels: config.Labels,
+        client: &http.Client{Timeout: 10 * time.Second},
+    }, nil
+}
+
+func (n *notify) Process(ctx context.Context, doc *Document) error {
+    if len(n.labels) > 0 && !doc.hasLabel(n.labels) {
+        return nil
+    }
+    return output.PostJSON(ctx, n.client, n.url, doc.record(false))
+}
@@ -0,0 +1,49 @@
+package progress
+
+import (
+    "time"
+
+    "smart-crawler/models"
+)
+
+// How far back rates are measured, so they follow the crawl's current pace
+// rather than its average
+const rateWindow = 10 * time.Second
+
+type sample struct {
+    at      time.Time
+    fetched int // Pages fetched
+    settled int // URLs taken off the queue, fetched or not
+}
+
+// meter turns successive snapshots into rates
+type meter struct {
+    samples []sample
+}
+
+// add records a snapshot and returns the pages fetched and URLs settled per
+// second since the oldest sample in the window. The window always keeps one
+// earlier sample, so rates are measured even when snapshots are further
+// apart than it.
+func (m *meter) add(progress models.CrawlProgress) (pageRate, urlRate float64) {
+    now := sample{
+        at:      time.Now(),
+        fetched: progress.PagesFetched,
+        settled: progress.PagesFetched + progress.PagesSkipped + progress.Errors,
+    }
+    m.samples = append(m.samples, now)
+    for len(m.samples) > 2 && now.at.Sub(m.samples[1].at) >= rateWindow {
+        m.samples = m.samples[1:]
+    }
+
+    // The first snapshot is measured from the start of the crawl
+    oldest := sample{at: now.at.Add(-progress.Elapsed)}
+    if len(m.samples) > 1 {
+        oldest = m.samples[0]
+    }
+    seconds := now.at.Sub(oldest.at).Seconds()
+    if seconds <= 0 {
+        return 0, 0
+    }
+    return float64(now.fetched-oldest.fetched) / seconds, float64(now.settled-oldest.settled) / seconds
+}
@@ -0,0 +1,273 @@
+package progress
+
+import (
+    "fmt"
+    "log"
+    "os"
+    "strings"
+    "sync"
+    "time"
+
+    "smart-crawler/models"
+)
+
+// Mode selects how a crawl's progress is shown
+type Mode string
+
+const (
+    Auto Mode = "auto" // Live on a terminal, log lines otherwise
+    Live Mode = "live" // Redrawn in place at the bottom of the terminal
+    Log  Mode = "log"  // A log line every LogInterval
+    Off  Mode = "off"
+)
+
+func ParseMode(s string) (Mode, error) {
+    switch mode := Mode(strings.ToLower(s)); mode {
+    case Auto, Live, Log, Off:
+        return mode, nil
+    }
+    return "", fmt.Errorf("invalid progress mode %q, use 'auto', 'live', 'log', or 'off'", s)
+}
+
+// Source is a crawler whose progress can be shown
+type Source interface {
+    Progress() models.CrawlProgress
+}
+
+// LogInterval is how often progress is logged when it is not shown live
+const LogInterval = 30 * time.Second
+
+// How often the live view is redrawn
+const redrawInterval = 500 * time.Millisecond
+
+// Show displays the progress of source, named by label, until the returned
+// function is called, which shows it a last time. Call it once the crawl
+// has returned. While the live view is up, the standard logger writes
+// above it instead of through it.
+func Show(mode Mode, label string, source Source) func() {
+    if mode == Auto {
+        mode = Log
+        if isTerminal(os.Stderr) {
+            mode = Live
+        }
+    }
+    switch mode {
+    case Off:
+        return func() {}
+    case Live:
+        return showLive(label, source)
+    default:
+        return showLog(label, source)
+    }
+}
+
+// isTerminal reports whether f is an interactive terminal that understands
+// cursor movement
+func isTerminal(f *os.File) bool {
+    info, err := f.Stat()
+    if err != nil {
+        return false
+    }
+    return info.Mode()&os.ModeCharDevice != 0 && os.Getenv("TERM") != "dumb"
+}
+
+// every calls update each interval until the returned function is called,
+// then once more
+func every(interval time.Duration, update func()) func() {
+    done := make(chan struct{})
+    stopped := make(chan struct{})
+    go func() {
+        defer close(stopped)
+        ticker := time.NewTicker(interval)
+        defer ticker.Stop()
+        for {
+            select {
+            case <-ticker.C:
+                update()
+            case <-done:
+                return
+            }
+        }
+    }()
+
+    var once sync.Once
+    return func() {
+        once.Do(func() {
+            close(done)
+            <-stopped
+            update()
+        })
+    }
+}
+
+func showLog(label string, source Source) func() {
+    var rates meter
+    return every(LogInterval, func() {
+        progress := source.Progress()
+        pageRate, urlRate := rates.add(progress)
+        log.Printf("%s: %s, %s, %s elapsed%s", crawlName(label, progress),
+            pageSummary(progress, pageRate), queueSummary(progress, -1), formatDuration(progress.Elapsed), etaSummary(progress, urlRate))
+    })
+}
+
+// liveView redraws a block of lines at the bottom of the terminal. Log
+// output written through it is printed above the block.
+type liveView struct {
+    out   *os.File
+    lines []string // The block as last drawn
+    drawn int      // Lines of the block on screen
+    mutex sync.Mutex
+}
+
+func showLive(label string, source Source) func() {
+    view := &liveView{out: os.Stderr}
+    previous := log.Writer()
+    log.SetOutput(view)
+
+    var rates meter
+    stop := every(redrawInterval, func() {
+        progress := source.Progress()
+        pageRate, urlRate := rates.add(progress)
+        view.update([]string{
+            fmt.Sprintf("%s | %s elapsed%s", crawlName(label, progress), formatDuration(progress.Elapsed), etaSummary(progress, urlRate)),
+            "  " + pageSummary(progress, pageRate),
+            "  " + queueSummary(progress, 3),
+        })
+    })
+    return func() {
+        stop()
+        log.SetOutput(previous)
+    }
+}
+
+func (v *liveView) update(lines []string) {
+    v.mutex.Lock()
+    defer v.mutex.Unlock()
+
+    v.lines = lines
+    v.clear()
+    v.draw()
+}
+
+// Write prints log output above the block
+func (v *liveView) Write(p []byte) (int, error) {
+    v.mutex.Lock()
+    defer v.mutex.Unlock()
+
+    v.clear()
+    n, err := v.out.Write(p)
+    v.draw()
+    return n, err
+}
+
+func (v *liveView) clear() {
+    if v.drawn > 0 {
+        fmt.Fprintf(v.out, "\033[%dA\r\033[J", v.drawn)
+        v.drawn = 0
+    }
+}
+
+// draw prints the block, cut to the terminal's width so no line wraps and
+// throws off the next clear
+func (v *liveView) draw() {
+    width := terminalWidth()
+    var b strings.Builder
+    for _, line := range v.lines {
+        if len(line) >= width {
+            line = line[:width-1]
+        }
+        b.WriteString(line)
+        b.WriteString("\n")
+    }
+    v.out.WriteString(b.String())
+    v.drawn = len(v.lines)
+}
+
+// terminalWidth is the width the shell exports in COLUMNS, or 80
+func terminalWidth() int {
+    var width int
+    if _, err := fmt.Sscan(os.Getenv("COLUMNS"), &width); err != nil || width < 20 {
+        return 80
+    }
+    return width
+}
+
+// crawlName is label, with the crawl session once it has been created
+func crawlName(label string, progress models.CrawlProgress) string {
+    if progress.CrawlID == 0 {
+        return label
+    }
+    return fmt.Sprintf("%s crawl %d", label, progress.CrawlID)
+}
+
+func pageSummary(progress models.CrawlProgress, pageRate float64) string {
+    return fmt.Sprintf("%d pages (%.1f/s), %d skipped, %d errors, %s",
+        progress.PagesFetched, pageRate, progress.PagesSkipped, progress.Errors, formatBytes(progress.Bytes))
+}
+
+// queueSummary reports the queue and the hosts being fetched from, naming
+// up to maxHosts of them (none when negative)
+func queueSummary(progress models.CrawlProgress, maxHosts int) string {
+    queued := "queue unknown"
+    if progress.Remaining >= 0 {
+        queued = fmt.Sprintf("%d queued", progress.Remaining)
+    }
+    summary := fmt.Sprintf("%s, %d in flight on %d hosts", queued, progress.InFlight, len(progress.ActiveHosts))
+    if maxHosts > 0 && len(progress.ActiveHosts) > 0 {
+        hosts := progress.ActiveHosts
+        if len(hosts) > maxHosts {
+            hosts = hosts[:maxHosts]
+        }
+        summary += ": " + strings.Join(hosts, ", ")
+        if more := len(progress.ActiveHosts) - len(hosts); more > 0 {
+            summary += fmt.Sprintf(" +%d", more)
+        }
+    }
+    return summary
+}
+
+// etaSummary estimates when the crawl ends: when the queue drains at the
+// current rate, or the duration budget runs out, whichever is sooner
+func etaSummary(progress models.CrawlProgress, urlRate float64) string {
+    if !progress.Running {
+        if progress.CrawlID == 0 {
+            return ", starting"
+        }
+        return ", finished"
+    }
+    if progress.Paused {
+        return ", paused"
+    }
+    var eta time.Duration
+    known := false
+    if progress.Remaining >= 0 && urlRate > 0 {
+        eta = time.Duration(float64(progress.Remaining) / urlRate * float64(time.Second))
+        known = true
+    }
+    if !progress.Deadline.IsZero() {
+        if left := time.Until(progress.Deadline); !known || left < eta {
+            eta, known = max(left, 0), true
+        }
+    }
+    if !known {
+        return ", ETA unknown"
+    }
+    return ", ETA " + formatDuration(eta)
+}
+
+func formatDuration(d time.Duration) string {
+    return d.Round(time.Second).String()
+}
+
+func formatBytes(bytes int64) string {
+    const unit = 1024
+    if bytes < unit {
+        return fmt.Sprintf("%d B", bytes)
+    }
+    div, exp := int64(unit), 0
+    for n := bytes / unit; n >= unit; n /= unit {
+        div *= unit
+        exp++
+    }
+    return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
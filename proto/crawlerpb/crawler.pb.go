@@ -0,0 +1,881 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.10
+// 	protoc        (unknown)
+// source: crawler.proto
+
+package crawlerpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Page struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	Id             int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Url            string                 `protobuf:"bytes,2,opt,name=url,proto3" json:"url,omitempty"`
+	Title          string                 `protobuf:"bytes,3,opt,name=title,proto3" json:"title,omitempty"`
+	Content        string                 `protobuf:"bytes,4,opt,name=content,proto3" json:"content,omitempty"`
+	StatusCode     int32                  `protobuf:"varint,5,opt,name=status_code,json=statusCode,proto3" json:"status_code,omitempty"`
+	ContentType    string                 `protobuf:"bytes,6,opt,name=content_type,json=contentType,proto3" json:"content_type,omitempty"`
+	Size           int64                  `protobuf:"varint,7,opt,name=size,proto3" json:"size,omitempty"`
+	LoadTimeMs     int64                  `protobuf:"varint,8,opt,name=load_time_ms,json=loadTimeMs,proto3" json:"load_time_ms,omitempty"`
+	Depth          int32                  `protobuf:"varint,9,opt,name=depth,proto3" json:"depth,omitempty"`
+	ParentUrl      string                 `protobuf:"bytes,10,opt,name=parent_url,json=parentUrl,proto3" json:"parent_url,omitempty"`
+	Hash           string                 `protobuf:"bytes,11,opt,name=hash,proto3" json:"hash,omitempty"`
+	Importance     float64                `protobuf:"fixed64,12,opt,name=importance,proto3" json:"importance,omitempty"`
+	ContentQuality float64                `protobuf:"fixed64,13,opt,name=content_quality,json=contentQuality,proto3" json:"content_quality,omitempty"`
+	LinkDensity    float64                `protobuf:"fixed64,14,opt,name=link_density,json=linkDensity,proto3" json:"link_density,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *Page) Reset() {
+	*x = Page{}
+	mi := &file_crawler_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Page) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Page) ProtoMessage() {}
+
+func (x *Page) ProtoReflect() protoreflect.Message {
+	mi := &file_crawler_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Page.ProtoReflect.Descriptor instead.
+func (*Page) Descriptor() ([]byte, []int) {
+	return file_crawler_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Page) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *Page) GetUrl() string {
+	if x != nil {
+		return x.Url
+	}
+	return ""
+}
+
+func (x *Page) GetTitle() string {
+	if x != nil {
+		return x.Title
+	}
+	return ""
+}
+
+func (x *Page) GetContent() string {
+	if x != nil {
+		return x.Content
+	}
+	return ""
+}
+
+func (x *Page) GetStatusCode() int32 {
+	if x != nil {
+		return x.StatusCode
+	}
+	return 0
+}
+
+func (x *Page) GetContentType() string {
+	if x != nil {
+		return x.ContentType
+	}
+	return ""
+}
+
+func (x *Page) GetSize() int64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+func (x *Page) GetLoadTimeMs() int64 {
+	if x != nil {
+		return x.LoadTimeMs
+	}
+	return 0
+}
+
+func (x *Page) GetDepth() int32 {
+	if x != nil {
+		return x.Depth
+	}
+	return 0
+}
+
+func (x *Page) GetParentUrl() string {
+	if x != nil {
+		return x.ParentUrl
+	}
+	return ""
+}
+
+func (x *Page) GetHash() string {
+	if x != nil {
+		return x.Hash
+	}
+	return ""
+}
+
+func (x *Page) GetImportance() float64 {
+	if x != nil {
+		return x.Importance
+	}
+	return 0
+}
+
+func (x *Page) GetContentQuality() float64 {
+	if x != nil {
+		return x.ContentQuality
+	}
+	return 0
+}
+
+func (x *Page) GetLinkDensity() float64 {
+	if x != nil {
+		return x.LinkDensity
+	}
+	return 0
+}
+
+type URLContext struct {
+	state            protoimpl.MessageState `protogen:"open.v1"`
+	ContentType      string                 `protobuf:"bytes,1,opt,name=content_type,json=contentType,proto3" json:"content_type,omitempty"`
+	Importance       float64                `protobuf:"fixed64,2,opt,name=importance,proto3" json:"importance,omitempty"`
+	LastModifiedUnix int64                  `protobuf:"varint,3,opt,name=last_modified_unix,json=lastModifiedUnix,proto3" json:"last_modified_unix,omitempty"`
+	LinkDensity      float64                `protobuf:"fixed64,4,opt,name=link_density,json=linkDensity,proto3" json:"link_density,omitempty"`
+	ContentQuality   float64                `protobuf:"fixed64,5,opt,name=content_quality,json=contentQuality,proto3" json:"content_quality,omitempty"`
+	SimilarityScore  float64                `protobuf:"fixed64,6,opt,name=similarity_score,json=similarityScore,proto3" json:"similarity_score,omitempty"`
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *URLContext) Reset() {
+	*x = URLContext{}
+	mi := &file_crawler_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *URLContext) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*URLContext) ProtoMessage() {}
+
+func (x *URLContext) ProtoReflect() protoreflect.Message {
+	mi := &file_crawler_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use URLContext.ProtoReflect.Descriptor instead.
+func (*URLContext) Descriptor() ([]byte, []int) {
+	return file_crawler_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *URLContext) GetContentType() string {
+	if x != nil {
+		return x.ContentType
+	}
+	return ""
+}
+
+func (x *URLContext) GetImportance() float64 {
+	if x != nil {
+		return x.Importance
+	}
+	return 0
+}
+
+func (x *URLContext) GetLastModifiedUnix() int64 {
+	if x != nil {
+		return x.LastModifiedUnix
+	}
+	return 0
+}
+
+func (x *URLContext) GetLinkDensity() float64 {
+	if x != nil {
+		return x.LinkDensity
+	}
+	return 0
+}
+
+func (x *URLContext) GetContentQuality() float64 {
+	if x != nil {
+		return x.ContentQuality
+	}
+	return 0
+}
+
+func (x *URLContext) GetSimilarityScore() float64 {
+	if x != nil {
+		return x.SimilarityScore
+	}
+	return 0
+}
+
+type URLPriority struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Url           string                 `protobuf:"bytes,1,opt,name=url,proto3" json:"url,omitempty"`
+	Priority      int32                  `protobuf:"varint,2,opt,name=priority,proto3" json:"priority,omitempty"`
+	Depth         int32                  `protobuf:"varint,3,opt,name=depth,proto3" json:"depth,omitempty"`
+	Parent        string                 `protobuf:"bytes,4,opt,name=parent,proto3" json:"parent,omitempty"`
+	Context       *URLContext            `protobuf:"bytes,5,opt,name=context,proto3" json:"context,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *URLPriority) Reset() {
+	*x = URLPriority{}
+	mi := &file_crawler_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *URLPriority) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*URLPriority) ProtoMessage() {}
+
+func (x *URLPriority) ProtoReflect() protoreflect.Message {
+	mi := &file_crawler_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use URLPriority.ProtoReflect.Descriptor instead.
+func (*URLPriority) Descriptor() ([]byte, []int) {
+	return file_crawler_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *URLPriority) GetUrl() string {
+	if x != nil {
+		return x.Url
+	}
+	return ""
+}
+
+func (x *URLPriority) GetPriority() int32 {
+	if x != nil {
+		return x.Priority
+	}
+	return 0
+}
+
+func (x *URLPriority) GetDepth() int32 {
+	if x != nil {
+		return x.Depth
+	}
+	return 0
+}
+
+func (x *URLPriority) GetParent() string {
+	if x != nil {
+		return x.Parent
+	}
+	return ""
+}
+
+func (x *URLPriority) GetContext() *URLContext {
+	if x != nil {
+		return x.Context
+	}
+	return nil
+}
+
+type CrawlStats struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	PagesProcessed int64                  `protobuf:"varint,1,opt,name=pages_processed,json=pagesProcessed,proto3" json:"pages_processed,omitempty"`
+	PagesSkipped   int64                  `protobuf:"varint,2,opt,name=pages_skipped,json=pagesSkipped,proto3" json:"pages_skipped,omitempty"`
+	Errors         int64                  `protobuf:"varint,3,opt,name=errors,proto3" json:"errors,omitempty"`
+	DurationMs     int64                  `protobuf:"varint,4,opt,name=duration_ms,json=durationMs,proto3" json:"duration_ms,omitempty"`
+	AvgLoadTimeMs  int64                  `protobuf:"varint,5,opt,name=avg_load_time_ms,json=avgLoadTimeMs,proto3" json:"avg_load_time_ms,omitempty"`
+	TotalSize      int64                  `protobuf:"varint,6,opt,name=total_size,json=totalSize,proto3" json:"total_size,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *CrawlStats) Reset() {
+	*x = CrawlStats{}
+	mi := &file_crawler_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CrawlStats) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CrawlStats) ProtoMessage() {}
+
+func (x *CrawlStats) ProtoReflect() protoreflect.Message {
+	mi := &file_crawler_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CrawlStats.ProtoReflect.Descriptor instead.
+func (*CrawlStats) Descriptor() ([]byte, []int) {
+	return file_crawler_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *CrawlStats) GetPagesProcessed() int64 {
+	if x != nil {
+		return x.PagesProcessed
+	}
+	return 0
+}
+
+func (x *CrawlStats) GetPagesSkipped() int64 {
+	if x != nil {
+		return x.PagesSkipped
+	}
+	return 0
+}
+
+func (x *CrawlStats) GetErrors() int64 {
+	if x != nil {
+		return x.Errors
+	}
+	return 0
+}
+
+func (x *CrawlStats) GetDurationMs() int64 {
+	if x != nil {
+		return x.DurationMs
+	}
+	return 0
+}
+
+func (x *CrawlStats) GetAvgLoadTimeMs() int64 {
+	if x != nil {
+		return x.AvgLoadTimeMs
+	}
+	return 0
+}
+
+func (x *CrawlStats) GetTotalSize() int64 {
+	if x != nil {
+		return x.TotalSize
+	}
+	return 0
+}
+
+type StartCrawlRequest struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Url     string                 `protobuf:"bytes,1,opt,name=url,proto3" json:"url,omitempty"`
+	Depth   int32                  `protobuf:"varint,2,opt,name=depth,proto3" json:"depth,omitempty"`
+	Workers int32                  `protobuf:"varint,3,opt,name=workers,proto3" json:"workers,omitempty"`
+	// "smart" (default) or "traditional"
+	Mode          string `protobuf:"bytes,4,opt,name=mode,proto3" json:"mode,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StartCrawlRequest) Reset() {
+	*x = StartCrawlRequest{}
+	mi := &file_crawler_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StartCrawlRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StartCrawlRequest) ProtoMessage() {}
+
+func (x *StartCrawlRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_crawler_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StartCrawlRequest.ProtoReflect.Descriptor instead.
+func (*StartCrawlRequest) Descriptor() ([]byte, []int) {
+	return file_crawler_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *StartCrawlRequest) GetUrl() string {
+	if x != nil {
+		return x.Url
+	}
+	return ""
+}
+
+func (x *StartCrawlRequest) GetDepth() int32 {
+	if x != nil {
+		return x.Depth
+	}
+	return 0
+}
+
+func (x *StartCrawlRequest) GetWorkers() int32 {
+	if x != nil {
+		return x.Workers
+	}
+	return 0
+}
+
+func (x *StartCrawlRequest) GetMode() string {
+	if x != nil {
+		return x.Mode
+	}
+	return ""
+}
+
+type StopCrawlRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	CrawlId       string                 `protobuf:"bytes,1,opt,name=crawl_id,json=crawlId,proto3" json:"crawl_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StopCrawlRequest) Reset() {
+	*x = StopCrawlRequest{}
+	mi := &file_crawler_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StopCrawlRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StopCrawlRequest) ProtoMessage() {}
+
+func (x *StopCrawlRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_crawler_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StopCrawlRequest.ProtoReflect.Descriptor instead.
+func (*StopCrawlRequest) Descriptor() ([]byte, []int) {
+	return file_crawler_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *StopCrawlRequest) GetCrawlId() string {
+	if x != nil {
+		return x.CrawlId
+	}
+	return ""
+}
+
+type GetStatsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	CrawlId       string                 `protobuf:"bytes,1,opt,name=crawl_id,json=crawlId,proto3" json:"crawl_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetStatsRequest) Reset() {
+	*x = GetStatsRequest{}
+	mi := &file_crawler_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetStatsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetStatsRequest) ProtoMessage() {}
+
+func (x *GetStatsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_crawler_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetStatsRequest.ProtoReflect.Descriptor instead.
+func (*GetStatsRequest) Descriptor() ([]byte, []int) {
+	return file_crawler_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *GetStatsRequest) GetCrawlId() string {
+	if x != nil {
+		return x.CrawlId
+	}
+	return ""
+}
+
+type StreamPagesRequest struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	CrawlId string                 `protobuf:"bytes,1,opt,name=crawl_id,json=crawlId,proto3" json:"crawl_id,omitempty"`
+	// Include page bodies in the stream; off by default to keep messages small
+	IncludeContent bool `protobuf:"varint,2,opt,name=include_content,json=includeContent,proto3" json:"include_content,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *StreamPagesRequest) Reset() {
+	*x = StreamPagesRequest{}
+	mi := &file_crawler_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StreamPagesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamPagesRequest) ProtoMessage() {}
+
+func (x *StreamPagesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_crawler_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamPagesRequest.ProtoReflect.Descriptor instead.
+func (*StreamPagesRequest) Descriptor() ([]byte, []int) {
+	return file_crawler_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *StreamPagesRequest) GetCrawlId() string {
+	if x != nil {
+		return x.CrawlId
+	}
+	return ""
+}
+
+func (x *StreamPagesRequest) GetIncludeContent() bool {
+	if x != nil {
+		return x.IncludeContent
+	}
+	return false
+}
+
+type CrawlStatus struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	CrawlId string                 `protobuf:"bytes,1,opt,name=crawl_id,json=crawlId,proto3" json:"crawl_id,omitempty"`
+	Url     string                 `protobuf:"bytes,2,opt,name=url,proto3" json:"url,omitempty"`
+	Mode    string                 `protobuf:"bytes,3,opt,name=mode,proto3" json:"mode,omitempty"`
+	// "running", "completed", "cancelled", or "failed"
+	Status          string `protobuf:"bytes,4,opt,name=status,proto3" json:"status,omitempty"`
+	Error           string `protobuf:"bytes,5,opt,name=error,proto3" json:"error,omitempty"`
+	PagesCrawled    int64  `protobuf:"varint,6,opt,name=pages_crawled,json=pagesCrawled,proto3" json:"pages_crawled,omitempty"`
+	LinksDiscovered int64  `protobuf:"varint,7,opt,name=links_discovered,json=linksDiscovered,proto3" json:"links_discovered,omitempty"`
+	Errors          int64  `protobuf:"varint,8,opt,name=errors,proto3" json:"errors,omitempty"`
+	// Final statistics, set once the crawl has finished
+	Stats         *CrawlStats `protobuf:"bytes,9,opt,name=stats,proto3" json:"stats,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CrawlStatus) Reset() {
+	*x = CrawlStatus{}
+	mi := &file_crawler_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CrawlStatus) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CrawlStatus) ProtoMessage() {}
+
+func (x *CrawlStatus) ProtoReflect() protoreflect.Message {
+	mi := &file_crawler_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CrawlStatus.ProtoReflect.Descriptor instead.
+func (*CrawlStatus) Descriptor() ([]byte, []int) {
+	return file_crawler_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *CrawlStatus) GetCrawlId() string {
+	if x != nil {
+		return x.CrawlId
+	}
+	return ""
+}
+
+func (x *CrawlStatus) GetUrl() string {
+	if x != nil {
+		return x.Url
+	}
+	return ""
+}
+
+func (x *CrawlStatus) GetMode() string {
+	if x != nil {
+		return x.Mode
+	}
+	return ""
+}
+
+func (x *CrawlStatus) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *CrawlStatus) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *CrawlStatus) GetPagesCrawled() int64 {
+	if x != nil {
+		return x.PagesCrawled
+	}
+	return 0
+}
+
+func (x *CrawlStatus) GetLinksDiscovered() int64 {
+	if x != nil {
+		return x.LinksDiscovered
+	}
+	return 0
+}
+
+func (x *CrawlStatus) GetErrors() int64 {
+	if x != nil {
+		return x.Errors
+	}
+	return 0
+}
+
+func (x *CrawlStatus) GetStats() *CrawlStats {
+	if x != nil {
+		return x.Stats
+	}
+	return nil
+}
+
+var File_crawler_proto protoreflect.FileDescriptor
+
+const file_crawler_proto_rawDesc = "" +
+	"\n" +
+	"\rcrawler.proto\x12\x0fsmartcrawler.v1\"\x87\x03\n" +
+	"\x04Page\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\x12\x10\n" +
+	"\x03url\x18\x02 \x01(\tR\x03url\x12\x14\n" +
+	"\x05title\x18\x03 \x01(\tR\x05title\x12\x18\n" +
+	"\acontent\x18\x04 \x01(\tR\acontent\x12\x1f\n" +
+	"\vstatus_code\x18\x05 \x01(\x05R\n" +
+	"statusCode\x12!\n" +
+	"\fcontent_type\x18\x06 \x01(\tR\vcontentType\x12\x12\n" +
+	"\x04size\x18\a \x01(\x03R\x04size\x12 \n" +
+	"\fload_time_ms\x18\b \x01(\x03R\n" +
+	"loadTimeMs\x12\x14\n" +
+	"\x05depth\x18\t \x01(\x05R\x05depth\x12\x1d\n" +
+	"\n" +
+	"parent_url\x18\n" +
+	" \x01(\tR\tparentUrl\x12\x12\n" +
+	"\x04hash\x18\v \x01(\tR\x04hash\x12\x1e\n" +
+	"\n" +
+	"importance\x18\f \x01(\x01R\n" +
+	"importance\x12'\n" +
+	"\x0fcontent_quality\x18\r \x01(\x01R\x0econtentQuality\x12!\n" +
+	"\flink_density\x18\x0e \x01(\x01R\vlinkDensity\"\xf4\x01\n" +
+	"\n" +
+	"URLContext\x12!\n" +
+	"\fcontent_type\x18\x01 \x01(\tR\vcontentType\x12\x1e\n" +
+	"\n" +
+	"importance\x18\x02 \x01(\x01R\n" +
+	"importance\x12,\n" +
+	"\x12last_modified_unix\x18\x03 \x01(\x03R\x10lastModifiedUnix\x12!\n" +
+	"\flink_density\x18\x04 \x01(\x01R\vlinkDensity\x12'\n" +
+	"\x0fcontent_quality\x18\x05 \x01(\x01R\x0econtentQuality\x12)\n" +
+	"\x10similarity_score\x18\x06 \x01(\x01R\x0fsimilarityScore\"\xa0\x01\n" +
+	"\vURLPriority\x12\x10\n" +
+	"\x03url\x18\x01 \x01(\tR\x03url\x12\x1a\n" +
+	"\bpriority\x18\x02 \x01(\x05R\bpriority\x12\x14\n" +
+	"\x05depth\x18\x03 \x01(\x05R\x05depth\x12\x16\n" +
+	"\x06parent\x18\x04 \x01(\tR\x06parent\x125\n" +
+	"\acontext\x18\x05 \x01(\v2\x1b.smartcrawler.v1.URLContextR\acontext\"\xdb\x01\n" +
+	"\n" +
+	"CrawlStats\x12'\n" +
+	"\x0fpages_processed\x18\x01 \x01(\x03R\x0epagesProcessed\x12#\n" +
+	"\rpages_skipped\x18\x02 \x01(\x03R\fpagesSkipped\x12\x16\n" +
+	"\x06errors\x18\x03 \x01(\x03R\x06errors\x12\x1f\n" +
+	"\vduration_ms\x18\x04 \x01(\x03R\n" +
+	"durationMs\x12'\n" +
+	"\x10avg_load_time_ms\x18\x05 \x01(\x03R\ravgLoadTimeMs\x12\x1d\n" +
+	"\n" +
+	"total_size\x18\x06 \x01(\x03R\ttotalSize\"i\n" +
+	"\x11StartCrawlRequest\x12\x10\n" +
+	"\x03url\x18\x01 \x01(\tR\x03url\x12\x14\n" +
+	"\x05depth\x18\x02 \x01(\x05R\x05depth\x12\x18\n" +
+	"\aworkers\x18\x03 \x01(\x05R\aworkers\x12\x12\n" +
+	"\x04mode\x18\x04 \x01(\tR\x04mode\"-\n" +
+	"\x10StopCrawlRequest\x12\x19\n" +
+	"\bcrawl_id\x18\x01 \x01(\tR\acrawlId\",\n" +
+	"\x0fGetStatsRequest\x12\x19\n" +
+	"\bcrawl_id\x18\x01 \x01(\tR\acrawlId\"X\n" +
+	"\x12StreamPagesRequest\x12\x19\n" +
+	"\bcrawl_id\x18\x01 \x01(\tR\acrawlId\x12'\n" +
+	"\x0finclude_content\x18\x02 \x01(\bR\x0eincludeContent\"\x97\x02\n" +
+	"\vCrawlStatus\x12\x19\n" +
+	"\bcrawl_id\x18\x01 \x01(\tR\acrawlId\x12\x10\n" +
+	"\x03url\x18\x02 \x01(\tR\x03url\x12\x12\n" +
+	"\x04mode\x18\x03 \x01(\tR\x04mode\x12\x16\n" +
+	"\x06status\x18\x04 \x01(\tR\x06status\x12\x14\n" +
+	"\x05error\x18\x05 \x01(\tR\x05error\x12#\n" +
+	"\rpages_crawled\x18\x06 \x01(\x03R\fpagesCrawled\x12)\n" +
+	"\x10links_discovered\x18\a \x01(\x03R\x0flinksDiscovered\x12\x16\n" +
+	"\x06errors\x18\b \x01(\x03R\x06errors\x121\n" +
+	"\x05stats\x18\t \x01(\v2\x1b.smartcrawler.v1.CrawlStatsR\x05stats2\xc7\x02\n" +
+	"\x0eCrawlerService\x12N\n" +
+	"\n" +
+	"StartCrawl\x12\".smartcrawler.v1.StartCrawlRequest\x1a\x1c.smartcrawler.v1.CrawlStatus\x12L\n" +
+	"\tStopCrawl\x12!.smartcrawler.v1.StopCrawlRequest\x1a\x1c.smartcrawler.v1.CrawlStatus\x12J\n" +
+	"\bGetStats\x12 .smartcrawler.v1.GetStatsRequest\x1a\x1c.smartcrawler.v1.CrawlStatus\x12K\n" +
+	"\vStreamPages\x12#.smartcrawler.v1.StreamPagesRequest\x1a\x15.smartcrawler.v1.Page0\x01B\x1fZ\x1dsmart-crawler/proto/crawlerpbb\x06proto3"
+
+var (
+	file_crawler_proto_rawDescOnce sync.Once
+	file_crawler_proto_rawDescData []byte
+)
+
+func file_crawler_proto_rawDescGZIP() []byte {
+	file_crawler_proto_rawDescOnce.Do(func() {
+		file_crawler_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_crawler_proto_rawDesc), len(file_crawler_proto_rawDesc)))
+	})
+	return file_crawler_proto_rawDescData
+}
+
+var file_crawler_proto_msgTypes = make([]protoimpl.MessageInfo, 9)
+var file_crawler_proto_goTypes = []any{
+	(*Page)(nil),               // 0: smartcrawler.v1.Page
+	(*URLContext)(nil),         // 1: smartcrawler.v1.URLContext
+	(*URLPriority)(nil),        // 2: smartcrawler.v1.URLPriority
+	(*CrawlStats)(nil),         // 3: smartcrawler.v1.CrawlStats
+	(*StartCrawlRequest)(nil),  // 4: smartcrawler.v1.StartCrawlRequest
+	(*StopCrawlRequest)(nil),   // 5: smartcrawler.v1.StopCrawlRequest
+	(*GetStatsRequest)(nil),    // 6: smartcrawler.v1.GetStatsRequest
+	(*StreamPagesRequest)(nil), // 7: smartcrawler.v1.StreamPagesRequest
+	(*CrawlStatus)(nil),        // 8: smartcrawler.v1.CrawlStatus
+}
+var file_crawler_proto_depIdxs = []int32{
+	1, // 0: smartcrawler.v1.URLPriority.context:type_name -> smartcrawler.v1.URLContext
+	3, // 1: smartcrawler.v1.CrawlStatus.stats:type_name -> smartcrawler.v1.CrawlStats
+	4, // 2: smartcrawler.v1.CrawlerService.StartCrawl:input_type -> smartcrawler.v1.StartCrawlRequest
+	5, // 3: smartcrawler.v1.CrawlerService.StopCrawl:input_type -> smartcrawler.v1.StopCrawlRequest
+	6, // 4: smartcrawler.v1.CrawlerService.GetStats:input_type -> smartcrawler.v1.GetStatsRequest
+	7, // 5: smartcrawler.v1.CrawlerService.StreamPages:input_type -> smartcrawler.v1.StreamPagesRequest
+	8, // 6: smartcrawler.v1.CrawlerService.StartCrawl:output_type -> smartcrawler.v1.CrawlStatus
+	8, // 7: smartcrawler.v1.CrawlerService.StopCrawl:output_type -> smartcrawler.v1.CrawlStatus
+	8, // 8: smartcrawler.v1.CrawlerService.GetStats:output_type -> smartcrawler.v1.CrawlStatus
+	0, // 9: smartcrawler.v1.CrawlerService.StreamPages:output_type -> smartcrawler.v1.Page
+	6, // [6:10] is the sub-list for method output_type
+	2, // [2:6] is the sub-list for method input_type
+	2, // [2:2] is the sub-list for extension type_name
+	2, // [2:2] is the sub-list for extension extendee
+	0, // [0:2] is the sub-list for field type_name
+}
+
+func init() { file_crawler_proto_init() }
+func file_crawler_proto_init() {
+	if File_crawler_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_crawler_proto_rawDesc), len(file_crawler_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   9,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_crawler_proto_goTypes,
+		DependencyIndexes: file_crawler_proto_depIdxs,
+		MessageInfos:      file_crawler_proto_msgTypes,
+	}.Build()
+	File_crawler_proto = out.File
+	file_crawler_proto_goTypes = nil
+	file_crawler_proto_depIdxs = nil
+}
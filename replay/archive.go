@@ -0,0 +1,90 @@
+package replay
+
+import (
+    "bufio"
+    "bytes"
+    "fmt"
+    "net/http"
+    "sync"
+
+    "smart-crawler/utils"
+)
+
+// Archive is a frozen corpus of raw HTTP responses keyed by URL. It is held
+// fully in memory, so it suits experiment-sized archives rather than whole
+// web-scale crawls.
+type Archive struct {
+    responses map[string][]byte
+    order     []string
+    mutex     sync.RWMutex
+}
+
+func NewArchive() *Archive {
+    return &Archive{
+        responses: make(map[string][]byte),
+    }
+}
+
+// Add stores a raw HTTP response for url; the first response recorded wins
+func (a *Archive) Add(url string, rawResponse []byte) {
+    key := utils.NormalizeURL(url)
+
+    a.mutex.Lock()
+    defer a.mutex.Unlock()
+
+    if _, exists := a.responses[key]; exists {
+        return
+    }
+    a.responses[key] = rawResponse
+    a.order = append(a.order, key)
+}
+
+func (a *Archive) Has(url string) bool {
+    a.mutex.RLock()
+    defer a.mutex.RUnlock()
+
+    _, exists := a.responses[utils.NormalizeURL(url)]
+    return exists
+}
+
+// First returns the first URL recorded in the archive, a sensible seed when
+// the requested start URL was not captured.
+func (a *Archive) First() string {
+    a.mutex.RLock()
+    defer a.mutex.RUnlock()
+
+    if len(a.order) == 0 {
+        return ""
+    }
+    return a.order[0]
+}
+
+func (a *Archive) Len() int {
+    a.mutex.RLock()
+    defer a.mutex.RUnlock()
+
+    return len(a.order)
+}
+
+// Transport is an http.RoundTripper that serves responses from an Archive
+// without touching the network.
+type Transport struct {
+    Archive *Archive
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+    t.Archive.mutex.RLock()
+    raw, exists := t.Archive.responses[utils.NormalizeURL(req.URL.String())]
+    t.Archive.mutex.RUnlock()
+
+    if !exists {
+        return nil, fmt.Errorf("replay: %s not in archive", req.URL)
+    }
+
+    resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(raw)), req)
+    if err != nil {
+        return nil, fmt.Errorf("replay: failed to parse archived response for %s: %w", req.URL, err)
+    }
+
+    return resp, nil
+}
@@ -0,0 +1,282 @@
+package replay
+
+import (
+    "bufio"
+    "bytes"
+    "compress/gzip"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "net/http/httputil"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    "smart-crawler/utils"
+)
+
+// latencyHeader is the WARC header a Cache records how long the live
+// response took in, in milliseconds
+const latencyHeader = "WARC-X-Fetch-Latency-Ms"
+
+// ErrNotCached is returned by an offline Cache's transport for a URL it has
+// no response for
+var ErrNotCached = errors.New("not in the replay cache")
+
+// Cache records live HTTP responses into an Archive and replays them,
+// keeping each response's original latency, so crawls run through it one
+// after the other see the same site at the same speed. A URL fetched for
+// the first time is fetched live and recorded; every later request for it,
+// by any crawler sharing the cache, gets the recording. GET responses are
+// recorded, and HEAD requests are answered from them.
+type Cache struct {
+    path    string
+    archive *Archive
+    offline bool
+
+    mutex    sync.Mutex
+    latency  map[string]time.Duration
+    recorded int
+    replayed int
+    inFlight map[string]*recording
+}
+
+// recording is a live fetch under way, which concurrent requests for the
+// same URL wait for
+type recording struct {
+    done chan struct{}
+    err  error
+}
+
+// OpenCache returns a cache backed by the WARC file at path, loading what
+// was recorded there before. A missing file starts an empty cache, written
+// by Save.
+func OpenCache(path string) (*Cache, error) {
+    c := &Cache{
+        path:     path,
+        archive:  NewArchive(),
+        latency:  make(map[string]time.Duration),
+        inFlight: make(map[string]*recording),
+    }
+    f, err := os.Open(path)
+    if errors.Is(err, os.ErrNotExist) {
+        return c, nil
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to open cache: %w", err)
+    }
+    defer f.Close()
+
+    reader, err := NewWARCReader(f)
+    if err != nil {
+        return nil, err
+    }
+    for {
+        record, err := reader.Next()
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            return nil, err
+        }
+        if record.Type != "response" || record.TargetURI == "" || !bytes.HasPrefix(record.Block, []byte("HTTP/")) {
+            continue
+        }
+        c.archive.Add(record.TargetURI, record.Block)
+        if ms, err := strconv.ParseInt(record.Header.Get(latencyHeader), 10, 64); err == nil {
+            c.latency[utils.NormalizeURL(record.TargetURI)] = time.Duration(ms) * time.Millisecond
+        }
+    }
+    return c, nil
+}
+
+// SetOffline makes the cache fail requests for URLs it has not recorded
+// instead of fetching them, so a run cannot reach the live site
+func (c *Cache) SetOffline(offline bool) {
+    c.offline = offline
+}
+
+// Len is how many responses the cache holds
+func (c *Cache) Len() int {
+    return c.archive.Len()
+}
+
+// Stats returns how many responses were recorded live and how many requests
+// were replayed since the cache was opened
+func (c *Cache) Stats() (recorded, replayed int) {
+    c.mutex.Lock()
+    defer c.mutex.Unlock()
+
+    return c.recorded, c.replayed
+}
+
+// Transport returns a RoundTripper that replays recorded responses and
+// records the rest through base
+func (c *Cache) Transport(base http.RoundTripper) http.RoundTripper {
+    return &cacheTransport{cache: c, base: base}
+}
+
+type cacheTransport struct {
+    cache *Cache
+    base  http.RoundTripper
+}
+
+func (t *cacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+    if req.Method != http.MethodGet && req.Method != http.MethodHead {
+        return t.base.RoundTrip(req)
+    }
+    c := t.cache
+    key := utils.NormalizeURL(req.URL.String())
+
+    for {
+        c.mutex.Lock()
+        if c.archive.Has(key) {
+            c.replayed++
+            latency := c.latency[key]
+            c.mutex.Unlock()
+            return c.replay(req, key, latency)
+        }
+        if c.offline {
+            c.mutex.Unlock()
+            return nil, fmt.Errorf("replay: %s: %w", req.URL, ErrNotCached)
+        }
+        pending := c.inFlight[key]
+        if pending == nil {
+            pending = &recording{done: make(chan struct{})}
+            c.inFlight[key] = pending
+            c.mutex.Unlock()
+            return t.record(req, key, pending)
+        }
+        c.mutex.Unlock()
+
+        select {
+        case <-pending.done:
+        case <-req.Context().Done():
+            return nil, req.Context().Err()
+        }
+        if pending.err != nil {
+            return nil, pending.err
+        }
+    }
+}
+
+// replay serves the recorded response for key after its original latency
+func (c *Cache) replay(req *http.Request, key string, latency time.Duration) (*http.Response, error) {
+    if latency > 0 {
+        timer := time.NewTimer(latency)
+        defer timer.Stop()
+        select {
+        case <-timer.C:
+        case <-req.Context().Done():
+            return nil, req.Context().Err()
+        }
+    }
+    c.archive.mutex.RLock()
+    raw := c.archive.responses[key]
+    c.archive.mutex.RUnlock()
+
+    // A HEAD request's response is read without its body
+    resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(raw)), req)
+    if err != nil {
+        return nil, fmt.Errorf("replay: failed to parse cached response for %s: %w", req.URL, err)
+    }
+    return resp, nil
+}
+
+// record fetches req live, with GET even for a HEAD request, and adds the
+// response to the archive before replaying it. A failed fetch is not
+// recorded, and is tried again by the next request for the URL.
+func (t *cacheTransport) record(req *http.Request, key string, pending *recording) (*http.Response, error) {
+    c := t.cache
+    defer func() {
+        c.mutex.Lock()
+        delete(c.inFlight, key)
+        c.mutex.Unlock()
+        close(pending.done)
+    }()
+
+    live := req
+    if req.Method == http.MethodHead {
+        live = req.Clone(req.Context())
+        live.Method = http.MethodGet
+    }
+    start := time.Now()
+    resp, err := t.base.RoundTrip(live)
+    if err != nil {
+        pending.err = err
+        return nil, err
+    }
+    // Dumping reads the whole body, which counts towards the latency
+    raw, err := httputil.DumpResponse(resp, true)
+    resp.Body.Close()
+    if err != nil {
+        pending.err = err
+        return nil, err
+    }
+    latency := time.Since(start)
+
+    c.mutex.Lock()
+    c.archive.Add(key, raw)
+    c.latency[key] = latency
+    c.recorded++
+    c.mutex.Unlock()
+    return c.replay(req, key, 0)
+}
+
+// Save writes every recorded response to the cache's file, replacing it,
+// gzipped when its name ends in .gz
+func (c *Cache) Save() error {
+    c.mutex.Lock()
+    latency := make(map[string]time.Duration, len(c.latency))
+    for key, d := range c.latency {
+        latency[key] = d
+    }
+    c.mutex.Unlock()
+
+    // Written beside the file and renamed over it, so an interrupted save
+    // leaves the previous recording intact
+    tmp, err := os.CreateTemp(filepath.Dir(c.path), filepath.Base(c.path)+".*")
+    if err != nil {
+        return fmt.Errorf("failed to write cache: %w", err)
+    }
+    defer os.Remove(tmp.Name())
+
+    var out io.Writer = tmp
+    var gz *gzip.Writer
+    if strings.HasSuffix(c.path, ".gz") {
+        gz = gzip.NewWriter(tmp)
+        out = gz
+    }
+    writer := bufio.NewWriter(out)
+    c.archive.mutex.RLock()
+    for _, key := range c.archive.order {
+        header := make(map[string]string)
+        if d, ok := latency[key]; ok {
+            header[latencyHeader] = strconv.FormatInt(d.Milliseconds(), 10)
+        }
+        if err = writeWARCResponse(writer, key, c.archive.responses[key], header); err != nil {
+            break
+        }
+    }
+    c.archive.mutex.RUnlock()
+    if err == nil {
+        err = writer.Flush()
+    }
+    if err == nil && gz != nil {
+        err = gz.Close()
+    }
+    if err == nil {
+        err = tmp.Chmod(0644)
+    }
+    if closeErr := tmp.Close(); err == nil {
+        err = closeErr
+    }
+    if err != nil {
+        return fmt.Errorf("failed to write cache: %w", err)
+    }
+    return os.Rename(tmp.Name(), c.path)
+}
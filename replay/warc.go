@@ -0,0 +1,149 @@
+package replay
+
+import (
+    "bufio"
+    "bytes"
+    "compress/gzip"
+    "fmt"
+    "io"
+    "net/textproto"
+    "os"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/google/uuid"
+)
+
+// Record is a single WARC record with its named headers and raw block
+type Record struct {
+    Type      string
+    TargetURI string
+    Header    textproto.MIMEHeader
+    Block     []byte
+}
+
+// WARCReader reads records sequentially from a WARC stream
+type WARCReader struct {
+    r  *bufio.Reader
+    tp *textproto.Reader
+}
+
+// NewWARCReader wraps r, transparently decompressing gzipped archives
+// (including per-record gzip members as written by most WARC tools).
+func NewWARCReader(r io.Reader) (*WARCReader, error) {
+    br := bufio.NewReader(r)
+    magic, err := br.Peek(2)
+    if err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+        gz, err := gzip.NewReader(br)
+        if err != nil {
+            return nil, fmt.Errorf("failed to open gzip stream: %w", err)
+        }
+        br = bufio.NewReader(gz)
+    }
+
+    return &WARCReader{r: br, tp: textproto.NewReader(br)}, nil
+}
+
+// Next returns the next record, or io.EOF when the archive is exhausted
+func (w *WARCReader) Next() (*Record, error) {
+    // Skip blank lines separating records
+    var version string
+    for {
+        line, err := w.tp.ReadLine()
+        if err != nil {
+            return nil, err
+        }
+        if line = strings.TrimSpace(line); line != "" {
+            version = line
+            break
+        }
+    }
+
+    if !strings.HasPrefix(version, "WARC/") {
+        return nil, fmt.Errorf("invalid WARC record header %q", version)
+    }
+
+    header, err := w.tp.ReadMIMEHeader()
+    if err != nil {
+        return nil, fmt.Errorf("failed to read WARC headers: %w", err)
+    }
+
+    length, err := strconv.ParseInt(header.Get("Content-Length"), 10, 64)
+    if err != nil || length < 0 {
+        return nil, fmt.Errorf("invalid WARC Content-Length %q", header.Get("Content-Length"))
+    }
+
+    block := make([]byte, length)
+    if _, err := io.ReadFull(w.r, block); err != nil {
+        return nil, fmt.Errorf("failed to read WARC block: %w", err)
+    }
+
+    return &Record{
+        Type:      header.Get("WARC-Type"),
+        TargetURI: strings.Trim(header.Get("WARC-Target-URI"), "<>"),
+        Header:    header,
+        Block:     block,
+    }, nil
+}
+
+// LoadWARC reads every response record from the archive at path
+func LoadWARC(path string) (*Archive, error) {
+    f, err := os.Open(path)
+    if err != nil {
+        return nil, fmt.Errorf("failed to open archive: %w", err)
+    }
+    defer f.Close()
+
+    reader, err := NewWARCReader(f)
+    if err != nil {
+        return nil, err
+    }
+
+    archive := NewArchive()
+    for {
+        record, err := reader.Next()
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            return nil, err
+        }
+
+        if record.Type != "response" || record.TargetURI == "" {
+            continue
+        }
+        if !bytes.HasPrefix(record.Block, []byte("HTTP/")) {
+            continue
+        }
+
+        archive.Add(record.TargetURI, record.Block)
+    }
+
+    return archive, nil
+}
+
+// writeWARCResponse writes a WARC response record holding the raw HTTP
+// response for targetURI, with any extra named headers
+func writeWARCResponse(w io.Writer, targetURI string, rawResponse []byte, extra map[string]string) error {
+    var header strings.Builder
+    header.WriteString("WARC/1.0\r\n")
+    header.WriteString("WARC-Type: response\r\n")
+    header.WriteString("WARC-Record-ID: <urn:uuid:" + uuid.NewString() + ">\r\n")
+    header.WriteString("WARC-Date: " + time.Now().UTC().Format(time.RFC3339) + "\r\n")
+    header.WriteString("WARC-Target-URI: " + targetURI + "\r\n")
+    header.WriteString("Content-Type: application/http; msgtype=response\r\n")
+    for name, value := range extra {
+        header.WriteString(name + ": " + value + "\r\n")
+    }
+    header.WriteString("Content-Length: " + strconv.Itoa(len(rawResponse)) + "\r\n\r\n")
+
+    if _, err := io.WriteString(w, header.String()); err != nil {
+        return err
+    }
+    if _, err := w.Write(rawResponse); err != nil {
+        return err
+    }
+    _, err := io.WriteString(w, "\r\n\r\n")
+    return err
+}
@@ -0,0 +1,65 @@
+package tracing
+
+import (
+    "context"
+    "fmt"
+    "strings"
+
+    "go.opentelemetry.io/otel"
+    "go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+    "go.opentelemetry.io/otel/sdk/resource"
+    sdktrace "go.opentelemetry.io/otel/sdk/trace"
+    semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// Config says where spans are exported
+type Config struct {
+    Endpoint       string // OTLP/HTTP collector base URL; traces go to its /v1/traces
+    TracesEndpoint string // Full URL for traces, in place of Endpoint's
+    ServiceName    string
+}
+
+// Enabled reports whether an endpoint is set
+func (c Config) Enabled() bool {
+    return c.Endpoint != "" || c.TracesEndpoint != ""
+}
+
+// tracesURL is where the collector accepts traces
+func (c Config) tracesURL() string {
+    if c.TracesEndpoint != "" {
+        return c.TracesEndpoint
+    }
+    return strings.TrimSuffix(c.Endpoint, "/") + "/v1/traces"
+}
+
+// Start installs a global tracer provider that exports spans in batches to
+// the OTLP/HTTP collector of cfg. Until it is called, or when cfg sets no
+// endpoint, spans are dropped. The other OTEL_EXPORTER_OTLP_* variables
+// (headers, timeout, compression), OTEL_TRACES_SAMPLER, and
+// OTEL_RESOURCE_ATTRIBUTES are honored. The returned function flushes the
+// spans still buffered and stops the exporter.
+func Start(ctx context.Context, cfg Config) (func(context.Context) error, error) {
+    if !cfg.Enabled() {
+        return func(context.Context) error { return nil }, nil
+    }
+
+    exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(cfg.tracesURL()))
+    if err != nil {
+        return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+    }
+    res, err := resource.New(ctx,
+        resource.WithAttributes(semconv.ServiceName(cfg.ServiceName)),
+        resource.WithFromEnv(),
+        resource.WithTelemetrySDK(),
+    )
+    if err != nil {
+        return nil, fmt.Errorf("invalid OTEL_RESOURCE_ATTRIBUTES: %w", err)
+    }
+
+    provider := sdktrace.NewTracerProvider(
+        sdktrace.WithBatcher(exporter),
+        sdktrace.WithResource(res),
+    )
+    otel.SetTracerProvider(provider)
+    return provider.Shutdown, nil
+}
@@ -0,0 +1,186 @@
+package utils
+
+import (
+    "net/url"
+    "sort"
+    "strings"
+)
+
+// DefaultTrackingParams are the query parameters NormalizeURL removes:
+// campaign and click identifiers that analytics add to links, which change
+// the URL of a page without changing the page. A trailing * matches every
+// parameter starting with what comes before it.
+var DefaultTrackingParams = []string{
+    "utm_*", "fbclid", "gclid", "gclsrc", "dclid", "msclkid", "yclid",
+    "mc_cid", "mc_eid", "igshid", "_ga", "_gl", "_hsenc", "_hsmi", "mkt_tok",
+}
+
+// DefaultSessionParams are the query parameters URL fingerprints ignore:
+// session IDs, which sites without cookies add to every link, so each visit
+// sees its own URLs for the same pages
+var DefaultSessionParams = []string{
+    "jsessionid", "phpsessid", "aspsessionid*", "sessionid", "session_id",
+    "sid", "cfid", "cftoken", "zenid", "oscsid",
+}
+
+// URLNormalizer rewrites the variants of a URL that lead to the same page to
+// one form, so a crawl queues and fetches the page once. It lowercases the
+// scheme and host, removes the default port, the fragment, and tracking
+// parameters, sorts the query parameters, collapses repeated slashes in the
+// path, and removes a trailing slash from it.
+type URLNormalizer struct {
+    // Query parameters removed, case-insensitively; a trailing * matches a
+    // prefix
+    TrackingParams []string
+    // Keep trailing slashes, for sites serving different pages at /dir and
+    // /dir/ instead of redirecting one to the other
+    KeepTrailingSlash bool
+    // Query and path parameters that fingerprints leave out, matched like
+    // TrackingParams. Unlike tracking parameters they stay in the URL, as
+    // the site may need them to serve the page.
+    SessionParams []string
+}
+
+var defaultNormalizer = &URLNormalizer{TrackingParams: DefaultTrackingParams, SessionParams: DefaultSessionParams}
+
+// NormalizeURL normalizes rawURL with the DefaultTrackingParams
+func NormalizeURL(rawURL string) string {
+    return defaultNormalizer.Normalize(rawURL)
+}
+
+// Normalize returns the normal form of rawURL. URLs that do not parse are
+// returned as they are, and URLs other than HTTP(S) lose only their
+// fragment. A nil URLNormalizer normalizes like NormalizeURL.
+func (n *URLNormalizer) Normalize(rawURL string) string {
+    if n == nil {
+        n = defaultNormalizer
+    }
+    u, err := url.Parse(rawURL)
+    if err != nil {
+        return rawURL
+    }
+    u.Fragment, u.RawFragment = "", ""
+    u.Scheme = strings.ToLower(u.Scheme)
+    if u.Scheme != "http" && u.Scheme != "https" || u.Opaque != "" {
+        return u.String()
+    }
+
+    host := strings.ToLower(u.Hostname())
+    if strings.Contains(host, ":") {
+        // An IPv6 literal
+        host = "[" + host + "]"
+    }
+    if port := u.Port(); port != "" && !(u.Scheme == "http" && port == "80" || u.Scheme == "https" && port == "443") {
+        host += ":" + port
+    }
+    u.Host = host
+
+    path := u.EscapedPath()
+    for strings.Contains(path, "//") {
+        path = strings.ReplaceAll(path, "//", "/")
+    }
+    if !n.KeepTrailingSlash && len(path) > 1 {
+        path = strings.TrimRight(path, "/")
+    }
+    if path == "" {
+        path = "/"
+    }
+    if unescaped, err := url.PathUnescape(path); err == nil {
+        u.Path, u.RawPath = unescaped, path
+    }
+
+    u.RawQuery = n.normalizeQuery(u.RawQuery)
+    u.ForceQuery = false
+    return u.String()
+}
+
+// Fingerprint identifies the page at rawURL whatever the variant of its URL:
+// the normalized host and path with the query parameters that matter,
+// e.g. "example.com/item?id=5". It leaves out the scheme, so the http and
+// https URLs of a page share a fingerprint, and session parameters, whether
+// in the query or on a path segment like ";jsessionid=...". Crawls queue
+// each fingerprint once. URLs that do not parse are their own fingerprint.
+func (n *URLNormalizer) Fingerprint(rawURL string) string {
+    if n == nil {
+        n = defaultNormalizer
+    }
+    u, err := url.Parse(n.Normalize(rawURL))
+    if err != nil || u.Host == "" {
+        return rawURL
+    }
+
+    segments := strings.Split(u.EscapedPath(), "/")
+    for i, segment := range segments {
+        name, param, ok := strings.Cut(segment, ";")
+        if !ok {
+            continue
+        }
+        var kept []string
+        for _, p := range strings.Split(param, ";") {
+            key, _, _ := strings.Cut(p, "=")
+            if !matchParam(key, n.SessionParams) {
+                kept = append(kept, p)
+            }
+        }
+        segments[i] = strings.Join(append([]string{name}, kept...), ";")
+    }
+    fingerprint := u.Host + strings.Join(segments, "/")
+    if query := filterQuery(u.RawQuery, n.SessionParams); query != "" {
+        fingerprint += "?" + query
+    }
+    return fingerprint
+}
+
+// normalizeQuery drops the tracking and empty parameters of a raw query and
+// sorts the rest by name, keeping the order of a repeated parameter's
+// values and each parameter's encoding
+func (n *URLNormalizer) normalizeQuery(rawQuery string) string {
+    return filterQuery(rawQuery, n.TrackingParams)
+}
+
+// filterQuery drops the parameters of a raw query matching patterns, and
+// empty ones, and sorts the rest by name like normalizeQuery
+func filterQuery(rawQuery string, patterns []string) string {
+    if rawQuery == "" {
+        return ""
+    }
+    type param struct {
+        name string
+        raw  string
+    }
+    var params []param
+    for _, raw := range strings.Split(rawQuery, "&") {
+        name, _, _ := strings.Cut(raw, "=")
+        if unescaped, err := url.QueryUnescape(name); err == nil {
+            name = unescaped
+        }
+        if name == "" || matchParam(name, patterns) {
+            continue
+        }
+        params = append(params, param{name, raw})
+    }
+    sort.SliceStable(params, func(i, j int) bool { return params[i].name < params[j].name })
+
+    kept := make([]string, len(params))
+    for i, p := range params {
+        kept[i] = p.raw
+    }
+    return strings.Join(kept, "&")
+}
+
+// matchParam reports whether the parameter name matches one of patterns,
+// case-insensitively, where a trailing * matches a prefix
+func matchParam(name string, patterns []string) bool {
+    name = strings.ToLower(name)
+    for _, pattern := range patterns {
+        pattern = strings.ToLower(pattern)
+        if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+            if strings.HasPrefix(name, prefix) {
+                return true
+            }
+        } else if name == pattern {
+            return true
+        }
+    }
+    return false
+}
@@ -5,7 +5,31 @@ import (
     "strings"
 )
 
+// Stylesheets, scripts, and images: what pages need to display, which only
+// mirrors fetch
+var assetPatterns = []string{".css", ".js", ".png", ".jpg", ".jpeg", ".gif", ".svg", ".ico"}
+
+// PDF and Word documents, which only crawls extracting their text fetch
+var documentPatterns = []string{".pdf", ".docx"}
+
+// Downloads and links that are not web pages
+var nonPagePatterns = []string{".zip", ".exe", ".dmg", "mailto:", "tel:"}
+
+// URLKinds are what a crawl fetches besides pages
+type URLKinds struct {
+    Assets    bool // Stylesheets, scripts, and images, as mirrors fetch
+    Documents bool // PDF and Word documents, for their text
+}
+
+// IsValidURL reports whether rawURL is an HTTP(S) URL worth crawling as a
+// page; assets, documents, downloads, and mailto: and tel: links are not
 func IsValidURL(rawURL string) bool {
+    return IsValidURLFor(rawURL, URLKinds{})
+}
+
+// IsValidURLFor is IsValidURL for a crawl that fetches kinds of URLs
+// besides pages
+func IsValidURLFor(rawURL string, kinds URLKinds) bool {
     if rawURL == "" {
         return false
     }
@@ -26,34 +50,31 @@ func IsValidURL(rawURL string) bool {
     }
 
     // Filter out common non-content URLs
-    excludePatterns := []string{
-        ".css", ".js", ".png", ".jpg", ".jpeg", ".gif", ".svg", ".ico",
-        ".pdf", ".zip", ".exe", ".dmg", "mailto:", "tel:",
+    if !kinds.Assets && IsAssetURL(rawURL) {
+        return false
     }
-
-    lowerURL := strings.ToLower(rawURL)
-    for _, pattern := range excludePatterns {
-        if strings.Contains(lowerURL, pattern) {
-            return false
-        }
+    if !kinds.Documents && IsDocumentURL(rawURL) {
+        return false
     }
+    return !containsAny(rawURL, nonPagePatterns)
+}
 
-    return true
+// IsAssetURL reports whether rawURL looks like a stylesheet, script, or image
+func IsAssetURL(rawURL string) bool {
+    return containsAny(rawURL, assetPatterns)
 }
 
-func NormalizeURL(rawURL string) string {
-    u, err := url.Parse(rawURL)
-    if err != nil {
-        return rawURL
-    }
+// IsDocumentURL reports whether rawURL looks like a PDF or Word document
+func IsDocumentURL(rawURL string) bool {
+    return containsAny(rawURL, documentPatterns)
+}
 
-    // Remove fragment
-    u.Fragment = ""
-    
-    // Normalize path
-    if u.Path == "" {
-        u.Path = "/"
+func containsAny(rawURL string, patterns []string) bool {
+    lowerURL := strings.ToLower(rawURL)
+    for _, pattern := range patterns {
+        if strings.Contains(lowerURL, pattern) {
+            return true
+        }
     }
-
-    return u.String()
+    return false
 }